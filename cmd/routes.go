@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/Bashar444/VTP/pkg/admin"
+	"github.com/Bashar444/VTP/pkg/assignment"
+	"github.com/Bashar444/VTP/pkg/attendance"
+	"github.com/Bashar444/VTP/pkg/auth"
+	"github.com/Bashar444/VTP/pkg/calendar"
+	"github.com/Bashar444/VTP/pkg/course"
+	"github.com/Bashar444/VTP/pkg/db"
+	"github.com/Bashar444/VTP/pkg/instructor"
+	"github.com/Bashar444/VTP/pkg/material"
+	"github.com/Bashar444/VTP/pkg/meeting"
+	"github.com/Bashar444/VTP/pkg/notification"
+	"github.com/Bashar444/VTP/pkg/poll"
+	"github.com/Bashar444/VTP/pkg/recording"
+	"github.com/Bashar444/VTP/pkg/router"
+	"github.com/Bashar444/VTP/pkg/signalling"
+	"github.com/Bashar444/VTP/pkg/streaming"
+	"github.com/Bashar444/VTP/pkg/subject"
+	"github.com/Bashar444/VTP/pkg/videointegration"
+)
+
+// routeHandlers collects every handler served by the API. Handlers whose
+// dependencies are unavailable (for example without a database) are nil and
+// their routes are not registered.
+type routeHandlers struct {
+	authMiddleware   *auth.AuthMiddleware
+	courseAuthorizer *course.CourseAuthorizer
+
+	health        http.HandlerFunc
+	ready         http.HandlerFunc
+	metrics       http.Handler
+	auth          *auth.AuthHandler
+	passwordReset *auth.PasswordResetHandler
+	twoFactor     *auth.TwoFactorHandler
+	guard         *auth.GuardHandler
+	admin         *admin.Handler
+
+	socketIO   http.Handler
+	signalling *signalling.APIHandler
+
+	recording *recording.RecordingHandlers
+	storage   *recording.StorageHandlers
+	playback  *recording.PlaybackHandlers
+
+	course       *course.CourseHandlers
+	instructor   *instructor.Handler
+	subject      *subject.Handler
+	meeting      *meeting.Handler
+	material     *material.Handler
+	assignment   *assignment.Handler
+	attendance   *attendance.Handler
+	notification *notification.Handler
+	calendar     *calendar.Handler
+	poll         *poll.Handler
+	video        *videointegration.Handler
+
+	abr          *streaming.ABRHandlers
+	transcoding  *streaming.TranscodingHandlers
+	distribution *streaming.DistributionHandlers
+}
+
+// registerRoutes registers every API route on the router
+func registerRoutes(rt *router.Router, h routeHandlers) {
+	am := h.authMiddleware
+	authz := h.courseAuthorizer
+
+	// Health, metrics and profiling
+	if h.health != nil {
+		rt.HandleFunc("GET /health", h.health)
+	}
+	if h.ready != nil {
+		rt.HandleFunc("GET /ready", h.ready)
+	}
+	if h.metrics != nil {
+		rt.Handle("GET /metrics", h.metrics)
+	}
+	rt.Handle("/debug/pprof/", http.DefaultServeMux)
+
+	// Authentication
+	if h.auth != nil {
+		h.auth.RegisterRoutes(rt, am)
+	}
+	if h.passwordReset != nil {
+		h.passwordReset.RegisterRoutes(rt)
+	}
+	if h.twoFactor != nil {
+		h.twoFactor.RegisterRoutes(rt, am)
+	}
+	if h.guard != nil {
+		h.guard.RegisterRoutes(rt, am)
+	}
+	if h.admin != nil {
+		h.admin.RegisterRoutes(rt)
+	}
+
+	// WebRTC signalling
+	if h.socketIO != nil {
+		rt.Handle("/socket.io/", h.socketIO)
+	}
+	if h.signalling != nil {
+		h.signalling.RegisterRoutes(rt)
+	}
+
+	// Recordings
+	if h.recording != nil {
+		h.recording.RegisterRoutes(rt, am, authz)
+	}
+	if h.storage != nil {
+		h.storage.RegisterStorageRoutes(rt, am, authz)
+	}
+	if h.playback != nil {
+		h.playback.RegisterPlaybackRoutes(rt, am, authz)
+	}
+
+	// Courses and school management
+	if h.course != nil {
+		h.course.RegisterCourseRoutes(rt, am)
+	}
+	if h.instructor != nil {
+		h.instructor.RegisterRoutes(rt, am)
+	}
+	if h.subject != nil {
+		h.subject.RegisterRoutes(rt, am)
+	}
+	if h.meeting != nil {
+		h.meeting.RegisterRoutes(rt, am, authz)
+	}
+	if h.material != nil {
+		h.material.RegisterRoutes(rt, am, authz)
+	}
+	if h.assignment != nil {
+		h.assignment.RegisterRoutes(rt, am, authz)
+	}
+	if h.attendance != nil {
+		h.attendance.RegisterRoutes(rt, am, authz)
+	}
+	if h.notification != nil {
+		h.notification.RegisterRoutes(rt, am)
+	}
+	if h.calendar != nil {
+		h.calendar.RegisterRoutes(rt, am)
+	}
+	if h.poll != nil {
+		h.poll.RegisterRoutes(rt, am, authz)
+	}
+	if h.video != nil {
+		h.video.RegisterRoutes(rt, am, authz)
+	}
+
+	// Adaptive bitrate, transcoding and live distribution
+	if h.abr != nil {
+		h.abr.RegisterABRRoutes(rt, am, authz)
+	}
+	if h.transcoding != nil {
+		h.transcoding.RegisterTranscodingRoutes(rt, am, authz)
+	}
+	if h.distribution != nil {
+		h.distribution.RegisterDistributionRoutes(rt, am, authz)
+	}
+}
+
+// healthHandler is the liveness probe. It reports service, database and
+// signalling cluster health; cluster problems do not fail it, as restarting
+// the replica does not fix them.
+func healthHandler(database *db.Database, sig *signalling.SignallingServer) http.HandlerFunc {
+	return healthCheck(database, sig, false)
+}
+
+// readyHandler is the readiness probe. It also fails while the replica
+// cannot reach the signalling cluster, as it would only see part of each
+// room. Sessions reaching the wrong replica are reported but do not fail
+// it: the load balancer causes them on every replica alike.
+func readyHandler(database *db.Database, sig *signalling.SignallingServer) http.HandlerFunc {
+	return healthCheck(database, sig, true)
+}
+
+// healthCheck reports service, database and signalling health
+func healthCheck(database *db.Database, sig *signalling.SignallingServer, readiness bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		// Check database connectivity
+		dbHealthy := true
+		if database != nil {
+			if err := database.Conn().Ping(); err != nil {
+				dbHealthy = false
+			}
+		}
+
+		// Report how this replica shares rooms with the others and whether
+		// the load balancer keeps sessions on it
+		var cluster *signalling.ClusterStatus
+		if sig != nil {
+			status := sig.ClusterStatus()
+			cluster = &status
+		}
+
+		// Determine overall health status
+		healthy := dbHealthy
+		if readiness && cluster != nil && !cluster.Ready() {
+			healthy = false
+		}
+		status := "healthy"
+		statusCode := http.StatusOK
+
+		if !healthy {
+			status = "unhealthy"
+			statusCode = http.StatusServiceUnavailable
+		}
+
+		// Get instance ID from environment
+		instanceID := os.Getenv("INSTANCE_ID")
+		if instanceID == "" {
+			instanceID = "unknown"
+		}
+
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":     status,
+			"service":    "vtp-platform",
+			"version":    "1.0.0",
+			"instance":   instanceID,
+			"database":   dbHealthy,
+			"signalling": cluster,
+		})
+	}
+}
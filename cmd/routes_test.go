@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/admin"
+	"github.com/Bashar444/VTP/pkg/assignment"
+	"github.com/Bashar444/VTP/pkg/attendance"
+	"github.com/Bashar444/VTP/pkg/auth"
+	"github.com/Bashar444/VTP/pkg/calendar"
+	"github.com/Bashar444/VTP/pkg/course"
+	"github.com/Bashar444/VTP/pkg/instructor"
+	"github.com/Bashar444/VTP/pkg/logging"
+	"github.com/Bashar444/VTP/pkg/material"
+	"github.com/Bashar444/VTP/pkg/meeting"
+	"github.com/Bashar444/VTP/pkg/monitoring"
+	"github.com/Bashar444/VTP/pkg/notification"
+	"github.com/Bashar444/VTP/pkg/poll"
+	"github.com/Bashar444/VTP/pkg/recording"
+	"github.com/Bashar444/VTP/pkg/router"
+	"github.com/Bashar444/VTP/pkg/signalling"
+	"github.com/Bashar444/VTP/pkg/streaming"
+	"github.com/Bashar444/VTP/pkg/subject"
+	"github.com/Bashar444/VTP/pkg/videointegration"
+	"github.com/google/uuid"
+)
+
+// newTestRouter registers every route with probe handlers in place of the
+// real ones. A probe reports the pattern it was registered for and fails the
+// request if a path parameter of its route is empty.
+func newTestRouter() *router.Router {
+	am := auth.NewAuthMiddleware(auth.NewTokenService("test-secret", 1, 1))
+
+	rt := router.New()
+	rt.Intercept(func(route router.Route, h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Route", route.Pattern)
+			for _, param := range route.Params() {
+				if r.PathValue(param) == "" {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+			}
+			w.WriteHeader(http.StatusOK)
+		})
+	})
+
+	registerRoutes(rt, routeHandlers{
+		authMiddleware:   am,
+		courseAuthorizer: course.NewCourseAuthorizer(nil, 0, nil),
+		health:           healthHandler(nil, nil),
+		ready:            readyHandler(nil, nil),
+		metrics:          monitoring.NewRegistry().Handler(),
+		auth:             auth.NewAuthHandler(nil, nil, nil),
+		passwordReset:    auth.NewPasswordResetHandler(nil),
+		twoFactor:        auth.NewTwoFactorHandler(nil),
+		guard:            auth.NewGuardHandler(nil),
+		admin:            admin.NewHandler(admin.NewStore(), am),
+		socketIO:         http.NotFoundHandler(),
+		signalling:       signalling.NewAPIHandler(nil, am),
+		recording:        recording.NewRecordingHandlers(nil, nil),
+		storage:          recording.NewStorageHandlers(nil, nil, nil),
+		playback:         recording.NewPlaybackHandlers(nil, nil, nil),
+		course:           course.NewCourseHandlers(nil, nil),
+		instructor:       instructor.NewHandler(nil),
+		subject:          subject.NewHandler(nil),
+		meeting:          meeting.NewHandler(nil),
+		material:         material.NewHandler(nil),
+		assignment:       assignment.NewHandler(nil),
+		attendance:       attendance.NewHandler(nil),
+		notification:     notification.NewHandler(nil),
+		calendar:         calendar.NewHandler(nil),
+		poll:             poll.NewHandler(nil),
+		video:            videointegration.NewHandler(nil),
+		abr:              streaming.NewABRHandlers(nil, nil),
+		transcoding:      streaming.NewTranscodingHandlers(nil, nil),
+		distribution:     streaming.NewDistributionHandlers(nil),
+	})
+	return rt
+}
+
+// samplePath fills the path parameters of a route with sample values
+func samplePath(route router.Route) string {
+	id := uuid.New().String()
+	path := route.Path
+	for _, param := range route.Params() {
+		path = strings.Replace(path, "{"+param+"}", id, 1)
+		path = strings.Replace(path, "{"+param+"...}", id, 1)
+	}
+	return strings.TrimSuffix(path, "{$}")
+}
+
+// TestRouteTable tests that every registered route is reachable with its
+// path parameters populated and that no other route shadows it
+func TestRouteTable(t *testing.T) {
+	rt := newTestRouter()
+
+	routes := rt.Routes()
+	if len(routes) == 0 {
+		t.Fatal("No routes registered")
+	}
+
+	for _, route := range routes {
+		method := route.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		req := httptest.NewRequest(method, samplePath(route), nil)
+		rec := httptest.NewRecorder()
+
+		rt.ServeHTTP(rec, req)
+		if got := rec.Header().Get("X-Route"); got != route.Pattern {
+			t.Errorf("%s %s: expected route %q, got %q (status %d)", method, req.URL.Path, route.Pattern, got, rec.Code)
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: path parameters not populated", route.Pattern)
+		}
+	}
+
+	t.Logf("✓ %d routes reachable", len(routes))
+}
+
+// TestRouteMethods tests that routes reject methods they were not registered for
+func TestRouteMethods(t *testing.T) {
+	rt := newTestRouter()
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/api/v1/auth/login", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/v1/subjects/" + uuid.New().String(), http.StatusMethodNotAllowed},
+		{http.MethodPatch, "/api/v1/meetings/" + uuid.New().String(), http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/v1/unknown", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		rec := httptest.NewRecorder()
+
+		rt.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("%s %s: expected status %d, got %d", test.method, test.path, test.status, rec.Code)
+		}
+	}
+
+	t.Log("✓ Unregistered methods rejected")
+}
+
+// errStubDB is returned by every statement run against stubDB
+var errStubDB = errors.New("stub database")
+
+// stubDB is a database/sql connector that records the arguments of every
+// statement and fails it, so services built on it show what their handler
+// passed down without a database
+type stubDB struct {
+	mu   sync.Mutex
+	args []driver.NamedValue
+}
+
+func (s *stubDB) Connect(ctx context.Context) (driver.Conn, error) { return stubConn{s}, nil }
+func (s *stubDB) Driver() driver.Driver                            { return nil }
+
+// received reports whether a statement was run with value as an argument
+func (s *stubDB) received(value string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, arg := range s.args {
+		if fmt.Sprint(arg.Value) == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *stubDB) reset() {
+	s.mu.Lock()
+	s.args = nil
+	s.mu.Unlock()
+}
+
+type stubConn struct{ db *stubDB }
+
+func (c stubConn) Prepare(query string) (driver.Stmt, error) { return nil, errStubDB }
+func (c stubConn) Close() error                              { return nil }
+func (c stubConn) Begin() (driver.Tx, error)                 { return nil, errStubDB }
+
+func (c stubConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.record(args)
+	return nil, errStubDB
+}
+
+func (c stubConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.record(args)
+	return nil, errStubDB
+}
+
+func (c stubConn) record(args []driver.NamedValue) {
+	c.db.mu.Lock()
+	c.db.args = append(c.db.args, args...)
+	c.db.mu.Unlock()
+}
+
+// TestRoutesReachHandlers sends requests through the registered routes to
+// the real handlers of each package, backed by services on stubDB. Course
+// authorization is left out, so only the handler can pass the path ID to
+// the database.
+func TestRoutesReachHandlers(t *testing.T) {
+	stub := &stubDB{}
+	conn := sql.OpenDB(stub)
+	defer conn.Close()
+
+	logger := logging.Discard()
+	tokens := auth.NewTokenService("test-secret", 1, 1)
+	am := auth.NewAuthMiddleware(tokens)
+
+	transcoder := streaming.NewMultiBitrateTranscoder(t.TempDir(), "ffmpeg", 1, logger).
+		WithJobStore(streaming.NewSQLJobStore(conn))
+
+	rt := router.New()
+	registerRoutes(rt, routeHandlers{
+		authMiddleware: am,
+		recording:      recording.NewRecordingHandlers(recording.NewRecordingService(conn, logger), logger),
+		course:         course.NewCourseHandlers(course.NewCourseService(conn, logger), logger),
+		instructor:     instructor.NewHandler(instructor.NewService(instructor.NewRepository(conn))),
+		subject:        subject.NewHandler(subject.NewService(subject.NewRepository(conn))),
+		meeting:        meeting.NewHandler(meeting.NewService(meeting.NewRepository(conn))),
+		material:       material.NewHandler(material.NewService(material.NewRepository(conn))),
+		assignment:     assignment.NewHandler(assignment.NewService(assignment.NewRepository(conn))),
+		attendance:     attendance.NewHandler(attendance.NewService(attendance.NewRepository(conn))),
+		notification:   notification.NewHandler(notification.NewService(notification.NewRepository(conn), logger)),
+		poll:           poll.NewHandler(poll.NewService(poll.NewRepository(conn))),
+		video:          videointegration.NewHandler(videointegration.NewService(videointegration.NewRepository(conn), logger)),
+		transcoding:    streaming.NewTranscodingHandlers(streaming.NewTranscodingService(transcoder, 1, logger), logger),
+	})
+
+	pair, err := tokens.GenerateTokenPair(uuid.New().String(), "admin@example.com", "admin")
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	// Instructors and subjects are a public catalog; their writes are not
+	tests := []struct {
+		pkg    string
+		path   string
+		public bool
+	}{
+		{"recording", "/api/v1/recordings/%s", false},
+		{"course", "/api/v1/courses/%s", false},
+		{"instructor", "/api/v1/instructors/%s", true},
+		{"subject", "/api/v1/subjects/%s", true},
+		{"meeting", "/api/v1/meetings/%s", false},
+		{"material", "/api/v1/materials/%s", false},
+		{"assignment", "/api/v1/assignments/%s", false},
+		{"attendance", "/api/v1/attendance/meeting/%s", false},
+		{"notification", "/api/v1/notifications/%s", false},
+		{"poll", "/api/v1/meetings/%s/polls", false},
+		{"videointegration", "/api/v1/meetings/%s/video", false},
+		{"streaming", "/api/v1/transcode/%s/progress", false},
+	}
+
+	for _, test := range tests {
+		id := uuid.New().String()
+		path := fmt.Sprintf(test.path, id)
+
+		method := http.MethodGet
+		if test.public {
+			method = http.MethodDelete
+		}
+		stub.reset()
+		rec := httptest.NewRecorder()
+		rt.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401 without a token, got %d", test.pkg, rec.Code)
+		}
+		if stub.received(id) {
+			t.Errorf("%s: unauthenticated request reached the database", test.pkg)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+		rec = httptest.NewRecorder()
+		rt.ServeHTTP(rec, req)
+		if rec.Code == http.StatusUnauthorized {
+			t.Errorf("%s: token refused", test.pkg)
+		}
+		if !stub.received(id) {
+			t.Errorf("%s: path ID %s did not reach the handler's service (status %d)", test.pkg, id, rec.Code)
+		}
+	}
+
+	t.Logf("✓ %d packages reached through registered routes", len(tests))
+}
+
+// unreachableAdapter is a cluster adapter whose heartbeats fail, as when
+// Redis is down
+type unreachableAdapter struct {
+	*signalling.MemoryAdapter
+}
+
+func (unreachableAdapter) Heartbeat(ctx context.Context, node string, ttl time.Duration) error {
+	return errors.New("redis unreachable")
+}
+
+// TestHealthProbes tests that a replica that cannot reach the signalling
+// cluster leaves rotation but stays live
+func TestHealthProbes(t *testing.T) {
+	sig, err := signalling.NewSignallingServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig.WithAdapter(unreachableAdapter{signalling.NewMemoryAdapter()})
+	if err := sig.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sig.Stop(context.Background()) })
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+	}{
+		{"liveness", healthHandler(nil, sig), http.StatusOK},
+		{"readiness", readyHandler(nil, sig), http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		tt.handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), "redis unreachable") {
+			t.Errorf("%s: cluster error not reported: %s", tt.name, rec.Body.String())
+		}
+	}
+}
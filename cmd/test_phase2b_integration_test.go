@@ -1,9 +1,9 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
 	"testing"
 	"time"
 
@@ -12,7 +12,7 @@ import (
 
 // TestPhase2BFullIntegration tests the complete Phase 2B streaming pipeline
 func TestPhase2BFullIntegration(t *testing.T) {
-	logger := log.New(os.Stderr, "[Phase2B Integration] ", log.LstdFlags)
+	logger := slog.Default()
 
 	fmt.Println()
 	fmt.Println("═══════════════════════════════════════════════════════════════")
@@ -55,7 +55,7 @@ func TestPhase2BFullIntegration(t *testing.T) {
 	transcoder := streaming.NewMultiBitrateTranscoder("/tmp", "/usr/bin/ffmpeg", 4, logger)
 
 	// Queue transcoding job
-	jobIDs, err := transcoder.QueueMultiBitrateJob("rec-001", "/tmp/input.mp4")
+	jobIDs, err := transcoder.QueueMultiBitrateJob(context.Background(), "rec-001", "/tmp/input.mp4")
 	if err != nil {
 		t.Errorf("Failed to queue transcoding job: %v", err)
 	}
@@ -71,11 +71,11 @@ func TestPhase2BFullIntegration(t *testing.T) {
 
 	// Simulate progress updates
 	for _, jobID := range jobIDs {
-		transcoder.UpdateJobProgress(jobID, 50.0, 25.0)
+		transcoder.UpdateJobProgress(context.Background(), jobID, 50.0, 25.0)
 	}
 
 	// Check job status
-	jobs := transcoder.GetAllJobs("rec-001")
+	jobs := transcoder.GetAllJobs(context.Background(), "rec-001")
 	if len(jobs) != 4 {
 		t.Errorf("Expected 4 jobs in list, got %d", len(jobs))
 	}
@@ -279,7 +279,7 @@ func TestQualityAdaptation(t *testing.T) {
 	fmt.Println("TEST: Quality Adaptation Algorithm")
 	fmt.Println("───────────────────────────────────────────────────────────────")
 
-	logger := log.New(os.Stderr, "[QualityAdapt] ", log.LstdFlags)
+	logger := slog.Default()
 	service := streaming.NewDistributionService(2, logger)
 	defer service.Stop()
 
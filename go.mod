@@ -13,6 +13,8 @@ require (
 require (
 	github.com/google/uuid v1.6.0
 	github.com/joho/godotenv v1.5.1
+	github.com/pquerna/otp v1.5.0
+	github.com/redis/go-redis/v9 v9.17.1
 )
 
 require (
@@ -22,6 +24,4 @@ require (
 	github.com/gofrs/uuid v4.4.0+incompatible // indirect
 	github.com/gomodule/redigo v1.9.3 // indirect
 	github.com/gorilla/websocket v1.5.3 // indirect
-	github.com/pquerna/otp v1.5.0 // indirect
-	github.com/redis/go-redis/v9 v9.17.1 // indirect
 )
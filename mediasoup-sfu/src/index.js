@@ -44,6 +44,8 @@ class Room {
     this.name = name;
     this.router = null;
     this.peers = new Map(); // peerId -> Peer
+    this.plainTransports = new Map(); // transportId -> PlainTransport
+    this.plainConsumers = new Map(); // consumerId -> Consumer on a plain transport
     this.createdAt = Date.now();
   }
 }
@@ -237,7 +239,7 @@ app.post('/rooms/:roomId/transports/:transportId/connect', async (req, res) => {
 app.post('/rooms/:roomId/producers', async (req, res) => {
   try {
     const { roomId } = req.params;
-    const { peerId, kind, rtpParameters } = req.body;
+    const { peerId, kind, rtpParameters, source } = req.body;
 
     if (!roomId || !peerId || !kind || !rtpParameters) {
       return res.status(400).json({ error: 'Missing required fields' });
@@ -253,27 +255,35 @@ app.post('/rooms/:roomId/producers', async (req, res) => {
       return res.status(404).json({ error: 'Peer or transport not found' });
     }
 
+    // A screen share is a second video producer, so producers are kept per
+    // source rather than per kind
+    const producerSource = source || (kind === 'video' ? 'camera' : 'mic');
+    const slot = producerSource === 'screen' ? 'screen' : kind;
+
     // Create producer
     const producer = await peer.transport.produce({
       kind,
-      rtpParameters
+      rtpParameters,
+      appData: { source: producerSource }
     });
 
     // Store producer
-    peer.addProducer(kind, producer);
+    peer.addProducer(slot, producer);
     producers.set(producer.id, {
       id: producer.id,
       roomId,
       peerId,
       userId: peer.userId,
       kind,
+      source: producerSource,
+      slot,
       createdAt: Date.now()
     });
 
     // Handle producer close
     producer.on('close', () => {
       logger.info(`Producer ${producer.id} closed`);
-      peer.removeProducer(kind);
+      peer.removeProducer(slot);
       producers.delete(producer.id);
     });
 
@@ -282,6 +292,7 @@ app.post('/rooms/:roomId/producers', async (req, res) => {
     res.json({
       id: producer.id,
       kind,
+      source: producerSource,
       rtpParameters: producer.rtpParameters
     });
   } catch (error) {
@@ -321,7 +332,7 @@ app.post('/rooms/:roomId/consumers', async (req, res) => {
       return res.status(404).json({ error: 'Producer peer not found' });
     }
 
-    const producer = producerPeer.getProducer(producerInfo.kind);
+    const producer = producerPeer.getProducer(producerInfo.slot);
     if (!producer) {
       return res.status(404).json({ error: 'Producer not found in peer' });
     }
@@ -381,7 +392,7 @@ app.post('/rooms/:roomId/producers/:producerId/close', async (req, res) => {
     const room = rooms.get(roomId);
     const peer = room.peers.get(producerInfo.peerId);
     if (peer) {
-      const producer = peer.getProducer(producerInfo.kind);
+      const producer = peer.getProducer(producerInfo.slot);
       if (producer) {
         producer.close();
       }
@@ -422,6 +433,219 @@ app.post('/rooms/:roomId/consumers/:consumerId/close', async (req, res) => {
   }
 });
 
+// List the producers in a room
+app.get('/rooms/:roomId/producers', (req, res) => {
+  const { roomId } = req.params;
+  const room = rooms.get(roomId);
+
+  if (!room) {
+    return res.status(404).json({ error: 'Room not found' });
+  }
+
+  res.json({
+    roomId,
+    producers: Array.from(producers.values())
+      .filter(p => p.roomId === roomId)
+      .map(p => {
+        const peer = room.peers.get(p.peerId);
+        return {
+          id: p.id,
+          peerId: p.peerId,
+          userId: p.userId,
+          fullName: peer ? peer.fullName : undefined,
+          role: peer ? peer.role : undefined,
+          kind: p.kind,
+          source: p.source,
+          createdAt: p.createdAt
+        };
+      })
+  });
+});
+
+// Create a plain RTP transport. Plain transports carry unencrypted RTP to a
+// server-side receiver such as the recorder; each one sends to a single
+// remote address, so the recorder creates one per stream.
+app.post('/rooms/:roomId/plain-transports', async (req, res) => {
+  try {
+    const { roomId } = req.params;
+
+    const room = rooms.get(roomId);
+    if (!room) {
+      return res.status(404).json({ error: 'Room not found' });
+    }
+
+    const transport = await room.router.createPlainTransport({
+      listenIp: {
+        ip: process.env.MEDIASOUP_LISTEN_IP || '127.0.0.1',
+        announcedIp: process.env.MEDIASOUP_PLAIN_ANNOUNCED_IP || undefined
+      },
+      rtcpMux: false,
+      comedia: false
+    });
+
+    room.plainTransports.set(transport.id, transport);
+    transport.observer.on('close', () => {
+      room.plainTransports.delete(transport.id);
+      logger.info(`Plain transport ${transport.id} closed in room ${roomId}`);
+    });
+
+    logger.info(`Created plain transport ${transport.id} in room ${roomId}`);
+
+    res.json({
+      transportId: transport.id,
+      ip: transport.tuple.localIp,
+      port: transport.tuple.localPort,
+      rtcpPort: transport.rtcpTuple ? transport.rtcpTuple.localPort : undefined
+    });
+  } catch (error) {
+    logger.error(`Error creating plain transport: ${error.message}`);
+    res.status(500).json({ error: error.message });
+  }
+});
+
+// Point a plain transport at the receiver's RTP and RTCP ports
+app.post('/rooms/:roomId/plain-transports/:transportId/connect', async (req, res) => {
+  try {
+    const { roomId, transportId } = req.params;
+    const { ip, port, rtcpPort } = req.body;
+
+    if (!ip || !port) {
+      return res.status(400).json({ error: 'Missing required fields' });
+    }
+
+    const room = rooms.get(roomId);
+    if (!room) {
+      return res.status(404).json({ error: 'Room not found' });
+    }
+
+    const transport = room.plainTransports.get(transportId);
+    if (!transport) {
+      return res.status(404).json({ error: 'Transport not found' });
+    }
+
+    await transport.connect({ ip, port, rtcpPort });
+
+    logger.info(`Connected plain transport ${transportId} to ${ip}:${port}`);
+    res.json({ success: true });
+  } catch (error) {
+    logger.error(`Error connecting plain transport: ${error.message}`);
+    res.status(500).json({ error: error.message });
+  }
+});
+
+// Consume a producer on a plain transport. The consumer starts paused so the
+// receiver can get ready before the first packet arrives.
+app.post('/rooms/:roomId/plain-transports/:transportId/consumers', async (req, res) => {
+  try {
+    const { roomId, transportId } = req.params;
+    const { producerId } = req.body;
+
+    if (!producerId) {
+      return res.status(400).json({ error: 'Missing required fields' });
+    }
+
+    const room = rooms.get(roomId);
+    if (!room) {
+      return res.status(404).json({ error: 'Room not found' });
+    }
+
+    const transport = room.plainTransports.get(transportId);
+    if (!transport) {
+      return res.status(404).json({ error: 'Transport not found' });
+    }
+
+    const producerInfo = producers.get(producerId);
+    if (!producerInfo || producerInfo.roomId !== roomId) {
+      return res.status(404).json({ error: 'Producer not found' });
+    }
+
+    const rtpCapabilities = room.router.rtpCapabilities;
+    if (!room.router.canConsume({ producerId, rtpCapabilities })) {
+      return res.status(400).json({ error: 'Cannot consume from this producer' });
+    }
+
+    const consumer = await transport.consume({
+      producerId,
+      rtpCapabilities,
+      paused: true
+    });
+
+    consumers.set(consumer.id, {
+      id: consumer.id,
+      roomId,
+      transportId,
+      producerId,
+      createdAt: Date.now()
+    });
+
+    room.plainConsumers.set(consumer.id, consumer);
+    consumer.observer.on('close', () => {
+      room.plainConsumers.delete(consumer.id);
+      consumers.delete(consumer.id);
+    });
+
+    logger.info(`Created plain consumer ${consumer.id} from producer ${producerId}`);
+
+    res.json({
+      id: consumer.id,
+      producerId,
+      kind: consumer.kind,
+      rtpParameters: consumer.rtpParameters
+    });
+  } catch (error) {
+    logger.error(`Error creating plain consumer: ${error.message}`);
+    res.status(500).json({ error: error.message });
+  }
+});
+
+// Resume a plain consumer. Video consumers also request a key frame so the
+// receiver can start decoding right away.
+app.post('/rooms/:roomId/plain-transports/:transportId/consumers/:consumerId/resume', async (req, res) => {
+  try {
+    const { roomId, transportId, consumerId } = req.params;
+
+    const room = rooms.get(roomId);
+    if (!room || !room.plainTransports.has(transportId)) {
+      return res.status(404).json({ error: 'Transport not found' });
+    }
+
+    const consumerInfo = consumers.get(consumerId);
+    const consumer = room.plainConsumers.get(consumerId);
+    if (!consumer || !consumerInfo || consumerInfo.transportId !== transportId) {
+      return res.status(404).json({ error: 'Consumer not found' });
+    }
+
+    await consumer.resume();
+    if (consumer.kind === 'video') {
+      await consumer.requestKeyFrame();
+    }
+
+    res.json({ success: true });
+  } catch (error) {
+    logger.error(`Error resuming plain consumer: ${error.message}`);
+    res.status(500).json({ error: error.message });
+  }
+});
+
+// Close a plain transport and its consumers
+app.post('/rooms/:roomId/plain-transports/:transportId/close', async (req, res) => {
+  try {
+    const { roomId, transportId } = req.params;
+
+    const room = rooms.get(roomId);
+    const transport = room && room.plainTransports.get(transportId);
+    if (!transport) {
+      return res.status(404).json({ error: 'Transport not found' });
+    }
+
+    transport.close();
+    res.json({ success: true });
+  } catch (error) {
+    logger.error(`Error closing plain transport: ${error.message}`);
+    res.status(500).json({ error: error.message });
+  }
+});
+
 // Create or join room
 async function getOrCreateRoom(roomId, roomName) {
   if (rooms.has(roomId)) {
@@ -546,6 +770,9 @@ app.post('/rooms/:roomId/peers/:peerId/leave', async (req, res) => {
 
     // Delete room if empty
     if (room.peers.size === 0) {
+      for (const transport of room.plainTransports.values()) {
+        transport.close();
+      }
       rooms.delete(roomId);
       logger.info(`Room ${roomId} deleted (empty)`);
     }
@@ -0,0 +1,6 @@
+-- Migration: 014_meeting_courses.sql
+-- Description: Link meetings to courses so course roles can authorize them
+
+ALTER TABLE meetings ADD COLUMN IF NOT EXISTS course_id UUID REFERENCES courses(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_meetings_course_id ON meetings(course_id);
@@ -0,0 +1,14 @@
+-- Migration: Add authentication settings
+-- Description: Store admin-controlled authentication policy, such as the roles required to use 2FA
+
+CREATE TABLE IF NOT EXISTS auth_settings (
+    key VARCHAR(100) PRIMARY KEY,
+    value JSONB NOT NULL,
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- 2FA is optional for every role until an admin requires it
+INSERT INTO auth_settings (key, value)
+VALUES ('two_factor_required_roles', '[]'::jsonb)
+ON CONFLICT (key) DO NOTHING;
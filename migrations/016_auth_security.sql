@@ -0,0 +1,26 @@
+-- Migration: Add brute-force protection and auth audit log
+-- Description: Persist account lockouts and record security-relevant authentication events
+
+-- Accounts are locked after repeated failed logins until the time passes,
+-- an admin unlocks them or the password is reset
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP WITH TIME ZONE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS lockout_reason VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_users_locked_until ON users(locked_until) WHERE locked_until IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users(lower(email));
+
+-- Auth audit log: logins, new login locations, lockouts and unlocks
+CREATE TABLE IF NOT EXISTS auth_audit_log (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    account VARCHAR(255),
+    event VARCHAR(50) NOT NULL,
+    ip_address VARCHAR(45),
+    network VARCHAR(50),
+    user_agent TEXT,
+    details JSONB DEFAULT '{}'::jsonb,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_audit_log_user_event ON auth_audit_log(user_id, event, network);
+CREATE INDEX IF NOT EXISTS idx_auth_audit_log_created_at ON auth_audit_log(created_at DESC);
@@ -0,0 +1,22 @@
+-- Migration: Recording sharing links
+-- Description: Share recordings with a course or by a tokenized link with an optional password and view limit
+
+ALTER TABLE recording_sharing ADD COLUMN IF NOT EXISTS course_id UUID REFERENCES courses(id) ON DELETE CASCADE;
+ALTER TABLE recording_sharing ADD COLUMN IF NOT EXISTS password_hash VARCHAR(255);
+ALTER TABLE recording_sharing ADD COLUMN IF NOT EXISTS max_views INTEGER CHECK (max_views IS NULL OR max_views > 0);
+ALTER TABLE recording_sharing ADD COLUMN IF NOT EXISTS view_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE recording_sharing ADD COLUMN IF NOT EXISTS revoked_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE recording_sharing DROP CONSTRAINT IF EXISTS recording_sharing_share_type_check;
+ALTER TABLE recording_sharing ADD CONSTRAINT recording_sharing_share_type_check
+    CHECK (share_type IN ('user', 'role', 'public', 'link', 'course'));
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_recording_sharing_token_unique
+    ON recording_sharing(share_link_token) WHERE share_link_token IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_recording_sharing_course_id ON recording_sharing(course_id);
+
+-- Link holders are not signed in, so accesses may have no user
+ALTER TABLE recording_access_log ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE recording_access_log ADD COLUMN IF NOT EXISTS share_id UUID REFERENCES recording_sharing(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_recording_access_log_share_id ON recording_access_log(share_id);
@@ -0,0 +1,10 @@
+-- Migration: HLS segment encryption keys
+-- Description: Per-recording AES-128 keys, sealed under the master key from config
+
+CREATE TABLE IF NOT EXISTS hls_encryption_keys (
+    recording_id UUID NOT NULL REFERENCES recordings(id) ON DELETE CASCADE,
+    key_index INTEGER NOT NULL CHECK (key_index >= 0),
+    encrypted_key BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (recording_id, key_index)
+);
@@ -0,0 +1,18 @@
+-- Migration: Live-to-VOD post-processing
+-- Description: Persisted stage of each recording's post-processing pipeline so it resumes after a restart
+
+CREATE TABLE IF NOT EXISTS recording_pipelines (
+    recording_id UUID PRIMARY KEY REFERENCES recordings(id) ON DELETE CASCADE,
+    stage VARCHAR(20) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    course_id UUID REFERENCES courses(id) ON DELETE SET NULL,
+    transcode_job_ids TEXT[] NOT NULL DEFAULT '{}',
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_recording_pipelines_unfinished
+    ON recording_pipelines(updated_at) WHERE status IN ('pending', 'running');
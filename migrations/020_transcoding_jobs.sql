@@ -0,0 +1,34 @@
+-- Migration: Persistent transcoding queue
+-- Description: Transcoding jobs leased by workers with FOR UPDATE SKIP LOCKED, so queued and running
+-- jobs survive restarts and are shared by all replicas
+
+CREATE TABLE IF NOT EXISTS transcoding_jobs (
+    job_id VARCHAR(255) PRIMARY KEY,
+    recording_id UUID NOT NULL REFERENCES recordings(id) ON DELETE CASCADE,
+    bitrate INTEGER NOT NULL,
+    resolution VARCHAR(20) NOT NULL,
+    frame_rate INTEGER NOT NULL,
+    label VARCHAR(50) NOT NULL,
+    input_path TEXT NOT NULL,
+    output_path TEXT NOT NULL,
+    encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(20) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'completed', 'failed', 'cancelled')),
+    priority INTEGER NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 3 CHECK (max_attempts > 0),
+    progress DOUBLE PRECISION NOT NULL DEFAULT 0,
+    worker_id VARCHAR(255),
+    lease_expires_at TIMESTAMP WITH TIME ZONE,
+    heartbeat_at TIMESTAMP WITH TIME ZONE,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_transcoding_jobs_queued
+    ON transcoding_jobs(priority DESC, created_at) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS idx_transcoding_jobs_leases
+    ON transcoding_jobs(lease_expires_at) WHERE status = 'running';
+CREATE INDEX IF NOT EXISTS idx_transcoding_jobs_recording ON transcoding_jobs(recording_id);
@@ -0,0 +1,33 @@
+-- Migration: Recurring meetings
+-- Description: Meeting series following an RFC 5545 recurrence rule. Occurrences are created
+-- as meetings ahead of time and keep the start the rule gave them, so each is created only once.
+
+CREATE TABLE IF NOT EXISTS meeting_series (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    course_id UUID REFERENCES courses(id) ON DELETE SET NULL,
+    instructor_id UUID NOT NULL REFERENCES instructors(id) ON DELETE CASCADE,
+    student_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    subject_id UUID NOT NULL REFERENCES subjects(id) ON DELETE RESTRICT,
+    title_ar VARCHAR(255) NOT NULL,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    duration INTEGER NOT NULL, -- minutes
+    timezone VARCHAR(64) NOT NULL DEFAULT 'Asia/Damascus',
+    rrule TEXT NOT NULL,
+    exdates TIMESTAMP WITH TIME ZONE[] NOT NULL DEFAULT '{}',
+    meeting_url TEXT,
+    room_id VARCHAR(255),
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'cancelled')),
+    materialized_until TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_meeting_series_instructor_id ON meeting_series(instructor_id);
+CREATE INDEX IF NOT EXISTS idx_meeting_series_course_id ON meeting_series(course_id);
+CREATE INDEX IF NOT EXISTS idx_meeting_series_due
+    ON meeting_series(materialized_until) WHERE status = 'active';
+
+ALTER TABLE meetings ADD COLUMN IF NOT EXISTS series_id UUID REFERENCES meeting_series(id) ON DELETE CASCADE;
+ALTER TABLE meetings ADD COLUMN IF NOT EXISTS original_start TIMESTAMP WITH TIME ZONE;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_meetings_series_occurrence ON meetings(series_id, original_start);
@@ -0,0 +1,12 @@
+-- Migration: Calendar feeds and invitations
+-- Description: Per-user secret iCalendar feed tokens, and a meeting sequence number that calendar
+-- clients use to tell a rescheduled or cancelled meeting from a stale copy
+
+CREATE TABLE IF NOT EXISTS calendar_feed_tokens (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE, -- hex SHA-256 of the token in the feed URL
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP WITH TIME ZONE
+);
+
+ALTER TABLE meetings ADD COLUMN IF NOT EXISTS sequence INTEGER NOT NULL DEFAULT 0;
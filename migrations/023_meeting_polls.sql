@@ -0,0 +1,28 @@
+-- Migration: Meeting polls
+-- Description: Polls held during live meetings, stored with their tallies when they close. Votes are
+-- kept per student except for anonymous polls, whose tallies are all that is stored.
+
+CREATE TABLE IF NOT EXISTS meeting_polls (
+    id UUID PRIMARY KEY,
+    meeting_id UUID NOT NULL REFERENCES meetings(id) ON DELETE CASCADE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    question TEXT NOT NULL,
+    options TEXT[] NOT NULL,
+    multiple BOOLEAN NOT NULL DEFAULT FALSE,
+    anonymous BOOLEAN NOT NULL DEFAULT FALSE,
+    points INTEGER NOT NULL DEFAULT 0, -- participation grade points, 0 for ungraded polls
+    correct_options INTEGER[] NOT NULL DEFAULT '{}',
+    tallies INTEGER[] NOT NULL,
+    voters INTEGER NOT NULL DEFAULT 0,
+    opened_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    closed_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_meeting_polls_meeting ON meeting_polls(meeting_id);
+
+CREATE TABLE IF NOT EXISTS meeting_poll_votes (
+    poll_id UUID NOT NULL REFERENCES meeting_polls(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    choices INTEGER[] NOT NULL,
+    PRIMARY KEY (poll_id, user_id)
+);
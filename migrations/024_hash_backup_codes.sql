@@ -0,0 +1,15 @@
+-- Migration: Store 2FA backup codes hashed
+-- Description: Replace plaintext backup codes with their SHA-256 hex digests.
+-- Digests are 64 characters and codes 8, so running this again is a no-op.
+
+UPDATE users
+SET backup_codes = (
+    SELECT COALESCE(jsonb_agg(
+        CASE WHEN length(code) = 64 THEN code
+             ELSE encode(sha256(convert_to(upper(trim(code)), 'UTF8')), 'hex')
+        END), '[]'::jsonb)
+    FROM jsonb_array_elements_text(backup_codes) AS code
+)
+WHERE EXISTS (
+    SELECT 1 FROM jsonb_array_elements_text(backup_codes) AS code WHERE length(code) <> 64
+);
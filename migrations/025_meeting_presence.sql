@@ -0,0 +1,17 @@
+-- Migration: Live session presence
+-- Description: One row per connection to a live session room, recorded by whichever replica holds the
+-- connection, so attendance sees every connection to a meeting and survives restarts. Rows are consumed
+-- when the room's meeting completes.
+
+CREATE TABLE IF NOT EXISTS meeting_presence (
+    id BIGSERIAL PRIMARY KEY,
+    room_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    socket_id VARCHAR(255) NOT NULL,
+    connected_at TIMESTAMP WITH TIME ZONE NOT NULL, -- when the connection joined
+    counted_from TIMESTAMP WITH TIME ZONE NOT NULL, -- start of the time not yet taken by a meeting
+    left_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_meeting_presence_room ON meeting_presence(room_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_meeting_presence_open ON meeting_presence(room_id, socket_id) WHERE left_at IS NULL;
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/Bashar444/VTP/pkg/auth"
+	"github.com/Bashar444/VTP/pkg/router"
 )
 
 type Announcement struct {
@@ -46,28 +47,34 @@ func NewHandler(store *Store, am *auth.AuthMiddleware) *Handler {
 	return &Handler{store: store, am: am}
 }
 
-func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
-	// Admin-only endpoints
-	mux.Handle("/api/v1/admin/announce", h.am.Middleware(h.am.RoleMiddleware("admin")(http.HandlerFunc(h.createAnnouncement))))
-	mux.Handle("/api/v1/admin/announcements", h.am.Middleware(h.am.RoleMiddleware("admin")(http.HandlerFunc(h.listAnnouncements))))
+// RegisterRoutes registers admin routes. Every route requires the admin role.
+func (h *Handler) RegisterRoutes(rt *router.Router) {
+	admin := rt.With(h.am.Middleware, h.am.RoleMiddleware("admin"))
+
+	// Announcements
+	admin.HandleFunc("POST /api/v1/admin/announce", h.createAnnouncement)
+	admin.HandleFunc("GET /api/v1/admin/announcements", h.listAnnouncements)
 
 	// User management
-	mux.Handle("/api/v1/admin/users", h.am.Middleware(h.am.RoleMiddleware("admin")(http.HandlerFunc(h.listUsers))))
-	mux.Handle("/api/v1/admin/users/create", h.am.Middleware(h.am.RoleMiddleware("admin")(http.HandlerFunc(h.createUser))))
-	mux.Handle("/api/v1/admin/users/update", h.am.Middleware(h.am.RoleMiddleware("admin")(http.HandlerFunc(h.updateUser))))
-	mux.Handle("/api/v1/admin/users/toggle-active", h.am.Middleware(h.am.RoleMiddleware("admin")(http.HandlerFunc(h.toggleUserActive))))
+	admin.HandleFunc("GET /api/v1/admin/users", h.listUsers)
+	admin.HandleFunc("POST /api/v1/admin/users/create", h.createUser)
+	admin.HandleFunc("PUT /api/v1/admin/users/update", h.updateUser)
+	admin.HandleFunc("PATCH /api/v1/admin/users/update", h.updateUser)
+	admin.HandleFunc("POST /api/v1/admin/users/toggle-active", h.toggleUserActive)
 
 	// School management
-	mux.Handle("/api/v1/admin/school-terms", h.am.Middleware(h.am.RoleMiddleware("admin")(http.HandlerFunc(h.handleSchoolTerms))))
-	mux.Handle("/api/v1/admin/grade-levels", h.am.Middleware(h.am.RoleMiddleware("admin")(http.HandlerFunc(h.handleGradeLevels))))
-	mux.Handle("/api/v1/admin/class-sections", h.am.Middleware(h.am.RoleMiddleware("admin")(http.HandlerFunc(h.handleClassSections))))
+	admin.HandleFunc("GET /api/v1/admin/school-terms", h.handleSchoolTerms)
+	admin.HandleFunc("POST /api/v1/admin/school-terms", h.handleSchoolTerms)
+	admin.HandleFunc("GET /api/v1/admin/grade-levels", h.handleGradeLevels)
+	admin.HandleFunc("GET /api/v1/admin/class-sections", h.handleClassSections)
+	admin.HandleFunc("POST /api/v1/admin/class-sections", h.handleClassSections)
 
 	// Reports
-	mux.Handle("/api/v1/admin/reports/attendance", h.am.Middleware(h.am.RoleMiddleware("admin")(http.HandlerFunc(h.getAttendanceReport))))
-	mux.Handle("/api/v1/admin/reports/overview", h.am.Middleware(h.am.RoleMiddleware("admin")(http.HandlerFunc(h.getOverviewReport))))
+	admin.HandleFunc("GET /api/v1/admin/reports/attendance", h.getAttendanceReport)
+	admin.HandleFunc("GET /api/v1/admin/reports/overview", h.getOverviewReport)
 
 	// Dashboard stats
-	mux.Handle("/api/v1/admin/dashboard", h.am.Middleware(h.am.RoleMiddleware("admin")(http.HandlerFunc(h.getDashboard))))
+	admin.HandleFunc("GET /api/v1/admin/dashboard", h.getDashboard)
 }
 
 func (h *Handler) createAnnouncement(w http.ResponseWriter, r *http.Request) {
@@ -18,6 +18,8 @@ type EventCollectorImpl struct {
 	batchTimeout time.Duration
 	ticker       *time.Ticker
 	doneCh       chan struct{}
+	stopOnce     sync.Once
+	inFlight     sync.WaitGroup // batch callbacks still running
 	onBatchFull  func(events []AnalyticsEvent) error
 	logger       *log.Logger
 }
@@ -126,7 +128,9 @@ func (ec *EventCollectorImpl) flushLocked() error {
 
 	// Call callback outside of lock to avoid deadlock
 	// This is not ideal but necessary for callback to do I/O
+	ec.inFlight.Add(1)
 	go func() {
+		defer ec.inFlight.Done()
 		if err := ec.onBatchFull(eventsCopy); err != nil && ec.logger != nil {
 			ec.logger.Printf("[Analytics] Error processing batch: %v\n", err)
 		}
@@ -135,11 +139,17 @@ func (ec *EventCollectorImpl) flushLocked() error {
 	return nil
 }
 
-// Stop stops the event collector
+// Stop stops the event collector. Remaining events are flushed and Stop
+// waits until every batch has been handed to the batch callback and
+// processed, so events are not lost on shutdown. Calling Stop more than once
+// is safe.
 func (ec *EventCollectorImpl) Stop() {
-	// Flush remaining events
-	ec.flushBatch()
-	close(ec.doneCh)
+	ec.stopOnce.Do(func() {
+		close(ec.doneCh)
+		// Flush remaining events
+		ec.flushBatch()
+	})
+	ec.inFlight.Wait()
 }
 
 // EventSerializer serializes events to JSON
@@ -244,6 +244,30 @@ func TestBatchProcessing(t *testing.T) {
 	}
 }
 
+func TestStopFlushesPendingEvents(t *testing.T) {
+	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	collector := NewEventCollector(100, time.Hour, logger)
+
+	var flushed []AnalyticsEvent
+	collector.SetBatchCallback(func(events []AnalyticsEvent) error {
+		time.Sleep(50 * time.Millisecond) // simulate a slow database write
+		flushed = events
+		return nil
+	})
+
+	for i := 0; i < 5; i++ {
+		collector.RecordEvent(EventPlaybackStarted, uuid.New(), uuid.New(), "session-001", nil)
+	}
+
+	collector.Stop()
+	if len(flushed) != 5 {
+		t.Errorf("Expected 5 events flushed before Stop returned, got %d", len(flushed))
+	}
+
+	// Stopping again must not panic
+	collector.Stop()
+}
+
 func TestMultipleEventTypes(t *testing.T) {
 	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
 	collector := NewEventCollector(100, 5*time.Second, logger)
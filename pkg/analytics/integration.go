@@ -181,6 +181,7 @@ type ReportGenerator struct {
 	logger         *log.Logger
 	reportInterval time.Duration
 	stopChan       chan bool
+	stopOnce       sync.Once
 	mu             sync.RWMutex
 	lastReportTime map[uuid.UUID]time.Time
 }
@@ -219,9 +220,12 @@ func (rg *ReportGenerator) Start() {
 	}
 }
 
-// Stop halts report generation
+// Stop halts report generation. It does not block when the generator was
+// never started and is safe to call more than once.
 func (rg *ReportGenerator) Stop() {
-	rg.stopChan <- true
+	rg.stopOnce.Do(func() {
+		close(rg.stopChan)
+	})
 }
 
 // generateDailyReports generates reports for all courses
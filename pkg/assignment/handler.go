@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/Bashar444/VTP/pkg/auth"
+	"github.com/Bashar444/VTP/pkg/course"
 	m "github.com/Bashar444/VTP/pkg/models"
+	"github.com/Bashar444/VTP/pkg/router"
 	"github.com/Bashar444/VTP/pkg/utils"
 )
 
@@ -12,9 +15,25 @@ type Handler struct{ svc *Service }
 
 func NewHandler(s *Service) *Handler { return &Handler{svc: s} }
 
+// RegisterRoutes registers assignment routes. All routes require
+// authentication and are authorized against the assignment's course.
+func (h *Handler) RegisterRoutes(rt *router.Router, am *auth.AuthMiddleware, authz *course.CourseAuthorizer) {
+	api := rt.With(am.Middleware)
+	member := authz.Require(authz.AssignmentScope("id"), course.MemberRoles...)
+	staff := authz.Require(authz.AssignmentScope("id"), course.StaffRoles...)
+
+	api.HandleFunc("GET /api/v1/assignments", h.List, authz.Require(authz.CourseFromQuery("course_id"), course.MemberRoles...))
+	api.HandleFunc("POST /api/v1/assignments", h.Create, authz.Require(authz.CourseFromBody("course_id"), course.ManageRoles...))
+	api.HandleFunc("GET /api/v1/assignments/{id}", h.Get, member)
+	api.HandleFunc("POST /api/v1/assignments/{id}/submit", h.Submit, member)
+	api.HandleFunc("GET /api/v1/assignments/{id}/submissions", h.ListSubmissions, staff)
+	api.HandleFunc("POST /api/v1/assignments/submissions/{submissionId}/grade", h.Grade,
+		authz.Require(authz.SubmissionScope("submissionId"), course.StaffRoles...))
+}
+
 func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 	var a m.Assignment
-	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+	if err := utils.DecodeJSON(r, &a); err != nil {
 		utils.WriteErr(w, http.StatusBadRequest, err)
 		return
 	}
@@ -28,14 +47,17 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query()
-	var instructorID, subjectID *string
+	var courseID, instructorID, subjectID *string
+	if v := q.Get("course_id"); v != "" {
+		courseID = &v
+	}
 	if v := q.Get("instructor_id"); v != "" {
 		instructorID = &v
 	}
 	if v := q.Get("subject_id"); v != "" {
 		subjectID = &v
 	}
-	res, err := h.svc.List(r.Context(), instructorID, subjectID)
+	res, err := h.svc.List(r.Context(), courseID, instructorID, subjectID)
 	if err != nil {
 		utils.WriteErr(w, http.StatusInternalServerError, err)
 		return
@@ -59,6 +81,13 @@ func (h *Handler) Submit(w http.ResponseWriter, r *http.Request) {
 		utils.WriteErr(w, http.StatusBadRequest, err)
 		return
 	}
+	// the assignment comes from the path the caller was authorized for
+	if id := utils.Param(r, "id"); id != "" {
+		sub.AssignmentID = id
+	}
+	if userID, ok := r.Context().Value("user_id").(string); ok && userID != "" {
+		sub.StudentID = userID
+	}
 	res, err := h.svc.Submit(r.Context(), &sub)
 	if err != nil {
 		utils.WriteErr(w, http.StatusBadRequest, err)
@@ -3,6 +3,7 @@ package assignment
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"time"
 
 	m "github.com/Bashar444/VTP/pkg/models"
@@ -28,19 +29,20 @@ func (r *Repository) Create(ctx context.Context, a *m.Assignment) (*m.Assignment
 	return a, nil
 }
 
-func (r *Repository) List(ctx context.Context, instructorID *string, subjectID *string) ([]m.Assignment, error) {
-	base := `SELECT id,course_id,instructor_id,title_ar,description_ar,subject_id,due_at,max_points,created_at,updated_at FROM assignments`
-	var rows *sql.Rows
-	var err error
-	if instructorID != nil && subjectID != nil {
-		rows, err = r.db.QueryContext(ctx, base+" WHERE instructor_id=$1 AND subject_id=$2 ORDER BY due_at ASC", *instructorID, *subjectID)
-	} else if instructorID != nil {
-		rows, err = r.db.QueryContext(ctx, base+" WHERE instructor_id=$1 ORDER BY due_at ASC", *instructorID)
-	} else if subjectID != nil {
-		rows, err = r.db.QueryContext(ctx, base+" WHERE subject_id=$1 ORDER BY due_at ASC", *subjectID)
-	} else {
-		rows, err = r.db.QueryContext(ctx, base+" ORDER BY due_at ASC")
+// List lists assignments matching the filters that are set
+func (r *Repository) List(ctx context.Context, courseID, instructorID, subjectID *string) ([]m.Assignment, error) {
+	q := `SELECT id,course_id,instructor_id,title_ar,description_ar,subject_id,due_at,max_points,created_at,updated_at FROM assignments WHERE 1=1`
+	var args []interface{}
+	for _, filter := range []struct {
+		column string
+		value  *string
+	}{{"course_id", courseID}, {"instructor_id", instructorID}, {"subject_id", subjectID}} {
+		if filter.value != nil {
+			args = append(args, *filter.value)
+			q += fmt.Sprintf(" AND %s=$%d", filter.column, len(args))
+		}
 	}
+	rows, err := r.db.QueryContext(ctx, q+" ORDER BY due_at ASC", args...)
 	if err != nil {
 		return nil, err
 	}
@@ -66,6 +68,40 @@ func (r *Repository) List(ctx context.Context, instructorID *string, subjectID *
 	return res, nil
 }
 
+// ListForStudent lists the assignments of the courses a student is actively
+// enrolled in
+func (r *Repository) ListForStudent(ctx context.Context, studentID string) ([]m.Assignment, error) {
+	q := `SELECT a.id,a.course_id,a.instructor_id,a.title_ar,a.description_ar,a.subject_id,a.due_at,a.max_points,a.created_at,a.updated_at
+          FROM assignments a
+          JOIN course_enrollments ce ON ce.course_id = a.course_id
+          WHERE ce.student_id=$1 AND ce.status='active'
+          ORDER BY a.due_at ASC`
+	rows, err := r.db.QueryContext(ctx, q, studentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []m.Assignment
+	for rows.Next() {
+		var a m.Assignment
+		var courseID, subjectID sql.NullString
+		err := rows.Scan(&a.ID, &courseID, &a.InstructorID, &a.TitleAR, &a.DescriptionAR, &subjectID, &a.DueAt, &a.MaxPoints, &a.CreatedAt, &a.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if courseID.Valid {
+			cid := courseID.String
+			a.CourseID = &cid
+		}
+		if subjectID.Valid {
+			sid := subjectID.String
+			a.SubjectID = &sid
+		}
+		res = append(res, a)
+	}
+	return res, rows.Err()
+}
+
 func (r *Repository) Get(ctx context.Context, id string) (*m.Assignment, error) {
 	q := `SELECT id,course_id,instructor_id,title_ar,description_ar,subject_id,due_at,max_points,created_at,updated_at FROM assignments WHERE id=$1`
 	var a m.Assignment
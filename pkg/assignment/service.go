@@ -23,8 +23,13 @@ func (s *Service) Create(ctx context.Context, a *m.Assignment) (*m.Assignment, e
 	return s.repo.Create(ctx, a)
 }
 
-func (s *Service) List(ctx context.Context, instructorID *string, subjectID *string) ([]m.Assignment, error) {
-	return s.repo.List(ctx, instructorID, subjectID)
+func (s *Service) List(ctx context.Context, courseID, instructorID, subjectID *string) ([]m.Assignment, error) {
+	return s.repo.List(ctx, courseID, instructorID, subjectID)
+}
+
+// ListForStudent lists the assignments of the courses a student is enrolled in
+func (s *Service) ListForStudent(ctx context.Context, studentID string) ([]m.Assignment, error) {
+	return s.repo.ListForStudent(ctx, studentID)
 }
 
 func (s *Service) Get(ctx context.Context, id string) (*m.Assignment, error) {
@@ -5,7 +5,10 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/Bashar444/VTP/pkg/auth"
+	"github.com/Bashar444/VTP/pkg/course"
 	"github.com/Bashar444/VTP/pkg/models"
+	"github.com/Bashar444/VTP/pkg/router"
 	"github.com/Bashar444/VTP/pkg/utils"
 )
 
@@ -19,6 +22,23 @@ func NewHandler(service *Service) *Handler {
 	return &Handler{service: service}
 }
 
+// RegisterRoutes registers attendance routes. Recording attendance is limited
+// to teachers and admins; meeting attendance is scoped to the meeting's course.
+func (h *Handler) RegisterRoutes(rt *router.Router, am *auth.AuthMiddleware, authz *course.CourseAuthorizer) {
+	api := rt.With(am.Middleware)
+	staff := api.With(am.RoleMiddleware(string(auth.RoleTeacher), string(auth.RoleAdmin)))
+
+	staff.HandleFunc("POST /api/v1/attendance", h.RecordAttendance)
+	staff.HandleFunc("POST /api/v1/attendance/bulk", h.BulkRecordAttendance)
+	staff.HandleFunc("PUT /api/v1/attendance/{id}", h.UpdateAttendance)
+	staff.HandleFunc("GET /api/v1/attendance/class/{id}", h.GetClassAttendance)
+	staff.HandleFunc("GET /api/v1/attendance/report", h.GenerateReport)
+	api.HandleFunc("GET /api/v1/attendance/student/{id}", h.GetStudentAttendance)
+	api.HandleFunc("GET /api/v1/attendance/student/{id}/stats", h.GetStudentStats)
+	api.HandleFunc("GET /api/v1/attendance/meeting/{id}", h.GetMeetingAttendance,
+		authz.Require(authz.MeetingScope("id"), course.StaffRoles...))
+}
+
 // RecordAttendanceRequest represents the request to record attendance
 type RecordAttendanceRequest struct {
 	StudentID      string `json:"student_id"`
@@ -0,0 +1,214 @@
+package attendance
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// PresenceConfig decides attendance from the time a student was connected
+// to a meeting's room
+type PresenceConfig struct {
+	LateAfter   time.Duration // joining later than this after the start is late
+	MinPresence float64       // share of the meeting, 0-1, below which a student is absent
+}
+
+// DefaultPresenceConfig marks students who join after 10 minutes late and
+// those connected for less than half of the meeting absent
+func DefaultPresenceConfig() PresenceConfig {
+	return PresenceConfig{
+		LateAfter:   10 * time.Minute,
+		MinPresence: 0.5,
+	}
+}
+
+// Interval is a stretch of time a user was connected. To is zero while the
+// user is still connected.
+type Interval struct {
+	From time.Time
+	To   time.Time
+}
+
+// Presence is the time a user spent in a room
+type Presence struct {
+	UserID    string
+	Intervals []Interval
+}
+
+// FirstJoin returns when the user first connected
+func (p *Presence) FirstJoin() time.Time {
+	if len(p.Intervals) == 0 {
+		return time.Time{}
+	}
+	return p.Intervals[0].From
+}
+
+// LastLeave returns when the user last disconnected
+func (p *Presence) LastLeave() time.Time {
+	if len(p.Intervals) == 0 {
+		return time.Time{}
+	}
+	return p.Intervals[len(p.Intervals)-1].To
+}
+
+// ConnectedBetween returns how long the user was connected between start
+// and end
+func (p *Presence) ConnectedBetween(start, end time.Time) time.Duration {
+	var total time.Duration
+	for _, interval := range p.Intervals {
+		from, to := interval.From, interval.To
+		if to.IsZero() || to.After(end) {
+			to = end
+		}
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(from) {
+			total += to.Sub(from)
+		}
+	}
+	return total
+}
+
+// Status decides a student's attendance in a meeting held from start to
+// end. Students who never joined are absent.
+func (c PresenceConfig) Status(p *Presence, start, end time.Time) string {
+	if p == nil || len(p.Intervals) == 0 {
+		return "absent"
+	}
+	if length := end.Sub(start); length > 0 {
+		if float64(p.ConnectedBetween(start, end)) < c.MinPresence*float64(length) {
+			return "absent"
+		}
+	}
+	if p.FirstJoin().After(start.Add(c.LateAfter)) {
+		return "late"
+	}
+	return "present"
+}
+
+// StaleConnection is how long a connection may stay open before it is
+// taken to be left behind by a replica that died without closing it. No
+// live class runs this long.
+const StaleConnection = 24 * time.Hour
+
+// PresenceStore adds up the time each user is connected to each room. It
+// keeps one row per connection in the meeting_presence table: every
+// replica records the connections it holds, so a meeting's presence is
+// complete whichever replica completes it and survives restarts. A user
+// counts as connected while any of their connections is in the room, so a
+// second tab adds no time and a reconnect continues the same record.
+type PresenceStore struct {
+	db *sql.DB
+}
+
+// NewPresenceStore creates a presence store
+func NewPresenceStore(db *sql.DB) *PresenceStore {
+	return &PresenceStore{db: db}
+}
+
+// Join records a connection of a user joining a room. A connection that
+// is already in the room is not recorded twice.
+func (s *PresenceStore) Join(ctx context.Context, roomID, userID, socketID string, at time.Time) error {
+	query := `
+		INSERT INTO meeting_presence (room_id, user_id, socket_id, connected_at, counted_from)
+		VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT (room_id, socket_id) WHERE left_at IS NULL DO NOTHING
+	`
+	_, err := s.db.ExecContext(ctx, query, roomID, userID, socketID, at)
+	return err
+}
+
+// Leave records a connection of a user leaving a room
+func (s *PresenceStore) Leave(ctx context.Context, roomID, userID, socketID string, at time.Time) error {
+	query := `
+		UPDATE meeting_presence SET left_at = GREATEST($4, counted_from)
+		WHERE room_id = $1 AND user_id = $2 AND socket_id = $3 AND left_at IS NULL
+	`
+	_, err := s.db.ExecContext(ctx, query, roomID, userID, socketID, at)
+	return err
+}
+
+// Take returns the presence in a room up to end and starts the room over.
+// Connections still open are counted until end and stay recorded from end
+// on, for the room's next meeting, unless they are stale.
+func (s *PresenceStore) Take(ctx context.Context, roomID string, end time.Time) (map[string]*Presence, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT user_id, counted_from, left_at FROM meeting_presence
+		WHERE room_id = $1 AND counted_from < $2
+		FOR UPDATE
+	`, roomID, end)
+	if err != nil {
+		return nil, err
+	}
+	connections := make(map[string][]Interval)
+	for rows.Next() {
+		var userID string
+		var interval Interval
+		var leftAt sql.NullTime
+		if err := rows.Scan(&userID, &interval.From, &leftAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		interval.To = leftAt.Time
+		connections[userID] = append(connections[userID], interval)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM meeting_presence
+		WHERE room_id = $1 AND ((left_at IS NOT NULL AND left_at <= $2) OR (left_at IS NULL AND connected_at < $3))
+	`, roomID, end, end.Add(-StaleConnection)); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE meeting_presence SET counted_from = $2
+		WHERE room_id = $1 AND counted_from < $2
+	`, roomID, end); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return mergePresence(connections, end), nil
+}
+
+// mergePresence turns each user's connections into the stretches of time
+// they had at least one connection open, up to end
+func mergePresence(connections map[string][]Interval, end time.Time) map[string]*Presence {
+	presence := make(map[string]*Presence, len(connections))
+	for userID, intervals := range connections {
+		for i := range intervals {
+			if intervals[i].To.IsZero() || intervals[i].To.After(end) {
+				intervals[i].To = end
+			}
+		}
+		sort.Slice(intervals, func(i, j int) bool {
+			return intervals[i].From.Before(intervals[j].From)
+		})
+
+		p := &Presence{UserID: userID}
+		for _, interval := range intervals {
+			last := len(p.Intervals) - 1
+			if last >= 0 && !interval.From.After(p.Intervals[last].To) {
+				if interval.To.After(p.Intervals[last].To) {
+					p.Intervals[last].To = interval.To
+				}
+				continue
+			}
+			p.Intervals = append(p.Intervals, interval)
+		}
+		presence[userID] = p
+	}
+	return presence
+}
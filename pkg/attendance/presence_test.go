@@ -0,0 +1,75 @@
+package attendance
+
+import (
+	"testing"
+	"time"
+)
+
+var classStart = time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+
+func at(minutes int) time.Time {
+	return classStart.Add(time.Duration(minutes) * time.Minute)
+}
+
+// TestMergePresence tests that reconnects and second connections are
+// merged into one record
+func TestMergePresence(t *testing.T) {
+	connections := map[string][]Interval{
+		"student-1": {
+			{From: at(25)}, // still connected
+			{From: at(2), To: at(20)},
+			// A second tab adds no time
+			{From: at(30), To: at(40)},
+		},
+		"student-2": {
+			{From: at(50), To: at(75)}, // left after the meeting ended
+		},
+	}
+
+	presence := mergePresence(connections, at(60))
+	p := presence["student-1"]
+	if p == nil || len(p.Intervals) != 2 {
+		t.Fatalf("Expected two connected intervals, got %+v", p)
+	}
+	if got := p.ConnectedBetween(classStart, at(60)); got != 53*time.Minute {
+		t.Errorf("Expected 53 connected minutes, got %s", got)
+	}
+	if !p.FirstJoin().Equal(at(2)) || !p.LastLeave().Equal(at(60)) {
+		t.Errorf("Unexpected check-in %s or check-out %s", p.FirstJoin(), p.LastLeave())
+	}
+	if got := presence["student-2"].ConnectedBetween(classStart, at(60)); got != 10*time.Minute {
+		t.Errorf("Expected 10 minutes counted until the end, got %s", got)
+	}
+
+	t.Log("✓ Reconnects merged into cumulative presence")
+}
+
+// TestPresenceStatus tests the present, late and absent thresholds
+func TestPresenceStatus(t *testing.T) {
+	cfg := DefaultPresenceConfig()
+	end := at(60)
+
+	tests := []struct {
+		name      string
+		intervals []Interval
+		want      string
+	}{
+		{"never joined", nil, "absent"},
+		{"on time", []Interval{{From: at(-5), To: at(60)}}, "present"},
+		{"late", []Interval{{From: at(12), To: at(60)}}, "late"},
+		{"under half", []Interval{{From: at(0), To: at(20)}, {From: at(50), To: at(55)}}, "absent"},
+		{"half with reconnects", []Interval{{From: at(5), To: at(20)}, {From: at(30), To: at(45)}}, "present"},
+		{"before the start only", []Interval{{From: at(-30), To: at(1)}}, "absent"},
+	}
+	for _, tt := range tests {
+		var p *Presence
+		if tt.intervals != nil {
+			p = &Presence{UserID: "student-1", Intervals: tt.intervals}
+		}
+		if got := cfg.Status(p, classStart, end); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+
+	t.Log("✓ Attendance status follows the thresholds")
+}
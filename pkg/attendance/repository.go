@@ -8,6 +8,7 @@ import (
 
 	"github.com/Bashar444/VTP/pkg/models"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 var (
@@ -234,6 +235,10 @@ func (r *Repository) BulkCreate(ctx context.Context, records []models.Attendance
 		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 		ON CONFLICT (student_id, class_section_id, date, subject_id) DO UPDATE SET
 			status = EXCLUDED.status,
+			meeting_id = COALESCE(EXCLUDED.meeting_id, attendance.meeting_id),
+			check_in_time = COALESCE(EXCLUDED.check_in_time, attendance.check_in_time),
+			check_out_time = COALESCE(EXCLUDED.check_out_time, attendance.check_out_time),
+			notes = COALESCE(NULLIF(EXCLUDED.notes, ''), attendance.notes),
 			updated_at = EXCLUDED.updated_at
 	`
 	stmt, err := tx.PrepareContext(ctx, query)
@@ -274,3 +279,26 @@ func (r *Repository) MarkPresent(ctx context.Context, studentID, meetingID strin
 	_, err := r.db.ExecContext(ctx, query, uuid.New().String(), studentID, meetingID, now.Format("2006-01-02"), now)
 	return err
 }
+
+// ClassSections returns the class section of each user that has one
+func (r *Repository) ClassSections(ctx context.Context, userIDs []string) (map[string]string, error) {
+	query := `
+		SELECT id, class_section_id FROM users
+		WHERE id = ANY($1::uuid[]) AND class_section_id IS NOT NULL
+	`
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sections := make(map[string]string)
+	for rows.Next() {
+		var userID, sectionID string
+		if err := rows.Scan(&userID, &sectionID); err != nil {
+			return nil, err
+		}
+		sections[userID] = sectionID
+	}
+	return sections, rows.Err()
+}
@@ -3,20 +3,34 @@ package attendance
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
 	"time"
 
+	"github.com/Bashar444/VTP/pkg/course"
 	"github.com/Bashar444/VTP/pkg/models"
+	"github.com/google/uuid"
 )
 
 var (
 	ErrInvalidStatus     = errors.New("invalid attendance status")
 	ErrInvalidDateRange  = errors.New("invalid date range")
 	ErrStudentIDRequired = errors.New("student ID is required")
+	ErrPresenceDisabled  = errors.New("presence tracking is not enabled")
+	ErrNoMeetingRoom     = errors.New("meeting has no live session room")
 )
 
+// Roster lists the students of a course (*course.CourseService)
+type Roster interface {
+	ListEnrollments(ctx context.Context, courseID uuid.UUID) ([]*course.CourseEnrollment, error)
+}
+
 // Service handles attendance business logic
 type Service struct {
-	repo *Repository
+	repo        *Repository
+	presence    *PresenceStore
+	presenceCfg PresenceConfig
+	roster      Roster
 }
 
 // NewService creates a new attendance service
@@ -109,6 +123,139 @@ func (s *Service) AutoMarkPresent(ctx context.Context, studentID, meetingID stri
 	return s.repo.MarkPresent(ctx, studentID, meetingID)
 }
 
+// WithPresence records attendance of completed meetings from the time
+// students were connected to the meeting's room
+func (s *Service) WithPresence(store *PresenceStore, cfg PresenceConfig) *Service {
+	s.presence = store
+	s.presenceCfg = cfg
+	return s
+}
+
+// WithRoster counts course students who never joined a meeting as absent
+func (s *Service) WithRoster(roster Roster) *Service {
+	s.roster = roster
+	return s
+}
+
+// RecordMeetingPresence records the attendance of a completed meeting from
+// presence in its room. The meeting runs from its scheduled start until it
+// was completed. Students of the meeting's course, or its one student, are
+// expected; without either, everyone but the instructor who joined is.
+// Students without a class section cannot be recorded and are skipped.
+func (s *Service) RecordMeetingPresence(ctx context.Context, m *models.Meeting) ([]models.Attendance, error) {
+	if s.presence == nil {
+		return nil, ErrPresenceDisabled
+	}
+	if m.RoomID == "" {
+		return nil, ErrNoMeetingRoom
+	}
+
+	start := m.ScheduledAt
+	end := start.Add(time.Duration(m.Duration) * time.Minute)
+	if m.EndTime != nil && m.EndTime.After(start) {
+		end = *m.EndTime
+	}
+	presence, err := s.presence.Take(ctx, m.RoomID, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load presence: %w", err)
+	}
+
+	studentIDs, err := s.expectedStudents(ctx, m, presence)
+	if err != nil {
+		return nil, err
+	}
+	if len(studentIDs) == 0 {
+		return nil, nil
+	}
+	sections, err := s.repo.ClassSections(ctx, studentIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load class sections: %w", err)
+	}
+
+	meetingID := m.ID
+	var subjectID *string
+	if m.SubjectID != "" {
+		subjectID = &m.SubjectID
+	}
+	date := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	minutes := int(end.Sub(start).Minutes())
+
+	records := make([]models.Attendance, 0, len(studentIDs))
+	for _, studentID := range studentIDs {
+		section, ok := sections[studentID]
+		if !ok {
+			slog.WarnContext(ctx, "Student has no class section, attendance not recorded",
+				"meeting_id", m.ID, "student_id", studentID)
+			continue
+		}
+
+		p := presence[studentID]
+		record := models.Attendance{
+			StudentID:      studentID,
+			ClassSectionID: section,
+			MeetingID:      &meetingID,
+			SubjectID:      subjectID,
+			Date:           date,
+			Status:         s.presenceCfg.Status(p, start, end),
+			Notes:          fmt.Sprintf("Live session: connected 0 of %d minutes", minutes),
+		}
+		if p != nil && len(p.Intervals) > 0 {
+			checkIn, checkOut := p.FirstJoin(), p.LastLeave()
+			record.CheckInTime = &checkIn
+			record.CheckOutTime = &checkOut
+			record.Notes = fmt.Sprintf("Live session: connected %d of %d minutes",
+				int(p.ConnectedBetween(start, end).Minutes()), minutes)
+		}
+		records = append(records, record)
+	}
+
+	if len(records) == 0 {
+		return nil, nil
+	}
+	if err := s.BulkRecordAttendance(ctx, records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// expectedStudents returns the students who should have attended a meeting
+func (s *Service) expectedStudents(ctx context.Context, m *models.Meeting, presence map[string]*Presence) ([]string, error) {
+	seen := make(map[string]bool)
+	var studentIDs []string
+	add := func(id string) {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			studentIDs = append(studentIDs, id)
+		}
+	}
+
+	if m.CourseID != "" && s.roster != nil {
+		courseID, err := uuid.Parse(m.CourseID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid course ID: %w", err)
+		}
+		enrollments, err := s.roster.ListEnrollments(ctx, courseID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list enrollments: %w", err)
+		}
+		for _, enrollment := range enrollments {
+			if enrollment.Status == course.EnrollmentActive {
+				add(enrollment.StudentID.String())
+			}
+		}
+	}
+	add(m.StudentID)
+
+	if len(studentIDs) == 0 {
+		for userID := range presence {
+			if userID != m.InstructorID {
+				add(userID)
+			}
+		}
+	}
+	return studentIDs, nil
+}
+
 // AttendanceReport holds attendance report data
 type AttendanceReport struct {
 	StudentID   string              `json:"student_id"`
@@ -0,0 +1,523 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/cache"
+)
+
+// Scopes of throttled authentication endpoints. Failures in the login and
+// 2FA scopes count toward the same account lockout.
+const (
+	ScopeLogin          = "login"
+	Scope2FA            = "2fa"
+	ScopeForgotPassword = "forgot_password"
+	ScopeResetToken     = "reset_token"
+)
+
+// Auth audit log events
+const (
+	AuditLoginSucceeded   = "login_succeeded"
+	AuditLoginNewLocation = "login_new_location"
+	AuditAccountLocked    = "account_locked"
+	AuditAccountUnlocked  = "account_unlocked"
+)
+
+var (
+	ErrTooManyAttempts = errors.New("too many attempts, try again later")
+	ErrAccountLocked   = errors.New("account is temporarily locked")
+
+	errUnlockUserNotFound = errors.New("user not found")
+)
+
+// ThrottleError is returned by LoginGuard.Check when a request is refused
+type ThrottleError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *ThrottleError) Error() string { return e.Err.Error() }
+
+func (e *ThrottleError) Unwrap() error { return e.Err }
+
+// AttemptCounter counts events in sliding windows. cache.RateLimiter
+// implements it on Redis and cache.MemoryRateLimiter in process memory.
+type AttemptCounter interface {
+	Hit(ctx context.Context, key string, window time.Duration) (int64, error)
+	Count(ctx context.Context, key string, window time.Duration) (int64, error)
+	Reset(ctx context.Context, keys ...string) error
+}
+
+// GuardConfig holds the brute-force protection limits
+type GuardConfig struct {
+	// Window is the sliding window failures are counted in
+	Window time.Duration
+	// MaxIPFailures refuses an IP address after this many failures in one
+	// scope within the window
+	MaxIPFailures int64
+	// MaxAccountFailures locks an account after this many failed logins and
+	// 2FA codes within the window
+	MaxAccountFailures int64
+	// MaxResetRequests limits password reset emails per account per window
+	MaxResetRequests int64
+	// LockoutDuration is how long a locked account stays locked unless an
+	// admin unlocks it or the password is reset
+	LockoutDuration time.Duration
+	// DelayAfter failures, each further failure doubles the response delay
+	// from BaseDelay up to MaxDelay
+	DelayAfter int64
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	// TrustProxyHeaders takes the client address from the last
+	// X-Forwarded-For entry. Enable it only behind a proxy that sets it.
+	TrustProxyHeaders bool
+}
+
+// DefaultGuardConfig returns the default brute-force protection limits
+func DefaultGuardConfig() GuardConfig {
+	return GuardConfig{
+		Window:             15 * time.Minute,
+		MaxIPFailures:      50,
+		MaxAccountFailures: 10,
+		MaxResetRequests:   3,
+		LockoutDuration:    30 * time.Minute,
+		DelayAfter:         3,
+		BaseDelay:          500 * time.Millisecond,
+		MaxDelay:           8 * time.Second,
+	}
+}
+
+// LoginGuard throttles authentication endpoints per IP address and per
+// account, locks accounts after repeated failures and writes the auth audit
+// log. Lockouts are persisted in the users table. A nil LoginGuard allows
+// everything.
+type LoginGuard struct {
+	counter AttemptCounter
+	db      *sql.DB
+	cfg     GuardConfig
+	log     *slog.Logger
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+// NewLoginGuard creates a login guard. Without a counter failures are
+// counted in memory; without a database lockouts last for the counting
+// window and audit events are only logged.
+func NewLoginGuard(counter AttemptCounter, db *sql.DB, cfg GuardConfig, logger *slog.Logger) *LoginGuard {
+	if counter == nil {
+		counter = cache.NewMemoryRateLimiter()
+	}
+	if logger == nil {
+		logger = slog.Default().With("component", "auth_guard")
+	}
+	return &LoginGuard{
+		counter: counter,
+		db:      db,
+		cfg:     cfg,
+		log:     logger,
+		sleep:   sleepContext,
+	}
+}
+
+// Check refuses a request from a throttled IP address or for a locked
+// account, and delays it progressively once failures accumulate. account is
+// an email address or user ID and may be empty.
+func (g *LoginGuard) Check(r *http.Request, scope, account string) error {
+	if g == nil {
+		return nil
+	}
+	ctx := r.Context()
+	account = normalizeAccount(account)
+
+	if account != "" && locksAccount(scope) {
+		if until, locked := g.lockedUntil(ctx, account); locked {
+			return &ThrottleError{Err: ErrAccountLocked, RetryAfter: time.Until(until)}
+		}
+	}
+
+	ipFailures := g.count(ctx, ipKey(scope, g.clientIP(r)))
+	if ipFailures >= g.cfg.MaxIPFailures {
+		return &ThrottleError{Err: ErrTooManyAttempts, RetryAfter: g.cfg.Window}
+	}
+
+	var accountFailures int64
+	if account != "" {
+		accountFailures = g.count(ctx, accountKey(scope, account))
+		if scope == ScopeForgotPassword && accountFailures >= g.cfg.MaxResetRequests {
+			return &ThrottleError{Err: ErrTooManyAttempts, RetryAfter: g.cfg.Window}
+		}
+	}
+
+	if delay := g.delay(max(ipFailures, accountFailures)); delay > 0 {
+		return g.sleep(ctx, delay)
+	}
+	return nil
+}
+
+// Failure records a failed attempt and locks the account once it reaches
+// the limit. Every password reset request is recorded as a failure so a
+// mailbox cannot be flooded.
+func (g *LoginGuard) Failure(r *http.Request, scope, account string) {
+	if g == nil {
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	account = normalizeAccount(account)
+
+	g.hit(ctx, ipKey(scope, g.clientIP(r)))
+	if account == "" {
+		return
+	}
+	failures := g.hit(ctx, accountKey(scope, account))
+	if locksAccount(scope) && failures >= g.cfg.MaxAccountFailures {
+		g.lock(ctx, r, account, failures)
+	}
+}
+
+// Success clears the account's failures after a completed login. IP
+// failures are kept so one valid account cannot hide guessing at others.
+func (g *LoginGuard) Success(r *http.Request, scope, account string) {
+	if g == nil {
+		return
+	}
+	account = normalizeAccount(account)
+	if account == "" {
+		return
+	}
+	if err := g.counter.Reset(r.Context(), accountKey(scope, account)); err != nil {
+		g.log.WarnContext(r.Context(), "Failed to reset login failures", "error", err)
+	}
+}
+
+// LoginSucceeded writes a completed login to the audit log. A login from a
+// network the user has not signed in from before is also recorded as a new
+// location once the user has a login history.
+func (g *LoginGuard) LoginSucceeded(r *http.Request, userID, email string) {
+	if g == nil {
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	ip := g.clientIP(r)
+	network := ipNetwork(ip)
+
+	if g.db != nil {
+		var seen, hasHistory bool
+		err := g.db.QueryRowContext(ctx,
+			`SELECT EXISTS(SELECT 1 FROM auth_audit_log WHERE user_id = $1 AND event = $2 AND network = $3),
+			        EXISTS(SELECT 1 FROM auth_audit_log WHERE user_id = $1 AND event = $2)`,
+			userID, AuditLoginSucceeded, network,
+		).Scan(&seen, &hasHistory)
+		if err != nil {
+			g.log.WarnContext(ctx, "Failed to check login history", "error", err)
+		} else if hasHistory && !seen {
+			g.log.WarnContext(ctx, "Login from a new location", "user_id", userID, "network", network)
+			g.audit(ctx, r, AuditLoginNewLocation, userID, email, nil)
+		}
+	}
+	g.audit(ctx, r, AuditLoginSucceeded, userID, email, nil)
+}
+
+// Unlock clears a user's lockout and login failures. reason and by are
+// recorded in the audit log; by is empty when the user unlocked the account
+// with a password reset. It reports whether the account was locked.
+func (g *LoginGuard) Unlock(r *http.Request, userID, reason, by string) (bool, error) {
+	if g == nil {
+		return false, nil
+	}
+	ctx := r.Context()
+
+	var email string
+	var wasLocked bool
+	if g.db != nil {
+		err := g.db.QueryRowContext(ctx,
+			`UPDATE users u SET locked_until = NULL, lockout_reason = NULL
+			 FROM (SELECT id, locked_until FROM users WHERE id = $1 FOR UPDATE) prev
+			 WHERE u.id = prev.id
+			 RETURNING u.email, prev.locked_until IS NOT NULL AND prev.locked_until > NOW()`,
+			userID,
+		).Scan(&email, &wasLocked)
+		if err == sql.ErrNoRows {
+			return false, errUnlockUserNotFound
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to unlock account: %w", err)
+		}
+	}
+
+	keys := []string{accountKey(ScopeLogin, userID), accountKey(Scope2FA, userID)}
+	if email != "" {
+		email = normalizeAccount(email)
+		keys = append(keys, accountKey(ScopeLogin, email), accountKey(Scope2FA, email))
+	}
+	if err := g.counter.Reset(ctx, keys...); err != nil {
+		return wasLocked, fmt.Errorf("failed to reset login failures: %w", err)
+	}
+
+	if wasLocked {
+		g.audit(ctx, r, AuditAccountUnlocked, userID, email, map[string]string{"reason": reason, "by": by})
+	}
+	return wasLocked, nil
+}
+
+// AuditEntry is one auth audit log record
+type AuditEntry struct {
+	ID        string            `json:"id"`
+	UserID    string            `json:"user_id,omitempty"`
+	Account   string            `json:"account,omitempty"`
+	Event     string            `json:"event"`
+	IPAddress string            `json:"ip_address"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// AuditLog returns audit log entries, newest first, optionally filtered by
+// user and event
+func (g *LoginGuard) AuditLog(ctx context.Context, userID, event string, limit int) ([]AuditEntry, error) {
+	if g == nil || g.db == nil {
+		return []AuditEntry{}, nil
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	rows, err := g.db.QueryContext(ctx,
+		`SELECT id, COALESCE(user_id::text, ''), COALESCE(account, ''), event,
+		        COALESCE(ip_address, ''), COALESCE(user_agent, ''), COALESCE(details, '{}'::jsonb), created_at
+		 FROM auth_audit_log
+		 WHERE ($1 = '' OR user_id::text = $1) AND ($2 = '' OR event = $2)
+		 ORDER BY created_at DESC
+		 LIMIT $3`,
+		userID, event, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var details []byte
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Account, &e.Event, &e.IPAddress, &e.UserAgent, &details, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		_ = json.Unmarshal(details, &e.Details)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// lock persists a lockout for an existing account and starts its failures
+// over, so the account gets a fresh set of attempts once the lock expires
+func (g *LoginGuard) lock(ctx context.Context, r *http.Request, account string, failures int64) {
+	until := time.Now().Add(g.cfg.LockoutDuration)
+	reason := fmt.Sprintf("%d failed attempts", failures)
+	g.log.WarnContext(ctx, "Account locked", "account", account, "failures", failures, "until", until)
+
+	if g.db == nil {
+		g.audit(ctx, r, AuditAccountLocked, "", account, map[string]string{"reason": reason})
+		return
+	}
+
+	var userID string
+	err := g.db.QueryRowContext(ctx,
+		`UPDATE users SET locked_until = $1, lockout_reason = $2
+		 WHERE lower(email) = $3 OR id::text = $3
+		 RETURNING id`,
+		until, reason, account,
+	).Scan(&userID)
+	if err == sql.ErrNoRows {
+		// Unknown accounts are still throttled by their failure count
+		return
+	}
+	if err != nil {
+		g.log.ErrorContext(ctx, "Failed to persist lockout", "account", account, "error", err)
+		return
+	}
+
+	if err := g.counter.Reset(ctx, accountKey(ScopeLogin, account)); err != nil {
+		g.log.WarnContext(ctx, "Failed to reset login failures", "error", err)
+	}
+	g.audit(ctx, r, AuditAccountLocked, userID, account, map[string]string{
+		"reason": reason,
+		"until":  until.UTC().Format(time.RFC3339),
+	})
+}
+
+// lockedUntil reports whether the account is locked and until when. Without
+// a database an account is locked while its failures are at the limit.
+func (g *LoginGuard) lockedUntil(ctx context.Context, account string) (time.Time, bool) {
+	if g.db == nil {
+		if g.count(ctx, accountKey(ScopeLogin, account)) >= g.cfg.MaxAccountFailures {
+			return time.Now().Add(g.cfg.Window), true
+		}
+		return time.Time{}, false
+	}
+
+	var until time.Time
+	err := g.db.QueryRowContext(ctx,
+		`SELECT locked_until FROM users
+		 WHERE (lower(email) = $1 OR id::text = $1) AND locked_until > NOW()
+		 LIMIT 1`,
+		account,
+	).Scan(&until)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false
+	}
+	if err != nil {
+		g.log.WarnContext(ctx, "Failed to check account lockout", "error", err)
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// audit writes an auth audit log entry
+func (g *LoginGuard) audit(ctx context.Context, r *http.Request, event, userID, account string, details map[string]string) {
+	ip := g.clientIP(r)
+	g.log.InfoContext(ctx, "Auth audit event", "event", event, "user_id", userID, "account", account, "ip", ip)
+	if g.db == nil {
+		return
+	}
+
+	detailsJSON, _ := json.Marshal(details)
+	_, err := g.db.ExecContext(ctx,
+		`INSERT INTO auth_audit_log (user_id, account, event, ip_address, network, user_agent, details)
+		 VALUES (NULLIF($1, '')::uuid, NULLIF($2, ''), $3, $4, $5, $6, $7)`,
+		userID, account, event, ip, ipNetwork(ip), r.UserAgent(), detailsJSON,
+	)
+	if err != nil {
+		g.log.ErrorContext(ctx, "Failed to write auth audit log", "event", event, "error", err)
+	}
+}
+
+// count returns the failures for key. Counter errors let the request
+// through: an unavailable Redis must not lock everyone out.
+func (g *LoginGuard) count(ctx context.Context, key string) int64 {
+	n, err := g.counter.Count(ctx, key, g.cfg.Window)
+	if err != nil {
+		g.log.WarnContext(ctx, "Failed to read login failures", "error", err)
+		return 0
+	}
+	return n
+}
+
+func (g *LoginGuard) hit(ctx context.Context, key string) int64 {
+	n, err := g.counter.Hit(ctx, key, g.cfg.Window)
+	if err != nil {
+		g.log.WarnContext(ctx, "Failed to record login failure", "error", err)
+		return 0
+	}
+	return n
+}
+
+// delay returns the progressive delay for a number of failures
+func (g *LoginGuard) delay(failures int64) time.Duration {
+	if failures < g.cfg.DelayAfter || g.cfg.BaseDelay <= 0 {
+		return 0
+	}
+	d := g.cfg.BaseDelay
+	for i := g.cfg.DelayAfter; i < failures && d < g.cfg.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, g.cfg.MaxDelay)
+}
+
+// clientIP returns the client address of the request
+func (g *LoginGuard) clientIP(r *http.Request) string {
+	if g.cfg.TrustProxyHeaders {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			parts := strings.Split(forwarded, ",")
+			return strings.TrimSpace(parts[len(parts)-1])
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// ipNetwork groups addresses by /24 for IPv4 and /48 for IPv6, roughly one
+// network per location
+func ipNetwork(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// locksAccount reports whether failures in the scope count toward lockout
+func locksAccount(scope string) bool {
+	return scope == ScopeLogin || scope == Scope2FA
+}
+
+func normalizeAccount(account string) string {
+	return strings.ToLower(strings.TrimSpace(account))
+}
+
+func ipKey(scope, ip string) string {
+	return "auth:" + scope + ":ip:" + ip
+}
+
+// accountKey shares one counter between the login and 2FA scopes so a
+// password and a second factor are guessed against the same budget
+func accountKey(scope, account string) string {
+	if locksAccount(scope) {
+		scope = ScopeLogin
+	}
+	return "auth:" + scope + ":account:" + account
+}
+
+// writeThrottleError responds to a refused request and reports whether err
+// was a throttle error. Any other error, such as the request being
+// cancelled during its delay, gets a generic 503.
+func writeThrottleError(w http.ResponseWriter, err error) bool {
+	var te *ThrottleError
+	if !errors.As(err, &te) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(ErrorResponse{
+			Error: "request could not be completed, try again",
+			Code:  "REQUEST_NOT_COMPLETED",
+		})
+		return false
+	}
+
+	retryAfter := int(te.RetryAfter.Round(time.Second).Seconds())
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", fmt.Sprint(retryAfter))
+	w.Header().Set("Content-Type", "application/json")
+
+	status, code := http.StatusTooManyRequests, "TOO_MANY_ATTEMPTS"
+	if errors.Is(te, ErrAccountLocked) {
+		status, code = http.StatusLocked, "ACCOUNT_LOCKED"
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: te.Error(), Code: code})
+	return true
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
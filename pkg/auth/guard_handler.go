@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Bashar444/VTP/pkg/router"
+)
+
+// GuardHandler exposes account lockouts and the auth audit log to admins
+type GuardHandler struct {
+	guard *LoginGuard
+}
+
+// NewGuardHandler creates a new guard handler
+func NewGuardHandler(guard *LoginGuard) *GuardHandler {
+	return &GuardHandler{guard: guard}
+}
+
+// RegisterRoutes registers the admin security routes
+func (h *GuardHandler) RegisterRoutes(rt *router.Router, am *AuthMiddleware) {
+	admin := rt.With(am.Middleware, am.RoleMiddleware("admin"))
+	admin.HandleFunc("POST /api/v1/admin/security/users/{id}/unlock", h.UnlockUser)
+	admin.HandleFunc("GET /api/v1/admin/security/audit-log", h.GetAuditLog)
+}
+
+// UnlockUser handles POST /api/v1/admin/security/users/{id}/unlock
+func (h *GuardHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+	adminID, _ := r.Context().Value("user_id").(string)
+
+	wasLocked, err := h.guard.Unlock(r, userID, "admin", adminID)
+	if err != nil {
+		if err == errUnlockUserNotFound {
+			respondError(w, http.StatusNotFound, "User not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to unlock account")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id":    userID,
+		"was_locked": wasLocked,
+		"message":    "Account unlocked",
+	})
+}
+
+// GetAuditLog handles GET /api/v1/admin/security/audit-log. It accepts
+// user_id, event and limit query parameters.
+func (h *GuardHandler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+
+	entries, err := h.guard.AuditLog(r.Context(), query.Get("user_id"), query.Get("event"), limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get audit log")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestGuard(cfg GuardConfig) (*LoginGuard, *[]time.Duration) {
+	g := NewLoginGuard(nil, nil, cfg, nil)
+	var delays []time.Duration
+	g.sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	return g, &delays
+}
+
+// TestLoginGuardLockout tests progressive delays and lockout after repeated
+// failures for one account
+func TestLoginGuardLockout(t *testing.T) {
+	cfg := DefaultGuardConfig()
+	cfg.MaxAccountFailures = 5
+	cfg.DelayAfter = 2
+	cfg.BaseDelay = time.Second
+	cfg.MaxDelay = 3 * time.Second
+	g, delays := newTestGuard(cfg)
+
+	req := httptest.NewRequest("POST", "/api/v1/auth/login", nil)
+	for i := 0; i < 4; i++ {
+		if err := g.Check(req, ScopeLogin, "Teacher@Example.com"); err != nil {
+			t.Fatalf("Attempt %d refused: %v", i+1, err)
+		}
+		g.Failure(req, ScopeLogin, "teacher@example.com")
+	}
+
+	expected := []time.Duration{time.Second, 2 * time.Second}
+	if len(*delays) != len(expected) {
+		t.Fatalf("Expected delays %v, got %v", expected, *delays)
+	}
+	for i, d := range expected {
+		if (*delays)[i] != d {
+			t.Errorf("Delay %d: expected %v, got %v", i, d, (*delays)[i])
+		}
+	}
+
+	// A wrong 2FA code counts against the same account
+	g.Failure(req, Scope2FA, "teacher@example.com")
+	err := g.Check(req, ScopeLogin, "teacher@example.com")
+	if !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("Expected account lockout, got %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	if !writeThrottleError(rec, err) || rec.Code != 423 || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Unexpected lockout response: %d %v", rec.Code, rec.Header())
+	}
+
+	// Other accounts are unaffected, and password resets stay available
+	if err := g.Check(req, ScopeLogin, "student@example.com"); errors.Is(err, ErrAccountLocked) {
+		t.Error("Unrelated account locked")
+	}
+	if err := g.Check(req, ScopeForgotPassword, "teacher@example.com"); err != nil {
+		t.Errorf("Password reset refused for locked account: %v", err)
+	}
+
+	t.Log("✓ Accounts locked after repeated failures")
+}
+
+// TestLoginGuardCancelledDelay tests that a request cancelled while it is
+// delayed still gets an error response
+func TestLoginGuardCancelledDelay(t *testing.T) {
+	cfg := DefaultGuardConfig()
+	cfg.DelayAfter = 1
+	cfg.BaseDelay = time.Second
+	g := NewLoginGuard(nil, nil, cfg, nil)
+	g.sleep = func(ctx context.Context, d time.Duration) error {
+		return context.Canceled
+	}
+
+	req := httptest.NewRequest("POST", "/api/v1/auth/login", nil)
+	g.Failure(req, ScopeLogin, "teacher@example.com")
+	err := g.Check(req, ScopeLogin, "teacher@example.com")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the cancelled delay to refuse the request, got %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	if writeThrottleError(rec, err) {
+		t.Error("Cancelled delay reported as a throttle error")
+	}
+	if rec.Code != 503 || rec.Body.Len() == 0 {
+		t.Errorf("Unexpected response for a cancelled delay: %d %q", rec.Code, rec.Body.String())
+	}
+
+	t.Log("✓ Cancelled delays answered with an error")
+}
+
+// TestLoginGuardIPLimit tests the per-IP limit across accounts
+func TestLoginGuardIPLimit(t *testing.T) {
+	cfg := DefaultGuardConfig()
+	cfg.MaxIPFailures = 3
+	g, _ := newTestGuard(cfg)
+
+	req := httptest.NewRequest("POST", "/api/v1/auth/verify-reset-token", nil)
+	req.RemoteAddr = "203.0.113.7:5000"
+	for i := 0; i < 3; i++ {
+		g.Failure(req, ScopeResetToken, "")
+	}
+	if err := g.Check(req, ScopeResetToken, ""); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("Expected IP throttling, got %v", err)
+	}
+
+	other := httptest.NewRequest("POST", "/api/v1/auth/verify-reset-token", nil)
+	other.RemoteAddr = "198.51.100.1:5000"
+	if err := g.Check(other, ScopeResetToken, ""); err != nil {
+		t.Errorf("Other IP throttled: %v", err)
+	}
+
+	// Forged forwarding headers are ignored unless the proxy is trusted
+	req.Header.Set("X-Forwarded-For", "192.0.2.1")
+	if err := g.Check(req, ScopeResetToken, ""); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("X-Forwarded-For bypassed the IP limit: %v", err)
+	}
+
+	t.Log("✓ IP addresses throttled per scope")
+}
+
+// TestLoginGuardSuccessResets tests that a completed login clears the
+// account's failures
+func TestLoginGuardSuccessResets(t *testing.T) {
+	cfg := DefaultGuardConfig()
+	cfg.MaxAccountFailures = 3
+	g, _ := newTestGuard(cfg)
+
+	req := httptest.NewRequest("POST", "/api/v1/auth/login", nil)
+	g.Failure(req, ScopeLogin, "admin@example.com")
+	g.Failure(req, ScopeLogin, "admin@example.com")
+	g.Success(req, ScopeLogin, "admin@example.com")
+	g.Failure(req, ScopeLogin, "admin@example.com")
+
+	if err := g.Check(req, ScopeLogin, "admin@example.com"); err != nil {
+		t.Errorf("Account locked after a successful login: %v", err)
+	}
+	if got := ipNetwork("203.0.113.7"); got != "203.0.113.0/24" {
+		t.Errorf("Unexpected network %q", got)
+	}
+
+	t.Log("✓ Successful login clears account failures")
+}
@@ -2,10 +2,13 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+
+	"github.com/Bashar444/VTP/pkg/router"
 )
 
 // RegisterRequest represents the request body for user registration
@@ -23,6 +26,18 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+// Login2FARequest represents the request body for the second login step
+type Login2FARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+// Login2FASetupRequest represents the request body for enrolling in 2FA
+// during login
+type Login2FASetupRequest struct {
+	MFAToken string `json:"mfa_token"`
+}
+
 // RefreshRequest represents the request body for token refresh
 type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token"`
@@ -52,6 +67,16 @@ type LoginResponse struct {
 	User         UserResponse `json:"user"`
 }
 
+// MFAChallengeResponse is returned by login instead of tokens when the user
+// must complete a second factor. EnrollmentRequired is set when the user's
+// role requires 2FA and the user has not enrolled yet.
+type MFAChallengeResponse struct {
+	MFARequired        bool   `json:"mfa_required"`
+	EnrollmentRequired bool   `json:"enrollment_required,omitempty"`
+	MFAToken           string `json:"mfa_token"`
+	ExpiresIn          int64  `json:"expires_in"`
+}
+
 // UserResponse represents user data in API responses (without sensitive info)
 type UserResponse struct {
 	UserID   string `json:"user_id"`
@@ -80,6 +105,8 @@ type AuthHandler struct {
 	userStore       *UserStore
 	tokenService    *TokenService
 	passwordService *PasswordService
+	twoFactor       *TwoFactorService
+	guard           *LoginGuard
 }
 
 // NewAuthHandler creates a new auth handler
@@ -91,6 +118,34 @@ func NewAuthHandler(userStore *UserStore, tokenService *TokenService, passwordSe
 	}
 }
 
+// WithTwoFactor enables the 2FA login step and the admin policy requiring
+// 2FA for some roles
+func (ah *AuthHandler) WithTwoFactor(twoFactor *TwoFactorService) *AuthHandler {
+	ah.twoFactor = twoFactor
+	return ah
+}
+
+// WithGuard throttles login attempts and locks accounts after repeated
+// failures
+func (ah *AuthHandler) WithGuard(guard *LoginGuard) *AuthHandler {
+	ah.guard = guard
+	return ah
+}
+
+// RegisterRoutes registers the account routes. Registration, login and
+// refresh are public; profile routes require authentication.
+func (ah *AuthHandler) RegisterRoutes(rt *router.Router, am *AuthMiddleware) {
+	rt.HandleFunc("POST /api/v1/auth/register", ah.RegisterHandler)
+	rt.HandleFunc("POST /api/v1/auth/login", ah.LoginHandler)
+	rt.HandleFunc("POST /api/v1/auth/login/2fa", ah.Login2FAHandler)
+	rt.HandleFunc("POST /api/v1/auth/login/2fa/setup", ah.Login2FASetupHandler)
+	rt.HandleFunc("POST /api/v1/auth/refresh", ah.RefreshHandler)
+
+	api := rt.With(am.Middleware)
+	api.HandleFunc("GET /api/v1/auth/profile", ah.GetProfileHandler)
+	api.HandleFunc("POST /api/v1/auth/change-password", ah.ChangePasswordHandler)
+}
+
 // RegisterHandler handles POST /api/v1/auth/register
 func (ah *AuthHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	// Validate request method
@@ -168,13 +223,153 @@ func (ah *AuthHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Refuse throttled clients and locked accounts before checking the
+	// password
+	if err := ah.guard.Check(r, ScopeLogin, req.Email); err != nil {
+		writeThrottleError(w, err)
+		return
+	}
+
 	// Authenticate user
 	user, err := ah.userStore.AuthenticateUser(r.Context(), req.Email, req.Password)
 	if err != nil {
+		ah.guard.Failure(r, ScopeLogin, req.Email)
 		ah.respondError(w, http.StatusUnauthorized, "INVALID_CREDENTIALS", "Invalid email or password")
 		return
 	}
 
+	// Users with 2FA, or whose role requires it, get a challenge instead of
+	// tokens
+	purpose := ""
+	if user.TOTPEnabled {
+		purpose = PurposeMFA
+	} else if ah.twoFactor != nil {
+		required, err := ah.twoFactor.IsRequired(r.Context(), user.Role)
+		if err != nil {
+			ah.respondError(w, http.StatusInternalServerError, "LOGIN_FAILED", "Failed to check 2FA policy")
+			return
+		}
+		if required {
+			purpose = PurposeMFAEnroll
+		}
+	}
+	if purpose != "" {
+		challenge, err := ah.tokenService.GenerateChallengeToken(user.ID, user.Email, user.Role, purpose)
+		if err != nil {
+			ah.respondError(w, http.StatusInternalServerError, "TOKEN_GENERATION_FAILED", "Failed to generate tokens")
+			return
+		}
+		ah.respondSuccess(w, http.StatusOK, MFAChallengeResponse{
+			MFARequired:        true,
+			EnrollmentRequired: purpose == PurposeMFAEnroll,
+			MFAToken:           challenge,
+			ExpiresIn:          int64(MFAChallengeDuration.Seconds()),
+		})
+		return
+	}
+
+	ah.completeLogin(w, r, user)
+}
+
+// Login2FAHandler handles POST /api/v1/auth/login/2fa. It exchanges a
+// challenge token from login and a TOTP or backup code for a token pair. For
+// an enrollment challenge the code confirms the secret from
+// /api/v1/auth/login/2fa/setup and enables 2FA.
+func (ah *AuthHandler) Login2FAHandler(w http.ResponseWriter, r *http.Request) {
+	if ah.twoFactor == nil {
+		ah.respondError(w, http.StatusServiceUnavailable, "2FA_UNAVAILABLE", "Two-factor authentication is not available")
+		return
+	}
+
+	var req Login2FARequest
+	if err := ah.parseJSONBody(r, &req); err != nil {
+		ah.respondError(w, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+	if req.MFAToken == "" || req.Code == "" {
+		ah.respondError(w, http.StatusBadRequest, "MISSING_FIELDS", "mfa_token and code are required")
+		return
+	}
+
+	claims, err := ah.tokenService.ValidateChallengeToken(req.MFAToken, PurposeMFA, PurposeMFAEnroll)
+	if err != nil {
+		ah.respondError(w, http.StatusUnauthorized, "INVALID_MFA_TOKEN", "Invalid or expired MFA token, please sign in again")
+		return
+	}
+	if err := ah.guard.Check(r, Scope2FA, claims.Email); err != nil {
+		writeThrottleError(w, err)
+		return
+	}
+
+	if claims.Purpose == PurposeMFAEnroll {
+		err = ah.twoFactor.Enable2FA(r.Context(), claims.UserID, req.Code)
+	} else {
+		err = ah.twoFactor.Verify2FA(r.Context(), claims.UserID, req.Code)
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrInvalidTOTPCode):
+		ah.guard.Failure(r, Scope2FA, claims.Email)
+		ah.respondError(w, http.StatusUnauthorized, "INVALID_CODE", "Invalid verification code")
+		return
+	case errors.Is(err, ErrTOTPCodeReused):
+		ah.guard.Failure(r, Scope2FA, claims.Email)
+		ah.respondError(w, http.StatusUnauthorized, "CODE_REUSED", "Verification code has already been used, wait for the next one")
+		return
+	case errors.Is(err, ErrTOTPNotEnabled), errors.Is(err, ErrTOTPAlreadyEnabled):
+		ah.respondError(w, http.StatusConflict, "2FA_STATE_CHANGED", "Two-factor settings changed, please sign in again")
+		return
+	default:
+		ah.respondError(w, http.StatusInternalServerError, "2FA_FAILED", "Failed to verify code")
+		return
+	}
+
+	// Reload the user so the tokens carry the current role
+	user, err := ah.userStore.GetUserByID(r.Context(), claims.UserID)
+	if err != nil {
+		ah.respondError(w, http.StatusUnauthorized, "USER_NOT_FOUND", "User not found")
+		return
+	}
+
+	ah.completeLogin(w, r, user)
+}
+
+// Login2FASetupHandler handles POST /api/v1/auth/login/2fa/setup. It
+// generates a TOTP secret and backup codes for a user holding an enrollment
+// challenge.
+func (ah *AuthHandler) Login2FASetupHandler(w http.ResponseWriter, r *http.Request) {
+	if ah.twoFactor == nil {
+		ah.respondError(w, http.StatusServiceUnavailable, "2FA_UNAVAILABLE", "Two-factor authentication is not available")
+		return
+	}
+
+	var req Login2FASetupRequest
+	if err := ah.parseJSONBody(r, &req); err != nil {
+		ah.respondError(w, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+
+	claims, err := ah.tokenService.ValidateChallengeToken(req.MFAToken, PurposeMFAEnroll)
+	if err != nil {
+		ah.respondError(w, http.StatusUnauthorized, "INVALID_MFA_TOKEN", "Invalid or expired MFA token, please sign in again")
+		return
+	}
+
+	resp, err := ah.twoFactor.Setup2FA(r.Context(), claims.UserID, claims.Email)
+	if err != nil {
+		if errors.Is(err, ErrTOTPAlreadyEnabled) {
+			ah.respondError(w, http.StatusConflict, "2FA_STATE_CHANGED", "Two-factor settings changed, please sign in again")
+			return
+		}
+		ah.respondError(w, http.StatusInternalServerError, "2FA_SETUP_FAILED", "Failed to setup 2FA")
+		return
+	}
+
+	ah.respondSuccess(w, http.StatusOK, resp)
+}
+
+// completeLogin issues a token pair for an authenticated user
+func (ah *AuthHandler) completeLogin(w http.ResponseWriter, r *http.Request, user *User) {
 	// Generate tokens
 	tokenPair, err := ah.tokenService.GenerateTokenPair(user.ID, user.Email, user.Role)
 	if err != nil {
@@ -184,6 +379,8 @@ func (ah *AuthHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Update last login
 	_ = ah.userStore.UpdateLastLogin(r.Context(), user.ID)
+	ah.guard.Success(r, ScopeLogin, user.Email)
+	ah.guard.LoginSucceeded(r, user.ID, user.Email)
 
 	// Prepare response
 	resp := LoginResponse{
@@ -2,12 +2,16 @@ package auth
 
 import (
 	"encoding/json"
+	"log/slog"
 	"net/http"
+
+	"github.com/Bashar444/VTP/pkg/router"
 )
 
 // PasswordResetHandler handles password reset HTTP requests
 type PasswordResetHandler struct {
 	service *PasswordResetService
+	guard   *LoginGuard
 }
 
 // NewPasswordResetHandler creates a new password reset handler
@@ -15,6 +19,13 @@ func NewPasswordResetHandler(service *PasswordResetService) *PasswordResetHandle
 	return &PasswordResetHandler{service: service}
 }
 
+// WithGuard throttles reset requests and token guessing, and unlocks an
+// account when its password is reset
+func (h *PasswordResetHandler) WithGuard(guard *LoginGuard) *PasswordResetHandler {
+	h.guard = guard
+	return h
+}
+
 // RequestResetRequest is the request body for requesting a password reset
 type RequestResetRequest struct {
 	Email string `json:"email"`
@@ -31,6 +42,13 @@ type ResetPasswordRequest struct {
 	NewPassword string `json:"new_password"`
 }
 
+// RegisterRoutes registers the public password reset routes
+func (h *PasswordResetHandler) RegisterRoutes(rt *router.Router) {
+	rt.HandleFunc("POST /api/v1/auth/forgot-password", h.RequestPasswordReset)
+	rt.HandleFunc("POST /api/v1/auth/verify-reset-token", h.VerifyResetToken)
+	rt.HandleFunc("POST /api/v1/auth/reset-password", h.ResetPassword)
+}
+
 // RequestPasswordReset handles POST /api/v1/auth/forgot-password
 func (h *PasswordResetHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
 	var req RequestResetRequest
@@ -44,6 +62,13 @@ func (h *PasswordResetHandler) RequestPasswordReset(w http.ResponseWriter, r *ht
 		return
 	}
 
+	// Every request counts, so reset emails cannot be used to flood a mailbox
+	if err := h.guard.Check(r, ScopeForgotPassword, req.Email); err != nil {
+		writeThrottleError(w, err)
+		return
+	}
+	h.guard.Failure(r, ScopeForgotPassword, req.Email)
+
 	// Get client info for logging
 	ipAddress := getClientIP(r)
 	userAgent := r.UserAgent()
@@ -82,9 +107,15 @@ func (h *PasswordResetHandler) VerifyResetToken(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	if err := h.guard.Check(r, ScopeResetToken, ""); err != nil {
+		writeThrottleError(w, err)
+		return
+	}
+
 	userID, err := h.service.VerifyResetToken(r.Context(), req.Token)
 	if err != nil {
 		if err == ErrInvalidResetToken || err == ErrTokenAlreadyUsed {
+			h.guard.Failure(r, ScopeResetToken, "")
 			respondError(w, http.StatusUnauthorized, err.Error())
 			return
 		}
@@ -121,9 +152,19 @@ func (h *PasswordResetHandler) ResetPassword(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err := h.service.ResetPassword(r.Context(), req.Token, req.NewPassword)
+	// Reset tokens are guessed against the same budget as verification
+	if err := h.guard.Check(r, ScopeResetToken, ""); err != nil {
+		writeThrottleError(w, err)
+		return
+	}
+
+	userID, err := h.service.VerifyResetToken(r.Context(), req.Token)
+	if err == nil {
+		err = h.service.ResetPassword(r.Context(), req.Token, req.NewPassword)
+	}
 	if err != nil {
 		if err == ErrInvalidResetToken || err == ErrTokenAlreadyUsed {
+			h.guard.Failure(r, ScopeResetToken, "")
 			respondError(w, http.StatusUnauthorized, err.Error())
 			return
 		}
@@ -131,6 +172,11 @@ func (h *PasswordResetHandler) ResetPassword(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// A password reset proves ownership of the account, so it ends a lockout
+	if _, err := h.guard.Unlock(r, userID, "password_reset", ""); err != nil {
+		slog.WarnContext(r.Context(), "Failed to clear lockout after password reset", "user_id", userID, "error", err)
+	}
+
 	respondJSON(w, http.StatusOK, map[string]string{
 		"message": "Password reset successfully",
 	})
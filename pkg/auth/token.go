@@ -8,11 +8,25 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Purposes of single-purpose tokens. Session tokens carry no purpose.
+const (
+	// PurposeMFA marks a challenge token issued after the password check
+	// for a user with 2FA enabled
+	PurposeMFA = "mfa"
+	// PurposeMFAEnroll marks a challenge token issued to a user who must
+	// enroll in 2FA before signing in
+	PurposeMFAEnroll = "mfa_enroll"
+)
+
+// MFAChallengeDuration is how long a user has to complete the second factor
+const MFAChallengeDuration = 5 * time.Minute
+
 // TokenClaims represents the JWT claims for a user
 type TokenClaims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID  string `json:"user_id"`
+	Email   string `json:"email"`
+	Role    string `json:"role"`
+	Purpose string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -47,13 +61,13 @@ func (ts *TokenService) GenerateTokenPair(userID, email, role string) (*TokenPai
 	}
 
 	// Generate access token
-	accessToken, err := ts.generateToken(userID, email, role, ts.accessDuration)
+	accessToken, err := ts.generateToken(userID, email, role, "", ts.accessDuration)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
 	// Generate refresh token
-	refreshToken, err := ts.generateToken(userID, email, role, ts.refreshDuration)
+	refreshToken, err := ts.generateToken(userID, email, role, "", ts.refreshDuration)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
@@ -66,15 +80,26 @@ func (ts *TokenService) GenerateTokenPair(userID, email, role string) (*TokenPai
 	}, nil
 }
 
+// GenerateChallengeToken generates a short-lived token that only proves the
+// password step of a login. It is rejected everywhere a session token is
+// expected.
+func (ts *TokenService) GenerateChallengeToken(userID, email, role, purpose string) (string, error) {
+	if userID == "" || purpose == "" {
+		return "", errors.New("userID and purpose are required")
+	}
+	return ts.generateToken(userID, email, role, purpose, MFAChallengeDuration)
+}
+
 // generateToken generates a JWT token with specified duration
-func (ts *TokenService) generateToken(userID, email, role string, duration time.Duration) (string, error) {
+func (ts *TokenService) generateToken(userID, email, role, purpose string, duration time.Duration) (string, error) {
 	now := time.Now()
 	expiresAt := now.Add(duration)
 
 	claims := &TokenClaims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
+		UserID:  userID,
+		Email:   email,
+		Role:    role,
+		Purpose: purpose,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -92,8 +117,36 @@ func (ts *TokenService) generateToken(userID, email, role string, duration time.
 	return tokenString, nil
 }
 
-// ValidateToken validates a JWT token and returns its claims
+// ValidateToken validates a session token and returns its claims.
+// Single-purpose tokens are rejected.
 func (ts *TokenService) ValidateToken(tokenString string) (*TokenClaims, error) {
+	claims, err := ts.parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, errors.New("token is not a session token")
+	}
+	return claims, nil
+}
+
+// ValidateChallengeToken validates a challenge token issued for one of the
+// given purposes and returns its claims
+func (ts *TokenService) ValidateChallengeToken(tokenString string, purposes ...string) (*TokenClaims, error) {
+	claims, err := ts.parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	for _, purpose := range purposes {
+		if claims.Purpose == purpose {
+			return claims, nil
+		}
+	}
+	return nil, errors.New("token has the wrong purpose")
+}
+
+// parseToken verifies the signature and expiry of a token
+func (ts *TokenService) parseToken(tokenString string) (*TokenClaims, error) {
 	if tokenString == "" {
 		return nil, errors.New("token is empty")
 	}
@@ -131,7 +184,7 @@ func (ts *TokenService) RefreshAccessToken(refreshTokenString string) (string, e
 	}
 
 	// Generate new access token with same user info
-	newAccessToken, err := ts.generateToken(claims.UserID, claims.Email, claims.Role, ts.accessDuration)
+	newAccessToken, err := ts.generateToken(claims.UserID, claims.Email, claims.Role, "", ts.accessDuration)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate new access token: %w", err)
 	}
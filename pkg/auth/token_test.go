@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+// TestChallengeTokenIsSinglePurpose tests that an MFA challenge cannot be
+// used as a session token and a session token cannot complete a challenge
+func TestChallengeTokenIsSinglePurpose(t *testing.T) {
+	ts := NewTokenService("test-secret", 1, 24)
+
+	challenge, err := ts.GenerateChallengeToken("user-1", "teacher@example.com", "teacher", PurposeMFA)
+	if err != nil {
+		t.Fatalf("Failed to generate challenge: %v", err)
+	}
+	if _, err := ts.ValidateToken(challenge); err == nil {
+		t.Error("Challenge token accepted as a session token")
+	}
+	if _, err := ts.RefreshAccessToken(challenge); err == nil {
+		t.Error("Challenge token accepted as a refresh token")
+	}
+	if _, err := ts.ValidateChallengeToken(challenge, PurposeMFAEnroll); err == nil {
+		t.Error("MFA challenge accepted for enrollment")
+	}
+	claims, err := ts.ValidateChallengeToken(challenge, PurposeMFA, PurposeMFAEnroll)
+	if err != nil {
+		t.Fatalf("Challenge rejected: %v", err)
+	}
+	if claims.UserID != "user-1" || claims.Purpose != PurposeMFA {
+		t.Errorf("Unexpected claims: %+v", claims)
+	}
+	if remaining := time.Until(claims.ExpiresAt.Time); remaining > MFAChallengeDuration {
+		t.Errorf("Challenge lives %v, longer than %v", remaining, MFAChallengeDuration)
+	}
+
+	pair, err := ts.GenerateTokenPair("user-1", "teacher@example.com", "teacher")
+	if err != nil {
+		t.Fatalf("Failed to generate token pair: %v", err)
+	}
+	if _, err := ts.ValidateChallengeToken(pair.AccessToken, PurposeMFA); err == nil {
+		t.Error("Session token accepted as a challenge")
+	}
+	if _, err := ts.ValidateToken(pair.AccessToken); err != nil {
+		t.Errorf("Session token rejected: %v", err)
+	}
+
+	t.Log("✓ Challenge and session tokens are not interchangeable")
+}
+
+// TestMatchStep tests that a code maps to the time step it was generated for
+func TestMatchStep(t *testing.T) {
+	s := NewTOTPService("VTP Test")
+	secret, _, err := s.GenerateSecret("user@example.com")
+	if err != nil {
+		t.Fatalf("Failed to generate secret: %v", err)
+	}
+
+	now := time.Unix(1_700_000_015, 0)
+	current := now.Truncate(totpPeriod)
+	previous := current.Add(-totpPeriod)
+
+	code, err := totp.GenerateCode(secret, previous)
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+
+	step, ok := s.MatchStep(secret, code, now, 1, 1)
+	if !ok {
+		t.Fatal("Code from the previous step rejected")
+	}
+	if !step.Equal(previous) {
+		t.Errorf("Expected step %v, got %v", previous, step)
+	}
+	if _, ok := s.MatchStep(secret, code, now, 0, 1); ok {
+		t.Error("Code from the previous step accepted without a window")
+	}
+	if _, ok := s.MatchStep(secret, code, now.Add(5*totpPeriod), 1, 1); ok {
+		t.Error("Stale code accepted")
+	}
+
+	t.Log("✓ TOTP codes matched to their time step")
+}
@@ -44,30 +44,39 @@ func (s *TOTPService) ValidateCode(secret, code string) bool {
 	return totp.Validate(code, secret)
 }
 
+// totpPeriod is the TOTP time step
+const totpPeriod = 30 * time.Second
+
 // ValidateCodeWithWindow validates with a time window for clock skew
 func (s *TOTPService) ValidateCodeWithWindow(secret, code string, windowBefore, windowAfter int) bool {
-	// Check current time
-	if totp.Validate(code, secret) {
-		return true
-	}
+	_, ok := s.MatchStep(secret, code, time.Now(), windowBefore, windowAfter)
+	return ok
+}
 
-	// Check previous periods
+// MatchStep finds the time step a code belongs to within the skew window
+// around now and returns the start of that step. Callers use the step to
+// refuse a code that has already been accepted.
+func (s *TOTPService) MatchStep(secret, code string, now time.Time, windowBefore, windowAfter int) (time.Time, bool) {
+	current := now.Truncate(totpPeriod)
+
+	// Check current time, then previous and future periods
+	if validateAtTime(secret, code, current) {
+		return current, true
+	}
 	for i := 1; i <= windowBefore; i++ {
-		pastTime := time.Now().Add(-time.Duration(i*30) * time.Second)
-		if validateAtTime(secret, code, pastTime) {
-			return true
+		step := current.Add(-time.Duration(i) * totpPeriod)
+		if validateAtTime(secret, code, step) {
+			return step, true
 		}
 	}
-
-	// Check future periods
 	for i := 1; i <= windowAfter; i++ {
-		futureTime := time.Now().Add(time.Duration(i*30) * time.Second)
-		if validateAtTime(secret, code, futureTime) {
-			return true
+		step := current.Add(time.Duration(i) * totpPeriod)
+		if validateAtTime(secret, code, step) {
+			return step, true
 		}
 	}
 
-	return false
+	return time.Time{}, false
 }
 
 // validateAtTime validates code at a specific time
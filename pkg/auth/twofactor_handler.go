@@ -2,12 +2,16 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+
+	"github.com/Bashar444/VTP/pkg/router"
 )
 
 // TwoFactorHandler handles 2FA HTTP requests
 type TwoFactorHandler struct {
 	service *TwoFactorService
+	guard   *LoginGuard
 }
 
 // NewTwoFactorHandler creates a new 2FA handler
@@ -15,44 +19,57 @@ func NewTwoFactorHandler(service *TwoFactorService) *TwoFactorHandler {
 	return &TwoFactorHandler{service: service}
 }
 
-// Setup2FARequest is the request body for setting up 2FA
-type Setup2FARequest struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
+// WithGuard throttles code verification and locks accounts after repeated
+// failures
+func (h *TwoFactorHandler) WithGuard(guard *LoginGuard) *TwoFactorHandler {
+	h.guard = guard
+	return h
 }
 
 // Enable2FARequest is the request body for enabling 2FA
 type Enable2FARequest struct {
-	UserID string `json:"user_id"`
-	Code   string `json:"code"`
+	Code string `json:"code"`
 }
 
 // Verify2FARequest is the request body for verifying 2FA
 type Verify2FARequest struct {
-	UserID string `json:"user_id"`
-	Code   string `json:"code"`
+	Code string `json:"code"`
 }
 
 // Disable2FARequest is the request body for disabling 2FA
 type Disable2FARequest struct {
-	UserID   string `json:"user_id"`
 	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// TwoFactorPolicy lists the roles that must use 2FA to sign in
+type TwoFactorPolicy struct {
+	RequiredRoles []string `json:"required_roles"`
+}
+
+// RegisterRoutes registers the 2FA routes. They act on the signed-in user
+// and the 2FA policy is managed by admins. Signing in with 2FA goes through
+// /api/v1/auth/login/2fa.
+func (h *TwoFactorHandler) RegisterRoutes(rt *router.Router, am *AuthMiddleware) {
+	api := rt.With(am.Middleware)
+	api.HandleFunc("POST /api/v1/auth/2fa/verify", h.Verify2FA)
+	api.HandleFunc("POST /api/v1/auth/2fa/setup", h.Setup2FA)
+	api.HandleFunc("POST /api/v1/auth/2fa/enable", h.Enable2FA)
+	api.HandleFunc("POST /api/v1/auth/2fa/disable", h.Disable2FA)
+	api.HandleFunc("GET /api/v1/auth/2fa/backup-codes", h.GetBackupCodes)
+	api.HandleFunc("POST /api/v1/auth/2fa/backup-codes/regenerate", h.RegenerateBackupCodes)
+
+	admin := rt.With(am.Middleware, am.RoleMiddleware("admin"))
+	admin.HandleFunc("GET /api/v1/admin/security/2fa-policy", h.GetPolicy)
+	admin.HandleFunc("PUT /api/v1/admin/security/2fa-policy", h.UpdatePolicy)
 }
 
 // Setup2FA handles POST /api/v1/auth/2fa/setup
 func (h *TwoFactorHandler) Setup2FA(w http.ResponseWriter, r *http.Request) {
-	var req Setup2FARequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request body")
-		return
-	}
+	userID, _ := GetUserID(r)
+	email, _ := GetUserEmail(r)
 
-	if req.UserID == "" || req.Email == "" {
-		respondError(w, http.StatusBadRequest, "user_id and email are required")
-		return
-	}
-
-	resp, err := h.service.Setup2FA(r.Context(), req.UserID, req.Email)
+	resp, err := h.service.Setup2FA(r.Context(), userID, email)
 	if err != nil {
 		if err == ErrTOTPAlreadyEnabled {
 			respondError(w, http.StatusConflict, "2FA is already enabled")
@@ -73,12 +90,13 @@ func (h *TwoFactorHandler) Enable2FA(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.UserID == "" || req.Code == "" {
-		respondError(w, http.StatusBadRequest, "user_id and code are required")
+	if req.Code == "" {
+		respondError(w, http.StatusBadRequest, "code is required")
 		return
 	}
 
-	err := h.service.Enable2FA(r.Context(), req.UserID, req.Code)
+	userID, _ := GetUserID(r)
+	err := h.service.Enable2FA(r.Context(), userID, req.Code)
 	if err != nil {
 		if err == ErrInvalidTOTPCode {
 			respondError(w, http.StatusUnauthorized, "Invalid verification code")
@@ -103,29 +121,30 @@ func (h *TwoFactorHandler) Verify2FA(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.UserID == "" || req.Code == "" {
-		respondError(w, http.StatusBadRequest, "user_id and code are required")
+	if req.Code == "" {
+		respondError(w, http.StatusBadRequest, "code is required")
 		return
 	}
 
-	err := h.service.Verify2FA(r.Context(), req.UserID, req.Code)
+	userID, _ := GetUserID(r)
+	if err := h.guard.Check(r, Scope2FA, userID); err != nil {
+		writeThrottleError(w, err)
+		return
+	}
+
+	err := h.service.Verify2FA(r.Context(), userID, req.Code)
 	if err != nil {
-		if err == ErrInvalidTOTPCode {
-			respondError(w, http.StatusUnauthorized, "Invalid verification code")
-			return
+		if !h.codeError(w, r, userID, err) {
+			respondError(w, http.StatusInternalServerError, "Failed to verify 2FA")
 		}
-		if err == ErrTOTPNotEnabled {
-			respondError(w, http.StatusBadRequest, "2FA is not enabled for this user")
-			return
-		}
-		respondError(w, http.StatusInternalServerError, "Failed to verify 2FA")
 		return
 	}
 
 	respondJSON(w, http.StatusOK, map[string]bool{"verified": true})
 }
 
-// Disable2FA handles POST /api/v1/auth/2fa/disable
+// Disable2FA handles POST /api/v1/auth/2fa/disable. The user confirms with
+// their current password and a TOTP or backup code.
 func (h *TwoFactorHandler) Disable2FA(w http.ResponseWriter, r *http.Request) {
 	var req Disable2FARequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -133,65 +152,120 @@ func (h *TwoFactorHandler) Disable2FA(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.UserID == "" || req.Password == "" {
-		respondError(w, http.StatusBadRequest, "user_id and password are required")
+	if req.Password == "" || req.Code == "" {
+		respondError(w, http.StatusBadRequest, "password and code are required")
 		return
 	}
 
-	err := h.service.Disable2FA(r.Context(), req.UserID, req.Password)
+	userID, _ := GetUserID(r)
+	if err := h.guard.Check(r, Scope2FA, userID); err != nil {
+		writeThrottleError(w, err)
+		return
+	}
+
+	err := h.service.Disable2FA(r.Context(), userID, req.Password, req.Code)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to disable 2FA")
+		if err == ErrInvalidPassword {
+			h.guard.Failure(r, Scope2FA, userID)
+			respondError(w, http.StatusUnauthorized, "Invalid password")
+			return
+		}
+		if !h.codeError(w, r, userID, err) {
+			respondError(w, http.StatusInternalServerError, "Failed to disable 2FA")
+		}
 		return
 	}
 
 	respondJSON(w, http.StatusOK, map[string]string{"message": "2FA disabled successfully"})
 }
 
-// GetBackupCodes handles GET /api/v1/auth/2fa/backup-codes
+// codeError responds to a rejected verification code, counting a wrong
+// code as a failed attempt. It reports whether err was such a rejection.
+func (h *TwoFactorHandler) codeError(w http.ResponseWriter, r *http.Request, userID string, err error) bool {
+	switch err {
+	case ErrInvalidTOTPCode:
+		h.guard.Failure(r, Scope2FA, userID)
+		respondError(w, http.StatusUnauthorized, "Invalid verification code")
+	case ErrTOTPCodeReused:
+		h.guard.Failure(r, Scope2FA, userID)
+		respondError(w, http.StatusUnauthorized, "Verification code has already been used")
+	case ErrTOTPNotEnabled:
+		respondError(w, http.StatusBadRequest, "2FA is not enabled for this user")
+	default:
+		return false
+	}
+	return true
+}
+
+// GetBackupCodes handles GET /api/v1/auth/2fa/backup-codes. Backup codes
+// are stored hashed, so only the number left is returned; regenerate them
+// to see new ones.
 func (h *TwoFactorHandler) GetBackupCodes(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		respondError(w, http.StatusBadRequest, "user_id is required")
+	userID, _ := GetUserID(r)
+	remaining, err := h.service.BackupCodesRemaining(r.Context(), userID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get backup codes")
 		return
 	}
 
-	codes, err := h.service.GetBackupCodes(r.Context(), userID)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"count": remaining,
+	})
+}
+
+// RegenerateBackupCodes handles POST /api/v1/auth/2fa/backup-codes/regenerate.
+// The new codes are returned once and replace the old ones.
+func (h *TwoFactorHandler) RegenerateBackupCodes(w http.ResponseWriter, r *http.Request) {
+	userID, _ := GetUserID(r)
+	codes, err := h.service.RegenerateBackupCodes(r.Context(), userID)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to get backup codes")
+		respondError(w, http.StatusInternalServerError, "Failed to regenerate backup codes")
 		return
 	}
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
 		"backup_codes": codes,
-		"count":        len(codes),
+		"message":      "Backup codes regenerated successfully",
 	})
 }
 
-// RegenerateBackupCodes handles POST /api/v1/auth/2fa/backup-codes/regenerate
-func (h *TwoFactorHandler) RegenerateBackupCodes(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		UserID string `json:"user_id"`
+// GetPolicy handles GET /api/v1/admin/security/2fa-policy
+func (h *TwoFactorHandler) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.service.RequiredRoles(r.Context())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get 2FA policy")
+		return
 	}
+
+	respondJSON(w, http.StatusOK, TwoFactorPolicy{RequiredRoles: roles})
+}
+
+// UpdatePolicy handles PUT /api/v1/admin/security/2fa-policy. Users of a
+// required role who have not enrolled are asked to enroll at their next
+// login.
+func (h *TwoFactorHandler) UpdatePolicy(w http.ResponseWriter, r *http.Request) {
+	var req TwoFactorPolicy
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	if req.UserID == "" {
-		respondError(w, http.StatusBadRequest, "user_id is required")
+	adminID, _ := r.Context().Value("user_id").(string)
+	if err := h.service.SetRequiredRoles(r.Context(), req.RequiredRoles, adminID); err != nil {
+		if errors.Is(err, ErrInvalidPolicyRole) {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to update 2FA policy")
 		return
 	}
 
-	codes, err := h.service.RegenerateBackupCodes(r.Context(), req.UserID)
+	roles, err := h.service.RequiredRoles(r.Context())
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to regenerate backup codes")
+		respondError(w, http.StatusInternalServerError, "Failed to get 2FA policy")
 		return
 	}
-
-	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"backup_codes": codes,
-		"message":      "Backup codes regenerated successfully",
-	})
+	respondJSON(w, http.StatusOK, TwoFactorPolicy{RequiredRoles: roles})
 }
 
 // Helper functions
@@ -2,17 +2,25 @@ package auth
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
 	ErrTOTPNotEnabled     = errors.New("TOTP is not enabled for this user")
 	ErrInvalidTOTPCode    = errors.New("invalid TOTP code")
 	ErrTOTPAlreadyEnabled = errors.New("TOTP is already enabled")
+	ErrTOTPCodeReused     = errors.New("TOTP code has already been used")
+	ErrInvalidPolicyRole  = errors.New("2FA can only be required for teacher and admin roles")
+	ErrInvalidPassword    = errors.New("invalid password")
 )
 
 // TwoFactorService handles 2FA operations
@@ -67,7 +75,7 @@ func (s *TwoFactorService) Setup2FA(ctx context.Context, userID, email string) (
 	}
 
 	// Store secret and backup codes (not yet enabled)
-	backupCodesJSON, _ := json.Marshal(backupCodes)
+	backupCodesJSON, _ := json.Marshal(hashBackupCodes(backupCodes))
 	_, err = s.db.ExecContext(ctx,
 		`UPDATE users SET totp_secret = $1, backup_codes = $2, updated_at = $3 WHERE id = $4`,
 		secret, backupCodesJSON, time.Now(), userID,
@@ -105,15 +113,17 @@ func (s *TwoFactorService) Enable2FA(ctx context.Context, userID, code string) e
 	}
 
 	// Validate the code
-	if !s.totpService.ValidateCodeWithWindow(secret, code, 1, 1) {
+	now := time.Now()
+	step, ok := s.totpService.MatchStep(secret, code, now, 1, 1)
+	if !ok {
 		return ErrInvalidTOTPCode
 	}
 
-	// Enable 2FA
-	now := time.Now()
+	// Enable 2FA. The step is recorded so the enrollment code cannot be
+	// used again to sign in.
 	_, err = s.db.ExecContext(ctx,
 		`UPDATE users SET totp_enabled = $1, totp_verified_at = $2, last_totp_verified = $3, updated_at = $4 WHERE id = $5`,
-		true, now, now, now, userID,
+		true, now, step, now, userID,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to enable 2FA: %w", err)
@@ -122,17 +132,18 @@ func (s *TwoFactorService) Enable2FA(ctx context.Context, userID, code string) e
 	return nil
 }
 
-// Verify2FA verifies a TOTP code for an enabled user
+// Verify2FA verifies a TOTP code or a backup code for an enabled user. A
+// TOTP code is accepted once: codes from a time step at or before the last
+// accepted one are refused. A backup code is consumed.
 func (s *TwoFactorService) Verify2FA(ctx context.Context, userID, code string) error {
 	// Get user's TOTP secret and status
 	var secret string
 	var totpEnabled bool
-	var backupCodesJSON []byte
 
 	err := s.db.QueryRowContext(ctx,
-		"SELECT totp_secret, totp_enabled, backup_codes FROM users WHERE id = $1",
+		"SELECT COALESCE(totp_secret, ''), COALESCE(totp_enabled, FALSE) FROM users WHERE id = $1",
 		userID,
-	).Scan(&secret, &totpEnabled, &backupCodesJSON)
+	).Scan(&secret, &totpEnabled)
 	if err != nil {
 		return fmt.Errorf("failed to get user: %w", err)
 	}
@@ -142,41 +153,67 @@ func (s *TwoFactorService) Verify2FA(ctx context.Context, userID, code string) e
 	}
 
 	// Try TOTP code first
-	if s.totpService.ValidateCodeWithWindow(secret, code, 1, 1) {
-		// Update last verified time
-		_, err = s.db.ExecContext(ctx,
-			"UPDATE users SET last_totp_verified = $1 WHERE id = $2",
-			time.Now(), userID,
+	if step, ok := s.totpService.MatchStep(secret, code, time.Now(), 1, 1); ok {
+		// Record the step only if it is newer than the last accepted one,
+		// so concurrent requests with the same code cannot both succeed
+		result, err := s.db.ExecContext(ctx,
+			`UPDATE users SET last_totp_verified = $1
+			 WHERE id = $2 AND (last_totp_verified IS NULL OR last_totp_verified < $1)`,
+			step, userID,
 		)
-		return err
+		if err != nil {
+			return fmt.Errorf("failed to record TOTP verification: %w", err)
+		}
+		if rows, err := result.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		} else if rows == 0 {
+			return ErrTOTPCodeReused
+		}
+		return nil
 	}
 
-	// Try backup codes
-	var backupCodes []string
-	if err := json.Unmarshal(backupCodesJSON, &backupCodes); err == nil {
-		for i, backupCode := range backupCodes {
-			if backupCode == code {
-				// Remove used backup code
-				backupCodes = append(backupCodes[:i], backupCodes[i+1:]...)
-				newBackupCodesJSON, _ := json.Marshal(backupCodes)
-				_, err = s.db.ExecContext(ctx,
-					"UPDATE users SET backup_codes = $1, last_totp_verified = $2 WHERE id = $3",
-					newBackupCodesJSON, time.Now(), userID,
-				)
-				return err
-			}
-		}
+	// Try backup codes, which are stored hashed. The code is removed in the
+	// same statement that checks it, so it can only be used once.
+	if strings.TrimSpace(code) == "" {
+		return ErrInvalidTOTPCode
+	}
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE users SET backup_codes = backup_codes - $1::text, updated_at = $2
+		 WHERE id = $3 AND backup_codes ? $1::text`,
+		hashBackupCode(code), time.Now(), userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to consume backup code: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	} else if rows == 1 {
+		return nil
 	}
 
 	return ErrInvalidTOTPCode
 }
 
-// Disable2FA disables 2FA for a user
-func (s *TwoFactorService) Disable2FA(ctx context.Context, userID, password string) error {
-	// Verify password before disabling (security measure)
-	// This would require password verification logic from auth service
+// Disable2FA disables 2FA for a user who confirms it with their current
+// password and a TOTP or backup code
+func (s *TwoFactorService) Disable2FA(ctx context.Context, userID, password, code string) error {
+	var passwordHash string
+	err := s.db.QueryRowContext(ctx,
+		"SELECT password_hash FROM users WHERE id = $1",
+		userID,
+	).Scan(&passwordHash)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)) != nil {
+		return ErrInvalidPassword
+	}
+
+	if err := s.Verify2FA(ctx, userID, code); err != nil {
+		return err
+	}
 
-	_, err := s.db.ExecContext(ctx,
+	_, err = s.db.ExecContext(ctx,
 		`UPDATE users SET totp_enabled = $1, totp_secret = $2, totp_verified_at = $3, backup_codes = $4, updated_at = $5 WHERE id = $6`,
 		false, "", nil, "[]", time.Now(), userID,
 	)
@@ -187,23 +224,18 @@ func (s *TwoFactorService) Disable2FA(ctx context.Context, userID, password stri
 	return nil
 }
 
-// GetBackupCodes retrieves remaining backup codes
-func (s *TwoFactorService) GetBackupCodes(ctx context.Context, userID string) ([]string, error) {
-	var backupCodesJSON []byte
+// BackupCodesRemaining returns how many unused backup codes a user has.
+// The codes themselves are only shown when generated.
+func (s *TwoFactorService) BackupCodesRemaining(ctx context.Context, userID string) (int, error) {
+	var remaining int
 	err := s.db.QueryRowContext(ctx,
-		"SELECT backup_codes FROM users WHERE id = $1",
+		"SELECT COALESCE(jsonb_array_length(backup_codes), 0) FROM users WHERE id = $1",
 		userID,
-	).Scan(&backupCodesJSON)
+	).Scan(&remaining)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get backup codes: %w", err)
-	}
-
-	var backupCodes []string
-	if err := json.Unmarshal(backupCodesJSON, &backupCodes); err != nil {
-		return nil, err
+		return 0, fmt.Errorf("failed to get backup codes: %w", err)
 	}
-
-	return backupCodes, nil
+	return remaining, nil
 }
 
 // RegenerateBackupCodes creates new backup codes
@@ -213,7 +245,7 @@ func (s *TwoFactorService) RegenerateBackupCodes(ctx context.Context, userID str
 		return nil, err
 	}
 
-	backupCodesJSON, _ := json.Marshal(backupCodes)
+	backupCodesJSON, _ := json.Marshal(hashBackupCodes(backupCodes))
 	_, err = s.db.ExecContext(ctx,
 		"UPDATE users SET backup_codes = $1, updated_at = $2 WHERE id = $3",
 		backupCodesJSON, time.Now(), userID,
@@ -224,3 +256,86 @@ func (s *TwoFactorService) RegenerateBackupCodes(ctx context.Context, userID str
 
 	return backupCodes, nil
 }
+
+// hashBackupCode returns the stored form of a backup code: the hex SHA-256
+// of the code, upper-cased. Codes are random, so an unsalted hash suffices.
+func hashBackupCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.ToUpper(strings.TrimSpace(code))))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashBackupCodes hashes backup codes for storage
+func hashBackupCodes(codes []string) []string {
+	hashed := make([]string, len(codes))
+	for i, code := range codes {
+		hashed[i] = hashBackupCode(code)
+	}
+	return hashed
+}
+
+// requiredRolesSetting is the auth_settings key holding the roles that must
+// use 2FA
+const requiredRolesSetting = "two_factor_required_roles"
+
+// RequiredRoles returns the roles that must use 2FA to sign in
+func (s *TwoFactorService) RequiredRoles(ctx context.Context) ([]string, error) {
+	var rolesJSON []byte
+	err := s.db.QueryRowContext(ctx,
+		"SELECT value FROM auth_settings WHERE key = $1",
+		requiredRolesSetting,
+	).Scan(&rolesJSON)
+	if err == sql.ErrNoRows {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get 2FA policy: %w", err)
+	}
+
+	var roles []string
+	if err := json.Unmarshal(rolesJSON, &roles); err != nil {
+		return nil, fmt.Errorf("failed to decode 2FA policy: %w", err)
+	}
+	return roles, nil
+}
+
+// SetRequiredRoles sets the roles that must use 2FA to sign in. Only the
+// teacher and admin roles can be required.
+func (s *TwoFactorService) SetRequiredRoles(ctx context.Context, roles []string, updatedBy string) error {
+	seen := make(map[string]bool)
+	cleaned := make([]string, 0, len(roles))
+	for _, role := range roles {
+		if role != "teacher" && role != "admin" {
+			return fmt.Errorf("%w: got %q", ErrInvalidPolicyRole, role)
+		}
+		if !seen[role] {
+			seen[role] = true
+			cleaned = append(cleaned, role)
+		}
+	}
+
+	rolesJSON, _ := json.Marshal(cleaned)
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO auth_settings (key, value, updated_by, updated_at)
+		 VALUES ($1, $2, NULLIF($3, '')::uuid, $4)
+		 ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at`,
+		requiredRolesSetting, rolesJSON, updatedBy, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update 2FA policy: %w", err)
+	}
+	return nil
+}
+
+// IsRequired reports whether users with the role must use 2FA
+func (s *TwoFactorService) IsRequired(ctx context.Context, role string) (bool, error) {
+	roles, err := s.RequiredRoles(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range roles {
+		if r == role {
+			return true, nil
+		}
+	}
+	return false, nil
+}
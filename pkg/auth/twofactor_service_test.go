@@ -0,0 +1,23 @@
+package auth
+
+import "testing"
+
+// TestHashBackupCode tests that backup codes are stored as 64-character
+// digests that match however the user types the code
+func TestHashBackupCode(t *testing.T) {
+	hashed := hashBackupCode("ABCD2345")
+	if len(hashed) != 64 || hashed == "ABCD2345" {
+		t.Fatalf("Unexpected digest %q", hashed)
+	}
+	if hashBackupCode(" abcd2345\n") != hashed {
+		t.Error("Expected case and surrounding spaces ignored")
+	}
+	if hashBackupCode("ABCD2346") == hashed {
+		t.Error("Expected different codes to differ")
+	}
+
+	codes := hashBackupCodes([]string{"ABCD2345", "WXYZ6789"})
+	if len(codes) != 2 || codes[0] != hashed {
+		t.Errorf("Unexpected hashed codes %v", codes)
+	}
+}
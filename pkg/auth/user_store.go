@@ -21,6 +21,11 @@ type User struct {
 	Locale       string    `db:"locale" json:"locale"`
 	CreatedAt    time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+
+	// TOTPEnabled is set once the user has confirmed a TOTP secret
+	TOTPEnabled bool `db:"totp_enabled" json:"totp_enabled"`
+	// LastTOTPVerified is the start of the last accepted TOTP time step
+	LastTOTPVerified *time.Time `db:"last_totp_verified" json:"-"`
 }
 
 // UserStore handles database operations for users
@@ -109,12 +114,14 @@ func (us *UserStore) GetUserByEmail(ctx context.Context, email string) (*User, e
 	}
 
 	query := `
-		SELECT id, email, phone, full_name, role, password_hash, locale, created_at, updated_at
+		SELECT id, email, phone, full_name, role, password_hash, locale, created_at, updated_at,
+		       COALESCE(totp_enabled, FALSE), last_totp_verified
 		FROM users
 		WHERE email = $1
 	`
 
 	user := &User{}
+	var lastTOTPVerified sql.NullTime
 	err := us.db.QueryRowContext(ctx, query, email).Scan(
 		&user.ID,
 		&user.Email,
@@ -125,6 +132,8 @@ func (us *UserStore) GetUserByEmail(ctx context.Context, email string) (*User, e
 		&user.Locale,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.TOTPEnabled,
+		&lastTOTPVerified,
 	)
 
 	if err != nil {
@@ -134,6 +143,10 @@ func (us *UserStore) GetUserByEmail(ctx context.Context, email string) (*User, e
 		return nil, fmt.Errorf("failed to get user by email: %w", err)
 	}
 
+	if lastTOTPVerified.Valid {
+		user.LastTOTPVerified = &lastTOTPVerified.Time
+	}
+
 	return user, nil
 }
 
@@ -144,12 +157,14 @@ func (us *UserStore) GetUserByID(ctx context.Context, userID string) (*User, err
 	}
 
 	query := `
-		SELECT id, email, phone, full_name, role, password_hash, locale, created_at, updated_at
+		SELECT id, email, phone, full_name, role, password_hash, locale, created_at, updated_at,
+		       COALESCE(totp_enabled, FALSE), last_totp_verified
 		FROM users
 		WHERE id = $1
 	`
 
 	user := &User{}
+	var lastTOTPVerified sql.NullTime
 	err := us.db.QueryRowContext(ctx, query, userID).Scan(
 		&user.ID,
 		&user.Email,
@@ -160,6 +175,8 @@ func (us *UserStore) GetUserByID(ctx context.Context, userID string) (*User, err
 		&user.Locale,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.TOTPEnabled,
+		&lastTOTPVerified,
 	)
 
 	if err != nil {
@@ -169,6 +186,10 @@ func (us *UserStore) GetUserByID(ctx context.Context, userID string) (*User, err
 		return nil, fmt.Errorf("failed to get user by ID: %w", err)
 	}
 
+	if lastTOTPVerified.Valid {
+		user.LastTOTPVerified = &lastTOTPVerified.Time
+	}
+
 	return user, nil
 }
 
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryRateLimiter counts events in sliding windows in process memory. It
+// stands in for RateLimiter when Redis is not configured; counts are not
+// shared between instances and are lost on restart.
+type MemoryRateLimiter struct {
+	mu     sync.Mutex
+	events map[string][]time.Time
+	hits   int
+	// longest window seen, so sweeps never drop events another key's
+	// window still counts
+	maxWindow time.Duration
+}
+
+// NewMemoryRateLimiter creates an in-memory rate limiter
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{events: make(map[string][]time.Time)}
+}
+
+// memorySweepInterval is how many hits pass between sweeps of idle keys
+const memorySweepInterval = 1024
+
+// Hit records an event for key and returns the number of events in the
+// sliding window ending now
+func (m *MemoryRateLimiter) Hit(ctx context.Context, key string, window time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	events := append(prune(m.events[key], now.Add(-window)), now)
+	m.events[key] = events
+
+	if window > m.maxWindow {
+		m.maxWindow = window
+	}
+	m.hits++
+	if m.hits%memorySweepInterval == 0 {
+		m.sweep(now.Add(-m.maxWindow))
+	}
+	return int64(len(events)), nil
+}
+
+// Count returns the number of events for key in the sliding window ending
+// now without recording one
+func (m *MemoryRateLimiter) Count(ctx context.Context, key string, window time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := prune(m.events[key], time.Now().Add(-window))
+	if len(events) == 0 {
+		delete(m.events, key)
+		return 0, nil
+	}
+	m.events[key] = events
+	return int64(len(events)), nil
+}
+
+// Reset forgets the events recorded for the keys
+func (m *MemoryRateLimiter) Reset(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		delete(m.events, key)
+	}
+	return nil
+}
+
+// sweep drops keys whose events are all older than cutoff
+func (m *MemoryRateLimiter) sweep(cutoff time.Time) {
+	for key, events := range m.events {
+		if len(events) == 0 || !events[len(events)-1].After(cutoff) {
+			delete(m.events, key)
+		}
+	}
+}
+
+// prune drops events at or before cutoff. Events are in time order.
+func prune(events []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(events) && !events[i].After(cutoff) {
+		i++
+	}
+	return events[i:]
+}
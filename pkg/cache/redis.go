@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -33,6 +34,16 @@ func NewRedisCache(addr, password string, db int) (*RedisCache, error) {
 	return &RedisCache{client: client}, nil
 }
 
+// NewRedisCacheFromURL creates a Redis cache client from a redis:// URL such
+// as REDIS_URL
+func NewRedisCacheFromURL(url string) (*RedisCache, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	return NewRedisCache(opts.Addr, opts.Password, opts.DB)
+}
+
 // Get retrieves a value from cache
 func (c *RedisCache) Get(ctx context.Context, key string) (string, error) {
 	val, err := c.client.Get(ctx, key).Result()
@@ -84,6 +95,40 @@ func (c *RedisCache) Expire(ctx context.Context, key string, expiration time.Dur
 	return c.client.Expire(ctx, key, expiration).Err()
 }
 
+// ErrUpdateConflict is returned by Update when other clients keep changing
+// the key
+var ErrUpdateConflict = errors.New("key changed by other clients, try again")
+
+// maxUpdateAttempts is how many times Update reads a key changed meanwhile
+const maxUpdateAttempts = 10
+
+// Update changes a value atomically. update receives the current value, ""
+// for a missing key, and returns the new one; it runs again if another
+// client changes the key before the new value is stored.
+func (c *RedisCache) Update(ctx context.Context, key string, expiration time.Duration, update func(current string) (string, error)) error {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		err := c.client.Watch(ctx, func(tx *redis.Tx) error {
+			current, err := tx.Get(ctx, key).Result()
+			if err != nil && err != redis.Nil {
+				return err
+			}
+			value, err := update(current)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, key, value, expiration)
+				return nil
+			})
+			return err
+		}, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return ErrUpdateConflict
+}
+
 // IncrBy increments a counter
 func (c *RedisCache) IncrBy(ctx context.Context, key string, value int64) (int64, error) {
 	return c.client.IncrBy(ctx, key, value).Result()
@@ -94,6 +139,54 @@ func (c *RedisCache) GetTTL(ctx context.Context, key string) (time.Duration, err
 	return c.client.TTL(ctx, key).Result()
 }
 
+// HSet sets a field of a hash
+func (c *RedisCache) HSet(ctx context.Context, key, field string, value interface{}) error {
+	return c.client.HSet(ctx, key, field, value).Err()
+}
+
+// HDel removes fields from a hash
+func (c *RedisCache) HDel(ctx context.Context, key string, fields ...string) error {
+	return c.client.HDel(ctx, key, fields...).Err()
+}
+
+// HGetAll returns every field of a hash; a missing key is an empty hash
+func (c *RedisCache) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return c.client.HGetAll(ctx, key).Result()
+}
+
+// Publish sends a message to the subscribers of a channel
+func (c *RedisCache) Publish(ctx context.Context, channel string, message interface{}) error {
+	return c.client.Publish(ctx, channel, message).Err()
+}
+
+// Subscribe calls handler with each message published to a channel until
+// ctx is done. It returns once the subscription is confirmed, so messages
+// published after it returns are received.
+func (c *RedisCache) Subscribe(ctx context.Context, channel string, handler func(payload string)) error {
+	pubsub := c.client.Subscribe(ctx, channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return err
+	}
+
+	go func() {
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				handler(msg.Payload)
+			}
+		}
+	}()
+	return nil
+}
+
 // FlushDB clears all keys (use with caution!)
 func (c *RedisCache) FlushDB(ctx context.Context) error {
 	return c.client.FlushDB(ctx).Err()
@@ -144,6 +237,16 @@ func (CacheKey) RecordingList(filters string) string {
 	return fmt.Sprintf("recordings:list:%s", filters)
 }
 
+// SignallingRoom is the hash of a signalling room's members across nodes
+func (CacheKey) SignallingRoom(roomID string) string {
+	return fmt.Sprintf("signalling:room:%s", roomID)
+}
+
+// SignallingRoomState is the state of a signalling room shared by nodes
+func (CacheKey) SignallingRoomState(roomID string) string {
+	return fmt.Sprintf("signalling:room-state:%s", roomID)
+}
+
 // Stats cache keys
 func (CacheKey) Stats(entity, id string) string {
 	return fmt.Sprintf("stats:%s:%s", entity, id)
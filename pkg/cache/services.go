@@ -4,7 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math/rand"
+	"strconv"
 	"time"
+
+	"github.com/redis/go-redis/v9"
 )
 
 // CachedCourseService wraps course service with caching
@@ -184,6 +188,43 @@ func (r *RateLimiter) GetRemainingRequests(ctx context.Context, key string, maxR
 	return remaining, nil
 }
 
+// Hit records an event for key and returns the number of events in the
+// sliding window ending now
+func (r *RateLimiter) Hit(ctx context.Context, key string, window time.Duration) (int64, error) {
+	windowKey := fmt.Sprintf("ratelimit:sw:%s", key)
+	now := time.Now()
+
+	pipe := r.cache.client.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, windowKey, "-inf", strconv.FormatInt(now.Add(-window).UnixMicro(), 10))
+	pipe.ZAdd(ctx, windowKey, redis.Z{
+		Score:  float64(now.UnixMicro()),
+		Member: fmt.Sprintf("%d-%d", now.UnixNano(), rand.Int63()),
+	})
+	count := pipe.ZCard(ctx, windowKey)
+	pipe.PExpire(ctx, windowKey, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return count.Val(), nil
+}
+
+// Count returns the number of events for key in the sliding window ending
+// now without recording one
+func (r *RateLimiter) Count(ctx context.Context, key string, window time.Duration) (int64, error) {
+	windowKey := fmt.Sprintf("ratelimit:sw:%s", key)
+	min := strconv.FormatInt(time.Now().Add(-window).UnixMicro(), 10)
+	return r.cache.client.ZCount(ctx, windowKey, "("+min, "+inf").Result()
+}
+
+// Reset forgets the events recorded for the keys
+func (r *RateLimiter) Reset(ctx context.Context, keys ...string) error {
+	windowKeys := make([]string, len(keys))
+	for i, key := range keys {
+		windowKeys[i] = fmt.Sprintf("ratelimit:sw:%s", key)
+	}
+	return r.cache.Delete(ctx, windowKeys...)
+}
+
 // GetJSON is a helper for cache-aside pattern
 func GetJSON[T any](ctx context.Context, cache *RedisCache, key string, fetchFunc func(ctx context.Context) (*T, error), expiration time.Duration) (*T, error) {
 	// Try cache
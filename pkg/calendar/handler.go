@@ -0,0 +1,107 @@
+package calendar
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Bashar444/VTP/pkg/auth"
+	"github.com/Bashar444/VTP/pkg/router"
+	"github.com/Bashar444/VTP/pkg/utils"
+)
+
+// Handler handles HTTP requests for calendar feeds
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new calendar handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// RegisterRoutes registers calendar routes. Feeds are read by calendar
+// apps without a session, so the feed itself is authorized by its secret
+// token alone.
+func (h *Handler) RegisterRoutes(rt *router.Router, am *auth.AuthMiddleware) {
+	api := rt.With(am.Middleware)
+
+	api.HandleFunc("POST /api/v1/calendar/feed", h.CreateFeed)
+	api.HandleFunc("DELETE /api/v1/calendar/feed", h.DeleteFeed)
+	rt.HandleFunc("GET /api/v1/calendar/feed/{token}", h.GetFeed)
+}
+
+// FeedResponse is the subscription address of a calendar feed
+type FeedResponse struct {
+	URL       string `json:"url"`
+	WebcalURL string `json:"webcal_url"`
+}
+
+// CreateFeed handles POST /api/v1/calendar/feed. It issues a new feed
+// address for the caller, replacing any previous one.
+func (h *Handler) CreateFeed(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserID(r)
+	if err != nil {
+		utils.WriteErr(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	token, err := h.service.IssueFeedToken(r.Context(), userID)
+	if err != nil {
+		utils.WriteErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	scheme := "https"
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	} else if r.TLS == nil {
+		scheme = "http"
+	}
+	address := r.Host + "/api/v1/calendar/feed/" + token + ".ics"
+
+	utils.WriteJSON(w, http.StatusCreated, FeedResponse{
+		URL:       scheme + "://" + address,
+		WebcalURL: "webcal://" + address,
+	})
+}
+
+// DeleteFeed handles DELETE /api/v1/calendar/feed
+func (h *Handler) DeleteFeed(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserID(r)
+	if err != nil {
+		utils.WriteErr(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	if err := h.service.RevokeFeedToken(r.Context(), userID); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrFeedNotFound) {
+			status = http.StatusNotFound
+		}
+		utils.WriteErr(w, status, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetFeed handles GET /api/v1/calendar/feed/{token}
+func (h *Handler) GetFeed(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSuffix(utils.Param(r, "token"), ".ics")
+
+	cal, err := h.service.Feed(r.Context(), token)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrFeedNotFound) {
+			status = http.StatusNotFound
+		}
+		utils.WriteErr(w, status, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="vtp.ics"`)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	cal.WriteTo(w)
+}
@@ -0,0 +1,299 @@
+package calendar
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Event statuses
+const (
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+// iTIP methods of invitations
+const (
+	MethodRequest = "REQUEST"
+	MethodCancel  = "CANCEL"
+)
+
+const (
+	prodID      = "-//VTP//Virtual Teaching Platform//AR"
+	utcLayout   = "20060102T150405Z"
+	localLayout = "20060102T150405"
+	maxLine     = 75 // octets per content line before folding
+)
+
+// Person is the organizer of an event
+type Person struct {
+	Name  string
+	Email string
+}
+
+// Event is a VEVENT. Start, End and ExDates are written in UTC unless
+// TimeZone is set, which recurring events need to keep their local time.
+type Event struct {
+	UID         string // stable across updates
+	Sequence    int    // raised on every significant change
+	Start       time.Time
+	End         time.Time // zero for moments such as deadlines
+	TimeZone    string    // IANA zone to write times in
+	RRule       string
+	ExDates     []time.Time
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Status      string // StatusConfirmed or StatusCancelled
+	Organizer   *Person
+	Updated     time.Time
+}
+
+// Calendar is a VCALENDAR holding events
+type Calendar struct {
+	Name     string
+	TimeZone string // calendar's default zone, advertised to clients
+	Method   string // iTIP method for invitations, empty for feeds
+	Events   []Event
+}
+
+// Bytes returns the calendar as an iCalendar object
+func (c *Calendar) Bytes() []byte {
+	var buf bytes.Buffer
+	c.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+// WriteTo writes the calendar as an iCalendar object
+func (c *Calendar) WriteTo(w io.Writer) (int64, error) {
+	cw := &contentWriter{w: w}
+	stamp := time.Now().UTC()
+
+	cw.line("BEGIN:VCALENDAR")
+	cw.line("VERSION:2.0")
+	cw.line("PRODID:" + prodID)
+	cw.line("CALSCALE:GREGORIAN")
+	if c.Method != "" {
+		cw.line("METHOD:" + c.Method)
+	}
+	if c.Name != "" {
+		cw.line("X-WR-CALNAME:" + escapeText(c.Name))
+	}
+	if c.TimeZone != "" {
+		cw.line("X-WR-TIMEZONE:" + c.TimeZone)
+	}
+
+	for _, zone := range c.zones() {
+		writeTimeZone(cw, zone.name, zone.from, zone.to)
+	}
+	for i := range c.Events {
+		c.Events[i].write(cw, stamp)
+	}
+
+	cw.line("END:VCALENDAR")
+	return cw.n, cw.err
+}
+
+type zoneRange struct {
+	name     string
+	from, to time.Time
+}
+
+// zones returns the time zones events are written in with the range of
+// times their definitions must cover
+func (c *Calendar) zones() []zoneRange {
+	byName := make(map[string]*zoneRange)
+	for _, e := range c.Events {
+		if e.TimeZone == "" {
+			continue
+		}
+		to := e.Start.AddDate(1, 0, 0)
+		if e.End.After(to) {
+			to = e.End
+		}
+		zone, ok := byName[e.TimeZone]
+		if !ok {
+			byName[e.TimeZone] = &zoneRange{name: e.TimeZone, from: e.Start, to: to}
+			continue
+		}
+		if e.Start.Before(zone.from) {
+			zone.from = e.Start
+		}
+		if to.After(zone.to) {
+			zone.to = to
+		}
+	}
+
+	zones := make([]zoneRange, 0, len(byName))
+	for _, zone := range byName {
+		zones = append(zones, *zone)
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].name < zones[j].name })
+	return zones
+}
+
+func (e *Event) write(cw *contentWriter, stamp time.Time) {
+	loc := time.UTC
+	if e.TimeZone != "" {
+		if l, err := time.LoadLocation(e.TimeZone); err == nil {
+			loc = l
+		}
+	}
+
+	cw.line("BEGIN:VEVENT")
+	cw.line("UID:" + e.UID)
+	cw.line("DTSTAMP:" + stamp.Format(utcLayout))
+	cw.line(fmt.Sprintf("SEQUENCE:%d", e.Sequence))
+	cw.line(dateTime("DTSTART", e.Start, loc))
+	if !e.End.IsZero() {
+		cw.line(dateTime("DTEND", e.End, loc))
+	}
+	if e.RRule != "" {
+		cw.line("RRULE:" + strings.TrimPrefix(e.RRule, "RRULE:"))
+	}
+	for _, exdate := range e.ExDates {
+		cw.line(dateTime("EXDATE", exdate, loc))
+	}
+	cw.line("SUMMARY:" + escapeText(e.Summary))
+	if e.Description != "" {
+		cw.line("DESCRIPTION:" + escapeText(e.Description))
+	}
+	if e.Location != "" {
+		cw.line("LOCATION:" + escapeText(e.Location))
+	}
+	if e.URL != "" {
+		cw.line("URL:" + e.URL)
+	}
+	if e.Status != "" {
+		cw.line("STATUS:" + e.Status)
+	}
+	if e.Organizer != nil && e.Organizer.Email != "" {
+		cw.line("ORGANIZER" + nameParam(e.Organizer.Name) + ":mailto:" + e.Organizer.Email)
+	}
+	if !e.Updated.IsZero() {
+		cw.line("LAST-MODIFIED:" + e.Updated.UTC().Format(utcLayout))
+	}
+	cw.line("END:VEVENT")
+}
+
+// dateTime formats a date-time property in UTC, or in local time with a
+// TZID parameter
+func dateTime(name string, t time.Time, loc *time.Location) string {
+	if loc == time.UTC {
+		return name + ":" + t.UTC().Format(utcLayout)
+	}
+	return name + ";TZID=" + loc.String() + ":" + t.In(loc).Format(localLayout)
+}
+
+// writeTimeZone writes a VTIMEZONE with the offsets a zone uses between
+// from and to, taken from the system's time zone database
+func writeTimeZone(cw *contentWriter, name string, from, to time.Time) {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return
+	}
+
+	cw.line("BEGIN:VTIMEZONE")
+	cw.line("TZID:" + name)
+	for t := from.In(loc); ; {
+		abbrev, offset := t.Zone()
+		start, end := t.ZoneBounds()
+		kind := "STANDARD"
+		if t.IsDST() {
+			kind = "DAYLIGHT"
+		}
+
+		onset, previous := "19700101T000000", offset
+		if !start.IsZero() {
+			_, previous = start.Add(-time.Second).In(loc).Zone()
+			onset = start.In(time.FixedZone("", previous)).Format(localLayout)
+		}
+
+		cw.line("BEGIN:" + kind)
+		cw.line("DTSTART:" + onset)
+		cw.line("TZOFFSETFROM:" + formatOffset(previous))
+		cw.line("TZOFFSETTO:" + formatOffset(offset))
+		if abbrev != "" && !strings.ContainsAny(abbrev, "+-") {
+			cw.line("TZNAME:" + abbrev)
+		}
+		cw.line("END:" + kind)
+
+		if end.IsZero() || !end.Before(to) {
+			break
+		}
+		t = end.In(loc)
+	}
+	cw.line("END:VTIMEZONE")
+}
+
+// formatOffset formats a UTC offset in seconds as +hhmm
+func formatOffset(offset int) string {
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	s := fmt.Sprintf("%c%02d%02d", sign, offset/3600, offset%3600/60)
+	if seconds := offset % 60; seconds != 0 {
+		s += fmt.Sprintf("%02d", seconds)
+	}
+	return s
+}
+
+// escapeText escapes a TEXT value
+func escapeText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// nameParam returns a CN parameter for a person's name, if any
+func nameParam(name string) string {
+	name = strings.NewReplacer(`"`, "", "\r", "", "\n", " ").Replace(name)
+	if name == "" {
+		return ""
+	}
+	return `;CN="` + name + `"`
+}
+
+// contentWriter writes content lines, folding them at 75 octets without
+// splitting UTF-8 characters, and remembers the first error
+type contentWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *contentWriter) line(s string) {
+	var b strings.Builder
+	width := 0
+	for _, r := range s {
+		size := utf8.RuneLen(r)
+		if width+size > maxLine {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	b.WriteString("\r\n")
+	cw.write(b.String())
+}
+
+func (cw *contentWriter) write(s string) {
+	if cw.err != nil {
+		return
+	}
+	n, err := io.WriteString(cw.w, s)
+	cw.n += int64(n)
+	cw.err = err
+}
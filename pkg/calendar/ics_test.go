@@ -0,0 +1,120 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Bashar444/VTP/pkg/models"
+)
+
+// unfold joins folded content lines
+func unfold(ics string) string {
+	return strings.ReplaceAll(ics, "\r\n ", "")
+}
+
+// TestMeetingEventUpdates tests that a moved or cancelled meeting keeps its
+// UID and carries its sequence and status
+func TestMeetingEventUpdates(t *testing.T) {
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	m := &models.Meeting{ID: "m1", TitleAr: "رياضيات", ScheduledAt: start, Duration: 45, Status: "scheduled"}
+
+	cal := &Calendar{Events: []Event{meetingEvent(m)}}
+	ics := string(cal.Bytes())
+	for _, want := range []string{
+		"UID:m1@vtp\r\n",
+		"SEQUENCE:0\r\n",
+		"DTSTART:20260301T090000Z\r\n",
+		"DTEND:20260301T094500Z\r\n",
+		"STATUS:CONFIRMED\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("Expected %q in:\n%s", want, ics)
+		}
+	}
+
+	m.Status = "cancelled"
+	m.Sequence = 2
+	cal = &Calendar{Method: MethodCancel, Events: []Event{meetingEvent(m)}}
+	ics = string(cal.Bytes())
+	for _, want := range []string{"METHOD:CANCEL\r\n", "UID:m1@vtp\r\n", "SEQUENCE:2\r\n", "STATUS:CANCELLED\r\n"} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("Expected %q in:\n%s", want, ics)
+		}
+	}
+}
+
+// TestContentLineFolding tests that long lines are folded at 75 octets
+// without splitting characters and that text is escaped
+func TestContentLineFolding(t *testing.T) {
+	summary := strings.Repeat("درس، رياضيات; ", 10)
+	cal := &Calendar{Events: []Event{{UID: "e1", Start: time.Now(), Summary: summary}}}
+	ics := string(cal.Bytes())
+
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		if len(line) > maxLine {
+			t.Errorf("Line of %d octets: %q", len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("Line splits a character: %q", line)
+		}
+	}
+	if !strings.Contains(unfold(ics), "SUMMARY:"+escapeText(summary)+"\r\n") {
+		t.Errorf("Expected the escaped summary in:\n%s", ics)
+	}
+	if escapeText("a,b;c\\d\ne") != `a\,b\;c\\d\ne` {
+		t.Errorf("Unexpected escaping: %s", escapeText("a,b;c\\d\ne"))
+	}
+}
+
+// TestTimetableEvent tests that a timetable lesson repeats weekly in local
+// time from the first lesson day of the term
+func TestTimetableEvent(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Damascus")
+	if err != nil {
+		t.Skipf("Time zone not available: %v", err)
+	}
+
+	entry := &TimetableEntry{
+		ID:          "s1",
+		SubjectName: "فيزياء",
+		DayOfWeek:   int(time.Tuesday),
+		StartTime:   "08:30:00",
+		EndTime:     "09:15:00",
+		TermStart:   time.Date(2026, 9, 6, 0, 0, 0, 0, time.UTC), // a Sunday
+		TermEnd:     time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC),
+	}
+	event, ok := timetableEvent(entry, loc)
+	if !ok {
+		t.Fatal("Expected an event")
+	}
+
+	ics := unfold(string((&Calendar{Events: []Event{event}}).Bytes()))
+	for _, want := range []string{
+		"BEGIN:VTIMEZONE\r\nTZID:Asia/Damascus\r\n",
+		"DTSTART;TZID=Asia/Damascus:20260908T083000\r\n",
+		"DTEND;TZID=Asia/Damascus:20260908T091500\r\n",
+		"RRULE:FREQ=WEEKLY",
+		"UID:schedule-s1@vtp\r\n",
+	} {
+		if !strings.Contains(ics, want) {
+			t.Errorf("Expected %q in:\n%s", want, ics)
+		}
+	}
+
+	entry.TermEnd = time.Date(2026, 9, 7, 0, 0, 0, 0, time.UTC)
+	if _, ok := timetableEvent(entry, loc); ok {
+		t.Error("Expected no event for a term without a Tuesday")
+	}
+}
+
+// TestHashToken tests that feed tokens are stored hashed
+func TestHashToken(t *testing.T) {
+	if hashToken("abc") == "abc" || len(hashToken("abc")) != 64 {
+		t.Errorf("Unexpected token hash %q", hashToken("abc"))
+	}
+	if hashToken("abc") != hashToken(" abc\n") {
+		t.Error("Expected surrounding space to be ignored")
+	}
+}
@@ -0,0 +1,201 @@
+package calendar
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/models"
+)
+
+var (
+	ErrFeedNotFound = errors.New("calendar feed not found")
+)
+
+// FeedUser is the owner of a calendar feed
+type FeedUser struct {
+	ID       string
+	FullName string
+	Role     string
+}
+
+// TimetableEntry is a weekly lesson of the school timetable during a term
+type TimetableEntry struct {
+	ID          string
+	SubjectName string
+	DayOfWeek   int    // 0=Sunday
+	StartTime   string // HH:MM:SS
+	EndTime     string // HH:MM:SS
+	RoomName    string
+	TermStart   time.Time
+	TermEnd     time.Time
+}
+
+// Repository handles calendar feed tokens and the timetable and people
+// calendars are built from
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository creates a new calendar repository
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// StoreFeedToken stores the hash of a user's feed token, replacing the
+// previous one
+func (r *Repository) StoreFeedToken(ctx context.Context, userID, tokenHash string) error {
+	query := `
+		INSERT INTO calendar_feed_tokens (user_id, token_hash, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET token_hash = EXCLUDED.token_hash, created_at = EXCLUDED.created_at, last_used_at = NULL
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, tokenHash, time.Now()); err != nil {
+		return fmt.Errorf("failed to store calendar feed token: %w", err)
+	}
+	return nil
+}
+
+// DeleteFeedToken removes a user's feed token
+func (r *Repository) DeleteFeedToken(ctx context.Context, userID string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM calendar_feed_tokens WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete calendar feed token: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrFeedNotFound
+	}
+	return nil
+}
+
+// FeedUser returns the owner of the feed token with the given hash and
+// records that the feed was read
+func (r *Repository) FeedUser(ctx context.Context, tokenHash string) (*FeedUser, error) {
+	query := `
+		UPDATE calendar_feed_tokens t
+		SET last_used_at = $2
+		FROM users u
+		WHERE t.token_hash = $1 AND u.id = t.user_id
+		RETURNING u.id, u.full_name, u.role
+	`
+
+	user := &FeedUser{}
+	err := r.db.QueryRowContext(ctx, query, tokenHash, time.Now()).Scan(&user.ID, &user.FullName, &user.Role)
+	if err == sql.ErrNoRows {
+		return nil, ErrFeedNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get calendar feed: %w", err)
+	}
+	return user, nil
+}
+
+// InstructorID returns the instructor profile ID of a user, or "" if the
+// user is not an instructor
+func (r *Repository) InstructorID(ctx context.Context, userID string) (string, error) {
+	var id string
+	err := r.db.QueryRowContext(ctx, `SELECT id FROM instructors WHERE user_id = $1`, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get instructor: %w", err)
+	}
+	return id, nil
+}
+
+// Organizer returns the name and email address of an instructor
+func (r *Repository) Organizer(ctx context.Context, instructorID string) (*Person, error) {
+	query := `
+		SELECT u.full_name, u.email
+		FROM instructors i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.id = $1
+	`
+
+	person := &Person{}
+	err := r.db.QueryRowContext(ctx, query, instructorID).Scan(&person.Name, &person.Email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get meeting organizer: %w", err)
+	}
+	return person, nil
+}
+
+// MeetingParticipants returns the user IDs of a meeting's instructor and
+// students: its one-on-one student or the students enrolled in its course
+func (r *Repository) MeetingParticipants(ctx context.Context, meeting *models.Meeting) ([]string, error) {
+	query := `
+		SELECT user_id::text FROM instructors WHERE id = $1
+		UNION
+		SELECT id::text FROM users WHERE id::text = $2
+		UNION
+		SELECT student_id::text FROM course_enrollments
+		WHERE course_id::text = $3 AND status = 'active'
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, meeting.InstructorID, meeting.StudentID, meeting.CourseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list meeting participants: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan meeting participant: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+// StudentTimetable lists the timetable of a student's class section in
+// current and upcoming terms
+func (r *Repository) StudentTimetable(ctx context.Context, userID string) ([]TimetableEntry, error) {
+	return r.timetable(ctx, `cs.class_section_id = (SELECT class_section_id FROM users WHERE id = $1)`, userID)
+}
+
+// InstructorTimetable lists the lessons an instructor teaches in current
+// and upcoming terms
+func (r *Repository) InstructorTimetable(ctx context.Context, instructorID string) ([]TimetableEntry, error) {
+	return r.timetable(ctx, `cs.instructor_id = $1`, instructorID)
+}
+
+func (r *Repository) timetable(ctx context.Context, condition string, arg string) ([]TimetableEntry, error) {
+	query := `
+		SELECT cs.id, s.name_ar, cs.day_of_week, cs.start_time::text, cs.end_time::text,
+			   COALESCE(cs.room_name, ''), st.start_date, st.end_date
+		FROM class_schedule cs
+		JOIN subjects s ON s.id = cs.subject_id
+		JOIN school_terms st ON st.id = cs.school_term_id
+		WHERE ` + condition + ` AND st.end_date >= CURRENT_DATE
+		ORDER BY st.start_date, cs.day_of_week, cs.start_time
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, arg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list timetable: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []TimetableEntry
+	for rows.Next() {
+		var e TimetableEntry
+		if err := rows.Scan(&e.ID, &e.SubjectName, &e.DayOfWeek, &e.StartTime, &e.EndTime,
+			&e.RoomName, &e.TermStart, &e.TermEnd); err != nil {
+			return nil, fmt.Errorf("failed to scan timetable entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
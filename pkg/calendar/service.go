@@ -0,0 +1,278 @@
+package calendar
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/meeting"
+	"github.com/Bashar444/VTP/pkg/models"
+	"github.com/Bashar444/VTP/pkg/notification"
+)
+
+const (
+	uidDomain       = "vtp"
+	meetingPageSize = 100
+	maxFeedMeetings = 500 // most recently listed meetings kept in a feed
+)
+
+// Meetings lists the meetings a feed is built from
+type Meetings interface {
+	GetStudentMeetings(ctx context.Context, studentID string, status string, page, pageSize int) ([]*models.Meeting, error)
+	GetInstructorMeetings(ctx context.Context, instructorID string, status string, page, pageSize int) ([]*models.Meeting, error)
+}
+
+// Assignments lists the assignment deadlines a feed is built from
+type Assignments interface {
+	List(ctx context.Context, courseID, instructorID, subjectID *string) ([]models.Assignment, error)
+	ListForStudent(ctx context.Context, studentID string) ([]models.Assignment, error)
+}
+
+// Inviter delivers meeting invitations to participants
+type Inviter interface {
+	NotifyMeetingInvite(ctx context.Context, invite *notification.MeetingInvite, participantIDs []string) error
+}
+
+// Service builds calendar feeds and meeting invitations
+type Service struct {
+	repo        *Repository
+	meetings    Meetings
+	assignments Assignments
+	inviter     Inviter
+}
+
+// NewService creates a new calendar service
+func NewService(repo *Repository, meetings Meetings, assignments Assignments) *Service {
+	return &Service{
+		repo:        repo,
+		meetings:    meetings,
+		assignments: assignments,
+	}
+}
+
+// WithInviter sets where meeting invitations are sent
+func (s *Service) WithInviter(inviter Inviter) *Service {
+	s.inviter = inviter
+	return s
+}
+
+// IssueFeedToken creates a new secret feed token for a user. Only its hash
+// is stored, so issuing a token revokes the previous one.
+func (s *Service) IssueFeedToken(ctx context.Context, userID string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate calendar feed token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	if err := s.repo.StoreFeedToken(ctx, userID, hashToken(token)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RevokeFeedToken disables a user's feed
+func (s *Service) RevokeFeedToken(ctx context.Context, userID string) error {
+	return s.repo.DeleteFeedToken(ctx, userID)
+}
+
+// Feed returns the calendar of the user owning a feed token: their
+// meetings, assignment deadlines and timetable. Teachers get what they
+// teach, everyone else what they attend.
+func (s *Service) Feed(ctx context.Context, token string) (*Calendar, error) {
+	if token == "" {
+		return nil, ErrFeedNotFound
+	}
+	user, err := s.repo.FeedUser(ctx, hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	instructorID, err := s.repo.InstructorID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	listMeetings := func(page int) ([]*models.Meeting, error) {
+		return s.meetings.GetStudentMeetings(ctx, user.ID, "", page, meetingPageSize)
+	}
+	listAssignments := func() ([]models.Assignment, error) {
+		return s.assignments.ListForStudent(ctx, user.ID)
+	}
+	listTimetable := func() ([]TimetableEntry, error) {
+		return s.repo.StudentTimetable(ctx, user.ID)
+	}
+	if instructorID != "" {
+		listMeetings = func(page int) ([]*models.Meeting, error) {
+			return s.meetings.GetInstructorMeetings(ctx, instructorID, "", page, meetingPageSize)
+		}
+		listAssignments = func() ([]models.Assignment, error) {
+			return s.assignments.List(ctx, nil, &instructorID, nil)
+		}
+		listTimetable = func() ([]TimetableEntry, error) {
+			return s.repo.InstructorTimetable(ctx, instructorID)
+		}
+	}
+
+	cal := &Calendar{Name: "VTP - " + user.FullName, TimeZone: meeting.DefaultTimezone}
+
+	for page, listed := 1, 0; listed < maxFeedMeetings; page++ {
+		meetings, err := listMeetings(page)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range meetings {
+			cal.Events = append(cal.Events, meetingEvent(m))
+		}
+		listed += len(meetings)
+		if len(meetings) < meetingPageSize {
+			break
+		}
+	}
+
+	assignments, err := listAssignments()
+	if err != nil {
+		return nil, err
+	}
+	for i := range assignments {
+		cal.Events = append(cal.Events, assignmentEvent(&assignments[i]))
+	}
+
+	timetable, err := listTimetable()
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(meeting.DefaultTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load time zone: %w", err)
+	}
+	for i := range timetable {
+		if event, ok := timetableEvent(&timetable[i], loc); ok {
+			cal.Events = append(cal.Events, event)
+		}
+	}
+
+	return cal, nil
+}
+
+// SendMeetingInvites sends the meeting's participants an invitation for
+// its current state: a request for scheduled meetings and a cancellation
+// for cancelled ones
+func (s *Service) SendMeetingInvites(ctx context.Context, m *models.Meeting) error {
+	if s.inviter == nil {
+		return nil
+	}
+	if m.Status != "scheduled" && m.Status != "cancelled" {
+		return nil
+	}
+
+	participants, err := s.repo.MeetingParticipants(ctx, m)
+	if err != nil {
+		return err
+	}
+	if len(participants) == 0 {
+		return nil
+	}
+	organizer, err := s.repo.Organizer(ctx, m.InstructorID)
+	if err != nil {
+		return err
+	}
+
+	event := meetingEvent(m)
+	event.Organizer = organizer
+	method := MethodRequest
+	if event.Status == StatusCancelled {
+		method = MethodCancel
+	}
+	cal := &Calendar{Method: method, Events: []Event{event}}
+
+	when := m.ScheduledAt
+	if loc, err := time.LoadLocation(meeting.DefaultTimezone); err == nil {
+		when = when.In(loc)
+	}
+
+	return s.inviter.NotifyMeetingInvite(ctx, &notification.MeetingInvite{
+		MeetingID: m.ID,
+		TitleAr:   m.TitleAr,
+		When:      when.Format("2006-01-02 15:04"),
+		Sequence:  m.Sequence,
+		Method:    method,
+		ICS:       cal.Bytes(),
+	}, participants)
+}
+
+// meetingEvent returns the event of a meeting. Its UID is the meeting's,
+// so clients update the event when the meeting is moved or cancelled.
+func meetingEvent(m *models.Meeting) Event {
+	status := StatusConfirmed
+	if m.Status == "cancelled" {
+		status = StatusCancelled
+	}
+	return Event{
+		UID:         m.ID + "@" + uidDomain,
+		Sequence:    m.Sequence,
+		Start:       m.ScheduledAt,
+		End:         m.ScheduledAt.Add(time.Duration(m.Duration) * time.Minute),
+		Summary:     m.TitleAr,
+		Description: m.MeetingURL,
+		URL:         m.MeetingURL,
+		Status:      status,
+		Updated:     m.UpdatedAt,
+	}
+}
+
+// assignmentEvent returns the deadline of an assignment
+func assignmentEvent(a *models.Assignment) Event {
+	return Event{
+		UID:         "assignment-" + a.ID + "@" + uidDomain,
+		Start:       a.DueAt,
+		Summary:     "موعد تسليم: " + a.TitleAR,
+		Description: a.DescriptionAR,
+		Status:      StatusConfirmed,
+		Updated:     a.UpdatedAt,
+	}
+}
+
+// timetableEvent returns a timetable lesson as an event repeating weekly in
+// local time from the first lesson of the term to its last day. It reports
+// false when the term holds no such lesson.
+func timetableEvent(e *TimetableEntry, loc *time.Location) (Event, bool) {
+	startClock, err1 := time.Parse("15:04:05", e.StartTime)
+	endClock, err2 := time.Parse("15:04:05", e.EndTime)
+	if err1 != nil || err2 != nil {
+		return Event{}, false
+	}
+
+	year, month, day := e.TermStart.Date()
+	first := time.Date(year, month, day, 0, 0, 0, 0, loc)
+	for first.Weekday() != time.Weekday(e.DayOfWeek) {
+		first = first.AddDate(0, 0, 1)
+	}
+	year, month, day = e.TermEnd.Date()
+	until := time.Date(year, month, day, 23, 59, 59, 0, loc)
+	if first.After(until) {
+		return Event{}, false
+	}
+
+	rule := meeting.Recurrence{Freq: meeting.FreqWeekly, Interval: 1, Until: until, WeekStart: time.Monday}
+	year, month, day = first.Date()
+	return Event{
+		UID:      "schedule-" + e.ID + "@" + uidDomain,
+		Start:    time.Date(year, month, day, startClock.Hour(), startClock.Minute(), 0, 0, loc),
+		End:      time.Date(year, month, day, endClock.Hour(), endClock.Minute(), 0, 0, loc),
+		TimeZone: loc.String(),
+		RRule:    rule.String(),
+		Summary:  e.SubjectName,
+		Location: e.RoomName,
+		Status:   StatusConfirmed,
+	}, true
+}
+
+// hashToken returns the stored form of a feed token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	return hex.EncodeToString(sum[:])
+}
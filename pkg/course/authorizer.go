@@ -0,0 +1,474 @@
+package course
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultRoleCacheTTL is how long a resolved (user, course) role is reused
+const DefaultRoleCacheTTL = 30 * time.Second
+
+// Role groups used when protecting course-scoped endpoints
+var (
+	// ManageRoles may modify the course and its content
+	ManageRoles = []string{RoleAdmin, RoleInstructor}
+	// StaffRoles may grade, take attendance and see submissions
+	StaffRoles = []string{RoleAdmin, RoleInstructor, RoleTA}
+	// MemberRoles may read course content
+	MemberRoles = []string{RoleAdmin, RoleInstructor, RoleTA, RoleStudent, RoleViewer}
+)
+
+var (
+	ErrNotCourseMember = errors.New("user has no role in this course")
+	ErrForbidden       = errors.New("course role does not permit this action")
+	ErrResourceMissing = errors.New("resource not found")
+	ErrCourseNotFound  = errors.New("course not found")
+)
+
+// roleRank orders course roles from least to most privileged
+var roleRank = map[string]int{
+	RoleViewer:     1,
+	RoleStudent:    2,
+	RoleTA:         3,
+	RoleInstructor: 4,
+	RoleAdmin:      5,
+}
+
+// HigherRole returns whichever of the two course roles grants more privileges
+func HigherRole(a, b string) string {
+	if roleRank[b] > roleRank[a] {
+		return b
+	}
+	return a
+}
+
+// CourseScope describes the course a request targets. OwnerUserID is the user
+// that created the resource (always treated as instructor) and AttendeeUserID
+// is an individually invited user such as the student of a 1:1 meeting.
+type CourseScope struct {
+	CourseID       uuid.UUID
+	OwnerUserID    string
+	AttendeeUserID string
+}
+
+// ScopeResolver maps a request to the course scope it targets. A nil scope
+// means the request is not bound to a single course.
+type ScopeResolver func(r *http.Request) (*CourseScope, error)
+
+type cachedRole struct {
+	role      string
+	expiresAt time.Time
+}
+
+// CourseAuthorizer resolves a user's effective role in a course from course
+// ownership, course_permissions and active enrollments
+type CourseAuthorizer struct {
+	db     *sql.DB
+	ttl    time.Duration
+	logger *slog.Logger
+
+	mu    sync.RWMutex
+	cache map[string]cachedRole
+
+	// lookup is swapped out in tests
+	lookup func(ctx context.Context, courseID uuid.UUID, userID string) (string, error)
+}
+
+// NewCourseAuthorizer creates a new course authorizer
+func NewCourseAuthorizer(db *sql.DB, ttl time.Duration, logger *slog.Logger) *CourseAuthorizer {
+	if logger == nil {
+		logger = slog.Default().With("component", "course_authz")
+	}
+	if ttl <= 0 {
+		ttl = DefaultRoleCacheTTL
+	}
+	a := &CourseAuthorizer{
+		db:     db,
+		ttl:    ttl,
+		logger: logger,
+		cache:  make(map[string]cachedRole),
+	}
+	a.lookup = a.lookupRole
+	return a
+}
+
+// EffectiveRole returns the user's role in the course, or "" if the user has
+// no relationship with it. Global admins are admins of every course.
+func (a *CourseAuthorizer) EffectiveRole(ctx context.Context, userID, globalRole string, courseID uuid.UUID) (string, error) {
+	if globalRole == RoleAdmin {
+		return RoleAdmin, nil
+	}
+
+	key := courseID.String() + "|" + userID
+	a.mu.RLock()
+	entry, ok := a.cache[key]
+	a.mu.RUnlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.role, nil
+	}
+
+	role, err := a.lookup(ctx, courseID, userID)
+	if err != nil {
+		return "", err
+	}
+
+	a.mu.Lock()
+	a.cache[key] = cachedRole{role: role, expiresAt: time.Now().Add(a.ttl)}
+	a.mu.Unlock()
+
+	return role, nil
+}
+
+// Invalidate drops the cached role for a user in a course
+func (a *CourseAuthorizer) Invalidate(courseID uuid.UUID, userID string) {
+	a.mu.Lock()
+	delete(a.cache, courseID.String()+"|"+userID)
+	a.mu.Unlock()
+}
+
+// InvalidateCourse drops every cached role for a course
+func (a *CourseAuthorizer) InvalidateCourse(courseID uuid.UUID) {
+	prefix := courseID.String() + "|"
+	a.mu.Lock()
+	for key := range a.cache {
+		if len(key) > len(prefix) && key[:len(prefix)] == prefix {
+			delete(a.cache, key)
+		}
+	}
+	a.mu.Unlock()
+}
+
+// ScopeRole resolves the effective role for a scope, taking resource
+// ownership into account in addition to the course role
+func (a *CourseAuthorizer) ScopeRole(ctx context.Context, userID, globalRole string, scope *CourseScope) (string, error) {
+	if globalRole == RoleAdmin {
+		return RoleAdmin, nil
+	}
+
+	role := ""
+	if scope.CourseID != uuid.Nil {
+		courseRole, err := a.EffectiveRole(ctx, userID, globalRole, scope.CourseID)
+		if err != nil {
+			return "", err
+		}
+		role = courseRole
+	}
+	if scope.OwnerUserID != "" && scope.OwnerUserID == userID {
+		role = HigherRole(role, RoleInstructor)
+	}
+	if scope.AttendeeUserID != "" && scope.AttendeeUserID == userID {
+		role = HigherRole(role, RoleStudent)
+	}
+	return role, nil
+}
+
+// Check verifies that the authenticated user holds one of the allowed roles
+// within the scope and returns the effective role
+func (a *CourseAuthorizer) Check(r *http.Request, scope *CourseScope, allowed ...string) (string, error) {
+	userID, _ := r.Context().Value("user_id").(string)
+	globalRole, _ := r.Context().Value("user_role").(string)
+	if userID == "" {
+		return "", ErrNotCourseMember
+	}
+
+	role, err := a.ScopeRole(r.Context(), userID, globalRole, scope)
+	if err != nil {
+		return "", err
+	}
+	if role == "" {
+		return "", ErrNotCourseMember
+	}
+	for _, candidate := range allowed {
+		if role == candidate {
+			return role, nil
+		}
+	}
+	return role, ErrForbidden
+}
+
+// Require returns middleware that only lets through users holding one of the
+// allowed roles in the course the request resolves to. The effective role is
+// stored in the request context under "course_role". A nil authorizer lets
+// every request through, matching CourseHandlers without an authorizer, so
+// routes can be registered when the database is unavailable.
+func (a *CourseAuthorizer) Require(resolve ScopeResolver, allowed ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if a == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope, err := resolve(r)
+			if err != nil {
+				if errors.Is(err, ErrResourceMissing) {
+					a.respondError(w, http.StatusNotFound, "NOT_FOUND", err.Error())
+					return
+				}
+				a.logger.WarnContext(r.Context(), "Failed to resolve course scope", "path", r.URL.Path, "error", err)
+				a.respondError(w, http.StatusBadRequest, "INVALID_SCOPE", err.Error())
+				return
+			}
+			if scope == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			role, err := a.Check(r, scope, allowed...)
+			switch {
+			case errors.Is(err, ErrNotCourseMember):
+				a.respondError(w, http.StatusForbidden, "NOT_COURSE_MEMBER", err.Error())
+				return
+			case errors.Is(err, ErrForbidden):
+				a.respondError(w, http.StatusForbidden, "INSUFFICIENT_COURSE_ROLE", err.Error())
+				return
+			case errors.Is(err, ErrCourseNotFound):
+				a.respondError(w, http.StatusNotFound, "COURSE_NOT_FOUND", err.Error())
+				return
+			case err != nil:
+				a.logger.ErrorContext(r.Context(), "Course authorization failed", "error", err)
+				a.respondError(w, http.StatusInternalServerError, "AUTHORIZATION_ERROR", "failed to resolve course role")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "course_role", role)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// lookupRole reads the course-level role for a user from the database
+func (a *CourseAuthorizer) lookupRole(ctx context.Context, courseID uuid.UUID, userID string) (string, error) {
+	query := `
+		SELECT c.instructor_id::text = $2,
+		       COALESCE(p.role, ''),
+		       EXISTS (
+		           SELECT 1 FROM course_enrollments e
+		           WHERE e.course_id = c.id AND e.student_id::text = $2 AND e.status = $3
+		       )
+		FROM courses c
+		LEFT JOIN course_permissions p ON p.course_id = c.id AND p.user_id::text = $2
+		WHERE c.id = $1
+	`
+
+	var isOwner, enrolled bool
+	var permRole string
+	err := a.db.QueryRowContext(ctx, query, courseID, userID, EnrollmentActive).Scan(&isOwner, &permRole, &enrolled)
+	if err == sql.ErrNoRows {
+		return "", ErrCourseNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve course role: %w", err)
+	}
+
+	role := permRole
+	if enrolled {
+		role = HigherRole(role, RoleStudent)
+	}
+	if isOwner {
+		role = HigherRole(role, RoleInstructor)
+	}
+	return role, nil
+}
+
+func (a *CourseAuthorizer) respondError(w http.ResponseWriter, statusCode int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": message, "code": code})
+}
+
+// Scope resolvers
+
+// CourseFromPath scopes a request to the course ID stored in the named path value
+func (a *CourseAuthorizer) CourseFromPath(param string) ScopeResolver {
+	return func(r *http.Request) (*CourseScope, error) {
+		courseID, err := uuid.Parse(r.PathValue(param))
+		if err != nil {
+			return nil, fmt.Errorf("invalid course ID")
+		}
+		return &CourseScope{CourseID: courseID}, nil
+	}
+}
+
+// CourseFromQuery scopes a request to a course ID query parameter. Only
+// global admins may leave it out, to act across courses.
+func (a *CourseAuthorizer) CourseFromQuery(param string) ScopeResolver {
+	return func(r *http.Request) (*CourseScope, error) {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			return unscoped(r, param)
+		}
+		courseID, err := uuid.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s", param)
+		}
+		return &CourseScope{CourseID: courseID}, nil
+	}
+}
+
+// CourseFromBody scopes a request to a course ID field of its JSON body.
+// Only global admins may leave it out. The body is restored so the handler
+// can decode it again.
+func (a *CourseAuthorizer) CourseFromBody(field string) ScopeResolver {
+	return func(r *http.Request) (*CourseScope, error) {
+		if r.Body == nil {
+			return unscoped(r, field)
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		r.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		var payload map[string]interface{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("invalid request body")
+		}
+		value, _ := payload[field].(string)
+		if value == "" {
+			return unscoped(r, field)
+		}
+		courseID, err := uuid.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s", field)
+		}
+		return &CourseScope{CourseID: courseID}, nil
+	}
+}
+
+// unscoped lets global admins make a request without a course ID and
+// refuses it to everyone else
+func unscoped(r *http.Request, name string) (*CourseScope, error) {
+	if role, _ := r.Context().Value("user_role").(string); role == RoleAdmin {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("%s is required", name)
+}
+
+// RecordingScope scopes a request to the course a recording is attached to
+func (a *CourseAuthorizer) RecordingScope(param string) ScopeResolver {
+	return a.resourceScope(param, `
+		SELECT COALESCE((SELECT cr.course_id::text FROM course_recordings cr
+		                 WHERE cr.recording_id = r.id ORDER BY cr.created_at LIMIT 1), ''),
+		       COALESCE(r.started_by::text, ''),
+		       ''
+		FROM recordings r
+		WHERE r.id = $1
+	`)
+}
+
+// MaterialScope scopes a request to the course a study material belongs to
+func (a *CourseAuthorizer) MaterialScope(param string) ScopeResolver {
+	return a.resourceScope(param, `
+		SELECT COALESCE(m.course_id::text, ''), COALESCE(i.user_id::text, ''), ''
+		FROM study_materials m
+		LEFT JOIN instructors i ON i.id = m.instructor_id
+		WHERE m.id = $1
+	`)
+}
+
+// AssignmentScope scopes a request to the course an assignment belongs to
+func (a *CourseAuthorizer) AssignmentScope(param string) ScopeResolver {
+	return a.resourceScope(param, `
+		SELECT COALESCE(a.course_id::text, ''), COALESCE(i.user_id::text, a.instructor_id::text), ''
+		FROM assignments a
+		LEFT JOIN instructors i ON i.id = a.instructor_id
+		WHERE a.id = $1
+	`)
+}
+
+// SubmissionScope scopes a request to the course of the assignment a
+// submission was made for
+func (a *CourseAuthorizer) SubmissionScope(param string) ScopeResolver {
+	return a.resourceScope(param, `
+		SELECT COALESCE(a.course_id::text, ''), COALESCE(i.user_id::text, a.instructor_id::text), ''
+		FROM assignment_submissions s
+		JOIN assignments a ON a.id = s.assignment_id
+		LEFT JOIN instructors i ON i.id = a.instructor_id
+		WHERE s.id = $1
+	`)
+}
+
+// MeetingScope scopes a request to the course of a meeting. The meeting's
+// instructor is its owner and an invited student is its attendee.
+func (a *CourseAuthorizer) MeetingScope(param string) ScopeResolver {
+	return a.resourceScope(param, `
+		SELECT COALESCE(m.course_id::text, ''), COALESCE(i.user_id::text, ''), COALESCE(m.student_id::text, '')
+		FROM meetings m
+		LEFT JOIN instructors i ON i.id = m.instructor_id
+		WHERE m.id = $1
+	`)
+}
+
+// resourceScope builds a resolver from a query returning the course ID, owner
+// user ID and attendee user ID of the resource named by the path value
+func (a *CourseAuthorizer) resourceScope(param, query string) ScopeResolver {
+	return func(r *http.Request) (*CourseScope, error) {
+		resourceID, err := uuid.Parse(r.PathValue(param))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s", param)
+		}
+		return a.queryScope(r.Context(), query, resourceID)
+	}
+}
+
+// queryScope runs a query returning the course ID, owner user ID and
+// attendee user ID of a resource
+func (a *CourseAuthorizer) queryScope(ctx context.Context, query string, args ...interface{}) (*CourseScope, error) {
+	var courseIDStr, owner, attendee string
+	err := a.db.QueryRowContext(ctx, query, args...).Scan(&courseIDStr, &owner, &attendee)
+	if err == sql.ErrNoRows {
+		return nil, ErrResourceMissing
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve resource course: %w", err)
+	}
+
+	scope := &CourseScope{OwnerUserID: owner, AttendeeUserID: attendee}
+	if courseIDStr != "" {
+		if scope.CourseID, err = uuid.Parse(courseIDStr); err != nil {
+			return nil, fmt.Errorf("invalid course ID on resource: %w", err)
+		}
+	}
+	return scope, nil
+}
+
+// RoomRole returns a user's role in the meeting held in a live session
+// room, as a series shares one room across its occurrences the one closest
+// to now. ok is false when no meeting is held in the room.
+func (a *CourseAuthorizer) RoomRole(ctx context.Context, roomID, userID, globalRole string) (string, bool, error) {
+	scope, err := a.roomScope(ctx, roomID)
+	if errors.Is(err, ErrResourceMissing) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	role, err := a.ScopeRole(ctx, userID, globalRole, scope)
+	return role, true, err
+}
+
+// roomScope scopes a live session room to the course of its meeting
+func (a *CourseAuthorizer) roomScope(ctx context.Context, roomID string) (*CourseScope, error) {
+	if roomID == "" {
+		return nil, ErrResourceMissing
+	}
+	return a.queryScope(ctx, `
+		SELECT COALESCE(m.course_id::text, ''), COALESCE(i.user_id::text, ''), COALESCE(m.student_id::text, '')
+		FROM meetings m
+		LEFT JOIN instructors i ON i.id = m.instructor_id
+		WHERE m.room_id = $1 AND m.status <> 'cancelled'
+		ORDER BY ABS(EXTRACT(EPOCH FROM (m.scheduled_at - NOW())))
+		LIMIT 1
+	`, roomID)
+}
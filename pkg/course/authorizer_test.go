@@ -0,0 +1,244 @@
+package course
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// newTestAuthorizer returns an authorizer whose role lookup reads from roles
+// and counts how often the database would have been hit
+func newTestAuthorizer(ttl time.Duration, roles map[string]string, calls *int) *CourseAuthorizer {
+	a := NewCourseAuthorizer(nil, ttl, nil)
+	a.lookup = func(ctx context.Context, courseID uuid.UUID, userID string) (string, error) {
+		*calls++
+		return roles[userID], nil
+	}
+	return a
+}
+
+// TestHigherRole tests course role ranking
+func TestHigherRole(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected string
+	}{
+		{RoleStudent, RoleTA, RoleTA},
+		{RoleInstructor, RoleStudent, RoleInstructor},
+		{"", RoleViewer, RoleViewer},
+		{RoleAdmin, RoleInstructor, RoleAdmin},
+		{RoleViewer, "", RoleViewer},
+	}
+
+	for _, test := range tests {
+		if got := HigherRole(test.a, test.b); got != test.expected {
+			t.Fatalf("HigherRole(%q, %q) = %q, expected %q", test.a, test.b, got, test.expected)
+		}
+	}
+
+	t.Log("✓ Course roles ranked correctly")
+}
+
+// TestEffectiveRoleCache tests that resolved roles are cached until the TTL expires
+func TestEffectiveRoleCache(t *testing.T) {
+	calls := 0
+	a := newTestAuthorizer(50*time.Millisecond, map[string]string{"user-1": RoleTA}, &calls)
+	courseID := uuid.New()
+
+	for i := 0; i < 3; i++ {
+		role, err := a.EffectiveRole(context.Background(), "user-1", "student", courseID)
+		if err != nil {
+			t.Fatalf("EffectiveRole failed: %v", err)
+		}
+		if role != RoleTA {
+			t.Fatalf("Expected role %s, got %s", RoleTA, role)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("Expected 1 lookup while cached, got %d", calls)
+	}
+
+	a.Invalidate(courseID, "user-1")
+	a.EffectiveRole(context.Background(), "user-1", "student", courseID)
+	if calls != 2 {
+		t.Fatalf("Expected lookup after invalidation, got %d lookups", calls)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	a.EffectiveRole(context.Background(), "user-1", "student", courseID)
+	if calls != 3 {
+		t.Fatalf("Expected lookup after TTL expiry, got %d lookups", calls)
+	}
+
+	t.Log("✓ Role cache honours TTL and invalidation")
+}
+
+// TestGlobalAdmin tests that platform admins bypass the course lookup
+func TestGlobalAdmin(t *testing.T) {
+	calls := 0
+	a := newTestAuthorizer(time.Minute, nil, &calls)
+
+	role, err := a.EffectiveRole(context.Background(), "admin-1", "admin", uuid.New())
+	if err != nil {
+		t.Fatalf("EffectiveRole failed: %v", err)
+	}
+	if role != RoleAdmin || calls != 0 {
+		t.Fatalf("Expected admin without lookup, got %q after %d lookups", role, calls)
+	}
+
+	t.Log("✓ Global admins are course admins")
+}
+
+// TestScopeRole tests that resource ownership raises the course role
+func TestScopeRole(t *testing.T) {
+	calls := 0
+	a := newTestAuthorizer(time.Minute, map[string]string{"viewer-1": RoleViewer}, &calls)
+	courseID := uuid.New()
+
+	tests := []struct {
+		name     string
+		userID   string
+		scope    *CourseScope
+		expected string
+	}{
+		{"Course viewer", "viewer-1", &CourseScope{CourseID: courseID}, RoleViewer},
+		{"Owner without course", "teacher-1", &CourseScope{OwnerUserID: "teacher-1"}, RoleInstructor},
+		{"Viewer owning resource", "viewer-1", &CourseScope{CourseID: courseID, OwnerUserID: "viewer-1"}, RoleInstructor},
+		{"Invited attendee", "student-1", &CourseScope{AttendeeUserID: "student-1"}, RoleStudent},
+		{"Stranger", "stranger", &CourseScope{OwnerUserID: "teacher-1"}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			role, err := a.ScopeRole(context.Background(), test.userID, "student", test.scope)
+			if err != nil {
+				t.Fatalf("ScopeRole failed: %v", err)
+			}
+			if role != test.expected {
+				t.Fatalf("Expected role %q, got %q", test.expected, role)
+			}
+		})
+	}
+
+	t.Log("✓ Scope roles resolved correctly")
+}
+
+// TestRequireMiddleware tests the HTTP middleware responses
+func TestRequireMiddleware(t *testing.T) {
+	calls := 0
+	a := newTestAuthorizer(time.Minute, map[string]string{
+		"student-1": RoleStudent,
+		"teacher-1": RoleInstructor,
+	}, &calls)
+	courseID := uuid.New()
+
+	resolve := func(r *http.Request) (*CourseScope, error) {
+		return &CourseScope{CourseID: courseID}, nil
+	}
+	handler := a.Require(resolve, ManageRoles...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Value("course_role") == nil {
+			t.Error("course_role not set in context")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		userID string
+		status int
+	}{
+		{"teacher-1", http.StatusOK},
+		{"student-1", http.StatusForbidden},
+		{"stranger", http.StatusForbidden},
+		{"", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/courses/"+courseID.String(), nil)
+		ctx := context.WithValue(req.Context(), "user_id", test.userID)
+		ctx = context.WithValue(ctx, "user_role", "teacher")
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req.WithContext(ctx))
+		if rec.Code != test.status {
+			t.Fatalf("User %q: expected status %d, got %d", test.userID, test.status, rec.Code)
+		}
+	}
+
+	t.Log("✓ Require middleware enforces course roles")
+}
+
+// TestCourseFromQuery tests that only global admins may list across courses
+func TestCourseFromQuery(t *testing.T) {
+	a := newTestAuthorizer(time.Minute, nil, new(int))
+	courseID := uuid.New()
+
+	tests := []struct {
+		query   string
+		role    string
+		scoped  bool
+		invalid bool
+	}{
+		{"?course_id=" + courseID.String(), "student", true, false},
+		{"", "student", false, true},
+		{"", "teacher", false, true},
+		{"", "admin", false, false},
+		{"?course_id=nope", "admin", false, true},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/assignments"+test.query, nil)
+		req = req.WithContext(context.WithValue(req.Context(), "user_role", test.role))
+		scope, err := a.CourseFromQuery("course_id")(req)
+		if (err != nil) != test.invalid {
+			t.Fatalf("%q as %s: unexpected error %v", test.query, test.role, err)
+		}
+		if (scope != nil) != test.scoped || (scope != nil && scope.CourseID != courseID) {
+			t.Fatalf("%q as %s: unexpected scope %+v", test.query, test.role, scope)
+		}
+	}
+
+	t.Log("✓ Course ID required outside global admins")
+}
+
+// TestCourseFromBody tests that a body the handler could read differently
+// is refused rather than let through unscoped
+func TestCourseFromBody(t *testing.T) {
+	calls := 0
+	a := newTestAuthorizer(time.Minute, map[string]string{"teacher-1": RoleInstructor}, &calls)
+	courseID := uuid.New()
+
+	handler := a.Require(a.CourseFromBody("course_id"), ManageRoles...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	tests := []struct {
+		userID string
+		body   string
+		status int
+	}{
+		{"teacher-1", `{"course_id":"` + courseID.String() + `"}`, http.StatusCreated},
+		{"stranger", `{"course_id":"` + courseID.String() + `"}`, http.StatusForbidden},
+		{"stranger", `{"course_id":"` + courseID.String() + `"}x`, http.StatusBadRequest},
+		{"stranger", `{"course_id":`, http.StatusBadRequest},
+		{"stranger", `{}`, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/meetings", strings.NewReader(test.body))
+		ctx := context.WithValue(req.Context(), "user_id", test.userID)
+		ctx = context.WithValue(ctx, "user_role", "teacher")
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req.WithContext(ctx))
+		if rec.Code != test.status {
+			t.Fatalf("%s with %s: expected status %d, got %d", test.userID, test.body, test.status, rec.Code)
+		}
+	}
+
+	t.Log("✓ Malformed bodies refused before the course check")
+}
@@ -3,25 +3,29 @@ package course
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"github.com/Bashar444/VTP/pkg/auth"
+	"github.com/Bashar444/VTP/pkg/router"
 	"github.com/google/uuid"
 )
 
 // CourseHandlers manages HTTP handlers for course operations
 type CourseHandlers struct {
-	service *CourseService
-	logger  *log.Logger
+	service    *CourseService
+	authorizer *CourseAuthorizer
+	logger     *slog.Logger
 }
 
 // NewCourseHandlers creates a new course handlers instance
-func NewCourseHandlers(service *CourseService, logger *log.Logger) *CourseHandlers {
+func NewCourseHandlers(service *CourseService, logger *slog.Logger) *CourseHandlers {
 	if logger == nil {
-		logger = log.New(log.Writer(), "[CourseAPI] ", log.LstdFlags)
+		logger = slog.Default().With("component", "course_api")
 	}
 	return &CourseHandlers{
 		service: service,
@@ -29,117 +33,82 @@ func NewCourseHandlers(service *CourseService, logger *log.Logger) *CourseHandle
 	}
 }
 
-// RegisterCourseRoutes registers all course routes on the default HTTP mux
-func (ch *CourseHandlers) RegisterCourseRoutes(mux *http.ServeMux) {
-	// Course Management
-	mux.HandleFunc("/api/v1/courses", ch.handleCourses)
-	mux.HandleFunc("/api/v1/courses/", ch.handleCourseDetail)
-
-	// Student's own enrollments
-	mux.HandleFunc("/api/v1/courses/my-enrollments", ch.GetMyEnrollments)
-
-	ch.logger.Println("Course routes registered")
+// WithAuthorizer enables course-role checks on course detail routes
+func (ch *CourseHandlers) WithAuthorizer(authorizer *CourseAuthorizer) *CourseHandlers {
+	ch.authorizer = authorizer
+	return ch
 }
 
-// handleCourses routes to appropriate handler based on method
-func (ch *CourseHandlers) handleCourses(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodPost:
-		ch.CreateCourse(w, r)
-	case http.MethodGet:
-		ch.ListCourses(w, r)
-	default:
-		ch.respondError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
-	}
-}
+// RegisterCourseRoutes registers all course routes. Routes under a course ID
+// are checked against the caller's course role when an authorizer is set.
+func (ch *CourseHandlers) RegisterCourseRoutes(rt *router.Router, am *auth.AuthMiddleware) {
+	api := rt.With(am.Middleware)
 
-// handleCourseDetail routes course detail requests
-func (ch *CourseHandlers) handleCourseDetail(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Path
+	// Course Management
+	api.HandleFunc("POST /api/v1/courses", ch.CreateCourse)
+	api.HandleFunc("GET /api/v1/courses", ch.ListCourses)
+	api.HandleFunc("GET /api/v1/courses/{id}", ch.courseRoute(MemberRoles, ch.GetCourse))
+	api.HandleFunc("PUT /api/v1/courses/{id}", ch.courseRoute(ManageRoles, ch.UpdateCourse))
+	api.HandleFunc("DELETE /api/v1/courses/{id}", ch.courseRoute(ManageRoles, ch.DeleteCourse))
+	api.HandleFunc("GET /api/v1/courses/{id}/stats", ch.courseRoute(StaffRoles, ch.GetCourseStats))
+
+	// Enrollment
+	api.HandleFunc("POST /api/v1/courses/{id}/enroll", ch.courseRoute(ManageRoles, ch.EnrollStudent))
+	api.HandleFunc("GET /api/v1/courses/{id}/enroll", ch.courseRoute(StaffRoles, ch.ListEnrollments))
+	api.HandleFunc("GET /api/v1/courses/{id}/enrollments", ch.courseRoute(StaffRoles, ch.ListEnrollments))
+	api.HandleFunc("DELETE /api/v1/courses/{id}/enroll/{student_id}", ch.courseRoute(ManageRoles,
+		func(w http.ResponseWriter, r *http.Request, courseID uuid.UUID) {
+			studentID, err := uuid.Parse(r.PathValue("student_id"))
+			if err != nil {
+				ch.respondError(w, r, http.StatusBadRequest, "Invalid student ID", err)
+				return
+			}
+			ch.RemoveStudent(w, r, courseID, studentID)
+		}))
+
+	// Recordings
+	api.HandleFunc("POST /api/v1/courses/{id}/recordings", ch.courseRoute(ManageRoles, ch.AddRecording))
+	api.HandleFunc("POST /api/v1/courses/{id}/recordings/{recording_id}/publish", ch.courseRoute(ManageRoles,
+		func(w http.ResponseWriter, r *http.Request, courseID uuid.UUID) {
+			recordingID, err := uuid.Parse(r.PathValue("recording_id"))
+			if err != nil {
+				ch.respondError(w, r, http.StatusBadRequest, "Invalid recording ID", err)
+				return
+			}
+			ch.PublishRecording(w, r, courseID, recordingID)
+		}))
+
+	// Permissions
+	api.HandleFunc("POST /api/v1/courses/{id}/permissions", ch.courseRoute(ManageRoles, ch.SetPermission))
+	api.HandleFunc("GET /api/v1/courses/{id}/permissions/{user_id}", ch.courseRoute(StaffRoles,
+		func(w http.ResponseWriter, r *http.Request, courseID uuid.UUID) {
+			userID, err := uuid.Parse(r.PathValue("user_id"))
+			if err != nil {
+				ch.respondError(w, r, http.StatusBadRequest, "Invalid user ID", err)
+				return
+			}
+			ch.GetPermission(w, r, courseID, userID)
+		}))
 
-	// Extract course ID from path: /api/v1/courses/{id} or related
-	parts := strings.Split(path, "/")
-	if len(parts) < 5 {
-		ch.respondError(w, http.StatusNotFound, "Not found", nil)
-		return
-	}
+	// Student's own enrollments
+	api.HandleFunc("GET /api/v1/courses/my-enrollments", ch.GetMyEnrollments)
 
-	courseIDStr := parts[4]
-	courseID, err := uuid.Parse(courseIDStr)
-	if err != nil {
-		ch.respondError(w, http.StatusBadRequest, "Invalid course ID", err)
-		return
-	}
+	ch.logger.Debug("Course routes registered")
+}
 
-	// Route based on remaining path and method
-	if len(parts) == 5 {
-		// /api/v1/courses/{id}
-		switch r.Method {
-		case http.MethodGet:
-			ch.GetCourse(w, r, courseID)
-		case http.MethodPut:
-			ch.UpdateCourse(w, r, courseID)
-		case http.MethodDelete:
-			ch.DeleteCourse(w, r, courseID)
-		default:
-			ch.respondError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+// courseRoute parses the course ID from the path and checks the caller's
+// course role before calling fn
+func (ch *CourseHandlers) courseRoute(allowed []string, fn func(http.ResponseWriter, *http.Request, uuid.UUID)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		courseID, err := uuid.Parse(r.PathValue("id"))
+		if err != nil {
+			ch.respondError(w, r, http.StatusBadRequest, "Invalid course ID", err)
+			return
 		}
-	} else if len(parts) >= 6 {
-		// /api/v1/courses/{id}/{action}
-		action := parts[5]
-		switch action {
-		case "enroll":
-			if len(parts) == 6 {
-				switch r.Method {
-				case http.MethodPost:
-					ch.EnrollStudent(w, r, courseID)
-				case http.MethodGet:
-					ch.ListEnrollments(w, r, courseID)
-				default:
-					ch.respondError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
-				}
-			} else if len(parts) == 7 && r.Method == http.MethodDelete {
-				// /api/v1/courses/{id}/enroll/{student_id}
-				studentID, err := uuid.Parse(parts[6])
-				if err != nil {
-					ch.respondError(w, http.StatusBadRequest, "Invalid student ID", err)
-					return
-				}
-				ch.RemoveStudent(w, r, courseID, studentID)
-			}
-		case "recordings":
-			if r.Method == http.MethodPost {
-				ch.AddRecording(w, r, courseID)
-			} else if len(parts) == 7 && parts[6] == "publish" && r.Method == http.MethodPost {
-				recordingID, err := uuid.Parse(parts[6])
-				if err != nil {
-					ch.respondError(w, http.StatusBadRequest, "Invalid recording ID", err)
-					return
-				}
-				ch.PublishRecording(w, r, courseID, recordingID)
-			}
-		case "enrollments":
-			if r.Method == http.MethodGet {
-				ch.ListEnrollments(w, r, courseID)
-			}
-		case "permissions":
-			if r.Method == http.MethodPost {
-				ch.SetPermission(w, r, courseID)
-			} else if len(parts) == 7 && r.Method == http.MethodGet {
-				userID, err := uuid.Parse(parts[6])
-				if err != nil {
-					ch.respondError(w, http.StatusBadRequest, "Invalid user ID", err)
-					return
-				}
-				ch.GetPermission(w, r, courseID, userID)
-			}
-		case "stats":
-			if r.Method == http.MethodGet {
-				ch.GetCourseStats(w, r, courseID)
-			}
-		default:
-			ch.respondError(w, http.StatusNotFound, "Not found", nil)
+		if !ch.authorize(w, r, courseID, allowed) {
+			return
 		}
+		fn(w, r, courseID)
 	}
 }
 
@@ -147,20 +116,20 @@ func (ch *CourseHandlers) handleCourseDetail(w http.ResponseWriter, r *http.Requ
 func (ch *CourseHandlers) CreateCourse(w http.ResponseWriter, r *http.Request) {
 	var req CreateCourseRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		ch.respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		ch.respondError(w, r, http.StatusBadRequest, "Invalid request body", err)
 		return
 	}
 
 	// Get instructor ID from JWT token context
-	instructorID, ok := r.Context().Value("user_id").(uuid.UUID)
+	instructorID, ok := contextUserID(r)
 	if !ok {
-		ch.respondError(w, http.StatusUnauthorized, "User ID not found in context", nil)
+		ch.respondError(w, r, http.StatusUnauthorized, "User ID not found in context", nil)
 		return
 	}
 
 	course, err := ch.service.CreateCourse(r.Context(), req, instructorID)
 	if err != nil {
-		ch.respondError(w, http.StatusInternalServerError, "Failed to create course", err)
+		ch.respondError(w, r, http.StatusInternalServerError, "Failed to create course", err)
 		return
 	}
 
@@ -199,7 +168,7 @@ func (ch *CourseHandlers) ListCourses(w http.ResponseWriter, r *http.Request) {
 
 	courses, err := ch.service.ListCourses(r.Context(), filter)
 	if err != nil {
-		ch.respondError(w, http.StatusInternalServerError, "Failed to list courses", err)
+		ch.respondError(w, r, http.StatusInternalServerError, "Failed to list courses", err)
 		return
 	}
 
@@ -225,7 +194,7 @@ func (ch *CourseHandlers) ListCourses(w http.ResponseWriter, r *http.Request) {
 func (ch *CourseHandlers) GetCourse(w http.ResponseWriter, r *http.Request, courseID uuid.UUID) {
 	course, err := ch.service.GetCourse(r.Context(), courseID)
 	if err != nil {
-		ch.respondError(w, http.StatusNotFound, "Course not found", err)
+		ch.respondError(w, r, http.StatusNotFound, "Course not found", err)
 		return
 	}
 
@@ -255,16 +224,16 @@ func (ch *CourseHandlers) GetCourse(w http.ResponseWriter, r *http.Request, cour
 func (ch *CourseHandlers) UpdateCourse(w http.ResponseWriter, r *http.Request, courseID uuid.UUID) {
 	var req UpdateCourseRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		ch.respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		ch.respondError(w, r, http.StatusBadRequest, "Invalid request body", err)
 		return
 	}
 
 	course, err := ch.service.UpdateCourse(r.Context(), courseID, req)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
-			ch.respondError(w, http.StatusNotFound, "Course not found", err)
+			ch.respondError(w, r, http.StatusNotFound, "Course not found", err)
 		} else {
-			ch.respondError(w, http.StatusInternalServerError, "Failed to update course", err)
+			ch.respondError(w, r, http.StatusInternalServerError, "Failed to update course", err)
 		}
 		return
 	}
@@ -277,12 +246,15 @@ func (ch *CourseHandlers) DeleteCourse(w http.ResponseWriter, r *http.Request, c
 	err := ch.service.DeleteCourse(r.Context(), courseID)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
-			ch.respondError(w, http.StatusNotFound, "Course not found", err)
+			ch.respondError(w, r, http.StatusNotFound, "Course not found", err)
 		} else {
-			ch.respondError(w, http.StatusInternalServerError, "Failed to delete course", err)
+			ch.respondError(w, r, http.StatusInternalServerError, "Failed to delete course", err)
 		}
 		return
 	}
+	if ch.authorizer != nil {
+		ch.authorizer.InvalidateCourse(courseID)
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -291,15 +263,18 @@ func (ch *CourseHandlers) DeleteCourse(w http.ResponseWriter, r *http.Request, c
 func (ch *CourseHandlers) EnrollStudent(w http.ResponseWriter, r *http.Request, courseID uuid.UUID) {
 	var req EnrollStudentRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		ch.respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		ch.respondError(w, r, http.StatusBadRequest, "Invalid request body", err)
 		return
 	}
 
 	enrollment, err := ch.service.EnrollStudent(r.Context(), courseID, req.StudentID)
 	if err != nil {
-		ch.respondError(w, http.StatusInternalServerError, "Failed to enroll student", err)
+		ch.respondError(w, r, http.StatusInternalServerError, "Failed to enroll student", err)
 		return
 	}
+	if ch.authorizer != nil {
+		ch.authorizer.Invalidate(courseID, req.StudentID.String())
+	}
 
 	ch.respondJSON(w, http.StatusCreated, enrollment)
 }
@@ -308,7 +283,7 @@ func (ch *CourseHandlers) EnrollStudent(w http.ResponseWriter, r *http.Request,
 func (ch *CourseHandlers) ListEnrollments(w http.ResponseWriter, r *http.Request, courseID uuid.UUID) {
 	enrollments, err := ch.service.ListEnrollments(r.Context(), courseID)
 	if err != nil {
-		ch.respondError(w, http.StatusInternalServerError, "Failed to list enrollments", err)
+		ch.respondError(w, r, http.StatusInternalServerError, "Failed to list enrollments", err)
 		return
 	}
 
@@ -329,9 +304,12 @@ func (ch *CourseHandlers) ListEnrollments(w http.ResponseWriter, r *http.Request
 func (ch *CourseHandlers) RemoveStudent(w http.ResponseWriter, r *http.Request, courseID uuid.UUID, studentID uuid.UUID) {
 	err := ch.service.RemoveStudent(r.Context(), courseID, studentID)
 	if err != nil {
-		ch.respondError(w, http.StatusInternalServerError, "Failed to remove student", err)
+		ch.respondError(w, r, http.StatusInternalServerError, "Failed to remove student", err)
 		return
 	}
+	if ch.authorizer != nil {
+		ch.authorizer.Invalidate(courseID, studentID.String())
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -340,7 +318,7 @@ func (ch *CourseHandlers) RemoveStudent(w http.ResponseWriter, r *http.Request,
 func (ch *CourseHandlers) AddRecording(w http.ResponseWriter, r *http.Request, courseID uuid.UUID) {
 	var req AddRecordingRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		ch.respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		ch.respondError(w, r, http.StatusBadRequest, "Invalid request body", err)
 		return
 	}
 
@@ -357,7 +335,7 @@ func (ch *CourseHandlers) AddRecording(w http.ResponseWriter, r *http.Request, c
 	recording, err := ch.service.AddRecordingToCourse(r.Context(), courseID, req.RecordingID,
 		lectureNumber, lectureTitle, req.SequenceOrder)
 	if err != nil {
-		ch.respondError(w, http.StatusInternalServerError, "Failed to add recording", err)
+		ch.respondError(w, r, http.StatusInternalServerError, "Failed to add recording", err)
 		return
 	}
 
@@ -368,7 +346,7 @@ func (ch *CourseHandlers) AddRecording(w http.ResponseWriter, r *http.Request, c
 func (ch *CourseHandlers) PublishRecording(w http.ResponseWriter, r *http.Request, courseID uuid.UUID, recordingID uuid.UUID) {
 	err := ch.service.PublishCourseRecording(r.Context(), courseID, recordingID)
 	if err != nil {
-		ch.respondError(w, http.StatusInternalServerError, "Failed to publish recording", err)
+		ch.respondError(w, r, http.StatusInternalServerError, "Failed to publish recording", err)
 		return
 	}
 
@@ -379,15 +357,18 @@ func (ch *CourseHandlers) PublishRecording(w http.ResponseWriter, r *http.Reques
 func (ch *CourseHandlers) SetPermission(w http.ResponseWriter, r *http.Request, courseID uuid.UUID) {
 	var req SetPermissionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		ch.respondError(w, http.StatusBadRequest, "Invalid request body", err)
+		ch.respondError(w, r, http.StatusBadRequest, "Invalid request body", err)
 		return
 	}
 
 	permission, err := ch.service.SetPermission(r.Context(), courseID, req.UserID, req.Role)
 	if err != nil {
-		ch.respondError(w, http.StatusInternalServerError, "Failed to set permission", err)
+		ch.respondError(w, r, http.StatusInternalServerError, "Failed to set permission", err)
 		return
 	}
+	if ch.authorizer != nil {
+		ch.authorizer.Invalidate(courseID, req.UserID.String())
+	}
 
 	ch.respondJSON(w, http.StatusCreated, permission)
 }
@@ -396,7 +377,7 @@ func (ch *CourseHandlers) SetPermission(w http.ResponseWriter, r *http.Request,
 func (ch *CourseHandlers) GetPermission(w http.ResponseWriter, r *http.Request, courseID uuid.UUID, userID uuid.UUID) {
 	permission, err := ch.service.GetPermission(r.Context(), courseID, userID)
 	if err != nil {
-		ch.respondError(w, http.StatusInternalServerError, "Failed to get permission", err)
+		ch.respondError(w, r, http.StatusInternalServerError, "Failed to get permission", err)
 		return
 	}
 
@@ -419,7 +400,7 @@ func (ch *CourseHandlers) GetPermission(w http.ResponseWriter, r *http.Request,
 func (ch *CourseHandlers) GetCourseStats(w http.ResponseWriter, r *http.Request, courseID uuid.UUID) {
 	course, err := ch.service.GetCourse(r.Context(), courseID)
 	if err != nil {
-		ch.respondError(w, http.StatusNotFound, "Course not found", err)
+		ch.respondError(w, r, http.StatusNotFound, "Course not found", err)
 		return
 	}
 
@@ -448,7 +429,7 @@ func (ch *CourseHandlers) GetCourseStats(w http.ResponseWriter, r *http.Request,
 	)
 
 	if err != nil && err != sql.ErrNoRows {
-		ch.respondError(w, http.StatusInternalServerError, "Failed to get stats", err)
+		ch.respondError(w, r, http.StatusInternalServerError, "Failed to get stats", err)
 		return
 	}
 
@@ -489,20 +470,20 @@ func (ch *CourseHandlers) GetCourseStats(w http.ResponseWriter, r *http.Request,
 // GetMyEnrollments returns courses the authenticated user is enrolled in
 func (ch *CourseHandlers) GetMyEnrollments(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		ch.respondError(w, http.StatusMethodNotAllowed, "Method not allowed", nil)
+		ch.respondError(w, r, http.StatusMethodNotAllowed, "Method not allowed", nil)
 		return
 	}
 
 	// Get user ID from context (set by auth middleware)
-	userID, ok := r.Context().Value("user_id").(uuid.UUID)
+	userID, ok := contextUserID(r)
 	if !ok {
-		ch.respondError(w, http.StatusUnauthorized, "Unauthorized", nil)
+		ch.respondError(w, r, http.StatusUnauthorized, "Unauthorized", nil)
 		return
 	}
 
 	enrollments, err := ch.service.GetStudentEnrollments(r.Context(), userID)
 	if err != nil {
-		ch.respondError(w, http.StatusInternalServerError, "Failed to fetch enrollments", err)
+		ch.respondError(w, r, http.StatusInternalServerError, "Failed to fetch enrollments", err)
 		return
 	}
 
@@ -514,15 +495,48 @@ func (ch *CourseHandlers) GetMyEnrollments(w http.ResponseWriter, r *http.Reques
 
 // Helper functions
 
+// authorize checks the caller's course role when an authorizer is configured
+func (ch *CourseHandlers) authorize(w http.ResponseWriter, r *http.Request, courseID uuid.UUID, allowed []string) bool {
+	if ch.authorizer == nil {
+		return true
+	}
+
+	_, err := ch.authorizer.Check(r, &CourseScope{CourseID: courseID}, allowed...)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrCourseNotFound):
+		ch.respondError(w, r, http.StatusNotFound, "Course not found", err)
+	case errors.Is(err, ErrNotCourseMember), errors.Is(err, ErrForbidden):
+		ch.respondError(w, r, http.StatusForbidden, "Insufficient course permissions", err)
+	default:
+		ch.respondError(w, r, http.StatusInternalServerError, "Failed to check course permissions", err)
+	}
+	return false
+}
+
+// contextUserID reads the authenticated user ID set by the auth middleware
+func contextUserID(r *http.Request) (uuid.UUID, bool) {
+	userIDStr, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		return uuid.Nil, false
+	}
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
 func (ch *CourseHandlers) respondJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	json.NewEncoder(w).Encode(payload)
 }
 
-func (ch *CourseHandlers) respondError(w http.ResponseWriter, code int, message string, err error) {
+func (ch *CourseHandlers) respondError(w http.ResponseWriter, r *http.Request, code int, message string, err error) {
 	if err != nil {
-		ch.logger.Printf("API Error: %s - %v", message, err)
+		ch.logger.WarnContext(r.Context(), "API error", "message", message, "status", code, "error", err)
 	}
 
 	response := ErrorResponse{
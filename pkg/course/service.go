@@ -5,7 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,13 +14,13 @@ import (
 // CourseService manages course operations
 type CourseService struct {
 	db     *sql.DB
-	logger *log.Logger
+	logger *slog.Logger
 }
 
 // NewCourseService creates a new course service
-func NewCourseService(db *sql.DB, logger *log.Logger) *CourseService {
+func NewCourseService(db *sql.DB, logger *slog.Logger) *CourseService {
 	if logger == nil {
-		logger = log.New(log.Writer(), "[CourseService] ", log.LstdFlags)
+		logger = slog.Default().With("component", "course")
 	}
 	return &CourseService{
 		db:     db,
@@ -54,11 +54,11 @@ func (cs *CourseService) CreateCourse(ctx context.Context, req CreateCourseReque
 	)
 
 	if err != nil {
-		cs.logger.Printf("Error creating course: %v", err)
+		cs.logger.ErrorContext(ctx, "Error creating course", "error", err)
 		return nil, fmt.Errorf("failed to create course: %w", err)
 	}
 
-	cs.logger.Printf("Course created: %s (ID: %s)", course.Name, course.ID)
+	cs.logger.InfoContext(ctx, "Course created", "course_id", course.ID, "name", course.Name)
 	return course, nil
 }
 
@@ -123,7 +123,7 @@ func (cs *CourseService) ListCourses(ctx context.Context, filter map[string]inte
 
 	rows, err := cs.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		cs.logger.Printf("Error listing courses: %v", err)
+		cs.logger.ErrorContext(ctx, "Error listing courses", "error", err)
 		return nil, fmt.Errorf("failed to list courses: %w", err)
 	}
 	defer rows.Close()
@@ -136,7 +136,7 @@ func (cs *CourseService) ListCourses(ctx context.Context, filter map[string]inte
 			&course.Department, &course.Semester, &course.Year, &course.Status, &course.MaxStudents,
 			&course.CreatedAt, &course.UpdatedAt,
 		); err != nil {
-			cs.logger.Printf("Error scanning course: %v", err)
+			cs.logger.ErrorContext(ctx, "Error scanning course", "error", err)
 			return nil, fmt.Errorf("failed to scan course: %w", err)
 		}
 		courses = append(courses, course)
@@ -178,7 +178,7 @@ func (cs *CourseService) UpdateCourse(ctx context.Context, courseID uuid.UUID, r
 		return nil, fmt.Errorf("failed to update course: %w", err)
 	}
 
-	cs.logger.Printf("Course updated: %s (ID: %s)", course.Name, course.ID)
+	cs.logger.InfoContext(ctx, "Course updated", "course_id", course.ID, "name", course.Name)
 	return course, nil
 }
 
@@ -187,7 +187,7 @@ func (cs *CourseService) DeleteCourse(ctx context.Context, courseID uuid.UUID) e
 	query := `DELETE FROM courses WHERE id = $1`
 	result, err := cs.db.ExecContext(ctx, query, courseID)
 	if err != nil {
-		cs.logger.Printf("Error deleting course: %v", err)
+		cs.logger.ErrorContext(ctx, "Error deleting course", "course_id", courseID, "error", err)
 		return fmt.Errorf("failed to delete course: %w", err)
 	}
 
@@ -200,7 +200,7 @@ func (cs *CourseService) DeleteCourse(ctx context.Context, courseID uuid.UUID) e
 		return fmt.Errorf("course not found: %s", courseID)
 	}
 
-	cs.logger.Printf("Course deleted: ID %s", courseID)
+	cs.logger.InfoContext(ctx, "Course deleted", "course_id", courseID)
 	return nil
 }
 
@@ -224,11 +224,11 @@ func (cs *CourseService) EnrollStudent(ctx context.Context, courseID, studentID
 	)
 
 	if err != nil {
-		cs.logger.Printf("Error enrolling student: %v", err)
+		cs.logger.ErrorContext(ctx, "Error enrolling student", "course_id", courseID, "student_id", studentID, "error", err)
 		return nil, fmt.Errorf("failed to enroll student: %w", err)
 	}
 
-	cs.logger.Printf("Student enrolled: %s in course %s", studentID, courseID)
+	cs.logger.InfoContext(ctx, "Student enrolled", "course_id", courseID, "student_id", studentID)
 	return enrollment, nil
 }
 
@@ -342,7 +342,7 @@ func (cs *CourseService) SetPermission(ctx context.Context, courseID, userID uui
 		return nil, fmt.Errorf("failed to set permission: %w", err)
 	}
 
-	cs.logger.Printf("Permission set: %s for user %s in course %s", role, userID, courseID)
+	cs.logger.InfoContext(ctx, "Permission set", "course_id", courseID, "target_user_id", userID, "role", role)
 	return permission, nil
 }
 
@@ -391,7 +391,7 @@ func (cs *CourseService) AddRecordingToCourse(ctx context.Context, courseID, rec
 	)
 
 	if err != nil {
-		cs.logger.Printf("Error adding recording to course: %v", err)
+		cs.logger.ErrorContext(ctx, "Error adding recording to course", "course_id", courseID, "recording_id", recordingID, "error", err)
 		return nil, fmt.Errorf("failed to add recording: %w", err)
 	}
 
@@ -438,7 +438,7 @@ func (cs *CourseService) LogCourseActivity(ctx context.Context, courseID uuid.UU
 	)
 
 	if err != nil {
-		cs.logger.Printf("Error logging activity: %v", err)
+		cs.logger.ErrorContext(ctx, "Error logging activity", "course_id", courseID, "error", err)
 		return fmt.Errorf("failed to log activity: %w", err)
 	}
 
@@ -460,7 +460,7 @@ func (cs *CourseService) LogRecordingAccess(ctx context.Context, recordingID uui
 	)
 
 	if err != nil {
-		cs.logger.Printf("Error logging recording access: %v", err)
+		cs.logger.ErrorContext(ctx, "Error logging recording access", "recording_id", recordingID, "error", err)
 		return fmt.Errorf("failed to log access: %w", err)
 	}
 
@@ -3,7 +3,7 @@ package db
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 
@@ -25,7 +25,7 @@ func NewDatabase(dbURL string) (*Database, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	log.Println("✓ Database connection established")
+	slog.Info("Database connection established")
 	return &Database{conn: conn}, nil
 }
 
@@ -52,9 +52,8 @@ func (d *Database) RunMigrations() error {
 	} else {
 		// Fall back to looking in the expected location from binary
 		wd, _ := os.Getwd()
-		log.Printf("Working directory: %s", wd)
 		migrationsDir = "migrations"
-		log.Printf("Note: Could not find migrations directory, attempting with: %s", migrationsDir)
+		slog.Warn("Could not find migrations directory", "working_dir", wd, "attempting", migrationsDir)
 	}
 
 	// Read migration files
@@ -76,7 +75,7 @@ func (d *Database) RunMigrations() error {
 				return fmt.Errorf("failed to execute migration %s: %w", filePath, err)
 			}
 
-			log.Printf("✓ Executed migration: %s", entry.Name())
+			slog.Info("Executed migration", "file", entry.Name())
 		}
 	}
 
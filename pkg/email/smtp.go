@@ -2,9 +2,12 @@ package email
 
 import (
 	"crypto/tls"
+	"encoding/base64"
 	"fmt"
+	"mime"
 	"net/smtp"
 	"os"
+	"strings"
 )
 
 // Sender defines minimal interface for sending emails
@@ -34,10 +37,6 @@ func NewSMTPSenderFromEnv() (*SMTPSender, error) {
 }
 
 func (s *SMTPSender) Send(to, subject, bodyHTML, bodyText string) error {
-	addr := fmt.Sprintf("%s:%s", s.host, s.port)
-	// Prefer STARTTLS
-	auth := smtp.PlainAuth("", s.user, s.pass, s.host)
-
 	msg := ""
 	msg += fmt.Sprintf("From: %s\r\n", s.from)
 	msg += fmt.Sprintf("To: %s\r\n", to)
@@ -50,6 +49,57 @@ func (s *SMTPSender) Send(to, subject, bodyHTML, bodyText string) error {
 	msg += bodyHTML + "\r\n"
 	msg += "--boundary42--\r\n"
 
+	return s.deliver(to, msg)
+}
+
+// From returns the address emails are sent from
+func (s *SMTPSender) From() string {
+	return s.from
+}
+
+// SendInvite sends an email carrying an iCalendar invitation. The invite
+// is both an alternative body, which mail clients show as an invitation
+// with the given iTIP method (REQUEST or CANCEL), and an invite.ics
+// attachment for clients that only import files.
+func (s *SMTPSender) SendInvite(to, subject, bodyHTML, bodyText string, invite []byte, method string) error {
+	encoded := base64.StdEncoding.EncodeToString(invite)
+	var folded strings.Builder
+	for len(encoded) > 76 {
+		folded.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	folded.WriteString(encoded + "\r\n")
+
+	msg := ""
+	msg += fmt.Sprintf("From: %s\r\n", s.from)
+	msg += fmt.Sprintf("To: %s\r\n", to)
+	msg += fmt.Sprintf("Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	msg += "MIME-Version: 1.0\r\n"
+	msg += "Content-Type: multipart/mixed; boundary=mixed42\r\n\r\n"
+	msg += "--mixed42\r\nContent-Type: multipart/alternative; boundary=boundary42\r\n\r\n"
+	msg += "--boundary42\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n"
+	msg += bodyText + "\r\n"
+	msg += "--boundary42\r\nContent-Type: text/html; charset=utf-8\r\n\r\n"
+	msg += bodyHTML + "\r\n"
+	msg += fmt.Sprintf("--boundary42\r\nContent-Type: text/calendar; charset=utf-8; method=%s\r\n", method)
+	msg += "Content-Transfer-Encoding: base64\r\n\r\n"
+	msg += folded.String()
+	msg += "--boundary42--\r\n"
+	msg += "--mixed42\r\nContent-Type: application/ics; name=invite.ics\r\n"
+	msg += "Content-Disposition: attachment; filename=invite.ics\r\n"
+	msg += "Content-Transfer-Encoding: base64\r\n\r\n"
+	msg += folded.String()
+	msg += "--mixed42--\r\n"
+
+	return s.deliver(to, msg)
+}
+
+// deliver sends a composed message to one recipient
+func (s *SMTPSender) deliver(to, msg string) error {
+	addr := fmt.Sprintf("%s:%s", s.host, s.port)
+	// Prefer STARTTLS
+	auth := smtp.PlainAuth("", s.user, s.pass, s.host)
+
 	// Attempt TLS if port 465
 	if s.port == "465" {
 		c, err := tls.Dial("tcp", addr, &tls.Config{ServerName: s.host})
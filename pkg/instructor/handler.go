@@ -6,8 +6,9 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/Bashar444/VTP/pkg/auth"
 	"github.com/Bashar444/VTP/pkg/models"
-	"github.com/gorilla/mux"
+	"github.com/Bashar444/VTP/pkg/router"
 )
 
 // Handler handles HTTP requests for instructors
@@ -20,6 +21,20 @@ func NewHandler(service *Service) *Handler {
 	return &Handler{service: service}
 }
 
+// RegisterRoutes registers instructor routes. Browsing instructors is public;
+// changes require authentication.
+func (h *Handler) RegisterRoutes(rt *router.Router, am *auth.AuthMiddleware) {
+	api := rt.With(am.Middleware)
+
+	rt.HandleFunc("GET /api/v1/instructors", h.ListInstructors)
+	rt.HandleFunc("GET /api/v1/instructors/{id}", h.GetInstructor)
+	rt.HandleFunc("GET /api/v1/instructors/{id}/availability", h.GetAvailableSlots)
+	api.HandleFunc("POST /api/v1/instructors", h.CreateInstructor,
+		am.RoleMiddleware(string(auth.RoleTeacher), string(auth.RoleAdmin)))
+	api.HandleFunc("PUT /api/v1/instructors/{id}", h.UpdateInstructor)
+	api.HandleFunc("DELETE /api/v1/instructors/{id}", h.DeleteInstructor)
+}
+
 // CreateInstructorRequest represents the request to create an instructor
 type CreateInstructorRequest struct {
 	UserID           string              `json:"user_id"`
@@ -108,8 +123,7 @@ func (h *Handler) CreateInstructor(w http.ResponseWriter, r *http.Request) {
 
 // GetInstructor handles GET /api/instructors/{id}
 func (h *Handler) GetInstructor(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id := r.PathValue("id")
 
 	instructor, err := h.service.GetInstructor(r.Context(), id)
 	if err != nil {
@@ -172,8 +186,7 @@ func (h *Handler) ListInstructors(w http.ResponseWriter, r *http.Request) {
 
 // UpdateInstructor handles PUT /api/instructors/{id}
 func (h *Handler) UpdateInstructor(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id := r.PathValue("id")
 
 	// Get user ID from context (set by auth middleware)
 	userID, ok := r.Context().Value("user_id").(string)
@@ -225,8 +238,7 @@ func (h *Handler) UpdateInstructor(w http.ResponseWriter, r *http.Request) {
 
 // DeleteInstructor handles DELETE /api/instructors/{id}
 func (h *Handler) DeleteInstructor(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id := r.PathValue("id")
 
 	// Get user ID from context
 	userID, ok := r.Context().Value("user_id").(string)
@@ -253,8 +265,7 @@ func (h *Handler) DeleteInstructor(w http.ResponseWriter, r *http.Request) {
 
 // GetAvailableSlots handles GET /api/instructors/{id}/availability
 func (h *Handler) GetAvailableSlots(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id := r.PathValue("id")
 
 	dateStr := r.URL.Query().Get("date")
 	date, err := time.Parse("2006-01-02", dateStr)
@@ -0,0 +1,198 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultShutdownTimeout bounds the whole shutdown sequence
+const DefaultShutdownTimeout = 30 * time.Second
+
+// Hook is a component managed by the lifecycle manager. OnStart and OnStop
+// are optional; components that start their workers in their constructor
+// only need OnStop.
+type Hook struct {
+	Name    string
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+	// Timeout optionally bounds OnStop more tightly than the overall
+	// shutdown deadline
+	Timeout time.Duration
+}
+
+// Manager starts components in the order they were appended and stops them
+// in reverse order, so a component is always stopped before the components
+// it depends on
+type Manager struct {
+	mu              sync.Mutex
+	hooks           []Hook
+	started         []Hook
+	shutdownTimeout time.Duration
+	logger          *slog.Logger
+	errCh           chan error
+}
+
+// NewManager creates a lifecycle manager
+func NewManager(shutdownTimeout time.Duration, logger *slog.Logger) *Manager {
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = DefaultShutdownTimeout
+	}
+	if logger == nil {
+		logger = slog.Default().With("component", "lifecycle")
+	}
+	return &Manager{
+		shutdownTimeout: shutdownTimeout,
+		logger:          logger,
+		errCh:           make(chan error, 1),
+	}
+}
+
+// Append adds a component. Components must be appended in dependency order:
+// dependencies first.
+func (m *Manager) Append(hook Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook)
+}
+
+// AppendServer adds an HTTP server. The listener is bound on start so address
+// errors are reported immediately; on stop the server stops accepting
+// connections and in-flight requests are drained until drainTimeout.
+func (m *Manager) AppendServer(name string, srv *http.Server, drainTimeout time.Duration) {
+	m.Append(Hook{
+		Name: name,
+		OnStart: func(ctx context.Context) error {
+			ln, err := net.Listen("tcp", srv.Addr)
+			if err != nil {
+				return fmt.Errorf("failed to listen on %s: %w", srv.Addr, err)
+			}
+			go func() {
+				if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					m.Fail(fmt.Errorf("%s: %w", name, err))
+				}
+			}()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			if err := srv.Shutdown(ctx); err != nil {
+				// Drain deadline passed; drop the remaining connections
+				srv.Close()
+				return fmt.Errorf("failed to drain connections: %w", err)
+			}
+			return nil
+		},
+		Timeout: drainTimeout,
+	})
+}
+
+// Fail reports a fatal error from a running component and triggers shutdown
+func (m *Manager) Fail(err error) {
+	select {
+	case m.errCh <- err:
+	default:
+	}
+}
+
+// Start starts every component in order. If a component fails to start,
+// the components already started are stopped in reverse order.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	hooks := append([]Hook(nil), m.hooks...)
+	m.mu.Unlock()
+
+	for _, hook := range hooks {
+		if hook.OnStart != nil {
+			if err := hook.OnStart(ctx); err != nil {
+				startErr := fmt.Errorf("failed to start %s: %w", hook.Name, err)
+				stopCtx, cancel := context.WithTimeout(context.Background(), m.shutdownTimeout)
+				defer cancel()
+				return errors.Join(startErr, m.Stop(stopCtx))
+			}
+			m.logger.InfoContext(ctx, "Started component", "hook", hook.Name)
+		}
+
+		m.mu.Lock()
+		m.started = append(m.started, hook)
+		m.mu.Unlock()
+	}
+	return nil
+}
+
+// Stop stops the started components in reverse order. Each component is
+// given until its own timeout or ctx, whichever is sooner; a component that
+// does not stop in time is abandoned so the rest can still shut down.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	started := m.started
+	m.started = nil
+	m.mu.Unlock()
+
+	var errs []error
+	for i := len(started) - 1; i >= 0; i-- {
+		hook := started[i]
+		if hook.OnStop == nil {
+			continue
+		}
+		if err := m.stopHook(ctx, hook); err != nil {
+			m.logger.ErrorContext(ctx, "Failed to stop component", "hook", hook.Name, "error", err)
+			errs = append(errs, fmt.Errorf("failed to stop %s: %w", hook.Name, err))
+			continue
+		}
+		m.logger.InfoContext(ctx, "Stopped component", "hook", hook.Name)
+	}
+	return errors.Join(errs...)
+}
+
+// stopHook runs a component's OnStop bounded by its timeout and ctx
+func (m *Manager) stopHook(ctx context.Context, hook Hook) error {
+	if hook.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hook.Timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- hook.OnStop(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("did not stop in time: %w", ctx.Err())
+	}
+}
+
+// Run starts every component and blocks until ctx is cancelled, the process
+// receives SIGINT or SIGTERM, or a component fails. It then stops every
+// component within the shutdown timeout.
+func (m *Manager) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := m.Start(ctx); err != nil {
+		return err
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		m.logger.Info("Shutdown requested, stopping components", "timeout", m.shutdownTimeout)
+	case runErr = <-m.errCh:
+		m.logger.Error("Component failed, stopping components", "error", runErr)
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), m.shutdownTimeout)
+	defer cancel()
+	return errors.Join(runErr, m.Stop(stopCtx))
+}
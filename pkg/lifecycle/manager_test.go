@@ -0,0 +1,208 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/logging"
+)
+
+func newTestManager(timeout time.Duration) *Manager {
+	return NewManager(timeout, logging.Discard())
+}
+
+// recorder collects the order in which hooks run
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) hook(name string) Hook {
+	return Hook{
+		Name: name,
+		OnStart: func(ctx context.Context) error {
+			r.add("start " + name)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			r.add("stop " + name)
+			return nil
+		},
+	}
+}
+
+func (r *recorder) add(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *recorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.calls, ", ")
+}
+
+// TestStartStopOrder tests that components stop in reverse start order
+func TestStartStopOrder(t *testing.T) {
+	m := newTestManager(time.Second)
+	rec := &recorder{}
+	m.Append(rec.hook("database"))
+	m.Append(rec.hook("workers"))
+	m.Append(rec.hook("http"))
+
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+
+	expected := "start database, start workers, start http, stop http, stop workers, stop database"
+	if got := rec.String(); got != expected {
+		t.Fatalf("Expected %q, got %q", expected, got)
+	}
+
+	t.Log("✓ Components stopped in reverse order")
+}
+
+// TestStartFailureRollsBack tests that a failed start stops started components
+func TestStartFailureRollsBack(t *testing.T) {
+	m := newTestManager(time.Second)
+	rec := &recorder{}
+	m.Append(rec.hook("database"))
+	m.Append(Hook{
+		Name:    "broken",
+		OnStart: func(ctx context.Context) error { return errors.New("boom") },
+		OnStop: func(ctx context.Context) error {
+			rec.add("stop broken")
+			return nil
+		},
+	})
+	m.Append(rec.hook("http"))
+
+	err := m.Start(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "failed to start broken") {
+		t.Fatalf("Expected start error, got %v", err)
+	}
+
+	expected := "start database, stop database"
+	if got := rec.String(); got != expected {
+		t.Fatalf("Expected %q, got %q", expected, got)
+	}
+
+	t.Log("✓ Started components rolled back")
+}
+
+// TestStopTimeout tests that a stuck component does not block the others
+func TestStopTimeout(t *testing.T) {
+	m := newTestManager(time.Second)
+	rec := &recorder{}
+	m.Append(rec.hook("database"))
+	m.Append(Hook{
+		Name: "stuck",
+		OnStop: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		},
+		Timeout: 20 * time.Millisecond,
+	})
+	m.Start(context.Background())
+
+	start := time.Now()
+	err := m.Stop(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "did not stop in time") {
+		t.Fatalf("Expected timeout error, got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("Stop waited for the stuck component")
+	}
+	if got := rec.String(); got != "start database, stop database" {
+		t.Fatalf("Expected database to stop after the stuck component, got %q", got)
+	}
+
+	t.Log("✓ Stuck components abandoned after their timeout")
+}
+
+// freeAddr returns a local address that is free to listen on
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve address: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// TestServerDrain tests that in-flight requests complete during shutdown
+func TestServerDrain(t *testing.T) {
+	m := newTestManager(time.Second)
+
+	requestStarted := make(chan struct{})
+	srv := &http.Server{
+		Addr: freeAddr(t),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(requestStarted)
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte("done"))
+		}),
+	}
+	m.AppendServer("http", srv, time.Second)
+
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	result := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + srv.Addr)
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		result <- string(body)
+	}()
+
+	<-requestStarted
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if got := <-result; got != "done" {
+		t.Fatalf("Expected in-flight request to complete, got %q", got)
+	}
+
+	t.Log("✓ In-flight requests drained")
+}
+
+// TestFailTriggersShutdown tests that a failing component stops Run
+func TestFailTriggersShutdown(t *testing.T) {
+	m := newTestManager(time.Second)
+	rec := &recorder{}
+	m.Append(rec.hook("database"))
+	m.Append(Hook{
+		Name: "server",
+		OnStart: func(ctx context.Context) error {
+			go m.Fail(errors.New("listener closed"))
+			return nil
+		},
+	})
+
+	err := m.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "listener closed") {
+		t.Fatalf("Expected run error, got %v", err)
+	}
+	if !strings.Contains(rec.String(), "stop database") {
+		t.Fatalf("Expected database to be stopped, got %q", rec.String())
+	}
+
+	t.Log("✓ Component failure stops the manager")
+}
@@ -0,0 +1,199 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Context keys under which correlation IDs are stored. They are plain strings
+// like the auth context keys so handlers can read them without this package.
+const (
+	RequestIDKey = "request_id"
+	SocketIDKey  = "socket_id"
+	userIDKey    = "user_id"
+)
+
+// RequestIDHeader carries the request ID on requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// Redacted replaces the value of sensitive attributes
+const Redacted = "[REDACTED]"
+
+// Format selects the log output encoding
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatText Format = "text"
+)
+
+// Config holds logger configuration
+type Config struct {
+	Level  slog.Level
+	Format Format
+}
+
+// ConfigFromEnv reads LOG_LEVEL (debug, info, warn, error) and LOG_FORMAT
+// (json, text). Unknown values fall back to info and JSON.
+func ConfigFromEnv() Config {
+	cfg := Config{Level: slog.LevelInfo, Format: FormatJSON}
+	if level := os.Getenv("LOG_LEVEL"); level != "" {
+		if err := cfg.Level.UnmarshalText([]byte(level)); err != nil {
+			cfg.Level = slog.LevelInfo
+		}
+	}
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), string(FormatText)) {
+		cfg.Format = FormatText
+	}
+	return cfg
+}
+
+// NewHandler creates a handler that writes to w, redacts secrets and adds the
+// correlation IDs found in the context of each record
+func NewHandler(w io.Writer, cfg Config) slog.Handler {
+	opts := &slog.HandlerOptions{Level: cfg.Level, ReplaceAttr: redactAttr}
+
+	var h slog.Handler
+	if cfg.Format == FormatText {
+		h = slog.NewTextHandler(w, opts)
+	} else {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	return &contextHandler{Handler: h}
+}
+
+// Setup installs a logger writing to stderr as the slog default. The standard
+// log package is routed through it too, so existing log.Printf calls are
+// emitted as structured records.
+func Setup(cfg Config) *slog.Logger {
+	logger := slog.New(NewHandler(os.Stderr, cfg))
+	slog.SetDefault(logger)
+	return logger
+}
+
+// Component returns the default logger tagged with a component name
+func Component(name string) *slog.Logger {
+	return slog.Default().With("component", name)
+}
+
+// LogLogger returns a *log.Logger for components that have not moved to slog.
+// Its output goes through the default handler, tagged with the component name.
+func LogLogger(name string) *log.Logger {
+	return slog.NewLogLogger(Component(name).Handler(), slog.LevelInfo)
+}
+
+// Discard returns a logger that drops every record
+func Discard() *slog.Logger {
+	return slog.New(discardHandler{})
+}
+
+// NewRequestID generates a request ID
+func NewRequestID() string {
+	return uuid.New().String()
+}
+
+// WithRequestID returns a context carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, RequestIDKey, id)
+}
+
+// RequestID returns the request ID carried by ctx, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(RequestIDKey).(string)
+	return id
+}
+
+// WithSocketID returns a context carrying a Socket.IO connection ID
+func WithSocketID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, SocketIDKey, id)
+}
+
+// contextHandler adds correlation IDs from the record context and scrubs
+// secrets from the message
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.Message = RedactString(r.Message)
+	if ctx != nil {
+		for _, key := range []string{RequestIDKey, SocketIDKey, userIDKey} {
+			if v, ok := ctx.Value(key).(string); ok && v != "" {
+				r.AddAttrs(slog.String(key, v))
+			}
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// discardHandler drops every record
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// sensitiveKeys are attribute keys whose values are never logged. Keys are
+// compared case-insensitively after removing separators.
+var sensitiveKeys = map[string]bool{
+	"password":      true,
+	"newpassword":   true,
+	"oldpassword":   true,
+	"passwordhash":  true,
+	"token":         true,
+	"accesstoken":   true,
+	"refreshtoken":  true,
+	"resettoken":    true,
+	"secret":        true,
+	"totpsecret":    true,
+	"backupcodes":   true,
+	"authorization": true,
+	"cookie":        true,
+}
+
+// IsSensitive reports whether an attribute key names a secret
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	key = strings.NewReplacer("_", "", "-", "", ".", "").Replace(key)
+	return sensitiveKeys[key]
+}
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if IsSensitive(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	if a.Value.Kind() == slog.KindString {
+		if s := a.Value.String(); s != RedactString(s) {
+			return slog.String(a.Key, RedactString(s))
+		}
+	}
+	return a
+}
+
+var (
+	secretAssignment = regexp.MustCompile(`(?i)\b(password|passwd|token|access_token|refresh_token|reset_token|secret|totp_secret)(["']?\s*[:=]\s*["']?)[^\s"',&]+`)
+	bearerToken      = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`)
+)
+
+// RedactString masks secrets embedded in free text, such as "token=abc" or
+// bearer credentials
+func RedactString(s string) string {
+	s = secretAssignment.ReplaceAllString(s, "${1}${2}"+Redacted)
+	return bearerToken.ReplaceAllString(s, "Bearer "+Redacted)
+}
@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func newTestLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(NewHandler(buf, Config{Level: slog.LevelDebug, Format: FormatJSON}))
+}
+
+// TestRequestIDFromContext tests that correlation IDs are added from the context
+func TestRequestIDFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newTestLogger(&buf)
+
+	ctx := WithSocketID(WithRequestID(context.Background(), "req-123"), "sock-1")
+	logger.InfoContext(ctx, "Recording started", "recording_id", "rec-1")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Failed to parse log record: %v", err)
+	}
+	if record[RequestIDKey] != "req-123" {
+		t.Errorf("Expected request_id req-123, got %v", record[RequestIDKey])
+	}
+	if record[SocketIDKey] != "sock-1" {
+		t.Errorf("Expected socket_id sock-1, got %v", record[SocketIDKey])
+	}
+	if RequestID(ctx) != "req-123" {
+		t.Errorf("Expected RequestID to return req-123, got %q", RequestID(ctx))
+	}
+
+	t.Log("✓ Correlation IDs added from context")
+}
+
+// TestRedaction tests that secrets are masked in attributes and messages
+func TestRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newTestLogger(&buf)
+
+	logger.Info("Password reset requested token=abc123",
+		"password", "hunter2",
+		"totp_secret", "JBSWY3DPEHPK3PXP",
+		"resetToken", "r3s3t",
+		"header", "Bearer eyJhbGciOiJIUzI1NiJ9.payload.sig",
+		"email", "student@example.com",
+	)
+
+	out := buf.String()
+	for _, secret := range []string{"abc123", "hunter2", "JBSWY3DPEHPK3PXP", "r3s3t", "eyJhbGciOiJIUzI1NiJ9"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("Secret %q leaked: %s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "student@example.com") {
+		t.Errorf("Non-sensitive attribute was redacted: %s", out)
+	}
+
+	t.Log("✓ Secrets redacted")
+}
+
+// TestConfigFromEnv tests level and format parsing
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("LOG_LEVEL", "debug")
+	t.Setenv("LOG_FORMAT", "text")
+
+	cfg := ConfigFromEnv()
+	if cfg.Level != slog.LevelDebug {
+		t.Errorf("Expected debug level, got %v", cfg.Level)
+	}
+	if cfg.Format != FormatText {
+		t.Errorf("Expected text format, got %v", cfg.Format)
+	}
+
+	t.Setenv("LOG_LEVEL", "verbose")
+	t.Setenv("LOG_FORMAT", "")
+	cfg = ConfigFromEnv()
+	if cfg.Level != slog.LevelInfo || cfg.Format != FormatJSON {
+		t.Errorf("Expected info/json defaults, got %v/%v", cfg.Level, cfg.Format)
+	}
+
+	t.Log("✓ Configuration parsed from environment")
+}
@@ -6,8 +6,11 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/Bashar444/VTP/pkg/auth"
+	"github.com/Bashar444/VTP/pkg/course"
 	"github.com/Bashar444/VTP/pkg/models"
-	"github.com/gorilla/mux"
+	"github.com/Bashar444/VTP/pkg/router"
+	"github.com/Bashar444/VTP/pkg/utils"
 )
 
 // Handler handles HTTP requests for study materials
@@ -20,6 +23,21 @@ func NewHandler(service *Service) *Handler {
 	return &Handler{service: service}
 }
 
+// RegisterRoutes registers study material routes. All routes require
+// authentication and are authorized against the material's course.
+func (h *Handler) RegisterRoutes(rt *router.Router, am *auth.AuthMiddleware, authz *course.CourseAuthorizer) {
+	api := rt.With(am.Middleware)
+	member := authz.Require(authz.MaterialScope("id"), course.MemberRoles...)
+	manage := authz.Require(authz.MaterialScope("id"), course.ManageRoles...)
+
+	api.HandleFunc("GET /api/v1/materials", h.ListMaterials, authz.Require(authz.CourseFromQuery("course_id"), course.MemberRoles...))
+	api.HandleFunc("POST /api/v1/materials", h.CreateMaterial, authz.Require(authz.CourseFromBody("course_id"), course.ManageRoles...))
+	api.HandleFunc("GET /api/v1/materials/{id}", h.GetMaterial, member)
+	api.HandleFunc("PUT /api/v1/materials/{id}", h.UpdateMaterial, manage)
+	api.HandleFunc("DELETE /api/v1/materials/{id}", h.DeleteMaterial, manage)
+	api.HandleFunc("GET /api/v1/materials/{id}/download", h.DownloadMaterial, member)
+}
+
 // CreateMaterialRequest represents the request to create a study material
 type CreateMaterialRequest struct {
 	CourseID     string `json:"course_id"`
@@ -55,7 +73,7 @@ type MaterialResponse struct {
 // CreateMaterial handles POST /api/v1/materials
 func (h *Handler) CreateMaterial(w http.ResponseWriter, r *http.Request) {
 	var req CreateMaterialRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := utils.DecodeJSON(r, &req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
@@ -80,8 +98,7 @@ func (h *Handler) CreateMaterial(w http.ResponseWriter, r *http.Request) {
 
 // GetMaterial handles GET /api/v1/materials/{id}
 func (h *Handler) GetMaterial(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id := r.PathValue("id")
 
 	material, err := h.service.GetMaterial(r.Context(), id)
 	if err != nil {
@@ -137,8 +154,7 @@ func (h *Handler) ListMaterials(w http.ResponseWriter, r *http.Request) {
 
 // UpdateMaterial handles PUT /api/v1/materials/{id}
 func (h *Handler) UpdateMaterial(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id := r.PathValue("id")
 
 	var req UpdateMaterialRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -169,8 +185,7 @@ func (h *Handler) UpdateMaterial(w http.ResponseWriter, r *http.Request) {
 
 // DeleteMaterial handles DELETE /api/v1/materials/{id}
 func (h *Handler) DeleteMaterial(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id := r.PathValue("id")
 
 	if err := h.service.DeleteMaterial(r.Context(), id); err != nil {
 		if err == ErrMaterialNotFound {
@@ -186,8 +201,7 @@ func (h *Handler) DeleteMaterial(w http.ResponseWriter, r *http.Request) {
 
 // DownloadMaterial handles GET /api/v1/materials/{id}/download
 func (h *Handler) DownloadMaterial(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id := r.PathValue("id")
 
 	material, err := h.service.GetMaterial(r.Context(), id)
 	if err != nil {
@@ -90,6 +90,7 @@ type DtlsFingerprint struct {
 type Producer struct {
 	ID            string      `json:"id"`
 	Kind          string      `json:"kind"`
+	Source        string      `json:"source,omitempty"`
 	RtpParameters interface{} `json:"rtpParameters"`
 }
 
@@ -141,10 +142,12 @@ type TransportConnectRequest struct {
 	DtlsParameters DtlsParameters `json:"dtlsParameters"`
 }
 
-// ProducerRequest for creating a producer
+// ProducerRequest for creating a producer. Source tells a screen share
+// (screen) apart from a camera or microphone.
 type ProducerRequest struct {
 	PeerID        string      `json:"peerId"`
 	Kind          string      `json:"kind"`
+	Source        string      `json:"source,omitempty"`
 	RtpParameters interface{} `json:"rtpParameters"`
 }
 
@@ -155,6 +158,50 @@ type ConsumerRequest struct {
 	RtpCapabilities interface{} `json:"rtpCapabilities"`
 }
 
+// ProducerInfo describes a producer in a room
+type ProducerInfo struct {
+	ID        string `json:"id"`
+	PeerID    string `json:"peerId"`
+	UserID    string `json:"userId"`
+	FullName  string `json:"fullName,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Kind      string `json:"kind"`
+	Source    string `json:"source,omitempty"` // camera, screen or mic
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// ProducersList contains the producers in a room
+type ProducersList struct {
+	RoomID    string         `json:"roomId"`
+	Producers []ProducerInfo `json:"producers"`
+}
+
+// PlainTransport represents a plain RTP transport. IP and Port are where the
+// SFU sends from; RTCPPort is set because RTCP is not multiplexed.
+type PlainTransport struct {
+	TransportID string `json:"transportId"`
+	IP          string `json:"ip"`
+	Port        int    `json:"port"`
+	RTCPPort    int    `json:"rtcpPort,omitempty"`
+}
+
+// PlainTransportConnectRequest tells a plain transport where to send RTP
+// and RTCP
+type PlainTransportConnectRequest struct {
+	IP       string `json:"ip"`
+	Port     int    `json:"port"`
+	RTCPPort int    `json:"rtcpPort,omitempty"`
+}
+
+// PlainConsumer is a consumer on a plain transport. Its RTP parameters give
+// the payload type and SSRC of the stream the receiver gets.
+type PlainConsumer struct {
+	ID            string        `json:"id"`
+	ProducerID    string        `json:"producerId"`
+	Kind          string        `json:"kind"`
+	RtpParameters RtpParameters `json:"rtpParameters"`
+}
+
 // Health check response
 type HealthResponse struct {
 	Status    string `json:"status"`
@@ -337,3 +384,71 @@ func (c *Client) LeaveRoom(roomID, peerId string) error {
 	_, err := c.request("POST", fmt.Sprintf("/rooms/%s/peers/%s/leave", roomID, peerId), nil)
 	return err
 }
+
+// GetProducers lists the producers in a room
+func (c *Client) GetProducers(roomID string) ([]ProducerInfo, error) {
+	data, err := c.request("GET", fmt.Sprintf("/rooms/%s/producers", roomID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var list ProducersList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+
+	return list.Producers, nil
+}
+
+// CreatePlainTransport creates a plain RTP transport for a server-side
+// receiver
+func (c *Client) CreatePlainTransport(roomID string) (*PlainTransport, error) {
+	data, err := c.request("POST", fmt.Sprintf("/rooms/%s/plain-transports", roomID), map[string]string{})
+	if err != nil {
+		return nil, err
+	}
+
+	var transport PlainTransport
+	if err := json.Unmarshal(data, &transport); err != nil {
+		return nil, err
+	}
+
+	return &transport, nil
+}
+
+// ConnectPlainTransport sets the address a plain transport sends to
+func (c *Client) ConnectPlainTransport(roomID, transportID string, req *PlainTransportConnectRequest) error {
+	_, err := c.request("POST", fmt.Sprintf("/rooms/%s/plain-transports/%s/connect", roomID, transportID), req)
+	return err
+}
+
+// ConsumePlain creates a paused consumer for a producer on a plain transport
+func (c *Client) ConsumePlain(roomID, transportID, producerID string) (*PlainConsumer, error) {
+	req := map[string]string{
+		"producerId": producerID,
+	}
+
+	data, err := c.request("POST", fmt.Sprintf("/rooms/%s/plain-transports/%s/consumers", roomID, transportID), req)
+	if err != nil {
+		return nil, err
+	}
+
+	var consumer PlainConsumer
+	if err := json.Unmarshal(data, &consumer); err != nil {
+		return nil, err
+	}
+
+	return &consumer, nil
+}
+
+// ResumePlainConsumer starts sending a plain consumer's stream
+func (c *Client) ResumePlainConsumer(roomID, transportID, consumerID string) error {
+	_, err := c.request("POST", fmt.Sprintf("/rooms/%s/plain-transports/%s/consumers/%s/resume", roomID, transportID, consumerID), nil)
+	return err
+}
+
+// ClosePlainTransport closes a plain transport and its consumers
+func (c *Client) ClosePlainTransport(roomID, transportID string) error {
+	_, err := c.request("POST", fmt.Sprintf("/rooms/%s/plain-transports/%s/close", roomID, transportID), nil)
+	return err
+}
@@ -1,6 +1,7 @@
 package mediasoup
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -268,3 +269,64 @@ func TestCloseConsumer(t *testing.T) {
 		t.Errorf("CloseConsumer failed: %v", err)
 	}
 }
+
+func TestPlainTransportConsumer(t *testing.T) {
+	roomID := "test-room"
+	var connected, resumed bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /rooms/test-room/plain-transports", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"transportId":"transport-1","ip":"127.0.0.1","port":40000,"rtcpPort":40001}`)
+	})
+	mux.HandleFunc("POST /rooms/test-room/plain-transports/transport-1/connect", func(w http.ResponseWriter, r *http.Request) {
+		var req PlainTransportConnectRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.IP != "127.0.0.1" || req.Port != 50000 || req.RTCPPort != 50001 {
+			t.Errorf("Unexpected connect request: %+v", req)
+		}
+		connected = true
+		fmt.Fprintf(w, `{"success":true}`)
+	})
+	mux.HandleFunc("POST /rooms/test-room/plain-transports/transport-1/consumers", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{
+			"id":"consumer-1",
+			"producerId":"producer-1",
+			"kind":"video",
+			"rtpParameters":{"codecs":[{"mimeType":"video/VP8","payloadType":101,"clockRate":90000}],"encodings":[{"ssrc":1234}]}
+		}`)
+	})
+	mux.HandleFunc("POST /rooms/test-room/plain-transports/transport-1/consumers/consumer-1/resume", func(w http.ResponseWriter, r *http.Request) {
+		resumed = true
+		fmt.Fprintf(w, `{"success":true}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	transport, err := client.CreatePlainTransport(roomID)
+	if err != nil {
+		t.Fatalf("CreatePlainTransport failed: %v", err)
+	}
+	if transport.TransportID != "transport-1" || transport.RTCPPort != 40001 {
+		t.Errorf("Unexpected transport: %+v", transport)
+	}
+
+	err = client.ConnectPlainTransport(roomID, transport.TransportID, &PlainTransportConnectRequest{IP: "127.0.0.1", Port: 50000, RTCPPort: 50001})
+	if err != nil || !connected {
+		t.Fatalf("ConnectPlainTransport failed: %v", err)
+	}
+
+	consumer, err := client.ConsumePlain(roomID, transport.TransportID, "producer-1")
+	if err != nil {
+		t.Fatalf("ConsumePlain failed: %v", err)
+	}
+	if len(consumer.RtpParameters.Codecs) != 1 || consumer.RtpParameters.Codecs[0].PayloadType != 101 {
+		t.Errorf("Unexpected codecs: %+v", consumer.RtpParameters.Codecs)
+	}
+	if consumer.RtpParameters.Encodings[0].SSRC != 1234 {
+		t.Errorf("Expected SSRC 1234, got %d", consumer.RtpParameters.Encodings[0].SSRC)
+	}
+
+	if err := client.ResumePlainConsumer(roomID, transport.TransportID, consumer.ID); err != nil || !resumed {
+		t.Errorf("ResumePlainConsumer failed: %v", err)
+	}
+}
@@ -6,8 +6,11 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/Bashar444/VTP/pkg/auth"
+	"github.com/Bashar444/VTP/pkg/course"
 	"github.com/Bashar444/VTP/pkg/models"
-	"github.com/gorilla/mux"
+	"github.com/Bashar444/VTP/pkg/router"
+	"github.com/Bashar444/VTP/pkg/utils"
 )
 
 // Handler handles HTTP requests for meetings
@@ -20,8 +23,27 @@ func NewHandler(service *Service) *Handler {
 	return &Handler{service: service}
 }
 
-// CreateMeetingRequest represents the request to create a meeting
+// RegisterRoutes registers meeting routes. All routes require authentication
+// and are authorized against the meeting's course.
+func (h *Handler) RegisterRoutes(rt *router.Router, am *auth.AuthMiddleware, authz *course.CourseAuthorizer) {
+	api := rt.With(am.Middleware)
+	member := authz.Require(authz.MeetingScope("id"), course.MemberRoles...)
+	manage := authz.Require(authz.MeetingScope("id"), course.ManageRoles...)
+
+	api.HandleFunc("GET /api/v1/meetings", h.ListMeetings, authz.Require(authz.CourseFromQuery("course_id"), course.MemberRoles...))
+	api.HandleFunc("POST /api/v1/meetings", h.CreateMeeting, authz.Require(authz.CourseFromBody("course_id"), course.ManageRoles...))
+	api.HandleFunc("GET /api/v1/meetings/{id}", h.GetMeeting, member)
+	api.HandleFunc("GET /api/v1/meetings/{id}/series", h.GetMeetingSeries, member)
+	api.HandleFunc("PUT /api/v1/meetings/{id}", h.UpdateMeeting, manage)
+	api.HandleFunc("DELETE /api/v1/meetings/{id}", h.DeleteMeeting, manage)
+	api.HandleFunc("POST /api/v1/meetings/{id}/cancel", h.CancelMeeting, manage)
+	api.HandleFunc("POST /api/v1/meetings/{id}/complete", h.CompleteMeeting, manage)
+}
+
+// CreateMeetingRequest represents the request to create a meeting. Setting
+// RRule creates a recurring meeting first held at ScheduledAt.
 type CreateMeetingRequest struct {
+	CourseID     string    `json:"course_id"`
 	InstructorID string    `json:"instructor_id"`
 	StudentID    string    `json:"student_id"`
 	SubjectID    string    `json:"subject_id"`
@@ -30,6 +52,11 @@ type CreateMeetingRequest struct {
 	Duration     int       `json:"duration"`
 	MeetingURL   string    `json:"meeting_url"`
 	RoomID       string    `json:"room_id"`
+
+	RRule          string      `json:"rrule"`           // RFC 5545 recurrence rule
+	Timezone       string      `json:"timezone"`        // defaults to Asia/Damascus
+	ExDates        []time.Time `json:"exdates"`         // occurrences to skip
+	IncludeWeekend bool        `json:"include_weekend"` // keep Friday and Saturday occurrences
 }
 
 // UpdateMeetingRequest represents the request to update a meeting
@@ -40,34 +67,74 @@ type UpdateMeetingRequest struct {
 	MeetingURL  string    `json:"meeting_url"`
 	RoomID      string    `json:"room_id"`
 	Status      string    `json:"status"`
+
+	// Only used when editing the following or all occurrences of a series
+	RRule          string `json:"rrule"`
+	IncludeWeekend bool   `json:"include_weekend"`
 }
 
 // MeetingResponse represents the meeting response
 type MeetingResponse struct {
-	ID           string     `json:"id"`
-	InstructorID string     `json:"instructor_id"`
-	StudentID    string     `json:"student_id"`
-	SubjectID    string     `json:"subject_id"`
-	TitleAr      string     `json:"title_ar"`
-	ScheduledAt  time.Time  `json:"scheduled_at"`
-	Duration     int        `json:"duration"`
-	MeetingURL   string     `json:"meeting_url"`
-	RoomID       string     `json:"room_id"`
-	Status       string     `json:"status"`
-	EndTime      *time.Time `json:"end_time"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
+	ID            string     `json:"id"`
+	CourseID      string     `json:"course_id"`
+	InstructorID  string     `json:"instructor_id"`
+	StudentID     string     `json:"student_id"`
+	SubjectID     string     `json:"subject_id"`
+	TitleAr       string     `json:"title_ar"`
+	ScheduledAt   time.Time  `json:"scheduled_at"`
+	Duration      int        `json:"duration"`
+	MeetingURL    string     `json:"meeting_url"`
+	RoomID        string     `json:"room_id"`
+	Status        string     `json:"status"`
+	EndTime       *time.Time `json:"end_time"`
+	SeriesID      string     `json:"series_id,omitempty"`
+	OriginalStart *time.Time `json:"original_start,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// SeriesResponse represents a recurring meeting
+type SeriesResponse struct {
+	ID           string      `json:"id"`
+	CourseID     string      `json:"course_id"`
+	InstructorID string      `json:"instructor_id"`
+	StudentID    string      `json:"student_id"`
+	SubjectID    string      `json:"subject_id"`
+	TitleAr      string      `json:"title_ar"`
+	StartsAt     time.Time   `json:"starts_at"`
+	Duration     int         `json:"duration"`
+	Timezone     string      `json:"timezone"`
+	RRule        string      `json:"rrule"`
+	ExDates      []time.Time `json:"exdates"`
+	MeetingURL   string      `json:"meeting_url"`
+	RoomID       string      `json:"room_id"`
+	Status       string      `json:"status"`
+}
+
+// SeriesChangeResponse represents a recurring meeting after it was created
+// or edited, with the occurrences created and those skipped because the
+// instructor had another meeting
+type SeriesChangeResponse struct {
+	Series    SeriesResponse    `json:"series"`
+	Meetings  []MeetingResponse `json:"meetings"`
+	Conflicts []time.Time       `json:"conflicts"`
 }
 
 // CreateMeeting handles POST /api/v1/meetings
 func (h *Handler) CreateMeeting(w http.ResponseWriter, r *http.Request) {
 	var req CreateMeetingRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := utils.DecodeJSON(r, &req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
+	if req.RRule != "" {
+		h.createSeries(w, r, &req)
+		return
+	}
+
 	meeting := &models.Meeting{
+		CourseID:     req.CourseID,
 		InstructorID: req.InstructorID,
 		StudentID:    req.StudentID,
 		SubjectID:    req.SubjectID,
@@ -91,10 +158,34 @@ func (h *Handler) CreateMeeting(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusCreated, toMeetingResponse(meeting))
 }
 
+func (h *Handler) createSeries(w http.ResponseWriter, r *http.Request, req *CreateMeetingRequest) {
+	series := &models.MeetingSeries{
+		CourseID:     req.CourseID,
+		InstructorID: req.InstructorID,
+		StudentID:    req.StudentID,
+		SubjectID:    req.SubjectID,
+		TitleAr:      req.TitleAr,
+		StartsAt:     req.ScheduledAt,
+		Duration:     req.Duration,
+		Timezone:     req.Timezone,
+		RRule:        req.RRule,
+		ExDates:      req.ExDates,
+		MeetingURL:   req.MeetingURL,
+		RoomID:       req.RoomID,
+	}
+
+	result, err := h.service.CreateSeries(r.Context(), series, req.IncludeWeekend)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, toSeriesChangeResponse(series, result))
+}
+
 // GetMeeting handles GET /api/v1/meetings/{id}
 func (h *Handler) GetMeeting(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id := r.PathValue("id")
 
 	meeting, err := h.service.GetMeeting(r.Context(), id)
 	if err != nil {
@@ -109,17 +200,49 @@ func (h *Handler) GetMeeting(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, toMeetingResponse(meeting))
 }
 
+// GetMeetingSeries handles GET /api/v1/meetings/{id}/series
+func (h *Handler) GetMeetingSeries(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	meeting, err := h.service.GetMeeting(r.Context(), id)
+	if err != nil {
+		if err == ErrMeetingNotFound {
+			respondError(w, http.StatusNotFound, "Meeting not found")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if meeting.SeriesID == "" {
+		respondError(w, http.StatusNotFound, "Meeting is not part of a series")
+		return
+	}
+
+	series, err := h.service.GetSeries(r.Context(), meeting.SeriesID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, toSeriesResponse(series))
+}
+
 // ListMeetings handles GET /api/v1/meetings
 func (h *Handler) ListMeetings(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
 	page, _ := strconv.Atoi(query.Get("page"))
 	pageSize, _ := strconv.Atoi(query.Get("page_size"))
+	courseID := query.Get("course_id")
 	instructorID := query.Get("instructor_id")
 	studentID := query.Get("student_id")
 	subjectID := query.Get("subject_id")
 	status := query.Get("status")
+	seriesID := query.Get("series_id")
 
 	filters := map[string]interface{}{}
+	if courseID != "" {
+		filters["course_id"] = courseID
+	}
 	if instructorID != "" {
 		filters["instructor_id"] = instructorID
 	}
@@ -132,6 +255,19 @@ func (h *Handler) ListMeetings(w http.ResponseWriter, r *http.Request) {
 	if status != "" {
 		filters["status"] = status
 	}
+	if seriesID != "" {
+		filters["series_id"] = seriesID
+	}
+	for _, name := range []string{"from_date", "to_date"} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				respondError(w, http.StatusBadRequest, "Invalid "+name)
+				return
+			}
+			filters[name] = t
+		}
+	}
 
 	meetings, err := h.service.ListMeetings(r.Context(), filters, page, pageSize)
 	if err != nil {
@@ -152,10 +288,11 @@ func (h *Handler) ListMeetings(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// UpdateMeeting handles PUT /api/v1/meetings/{id}
+// UpdateMeeting handles PUT /api/v1/meetings/{id}. For an occurrence of a
+// recurring meeting, ?scope=following or ?scope=all also edits the
+// occurrences after it or the whole series.
 func (h *Handler) UpdateMeeting(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id := r.PathValue("id")
 
 	var req UpdateMeetingRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -163,6 +300,11 @@ func (h *Handler) UpdateMeeting(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if scope := r.URL.Query().Get("scope"); scope != "" && scope != ScopeThis {
+		h.updateOccurrences(w, r, id, scope, &req)
+		return
+	}
+
 	meeting := &models.Meeting{
 		ID:          id,
 		TitleAr:     req.TitleAr,
@@ -190,10 +332,33 @@ func (h *Handler) UpdateMeeting(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, toMeetingResponse(updated))
 }
 
+func (h *Handler) updateOccurrences(w http.ResponseWriter, r *http.Request, id, scope string, req *UpdateMeetingRequest) {
+	update := &SeriesUpdate{
+		TitleAr:        req.TitleAr,
+		ScheduledAt:    req.ScheduledAt,
+		Duration:       req.Duration,
+		MeetingURL:     req.MeetingURL,
+		RoomID:         req.RoomID,
+		RRule:          req.RRule,
+		IncludeWeekend: req.IncludeWeekend,
+	}
+
+	series, result, err := h.service.UpdateOccurrences(r.Context(), id, scope, update)
+	if err != nil {
+		if err == ErrMeetingNotFound {
+			respondError(w, http.StatusNotFound, "Meeting not found")
+			return
+		}
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, toSeriesChangeResponse(series, result))
+}
+
 // DeleteMeeting handles DELETE /api/v1/meetings/{id}
 func (h *Handler) DeleteMeeting(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id := r.PathValue("id")
 
 	if err := h.service.DeleteMeeting(r.Context(), id); err != nil {
 		if err == ErrMeetingNotFound {
@@ -207,12 +372,13 @@ func (h *Handler) DeleteMeeting(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Meeting deleted successfully"})
 }
 
-// CancelMeeting handles POST /api/v1/meetings/{id}/cancel
+// CancelMeeting handles POST /api/v1/meetings/{id}/cancel. For an
+// occurrence of a recurring meeting, ?scope=following or ?scope=all also
+// cancels the occurrences after it or the whole series.
 func (h *Handler) CancelMeeting(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id := r.PathValue("id")
 
-	if err := h.service.CancelMeeting(r.Context(), id); err != nil {
+	if err := h.service.CancelOccurrences(r.Context(), id, r.URL.Query().Get("scope")); err != nil {
 		if err == ErrMeetingNotFound {
 			respondError(w, http.StatusNotFound, "Meeting not found")
 			return
@@ -227,8 +393,7 @@ func (h *Handler) CancelMeeting(w http.ResponseWriter, r *http.Request) {
 
 // CompleteMeeting handles POST /api/v1/meetings/{id}/complete
 func (h *Handler) CompleteMeeting(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id := r.PathValue("id")
 
 	if err := h.service.CompleteMeeting(r.Context(), id); err != nil {
 		if err == ErrMeetingNotFound {
@@ -246,19 +411,61 @@ func (h *Handler) CompleteMeeting(w http.ResponseWriter, r *http.Request) {
 // Helper functions
 func toMeetingResponse(meeting *models.Meeting) MeetingResponse {
 	return MeetingResponse{
-		ID:           meeting.ID,
-		InstructorID: meeting.InstructorID,
-		StudentID:    meeting.StudentID,
-		SubjectID:    meeting.SubjectID,
-		TitleAr:      meeting.TitleAr,
-		ScheduledAt:  meeting.ScheduledAt,
-		Duration:     meeting.Duration,
-		MeetingURL:   meeting.MeetingURL,
-		RoomID:       meeting.RoomID,
-		Status:       meeting.Status,
-		EndTime:      meeting.EndTime,
-		CreatedAt:    meeting.CreatedAt,
-		UpdatedAt:    meeting.UpdatedAt,
+		ID:            meeting.ID,
+		CourseID:      meeting.CourseID,
+		InstructorID:  meeting.InstructorID,
+		StudentID:     meeting.StudentID,
+		SubjectID:     meeting.SubjectID,
+		TitleAr:       meeting.TitleAr,
+		ScheduledAt:   meeting.ScheduledAt,
+		Duration:      meeting.Duration,
+		MeetingURL:    meeting.MeetingURL,
+		RoomID:        meeting.RoomID,
+		Status:        meeting.Status,
+		EndTime:       meeting.EndTime,
+		SeriesID:      meeting.SeriesID,
+		OriginalStart: meeting.OriginalStart,
+		CreatedAt:     meeting.CreatedAt,
+		UpdatedAt:     meeting.UpdatedAt,
+	}
+}
+
+func toSeriesResponse(series *models.MeetingSeries) SeriesResponse {
+	exdates := series.ExDates
+	if exdates == nil {
+		exdates = []time.Time{}
+	}
+	return SeriesResponse{
+		ID:           series.ID,
+		CourseID:     series.CourseID,
+		InstructorID: series.InstructorID,
+		StudentID:    series.StudentID,
+		SubjectID:    series.SubjectID,
+		TitleAr:      series.TitleAr,
+		StartsAt:     series.StartsAt,
+		Duration:     series.Duration,
+		Timezone:     series.Timezone,
+		RRule:        series.RRule,
+		ExDates:      exdates,
+		MeetingURL:   series.MeetingURL,
+		RoomID:       series.RoomID,
+		Status:       series.Status,
+	}
+}
+
+func toSeriesChangeResponse(series *models.MeetingSeries, result *Materialized) SeriesChangeResponse {
+	meetings := make([]MeetingResponse, len(result.Meetings))
+	for i, meeting := range result.Meetings {
+		meetings[i] = toMeetingResponse(meeting)
+	}
+	conflicts := result.Conflicts
+	if conflicts == nil {
+		conflicts = []time.Time{}
+	}
+	return SeriesChangeResponse{
+		Series:    toSeriesResponse(series),
+		Meetings:  meetings,
+		Conflicts: conflicts,
 	}
 }
 
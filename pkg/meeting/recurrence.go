@@ -0,0 +1,239 @@
+package meeting
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence frequencies
+const (
+	FreqDaily  = "DAILY"
+	FreqWeekly = "WEEKLY"
+)
+
+// ErrUnsupportedRecurrence is returned for valid RFC 5545 rules using parts
+// meeting series do not support
+var ErrUnsupportedRecurrence = errors.New("unsupported recurrence rule")
+
+const untilLayout = "20060102T150405Z"
+
+var weekdayCodes = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Recurrence is the subset of an RFC 5545 RRULE used by meeting series:
+// daily or weekly repetition on given days, ending on a date or after a
+// number of meetings
+type Recurrence struct {
+	Freq      string         // DAILY or WEEKLY
+	Interval  int            // every Interval days or weeks
+	ByDay     []time.Weekday // empty means every day, or the first meeting's day for weekly rules
+	Until     time.Time      // last possible start, zero for none
+	Count     int            // number of meetings, 0 for none
+	WeekStart time.Weekday   // first day of the week for weekly intervals
+}
+
+// ParseRecurrence parses an RRULE, with or without the "RRULE:" prefix.
+// Floating and date-only UNTIL values are read in loc.
+func ParseRecurrence(rule string, loc *time.Location) (*Recurrence, error) {
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+	if rule == "" {
+		return nil, fmt.Errorf("recurrence rule is empty")
+	}
+
+	r := &Recurrence{Interval: 1, WeekStart: time.Monday}
+	for _, part := range strings.Split(rule, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid recurrence rule part %q", part)
+		}
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(value)
+			if r.Freq != FreqDaily && r.Freq != FreqWeekly {
+				return nil, fmt.Errorf("%w: FREQ=%s", ErrUnsupportedRecurrence, value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid COUNT %q", value)
+			}
+			r.Count = n
+		case "UNTIL":
+			until, err := parseUntil(value, loc)
+			if err != nil {
+				return nil, err
+			}
+			r.Until = until
+		case "BYDAY":
+			r.ByDay = r.ByDay[:0]
+			for _, code := range strings.Split(value, ",") {
+				day, err := parseWeekday(code)
+				if err != nil {
+					return nil, err
+				}
+				r.ByDay = append(r.ByDay, day)
+			}
+		case "WKST":
+			day, err := parseWeekday(value)
+			if err != nil {
+				return nil, err
+			}
+			r.WeekStart = day
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedRecurrence, name)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, fmt.Errorf("recurrence rule has no FREQ")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, fmt.Errorf("recurrence rule cannot have both COUNT and UNTIL")
+	}
+	return r, nil
+}
+
+func parseUntil(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(untilLayout, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102T150405", value, loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102", value, loc); err == nil {
+		// A date includes meetings held on that day
+		return t.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL %q", value)
+}
+
+func parseWeekday(code string) (time.Weekday, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	for i, c := range weekdayCodes {
+		if c == code {
+			return time.Weekday(i), nil
+		}
+	}
+	if len(code) > 2 {
+		// Ordinal days such as 1MO only apply to monthly and yearly rules
+		return 0, fmt.Errorf("%w: BYDAY=%s", ErrUnsupportedRecurrence, code)
+	}
+	return 0, fmt.Errorf("invalid weekday %q", code)
+}
+
+// String formats the rule as an RRULE value, without the "RRULE:" prefix
+func (r *Recurrence) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		codes := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			codes[i] = weekdayCodes[day]
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayout))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+weekdayCodes[r.WeekStart])
+	}
+	return strings.Join(parts, ";")
+}
+
+// days returns the weekdays a series first held at start meets on
+func (r *Recurrence) days(start time.Time) map[time.Weekday]bool {
+	days := make(map[time.Weekday]bool)
+	switch {
+	case len(r.ByDay) > 0:
+		for _, day := range r.ByDay {
+			days[day] = true
+		}
+	case r.Freq == FreqWeekly:
+		days[start.Weekday()] = true
+	default:
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			days[day] = true
+		}
+	}
+	return days
+}
+
+// Exclude removes days from the rule, rewriting BYDAY so the rule stays a
+// plain RRULE other calendars understand. It fails when no day is left.
+func (r *Recurrence) Exclude(start time.Time, excluded ...time.Weekday) error {
+	days := r.days(start)
+	changed := false
+	for _, day := range excluded {
+		if days[day] {
+			delete(days, day)
+			changed = true
+		}
+	}
+	if len(days) == 0 {
+		return fmt.Errorf("recurrence rule only falls on excluded days")
+	}
+	if !changed {
+		return nil
+	}
+
+	r.ByDay = r.ByDay[:0]
+	for i := 0; i < 7; i++ {
+		if day := (r.WeekStart + time.Weekday(i)) % 7; days[day] {
+			r.ByDay = append(r.ByDay, day)
+		}
+	}
+	return nil
+}
+
+// Occurrences returns the starts from..to (exclusive) of a series first
+// held at start. Starts keep start's wall clock time in its location, so
+// meetings do not move with daylight saving changes. COUNT counts from
+// start whatever from is.
+func (r *Recurrence) Occurrences(start, from, to time.Time) []time.Time {
+	days := r.days(start)
+	interval := max(r.Interval, 1)
+	loc := start.Location()
+	year, month, day := start.Date()
+	hour, minute, sec := start.Clock()
+
+	// Weekly intervals count whole weeks from the week of the first meeting
+	period, first := 1, 0
+	if r.Freq == FreqWeekly {
+		period = 7
+		first = -int((start.Weekday() - r.WeekStart + 7) % 7)
+	}
+
+	var starts []time.Time
+	held := 0
+	for offset := first; ; offset++ {
+		t := time.Date(year, month, day+offset, hour, minute, sec, 0, loc)
+		if !t.Before(to) || (!r.Until.IsZero() && t.After(r.Until)) {
+			break
+		}
+		if t.Before(start) || !days[t.Weekday()] || ((offset-first)/period)%interval != 0 {
+			continue
+		}
+		held++
+		if r.Count > 0 && held > r.Count {
+			break
+		}
+		if !t.Before(from) {
+			starts = append(starts, t)
+		}
+	}
+	return starts
+}
@@ -0,0 +1,156 @@
+package meeting
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("Time zone %s not available: %v", name, err)
+	}
+	return loc
+}
+
+func formatStarts(starts []time.Time) []string {
+	out := make([]string, len(starts))
+	for i, start := range starts {
+		out[i] = start.Format("Mon 2006-01-02 15:04")
+	}
+	return out
+}
+
+func expectStarts(t *testing.T, got []time.Time, want ...string) {
+	t.Helper()
+	formatted := formatStarts(got)
+	if len(formatted) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, formatted)
+	}
+	for i := range want {
+		if formatted[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, formatted)
+		}
+	}
+}
+
+// TestRecurrenceOccurrences tests weekly rules ending after a count or on
+// a date
+func TestRecurrenceOccurrences(t *testing.T) {
+	loc := mustLocation(t, DefaultTimezone)
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, loc) // a Sunday
+	far := start.AddDate(1, 0, 0)
+
+	rule, err := ParseRecurrence("RRULE:FREQ=WEEKLY;BYDAY=SU,TU,TH;COUNT=5", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStarts(t, rule.Occurrences(start, start, far),
+		"Sun 2026-10-18 09:00", "Tue 2026-10-20 09:00", "Thu 2026-10-22 09:00",
+		"Sun 2026-10-25 09:00", "Tue 2026-10-27 09:00")
+
+	// COUNT counts from the first meeting, not from the window
+	expectStarts(t, rule.Occurrences(start, start.AddDate(0, 0, 5), far),
+		"Sun 2026-10-25 09:00", "Tue 2026-10-27 09:00")
+
+	// Weeks start on Monday, so the Monday after the first meeting falls in
+	// the second week. A date-only UNTIL includes meetings on that day.
+	rule, err = ParseRecurrence("FREQ=WEEKLY;INTERVAL=2;BYDAY=MO;UNTIL=20261109", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStarts(t, rule.Occurrences(start, start, far),
+		"Mon 2026-10-26 09:00", "Mon 2026-11-09 09:00")
+
+	// Without BYDAY a weekly rule meets on the first meeting's day
+	rule, _ = ParseRecurrence("FREQ=WEEKLY", loc)
+	expectStarts(t, rule.Occurrences(start, start, start.AddDate(0, 0, 15)),
+		"Sun 2026-10-18 09:00", "Sun 2026-10-25 09:00", "Sun 2026-11-01 09:00")
+
+	t.Log("✓ Weekly rules expanded")
+}
+
+// TestRecurrenceKeepsWallClock tests that meetings keep their local time
+// across a daylight saving change
+func TestRecurrenceKeepsWallClock(t *testing.T) {
+	loc := mustLocation(t, "Europe/Berlin")
+	start := time.Date(2026, 10, 21, 16, 30, 0, 0, loc)
+
+	rule, _ := ParseRecurrence("FREQ=WEEKLY;COUNT=2", loc)
+	starts := rule.Occurrences(start, start, start.AddDate(0, 1, 0))
+	expectStarts(t, starts, "Wed 2026-10-21 16:30", "Wed 2026-10-28 16:30")
+	if gap := starts[1].Sub(starts[0]); gap != 7*24*time.Hour+time.Hour {
+		t.Errorf("Expected the clock change between meetings, got %s", gap)
+	}
+
+	t.Log("✓ Local time kept across daylight saving")
+}
+
+// TestRecurrenceExcludesWeekend tests that the weekend is written out of
+// rules and that a first meeting on the weekend moves to a school day
+func TestRecurrenceExcludesWeekend(t *testing.T) {
+	loc := mustLocation(t, DefaultTimezone)
+	saturday := time.Date(2026, 10, 24, 10, 0, 0, 0, loc)
+
+	rule, start, err := prepareRule("FREQ=DAILY;COUNT=6", DefaultTimezone, saturday, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rule.String(); got != "FREQ=DAILY;BYDAY=MO,TU,WE,TH,SU;COUNT=6" {
+		t.Errorf("Unexpected rule %s", got)
+	}
+	expectStarts(t, rule.Occurrences(start, start, start.AddDate(0, 1, 0)),
+		"Sun 2026-10-25 10:00", "Mon 2026-10-26 10:00", "Tue 2026-10-27 10:00",
+		"Wed 2026-10-28 10:00", "Thu 2026-10-29 10:00", "Sun 2026-11-01 10:00")
+
+	// Series can opt back into the weekend
+	rule, start, _ = prepareRule("FREQ=DAILY;COUNT=2", DefaultTimezone, saturday, true)
+	if rule.String() != "FREQ=DAILY;COUNT=2" || !start.Equal(saturday) {
+		t.Errorf("Weekend left out of %s starting %s", rule, start)
+	}
+
+	if _, _, err := prepareRule("FREQ=WEEKLY;BYDAY=FR,SA", DefaultTimezone, saturday, false); err == nil {
+		t.Error("Expected an error for a rule held only on the weekend")
+	}
+
+	t.Log("✓ Syrian weekend left out by default")
+}
+
+// TestParseRecurrenceErrors tests rules meeting series reject
+func TestParseRecurrenceErrors(t *testing.T) {
+	tests := []struct {
+		rule        string
+		unsupported bool
+	}{
+		{"", false},
+		{"BYDAY=MO", false},
+		{"FREQ=WEEKLY;COUNT=0", false},
+		{"FREQ=WEEKLY;COUNT=3;UNTIL=20261231T000000Z", false},
+		{"FREQ=WEEKLY;BYDAY=XX", false},
+		{"FREQ=MONTHLY", true},
+		{"FREQ=WEEKLY;BYDAY=1MO", true},
+		{"FREQ=WEEKLY;BYMONTH=1", true},
+	}
+	for _, tt := range tests {
+		_, err := ParseRecurrence(tt.rule, time.UTC)
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.rule)
+			continue
+		}
+		if errors.Is(err, ErrUnsupportedRecurrence) != tt.unsupported {
+			t.Errorf("%q: unexpected error %v", tt.rule, err)
+		}
+	}
+
+	rule, err := ParseRecurrence("FREQ=WEEKLY;INTERVAL=2;BYDAY=SU,WE;UNTIL=20261231T215959Z;WKST=SU", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rule.String(); got != "FREQ=WEEKLY;INTERVAL=2;BYDAY=SU,WE;UNTIL=20261231T215959Z;WKST=SU" {
+		t.Errorf("Rule not written back unchanged: %s", got)
+	}
+
+	t.Log("✓ Unsupported rules rejected")
+}
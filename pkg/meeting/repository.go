@@ -9,12 +9,15 @@ import (
 
 	"github.com/Bashar444/VTP/pkg/models"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 var (
 	ErrMeetingNotFound    = errors.New("meeting not found")
 	ErrInvalidMeetingData = errors.New("invalid meeting data")
 	ErrTimeConflict       = errors.New("meeting time conflicts with existing meeting")
+	ErrSeriesNotFound     = errors.New("meeting series not found")
+	ErrInvalidScope       = errors.New("scope must be this, following or all")
 )
 
 // Repository handles meeting database operations
@@ -45,8 +48,9 @@ func (r *Repository) Create(ctx context.Context, meeting *models.Meeting) error
 		INSERT INTO meetings (
 			id, instructor_id, student_id, subject_id, title_ar,
 			scheduled_at, duration, meeting_url, room_id, status,
-			end_time, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			end_time, created_at, updated_at, course_id, series_id, original_start,
+			sequence
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
 	`
 
 	_, err := r.db.ExecContext(ctx, query,
@@ -63,6 +67,10 @@ func (r *Repository) Create(ctx context.Context, meeting *models.Meeting) error
 		nullTime(meeting.EndTime),
 		meeting.CreatedAt,
 		meeting.UpdatedAt,
+		nullString(meeting.CourseID),
+		nullString(meeting.SeriesID),
+		nullTime(meeting.OriginalStart),
+		meeting.Sequence,
 	)
 
 	if err != nil {
@@ -75,13 +83,14 @@ func (r *Repository) Create(ctx context.Context, meeting *models.Meeting) error
 // GetByID retrieves a meeting by ID
 func (r *Repository) GetByID(ctx context.Context, id string) (*models.Meeting, error) {
 	meeting := &models.Meeting{}
-	var studentID, meetingURL, roomID sql.NullString
-	var endTime sql.NullTime
+	var studentID, meetingURL, roomID, courseID, seriesID sql.NullString
+	var endTime, originalStart sql.NullTime
 
 	query := `
 		SELECT id, instructor_id, student_id, subject_id, title_ar,
 			   scheduled_at, duration, meeting_url, room_id, status,
-			   end_time, created_at, updated_at
+			   end_time, created_at, updated_at, course_id, series_id, original_start,
+			   sequence
 		FROM meetings
 		WHERE id = $1
 	`
@@ -100,6 +109,10 @@ func (r *Repository) GetByID(ctx context.Context, id string) (*models.Meeting, e
 		&endTime,
 		&meeting.CreatedAt,
 		&meeting.UpdatedAt,
+		&courseID,
+		&seriesID,
+		&originalStart,
+		&meeting.Sequence,
 	)
 
 	if err == sql.ErrNoRows {
@@ -112,9 +125,14 @@ func (r *Repository) GetByID(ctx context.Context, id string) (*models.Meeting, e
 	meeting.StudentID = studentID.String
 	meeting.MeetingURL = meetingURL.String
 	meeting.RoomID = roomID.String
+	meeting.CourseID = courseID.String
+	meeting.SeriesID = seriesID.String
 	if endTime.Valid {
 		meeting.EndTime = &endTime.Time
 	}
+	if originalStart.Valid {
+		meeting.OriginalStart = &originalStart.Time
+	}
 
 	return meeting, nil
 }
@@ -124,7 +142,8 @@ func (r *Repository) List(ctx context.Context, filters map[string]interface{}, l
 	query := `
 		SELECT id, instructor_id, student_id, subject_id, title_ar,
 			   scheduled_at, duration, meeting_url, room_id, status,
-			   end_time, created_at, updated_at
+			   end_time, created_at, updated_at, course_id, series_id, original_start,
+			   sequence
 		FROM meetings
 		WHERE 1=1
 	`
@@ -138,12 +157,24 @@ func (r *Repository) List(ctx context.Context, filters map[string]interface{}, l
 		argPos++
 	}
 
+	if courseID, ok := filters["course_id"].(string); ok && courseID != "" {
+		query += fmt.Sprintf(" AND course_id = $%d", argPos)
+		args = append(args, courseID)
+		argPos++
+	}
+
 	if studentID, ok := filters["student_id"].(string); ok && studentID != "" {
 		query += fmt.Sprintf(" AND student_id = $%d", argPos)
 		args = append(args, studentID)
 		argPos++
 	}
 
+	if attendeeID, ok := filters["attendee_id"].(string); ok && attendeeID != "" {
+		query += fmt.Sprintf(" AND (student_id = $%d OR course_id IN (%s))", argPos, enrolledCourses(argPos))
+		args = append(args, attendeeID)
+		argPos++
+	}
+
 	if subjectID, ok := filters["subject_id"].(string); ok && subjectID != "" {
 		query += fmt.Sprintf(" AND subject_id = $%d", argPos)
 		args = append(args, subjectID)
@@ -156,6 +187,18 @@ func (r *Repository) List(ctx context.Context, filters map[string]interface{}, l
 		argPos++
 	}
 
+	if seriesID, ok := filters["series_id"].(string); ok && seriesID != "" {
+		query += fmt.Sprintf(" AND series_id = $%d", argPos)
+		args = append(args, seriesID)
+		argPos++
+	}
+
+	if originalFrom, ok := filters["original_from"].(time.Time); ok {
+		query += fmt.Sprintf(" AND original_start >= $%d", argPos)
+		args = append(args, originalFrom)
+		argPos++
+	}
+
 	if fromDate, ok := filters["from_date"].(time.Time); ok {
 		query += fmt.Sprintf(" AND scheduled_at >= $%d", argPos)
 		args = append(args, fromDate)
@@ -192,8 +235,8 @@ func (r *Repository) List(ctx context.Context, filters map[string]interface{}, l
 	meetings := []*models.Meeting{}
 	for rows.Next() {
 		meeting := &models.Meeting{}
-		var studentID, meetingURL, roomID sql.NullString
-		var endTime sql.NullTime
+		var studentID, meetingURL, roomID, courseID, seriesID sql.NullString
+		var endTime, originalStart sql.NullTime
 
 		err := rows.Scan(
 			&meeting.ID,
@@ -209,6 +252,10 @@ func (r *Repository) List(ctx context.Context, filters map[string]interface{}, l
 			&endTime,
 			&meeting.CreatedAt,
 			&meeting.UpdatedAt,
+			&courseID,
+			&seriesID,
+			&originalStart,
+			&meeting.Sequence,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan meeting: %w", err)
@@ -217,9 +264,14 @@ func (r *Repository) List(ctx context.Context, filters map[string]interface{}, l
 		meeting.StudentID = studentID.String
 		meeting.MeetingURL = meetingURL.String
 		meeting.RoomID = roomID.String
+		meeting.CourseID = courseID.String
+		meeting.SeriesID = seriesID.String
 		if endTime.Valid {
 			meeting.EndTime = &endTime.Time
 		}
+		if originalStart.Valid {
+			meeting.OriginalStart = &originalStart.Time
+		}
 
 		meetings = append(meetings, meeting)
 	}
@@ -243,8 +295,8 @@ func (r *Repository) Update(ctx context.Context, meeting *models.Meeting) error
 		UPDATE meetings
 		SET title_ar = $1, scheduled_at = $2, duration = $3,
 			meeting_url = $4, room_id = $5, status = $6,
-			end_time = $7, updated_at = $8
-		WHERE id = $9
+			end_time = $7, sequence = $8, updated_at = $9
+		WHERE id = $10
 	`
 
 	result, err := r.db.ExecContext(ctx, query,
@@ -255,6 +307,7 @@ func (r *Repository) Update(ctx context.Context, meeting *models.Meeting) error
 		nullString(meeting.RoomID),
 		meeting.Status,
 		nullTime(meeting.EndTime),
+		meeting.Sequence,
 		meeting.UpdatedAt,
 		meeting.ID,
 	)
@@ -305,7 +358,7 @@ func (r *Repository) CheckTimeConflict(ctx context.Context, instructorID string,
 		FROM meetings
 		WHERE instructor_id = $1
 			AND status IN ('scheduled', 'in-progress')
-			AND id != $2
+			AND id::text != $2
 			AND (
 				(scheduled_at <= $3 AND (scheduled_at + (duration || ' minutes')::interval) > $3)
 				OR
@@ -324,6 +377,344 @@ func (r *Repository) CheckTimeConflict(ctx context.Context, instructorID string,
 	return count > 0, nil
 }
 
+// CreateSeries creates a meeting series
+func (r *Repository) CreateSeries(ctx context.Context, series *models.MeetingSeries) error {
+	if series.InstructorID == "" || series.SubjectID == "" || series.TitleAr == "" || series.RRule == "" {
+		return ErrInvalidMeetingData
+	}
+
+	series.ID = uuid.New().String()
+	series.CreatedAt = time.Now()
+	series.UpdatedAt = time.Now()
+
+	if series.Status == "" {
+		series.Status = "active"
+	}
+
+	query := `
+		INSERT INTO meeting_series (
+			id, course_id, instructor_id, student_id, subject_id, title_ar,
+			starts_at, duration, timezone, rrule, exdates, meeting_url,
+			room_id, status, materialized_until, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11::timestamptz[], $12, $13, $14, $15, $16, $17)
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		series.ID,
+		nullString(series.CourseID),
+		series.InstructorID,
+		nullString(series.StudentID),
+		series.SubjectID,
+		series.TitleAr,
+		series.StartsAt,
+		series.Duration,
+		series.Timezone,
+		series.RRule,
+		exdatesArray(series.ExDates),
+		nullString(series.MeetingURL),
+		nullString(series.RoomID),
+		series.Status,
+		nullTime(series.MaterializedUntil),
+		series.CreatedAt,
+		series.UpdatedAt,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to create meeting series: %w", err)
+	}
+
+	return nil
+}
+
+const seriesColumns = `
+	id, course_id, instructor_id, student_id, subject_id, title_ar,
+	starts_at, duration, timezone, rrule, exdates, meeting_url,
+	room_id, status, materialized_until, created_at, updated_at
+`
+
+// scanSeries scans a row selected with seriesColumns
+func scanSeries(row interface{ Scan(dest ...any) error }) (*models.MeetingSeries, error) {
+	series := &models.MeetingSeries{}
+	var courseID, studentID, meetingURL, roomID sql.NullString
+	var exdates pq.StringArray
+	var materializedUntil sql.NullTime
+
+	err := row.Scan(
+		&series.ID,
+		&courseID,
+		&series.InstructorID,
+		&studentID,
+		&series.SubjectID,
+		&series.TitleAr,
+		&series.StartsAt,
+		&series.Duration,
+		&series.Timezone,
+		&series.RRule,
+		&exdates,
+		&meetingURL,
+		&roomID,
+		&series.Status,
+		&materializedUntil,
+		&series.CreatedAt,
+		&series.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	series.CourseID = courseID.String
+	series.StudentID = studentID.String
+	series.MeetingURL = meetingURL.String
+	series.RoomID = roomID.String
+	if materializedUntil.Valid {
+		series.MaterializedUntil = &materializedUntil.Time
+	}
+	for _, exdate := range exdates {
+		t, err := pq.ParseTimestamp(time.UTC, exdate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exception date %q: %w", exdate, err)
+		}
+		series.ExDates = append(series.ExDates, t)
+	}
+
+	return series, nil
+}
+
+// GetSeries retrieves a meeting series by ID
+func (r *Repository) GetSeries(ctx context.Context, id string) (*models.MeetingSeries, error) {
+	query := `SELECT ` + seriesColumns + ` FROM meeting_series WHERE id = $1`
+
+	series, err := scanSeries(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrSeriesNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get meeting series: %w", err)
+	}
+
+	return series, nil
+}
+
+// ListDueSeries retrieves active series whose occurrences are created only
+// up to before, filtered like List
+func (r *Repository) ListDueSeries(ctx context.Context, filters map[string]interface{}, before time.Time) ([]*models.MeetingSeries, error) {
+	query := `SELECT ` + seriesColumns + ` FROM meeting_series
+		WHERE status = 'active' AND (materialized_until IS NULL OR materialized_until < $1)`
+	args := []interface{}{before}
+	argPos := 2
+
+	for _, column := range []string{"instructor_id", "course_id", "student_id", "subject_id"} {
+		if value, ok := filters[column].(string); ok && value != "" {
+			query += fmt.Sprintf(" AND %s = $%d", column, argPos)
+			args = append(args, value)
+			argPos++
+		}
+	}
+	if attendeeID, ok := filters["attendee_id"].(string); ok && attendeeID != "" {
+		query += fmt.Sprintf(" AND (student_id = $%d OR course_id IN (%s))", argPos, enrolledCourses(argPos))
+		args = append(args, attendeeID)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list meeting series: %w", err)
+	}
+	defer rows.Close()
+
+	series := []*models.MeetingSeries{}
+	for rows.Next() {
+		s, err := scanSeries(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan meeting series: %w", err)
+		}
+		series = append(series, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return series, nil
+}
+
+// UpdateSeries updates a meeting series
+func (r *Repository) UpdateSeries(ctx context.Context, series *models.MeetingSeries) error {
+	series.UpdatedAt = time.Now()
+
+	query := `
+		UPDATE meeting_series
+		SET title_ar = $1, starts_at = $2, duration = $3, timezone = $4,
+			rrule = $5, exdates = $6::timestamptz[], meeting_url = $7, room_id = $8,
+			status = $9, materialized_until = $10, updated_at = $11
+		WHERE id = $12
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		series.TitleAr,
+		series.StartsAt,
+		series.Duration,
+		series.Timezone,
+		series.RRule,
+		exdatesArray(series.ExDates),
+		nullString(series.MeetingURL),
+		nullString(series.RoomID),
+		series.Status,
+		nullTime(series.MaterializedUntil),
+		series.UpdatedAt,
+		series.ID,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to update meeting series: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrSeriesNotFound
+	}
+
+	return nil
+}
+
+// CreateOccurrence creates a meeting for an occurrence of a series unless
+// the occurrence was already created. It reports whether it created one.
+func (r *Repository) CreateOccurrence(ctx context.Context, meeting *models.Meeting) (bool, error) {
+	if meeting.SeriesID == "" || meeting.OriginalStart == nil {
+		return false, ErrInvalidMeetingData
+	}
+
+	meeting.ID = uuid.New().String()
+	meeting.CreatedAt = time.Now()
+	meeting.UpdatedAt = time.Now()
+
+	query := `
+		INSERT INTO meetings (
+			id, instructor_id, student_id, subject_id, title_ar,
+			scheduled_at, duration, meeting_url, room_id, status,
+			created_at, updated_at, course_id, series_id, original_start
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		ON CONFLICT (series_id, original_start) DO NOTHING
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		meeting.ID,
+		meeting.InstructorID,
+		nullString(meeting.StudentID),
+		meeting.SubjectID,
+		meeting.TitleAr,
+		meeting.ScheduledAt,
+		meeting.Duration,
+		nullString(meeting.MeetingURL),
+		nullString(meeting.RoomID),
+		meeting.Status,
+		meeting.CreatedAt,
+		meeting.UpdatedAt,
+		nullString(meeting.CourseID),
+		meeting.SeriesID,
+		meeting.OriginalStart,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to create meeting occurrence: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// MoveOccurrences saves occurrences moved to other dates or to another
+// series. Their dates are cleared first, so occurrences can take each
+// other's dates.
+func (r *Repository) MoveOccurrences(ctx context.Context, occurrences []*models.Meeting) error {
+	if len(occurrences) == 0 {
+		return nil
+	}
+	ids := make([]string, len(occurrences))
+	for i, meeting := range occurrences {
+		ids[i] = meeting.ID
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to move meeting occurrences: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE meetings SET original_start = NULL WHERE id::text = ANY($1)`, pq.Array(ids)); err != nil {
+		return fmt.Errorf("failed to move meeting occurrences: %w", err)
+	}
+
+	query := `
+		UPDATE meetings
+		SET series_id = $1, original_start = $2, title_ar = $3, scheduled_at = $4,
+			duration = $5, meeting_url = $6, room_id = $7, sequence = $8, updated_at = $9
+		WHERE id = $10
+	`
+	now := time.Now()
+	for _, meeting := range occurrences {
+		meeting.UpdatedAt = now
+		_, err := tx.ExecContext(ctx, query,
+			meeting.SeriesID,
+			meeting.OriginalStart,
+			meeting.TitleAr,
+			meeting.ScheduledAt,
+			meeting.Duration,
+			nullString(meeting.MeetingURL),
+			nullString(meeting.RoomID),
+			meeting.Sequence,
+			meeting.UpdatedAt,
+			meeting.ID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to move meeting occurrence: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to move meeting occurrences: %w", err)
+	}
+	return nil
+}
+
+// CancelOccurrences cancels the scheduled occurrences of a series starting
+// at or after from and returns their IDs
+func (r *Repository) CancelOccurrences(ctx context.Context, seriesID string, from time.Time) ([]string, error) {
+	query := `
+		UPDATE meetings
+		SET status = 'cancelled', sequence = sequence + 1, updated_at = $3
+		WHERE series_id = $1 AND original_start >= $2 AND status = 'scheduled'
+		RETURNING id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, seriesID, from, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel meeting occurrences: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan meeting ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return ids, nil
+}
+
 // Helper functions
 func nullString(s string) sql.NullString {
 	return sql.NullString{String: s, Valid: s != ""}
@@ -335,3 +726,17 @@ func nullTime(t *time.Time) sql.NullTime {
 	}
 	return sql.NullTime{Time: *t, Valid: true}
 }
+
+// enrolledCourses selects the courses the student in parameter argPos is
+// actively enrolled in
+func enrolledCourses(argPos int) string {
+	return fmt.Sprintf("SELECT course_id FROM course_enrollments WHERE student_id = $%d AND status = 'active'", argPos)
+}
+
+func exdatesArray(exdates []time.Time) pq.StringArray {
+	values := make(pq.StringArray, len(exdates))
+	for i, t := range exdates {
+		values[i] = t.UTC().Format(time.RFC3339)
+	}
+	return values
+}
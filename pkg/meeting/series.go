@@ -0,0 +1,583 @@
+package meeting
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/models"
+)
+
+// Scopes of an edit or cancellation of a recurring meeting
+const (
+	ScopeThis      = "this"
+	ScopeFollowing = "following"
+	ScopeAll       = "all"
+)
+
+// DefaultTimezone is the zone recurrence rules are expanded in when a
+// series does not name one
+const DefaultTimezone = "Asia/Damascus"
+
+// WeekendDays are left out of recurring meetings unless a series includes
+// them: the Syrian weekend
+var WeekendDays = []time.Weekday{time.Friday, time.Saturday}
+
+const (
+	// materializeAhead is how far ahead occurrences are created. Series are
+	// topped up once less than half of it is left.
+	materializeAhead = 28 * 24 * time.Hour
+	// maxMaterializeAhead bounds how far ahead a query can create occurrences
+	maxMaterializeAhead = 366 * 24 * time.Hour
+)
+
+// Materialized lists the occurrences created for a series and those
+// skipped because the instructor had another meeting. Skipped occurrences
+// are added to the series' exception dates.
+type Materialized struct {
+	Meetings  []*models.Meeting
+	Conflicts []time.Time
+}
+
+// SeriesUpdate changes the occurrences of a series in an edit's scope
+type SeriesUpdate struct {
+	TitleAr        string
+	ScheduledAt    time.Time // new start of the edited occurrence, zero to keep it
+	Duration       int
+	MeetingURL     string
+	RoomID         string
+	RRule          string // new rule, empty to keep it
+	IncludeWeekend bool
+}
+
+// CreateSeries creates a recurring meeting and its first occurrences. A
+// first meeting that does not fall on the rule's days moves to the first
+// day that does. The weekend is left out unless includeWeekend is set.
+func (s *Service) CreateSeries(ctx context.Context, series *models.MeetingSeries, includeWeekend bool) (*Materialized, error) {
+	if series.InstructorID == "" {
+		return nil, fmt.Errorf("instructor ID is required")
+	}
+	if series.SubjectID == "" {
+		return nil, fmt.Errorf("subject ID is required")
+	}
+	if series.TitleAr == "" {
+		return nil, fmt.Errorf("title is required")
+	}
+	if series.Duration <= 0 {
+		return nil, fmt.Errorf("duration must be positive")
+	}
+	if series.StartsAt.Before(time.Now()) {
+		return nil, fmt.Errorf("meeting cannot be scheduled in the past")
+	}
+	if series.Timezone == "" {
+		series.Timezone = DefaultTimezone
+	}
+
+	rule, start, err := prepareRule(series.RRule, series.Timezone, series.StartsAt, includeWeekend)
+	if err != nil {
+		return nil, err
+	}
+	series.StartsAt = start
+	series.RRule = rule.String()
+	series.Status = "active"
+	series.MaterializedUntil = nil
+
+	if err := s.repo.CreateSeries(ctx, series); err != nil {
+		return nil, err
+	}
+
+	return s.materialize(ctx, series, time.Now().Add(materializeAhead), nil)
+}
+
+// GetSeries retrieves a meeting series by ID
+func (s *Service) GetSeries(ctx context.Context, id string) (*models.MeetingSeries, error) {
+	return s.repo.GetSeries(ctx, id)
+}
+
+// prepareRule parses a series' rule, leaves out the weekend unless asked
+// not to and moves start to the rule's first occurrence
+func prepareRule(rrule, timezone string, start time.Time, includeWeekend bool) (*Recurrence, time.Time, error) {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid time zone %q", timezone)
+	}
+	rule, err := ParseRecurrence(rrule, loc)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	start = start.In(loc)
+	if !includeWeekend {
+		if err := rule.Exclude(start, WeekendDays...); err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+
+	first := rule.Occurrences(start, start, start.AddDate(1, 0, 0))
+	if len(first) == 0 {
+		return nil, time.Time{}, fmt.Errorf("recurrence rule has no meeting within a year")
+	}
+	return rule, first[0], nil
+}
+
+// seriesRule parses a stored series' rule and returns its start in the
+// series' time zone
+func seriesRule(series *models.MeetingSeries) (*Recurrence, time.Time, error) {
+	loc, err := time.LoadLocation(series.Timezone)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid time zone %q", series.Timezone)
+	}
+	rule, err := ParseRecurrence(series.RRule, loc)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return rule, series.StartsAt.In(loc), nil
+}
+
+// materialize creates the occurrences of a series up to until that were
+// not created yet, leaving out the held dates that already have a meeting.
+// Occurrences clashing with another meeting of the instructor are skipped
+// and added to the series' exception dates.
+func (s *Service) materialize(ctx context.Context, series *models.MeetingSeries, until time.Time, held []time.Time) (*Materialized, error) {
+	result := &Materialized{}
+	if series.Status != "active" {
+		return result, nil
+	}
+	until = minTime(until, time.Now().Add(maxMaterializeAhead))
+	from := series.StartsAt
+	if series.MaterializedUntil != nil && series.MaterializedUntil.After(from) {
+		from = *series.MaterializedUntil
+	}
+	if !until.After(from) {
+		return result, nil
+	}
+
+	rule, start, err := seriesRule(series)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, at := range rule.Occurrences(start, from, until) {
+		if isExDate(series.ExDates, at) || isExDate(held, at) {
+			continue
+		}
+
+		hasConflict, err := s.repo.CheckTimeConflict(ctx, series.InstructorID, at, series.Duration, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to check time conflict: %w", err)
+		}
+		if hasConflict {
+			series.ExDates = append(series.ExDates, at)
+			result.Conflicts = append(result.Conflicts, at)
+			continue
+		}
+
+		occurrence := newOccurrence(series, at)
+		created, err := s.repo.CreateOccurrence(ctx, occurrence)
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			result.Meetings = append(result.Meetings, occurrence)
+		}
+	}
+
+	series.MaterializedUntil = &until
+	if err := s.repo.UpdateSeries(ctx, series); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// materializeDue tops up the series matching a meeting list's filters, so
+// the list includes their upcoming occurrences
+func (s *Service) materializeDue(ctx context.Context, filters map[string]interface{}) error {
+	now := time.Now()
+	due := now.Add(materializeAhead / 2)
+	until := now.Add(materializeAhead)
+	if toDate, ok := filters["to_date"].(time.Time); ok && toDate.After(due) {
+		due = toDate
+		until = maxTime(until, toDate.Add(time.Second))
+	}
+
+	dueSeries, err := s.repo.ListDueSeries(ctx, filters, due)
+	if err != nil {
+		return err
+	}
+	for _, series := range dueSeries {
+		if _, err := s.materialize(ctx, series, until, nil); err != nil {
+			return fmt.Errorf("failed to create occurrences of series %s: %w", series.ID, err)
+		}
+	}
+	return nil
+}
+
+// UpdateOccurrences edits the occurrence of a series with the given ID and,
+// depending on scope, the occurrences following it or the whole series.
+// Changing the following occurrences splits the series in two. Scheduled
+// occurrences in scope keep their meetings and move to their new times,
+// replacing edits made to single occurrences among them. Dates the edit
+// removes are cancelled and dates it adds are created. It returns the
+// series holding the edited occurrences.
+func (s *Service) UpdateOccurrences(ctx context.Context, id, scope string, update *SeriesUpdate) (*models.MeetingSeries, *Materialized, error) {
+	if scope != ScopeFollowing && scope != ScopeAll {
+		return nil, nil, ErrInvalidScope
+	}
+	if update.TitleAr == "" {
+		return nil, nil, fmt.Errorf("title is required")
+	}
+	if update.Duration <= 0 {
+		return nil, nil, fmt.Errorf("duration must be positive")
+	}
+
+	occurrence, series, err := s.occurrenceSeries(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pivot := *occurrence.OriginalStart
+	if scope == ScopeAll || !pivot.After(series.StartsAt) {
+		pivot = series.StartsAt
+	}
+	var shift time.Duration
+	if !update.ScheduledAt.IsZero() {
+		shift = update.ScheduledAt.Sub(*occurrence.OriginalStart)
+	}
+
+	rule, start, err := seriesRule(series)
+	if err != nil {
+		return nil, nil, err
+	}
+	newStart := pivot.Add(shift)
+	if update.RRule != "" {
+		rule, newStart, err = prepareRule(update.RRule, series.Timezone, newStart, update.IncludeWeekend)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if rule.Count > 0 && pivot.After(series.StartsAt) {
+		// The new series holds the meetings the old one had left
+		rule.Count -= len(rule.Occurrences(start, start, pivot))
+	}
+
+	edited := *series
+	edited.TitleAr = update.TitleAr
+	edited.StartsAt = newStart
+	edited.Duration = update.Duration
+	edited.MeetingURL = update.MeetingURL
+	edited.RoomID = update.RoomID
+	edited.RRule = rule.String()
+	edited.ExDates = nil
+	for _, exdate := range series.ExDates {
+		if !exdate.Before(pivot) {
+			edited.ExDates = append(edited.ExDates, exdate.Add(shift))
+		}
+	}
+
+	if pivot.After(series.StartsAt) {
+		// End the old series before the edited occurrence and continue in a new one
+		if err := s.endSeriesBefore(ctx, series, pivot); err != nil {
+			return nil, nil, err
+		}
+		edited.MaterializedUntil = nil
+		if err := s.repo.CreateSeries(ctx, &edited); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		// Occurrences already held keep their meetings
+		edited.MaterializedUntil = nil
+		if now := time.Now(); now.After(edited.StartsAt) {
+			edited.MaterializedUntil = &now
+		}
+		if err := s.repo.UpdateSeries(ctx, &edited); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	until := time.Now().Add(materializeAhead)
+	if series.MaterializedUntil != nil {
+		until = maxTime(until, *series.MaterializedUntil)
+	}
+	moved, err := s.moveOccurrences(ctx, series.ID, &edited, maxTime(pivot, time.Now()), shift, until)
+	if err != nil {
+		return nil, nil, err
+	}
+	held := make([]time.Time, 0, len(moved.Meetings))
+	for _, m := range moved.Meetings {
+		held = append(held, *m.OriginalStart)
+	}
+	result, err := s.materialize(ctx, &edited, until, held)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, m := range result.Meetings {
+		s.changed(ctx, m.ID)
+	}
+	result.Meetings = append(moved.Meetings, result.Meetings...)
+	result.Conflicts = append(moved.Conflicts, result.Conflicts...)
+	return &edited, result, nil
+}
+
+// moveOccurrences moves the scheduled occurrences of a series from from on
+// into an edited series by shift, keeping their meetings. An occurrence
+// whose new date the edited rule does not hold keeps its own date if the
+// rule still holds that, and is cancelled otherwise. Moved occurrences
+// clashing with another meeting of the instructor are cancelled and added
+// to the edited series' exception dates.
+func (s *Service) moveOccurrences(ctx context.Context, seriesID string, edited *models.MeetingSeries, from time.Time, shift time.Duration, until time.Time) (*Materialized, error) {
+	occurrences, err := s.repo.List(ctx, map[string]interface{}{
+		"series_id":     seriesID,
+		"original_from": from,
+	}, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(occurrences, func(a, b *models.Meeting) int {
+		return a.OriginalStart.Compare(*b.OriginalStart)
+	})
+
+	rule, start, err := seriesRule(edited)
+	if err != nil {
+		return nil, err
+	}
+	lo := edited.StartsAt
+	if edited.MaterializedUntil != nil && edited.MaterializedUntil.After(lo) {
+		lo = *edited.MaterializedUntil
+	}
+	var scheduled []*models.Meeting
+	var fixed []time.Time // dates of the series' other meetings, which stay where they are
+	for _, o := range occurrences {
+		if o.Status == "scheduled" {
+			scheduled = append(scheduled, o)
+		} else if edited.ID == seriesID {
+			fixed = append(fixed, *o.OriginalStart)
+		}
+	}
+	dates := slices.DeleteFunc(rule.Occurrences(start, lo, until), func(at time.Time) bool {
+		return isExDate(edited.ExDates, at) || isExDate(fixed, at)
+	})
+
+	holders, removed := assignDates(scheduled, dates, shift)
+	for _, o := range removed {
+		if err := s.CancelMeeting(ctx, o.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &Materialized{}
+	var changed []*models.Meeting
+	for i, o := range holders {
+		if o == nil {
+			continue
+		}
+		at := dates[i]
+		if !o.ScheduledAt.Equal(at) || o.Duration != edited.Duration || o.TitleAr != edited.TitleAr ||
+			o.MeetingURL != edited.MeetingURL || o.RoomID != edited.RoomID {
+			o.Sequence++
+			changed = append(changed, o)
+		}
+		o.SeriesID = edited.ID
+		o.OriginalStart = &at
+		o.ScheduledAt = at
+		o.TitleAr = edited.TitleAr
+		o.Duration = edited.Duration
+		o.MeetingURL = edited.MeetingURL
+		o.RoomID = edited.RoomID
+		result.Meetings = append(result.Meetings, o)
+	}
+	if err := s.repo.MoveOccurrences(ctx, result.Meetings); err != nil {
+		return nil, err
+	}
+
+	for _, o := range changed {
+		hasConflict, err := s.repo.CheckTimeConflict(ctx, o.InstructorID, o.ScheduledAt, o.Duration, o.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check time conflict: %w", err)
+		}
+		if !hasConflict {
+			continue
+		}
+		if err := s.CancelMeeting(ctx, o.ID); err != nil {
+			return nil, err
+		}
+		edited.ExDates = append(edited.ExDates, *o.OriginalStart)
+		result.Conflicts = append(result.Conflicts, *o.OriginalStart)
+		result.Meetings = slices.DeleteFunc(result.Meetings, func(m *models.Meeting) bool {
+			return m == o
+		})
+	}
+	for _, o := range changed {
+		if slices.Contains(result.Meetings, o) {
+			s.changed(ctx, o.ID)
+		}
+	}
+	return result, nil
+}
+
+// CancelOccurrences cancels the occurrence of a series with the given ID
+// and, depending on scope, the occurrences following it or the whole
+// series. Cancelling a meeting outside a series only supports ScopeThis.
+func (s *Service) CancelOccurrences(ctx context.Context, id, scope string) error {
+	switch scope {
+	case "", ScopeThis:
+		meeting, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := s.CancelMeeting(ctx, id); err != nil {
+			return err
+		}
+		return s.excludeOccurrence(ctx, meeting)
+	case ScopeFollowing, ScopeAll:
+	default:
+		return ErrInvalidScope
+	}
+
+	occurrence, series, err := s.occurrenceSeries(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	pivot := *occurrence.OriginalStart
+	if scope == ScopeAll || !pivot.After(series.StartsAt) {
+		pivot = series.StartsAt
+		series.Status = "cancelled"
+		if err := s.repo.UpdateSeries(ctx, series); err != nil {
+			return err
+		}
+	} else if err := s.endSeriesBefore(ctx, series, pivot); err != nil {
+		return err
+	}
+
+	cancelled, err := s.repo.CancelOccurrences(ctx, series.ID, pivot)
+	if err != nil {
+		return err
+	}
+	for _, id := range cancelled {
+		s.changed(ctx, id)
+	}
+	return nil
+}
+
+// occurrenceSeries loads a meeting that is an occurrence of a series and
+// its series
+func (s *Service) occurrenceSeries(ctx context.Context, id string) (*models.Meeting, *models.MeetingSeries, error) {
+	occurrence, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if occurrence.SeriesID == "" || occurrence.OriginalStart == nil {
+		return nil, nil, fmt.Errorf("meeting is not part of a series")
+	}
+	series, err := s.repo.GetSeries(ctx, occurrence.SeriesID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return occurrence, series, nil
+}
+
+// endSeriesBefore ends a series with the last occurrence before pivot
+func (s *Service) endSeriesBefore(ctx context.Context, series *models.MeetingSeries, pivot time.Time) error {
+	rule, _, err := seriesRule(series)
+	if err != nil {
+		return err
+	}
+	rule.Count = 0
+	rule.Until = pivot.Add(-time.Second)
+	series.RRule = rule.String()
+	series.ExDates = slices.DeleteFunc(series.ExDates, func(t time.Time) bool {
+		return !t.Before(pivot)
+	})
+	return s.repo.UpdateSeries(ctx, series)
+}
+
+// excludeOccurrence adds a cancelled or deleted occurrence to its series'
+// exception dates
+func (s *Service) excludeOccurrence(ctx context.Context, meeting *models.Meeting) error {
+	if meeting.SeriesID == "" || meeting.OriginalStart == nil {
+		return nil
+	}
+	series, err := s.repo.GetSeries(ctx, meeting.SeriesID)
+	if err != nil {
+		return err
+	}
+	if isExDate(series.ExDates, *meeting.OriginalStart) {
+		return nil
+	}
+	series.ExDates = append(series.ExDates, *meeting.OriginalStart)
+	return s.repo.UpdateSeries(ctx, series)
+}
+
+// newOccurrence builds the meeting for an occurrence of a series
+func newOccurrence(series *models.MeetingSeries, at time.Time) *models.Meeting {
+	originalStart := at
+	return &models.Meeting{
+		CourseID:      series.CourseID,
+		InstructorID:  series.InstructorID,
+		StudentID:     series.StudentID,
+		SubjectID:     series.SubjectID,
+		TitleAr:       series.TitleAr,
+		ScheduledAt:   at,
+		Duration:      series.Duration,
+		MeetingURL:    series.MeetingURL,
+		RoomID:        series.RoomID,
+		Status:        "scheduled",
+		SeriesID:      series.ID,
+		OriginalStart: &originalStart,
+	}
+}
+
+// assignDates moves occurrences by shift onto the dates of a rule. It
+// returns the occurrence moving to each date, nil for dates that need a new
+// one, and the occurrences left without a date. An occurrence whose new
+// date is not among dates keeps its own date if it is.
+func assignDates(occurrences []*models.Meeting, dates []time.Time, shift time.Duration) ([]*models.Meeting, []*models.Meeting) {
+	holders := make([]*models.Meeting, len(dates))
+	var removed []*models.Meeting
+	for _, o := range occurrences {
+		i := slices.IndexFunc(dates, o.OriginalStart.Add(shift).Equal)
+		if i < 0 || holders[i] != nil {
+			removed = append(removed, o)
+			continue
+		}
+		holders[i] = o
+	}
+
+	// Keeping its own date may take the date of another occurrence, which
+	// then tries its own, so occurrences of one series never share a date
+	for kept := true; kept; {
+		kept = false
+		for j, o := range removed {
+			i := slices.IndexFunc(dates, o.OriginalStart.Equal)
+			if i < 0 {
+				continue
+			}
+			if holders[i] != nil {
+				removed[j] = holders[i]
+			} else {
+				removed = slices.Delete(removed, j, j+1)
+			}
+			holders[i] = o
+			kept = true
+			break
+		}
+	}
+	return holders, removed
+}
+
+func isExDate(exdates []time.Time, at time.Time) bool {
+	return slices.ContainsFunc(exdates, at.Equal)
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,67 @@
+package meeting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/models"
+)
+
+func testOccurrences(starts ...time.Time) []*models.Meeting {
+	occurrences := make([]*models.Meeting, len(starts))
+	for i, start := range starts {
+		originalStart := start
+		occurrences[i] = &models.Meeting{ID: start.Format("Mon 02"), ScheduledAt: start, OriginalStart: &originalStart}
+	}
+	return occurrences
+}
+
+func meetingIDs(meetings []*models.Meeting) []string {
+	ids := make([]string, len(meetings))
+	for i, m := range meetings {
+		if m != nil {
+			ids[i] = m.ID
+		}
+	}
+	return ids
+}
+
+func expectIDs(t *testing.T, what string, got []*models.Meeting, want ...string) {
+	t.Helper()
+	ids := meetingIDs(got)
+	if len(ids) != len(want) {
+		t.Fatalf("%s: expected %q, got %q", what, want, ids)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("%s: expected %q, got %q", what, want, ids)
+		}
+	}
+}
+
+// TestAssignDates tests that edited occurrences keep their meetings and
+// never share a date
+func TestAssignDates(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2026, time.November, d, 10, 0, 0, 0, time.UTC)
+	}
+
+	// Moving every occurrence a day later keeps all of them and adds the
+	// date after the last one
+	holders, removed := assignDates(testOccurrences(day(2), day(3), day(4)), []time.Time{day(3), day(4), day(5), day(6)}, 24*time.Hour)
+	expectIDs(t, "moved", holders, "Mon 02", "Tue 03", "Wed 04", "")
+	expectIDs(t, "moved removed", removed)
+
+	// Monday and Wednesday meetings changed to Wednesday only: the Wednesday
+	// meetings keep their dates and the Monday ones are left over
+	holders, removed = assignDates(testOccurrences(day(2), day(4), day(9), day(11)), []time.Time{day(4), day(11)}, 2*24*time.Hour)
+	expectIDs(t, "new rule", holders, "Wed 04", "Wed 11")
+	expectIDs(t, "new rule removed", removed, "Mon 02", "Mon 09")
+
+	// Dates the rule no longer holds are left over
+	holders, removed = assignDates(testOccurrences(day(2), day(9)), []time.Time{day(2)}, 0)
+	expectIDs(t, "shortened", holders, "Mon 02")
+	expectIDs(t, "shortened removed", removed, "Mon 09")
+
+	t.Log("✓ Occurrences moved onto the edited dates")
+}
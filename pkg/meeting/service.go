@@ -10,7 +10,9 @@ import (
 
 // Service handles business logic for meetings
 type Service struct {
-	repo *Repository
+	repo        *Repository
+	onCompleted func(ctx context.Context, meeting *models.Meeting)
+	onChanged   func(ctx context.Context, meeting *models.Meeting)
 }
 
 // NewService creates a new meeting service
@@ -18,6 +20,34 @@ func NewService(repo *Repository) *Service {
 	return &Service{repo: repo}
 }
 
+// OnCompleted registers a function called in the background after a
+// meeting is completed
+func (s *Service) OnCompleted(fn func(ctx context.Context, meeting *models.Meeting)) {
+	s.onCompleted = fn
+}
+
+// OnChanged registers a function called in the background after a meeting
+// is scheduled, moved or cancelled, once for each occurrence an edit or
+// cancellation of a recurring meeting changes. Occurrences a series
+// creates when it starts or as it runs on are not announced.
+func (s *Service) OnChanged(fn func(ctx context.Context, meeting *models.Meeting)) {
+	s.onChanged = fn
+}
+
+// changed calls the OnChanged function with the meeting as stored
+func (s *Service) changed(ctx context.Context, id string) {
+	if s.onChanged == nil {
+		return
+	}
+	go func(ctx context.Context) {
+		meeting, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			return
+		}
+		s.onChanged(ctx, meeting)
+	}(context.WithoutCancel(ctx))
+}
+
 // CreateMeeting creates a new meeting with conflict detection
 func (s *Service) CreateMeeting(ctx context.Context, meeting *models.Meeting) error {
 	// Validate required fields
@@ -46,7 +76,11 @@ func (s *Service) CreateMeeting(ctx context.Context, meeting *models.Meeting) er
 		return ErrTimeConflict
 	}
 
-	return s.repo.Create(ctx, meeting)
+	if err := s.repo.Create(ctx, meeting); err != nil {
+		return err
+	}
+	s.changed(ctx, meeting.ID)
+	return nil
 }
 
 // GetMeeting retrieves a meeting by ID
@@ -64,6 +98,11 @@ func (s *Service) ListMeetings(ctx context.Context, filters map[string]interface
 		page = 1
 	}
 
+	// Create the upcoming occurrences of recurring meetings first
+	if err := s.materializeDue(ctx, filters); err != nil {
+		return nil, err
+	}
+
 	offset := (page - 1) * pageSize
 	return s.repo.List(ctx, filters, pageSize, offset)
 }
@@ -87,7 +126,8 @@ func (s *Service) UpdateMeeting(ctx context.Context, meeting *models.Meeting) er
 	}
 
 	// Check for time conflicts if time changed
-	if !meeting.ScheduledAt.Equal(existing.ScheduledAt) || meeting.Duration != existing.Duration {
+	moved := !meeting.ScheduledAt.Equal(existing.ScheduledAt) || meeting.Duration != existing.Duration
+	if moved {
 		hasConflict, err := s.repo.CheckTimeConflict(ctx, existing.InstructorID, meeting.ScheduledAt, meeting.Duration, meeting.ID)
 		if err != nil {
 			return fmt.Errorf("failed to check time conflict: %w", err)
@@ -97,12 +137,33 @@ func (s *Service) UpdateMeeting(ctx context.Context, meeting *models.Meeting) er
 		}
 	}
 
-	return s.repo.Update(ctx, meeting)
+	if meeting.Status == "" {
+		meeting.Status = existing.Status
+	}
+	meeting.Sequence = existing.Sequence
+	if moved || meeting.Status != existing.Status {
+		meeting.Sequence++
+	}
+	if err := s.repo.Update(ctx, meeting); err != nil {
+		return err
+	}
+	if meeting.Sequence != existing.Sequence {
+		s.changed(ctx, meeting.ID)
+	}
+	return nil
 }
 
-// DeleteMeeting deletes a meeting
+// DeleteMeeting deletes a meeting. A deleted occurrence of a series is
+// left out of the series from then on.
 func (s *Service) DeleteMeeting(ctx context.Context, id string) error {
-	return s.repo.Delete(ctx, id)
+	meeting, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	return s.excludeOccurrence(ctx, meeting)
 }
 
 // CancelMeeting cancels a meeting
@@ -120,7 +181,12 @@ func (s *Service) CancelMeeting(ctx context.Context, id string) error {
 	}
 
 	meeting.Status = "cancelled"
-	return s.repo.Update(ctx, meeting)
+	meeting.Sequence++
+	if err := s.repo.Update(ctx, meeting); err != nil {
+		return err
+	}
+	s.changed(ctx, meeting.ID)
+	return nil
 }
 
 // CompleteMeeting marks a meeting as completed
@@ -140,7 +206,14 @@ func (s *Service) CompleteMeeting(ctx context.Context, id string) error {
 	now := time.Now()
 	meeting.Status = "completed"
 	meeting.EndTime = &now
-	return s.repo.Update(ctx, meeting)
+	if err := s.repo.Update(ctx, meeting); err != nil {
+		return err
+	}
+
+	if s.onCompleted != nil {
+		go s.onCompleted(context.WithoutCancel(ctx), meeting)
+	}
+	return nil
 }
 
 // GetInstructorMeetings retrieves meetings for an instructor
@@ -154,10 +227,11 @@ func (s *Service) GetInstructorMeetings(ctx context.Context, instructorID string
 	return s.ListMeetings(ctx, filters, page, pageSize)
 }
 
-// GetStudentMeetings retrieves meetings for a student
+// GetStudentMeetings retrieves a student's one-on-one meetings and the
+// meetings of the courses they are enrolled in
 func (s *Service) GetStudentMeetings(ctx context.Context, studentID string, status string, page, pageSize int) ([]*models.Meeting, error) {
 	filters := map[string]interface{}{
-		"student_id": studentID,
+		"attendee_id": studentID,
 	}
 	if status != "" {
 		filters["status"] = status
@@ -204,5 +278,10 @@ func (s *Service) RescheduleMeeting(ctx context.Context, id string, newScheduled
 
 	meeting.ScheduledAt = newScheduledAt
 	meeting.Duration = newDuration
-	return s.repo.Update(ctx, meeting)
+	meeting.Sequence++
+	if err := s.repo.Update(ctx, meeting); err != nil {
+		return err
+	}
+	s.changed(ctx, meeting.ID)
+	return nil
 }
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/monitoring"
+)
+
+// MetricsMiddleware records request counts and latencies per route. It must
+// wrap the router directly: the route pattern is read from the request after
+// the router has matched it, and requests copied by outer middleware do not
+// see it.
+func MetricsMiddleware(metrics *monitoring.HTTPMetrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			start := time.Now()
+
+			next.ServeHTTP(rec, r)
+
+			metrics.Observe(r.Pattern, rec.status, time.Since(start))
+		})
+	}
+}
+
+// BearerToken restricts a handler to requests presenting the token as a
+// bearer credential, such as a Prometheus scraper. An empty token leaves the
+// handler open.
+func BearerToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if token == "" {
+			return next
+		}
+		expected := []byte("Bearer " + token)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Bashar444/VTP/pkg/logging"
+)
+
+// TestRequestIDMiddleware tests that request IDs are generated, propagated
+// through the context and echoed in the response
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	handler := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logging.RequestID(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"generated", "", false},
+		{"propagated", "edge-7f3a.42", true},
+		{"rejected", "bad id\nwith newline", false},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/courses", nil)
+		if test.incoming != "" {
+			req.Header.Set(logging.RequestIDHeader, test.incoming)
+		}
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		got := rec.Header().Get(logging.RequestIDHeader)
+		if got == "" || got != seen {
+			t.Errorf("%s: response ID %q does not match context ID %q", test.name, got, seen)
+		}
+		if test.keep != (got == test.incoming) {
+			t.Errorf("%s: incoming ID %q, got %q", test.name, test.incoming, got)
+		}
+		if rec.Code != http.StatusTeapot {
+			t.Errorf("%s: expected status %d, got %d", test.name, http.StatusTeapot, rec.Code)
+		}
+	}
+
+	t.Log("✓ Request IDs generated and propagated")
+}
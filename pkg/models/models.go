@@ -107,19 +107,46 @@ type Subject struct {
 
 // Meeting represents a scheduled one-on-one or group session
 type Meeting struct {
-	ID           string     `db:"id" json:"id"`
-	InstructorID string     `db:"instructor_id" json:"instructor_id"`
-	StudentID    string     `db:"student_id" json:"student_id"` // null for group meetings
-	SubjectID    string     `db:"subject_id" json:"subject_id"`
-	TitleAr      string     `db:"title_ar" json:"title_ar"`
-	ScheduledAt  time.Time  `db:"scheduled_at" json:"scheduled_at"`
-	Duration     int        `db:"duration" json:"duration"` // minutes
-	MeetingURL   string     `db:"meeting_url" json:"meeting_url"`
-	RoomID       string     `db:"room_id" json:"room_id"`
-	Status       string     `db:"status" json:"status"` // scheduled, completed, cancelled
-	EndTime      *time.Time `db:"end_time" json:"end_time"`
-	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
-	UpdatedAt    time.Time  `db:"updated_at" json:"updated_at"`
+	ID            string     `db:"id" json:"id"`
+	CourseID      string     `db:"course_id" json:"course_id"` // null for meetings outside a course
+	InstructorID  string     `db:"instructor_id" json:"instructor_id"`
+	StudentID     string     `db:"student_id" json:"student_id"` // null for group meetings
+	SubjectID     string     `db:"subject_id" json:"subject_id"`
+	TitleAr       string     `db:"title_ar" json:"title_ar"`
+	ScheduledAt   time.Time  `db:"scheduled_at" json:"scheduled_at"`
+	Duration      int        `db:"duration" json:"duration"` // minutes
+	MeetingURL    string     `db:"meeting_url" json:"meeting_url"`
+	RoomID        string     `db:"room_id" json:"room_id"`
+	Status        string     `db:"status" json:"status"` // scheduled, completed, cancelled
+	EndTime       *time.Time `db:"end_time" json:"end_time"`
+	SeriesID      string     `db:"series_id" json:"series_id,omitempty"`           // null for one-off meetings
+	OriginalStart *time.Time `db:"original_start" json:"original_start,omitempty"` // start given by the series' rule
+	Sequence      int        `db:"sequence" json:"sequence"`                       // iCalendar SEQUENCE, raised when moved or cancelled
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// MeetingSeries is a recurring meeting following an RFC 5545 recurrence
+// rule. Its occurrences are created as meetings ahead of time, up to
+// MaterializedUntil.
+type MeetingSeries struct {
+	ID                string      `db:"id" json:"id"`
+	CourseID          string      `db:"course_id" json:"course_id"`
+	InstructorID      string      `db:"instructor_id" json:"instructor_id"`
+	StudentID         string      `db:"student_id" json:"student_id"`
+	SubjectID         string      `db:"subject_id" json:"subject_id"`
+	TitleAr           string      `db:"title_ar" json:"title_ar"`
+	StartsAt          time.Time   `db:"starts_at" json:"starts_at"` // first occurrence (DTSTART)
+	Duration          int         `db:"duration" json:"duration"`   // minutes
+	Timezone          string      `db:"timezone" json:"timezone"`   // IANA zone the rule is expanded in
+	RRule             string      `db:"rrule" json:"rrule"`
+	ExDates           []time.Time `db:"exdates" json:"exdates"` // skipped occurrences (EXDATE)
+	MeetingURL        string      `db:"meeting_url" json:"meeting_url"`
+	RoomID            string      `db:"room_id" json:"room_id"`
+	Status            string      `db:"status" json:"status"` // active, cancelled
+	MaterializedUntil *time.Time  `db:"materialized_until" json:"materialized_until"`
+	CreatedAt         time.Time   `db:"created_at" json:"created_at"`
+	UpdatedAt         time.Time   `db:"updated_at" json:"updated_at"`
 }
 
 // StudyMaterial represents supplementary learning materials
@@ -229,6 +256,30 @@ type Attendance struct {
 	UpdatedAt      time.Time  `db:"updated_at" json:"updated_at"`
 }
 
+// MeetingPoll is a poll held during a live meeting, stored when it closed
+type MeetingPoll struct {
+	ID        string     `db:"id" json:"id"`
+	MeetingID string     `db:"meeting_id" json:"meeting_id"`
+	CreatedBy string     `db:"created_by" json:"created_by"`
+	Question  string     `db:"question" json:"question"`
+	Options   []string   `db:"options" json:"options"`
+	Multiple  bool       `db:"multiple" json:"multiple"`
+	Anonymous bool       `db:"anonymous" json:"anonymous"`
+	Points    int        `db:"points" json:"points"`                   // participation grade points, 0 for ungraded polls
+	Correct   []int      `db:"correct_options" json:"correct_options"` // options earning the points, any if empty
+	Tallies   []int      `db:"tallies" json:"tallies"`
+	Voters    int        `db:"voters" json:"voters"`
+	OpenedAt  time.Time  `db:"opened_at" json:"opened_at"`
+	ClosedAt  time.Time  `db:"closed_at" json:"closed_at"`
+	Votes     []PollVote `json:"votes,omitempty"` // never stored for anonymous polls
+}
+
+// PollVote is the options a user chose in a poll
+type PollVote struct {
+	UserID  string `db:"user_id" json:"user_id"`
+	Choices []int  `db:"choices" json:"choices"`
+}
+
 // Notification represents a user notification
 type Notification struct {
 	ID             string     `db:"id" json:"id"`
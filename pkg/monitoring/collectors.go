@@ -0,0 +1,77 @@
+package monitoring
+
+import (
+	"database/sql"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// HTTPMetrics records request counts and latencies per route. Routes are
+// labelled with their registered pattern rather than the request path so
+// the number of series stays bounded.
+type HTTPMetrics struct {
+	requests *CounterVec
+	duration *HistogramVec
+}
+
+// NewHTTPMetrics registers the HTTP request metrics
+func NewHTTPMetrics(reg *Registry) *HTTPMetrics {
+	return &HTTPMetrics{
+		requests: reg.NewCounterVec("vtp_http_requests_total",
+			"HTTP requests by route pattern and status code.", "route", "code"),
+		duration: reg.NewHistogramVec("vtp_http_request_duration_seconds",
+			"HTTP request latency by route pattern.", DefaultBuckets, "route"),
+	}
+}
+
+// Observe records a completed request. Requests that matched no route are
+// recorded under "unmatched".
+func (m *HTTPMetrics) Observe(route string, code int, duration time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	m.requests.Inc(route, strconv.Itoa(code))
+	m.duration.Observe(duration.Seconds(), route)
+}
+
+// RegisterDBMetrics exports database/sql connection pool statistics
+func RegisterDBMetrics(reg *Registry, db *sql.DB) {
+	reg.NewGaugeFunc("vtp_db_open_connections", "Established database connections, in use and idle.",
+		func() float64 { return float64(db.Stats().OpenConnections) })
+	reg.NewGaugeFunc("vtp_db_in_use_connections", "Database connections currently in use.",
+		func() float64 { return float64(db.Stats().InUse) })
+	reg.NewGaugeFunc("vtp_db_idle_connections", "Idle database connections.",
+		func() float64 { return float64(db.Stats().Idle) })
+	reg.NewGaugeFunc("vtp_db_max_open_connections", "Maximum number of open database connections, 0 when unlimited.",
+		func() float64 { return float64(db.Stats().MaxOpenConnections) })
+	reg.NewCounterFunc("vtp_db_wait_count_total", "Connections waited for because the pool was exhausted.",
+		func() float64 { return float64(db.Stats().WaitCount) })
+	reg.NewCounterFunc("vtp_db_wait_duration_seconds_total", "Time spent waiting for a database connection.",
+		func() float64 { return db.Stats().WaitDuration.Seconds() })
+	reg.NewCounterFunc("vtp_db_max_idle_closed_total", "Connections closed because of the idle connection limit.",
+		func() float64 { return float64(db.Stats().MaxIdleClosed) })
+	reg.NewCounterFunc("vtp_db_max_lifetime_closed_total", "Connections closed because of the connection lifetime limit.",
+		func() float64 { return float64(db.Stats().MaxLifetimeClosed) })
+}
+
+// RegisterRuntimeMetrics exports the goroutine and memory statistics that
+// PerformanceMonitor logs
+func RegisterRuntimeMetrics(reg *Registry) {
+	reg.NewGaugeFunc("vtp_go_goroutines", "Number of goroutines.",
+		func() float64 { return float64(runtime.NumGoroutine()) })
+	reg.NewGaugeFunc("vtp_go_memory_alloc_bytes", "Bytes of allocated heap objects.",
+		func() float64 { return float64(readMemStats().Alloc) })
+	reg.NewGaugeFunc("vtp_go_memory_sys_bytes", "Bytes of memory obtained from the OS.",
+		func() float64 { return float64(readMemStats().Sys) })
+	reg.NewGaugeFunc("vtp_go_heap_objects", "Number of allocated heap objects.",
+		func() float64 { return float64(readMemStats().HeapObjects) })
+	reg.NewCounterFunc("vtp_go_gc_cycles_total", "Completed garbage collection cycles.",
+		func() float64 { return float64(readMemStats().NumGC) })
+}
+
+func readMemStats() *runtime.MemStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return &m
+}
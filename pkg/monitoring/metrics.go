@@ -0,0 +1,355 @@
+package monitoring
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric types of the Prometheus text exposition format
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// DefaultBuckets are latency buckets in seconds suited to API requests
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metric is a family of series that can write itself in the text format
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds metric families and serves them in the Prometheus text
+// exposition format
+type Registry struct {
+	mu      sync.RWMutex
+	metrics map[string]metric
+}
+
+// NewRegistry creates an empty metrics registry
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// register adds a metric family. Registering two families under the same
+// name is a programming error.
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.metrics[m.name()]; exists {
+		panic(fmt.Sprintf("monitoring: metric %s registered twice", m.name()))
+	}
+	r.metrics[m.name()] = m
+}
+
+// WriteTo writes every metric family sorted by name
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	metrics := make([]metric, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		metrics = append(metrics, r.metrics[name])
+	}
+	r.mu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+	for _, m := range metrics {
+		m.write(cw)
+	}
+	return cw.n, bw.Flush()
+}
+
+// Handler serves the registry for Prometheus scrapes
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+// CounterVec is a counter partitioned by label values
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// NewCounterVec registers a counter with the given label names
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: desc{n: name, help: help, typ: TypeCounter, labels: labels}, series: make(map[string]*series)}
+	r.register(c)
+	return c
+}
+
+// Inc increments the counter for the label values by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter for the label values. Negative values are ignored
+// because counters only go up.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(labelValues).value += v
+}
+
+// Value returns the current count for the label values
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.series[seriesKey(labelValues)]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (c *CounterVec) get(labelValues []string) *series {
+	key := seriesKey(labelValues)
+	s, ok := c.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		c.series[key] = s
+	}
+	return s
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	samples := make([]Sample, 0, len(c.series))
+	for _, s := range c.series {
+		samples = append(samples, Sample{LabelValues: s.labelValues, Value: s.value})
+	}
+	c.mu.Unlock()
+	c.writeSamples(w, samples)
+}
+
+// HistogramVec is a histogram partitioned by label values
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64 // per bucket, not cumulative
+	count       uint64
+	sum         float64
+}
+
+// NewHistogramVec registers a histogram with the given upper bucket bounds
+// and label names. DefaultBuckets is used when buckets is empty.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := &HistogramVec{
+		desc:    desc{n: name, help: help, typ: TypeHistogram, labels: labels},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe records a value for the label values
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := seriesKey(labelValues)
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+
+	idx := sort.SearchFloat64s(h.buckets, v)
+	if idx < len(h.buckets) {
+		s.counts[idx]++
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w)
+	bucketLabels := append(append([]string(nil), h.labels...), "le")
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		values := append(append([]string(nil), s.labelValues...), "")
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			values[len(values)-1] = formatFloat(bound)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.n, formatLabels(bucketLabels, values), cumulative)
+		}
+		values[len(values)-1] = "+Inf"
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.n, formatLabels(bucketLabels, values), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.n, formatLabels(h.labels, s.labelValues), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.n, formatLabels(h.labels, s.labelValues), s.count)
+	}
+}
+
+// Sample is one series value reported by a collector function
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// funcMetric reads its values from a callback at scrape time. It exports
+// state that components already track, such as pool or queue sizes.
+type funcMetric struct {
+	desc
+	collect func() []Sample
+}
+
+// NewGaugeFunc registers a gauge whose value is read at scrape time
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&funcMetric{
+		desc:    desc{n: name, help: help, typ: TypeGauge},
+		collect: func() []Sample { return []Sample{{Value: fn()}} },
+	})
+}
+
+// NewCounterFunc registers a counter whose value is read at scrape time. fn
+// must return a value that never decreases.
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(&funcMetric{
+		desc:    desc{n: name, help: help, typ: TypeCounter},
+		collect: func() []Sample { return []Sample{{Value: fn()}} },
+	})
+}
+
+// NewGaugeVecFunc registers a labelled gauge whose series are read at
+// scrape time
+func (r *Registry) NewGaugeVecFunc(name, help string, labels []string, fn func() []Sample) {
+	r.register(&funcMetric{
+		desc:    desc{n: name, help: help, typ: TypeGauge, labels: labels},
+		collect: fn,
+	})
+}
+
+func (f *funcMetric) write(w io.Writer) {
+	f.writeSamples(w, f.collect())
+}
+
+// desc holds what every metric family has in common
+type desc struct {
+	n      string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (d *desc) name() string { return d.n }
+
+func (d *desc) writeHeader(w io.Writer) {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.n, help, d.n, d.typ)
+}
+
+func (d *desc) writeSamples(w io.Writer, samples []Sample) {
+	sort.Slice(samples, func(i, j int) bool {
+		return seriesKey(samples[i].LabelValues) < seriesKey(samples[j].LabelValues)
+	})
+	d.writeHeader(w)
+	for _, s := range samples {
+		fmt.Fprintf(w, "%s%s %s\n", d.n, formatLabels(d.labels, s.LabelValues), formatFloat(s.Value))
+	}
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+}
+
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatLabels renders {name="value",...}. Missing values are rendered empty.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escape.Replace(value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
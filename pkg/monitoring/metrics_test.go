@@ -0,0 +1,105 @@
+package monitoring
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T, reg *Registry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := reg.WriteTo(&buf); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+	return buf.String()
+}
+
+func expectLines(t *testing.T, out string, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Missing line %q in output:\n%s", line, out)
+		}
+	}
+}
+
+// TestCounterExposition tests counter output in the text format
+func TestCounterExposition(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.NewCounterVec("vtp_test_total", "Test counter.", "channel", "status")
+
+	c.Inc("email", "delivered")
+	c.Inc("email", "delivered")
+	c.Add(3, "sms", "failed")
+	c.Add(-1, "sms", "failed")
+
+	expectLines(t, scrape(t, reg),
+		"# HELP vtp_test_total Test counter.",
+		"# TYPE vtp_test_total counter",
+		`vtp_test_total{channel="email",status="delivered"} 2`,
+		`vtp_test_total{channel="sms",status="failed"} 3`,
+	)
+	if got := c.Value("email", "delivered"); got != 2 {
+		t.Errorf("Expected value 2, got %v", got)
+	}
+
+	t.Log("✓ Counters exposed")
+}
+
+// TestHistogramExposition tests cumulative buckets, sum and count
+func TestHistogramExposition(t *testing.T) {
+	reg := NewRegistry()
+	h := reg.NewHistogramVec("vtp_test_seconds", "Test histogram.", []float64{0.1, 1}, "route")
+
+	h.Observe(0.05, "GET /a")
+	h.Observe(0.5, "GET /a")
+	h.Observe(5, "GET /a")
+
+	expectLines(t, scrape(t, reg),
+		"# TYPE vtp_test_seconds histogram",
+		`vtp_test_seconds_bucket{route="GET /a",le="0.1"} 1`,
+		`vtp_test_seconds_bucket{route="GET /a",le="1"} 2`,
+		`vtp_test_seconds_bucket{route="GET /a",le="+Inf"} 3`,
+		`vtp_test_seconds_sum{route="GET /a"} 5.55`,
+		`vtp_test_seconds_count{route="GET /a"} 3`,
+	)
+
+	t.Log("✓ Histograms exposed")
+}
+
+// TestFuncMetrics tests metrics read at scrape time and label escaping
+func TestFuncMetrics(t *testing.T) {
+	reg := NewRegistry()
+	depth := 4
+	reg.NewGaugeFunc("vtp_test_depth", "Queue depth.", func() float64 { return float64(depth) })
+	reg.NewGaugeVecFunc("vtp_test_viewers", "Viewers.", []string{"stream"}, func() []Sample {
+		return []Sample{{LabelValues: []string{`a"b`}, Value: 7}}
+	})
+
+	depth = 9
+	expectLines(t, scrape(t, reg),
+		"vtp_test_depth 9",
+		`vtp_test_viewers{stream="a\"b"} 7`,
+	)
+
+	t.Log("✓ Function metrics read at scrape time")
+}
+
+// TestHTTPMetrics tests that unmatched requests share one series
+func TestHTTPMetrics(t *testing.T) {
+	reg := NewRegistry()
+	m := NewHTTPMetrics(reg)
+
+	m.Observe("GET /api/v1/courses/{id}", 200, 20*time.Millisecond)
+	m.Observe("", 404, time.Millisecond)
+
+	expectLines(t, scrape(t, reg),
+		`vtp_http_requests_total{route="GET /api/v1/courses/{id}",code="200"} 1`,
+		`vtp_http_requests_total{route="unmatched",code="404"} 1`,
+		`vtp_http_request_duration_seconds_count{route="GET /api/v1/courses/{id}"} 1`,
+	)
+
+	t.Log("✓ HTTP metrics recorded per route")
+}
@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/Bashar444/VTP/pkg/auth"
 	"github.com/Bashar444/VTP/pkg/models"
+	"github.com/Bashar444/VTP/pkg/router"
 	"github.com/Bashar444/VTP/pkg/utils"
 )
 
@@ -19,6 +21,23 @@ func NewHandler(service *Service) *Handler {
 	return &Handler{service: service}
 }
 
+// RegisterRoutes registers notification routes. All routes require
+// authentication; sending notifications is limited to teachers and admins.
+func (h *Handler) RegisterRoutes(rt *router.Router, am *auth.AuthMiddleware) {
+	api := rt.With(am.Middleware)
+	senders := am.RoleMiddleware(string(auth.RoleTeacher), string(auth.RoleAdmin))
+
+	api.HandleFunc("GET /api/v1/notifications", h.GetUserNotifications)
+	api.HandleFunc("POST /api/v1/notifications", h.CreateNotification, senders)
+	api.HandleFunc("GET /api/v1/notifications/{id}", h.GetNotification)
+	api.HandleFunc("DELETE /api/v1/notifications/{id}", h.DeleteNotification)
+	api.HandleFunc("POST /api/v1/notifications/{id}/read", h.MarkAsRead)
+	api.HandleFunc("POST /api/v1/notifications/read-all", h.MarkAllAsRead)
+	api.HandleFunc("GET /api/v1/notifications/unread-count", h.GetUnreadCount)
+	api.HandleFunc("POST /api/v1/notifications/broadcast", h.BroadcastNotification,
+		am.RoleMiddleware(string(auth.RoleAdmin)))
+}
+
 // CreateNotificationRequest represents the request to create a notification
 type CreateNotificationRequest struct {
 	UserID        string  `json:"user_id"`
@@ -8,6 +8,7 @@ import (
 
 	"github.com/Bashar444/VTP/pkg/models"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 var (
@@ -196,3 +197,26 @@ func (r *Repository) BulkCreate(ctx context.Context, notifications []models.Noti
 
 	return tx.Commit()
 }
+
+// UserEmails returns the email addresses of users by user ID. Users without
+// an address are left out.
+func (r *Repository) UserEmails(ctx context.Context, userIDs []string) (map[string]string, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, email FROM users WHERE id = ANY($1::uuid[]) AND email <> ''`,
+		pq.Array(userIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails := make(map[string]string)
+	for rows.Next() {
+		var id, email string
+		if err := rows.Scan(&id, &email); err != nil {
+			return nil, err
+		}
+		emails[id] = email
+	}
+	return emails, rows.Err()
+}
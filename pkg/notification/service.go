@@ -3,9 +3,11 @@ package notification
 import (
 	"context"
 	"errors"
-	"log"
+	"html"
+	"log/slog"
 
 	"github.com/Bashar444/VTP/pkg/models"
+	"github.com/Bashar444/VTP/pkg/monitoring"
 )
 
 var (
@@ -50,29 +52,52 @@ type PushSender interface {
 	SendPush(ctx context.Context, userID, title, body string, data map[string]string) error
 }
 
+// InviteSender sends emails carrying an iCalendar invitation
+type InviteSender interface {
+	SendInvite(to, subject, bodyHTML, bodyText string, invite []byte, method string) error
+}
+
 // Service handles notification business logic
 type Service struct {
-	repo        *Repository
-	emailSender EmailSender
-	smsSender   SMSSender
-	pushSender  PushSender
-	logger      *log.Logger
+	repo         *Repository
+	emailSender  EmailSender
+	inviteSender InviteSender
+	smsSender    SMSSender
+	pushSender   PushSender
+	logger       *slog.Logger
+	deliveries   *monitoring.CounterVec
 }
 
 // NewService creates a new notification service
-func NewService(repo *Repository, logger *log.Logger) *Service {
+func NewService(repo *Repository, logger *slog.Logger) *Service {
+	if logger == nil {
+		logger = slog.Default().With("component", "notification")
+	}
 	return &Service{
 		repo:   repo,
 		logger: logger,
 	}
 }
 
+// WithMetrics records delivery outcomes per channel in the registry
+func (s *Service) WithMetrics(reg *monitoring.Registry) *Service {
+	s.deliveries = reg.NewCounterVec("vtp_notification_deliveries_total",
+		"Notification delivery attempts by channel and outcome.", "channel", "status")
+	return s
+}
+
 // WithEmailSender sets the email sender
 func (s *Service) WithEmailSender(sender EmailSender) *Service {
 	s.emailSender = sender
 	return s
 }
 
+// WithInviteSender sets the sender of meeting invitation emails
+func (s *Service) WithInviteSender(sender InviteSender) *Service {
+	s.inviteSender = sender
+	return s
+}
+
 // WithSMSSender sets the SMS sender
 func (s *Service) WithSMSSender(sender SMSSender) *Service {
 	s.smsSender = sender
@@ -104,8 +129,9 @@ func (s *Service) CreateNotification(ctx context.Context, n *models.Notification
 		return err
 	}
 
-	// Async send based on channel
-	go s.deliverNotification(context.Background(), n)
+	// Async send based on channel. The delivery outlives the request but
+	// keeps its context values for logging.
+	go s.deliverNotification(context.WithoutCancel(ctx), n)
 
 	return nil
 }
@@ -137,13 +163,15 @@ func (s *Service) deliverNotification(ctx context.Context, n *models.Notificatio
 	status := "delivered"
 	if err != nil {
 		status = "failed"
-		if s.logger != nil {
-			s.logger.Printf("Failed to deliver notification %s: %v", n.ID, err)
-		}
+		s.logger.ErrorContext(ctx, "Failed to deliver notification", "notification_id", n.ID, "channel", n.Channel, "error", err)
 	}
 
-	if updateErr := s.repo.UpdateDeliveryStatus(ctx, n.ID, status); updateErr != nil && s.logger != nil {
-		s.logger.Printf("Failed to update notification status %s: %v", n.ID, updateErr)
+	if s.deliveries != nil {
+		s.deliveries.Inc(n.Channel, status)
+	}
+
+	if updateErr := s.repo.UpdateDeliveryStatus(ctx, n.ID, status); updateErr != nil {
+		s.logger.ErrorContext(ctx, "Failed to update notification status", "notification_id", n.ID, "error", updateErr)
 	}
 }
 
@@ -229,6 +257,97 @@ func (s *Service) NotifyMeeting(ctx context.Context, meetingID, titleAr string,
 	return s.repo.BulkCreate(ctx, notifications)
 }
 
+// MeetingInvite is the calendar invitation for a scheduled, moved or
+// cancelled meeting
+type MeetingInvite struct {
+	MeetingID string
+	TitleAr   string
+	When      string // start as participants read it
+	Sequence  int    // 0 for a new meeting
+	Method    string // iTIP method of ICS: REQUEST or CANCEL
+	ICS       []byte
+}
+
+// NotifyMeetingInvite tells participants about a scheduled, moved or
+// cancelled meeting in the app and, when an invite sender is set, by an
+// email with the calendar invitation
+func (s *Service) NotifyMeetingInvite(ctx context.Context, invite *MeetingInvite, participantIDs []string) error {
+	titleAr, titleEn := "حصة جديدة", "New Class"
+	messageAr, messageEn := "تمت جدولة حصة: ", "A class was scheduled: "
+	switch {
+	case invite.Method == "CANCEL":
+		titleAr, titleEn = "إلغاء حصة", "Class Cancelled"
+		messageAr, messageEn = "تم إلغاء الحصة: ", "The class was cancelled: "
+	case invite.Sequence > 0:
+		titleAr, titleEn = "تغيير موعد حصة", "Class Rescheduled"
+		messageAr, messageEn = "تم تغيير موعد الحصة: ", "The class was rescheduled: "
+	}
+	messageAr += invite.TitleAr + " - " + invite.When
+	messageEn += invite.TitleAr + " - " + invite.When
+
+	var notifications []models.Notification
+	refType := "meeting"
+	for _, participantID := range participantIDs {
+		notifications = append(notifications, models.Notification{
+			UserID:        participantID,
+			TitleAr:       titleAr,
+			TitleEn:       titleEn,
+			MessageAr:     messageAr,
+			MessageEn:     messageEn,
+			Type:          "meeting",
+			Channel:       "in_app",
+			ReferenceType: &refType,
+			ReferenceID:   &invite.MeetingID,
+		})
+	}
+	if err := s.repo.BulkCreate(ctx, notifications); err != nil {
+		return err
+	}
+
+	if s.inviteSender == nil || len(invite.ICS) == 0 {
+		return nil
+	}
+	emails, err := s.repo.UserEmails(ctx, participantIDs)
+	if err != nil {
+		return err
+	}
+	bodyText := messageAr + "\n\n" + messageEn
+	bodyHTML := "<p dir=\"rtl\">" + html.EscapeString(messageAr) + "</p><p>" + html.EscapeString(messageEn) + "</p>"
+	for userID, to := range emails {
+		status := "delivered"
+		if err := s.inviteSender.SendInvite(to, titleAr+" | "+titleEn, bodyHTML, bodyText, invite.ICS, invite.Method); err != nil {
+			status = "failed"
+			s.logger.ErrorContext(ctx, "Failed to email meeting invitation", "meeting_id", invite.MeetingID, "user_id", userID, "error", err)
+		}
+		if s.deliveries != nil {
+			s.deliveries.Inc("email", status)
+		}
+	}
+	return nil
+}
+
+// NotifyRecording tells enrolled students that a class recording is
+// available
+func (s *Service) NotifyRecording(ctx context.Context, recordingID, title string, studentIDs []string) error {
+	var notifications []models.Notification
+	refType := "recording"
+	for _, studentID := range studentIDs {
+		n := models.Notification{
+			UserID:        studentID,
+			TitleAr:       "تسجيل جديد",
+			TitleEn:       "New Recording",
+			MessageAr:     "تسجيل الحصة متاح الآن: " + title,
+			MessageEn:     "The class recording is now available: " + title,
+			Type:          "info",
+			Channel:       "in_app",
+			ReferenceType: &refType,
+			ReferenceID:   &recordingID,
+		}
+		notifications = append(notifications, n)
+	}
+	return s.repo.BulkCreate(ctx, notifications)
+}
+
 // NotifyGrade sends grade notification to a student
 func (s *Service) NotifyGrade(ctx context.Context, studentID, subjectName string, grade int, maxGrade int) error {
 	gradeType := "grade"
@@ -0,0 +1,67 @@
+package poll
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/Bashar444/VTP/pkg/auth"
+	"github.com/Bashar444/VTP/pkg/course"
+	"github.com/Bashar444/VTP/pkg/models"
+	"github.com/Bashar444/VTP/pkg/router"
+	"github.com/Bashar444/VTP/pkg/utils"
+)
+
+// Handler handles HTTP requests for meeting polls
+type Handler struct {
+	service *Service
+}
+
+// NewHandler creates a new poll handler
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// RegisterRoutes registers poll routes. Polls are held over the live
+// session's socket; only their stored results are served here, scoped to
+// the meeting's course.
+func (h *Handler) RegisterRoutes(rt *router.Router, am *auth.AuthMiddleware, authz *course.CourseAuthorizer) {
+	api := rt.With(am.Middleware)
+
+	api.HandleFunc("GET /api/v1/meetings/{id}/polls", h.GetMeetingPolls,
+		authz.Require(authz.MeetingScope("id"), course.MemberRoles...))
+}
+
+// GetMeetingPolls handles GET /api/v1/meetings/{id}/polls. Course staff
+// see every vote; others see the tallies and their own votes.
+func (h *Handler) GetMeetingPolls(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserID(r)
+	if err != nil {
+		utils.WriteErr(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	meetingID := utils.Param(r, "id")
+	polls, err := h.service.GetMeetingPolls(r.Context(), meetingID)
+	if err != nil {
+		utils.WriteErr(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	role, _ := r.Context().Value("course_role").(string)
+	if !slices.Contains(course.StaffRoles, role) {
+		for i := range polls {
+			own := []models.PollVote{}
+			for _, vote := range polls[i].Votes {
+				if vote.UserID == userID {
+					own = append(own, vote)
+				}
+			}
+			polls[i].Votes = own
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"meeting_id": meetingID,
+		"polls":      polls,
+	})
+}
@@ -0,0 +1,219 @@
+package poll
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/models"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrMeetingNotFound = errors.New("no meeting for this room")
+)
+
+// Grade is a participation grade earned in a poll
+type Grade struct {
+	StudentID    string
+	SubjectID    string
+	SchoolTermID string
+	MaxPoints    int
+	PointsEarned int
+	Notes        string
+	GradedBy     string
+}
+
+// Repository handles poll data persistence
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository creates a new poll repository
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// RoomMeeting is the meeting a poll was held in
+type RoomMeeting struct {
+	ID        string
+	SubjectID string
+	CourseID  string
+	StudentID string // the invited student of a 1:1 meeting
+}
+
+// MeetingForRoom returns the meeting held in a live session room closest
+// to a time, as a series shares one room across its occurrences
+func (r *Repository) MeetingForRoom(ctx context.Context, roomID string, at time.Time) (*RoomMeeting, error) {
+	query := `
+		SELECT id, COALESCE(subject_id::text, ''), COALESCE(course_id::text, ''), COALESCE(student_id::text, '')
+		FROM meetings
+		WHERE room_id = $1 AND status <> 'cancelled'
+		ORDER BY ABS(EXTRACT(EPOCH FROM (scheduled_at - $2::timestamptz)))
+		LIMIT 1
+	`
+	var m RoomMeeting
+	err := r.db.QueryRowContext(ctx, query, roomID, at).Scan(&m.ID, &m.SubjectID, &m.CourseID, &m.StudentID)
+	if err == sql.ErrNoRows {
+		return nil, ErrMeetingNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// TermAt returns the school term covering a date, preferring the active
+// one, or "" if there is none
+func (r *Repository) TermAt(ctx context.Context, at time.Time) (string, error) {
+	query := `
+		SELECT id FROM school_terms
+		WHERE $1::date BETWEEN start_date AND end_date
+		ORDER BY is_active DESC, start_date DESC
+		LIMIT 1
+	`
+	var termID string
+	err := r.db.QueryRowContext(ctx, query, at).Scan(&termID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return termID, err
+}
+
+// Save stores a closed poll with its votes and the grades it earned. A
+// poll is only stored once; saving it again reports false and changes
+// nothing.
+func (r *Repository) Save(ctx context.Context, p *models.MeetingPoll, grades []Grade) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO meeting_polls (
+			id, meeting_id, created_by, question, options, multiple, anonymous,
+			points, correct_options, tallies, voters, opened_at, closed_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (id) DO NOTHING
+	`,
+		p.ID, p.MeetingID, nullString(p.CreatedBy), p.Question, pq.Array(p.Options), p.Multiple, p.Anonymous,
+		p.Points, pq.Array(p.Correct), pq.Array(p.Tallies), p.Voters, p.OpenedAt, p.ClosedAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to insert poll: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	for _, vote := range p.Votes {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO meeting_poll_votes (poll_id, user_id, choices) VALUES ($1, $2, $3)
+		`, p.ID, vote.UserID, pq.Array(vote.Choices))
+		if err != nil {
+			return false, fmt.Errorf("failed to insert poll vote: %w", err)
+		}
+	}
+
+	for _, g := range grades {
+		percentage := 0.0
+		if g.MaxPoints > 0 {
+			percentage = float64(g.PointsEarned) * 100 / float64(g.MaxPoints)
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO student_grades (
+				student_id, subject_id, school_term_id, grade_type,
+				max_points, points_earned, percentage, notes, graded_by
+			) VALUES ($1, $2, $3, 'participation', $4, $5, $6, $7, $8)
+		`, g.StudentID, g.SubjectID, g.SchoolTermID, g.MaxPoints, g.PointsEarned, percentage,
+			g.Notes, nullString(g.GradedBy))
+		if err != nil {
+			return false, fmt.Errorf("failed to insert participation grade: %w", err)
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+// ListByMeeting returns the polls of a meeting in the order they were
+// held, with their votes
+func (r *Repository) ListByMeeting(ctx context.Context, meetingID string) ([]models.MeetingPoll, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, meeting_id, COALESCE(created_by::text, ''), question, options, multiple, anonymous,
+			points, correct_options, tallies, voters, opened_at, closed_at
+		FROM meeting_polls
+		WHERE meeting_id = $1
+		ORDER BY opened_at
+	`, meetingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var polls []models.MeetingPoll
+	index := make(map[string]int)
+	for rows.Next() {
+		var p models.MeetingPoll
+		var correct, tallies pq.Int64Array
+		if err := rows.Scan(
+			&p.ID, &p.MeetingID, &p.CreatedBy, &p.Question, pq.Array(&p.Options), &p.Multiple, &p.Anonymous,
+			&p.Points, &correct, &tallies, &p.Voters, &p.OpenedAt, &p.ClosedAt,
+		); err != nil {
+			return nil, err
+		}
+		p.Correct = ints(correct)
+		p.Tallies = ints(tallies)
+		index[p.ID] = len(polls)
+		polls = append(polls, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(polls) == 0 {
+		return polls, nil
+	}
+
+	voteRows, err := r.db.QueryContext(ctx, `
+		SELECT v.poll_id, v.user_id, v.choices
+		FROM meeting_poll_votes v
+		JOIN meeting_polls p ON p.id = v.poll_id
+		WHERE p.meeting_id = $1
+		ORDER BY v.user_id
+	`, meetingID)
+	if err != nil {
+		return nil, err
+	}
+	defer voteRows.Close()
+
+	for voteRows.Next() {
+		var pollID string
+		var vote models.PollVote
+		var choices pq.Int64Array
+		if err := voteRows.Scan(&pollID, &vote.UserID, &choices); err != nil {
+			return nil, err
+		}
+		vote.Choices = ints(choices)
+		if i, ok := index[pollID]; ok {
+			polls[i].Votes = append(polls[i].Votes, vote)
+		}
+	}
+	return polls, voteRows.Err()
+}
+
+func ints(values pq.Int64Array) []int {
+	out := make([]int, len(values))
+	for i, v := range values {
+		out[i] = int(v)
+	}
+	return out
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
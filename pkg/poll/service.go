@@ -0,0 +1,203 @@
+package poll
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+
+	"github.com/Bashar444/VTP/pkg/course"
+	"github.com/Bashar444/VTP/pkg/models"
+	"github.com/google/uuid"
+)
+
+// Roster lists the students of a course (*course.CourseService)
+type Roster interface {
+	ListEnrollments(ctx context.Context, courseID uuid.UUID) ([]*course.CourseEnrollment, error)
+}
+
+// Service stores the polls held in live meetings and grades them
+type Service struct {
+	repo   *Repository
+	roster Roster
+}
+
+// NewService creates a new poll service
+func NewService(repo *Repository) *Service {
+	return &Service{repo: repo}
+}
+
+// WithRoster grades the students enrolled in a meeting's course. Without a
+// roster only the invited student of a 1:1 meeting is graded.
+func (s *Service) WithRoster(roster Roster) *Service {
+	s.roster = roster
+	return s
+}
+
+// RecordPoll stores a poll closed in a live session room under the room's
+// meeting. Graded polls give every enrolled student who voted or was
+// present a participation grade in the meeting's subject for the current
+// term; anyone else in the room is not graded. It returns the number of
+// grades recorded.
+func (s *Service) RecordPoll(ctx context.Context, roomID string, p *models.MeetingPoll, students []string) (int, error) {
+	meeting, err := s.repo.MeetingForRoom(ctx, roomID, p.OpenedAt)
+	if err != nil {
+		return 0, err
+	}
+	p.MeetingID = meeting.ID
+	if !validUUID(p.CreatedBy) {
+		p.CreatedBy = ""
+	}
+
+	votes := make(map[string][]int, len(p.Votes))
+	kept := p.Votes[:0]
+	for _, vote := range p.Votes {
+		if validUUID(vote.UserID) {
+			votes[vote.UserID] = vote.Choices
+			kept = append(kept, vote)
+		}
+	}
+	p.Votes = kept
+	if p.Anonymous {
+		p.Votes = nil
+	}
+
+	var grades []Grade
+	if p.Points > 0 && !p.Anonymous {
+		switch termID, err := s.repo.TermAt(ctx, p.ClosedAt); {
+		case err != nil:
+			return 0, fmt.Errorf("failed to find school term: %w", err)
+		case meeting.SubjectID == "" || termID == "":
+			slog.WarnContext(ctx, "Poll not graded, its meeting has no subject or term",
+				"poll_id", p.ID, "meeting_id", meeting.ID)
+		default:
+			enrolled, err := s.enrolledStudents(ctx, meeting)
+			if err != nil {
+				return 0, err
+			}
+			grades = participationGrades(p, votes, enrolledOnly(students, enrolled), meeting.SubjectID, termID)
+		}
+	}
+
+	saved, err := s.repo.Save(ctx, p, grades)
+	if err != nil || !saved {
+		return 0, err
+	}
+	return len(grades), nil
+}
+
+// enrolledStudents returns the students who may be graded in a meeting:
+// the active enrollments of its course and its invited student
+func (s *Service) enrolledStudents(ctx context.Context, m *RoomMeeting) (map[string]bool, error) {
+	enrolled := make(map[string]bool)
+	if m.StudentID != "" {
+		enrolled[m.StudentID] = true
+	}
+	if m.CourseID == "" || s.roster == nil {
+		return enrolled, nil
+	}
+
+	courseID, err := uuid.Parse(m.CourseID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid course ID: %w", err)
+	}
+	enrollments, err := s.roster.ListEnrollments(ctx, courseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list enrollments: %w", err)
+	}
+	for _, enrollment := range enrollments {
+		if enrollment.Status == course.EnrollmentActive {
+			enrolled[enrollment.StudentID.String()] = true
+		}
+	}
+	return enrolled, nil
+}
+
+// enrolledOnly drops the users who are not enrolled students
+func enrolledOnly(students []string, enrolled map[string]bool) []string {
+	kept := make([]string, 0, len(students))
+	for _, studentID := range students {
+		if enrolled[studentID] {
+			kept = append(kept, studentID)
+		}
+	}
+	return kept
+}
+
+// GetMeetingPolls returns the polls held in a meeting
+func (s *Service) GetMeetingPolls(ctx context.Context, meetingID string) ([]models.MeetingPoll, error) {
+	return s.repo.ListByMeeting(ctx, meetingID)
+}
+
+// participationGrades grades the students of a poll. Voters earn the
+// poll's points when their vote is correct; students who were present
+// without voting earn none.
+func participationGrades(p *models.MeetingPoll, votes map[string][]int, students []string, subjectID, termID string) []Grade {
+	grades := make([]Grade, 0, len(students))
+	for _, studentID := range students {
+		if !validUUID(studentID) {
+			continue
+		}
+		earned := 0
+		if choices, voted := votes[studentID]; voted && correct(p, choices) {
+			earned = p.Points
+		}
+		grades = append(grades, Grade{
+			StudentID:    studentID,
+			SubjectID:    subjectID,
+			SchoolTermID: termID,
+			MaxPoints:    p.Points,
+			PointsEarned: earned,
+			Notes:        "Live poll: " + p.Question,
+			GradedBy:     p.CreatedBy,
+		})
+	}
+	return grades
+}
+
+// correct reports whether a vote earns a poll's points. Without correct
+// options every vote does; a single choice must be one of them, and
+// several choices must be exactly them.
+func correct(p *models.MeetingPoll, choices []int) bool {
+	if len(p.Correct) == 0 {
+		return len(choices) > 0
+	}
+	if !p.Multiple {
+		for _, option := range p.Correct {
+			if len(choices) == 1 && choices[0] == option {
+				return true
+			}
+		}
+		return false
+	}
+
+	want := distinct(p.Correct)
+	got := distinct(choices)
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func distinct(values []int) []int {
+	seen := make(map[int]bool, len(values))
+	out := make([]int, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	sort.Ints(out)
+	return out
+}
+
+func validUUID(s string) bool {
+	_, err := uuid.Parse(s)
+	return err == nil
+}
@@ -0,0 +1,84 @@
+package poll
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Bashar444/VTP/pkg/course"
+	"github.com/Bashar444/VTP/pkg/models"
+	"github.com/google/uuid"
+)
+
+// TestParticipationGrades tests that correct voters earn the poll's
+// points and present students who did not vote earn none
+func TestParticipationGrades(t *testing.T) {
+	right, wrong, silent := uuid.New().String(), uuid.New().String(), uuid.New().String()
+	p := &models.MeetingPoll{Question: "Which are primes?", Multiple: true, Points: 2, Correct: []int{2, 0}}
+	votes := map[string][]int{
+		right: {0, 2},
+		wrong: {0},
+	}
+
+	grades := participationGrades(p, votes, []string{right, wrong, silent, "not-a-user"}, "subject", "term")
+	if len(grades) != 3 {
+		t.Fatalf("Expected 3 grades, got %d", len(grades))
+	}
+	earned := map[string]int{}
+	for _, g := range grades {
+		if g.MaxPoints != 2 || g.SubjectID != "subject" || g.SchoolTermID != "term" {
+			t.Errorf("Unexpected grade %+v", g)
+		}
+		earned[g.StudentID] = g.PointsEarned
+	}
+	if earned[right] != 2 || earned[wrong] != 0 || earned[silent] != 0 {
+		t.Errorf("Unexpected points %v", earned)
+	}
+}
+
+// TestCorrectVotes tests which votes earn a poll's points
+func TestCorrectVotes(t *testing.T) {
+	single := &models.MeetingPoll{Correct: []int{1, 3}}
+	if !correct(single, []int{3}) || correct(single, []int{0}) {
+		t.Error("Expected a single choice to earn points when it is one of the correct options")
+	}
+	open := &models.MeetingPoll{}
+	if !correct(open, []int{0}) || correct(open, nil) {
+		t.Error("Expected any vote to earn points without correct options")
+	}
+	multiple := &models.MeetingPoll{Multiple: true, Correct: []int{1, 3}}
+	if !correct(multiple, []int{3, 1}) || correct(multiple, []int{1}) || correct(multiple, []int{1, 2, 3}) {
+		t.Error("Expected several choices to earn points only when they are exactly the correct options")
+	}
+}
+
+// fakeRoster lists the enrollments of every course
+type fakeRoster []*course.CourseEnrollment
+
+func (f fakeRoster) ListEnrollments(ctx context.Context, courseID uuid.UUID) ([]*course.CourseEnrollment, error) {
+	return f, nil
+}
+
+// TestEnrolledStudents tests that only active students of the meeting's
+// course and its invited student are graded
+func TestEnrolledStudents(t *testing.T) {
+	enrolled, dropped, invited, outsider := uuid.New(), uuid.New(), uuid.New().String(), uuid.New().String()
+	s := NewService(nil).WithRoster(fakeRoster{
+		{StudentID: enrolled, Status: course.EnrollmentActive},
+		{StudentID: dropped, Status: "dropped"},
+	})
+
+	students, err := s.enrolledStudents(context.Background(), &RoomMeeting{CourseID: uuid.New().String(), StudentID: invited})
+	if err != nil {
+		t.Fatal(err)
+	}
+	graded := enrolledOnly([]string{enrolled.String(), dropped.String(), invited, outsider}, students)
+	if len(graded) != 2 || graded[0] != enrolled.String() || graded[1] != invited {
+		t.Errorf("Expected the enrolled and invited students graded, got %v", graded)
+	}
+
+	// Without a course only the invited student is graded
+	students, _ = s.enrolledStudents(context.Background(), &RoomMeeting{})
+	if graded := enrolledOnly([]string{enrolled.String(), outsider}, students); len(graded) != 0 {
+		t.Errorf("Expected nobody graded, got %v", graded)
+	}
+}
@@ -2,10 +2,13 @@ package recording
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"strings"
 
+	"github.com/Bashar444/VTP/pkg/auth"
+	"github.com/Bashar444/VTP/pkg/course"
+	"github.com/Bashar444/VTP/pkg/logging"
+	"github.com/Bashar444/VTP/pkg/router"
 	"github.com/google/uuid"
 )
 
@@ -13,11 +16,15 @@ import (
 type StorageHandlers struct {
 	storageManager *StorageManager
 	service        *RecordingService
-	logger         *log.Logger
+	sharing        *SharingService
+	logger         *slog.Logger
 }
 
 // NewStorageHandlers creates new storage handlers
-func NewStorageHandlers(storageManager *StorageManager, service *RecordingService, logger *log.Logger) *StorageHandlers {
+func NewStorageHandlers(storageManager *StorageManager, service *RecordingService, logger *slog.Logger) *StorageHandlers {
+	if logger == nil {
+		logger = logging.Discard()
+	}
 	return &StorageHandlers{
 		storageManager: storageManager,
 		service:        service,
@@ -25,6 +32,14 @@ func NewStorageHandlers(storageManager *StorageManager, service *RecordingServic
 	}
 }
 
+// WithSharing checks downloads against the recording's shares and logs
+// every download. Without it only members of the recording's course can
+// download it.
+func (h *StorageHandlers) WithSharing(sharing *SharingService) *StorageHandlers {
+	h.sharing = sharing
+	return h
+}
+
 // DownloadRecordingHandler handles GET /api/v1/recordings/{id}/download
 func (h *StorageHandlers) DownloadRecordingHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -32,9 +47,8 @@ func (h *StorageHandlers) DownloadRecordingHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	// Extract recording ID from URL
-	recordingIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/recordings/")
-	recordingIDStr = strings.TrimSuffix(recordingIDStr, "/download")
+	// Extract recording ID from the route
+	recordingIDStr := r.PathValue("id")
 
 	recordingID, err := uuid.Parse(recordingIDStr)
 	if err != nil {
@@ -42,17 +56,20 @@ func (h *StorageHandlers) DownloadRecordingHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	// Get user ID from context or header
-	userID, err := h.getUserID(r)
-	if err != nil {
-		h.writeError(w, http.StatusUnauthorized, "Unauthorized")
-		return
+	// Link holders download without an account
+	var userID uuid.UUID
+	if h.sharing == nil {
+		userID, err = h.getUserID(r)
+		if err != nil {
+			h.writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
 	}
 
 	// Get recording to verify it exists and user has access
 	recording, err := h.service.GetRecording(r.Context(), recordingID)
 	if err != nil {
-		h.logger.Printf("Failed to get recording %s: %v", recordingID, err)
+		h.logger.ErrorContext(r.Context(), "Failed to get recording", "recording_id", recordingID, "error", err)
 		h.writeError(w, http.StatusInternalServerError, "Failed to get recording")
 		return
 	}
@@ -68,9 +85,24 @@ func (h *StorageHandlers) DownloadRecordingHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
+	if h.sharing != nil {
+		grant, err := h.sharing.CheckAccess(r, recordingID, AccessActionDownload)
+		if err != nil {
+			status, message := accessErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				h.logger.ErrorContext(r.Context(), "Failed to check recording access", "recording_id", recordingID, "error", err)
+			}
+			h.writeError(w, status, message)
+			return
+		}
+		if grant.UserID != nil {
+			userID = *grant.UserID
+		}
+	}
+
 	// Download recording
 	if err := h.storageManager.DownloadRecording(r.Context(), recordingID, w); err != nil {
-		h.logger.Printf("Failed to download recording %s: %v", recordingID, err)
+		h.logger.ErrorContext(r.Context(), "Failed to download recording", "recording_id", recordingID, "error", err)
 		h.writeError(w, http.StatusInternalServerError, "Failed to download recording")
 		return
 	}
@@ -79,7 +111,7 @@ func (h *StorageHandlers) DownloadRecordingHandler(w http.ResponseWriter, r *htt
 	w.Header().Set("Content-Type", "video/webm")
 	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.webm"`, recording.Title))
 
-	h.logger.Printf("Recording downloaded: %s by user %s", recordingID, userID)
+	h.logger.InfoContext(r.Context(), "Recording downloaded", "recording_id", recordingID, "user_id", userID)
 }
 
 // GetDownloadURLHandler handles GET /api/v1/recordings/{id}/download-url
@@ -89,9 +121,8 @@ func (h *StorageHandlers) GetDownloadURLHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	// Extract recording ID from URL
-	recordingIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/recordings/")
-	recordingIDStr = strings.TrimSuffix(recordingIDStr, "/download-url")
+	// Extract recording ID from the route
+	recordingIDStr := r.PathValue("id")
 
 	recordingID, err := uuid.Parse(recordingIDStr)
 	if err != nil {
@@ -102,7 +133,7 @@ func (h *StorageHandlers) GetDownloadURLHandler(w http.ResponseWriter, r *http.R
 	// Get recording
 	recording, err := h.service.GetRecording(r.Context(), recordingID)
 	if err != nil {
-		h.logger.Printf("Failed to get recording %s: %v", recordingID, err)
+		h.logger.ErrorContext(r.Context(), "Failed to get recording", "recording_id", recordingID, "error", err)
 		h.writeError(w, http.StatusInternalServerError, "Failed to get recording")
 		return
 	}
@@ -122,7 +153,7 @@ func (h *StorageHandlers) GetDownloadURLHandler(w http.ResponseWriter, r *http.R
 	expiresIn := 24 * 60 * 60 // 24 hours in seconds
 	url, err := h.storageManager.GetRecordingURL(r.Context(), recordingID, 0)
 	if err != nil {
-		h.logger.Printf("Failed to get download URL: %v", err)
+		h.logger.ErrorContext(r.Context(), "Failed to get download URL", "recording_id", recordingID, "error", err)
 		h.writeError(w, http.StatusInternalServerError, "Failed to generate download URL")
 		return
 	}
@@ -144,9 +175,8 @@ func (h *StorageHandlers) GetRecordingInfoHandler(w http.ResponseWriter, r *http
 		return
 	}
 
-	// Extract recording ID from URL
-	recordingIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/recordings/")
-	recordingIDStr = strings.TrimSuffix(recordingIDStr, "/info")
+	// Extract recording ID from the route
+	recordingIDStr := r.PathValue("id")
 
 	recordingID, err := uuid.Parse(recordingIDStr)
 	if err != nil {
@@ -157,7 +187,7 @@ func (h *StorageHandlers) GetRecordingInfoHandler(w http.ResponseWriter, r *http
 	// Get recording
 	recording, err := h.service.GetRecording(r.Context(), recordingID)
 	if err != nil {
-		h.logger.Printf("Failed to get recording %s: %v", recordingID, err)
+		h.logger.ErrorContext(r.Context(), "Failed to get recording", "recording_id", recordingID, "error", err)
 		h.writeError(w, http.StatusInternalServerError, "Failed to get recording")
 		return
 	}
@@ -170,7 +200,7 @@ func (h *StorageHandlers) GetRecordingInfoHandler(w http.ResponseWriter, r *http
 	// Get file size
 	fileSize, err := h.storageManager.GetRecordingSize(r.Context(), recordingID)
 	if err != nil {
-		h.logger.Printf("Failed to get file size: %v", err)
+		h.logger.ErrorContext(r.Context(), "Failed to get file size", "recording_id", recordingID, "error", err)
 		// Continue without file size
 	}
 
@@ -228,48 +258,28 @@ func (h *StorageHandlers) writeError(w http.ResponseWriter, status int, message
 	fmt.Fprintf(w, `{"error":"%s","status":%d}`, message, status)
 }
 
-// getUserID extracts user ID from request context or header
+// getUserID returns the authenticated user set by the auth middleware
 func (h *StorageHandlers) getUserID(r *http.Request) (uuid.UUID, error) {
-	// Try to get from header first (X-User-ID)
-	userIDStr := r.Header.Get("X-User-ID")
-	if userIDStr != "" {
+	if userIDStr, ok := r.Context().Value("user_id").(string); ok {
 		if userID, err := uuid.Parse(userIDStr); err == nil {
 			return userID, nil
 		}
 	}
 
-	// Try to get from context (set by auth middleware)
-	if userID, ok := r.Context().Value("user_id").(uuid.UUID); ok {
-		return userID, nil
-	}
-
 	return uuid.Nil, fmt.Errorf("user ID not found in request")
 }
 
 // RegisterStorageRoutes registers all storage-related routes
-func (h *StorageHandlers) RegisterStorageRoutes(mux *http.ServeMux) {
-	// Download endpoints
-	mux.HandleFunc("/api/v1/recordings/{id}/download", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			h.DownloadRecordingHandler(w, r)
-		} else {
-			h.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
-		}
-	})
-
-	mux.HandleFunc("/api/v1/recordings/{id}/download-url", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			h.GetDownloadURLHandler(w, r)
-		} else {
-			h.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
-		}
-	})
-
-	mux.HandleFunc("/api/v1/recordings/{id}/info", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			h.GetRecordingInfoHandler(w, r)
-		} else {
-			h.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
-		}
-	})
+func (h *StorageHandlers) RegisterStorageRoutes(rt *router.Router, am *auth.AuthMiddleware, authz *course.CourseAuthorizer) {
+	api := rt.With(am.Middleware, authz.Require(authz.RecordingScope("id"), course.MemberRoles...))
+
+	// With sharing the handler checks access itself, so link holders
+	// without an account can download
+	if h.sharing != nil {
+		rt.With(am.OptionalAuthMiddleware).HandleFunc("GET /api/v1/recordings/{id}/download", h.DownloadRecordingHandler)
+	} else {
+		api.HandleFunc("GET /api/v1/recordings/{id}/download", h.DownloadRecordingHandler)
+	}
+	api.HandleFunc("GET /api/v1/recordings/{id}/download-url", h.GetDownloadURLHandler)
+	api.HandleFunc("GET /api/v1/recordings/{id}/info", h.GetRecordingInfoHandler)
 }
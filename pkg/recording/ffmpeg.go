@@ -4,7 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -17,6 +17,7 @@ type FFmpegProcess struct {
 	mu             sync.Mutex
 	cmd            *exec.Cmd
 	stdin          io.WriteCloser
+	audio          io.WriteCloser
 	stderr         io.ReadCloser
 	recordingID    string
 	outputPath     string
@@ -27,8 +28,9 @@ type FFmpegProcess struct {
 	lastError      string
 	errorChan      chan error
 	stopChan       chan bool
-	logger         *log.Logger
+	logger         *slog.Logger
 	isRunning      bool
+	interactive    bool // stdin carries FFmpeg keyboard commands
 }
 
 // FFmpegConfig contains FFmpeg configuration
@@ -40,6 +42,14 @@ type FFmpegConfig struct {
 	VideoCodec  string
 	AudioCodec  string
 	Format      string
+	FFmpegPath  string // defaults to ffmpeg on PATH
+}
+
+func (c *FFmpegConfig) binary() string {
+	if c.FFmpegPath != "" {
+		return c.FFmpegPath
+	}
+	return "ffmpeg"
 }
 
 // DefaultFFmpegConfig returns default FFmpeg configuration
@@ -56,13 +66,13 @@ func DefaultFFmpegConfig() *FFmpegConfig {
 }
 
 // NewFFmpegProcess creates a new FFmpeg process
-func NewFFmpegProcess(recordingID string, config *FFmpegConfig, logger *log.Logger) *FFmpegProcess {
+func NewFFmpegProcess(recordingID string, config *FFmpegConfig, logger *slog.Logger) *FFmpegProcess {
 	if config == nil {
 		config = DefaultFFmpegConfig()
 	}
 
 	if logger == nil {
-		logger = log.New(os.Stderr, "[FFmpeg] ", log.LstdFlags)
+		logger = slog.Default().With("component", "ffmpeg")
 	}
 
 	// Ensure output directory exists
@@ -97,17 +107,27 @@ func (fp *FFmpegProcess) StartFFmpeg(ctx context.Context, config *FFmpegConfig)
 		config = DefaultFFmpegConfig()
 	}
 
+	// Audio is passed on an extra pipe, which FFmpeg sees as fd 3
+	audioR, audioW, err := os.Pipe()
+	if err != nil {
+		fp.lastError = err.Error()
+		fp.status = "failed"
+		return fmt.Errorf("failed to create audio pipe: %w", err)
+	}
+
 	// Build FFmpeg command
 	args := []string{
+		"-thread_queue_size", "512",
 		"-f", "rawvideo",
 		"-pixel_format", "yuv420p",
 		"-video_size", config.Resolution,
 		"-framerate", fmt.Sprintf("%d", config.FrameRate),
 		"-i", "pipe:0", // Video from stdin
+		"-thread_queue_size", "512",
 		"-f", "s16le", // Audio format: signed 16-bit little-endian
 		"-sample_rate", "48000", // Standard audio sample rate
 		"-channels", "2", // Stereo
-		"-i", "pipe:1", // Audio from stdin
+		"-i", "pipe:3", // Audio from the extra pipe
 		"-c:v", config.VideoCodec,
 		"-b:v", fmt.Sprintf("%dk", config.BitrateKbps),
 		"-c:a", config.AudioCodec,
@@ -116,7 +136,74 @@ func (fp *FFmpegProcess) StartFFmpeg(ctx context.Context, config *FFmpegConfig)
 		fp.outputPath,
 	}
 
-	fp.cmd = exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd := exec.CommandContext(ctx, config.binary(), args...)
+	cmd.ExtraFiles = []*os.File{audioR}
+
+	err = fp.start(cmd)
+	// The child has its own copy of the read end
+	audioR.Close()
+	if err != nil {
+		audioW.Close()
+		return err
+	}
+	fp.audio = audioW
+
+	fp.logger.InfoContext(ctx, "FFmpeg process started", "recording_id", fp.recordingID, "output", fp.outputPath)
+	return nil
+}
+
+// StartRTP launches FFmpeg with arguments built by rtpIngestArgs or
+// rtpCompositeArgs to receive RTP streams described by an SDP file. FFmpeg
+// aligns the streams using the RTCP sender reports, so RTCP must reach it
+// alongside RTP. Stdin is kept for keyboard commands: filter commands are
+// sent with SendCommand and the process is stopped by sending "q", which
+// lets FFmpeg write the trailer.
+func (fp *FFmpegProcess) StartRTP(ctx context.Context, args []string, config *FFmpegConfig) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	if fp.isRunning {
+		return fmt.Errorf("FFmpeg process already running for %s", fp.recordingID)
+	}
+
+	if config == nil {
+		config = DefaultFFmpegConfig()
+	}
+
+	cmd := exec.CommandContext(ctx, config.binary(), args...)
+	if err := fp.start(cmd); err != nil {
+		return err
+	}
+	fp.interactive = true
+
+	fp.logger.InfoContext(ctx, "FFmpeg RTP ingest started", "recording_id", fp.recordingID, "output", fp.outputPath)
+	return nil
+}
+
+// SendCommand sends a command to a named filter of a running RTP ingest,
+// e.g. target "overlay@o1", command "x" and arg "640". FFmpeg reads one
+// keyboard command about every 100ms, so commands queue up on stdin.
+func (fp *FFmpegProcess) SendCommand(target, command, arg string) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	if !fp.isRunning || !fp.interactive || fp.stdin == nil {
+		return fmt.Errorf("FFmpeg process does not accept commands")
+	}
+
+	// "c" is followed by: target time command argument, where time -1 means
+	// now
+	if _, err := fmt.Fprintf(fp.stdin, "c%s -1 %s %s\n", target, command, arg); err != nil {
+		fp.lastError = err.Error()
+		return fmt.Errorf("failed to send filter command: %w", err)
+	}
+	return nil
+}
+
+// start runs cmd with stdin and stderr pipes attached. The caller holds
+// fp.mu.
+func (fp *FFmpegProcess) start(cmd *exec.Cmd) error {
+	fp.cmd = cmd
 
 	// Set up pipes
 	var err error
@@ -149,7 +236,6 @@ func (fp *FFmpegProcess) StartFFmpeg(ctx context.Context, config *FFmpegConfig)
 	// Start monitoring goroutine
 	go fp.monitorProcess()
 
-	fp.logger.Printf("FFmpeg process started for recording %s, output: %s", fp.recordingID, fp.outputPath)
 	return nil
 }
 
@@ -169,10 +255,17 @@ func (fp *FFmpegProcess) StopFFmpeg(ctx context.Context) error {
 		return fmt.Errorf("FFmpeg process not running")
 	}
 
-	// Close stdin to signal end of input to FFmpeg
+	// Close the inputs to signal end of input to FFmpeg. RTP input has no
+	// end, so FFmpeg is asked to quit instead.
 	if fp.stdin != nil {
+		if fp.interactive {
+			io.WriteString(fp.stdin, "q")
+		}
 		fp.stdin.Close()
 	}
+	if fp.audio != nil {
+		fp.audio.Close()
+	}
 
 	// Wait for process to finish with timeout
 	done := make(chan error, 1)
@@ -183,7 +276,7 @@ func (fp *FFmpegProcess) StopFFmpeg(ctx context.Context) error {
 	select {
 	case err := <-done:
 		if err != nil && err.Error() != "exit status 0" {
-			fp.logger.Printf("FFmpeg exited with error: %v", err)
+			fp.logger.WarnContext(ctx, "FFmpeg exited with error", "recording_id", fp.recordingID, "error", err)
 		}
 	case <-ctx.Done():
 		fp.cmd.Process.Kill()
@@ -195,7 +288,7 @@ func (fp *FFmpegProcess) StopFFmpeg(ctx context.Context) error {
 	fp.isRunning = false
 	fp.mu.Unlock()
 
-	fp.logger.Printf("FFmpeg process stopped for recording %s", fp.recordingID)
+	fp.logger.InfoContext(ctx, "FFmpeg process stopped", "recording_id", fp.recordingID)
 	return nil
 }
 
@@ -235,12 +328,12 @@ func (fp *FFmpegProcess) WriteAudioFrame(data []byte) error {
 		return fmt.Errorf("FFmpeg process not running")
 	}
 
-	if fp.stdin == nil {
-		return fmt.Errorf("stdin not available")
+	if fp.audio == nil {
+		return fmt.Errorf("audio pipe not available")
 	}
 
-	// Write audio frame (file descriptor 1)
-	_, err := fp.stdin.Write(data)
+	// Write audio frame (file descriptor 3)
+	_, err := fp.audio.Write(data)
 	if err != nil {
 		fp.lastError = err.Error()
 		fp.status = "error"
@@ -315,7 +408,7 @@ func (fp *FFmpegProcess) monitorProcess() {
 
 		// Log FFmpeg output for debugging
 		if n > 0 {
-			fp.logger.Printf("FFmpeg: %s", string(data[:n]))
+			fp.logger.Debug("FFmpeg output", "recording_id", fp.recordingID, "output", string(data[:n]))
 		}
 	}
 }
@@ -350,6 +443,10 @@ func (fp *FFmpegProcess) Cleanup() error {
 		fp.stdin.Close()
 	}
 
+	if fp.audio != nil {
+		fp.audio.Close()
+	}
+
 	if fp.stderr != nil {
 		fp.stderr.Close()
 	}
@@ -360,3 +457,74 @@ func (fp *FFmpegProcess) Cleanup() error {
 
 	return nil
 }
+
+// ProcessRegistry tracks running FFmpeg processes by recording ID so they can
+// be finalized when the server shuts down
+type ProcessRegistry struct {
+	mu        sync.Mutex
+	processes map[string]*FFmpegProcess
+	logger    *slog.Logger
+}
+
+// NewProcessRegistry creates an empty process registry
+func NewProcessRegistry(logger *slog.Logger) *ProcessRegistry {
+	if logger == nil {
+		logger = slog.Default().With("component", "ffmpeg")
+	}
+	return &ProcessRegistry{
+		processes: make(map[string]*FFmpegProcess),
+		logger:    logger,
+	}
+}
+
+// Add registers a process under its recording ID
+func (pr *ProcessRegistry) Add(fp *FFmpegProcess) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.processes[fp.GetRecordingID()] = fp
+}
+
+// Remove unregisters the process for a recording and returns it
+func (pr *ProcessRegistry) Remove(recordingID string) (*FFmpegProcess, bool) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	fp, ok := pr.processes[recordingID]
+	delete(pr.processes, recordingID)
+	return fp, ok
+}
+
+// Len returns the number of registered processes
+func (pr *ProcessRegistry) Len() int {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	return len(pr.processes)
+}
+
+// StopAll closes the input of every registered process so FFmpeg writes the
+// container trailer, and waits for them to exit until ctx is done. It returns
+// the IDs of the recordings whose processes were registered.
+func (pr *ProcessRegistry) StopAll(ctx context.Context) []string {
+	pr.mu.Lock()
+	processes := pr.processes
+	pr.processes = make(map[string]*FFmpegProcess)
+	pr.mu.Unlock()
+
+	var wg sync.WaitGroup
+	ids := make([]string, 0, len(processes))
+	for id, fp := range processes {
+		ids = append(ids, id)
+		if !fp.IsRunning() {
+			continue
+		}
+		wg.Add(1)
+		go func(id string, fp *FFmpegProcess) {
+			defer wg.Done()
+			if err := fp.StopFFmpeg(ctx); err != nil {
+				pr.logger.ErrorContext(ctx, "Failed to finalize FFmpeg", "recording_id", id, "error", err)
+			}
+		}(id, fp)
+	}
+	wg.Wait()
+
+	return ids
+}
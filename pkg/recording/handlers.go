@@ -2,26 +2,33 @@ package recording
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
-	"strings"
 
+	"github.com/Bashar444/VTP/pkg/auth"
+	"github.com/Bashar444/VTP/pkg/course"
+	"github.com/Bashar444/VTP/pkg/logging"
+	"github.com/Bashar444/VTP/pkg/router"
 	"github.com/google/uuid"
 )
 
 // RecordingHandlers handles all HTTP endpoints for recordings
 type RecordingHandlers struct {
-	service *RecordingService
-	logger  *log.Logger
+	service  *RecordingService
+	sharing  *SharingService
+	pipeline *VODPipeline
+	logger   *slog.Logger
 }
 
 // NewRecordingHandlers creates a new handlers instance
-func NewRecordingHandlers(service *RecordingService, logger *log.Logger) *RecordingHandlers {
+func NewRecordingHandlers(service *RecordingService, logger *slog.Logger) *RecordingHandlers {
 	if logger == nil {
-		logger = log.New(io.Discard, "[RecordingHandlers] ", log.LstdFlags)
+		logger = logging.Discard()
 	}
 
 	return &RecordingHandlers{
@@ -30,6 +37,18 @@ func NewRecordingHandlers(service *RecordingService, logger *log.Logger) *Record
 	}
 }
 
+// WithPipeline exposes the post-processing state of recordings
+func (h *RecordingHandlers) WithPipeline(pipeline *VODPipeline) *RecordingHandlers {
+	h.pipeline = pipeline
+	return h
+}
+
+// WithSharing enables the endpoints that share recordings
+func (h *RecordingHandlers) WithSharing(sharing *SharingService) *RecordingHandlers {
+	h.sharing = sharing
+	return h
+}
+
 // StartRecordingHandler handles POST /api/v1/recordings/start
 func (h *RecordingHandlers) StartRecordingHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -40,7 +59,7 @@ func (h *RecordingHandlers) StartRecordingHandler(w http.ResponseWriter, r *http
 	// Parse request body
 	var req StartRecordingRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Printf("Failed to parse request: %v", err)
+		h.logger.WarnContext(r.Context(), "Failed to parse request", "error", err)
 		h.writeError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
@@ -48,15 +67,19 @@ func (h *RecordingHandlers) StartRecordingHandler(w http.ResponseWriter, r *http
 	// Get user ID from context or header
 	userID, err := h.getUserID(r)
 	if err != nil {
-		h.logger.Printf("Failed to get user ID: %v", err)
+		h.logger.WarnContext(r.Context(), "Failed to get user ID", "error", err)
 		h.writeError(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
 	// Start recording
 	recording, err := h.service.StartRecording(r.Context(), &req, userID)
+	if errors.Is(err, ErrInvalidLayout) {
+		h.writeError(w, http.StatusBadRequest, "Invalid layout")
+		return
+	}
 	if err != nil {
-		h.logger.Printf("Failed to start recording: %v", err)
+		h.logger.ErrorContext(r.Context(), "Failed to start recording", "error", err)
 		h.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to start recording: %v", err))
 		return
 	}
@@ -71,7 +94,7 @@ func (h *RecordingHandlers) StartRecordingHandler(w http.ResponseWriter, r *http
 	}
 
 	h.writeJSON(w, http.StatusOK, response)
-	h.logger.Printf("Recording started: %s in room %s", recording.ID, recording.RoomID)
+	h.logger.InfoContext(r.Context(), "Recording started", "recording_id", recording.ID, "room_id", recording.RoomID)
 }
 
 // StopRecordingHandler handles POST /api/v1/recordings/{id}/stop
@@ -81,9 +104,8 @@ func (h *RecordingHandlers) StopRecordingHandler(w http.ResponseWriter, r *http.
 		return
 	}
 
-	// Extract recording ID from URL
-	recordingIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/recordings/")
-	recordingIDStr = strings.TrimSuffix(recordingIDStr, "/stop")
+	// Extract recording ID from the route
+	recordingIDStr := r.PathValue("id")
 
 	recordingID, err := uuid.Parse(recordingIDStr)
 	if err != nil {
@@ -94,7 +116,7 @@ func (h *RecordingHandlers) StopRecordingHandler(w http.ResponseWriter, r *http.
 	// Stop recording
 	recording, err := h.service.StopRecording(r.Context(), recordingID)
 	if err != nil {
-		h.logger.Printf("Failed to stop recording %s: %v", recordingID, err)
+		h.logger.ErrorContext(r.Context(), "Failed to stop recording", "recording_id", recordingID, "error", err)
 		h.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to stop recording: %v", err))
 		return
 	}
@@ -115,7 +137,7 @@ func (h *RecordingHandlers) StopRecordingHandler(w http.ResponseWriter, r *http.
 	}
 
 	h.writeJSON(w, http.StatusOK, response)
-	h.logger.Printf("Recording stopped: %s (duration: %d seconds)", recordingID, *recording.DurationSeconds)
+	h.logger.InfoContext(r.Context(), "Recording stopped", "recording_id", recordingID, "duration_seconds", *recording.DurationSeconds)
 }
 
 // GetRecordingHandler handles GET /api/v1/recordings/{id}
@@ -125,8 +147,8 @@ func (h *RecordingHandlers) GetRecordingHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	// Extract recording ID from URL
-	recordingIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/recordings/")
+	// Extract recording ID from the route
+	recordingIDStr := r.PathValue("id")
 
 	recordingID, err := uuid.Parse(recordingIDStr)
 	if err != nil {
@@ -137,7 +159,7 @@ func (h *RecordingHandlers) GetRecordingHandler(w http.ResponseWriter, r *http.R
 	// Get recording
 	recording, err := h.service.GetRecording(r.Context(), recordingID)
 	if err != nil {
-		h.logger.Printf("Failed to get recording %s: %v", recordingID, err)
+		h.logger.ErrorContext(r.Context(), "Failed to get recording", "recording_id", recordingID, "error", err)
 		h.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get recording: %v", err))
 		return
 	}
@@ -214,10 +236,24 @@ func (h *RecordingHandlers) ListRecordingsHandler(w http.ResponseWriter, r *http
 		}
 	}
 
+	// The route authorizes course_id against the caller's course role.
+	// Without it, only global admins see every recording; everyone else
+	// sees the recordings they started.
+	if courseID, err := uuid.Parse(r.URL.Query().Get("course_id")); err == nil {
+		query.CourseID = courseID
+	} else if role, _ := r.Context().Value("user_role").(string); role != "admin" {
+		userID, err := h.getUserID(r)
+		if err != nil {
+			h.writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		query.UserID = userID
+	}
+
 	// List recordings
 	recordings, total, err := h.service.ListRecordings(r.Context(), query)
 	if err != nil {
-		h.logger.Printf("Failed to list recordings: %v", err)
+		h.logger.ErrorContext(r.Context(), "Failed to list recordings", "error", err)
 		h.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to list recordings: %v", err))
 		return
 	}
@@ -261,8 +297,8 @@ func (h *RecordingHandlers) DeleteRecordingHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	// Extract recording ID from URL
-	recordingIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/recordings/")
+	// Extract recording ID from the route
+	recordingIDStr := r.PathValue("id")
 
 	recordingID, err := uuid.Parse(recordingIDStr)
 	if err != nil {
@@ -273,7 +309,7 @@ func (h *RecordingHandlers) DeleteRecordingHandler(w http.ResponseWriter, r *htt
 	// Delete recording
 	recording, err := h.service.DeleteRecording(r.Context(), recordingID)
 	if err != nil {
-		h.logger.Printf("Failed to delete recording %s: %v", recordingID, err)
+		h.logger.ErrorContext(r.Context(), "Failed to delete recording", "recording_id", recordingID, "error", err)
 		h.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete recording: %v", err))
 		return
 	}
@@ -292,7 +328,225 @@ func (h *RecordingHandlers) DeleteRecordingHandler(w http.ResponseWriter, r *htt
 	}
 
 	h.writeJSON(w, http.StatusOK, response)
-	h.logger.Printf("Recording deleted: %s", recordingID)
+	h.logger.InfoContext(r.Context(), "Recording deleted", "recording_id", recordingID)
+}
+
+// SetLayoutHandler handles POST /api/v1/recordings/{id}/layout
+func (h *RecordingHandlers) SetLayoutHandler(w http.ResponseWriter, r *http.Request) {
+	recordingID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid recording ID")
+		return
+	}
+
+	var req SetLayoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	err = h.service.SetLayout(r.Context(), recordingID, req.Layout)
+	switch {
+	case errors.Is(err, ErrInvalidLayout):
+		h.writeError(w, http.StatusBadRequest, "Invalid layout")
+		return
+	case errors.Is(err, ErrRTPSessionNotFound), errors.Is(err, ErrNotComposite):
+		h.writeError(w, http.StatusConflict, "Recording is not a composite recording in progress")
+		return
+	case err != nil:
+		h.logger.ErrorContext(r.Context(), "Failed to set layout", "recording_id", recordingID, "error", err)
+		h.writeError(w, http.StatusInternalServerError, "Failed to set layout")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"recording_id": recordingID,
+		"layout":       req.Layout,
+		"message":      "Layout changed",
+	})
+}
+
+// GetChaptersHandler handles GET /api/v1/recordings/{id}/chapters. With
+// ?format=vtt the chapters are returned as a WebVTT chapters track for the
+// player.
+func (h *RecordingHandlers) GetChaptersHandler(w http.ResponseWriter, r *http.Request) {
+	recordingID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid recording ID")
+		return
+	}
+
+	chapters, err := h.service.GetChapters(r.Context(), recordingID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Failed to get chapters", "recording_id", recordingID, "error", err)
+		h.writeError(w, http.StatusInternalServerError, "Failed to get chapters")
+		return
+	}
+	if chapters == nil {
+		h.writeError(w, http.StatusNotFound, "Recording not found")
+		return
+	}
+
+	if r.URL.Query().Get("format") == "vtt" {
+		w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, ChaptersVTT(chapters))
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"recording_id": recordingID,
+		"chapters":     chapters,
+		"count":        len(chapters),
+	})
+}
+
+// CreateShareHandler handles POST /api/v1/recordings/{id}/shares
+func (h *RecordingHandlers) CreateShareHandler(w http.ResponseWriter, r *http.Request) {
+	recordingID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid recording ID")
+		return
+	}
+
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req CreateShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	share, err := h.sharing.CreateShare(r.Context(), r, recordingID, userID, &req)
+	if err != nil {
+		if errors.Is(err, ErrInvalidShare) {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.logger.ErrorContext(r.Context(), "Failed to share recording", "recording_id", recordingID, "error", err)
+		h.writeError(w, http.StatusInternalServerError, "Failed to share recording")
+		return
+	}
+
+	response := map[string]interface{}{
+		"share":   share,
+		"message": "Recording shared",
+	}
+	if share.ShareLinkToken != nil {
+		query := url.Values{ShareTokenParam: {*share.ShareLinkToken}}.Encode()
+		response["playlist_url"] = fmt.Sprintf("/api/v1/recordings/%s/stream/playlist.m3u8?%s", recordingID, query)
+		if share.AccessLevel == AccessLevelDownload {
+			response["download_url"] = fmt.Sprintf("/api/v1/recordings/%s/download?%s", recordingID, query)
+		}
+	}
+
+	h.writeJSON(w, http.StatusCreated, response)
+}
+
+// ListSharesHandler handles GET /api/v1/recordings/{id}/shares
+func (h *RecordingHandlers) ListSharesHandler(w http.ResponseWriter, r *http.Request) {
+	recordingID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid recording ID")
+		return
+	}
+
+	shares, err := h.sharing.ListShares(r.Context(), recordingID)
+	if err != nil {
+		h.logger.ErrorContext(r.Context(), "Failed to list shares", "recording_id", recordingID, "error", err)
+		h.writeError(w, http.StatusInternalServerError, "Failed to list shares")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"recording_id": recordingID,
+		"shares":       shares,
+		"count":        len(shares),
+	})
+}
+
+// RevokeShareHandler handles DELETE /api/v1/recordings/{id}/shares/{shareId}
+func (h *RecordingHandlers) RevokeShareHandler(w http.ResponseWriter, r *http.Request) {
+	recordingID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid recording ID")
+		return
+	}
+	shareID, err := uuid.Parse(r.PathValue("shareId"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid share ID")
+		return
+	}
+
+	userID, err := h.getUserID(r)
+	if err != nil {
+		h.writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	err = h.sharing.RevokeShare(r.Context(), r, recordingID, shareID, userID)
+	switch {
+	case errors.Is(err, ErrShareNotFound):
+		h.writeError(w, http.StatusNotFound, "Share not found")
+		return
+	case err != nil:
+		h.logger.ErrorContext(r.Context(), "Failed to revoke share", "share_id", shareID, "error", err)
+		h.writeError(w, http.StatusInternalServerError, "Failed to revoke share")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"share_id": shareID,
+		"message":  "Share revoked",
+	})
+}
+
+// GetPipelineHandler handles GET /api/v1/recordings/{id}/pipeline
+func (h *RecordingHandlers) GetPipelineHandler(w http.ResponseWriter, r *http.Request) {
+	recordingID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid recording ID")
+		return
+	}
+
+	state, err := h.pipeline.Status(r.Context(), recordingID)
+	switch {
+	case errors.Is(err, ErrPipelineNotFound):
+		h.writeError(w, http.StatusNotFound, "Recording has not been post-processed")
+		return
+	case err != nil:
+		h.logger.ErrorContext(r.Context(), "Failed to get pipeline", "recording_id", recordingID, "error", err)
+		h.writeError(w, http.StatusInternalServerError, "Failed to get pipeline")
+		return
+	}
+
+	h.writeJSON(w, http.StatusOK, state)
+}
+
+// RetryPipelineHandler handles POST /api/v1/recordings/{id}/pipeline/retry
+func (h *RecordingHandlers) RetryPipelineHandler(w http.ResponseWriter, r *http.Request) {
+	recordingID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, "Invalid recording ID")
+		return
+	}
+
+	state, err := h.pipeline.Retry(r.Context(), recordingID)
+	switch {
+	case errors.Is(err, ErrPipelineNotFound):
+		h.writeError(w, http.StatusNotFound, "Recording has not been post-processed")
+		return
+	case err != nil:
+		h.logger.ErrorContext(r.Context(), "Failed to retry pipeline", "recording_id", recordingID, "error", err)
+		h.writeError(w, http.StatusInternalServerError, "Failed to retry pipeline")
+		return
+	}
+
+	h.writeJSON(w, http.StatusAccepted, state)
 }
 
 // Helper methods
@@ -302,7 +556,7 @@ func (h *RecordingHandlers) writeJSON(w http.ResponseWriter, status int, data in
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(data); err != nil {
-		h.logger.Printf("Failed to write JSON response: %v", err)
+		h.logger.Error("Failed to write JSON response", "error", err)
 	}
 }
 
@@ -315,45 +569,51 @@ func (h *RecordingHandlers) writeError(w http.ResponseWriter, status int, messag
 	h.writeJSON(w, status, errorResponse)
 }
 
-// getUserID extracts user ID from request context or header
+// getUserID returns the authenticated user set by the auth middleware
 func (h *RecordingHandlers) getUserID(r *http.Request) (uuid.UUID, error) {
-	// Try to get from header first (X-User-ID)
-	userIDStr := r.Header.Get("X-User-ID")
-	if userIDStr != "" {
+	if userIDStr, ok := r.Context().Value("user_id").(string); ok {
 		if userID, err := uuid.Parse(userIDStr); err == nil {
 			return userID, nil
 		}
 	}
 
-	// Try to get from context (set by auth middleware)
-	if userID, ok := r.Context().Value("user_id").(uuid.UUID); ok {
-		return userID, nil
-	}
-
 	return uuid.Nil, fmt.Errorf("user ID not found in request")
 }
 
-// RegisterRoutes registers all recording routes with a router
-// This assumes you have a router like chi or gorilla/mux
-func (h *RecordingHandlers) RegisterRoutes(mux *http.ServeMux) {
-	// POST /api/v1/recordings/start
-	mux.HandleFunc("/api/v1/recordings/start", h.StartRecordingHandler)
-
-	// POST /api/v1/recordings/{id}/stop
-	mux.HandleFunc("/api/v1/recordings/{id}/stop", h.StopRecordingHandler)
-
-	// GET /api/v1/recordings
-	mux.HandleFunc("/api/v1/recordings", h.ListRecordingsHandler)
-
-	// GET /api/v1/recordings/{id}
-	// DELETE /api/v1/recordings/{id}
-	mux.HandleFunc("/api/v1/recordings/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			h.GetRecordingHandler(w, r)
-		} else if r.Method == http.MethodDelete {
-			h.DeleteRecordingHandler(w, r)
-		} else {
-			h.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+// RegisterRoutes registers recording routes. Routes bound to a recording are
+// authorized against the course the recording is published in.
+func (h *RecordingHandlers) RegisterRoutes(rt *router.Router, am *auth.AuthMiddleware, authz *course.CourseAuthorizer) {
+	api := rt.With(am.Middleware)
+	member := authz.Require(authz.RecordingScope("id"), course.MemberRoles...)
+	manage := authz.Require(authz.RecordingScope("id"), course.ManageRoles...)
+
+	api.HandleFunc("POST /api/v1/recordings/start", h.StartRecordingHandler)
+	api.HandleFunc("GET /api/v1/recordings", h.ListRecordingsHandler, authz.Require(listScope(authz), course.MemberRoles...))
+	api.HandleFunc("GET /api/v1/recordings/{id}", h.GetRecordingHandler, member)
+	api.HandleFunc("DELETE /api/v1/recordings/{id}", h.DeleteRecordingHandler, manage)
+	api.HandleFunc("POST /api/v1/recordings/{id}/stop", h.StopRecordingHandler, manage)
+	api.HandleFunc("POST /api/v1/recordings/{id}/layout", h.SetLayoutHandler, manage)
+	api.HandleFunc("GET /api/v1/recordings/{id}/chapters", h.GetChaptersHandler, member)
+
+	if h.sharing != nil {
+		api.HandleFunc("POST /api/v1/recordings/{id}/shares", h.CreateShareHandler, manage)
+		api.HandleFunc("GET /api/v1/recordings/{id}/shares", h.ListSharesHandler, manage)
+		api.HandleFunc("DELETE /api/v1/recordings/{id}/shares/{shareId}", h.RevokeShareHandler, manage)
+	}
+	if h.pipeline != nil {
+		api.HandleFunc("GET /api/v1/recordings/{id}/pipeline", h.GetPipelineHandler, manage)
+		api.HandleFunc("POST /api/v1/recordings/{id}/pipeline/retry", h.RetryPipelineHandler, manage)
+	}
+}
+
+// listScope scopes a recording list to its course_id query parameter when
+// one is given. Lists without it are limited by ListRecordingsHandler.
+func listScope(authz *course.CourseAuthorizer) course.ScopeResolver {
+	scoped := authz.CourseFromQuery("course_id")
+	return func(r *http.Request) (*course.CourseScope, error) {
+		if r.URL.Query().Get("course_id") == "" {
+			return nil, nil
 		}
-	})
+		return scoped(r)
+	}
 }
@@ -0,0 +1,387 @@
+package recording
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Composite recording layouts
+const (
+	LayoutSpeakerFocus = "speaker-focus"
+	LayoutSideBySide   = "side-by-side"
+	LayoutScreenPiP    = "screen-pip"
+	LayoutGrid         = "grid"
+)
+
+// Layout event types, matching the signalling room events
+const (
+	LayoutEventActiveSpeaker = "active-speaker"
+	LayoutEventScreenShare   = "screen-share"
+)
+
+// Reasons for a layout change
+const (
+	LayoutReasonStart  = "start"
+	LayoutReasonManual = "manual"
+)
+
+// ValidateLayout checks if a layout is valid
+func ValidateLayout(layout string) bool {
+	switch layout {
+	case LayoutSpeakerFocus, LayoutSideBySide, LayoutScreenPiP, LayoutGrid:
+		return true
+	}
+	return false
+}
+
+// LayoutEvent is a room event that can change the layout of a composite
+// recording
+type LayoutEvent struct {
+	Type   string
+	UserID string
+	Active bool
+	At     time.Time
+}
+
+// LayoutChange records a switch of the composite layout. The changes are
+// stored with the recording and become its chapter markers.
+type LayoutChange struct {
+	OffsetSeconds float64   `json:"offset_seconds"`
+	At            time.Time `json:"at"`
+	Layout        string    `json:"layout"`
+	UserID        string    `json:"user_id,omitempty"`
+	Title         string    `json:"title"`
+	Reason        string    `json:"reason"`
+}
+
+// Chapter is a chapter marker shown during playback
+type Chapter struct {
+	StartSeconds float64 `json:"start_seconds"`
+	EndSeconds   float64 `json:"end_seconds"`
+	Title        string  `json:"title"`
+	Layout       string  `json:"layout"`
+	UserID       string  `json:"user_id,omitempty"`
+}
+
+// ChaptersFromChanges turns layout changes into chapter markers. Each
+// chapter ends where the next begins and the last one ends at end seconds.
+func ChaptersFromChanges(changes []LayoutChange, end float64) []Chapter {
+	chapters := make([]Chapter, 0, len(changes))
+	for i, change := range changes {
+		chapterEnd := end
+		if i+1 < len(changes) {
+			chapterEnd = changes[i+1].OffsetSeconds
+		}
+		if chapterEnd < change.OffsetSeconds {
+			chapterEnd = change.OffsetSeconds
+		}
+		chapters = append(chapters, Chapter{
+			StartSeconds: change.OffsetSeconds,
+			EndSeconds:   chapterEnd,
+			Title:        change.Title,
+			Layout:       change.Layout,
+			UserID:       change.UserID,
+		})
+	}
+	return chapters
+}
+
+// ChaptersVTT renders chapter markers as a WebVTT chapters track
+func ChaptersVTT(chapters []Chapter) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i, chapter := range chapters {
+		fmt.Fprintf(&b, "\n%d\n%s --> %s\n%s\n", i+1,
+			vttTimestamp(chapter.StartSeconds), vttTimestamp(chapter.EndSeconds), chapter.Title)
+	}
+	return b.String()
+}
+
+func vttTimestamp(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// Rect is a region of the canvas
+type Rect struct {
+	X, Y, W, H int
+}
+
+// layoutInput is a video stream that can be placed on the canvas
+type layoutInput struct {
+	UserID  string
+	Name    string
+	Screen  bool
+	Teacher bool
+}
+
+// layoutState is what decides the placement of the inputs
+type layoutState struct {
+	Layout    string
+	Pinned    bool   // chosen manually, so room events do not switch it
+	Speaker   string // active speaker
+	Presenter string // user sharing their screen
+}
+
+// resolveLayout returns the layout that is actually shown, the user in
+// focus and the position of each visible input. Layouts that need a
+// screen share or a camera fall back to one that can be shown.
+func resolveLayout(state layoutState, width, height int, inputs []layoutInput) (string, string, map[int]Rect) {
+	camera := func(userID string) int {
+		for i, in := range inputs {
+			if !in.Screen && in.UserID == userID {
+				return i
+			}
+		}
+		return -1
+	}
+
+	// The speaker's camera, else a teacher's, else the first camera
+	speaker := camera(state.Speaker)
+	if speaker < 0 {
+		for i, in := range inputs {
+			if !in.Screen && in.Teacher {
+				speaker = i
+				break
+			}
+		}
+	}
+	if speaker < 0 {
+		for i, in := range inputs {
+			if !in.Screen {
+				speaker = i
+				break
+			}
+		}
+	}
+
+	screen := -1
+	if state.Presenter != "" {
+		for i, in := range inputs {
+			if in.Screen && in.UserID == state.Presenter {
+				screen = i
+				break
+			}
+		}
+	}
+
+	userOf := func(i int) string {
+		if i < 0 {
+			return ""
+		}
+		return inputs[i].UserID
+	}
+
+	layout := state.Layout
+	if layout == LayoutScreenPiP && screen < 0 {
+		layout = LayoutSpeakerFocus
+	}
+	if layout == LayoutSpeakerFocus && speaker < 0 {
+		layout = LayoutGrid
+	}
+
+	placement := make(map[int]Rect)
+	switch layout {
+	case LayoutScreenPiP:
+		placement[screen] = Rect{0, 0, width, height}
+		if speaker >= 0 {
+			margin := width / 64
+			w, h := width/4, height/4
+			placement[speaker] = Rect{width - w - margin, height - h - margin, w, h}
+		}
+		return layout, userOf(screen), placement
+
+	case LayoutSideBySide:
+		left, right := speaker, -1
+		if screen >= 0 {
+			left, right = screen, speaker
+		} else {
+			for i, in := range inputs {
+				if !in.Screen && i != speaker {
+					right = i
+					break
+				}
+			}
+		}
+		if left < 0 {
+			left, right = right, -1
+		}
+		if left < 0 {
+			return layout, "", placement
+		}
+		if right < 0 {
+			placement[left] = Rect{0, 0, width, height}
+		} else {
+			placement[left] = Rect{0, 0, width / 2, height}
+			placement[right] = Rect{width / 2, 0, width / 2, height}
+		}
+		return layout, userOf(left), placement
+
+	case LayoutSpeakerFocus:
+		// The speaker on top, up to four other cameras in a strip below
+		var others []int
+		for i, in := range inputs {
+			if !in.Screen && i != speaker && len(others) < 4 {
+				others = append(others, i)
+			}
+		}
+		if len(others) == 0 {
+			placement[speaker] = Rect{0, 0, width, height}
+			return layout, userOf(speaker), placement
+		}
+		mainHeight := height * 3 / 4
+		placement[speaker] = Rect{0, 0, width, mainHeight}
+		cellWidth := width / len(others)
+		for n, i := range others {
+			placement[i] = Rect{n * cellWidth, mainHeight, cellWidth, height - mainHeight}
+		}
+		return layout, userOf(speaker), placement
+
+	default:
+		layout = LayoutGrid
+		n := len(inputs)
+		if n == 0 {
+			return layout, "", placement
+		}
+		cols := int(math.Ceil(math.Sqrt(float64(n))))
+		rows := (n + cols - 1) / cols
+		cellWidth, cellHeight := width/cols, height/rows
+		for i := range inputs {
+			placement[i] = Rect{(i % cols) * cellWidth, (i / cols) * cellHeight, cellWidth, cellHeight}
+		}
+		return layout, "", placement
+	}
+}
+
+// layoutTitle names a layout for its chapter marker
+func layoutTitle(layout, focus string, inputs []layoutInput) string {
+	name := focus
+	for _, in := range inputs {
+		if in.UserID == focus && in.Name != "" {
+			name = in.Name
+			break
+		}
+	}
+
+	switch layout {
+	case LayoutScreenPiP:
+		if name != "" {
+			return "Screen share: " + name
+		}
+		return "Screen share"
+	case LayoutSideBySide:
+		return "Side by side"
+	case LayoutSpeakerFocus:
+		if name != "" {
+			return name
+		}
+		return "Speaker"
+	default:
+		return "Grid view"
+	}
+}
+
+// hiddenSize is the size hidden inputs are scaled to while they are drawn
+// off the canvas
+const hiddenSize = 16
+
+// compositeFilterGraph builds the FFmpeg filter graph for a composite
+// recording. Each video input is scaled and overlaid on a black canvas; the
+// scale and overlay filters are named after the input so a layout switch
+// only sends them new sizes and positions. All audio inputs are mixed and
+// loudness normalized.
+func compositeFilterGraph(streams []RTPStream, width, height, fps int, placement map[int]Rect) string {
+	var chains []string
+
+	video := 0
+	last := "base"
+	for index, stream := range streams {
+		if stream.Kind != "video" {
+			continue
+		}
+		w, h, x, y := placementArgs(placement, video, width)
+		chains = append(chains,
+			fmt.Sprintf("[0:%d]scale@v%d=w=%d:h=%d:force_original_aspect_ratio=decrease:force_divisible_by=2,setsar=1,format=yuv420p[v%d]",
+				index, video, w, h, video),
+			fmt.Sprintf("[%s][v%d]overlay@o%d=x=%s:y=%s:eval=frame[c%d]", last, video, video, x, y, video),
+		)
+		last = fmt.Sprintf("c%d", video)
+		video++
+	}
+	if video > 0 {
+		chains = append([]string{fmt.Sprintf("color=c=black:s=%dx%d:r=%d[base]", width, height, fps)}, chains...)
+		chains = append(chains, fmt.Sprintf("[%s]null[vout]", last))
+	}
+
+	var audio []string
+	for index, stream := range streams {
+		if stream.Kind != "audio" {
+			continue
+		}
+		label := fmt.Sprintf("a%d", len(audio))
+		chains = append(chains, fmt.Sprintf("[0:%d]aresample=async=1[%s]", index, label))
+		audio = append(audio, "["+label+"]")
+	}
+	if len(audio) > 0 {
+		mix := strings.Join(audio, "")
+		if len(audio) > 1 {
+			mix += fmt.Sprintf("amix=inputs=%d:duration=longest:dropout_transition=0:normalize=0,", len(audio))
+		}
+		// loudnorm works at 192 kHz, so resample back for the encoder
+		chains = append(chains, mix+"loudnorm=I=-16:TP=-1.5:LRA=11,aresample=48000[aout]")
+	}
+
+	return strings.Join(chains, ";")
+}
+
+// filterCommand is a command for a named filter of the composite graph
+type filterCommand struct {
+	Target  string
+	Command string
+	Arg     string
+}
+
+// layoutCommands returns the filter commands that move the inputs from one
+// placement to another. Inputs that move are hidden first so a switch never
+// shows two inputs on top of each other.
+func layoutCommands(from, to map[int]Rect, inputs, width int) []filterCommand {
+	var hide, resize, show []filterCommand
+	for i := 0; i < inputs; i++ {
+		old, wasShown := from[i]
+		next, shown := to[i]
+		if wasShown == shown && old == next {
+			continue
+		}
+		overlay, scale := fmt.Sprintf("overlay@o%d", i), fmt.Sprintf("scale@v%d", i)
+		w, h, x, y := placementArgs(to, i, width)
+		if wasShown {
+			hide = append(hide, filterCommand{overlay, "x", fmt.Sprint(width)})
+		}
+		resize = append(resize,
+			filterCommand{scale, "w", fmt.Sprint(w)},
+			filterCommand{scale, "h", fmt.Sprint(h)},
+		)
+		if shown {
+			show = append(show,
+				filterCommand{overlay, "y", y},
+				filterCommand{overlay, "x", x},
+			)
+		}
+	}
+	return append(append(hide, resize...), show...)
+}
+
+// placementArgs returns the scale size and overlay position of an input.
+// Inputs keep their aspect ratio and are centred in their region; hidden
+// inputs are drawn past the right edge of the canvas.
+func placementArgs(placement map[int]Rect, input, width int) (int, int, string, string) {
+	rect, ok := placement[input]
+	if !ok {
+		return hiddenSize, hiddenSize, fmt.Sprint(width), "0"
+	}
+	return rect.W, rect.H,
+		fmt.Sprintf("%d+(%d-w)/2", rect.X, rect.W),
+		fmt.Sprintf("%d+(%d-h)/2", rect.Y, rect.H)
+}
@@ -0,0 +1,268 @@
+package recording
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/mediasoup"
+)
+
+// TestResolveLayout tests the placement of inputs for each layout
+func TestResolveLayout(t *testing.T) {
+	inputs := []layoutInput{
+		{UserID: "teacher", Name: "Tariq Teacher", Screen: true},
+		{UserID: "teacher", Name: "Tariq Teacher", Teacher: true},
+		{UserID: "student-1", Name: "Sara Student"},
+		{UserID: "student-2"},
+	}
+
+	// Speaker focus falls back to the teacher's camera
+	layout, focus, placement := resolveLayout(layoutState{Layout: LayoutSpeakerFocus}, 1280, 720, inputs)
+	if layout != LayoutSpeakerFocus || focus != "teacher" {
+		t.Errorf("Expected speaker focus on the teacher, got %s on %s", layout, focus)
+	}
+	if placement[1] != (Rect{0, 0, 1280, 540}) {
+		t.Errorf("Speaker placed at %+v", placement[1])
+	}
+	if placement[2] != (Rect{0, 540, 640, 180}) || placement[3] != (Rect{640, 540, 640, 180}) {
+		t.Errorf("Strip placed at %+v and %+v", placement[2], placement[3])
+	}
+	if _, shown := placement[0]; shown {
+		t.Error("Screen shown in speaker focus")
+	}
+
+	// The active speaker takes focus
+	_, focus, placement = resolveLayout(layoutState{Layout: LayoutSpeakerFocus, Speaker: "student-1"}, 1280, 720, inputs)
+	if focus != "student-1" || placement[2].H != 540 {
+		t.Errorf("Expected focus on student-1, got %s at %+v", focus, placement[2])
+	}
+
+	// Screen PiP puts the speaker in the corner
+	layout, focus, placement = resolveLayout(layoutState{Layout: LayoutScreenPiP, Presenter: "teacher"}, 1280, 720, inputs)
+	if layout != LayoutScreenPiP || focus != "teacher" {
+		t.Errorf("Expected screen PiP of the teacher, got %s of %s", layout, focus)
+	}
+	if placement[0] != (Rect{0, 0, 1280, 720}) || placement[1] != (Rect{1280 - 320 - 20, 720 - 180 - 20, 320, 180}) {
+		t.Errorf("PiP placed at %+v and %+v", placement[0], placement[1])
+	}
+	if len(placement) != 2 {
+		t.Errorf("Expected 2 inputs shown, got %d", len(placement))
+	}
+
+	// Without a screen share PiP falls back to speaker focus
+	layout, _, _ = resolveLayout(layoutState{Layout: LayoutScreenPiP, Presenter: "student-1"}, 1280, 720, inputs)
+	if layout != LayoutSpeakerFocus {
+		t.Errorf("Expected speaker focus fallback, got %s", layout)
+	}
+
+	// Side by side shows the screen next to the speaker
+	_, _, placement = resolveLayout(layoutState{Layout: LayoutSideBySide, Presenter: "teacher"}, 1280, 720, inputs)
+	if placement[0] != (Rect{0, 0, 640, 720}) || placement[1] != (Rect{640, 0, 640, 720}) {
+		t.Errorf("Side by side placed at %+v and %+v", placement[0], placement[1])
+	}
+
+	// The grid fits every input
+	layout, focus, placement = resolveLayout(layoutState{Layout: LayoutGrid}, 1280, 720, inputs)
+	if layout != LayoutGrid || focus != "" || len(placement) != 4 {
+		t.Errorf("Expected a grid of 4, got %s with %d", layout, len(placement))
+	}
+	if placement[3] != (Rect{640, 360, 640, 360}) {
+		t.Errorf("Last grid cell at %+v", placement[3])
+	}
+
+	t.Log("✓ Layouts place inputs and fall back when needed")
+}
+
+// TestCompositeFilterGraph tests the filter graph of a composite recording
+func TestCompositeFilterGraph(t *testing.T) {
+	streams := []RTPStream{
+		{Kind: "video"},
+		{Kind: "audio"},
+		{Kind: "video"},
+		{Kind: "audio"},
+	}
+	placement := map[int]Rect{0: {0, 0, 1280, 720}}
+
+	graph := compositeFilterGraph(streams, 1280, 720, 30, placement)
+	for _, want := range []string{
+		"color=c=black:s=1280x720:r=30[base]",
+		"[0:0]scale@v0=w=1280:h=720:",
+		"[base][v0]overlay@o0=x=0+(1280-w)/2:y=0+(720-h)/2:eval=frame[c0]",
+		"[0:2]scale@v1=w=16:h=16:",
+		"[c0][v1]overlay@o1=x=1280:y=0:eval=frame[c1]",
+		"[c1]null[vout]",
+		"[0:1]aresample=async=1[a0]",
+		"[0:3]aresample=async=1[a1]",
+		"[a0][a1]amix=inputs=2:duration=longest:dropout_transition=0:normalize=0,loudnorm=I=-16:TP=-1.5:LRA=11,aresample=48000[aout]",
+	} {
+		if !strings.Contains(graph, want) {
+			t.Errorf("Filter graph missing %q:\n%s", want, graph)
+		}
+	}
+
+	args := strings.Join(rtpCompositeArgs("in.sdp", "out.webm", graph, streams, &FFmpegConfig{Format: "webm"}), " ")
+	for _, want := range []string{"-map [vout] -map [aout]", "-c:v libvpx -deadline realtime", "-c:a libopus", "-f webm -y out.webm"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("Composite args missing %q: %s", want, args)
+		}
+	}
+
+	t.Log("✓ Composite graph overlays video and normalizes mixed audio")
+}
+
+// TestLayoutCommands tests the filter commands of a layout switch
+func TestLayoutCommands(t *testing.T) {
+	from := map[int]Rect{0: {0, 0, 1280, 720}}
+	to := map[int]Rect{0: {0, 0, 640, 720}, 1: {640, 0, 640, 720}}
+
+	var lines []string
+	for _, cmd := range layoutCommands(from, to, 3, 1280) {
+		lines = append(lines, cmd.Target+" "+cmd.Command+" "+cmd.Arg)
+	}
+	expected := []string{
+		"overlay@o0 x 1280",
+		"scale@v0 w 640",
+		"scale@v0 h 720",
+		"scale@v1 w 640",
+		"scale@v1 h 720",
+		"overlay@o0 y 0+(720-h)/2",
+		"overlay@o0 x 0+(640-w)/2",
+		"overlay@o1 y 0+(720-h)/2",
+		"overlay@o1 x 640+(640-w)/2",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected commands:\n%s", strings.Join(lines, "\n"))
+	}
+
+	if cmds := layoutCommands(to, to, 3, 1280); len(cmds) != 0 {
+		t.Errorf("Expected no commands for an unchanged layout, got %d", len(cmds))
+	}
+
+	t.Log("✓ Layout switches only move changed inputs")
+}
+
+// TestChaptersVTT tests chapter markers built from layout changes
+func TestChaptersVTT(t *testing.T) {
+	changes := []LayoutChange{
+		{OffsetSeconds: 0, Layout: LayoutSpeakerFocus, UserID: "teacher", Title: "Tariq Teacher"},
+		{OffsetSeconds: 75.5, Layout: LayoutScreenPiP, UserID: "teacher", Title: "Screen share: Tariq Teacher"},
+	}
+
+	chapters := ChaptersFromChanges(changes, 3725)
+	if len(chapters) != 2 || chapters[0].EndSeconds != 75.5 || chapters[1].EndSeconds != 3725 {
+		t.Fatalf("Unexpected chapters: %+v", chapters)
+	}
+
+	expected := "WEBVTT\n\n1\n00:00:00.000 --> 00:01:15.500\nTariq Teacher\n\n2\n00:01:15.500 --> 01:02:05.000\nScreen share: Tariq Teacher\n"
+	if vtt := ChaptersVTT(chapters); vtt != expected {
+		t.Errorf("Unexpected WebVTT:\n%s", vtt)
+	}
+
+	t.Log("✓ Chapters render as WebVTT")
+}
+
+// TestRTPRecorderCompositeLayouts tests layout switches driven by room
+// events and by the host
+func TestRTPRecorderCompositeLayouts(t *testing.T) {
+	_, server := newFakeSFU(t)
+
+	dir := t.TempDir()
+	commandsPath := filepath.Join(dir, "commands")
+	fakeFFmpeg := filepath.Join(dir, "ffmpeg")
+	if err := os.WriteFile(fakeFFmpeg, []byte("#!/bin/sh\ncat >"+commandsPath+"\n"), 0755); err != nil {
+		t.Fatalf("Failed to write fake ffmpeg: %v", err)
+	}
+
+	config := DefaultRTPIngestConfig()
+	config.OutputDir = dir
+	config.FFmpegPath = fakeFFmpeg
+	config.MinPort = 53000
+	config.MaxPort = 53999
+	config.ReadyTimeout = 100 * time.Millisecond
+	config.SpeakerHold = 200 * time.Millisecond
+
+	recorder := NewRTPRecorder(mediasoup.NewClient(server.URL), NewProcessRegistry(nil), config, nil)
+
+	if _, err := recorder.Start(context.Background(), "rec-1", "room-1", RTPRecordOptions{Layout: "carousel"}); err != ErrInvalidLayout {
+		t.Errorf("Expected ErrInvalidLayout, got %v", err)
+	}
+
+	session, err := recorder.Start(context.Background(), "rec-1", "room-1", RTPRecordOptions{Layout: LayoutSpeakerFocus})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if len(session.Streams) != 5 {
+		t.Fatalf("Expected every producer to be recorded, got %d streams", len(session.Streams))
+	}
+	if session.Streams[0].ProducerID != "teacher-screen-video" || session.Streams[1].ProducerID != "teacher-video" {
+		t.Errorf("Expected the screen then the teacher's camera first, got %+v", session.Streams)
+	}
+
+	start := session.StartedAt
+	recorder.HandleRoomEvent("other-room", LayoutEvent{Type: LayoutEventActiveSpeaker, UserID: "student", At: start})
+	recorder.HandleRoomEvent("room-1", LayoutEvent{Type: LayoutEventActiveSpeaker, UserID: "student", At: start.Add(time.Second)})
+	// Within the hold the teacher only takes focus once it ends
+	recorder.HandleRoomEvent("room-1", LayoutEvent{Type: LayoutEventActiveSpeaker, UserID: "teacher", At: start.Add(1100 * time.Millisecond)})
+
+	session.mu.Lock()
+	if session.state.Speaker != "student" || session.pendingSpeaker != "teacher" {
+		t.Errorf("Expected the teacher held back, speaker %s pending %s", session.state.Speaker, session.pendingSpeaker)
+	}
+	session.mu.Unlock()
+	time.Sleep(300 * time.Millisecond)
+
+	recorder.HandleRoomEvent("room-1", LayoutEvent{Type: LayoutEventScreenShare, UserID: "teacher", Active: true, At: start.Add(2 * time.Second)})
+	recorder.HandleRoomEvent("room-1", LayoutEvent{Type: LayoutEventScreenShare, UserID: "teacher", Active: false, At: start.Add(3 * time.Second)})
+
+	if err := recorder.SetLayout("rec-1", LayoutGrid); err != nil {
+		t.Fatalf("SetLayout failed: %v", err)
+	}
+	// A pinned grid stays through a screen share
+	recorder.HandleRoomEvent("room-1", LayoutEvent{Type: LayoutEventScreenShare, UserID: "teacher", Active: true})
+
+	changes := session.LayoutChanges()
+	var got []string
+	for _, change := range changes {
+		got = append(got, change.Layout+"/"+change.UserID+"/"+change.Reason)
+	}
+	expected := []string{
+		"speaker-focus/teacher/start",
+		"speaker-focus/student/active-speaker",
+		"speaker-focus/teacher/active-speaker",
+		"screen-pip/teacher/screen-share",
+		"speaker-focus/teacher/screen-share",
+		"grid//manual",
+	}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Fatalf("Unexpected layout changes:\n%s", strings.Join(got, "\n"))
+	}
+	if changes[0].OffsetSeconds != 0 || changes[1].OffsetSeconds != 1 || changes[2].OffsetSeconds != 1.2 || changes[4].OffsetSeconds != 3 {
+		t.Errorf("Unexpected offsets: %+v", changes)
+	}
+	if changes[0].Title != "Tariq Teacher" || changes[3].Title != "Screen share: Tariq Teacher" {
+		t.Errorf("Unexpected titles: %q, %q", changes[0].Title, changes[2].Title)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := recorder.Stop(ctx, "rec-1"); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if err := recorder.SetLayout("rec-1", LayoutGrid); err != ErrRTPSessionNotFound {
+		t.Errorf("Expected ErrRTPSessionNotFound after stop, got %v", err)
+	}
+
+	commands, err := os.ReadFile(commandsPath)
+	if err != nil {
+		t.Fatalf("Failed to read FFmpeg input: %v", err)
+	}
+	if !strings.Contains(string(commands), "coverlay@o1 -1 x ") || !strings.HasSuffix(string(commands), "q") {
+		t.Errorf("Unexpected FFmpeg input: %q", commands)
+	}
+
+	t.Log("✓ Composite layouts follow the speaker, screen share and host")
+}
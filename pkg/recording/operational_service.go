@@ -3,9 +3,11 @@ package recording
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,18 +15,72 @@ import (
 
 // RecordingService handles operational recording lifecycle (start/stop/update)
 type RecordingService struct {
-	db  *sql.DB
-	log *log.Logger
+	db        *sql.DB
+	log       *slog.Logger
+	processes *ProcessRegistry
+	rtp       *RTPRecorder
+	pipeline  *VODPipeline
 }
 
 // NewRecordingService creates a new recording service
-func NewRecordingService(db *sql.DB, logger *log.Logger) *RecordingService {
+func NewRecordingService(db *sql.DB, logger *slog.Logger) *RecordingService {
+	if logger == nil {
+		logger = slog.Default().With("component", "recording")
+	}
 	return &RecordingService{
 		db:  db,
 		log: logger,
 	}
 }
 
+// WithProcessRegistry tracks the FFmpeg processes writing recordings so they
+// are stopped with their recording and finalized on shutdown
+func (s *RecordingService) WithProcessRegistry(processes *ProcessRegistry) *RecordingService {
+	s.processes = processes
+	return s
+}
+
+// WithRTPRecorder records the room's media from the SFU when a recording is
+// started
+func (s *RecordingService) WithRTPRecorder(rtp *RTPRecorder) *RecordingService {
+	s.rtp = rtp
+	return s
+}
+
+// WithPipeline post-processes recordings once they are stopped
+func (s *RecordingService) WithPipeline(pipeline *VODPipeline) *RecordingService {
+	s.pipeline = pipeline
+	return s
+}
+
+// Processes returns the FFmpeg process registry, or nil if none is attached
+func (s *RecordingService) Processes() *ProcessRegistry {
+	return s.processes
+}
+
+// FinalizeActive stops every running FFmpeg process so its output file is
+// closed cleanly and marks the recordings as completed. It is called on
+// shutdown, before the database is closed.
+func (s *RecordingService) FinalizeActive(ctx context.Context) error {
+	if s.processes == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, id := range s.processes.StopAll(ctx) {
+		recordingID, err := uuid.Parse(id)
+		if err != nil {
+			continue
+		}
+		if _, err := s.StopRecording(ctx, recordingID); err != nil {
+			errs = append(errs, fmt.Errorf("failed to finalize recording %s: %w", id, err))
+			continue
+		}
+		s.log.InfoContext(ctx, "Finalized recording on shutdown", "recording_id", id)
+	}
+	return errors.Join(errs...)
+}
+
 // StartRecording creates a new recording entry in the database
 func (s *RecordingService) StartRecording(ctx context.Context, req *StartRecordingRequest, userID uuid.UUID) (*Recording, error) {
 	if req == nil {
@@ -68,6 +124,12 @@ func (s *RecordingService) StartRecording(ctx context.Context, req *StartRecordi
 	if req.Description != nil {
 		recording.Metadata["description"] = *req.Description
 	}
+	if req.Layout != "" {
+		if !ValidateLayout(req.Layout) {
+			return nil, ErrInvalidLayout
+		}
+		recording.Metadata["layout"] = req.Layout
+	}
 
 	query := `
 		INSERT INTO recordings 
@@ -107,14 +169,69 @@ func (s *RecordingService) StartRecording(ctx context.Context, req *StartRecordi
 	)
 
 	if err != nil {
-		s.log.Printf("Error starting recording: %v", err)
+		s.log.ErrorContext(ctx, "Error starting recording", "error", err)
 		return nil, fmt.Errorf("failed to start recording: %w", err)
 	}
 
-	s.log.Printf("Recording %s started for room %s by user %s", recording.ID, recording.RoomID, userID)
+	if s.rtp != nil {
+		if err := s.startIngest(ctx, recording); err != nil {
+			return nil, err
+		}
+	}
+
+	s.log.InfoContext(ctx, "Recording started", "recording_id", recording.ID, "room_id", recording.RoomID, "user_id", userID)
 	return recording, nil
 }
 
+// startIngest starts receiving the room's media for a new recording. A
+// recording whose ingest cannot start is marked failed.
+func (s *RecordingService) startIngest(ctx context.Context, recording *Recording) error {
+	opts := RTPRecordOptions{Format: recording.Format}
+	if layout, ok := recording.Metadata["layout"].(string); ok {
+		opts.Layout = layout
+	}
+	if recording.BitrateKbps != nil {
+		opts.BitrateKbps = *recording.BitrateKbps
+	}
+
+	session, err := s.rtp.Start(ctx, recording.ID.String(), recording.RoomID.String(), opts)
+	if err != nil {
+		s.log.ErrorContext(ctx, "Failed to start RTP ingest", "recording_id", recording.ID, "error", err)
+		_, dbErr := s.db.ExecContext(ctx,
+			`UPDATE recordings SET status = $1, error_message = $2, updated_at = $3 WHERE id = $4`,
+			StatusFailed, err.Error(), time.Now().UTC(), recording.ID,
+		)
+		if dbErr != nil {
+			s.log.ErrorContext(ctx, "Failed to mark recording failed", "recording_id", recording.ID, "error", dbErr)
+		}
+		return fmt.Errorf("failed to start recording media: %w", err)
+	}
+
+	codecs := make([]string, 0, len(session.Streams))
+	for _, stream := range session.Streams {
+		codecs = append(codecs, strings.ToLower(codecName(stream.Codec)))
+	}
+	mimeType := "video/" + recording.Format
+	codecList := strings.Join(codecs, ",")
+
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE recordings SET status = $1, file_path = $2, mime_type = $3, codecs = $4, updated_at = $5 WHERE id = $6`,
+		StatusRecording, session.OutputPath, mimeType, codecList, time.Now().UTC(), recording.ID,
+	)
+	if err != nil {
+		if _, stopErr := s.rtp.Stop(ctx, recording.ID.String()); stopErr != nil {
+			s.log.ErrorContext(ctx, "Failed to stop RTP ingest", "recording_id", recording.ID, "error", stopErr)
+		}
+		return fmt.Errorf("failed to update recording: %w", err)
+	}
+
+	recording.Status = StatusRecording
+	recording.FilePath = &session.OutputPath
+	recording.MimeType = &mimeType
+	recording.Codecs = &codecList
+	return nil
+}
+
 // StopRecording marks a recording as stopped and updates duration
 func (s *RecordingService) StopRecording(ctx context.Context, recordingID uuid.UUID) (*Recording, error) {
 	if recordingID == uuid.Nil {
@@ -137,6 +254,27 @@ func (s *RecordingService) StopRecording(ctx context.Context, recordingID uuid.U
 		return nil, errors.New("cannot stop a deleted recording")
 	}
 
+	// Let FFmpeg write the container trailer before the recording is closed
+	if s.rtp != nil {
+		session, err := s.rtp.Stop(ctx, recordingID.String())
+		if err != nil && !errors.Is(err, ErrRTPSessionNotFound) {
+			s.log.ErrorContext(ctx, "Failed to stop RTP ingest", "recording_id", recordingID, "error", err)
+		}
+		if session != nil && session.Layout != "" {
+			end := time.Since(session.StartedAt).Seconds()
+			if err := s.saveLayoutChanges(ctx, recordingID, session.LayoutChanges(), end); err != nil {
+				s.log.ErrorContext(ctx, "Failed to save layout changes", "recording_id", recordingID, "error", err)
+			}
+		}
+	}
+	if s.processes != nil {
+		if fp, ok := s.processes.Remove(recordingID.String()); ok && fp.IsRunning() {
+			if err := fp.StopFFmpeg(ctx); err != nil {
+				s.log.ErrorContext(ctx, "Failed to stop FFmpeg", "recording_id", recordingID, "error", err)
+			}
+		}
+	}
+
 	// Calculate duration
 	duration := int(now.Sub(recording.StartedAt).Seconds())
 
@@ -174,14 +312,101 @@ func (s *RecordingService) StopRecording(ctx context.Context, recordingID uuid.U
 	)
 
 	if err != nil {
-		s.log.Printf("Error stopping recording: %v", err)
+		s.log.ErrorContext(ctx, "Error stopping recording", "recording_id", recordingID, "error", err)
 		return nil, fmt.Errorf("failed to stop recording: %w", err)
 	}
 
-	s.log.Printf("Recording %s stopped. Duration: %d seconds", recordingID, duration)
+	s.log.InfoContext(ctx, "Recording stopped", "recording_id", recordingID, "duration_seconds", duration)
+
+	if s.pipeline != nil {
+		if err := s.pipeline.Enqueue(ctx, recordingID); err != nil {
+			s.log.ErrorContext(ctx, "Failed to queue post-processing", "recording_id", recordingID, "error", err)
+		}
+	}
 	return recording, nil
 }
 
+// saveLayoutChanges stores the layout changes of a composite recording and
+// the chapter markers derived from them in the recording's metadata
+func (s *RecordingService) saveLayoutChanges(ctx context.Context, recordingID uuid.UUID, changes []LayoutChange, end float64) error {
+	return s.MergeMetadata(ctx, recordingID, map[string]interface{}{
+		"layout_changes": changes,
+		"chapters":       ChaptersFromChanges(changes, end),
+	})
+}
+
+// MergeMetadata adds keys to a recording's metadata, replacing existing keys
+func (s *RecordingService) MergeMetadata(ctx context.Context, recordingID uuid.UUID, patch map[string]interface{}) error {
+	encoded, err := json.Marshal(patch)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE recordings SET metadata = COALESCE(metadata, '{}'::jsonb) || $1::jsonb, updated_at = $2 WHERE id = $3`,
+		string(encoded), time.Now().UTC(), recordingID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update recording metadata: %w", err)
+	}
+	return nil
+}
+
+// SetFileSize records the size of a finalized recording file
+func (s *RecordingService) SetFileSize(ctx context.Context, recordingID uuid.UUID, size int64) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE recordings SET file_size_bytes = $1, updated_at = $2 WHERE id = $3`,
+		size, time.Now().UTC(), recordingID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update recording file size: %w", err)
+	}
+	return nil
+}
+
+// SetLayout switches the layout of a composite recording in progress
+func (s *RecordingService) SetLayout(ctx context.Context, recordingID uuid.UUID, layout string) error {
+	if s.rtp == nil {
+		return ErrRTPSessionNotFound
+	}
+	if err := s.rtp.SetLayout(recordingID.String(), layout); err != nil {
+		return err
+	}
+	s.log.InfoContext(ctx, "Recording layout changed", "recording_id", recordingID, "layout", layout)
+	return nil
+}
+
+// GetChapters returns the chapter markers of a recording. A recording in
+// progress returns its layout changes so far; a recording without layout
+// changes has no chapters. It returns nil if the recording does not exist.
+func (s *RecordingService) GetChapters(ctx context.Context, recordingID uuid.UUID) ([]Chapter, error) {
+	if s.rtp != nil {
+		if session, ok := s.rtp.Session(recordingID.String()); ok && session.Layout != "" {
+			return ChaptersFromChanges(session.LayoutChanges(), time.Since(session.StartedAt).Seconds()), nil
+		}
+	}
+
+	var raw []byte
+	err := s.db.QueryRowContext(ctx,
+		`SELECT metadata->'chapters' FROM recordings WHERE id = $1 AND status != $2`,
+		recordingID, StatusDeleted,
+	).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chapters: %w", err)
+	}
+
+	chapters := []Chapter{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &chapters); err != nil {
+			return nil, fmt.Errorf("failed to decode chapters: %w", err)
+		}
+	}
+	return chapters, nil
+}
+
 // GetRecording retrieves a recording by ID
 func (s *RecordingService) GetRecording(ctx context.Context, recordingID uuid.UUID) (*Recording, error) {
 	if recordingID == uuid.Nil {
@@ -228,7 +453,7 @@ func (s *RecordingService) GetRecording(ctx context.Context, recordingID uuid.UU
 	}
 
 	if err != nil {
-		s.log.Printf("Error getting recording: %v", err)
+		s.log.ErrorContext(ctx, "Error getting recording", "recording_id", recordingID, "error", err)
 		return nil, fmt.Errorf("failed to get recording: %w", err)
 	}
 
@@ -269,6 +494,12 @@ func (s *RecordingService) ListRecordings(ctx context.Context, query *RecordingL
 		argCounter++
 	}
 
+	if query.CourseID != uuid.Nil {
+		whereConditions = append(whereConditions, fmt.Sprintf("id IN (SELECT recording_id FROM course_recordings WHERE course_id = $%d)", argCounter))
+		args = append(args, query.CourseID)
+		argCounter++
+	}
+
 	if query.Status != "" && ValidateStatus(query.Status) {
 		whereConditions = append(whereConditions, fmt.Sprintf("status = $%d", argCounter))
 		args = append(args, query.Status)
@@ -289,7 +520,7 @@ func (s *RecordingService) ListRecordings(ctx context.Context, query *RecordingL
 	var total int
 	err := s.db.QueryRowContext(ctx, countQuery, args...).Scan(&total)
 	if err != nil {
-		s.log.Printf("Error counting recordings: %v", err)
+		s.log.ErrorContext(ctx, "Error counting recordings", "error", err)
 		return nil, 0, fmt.Errorf("failed to count recordings: %w", err)
 	}
 
@@ -310,7 +541,7 @@ func (s *RecordingService) ListRecordings(ctx context.Context, query *RecordingL
 
 	rows, err := s.db.QueryContext(ctx, dataQuery, args...)
 	if err != nil {
-		s.log.Printf("Error querying recordings: %v", err)
+		s.log.ErrorContext(ctx, "Error querying recordings", "error", err)
 		return nil, 0, fmt.Errorf("failed to query recordings: %w", err)
 	}
 	defer rows.Close()
@@ -343,14 +574,14 @@ func (s *RecordingService) ListRecordings(ctx context.Context, query *RecordingL
 			&rec.DeletedAt,
 		)
 		if err != nil {
-			s.log.Printf("Error scanning recording: %v", err)
+			s.log.ErrorContext(ctx, "Error scanning recording", "error", err)
 			continue
 		}
 		recordings = append(recordings, rec)
 	}
 
 	if err = rows.Err(); err != nil {
-		s.log.Printf("Error iterating recordings: %v", err)
+		s.log.ErrorContext(ctx, "Error iterating recordings", "error", err)
 		return nil, 0, fmt.Errorf("failed to iterate recordings: %w", err)
 	}
 
@@ -406,11 +637,11 @@ func (s *RecordingService) DeleteRecording(ctx context.Context, recordingID uuid
 	}
 
 	if err != nil {
-		s.log.Printf("Error deleting recording: %v", err)
+		s.log.ErrorContext(ctx, "Error deleting recording", "recording_id", recordingID, "error", err)
 		return nil, fmt.Errorf("failed to delete recording: %w", err)
 	}
 
-	s.log.Printf("Recording %s deleted", recordingID)
+	s.log.InfoContext(ctx, "Recording deleted", "recording_id", recordingID)
 	return recording, nil
 }
 
@@ -427,11 +658,11 @@ func (s *RecordingService) UpdateRecordingStatus(ctx context.Context, recordingI
 	query := `UPDATE recordings SET status = $1, updated_at = $2 WHERE id = $3`
 	_, err := s.db.ExecContext(ctx, query, status, time.Now().UTC(), recordingID)
 	if err != nil {
-		s.log.Printf("Error updating recording status: %v", err)
+		s.log.ErrorContext(ctx, "Error updating recording status", "recording_id", recordingID, "error", err)
 		return fmt.Errorf("failed to update recording status: %w", err)
 	}
 
-	s.log.Printf("Recording %s status updated to %s", recordingID, status)
+	s.log.InfoContext(ctx, "Recording status updated", "recording_id", recordingID, "status", status)
 	return nil
 }
 
@@ -444,7 +675,7 @@ func (s *RecordingService) UpdateRecordingMetadata(ctx context.Context, recordin
 	query := `UPDATE recordings SET metadata = $1, updated_at = $2 WHERE id = $3`
 	_, err := s.db.ExecContext(ctx, query, metadata, time.Now().UTC(), recordingID)
 	if err != nil {
-		s.log.Printf("Error updating recording metadata: %v", err)
+		s.log.ErrorContext(ctx, "Error updating recording metadata", "recording_id", recordingID, "error", err)
 		return fmt.Errorf("failed to update recording metadata: %w", err)
 	}
 
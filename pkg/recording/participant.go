@@ -4,7 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"sync"
 	"time"
 
@@ -15,7 +15,7 @@ import (
 type ParticipantManager struct {
 	recordingID uuid.UUID
 	db          *sql.DB
-	logger      *log.Logger
+	logger      *slog.Logger
 
 	mu           sync.RWMutex
 	participants map[uuid.UUID]*ParticipantStats
@@ -38,7 +38,7 @@ type ParticipantStats struct {
 }
 
 // NewParticipantManager creates a new participant manager
-func NewParticipantManager(recordingID uuid.UUID, db *sql.DB, logger *log.Logger) *ParticipantManager {
+func NewParticipantManager(recordingID uuid.UUID, db *sql.DB, logger *slog.Logger) *ParticipantManager {
 	return &ParticipantManager{
 		recordingID:  recordingID,
 		db:           db,
@@ -68,11 +68,11 @@ func (pm *ParticipantManager) AddParticipant(ctx context.Context, userID uuid.UU
 
 	// Persist to database
 	if err := pm.persistParticipant(ctx, userID); err != nil {
-		pm.logger.Printf("Failed to persist participant %s: %v", userID, err)
+		pm.logger.ErrorContext(ctx, "Failed to persist participant", "recording_id", pm.recordingID, "user_id", userID, "error", err)
 		// Don't return error - continue with in-memory tracking
 	}
 
-	pm.logger.Printf("Participant added: %s to recording %s", userID, pm.recordingID)
+	pm.logger.InfoContext(ctx, "Participant added", "recording_id", pm.recordingID, "user_id", userID)
 	return nil
 }
 
@@ -92,11 +92,11 @@ func (pm *ParticipantManager) RemoveParticipant(ctx context.Context, userID uuid
 
 	// Persist removal to database
 	if err := pm.persistParticipantRemoval(ctx, userID, now); err != nil {
-		pm.logger.Printf("Failed to persist participant removal: %v", err)
+		pm.logger.ErrorContext(ctx, "Failed to persist participant removal", "recording_id", pm.recordingID, "user_id", userID, "error", err)
 	}
 
 	// Keep in map for stats tracking but mark as left
-	pm.logger.Printf("Participant removed: %s from recording %s", userID, pm.recordingID)
+	pm.logger.InfoContext(ctx, "Participant removed", "recording_id", pm.recordingID, "user_id", userID)
 	return nil
 }
 
@@ -140,7 +140,7 @@ func (pm *ParticipantManager) UpdateParticipantStats(ctx context.Context, userID
 
 	// Persist to database (periodic updates)
 	if err := pm.persistParticipantStats(ctx, userID, participant); err != nil {
-		pm.logger.Printf("Failed to persist participant stats: %v", err)
+		pm.logger.ErrorContext(ctx, "Failed to persist participant stats", "recording_id", pm.recordingID, "user_id", userID, "error", err)
 	}
 
 	return nil
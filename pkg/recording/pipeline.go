@@ -0,0 +1,776 @@
+package recording
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/course"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Post-processing stages, run in this order. Each stage is recorded once it
+// succeeds, so a restarted pipeline continues after the last one.
+const (
+	StageFinalize  = "finalize"
+	StageMetadata  = "metadata"
+	StageThumbnail = "thumbnail"
+	StageTranscode = "transcode"
+	StageAttach    = "attach"
+	StagePublish   = "publish"
+	StageNotify    = "notify"
+)
+
+// PipelineStages lists the post-processing stages in order
+var PipelineStages = []string{
+	StageFinalize, StageMetadata, StageThumbnail, StageTranscode, StageAttach, StagePublish, StageNotify,
+}
+
+// Pipeline statuses
+const (
+	PipelinePending   = "pending"
+	PipelineRunning   = "running"
+	PipelineCompleted = "completed"
+	PipelineFailed    = "failed"
+)
+
+var (
+	ErrPipelineNotFound = errors.New("recording pipeline not found")
+	ErrRecordingMissing = errors.New("recording not found")
+	ErrNoRecordingFile  = errors.New("recording has no output file")
+	ErrTranscodeFailed  = errors.New("transcoding failed")
+)
+
+// PipelineState is the persisted progress of a recording's post-processing
+type PipelineState struct {
+	RecordingID uuid.UUID  `json:"recording_id"`
+	Stage       string     `json:"stage"` // last completed stage, empty before the first
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	CourseID    *uuid.UUID `json:"course_id,omitempty"`
+	JobIDs      []string   `json:"transcode_job_ids,omitempty"`
+	LastError   *string    `json:"last_error,omitempty"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// done reports whether a stage has already run
+func (s *PipelineState) done(stage string) bool {
+	return stageIndex(stage) <= stageIndex(s.Stage)
+}
+
+func stageIndex(stage string) int {
+	for i, name := range PipelineStages {
+		if name == stage {
+			return i
+		}
+	}
+	return -1
+}
+
+// PipelineStore persists pipeline state
+type PipelineStore interface {
+	// Create adds a pending pipeline unless the recording already has one
+	Create(ctx context.Context, recordingID uuid.UUID) error
+	// Load returns a pipeline or ErrPipelineNotFound
+	Load(ctx context.Context, recordingID uuid.UUID) (*PipelineState, error)
+	Save(ctx context.Context, state *PipelineState) error
+	// Unfinished lists pipelines that are pending or were running when the
+	// process stopped
+	Unfinished(ctx context.Context) ([]uuid.UUID, error)
+}
+
+// SQLPipelineStore stores pipelines in the recording_pipelines table
+type SQLPipelineStore struct {
+	db *sql.DB
+}
+
+// NewSQLPipelineStore creates a pipeline store backed by the database
+func NewSQLPipelineStore(db *sql.DB) *SQLPipelineStore {
+	return &SQLPipelineStore{db: db}
+}
+
+// Create adds a pending pipeline
+func (s *SQLPipelineStore) Create(ctx context.Context, recordingID uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO recording_pipelines (recording_id, status)
+		VALUES ($1, $2)
+		ON CONFLICT (recording_id) DO NOTHING
+	`, recordingID, PipelinePending)
+	if err != nil {
+		return fmt.Errorf("failed to create pipeline: %w", err)
+	}
+	return nil
+}
+
+// Load returns a pipeline
+func (s *SQLPipelineStore) Load(ctx context.Context, recordingID uuid.UUID) (*PipelineState, error) {
+	state := &PipelineState{RecordingID: recordingID}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT stage, status, attempts, course_id, transcode_job_ids, last_error, updated_at, completed_at
+		FROM recording_pipelines
+		WHERE recording_id = $1
+	`, recordingID).Scan(
+		&state.Stage, &state.Status, &state.Attempts, &state.CourseID,
+		pq.Array(&state.JobIDs), &state.LastError, &state.UpdatedAt, &state.CompletedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPipelineNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pipeline: %w", err)
+	}
+	return state, nil
+}
+
+// Save updates a pipeline
+func (s *SQLPipelineStore) Save(ctx context.Context, state *PipelineState) error {
+	state.UpdatedAt = time.Now().UTC()
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE recording_pipelines
+		SET stage = $1, status = $2, attempts = $3, course_id = $4, transcode_job_ids = $5,
+		    last_error = $6, updated_at = $7, completed_at = $8
+		WHERE recording_id = $9
+	`, state.Stage, state.Status, state.Attempts, state.CourseID, pq.Array(state.JobIDs),
+		state.LastError, state.UpdatedAt, state.CompletedAt, state.RecordingID)
+	if err != nil {
+		return fmt.Errorf("failed to save pipeline: %w", err)
+	}
+	return nil
+}
+
+// Unfinished lists pending and interrupted pipelines, oldest first
+func (s *SQLPipelineStore) Unfinished(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT recording_id FROM recording_pipelines
+		WHERE status IN ($1, $2)
+		ORDER BY updated_at
+	`, PipelinePending, PipelineRunning)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pipelines: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan pipeline: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// MemoryPipelineStore keeps pipelines in memory, for tests and setups
+// without a database
+type MemoryPipelineStore struct {
+	mu     sync.Mutex
+	states map[uuid.UUID]PipelineState
+}
+
+// NewMemoryPipelineStore creates an empty in-memory pipeline store
+func NewMemoryPipelineStore() *MemoryPipelineStore {
+	return &MemoryPipelineStore{states: make(map[uuid.UUID]PipelineState)}
+}
+
+// Create adds a pending pipeline
+func (s *MemoryPipelineStore) Create(ctx context.Context, recordingID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.states[recordingID]; !ok {
+		s.states[recordingID] = PipelineState{RecordingID: recordingID, Status: PipelinePending, UpdatedAt: time.Now().UTC()}
+	}
+	return nil
+}
+
+// Load returns a copy of a pipeline
+func (s *MemoryPipelineStore) Load(ctx context.Context, recordingID uuid.UUID) (*PipelineState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[recordingID]
+	if !ok {
+		return nil, ErrPipelineNotFound
+	}
+	state.JobIDs = append([]string(nil), state.JobIDs...)
+	return &state, nil
+}
+
+// Save updates a pipeline
+func (s *MemoryPipelineStore) Save(ctx context.Context, state *PipelineState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.states[state.RecordingID]; !ok {
+		return ErrPipelineNotFound
+	}
+	state.UpdatedAt = time.Now().UTC()
+	saved := *state
+	saved.JobIDs = append([]string(nil), state.JobIDs...)
+	s.states[state.RecordingID] = saved
+	return nil
+}
+
+// Unfinished lists pending and interrupted pipelines
+func (s *MemoryPipelineStore) Unfinished(ctx context.Context) ([]uuid.UUID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []uuid.UUID
+	for id, state := range s.states {
+		if state.Status == PipelinePending || state.Status == PipelineRunning {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// PipelineRecordings is the recording access the pipeline needs
+// (*RecordingService)
+type PipelineRecordings interface {
+	GetRecording(ctx context.Context, recordingID uuid.UUID) (*Recording, error)
+	StopRecording(ctx context.Context, recordingID uuid.UUID) (*Recording, error)
+	SetFileSize(ctx context.Context, recordingID uuid.UUID, size int64) error
+	MergeMetadata(ctx context.Context, recordingID uuid.UUID, patch map[string]interface{}) error
+}
+
+// MediaProcessor probes recordings and renders thumbnails (*StreamingManager)
+type MediaProcessor interface {
+	ExtractMetadata(ctx context.Context, recordingID uuid.UUID, inputPath string) (*RecordingMetadata, error)
+	GenerateThumbnail(ctx context.Context, recordingID uuid.UUID, inputPath string, timestampSeconds int) (string, error)
+}
+
+// VODTranscoder queues multi-bitrate encodes ahead of backfills
+// (*streaming.TranscodingService)
+type VODTranscoder interface {
+	StartLiveToVODEncoding(ctx context.Context, recordingID, inputPath string) ([]string, error)
+	GetRecordingTranscodingStatus(ctx context.Context, recordingID string) map[string]interface{}
+}
+
+// CoursePublisher adds recordings to courses (*course.CourseService)
+type CoursePublisher interface {
+	AddRecordingToCourse(ctx context.Context, courseID, recordingID uuid.UUID, lectureNumber int, lectureTitle string, sequence int) (*course.CourseRecording, error)
+	PublishCourseRecording(ctx context.Context, courseID, recordingID uuid.UUID) error
+	ListEnrollments(ctx context.Context, courseID uuid.UUID) ([]*course.CourseEnrollment, error)
+}
+
+// RecordingNotifier tells students about a new recording
+// (*notification.Service)
+type RecordingNotifier interface {
+	NotifyRecording(ctx context.Context, recordingID, title string, userIDs []string) error
+}
+
+// courseLink is the course a recording belongs to
+type courseLink struct {
+	CourseID uuid.UUID
+	Attached bool // already in course_recordings
+	Lectures int  // recordings the course has
+}
+
+// PipelineConfig configures post-processing
+type PipelineConfig struct {
+	Workers      int
+	MaxAttempts  int           // a pipeline fails after this many failed runs
+	RetryDelay   time.Duration // wait before retrying a failed run
+	PollInterval time.Duration // how often transcoding progress is checked
+	ThumbnailAt  int           // seconds into the recording
+}
+
+// DefaultPipelineConfig returns the default post-processing configuration
+func DefaultPipelineConfig() PipelineConfig {
+	return PipelineConfig{
+		Workers:      2,
+		MaxAttempts:  3,
+		RetryDelay:   time.Minute,
+		PollInterval: 5 * time.Second,
+		ThumbnailAt:  5,
+	}
+}
+
+// VODPipeline turns a finished recording or live stream into a published
+// course recording: it finalizes the file, extracts metadata, renders a
+// thumbnail, transcodes, attaches the recording to its course, publishes it
+// and notifies enrolled students. Stages are safe to repeat, except that a
+// crash between notifying and saving the stage notifies students twice.
+type VODPipeline struct {
+	store      PipelineStore
+	recordings PipelineRecordings
+	media      MediaProcessor
+	transcoder VODTranscoder
+	courses    CoursePublisher
+	notifier   RecordingNotifier
+	cfg        PipelineConfig
+	log        *slog.Logger
+
+	// lookupCourse is swapped out in tests
+	lookupCourse func(ctx context.Context, rec *Recording) (*courseLink, error)
+
+	queue    chan uuid.UUID
+	mu       sync.Mutex
+	inflight map[uuid.UUID]bool
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewVODPipeline creates a post-processing pipeline. db resolves the course
+// of a recording from the meeting held in its room.
+func NewVODPipeline(db *sql.DB, store PipelineStore, recordings PipelineRecordings, cfg PipelineConfig, logger *slog.Logger) *VODPipeline {
+	if logger == nil {
+		logger = slog.Default().With("component", "vod_pipeline")
+	}
+	defaults := DefaultPipelineConfig()
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaults.Workers
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaults.MaxAttempts
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaults.PollInterval
+	}
+	p := &VODPipeline{
+		store:      store,
+		recordings: recordings,
+		cfg:        cfg,
+		log:        logger,
+		queue:      make(chan uuid.UUID, 100),
+		inflight:   make(map[uuid.UUID]bool),
+	}
+	p.lookupCourse = func(ctx context.Context, rec *Recording) (*courseLink, error) {
+		return lookupRecordingCourse(ctx, db, rec)
+	}
+	return p
+}
+
+// WithMedia extracts metadata and thumbnails with the given processor
+func (p *VODPipeline) WithMedia(media MediaProcessor) *VODPipeline {
+	p.media = media
+	return p
+}
+
+// WithTranscoder queues multi-bitrate encodes and waits for them before the
+// recording is published
+func (p *VODPipeline) WithTranscoder(transcoder VODTranscoder) *VODPipeline {
+	p.transcoder = transcoder
+	return p
+}
+
+// WithCourses attaches and publishes recordings in their course
+func (p *VODPipeline) WithCourses(courses CoursePublisher) *VODPipeline {
+	p.courses = courses
+	return p
+}
+
+// WithNotifier notifies enrolled students once a recording is published
+func (p *VODPipeline) WithNotifier(notifier RecordingNotifier) *VODPipeline {
+	p.notifier = notifier
+	return p
+}
+
+// Start starts the workers and resumes pipelines that were pending or
+// interrupted when the process stopped
+func (p *VODPipeline) Start(ctx context.Context) error {
+	runCtx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	for i := 0; i < p.cfg.Workers; i++ {
+		p.wg.Add(1)
+		go p.worker(runCtx)
+	}
+
+	ids, err := p.store.Unfinished(ctx)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		p.schedule(id)
+	}
+	if len(ids) > 0 {
+		p.log.InfoContext(ctx, "Resuming recording pipelines", "count", len(ids))
+	}
+	return nil
+}
+
+// Stop stops the workers. Interrupted pipelines resume on the next Start.
+func (p *VODPipeline) Stop(ctx context.Context) error {
+	if p.cancel == nil {
+		return nil
+	}
+	p.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Enqueue persists a pipeline for a recording and schedules it. Enqueuing a
+// recording twice is harmless.
+func (p *VODPipeline) Enqueue(ctx context.Context, recordingID uuid.UUID) error {
+	if err := p.store.Create(ctx, recordingID); err != nil {
+		return err
+	}
+	p.schedule(recordingID)
+	return nil
+}
+
+// Status returns the progress of a recording's pipeline
+func (p *VODPipeline) Status(ctx context.Context, recordingID uuid.UUID) (*PipelineState, error) {
+	return p.store.Load(ctx, recordingID)
+}
+
+// Retry restarts a failed pipeline from the stage that failed
+func (p *VODPipeline) Retry(ctx context.Context, recordingID uuid.UUID) (*PipelineState, error) {
+	state, err := p.store.Load(ctx, recordingID)
+	if err != nil {
+		return nil, err
+	}
+	if state.Status == PipelineFailed {
+		state.Status = PipelinePending
+		state.Attempts = 0
+		if err := p.store.Save(ctx, state); err != nil {
+			return nil, err
+		}
+	}
+	if state.Status != PipelineCompleted {
+		p.schedule(recordingID)
+	}
+	return state, nil
+}
+
+// schedule queues a pipeline unless it is already queued or running. A full
+// queue is not an error: the pipeline stays pending and resumes on restart.
+func (p *VODPipeline) schedule(recordingID uuid.UUID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.inflight[recordingID] {
+		return
+	}
+	select {
+	case p.queue <- recordingID:
+		p.inflight[recordingID] = true
+	default:
+		p.log.Warn("Pipeline queue full", "recording_id", recordingID)
+	}
+}
+
+func (p *VODPipeline) worker(ctx context.Context) {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-p.queue:
+			err := p.Run(ctx, id)
+
+			p.mu.Lock()
+			delete(p.inflight, id)
+			p.mu.Unlock()
+
+			if err != nil && ctx.Err() == nil && !errors.Is(err, errPipelineGaveUp) {
+				p.retryLater(ctx, id)
+			}
+		}
+	}
+}
+
+// retryLater schedules a failed run again after the retry delay
+func (p *VODPipeline) retryLater(ctx context.Context, recordingID uuid.UUID) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		select {
+		case <-time.After(p.cfg.RetryDelay):
+			p.schedule(recordingID)
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// errPipelineGaveUp marks a pipeline that used up its attempts
+var errPipelineGaveUp = errors.New("pipeline failed too many times")
+
+// Run runs the remaining stages of a recording's pipeline
+func (p *VODPipeline) Run(ctx context.Context, recordingID uuid.UUID) error {
+	state, err := p.store.Load(ctx, recordingID)
+	if err != nil {
+		return err
+	}
+	if state.Status == PipelineCompleted || state.Status == PipelineFailed {
+		return nil
+	}
+
+	state.Status = PipelineRunning
+	state.Attempts++
+	if err := p.store.Save(ctx, state); err != nil {
+		return err
+	}
+
+	for _, stage := range PipelineStages {
+		if state.done(stage) {
+			continue
+		}
+		if err := p.runStage(ctx, stage, state); err != nil {
+			return p.fail(ctx, state, stage, err)
+		}
+		state.Stage = stage
+		if err := p.store.Save(ctx, state); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().UTC()
+	state.Status = PipelineCompleted
+	state.LastError = nil
+	state.CompletedAt = &now
+	if err := p.store.Save(ctx, state); err != nil {
+		return err
+	}
+	p.log.InfoContext(ctx, "Recording post-processing completed", "recording_id", recordingID)
+	return nil
+}
+
+// fail records a failed stage. The pipeline is retried until it runs out of
+// attempts; a stopped process leaves it running, to resume on restart.
+func (p *VODPipeline) fail(ctx context.Context, state *PipelineState, stage string, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("%s: %v", stage, err)
+	state.LastError = &message
+	state.Status = PipelinePending
+	if state.Attempts >= p.cfg.MaxAttempts {
+		state.Status = PipelineFailed
+	}
+	if saveErr := p.store.Save(ctx, state); saveErr != nil {
+		p.log.ErrorContext(ctx, "Failed to save pipeline", "recording_id", state.RecordingID, "error", saveErr)
+	}
+
+	p.log.ErrorContext(ctx, "Recording post-processing failed", "recording_id", state.RecordingID,
+		"stage", stage, "attempt", state.Attempts, "error", err)
+	if state.Status == PipelineFailed {
+		return fmt.Errorf("%w: %s", errPipelineGaveUp, message)
+	}
+	return fmt.Errorf("stage %s failed: %w", stage, err)
+}
+
+func (p *VODPipeline) runStage(ctx context.Context, stage string, state *PipelineState) error {
+	rec, err := p.recordings.GetRecording(ctx, state.RecordingID)
+	if err != nil {
+		return err
+	}
+	if rec == nil || rec.Status == StatusDeleted {
+		return ErrRecordingMissing
+	}
+
+	switch stage {
+	case StageFinalize:
+		return p.finalize(ctx, rec)
+	case StageMetadata:
+		return p.extractMetadata(ctx, rec)
+	case StageThumbnail:
+		return p.thumbnail(ctx, rec)
+	case StageTranscode:
+		return p.transcode(ctx, rec, state)
+	case StageAttach:
+		return p.attach(ctx, rec, state)
+	case StagePublish:
+		if p.courses == nil || state.CourseID == nil {
+			return nil
+		}
+		return p.courses.PublishCourseRecording(ctx, *state.CourseID, rec.ID)
+	case StageNotify:
+		return p.notify(ctx, rec, state)
+	}
+	return fmt.Errorf("unknown stage %q", stage)
+}
+
+// finalize stops a recording that is still running, as when a live stream
+// ends first, and records the size of the closed file
+func (p *VODPipeline) finalize(ctx context.Context, rec *Recording) error {
+	if rec.Status == StatusPending || rec.Status == StatusRecording {
+		stopped, err := p.recordings.StopRecording(ctx, rec.ID)
+		if err != nil {
+			return err
+		}
+		*rec = *stopped
+	}
+	if rec.FilePath == nil || *rec.FilePath == "" {
+		return ErrNoRecordingFile
+	}
+
+	info, err := os.Stat(*rec.FilePath)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNoRecordingFile, err)
+	}
+	return p.recordings.SetFileSize(ctx, rec.ID, info.Size())
+}
+
+func (p *VODPipeline) extractMetadata(ctx context.Context, rec *Recording) error {
+	if p.media == nil {
+		return nil
+	}
+	metadata, err := p.media.ExtractMetadata(ctx, rec.ID, *rec.FilePath)
+	if err != nil {
+		return err
+	}
+	return p.recordings.MergeMetadata(ctx, rec.ID, map[string]interface{}{
+		"probe": map[string]interface{}{
+			"raw":          metadata.RawData,
+			"extracted_at": metadata.ExtractedAt,
+		},
+	})
+}
+
+func (p *VODPipeline) thumbnail(ctx context.Context, rec *Recording) error {
+	if p.media == nil {
+		return nil
+	}
+	at := p.cfg.ThumbnailAt
+	if rec.DurationSeconds != nil && *rec.DurationSeconds < 2*at {
+		at = *rec.DurationSeconds / 2
+	}
+	_, err := p.media.GenerateThumbnail(ctx, rec.ID, *rec.FilePath, at)
+	return err
+}
+
+// transcode queues the encodes once and waits for them. Jobs missing from
+// the transcoder, e.g. lost to a restart of a transcoder without a database,
+// are queued again.
+func (p *VODPipeline) transcode(ctx context.Context, rec *Recording, state *PipelineState) error {
+	if p.transcoder == nil {
+		return nil
+	}
+
+	for {
+		total, completed, failed := transcodeCounts(p.transcoder.GetRecordingTranscodingStatus(ctx, rec.ID.String()))
+		switch {
+		case total == 0:
+			jobIDs, err := p.transcoder.StartLiveToVODEncoding(ctx, rec.ID.String(), *rec.FilePath)
+			if err != nil {
+				return err
+			}
+			state.JobIDs = jobIDs
+			if err := p.store.Save(ctx, state); err != nil {
+				return err
+			}
+		case failed > 0:
+			return fmt.Errorf("%w: %d of %d jobs failed", ErrTranscodeFailed, failed, total)
+		case completed == total:
+			return nil
+		}
+
+		select {
+		case <-time.After(p.cfg.PollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// transcodeCounts reads the job counts of a transcoding status
+func transcodeCounts(status map[string]interface{}) (total, completed, failed int) {
+	total, _ = status["total_jobs"].(int)
+	completed, _ = status["completed_count"].(int)
+	failed, _ = status["failed_count"].(int)
+	return total, completed, failed
+}
+
+// attach adds the recording to the course of the meeting it was recorded in,
+// as the course's next lecture. Recordings outside a course are not
+// attached, published or announced.
+func (p *VODPipeline) attach(ctx context.Context, rec *Recording, state *PipelineState) error {
+	if p.courses == nil {
+		return nil
+	}
+	link, err := p.lookupCourse(ctx, rec)
+	if err != nil {
+		return err
+	}
+	if link == nil {
+		p.log.InfoContext(ctx, "Recording has no course", "recording_id", rec.ID)
+		return nil
+	}
+
+	state.CourseID = &link.CourseID
+	if link.Attached {
+		return nil
+	}
+	_, err = p.courses.AddRecordingToCourse(ctx, link.CourseID, rec.ID, link.Lectures+1, rec.Title, link.Lectures)
+	return err
+}
+
+func (p *VODPipeline) notify(ctx context.Context, rec *Recording, state *PipelineState) error {
+	if p.notifier == nil || p.courses == nil || state.CourseID == nil {
+		return nil
+	}
+	enrollments, err := p.courses.ListEnrollments(ctx, *state.CourseID)
+	if err != nil {
+		return err
+	}
+
+	var students []string
+	for _, enrollment := range enrollments {
+		if enrollment.Status == "active" {
+			students = append(students, enrollment.StudentID.String())
+		}
+	}
+	if len(students) == 0 {
+		return nil
+	}
+	return p.notifier.NotifyRecording(ctx, rec.ID.String(), rec.Title, students)
+}
+
+// lookupRecordingCourse finds the course a recording is already in, or else
+// the course of the latest meeting held in its room
+func lookupRecordingCourse(ctx context.Context, db *sql.DB, rec *Recording) (*courseLink, error) {
+	if db == nil {
+		return nil, nil
+	}
+
+	link := &courseLink{}
+	err := db.QueryRowContext(ctx,
+		`SELECT course_id FROM course_recordings WHERE recording_id = $1 LIMIT 1`, rec.ID,
+	).Scan(&link.CourseID)
+	if err == nil {
+		link.Attached = true
+		return link, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to look up course recording: %w", err)
+	}
+
+	err = db.QueryRowContext(ctx, `
+		SELECT m.course_id,
+		       (SELECT COUNT(*) FROM course_recordings cr WHERE cr.course_id = m.course_id)
+		FROM meetings m
+		WHERE m.room_id = $1 AND m.course_id IS NOT NULL
+		ORDER BY m.scheduled_at DESC
+		LIMIT 1
+	`, rec.RoomID.String()).Scan(&link.CourseID, &link.Lectures)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up recording course: %w", err)
+	}
+	return link, nil
+}
@@ -0,0 +1,327 @@
+package recording
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/course"
+	"github.com/Bashar444/VTP/pkg/logging"
+	"github.com/google/uuid"
+)
+
+// fakePipelineDeps records the calls the pipeline makes
+type fakePipelineDeps struct {
+	mu          sync.Mutex
+	recording   *Recording
+	calls       map[string]int
+	failJobs    bool
+	jobs        int
+	students    []*course.CourseEnrollment
+	notified    []string
+	attachedTo  uuid.UUID
+	lectureNum  int
+	publishedTo uuid.UUID
+}
+
+func (f *fakePipelineDeps) called(name string) {
+	f.mu.Lock()
+	f.calls[name]++
+	f.mu.Unlock()
+}
+
+func (f *fakePipelineDeps) count(name string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[name]
+}
+
+func (f *fakePipelineDeps) GetRecording(ctx context.Context, recordingID uuid.UUID) (*Recording, error) {
+	copied := *f.recording
+	return &copied, nil
+}
+
+func (f *fakePipelineDeps) StopRecording(ctx context.Context, recordingID uuid.UUID) (*Recording, error) {
+	f.called("stop")
+	f.recording.Status = StatusCompleted
+	return f.GetRecording(ctx, recordingID)
+}
+
+func (f *fakePipelineDeps) SetFileSize(ctx context.Context, recordingID uuid.UUID, size int64) error {
+	f.called("size")
+	f.recording.FileSizeBytes = &size
+	return nil
+}
+
+func (f *fakePipelineDeps) MergeMetadata(ctx context.Context, recordingID uuid.UUID, patch map[string]interface{}) error {
+	f.called("metadata")
+	return nil
+}
+
+func (f *fakePipelineDeps) ExtractMetadata(ctx context.Context, recordingID uuid.UUID, inputPath string) (*RecordingMetadata, error) {
+	f.called("probe")
+	return &RecordingMetadata{RecordingID: recordingID, RawData: "duration=60", ExtractedAt: time.Now()}, nil
+}
+
+func (f *fakePipelineDeps) GenerateThumbnail(ctx context.Context, recordingID uuid.UUID, inputPath string, timestampSeconds int) (string, error) {
+	f.called("thumbnail")
+	return inputPath + ".jpg", nil
+}
+
+func (f *fakePipelineDeps) StartLiveToVODEncoding(ctx context.Context, recordingID, inputPath string) ([]string, error) {
+	f.called("transcode")
+	f.mu.Lock()
+	f.jobs = 4
+	f.mu.Unlock()
+	return []string{"job-1", "job-2", "job-3", "job-4"}, nil
+}
+
+func (f *fakePipelineDeps) GetRecordingTranscodingStatus(ctx context.Context, recordingID string) map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status := map[string]interface{}{"recording_id": recordingID, "total_jobs": f.jobs}
+	if f.jobs > 0 {
+		status["completed_count"] = f.jobs
+		status["failed_count"] = 0
+		if f.failJobs {
+			status["completed_count"] = f.jobs - 1
+			status["failed_count"] = 1
+		}
+	}
+	return status
+}
+
+func (f *fakePipelineDeps) AddRecordingToCourse(ctx context.Context, courseID, recordingID uuid.UUID, lectureNumber int, lectureTitle string, sequence int) (*course.CourseRecording, error) {
+	f.called("attach")
+	f.attachedTo = courseID
+	f.lectureNum = lectureNumber
+	return &course.CourseRecording{CourseID: courseID, RecordingID: recordingID}, nil
+}
+
+func (f *fakePipelineDeps) PublishCourseRecording(ctx context.Context, courseID, recordingID uuid.UUID) error {
+	f.called("publish")
+	f.publishedTo = courseID
+	return nil
+}
+
+func (f *fakePipelineDeps) ListEnrollments(ctx context.Context, courseID uuid.UUID) ([]*course.CourseEnrollment, error) {
+	return f.students, nil
+}
+
+func (f *fakePipelineDeps) NotifyRecording(ctx context.Context, recordingID, title string, userIDs []string) error {
+	f.called("notify")
+	f.notified = append(f.notified, userIDs...)
+	return nil
+}
+
+func newTestPipeline(t *testing.T, status string) (*VODPipeline, *fakePipelineDeps, *MemoryPipelineStore, uuid.UUID) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "class.webm")
+	if err := os.WriteFile(path, []byte("recording"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	duration := 60
+	deps := &fakePipelineDeps{
+		recording: &Recording{
+			ID:              uuid.New(),
+			RoomID:          uuid.New(),
+			Title:           "Lecture 3",
+			Status:          status,
+			FilePath:        &path,
+			DurationSeconds: &duration,
+		},
+		calls: make(map[string]int),
+		students: []*course.CourseEnrollment{
+			{StudentID: uuid.New(), Status: "active"},
+			{StudentID: uuid.New(), Status: "dropped"},
+		},
+	}
+
+	courseID := uuid.New()
+	store := NewMemoryPipelineStore()
+	cfg := DefaultPipelineConfig()
+	cfg.PollInterval = time.Millisecond
+	cfg.MaxAttempts = 2
+	p := NewVODPipeline(nil, store, deps, cfg, logging.Discard()).
+		WithMedia(deps).
+		WithTranscoder(deps).
+		WithCourses(deps).
+		WithNotifier(deps)
+	p.lookupCourse = func(ctx context.Context, rec *Recording) (*courseLink, error) {
+		return &courseLink{CourseID: courseID, Lectures: 2}, nil
+	}
+	return p, deps, store, courseID
+}
+
+// TestPipelineRun tests a full post-processing run
+func TestPipelineRun(t *testing.T) {
+	ctx := context.Background()
+	p, deps, store, courseID := newTestPipeline(t, StatusRecording)
+	recordingID := deps.recording.ID
+
+	if err := store.Create(ctx, recordingID); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Run(ctx, recordingID); err != nil {
+		t.Fatalf("Pipeline failed: %v", err)
+	}
+
+	state, _ := store.Load(ctx, recordingID)
+	if state.Status != PipelineCompleted || state.Stage != StageNotify || state.CompletedAt == nil {
+		t.Errorf("Unexpected state %+v", state)
+	}
+	if len(state.JobIDs) != 4 || state.CourseID == nil || *state.CourseID != courseID {
+		t.Errorf("Jobs or course not persisted: %+v", state)
+	}
+
+	// A live stream that ended first stops its recording
+	if deps.count("stop") != 1 || *deps.recording.FileSizeBytes != int64(len("recording")) {
+		t.Error("Recording not finalized")
+	}
+	for _, call := range []string{"probe", "metadata", "thumbnail", "transcode", "attach", "publish", "notify"} {
+		if deps.count(call) != 1 {
+			t.Errorf("Expected one %s call, got %d", call, deps.count(call))
+		}
+	}
+	if deps.attachedTo != courseID || deps.lectureNum != 3 || deps.publishedTo != courseID {
+		t.Errorf("Attached to %s as lecture %d, published to %s", deps.attachedTo, deps.lectureNum, deps.publishedTo)
+	}
+	if len(deps.notified) != 1 || deps.notified[0] != deps.students[0].StudentID.String() {
+		t.Errorf("Expected only the active student notified, got %v", deps.notified)
+	}
+
+	// Running a completed pipeline does nothing
+	if err := p.Run(ctx, recordingID); err != nil || deps.count("notify") != 1 {
+		t.Errorf("Completed pipeline ran again: %v", err)
+	}
+
+	t.Log("✓ Recording post-processed")
+}
+
+// TestPipelineResume tests that a pipeline interrupted mid-way continues
+// after its last completed stage
+func TestPipelineResume(t *testing.T) {
+	ctx := context.Background()
+	p, deps, store, _ := newTestPipeline(t, StatusCompleted)
+	recordingID := deps.recording.ID
+
+	// The process stopped while transcoding; the transcoder lost its jobs
+	store.Create(ctx, recordingID)
+	state, _ := store.Load(ctx, recordingID)
+	state.Stage = StageThumbnail
+	state.Status = PipelineRunning
+	state.JobIDs = []string{"lost-job"}
+	store.Save(ctx, state)
+
+	ids, _ := store.Unfinished(ctx)
+	if len(ids) != 1 || ids[0] != recordingID {
+		t.Fatalf("Interrupted pipeline not listed as unfinished: %v", ids)
+	}
+
+	if err := p.Run(ctx, recordingID); err != nil {
+		t.Fatalf("Resumed pipeline failed: %v", err)
+	}
+	for _, call := range []string{"size", "probe", "thumbnail"} {
+		if deps.count(call) != 0 {
+			t.Errorf("Completed stage %s ran again", call)
+		}
+	}
+	if deps.count("transcode") != 1 || deps.count("publish") != 1 {
+		t.Error("Remaining stages did not run")
+	}
+
+	t.Log("✓ Interrupted pipeline resumed")
+}
+
+// TestPipelineFailure tests retries, giving up and manual retry
+func TestPipelineFailure(t *testing.T) {
+	ctx := context.Background()
+	p, deps, store, _ := newTestPipeline(t, StatusCompleted)
+	recordingID := deps.recording.ID
+	deps.failJobs = true
+	store.Create(ctx, recordingID)
+
+	if err := p.Run(ctx, recordingID); !errors.Is(err, ErrTranscodeFailed) {
+		t.Fatalf("Expected ErrTranscodeFailed, got %v", err)
+	}
+	state, _ := store.Load(ctx, recordingID)
+	if state.Status != PipelinePending || state.Stage != StageThumbnail || state.LastError == nil {
+		t.Errorf("Expected a pending pipeline after the first failure, got %+v", state)
+	}
+
+	// The second failure uses up the attempts
+	if err := p.Run(ctx, recordingID); !errors.Is(err, errPipelineGaveUp) {
+		t.Fatalf("Expected the pipeline to give up, got %v", err)
+	}
+	state, _ = store.Load(ctx, recordingID)
+	if state.Status != PipelineFailed || deps.count("attach") != 0 {
+		t.Errorf("Expected a failed pipeline that never attached, got %+v", state)
+	}
+
+	deps.failJobs = false
+	if _, err := p.Retry(ctx, recordingID); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Run(ctx, recordingID); err != nil {
+		t.Fatalf("Retried pipeline failed: %v", err)
+	}
+	state, _ = store.Load(ctx, recordingID)
+	if state.Status != PipelineCompleted || state.LastError != nil {
+		t.Errorf("Expected a completed pipeline after retry, got %+v", state)
+	}
+
+	t.Log("✓ Failed pipeline retried")
+}
+
+// TestPipelineWithoutCourse tests that recordings outside a course are
+// processed but not published
+func TestPipelineWithoutCourse(t *testing.T) {
+	ctx := context.Background()
+	p, deps, store, _ := newTestPipeline(t, StatusCompleted)
+	p.lookupCourse = func(ctx context.Context, rec *Recording) (*courseLink, error) { return nil, nil }
+	store.Create(ctx, deps.recording.ID)
+
+	if err := p.Run(ctx, deps.recording.ID); err != nil {
+		t.Fatal(err)
+	}
+	if deps.count("transcode") != 1 || deps.count("attach")+deps.count("publish")+deps.count("notify") != 0 {
+		t.Errorf("Unexpected calls %v", deps.calls)
+	}
+
+	t.Log("✓ Recording without course processed")
+}
+
+// TestPipelineEnqueue tests that queued pipelines run on the workers
+func TestPipelineEnqueue(t *testing.T) {
+	ctx := context.Background()
+	p, deps, store, _ := newTestPipeline(t, StatusCompleted)
+	if err := p.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop(ctx)
+
+	for i := 0; i < 2; i++ {
+		if err := p.Enqueue(ctx, deps.recording.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if state, _ := store.Load(ctx, deps.recording.ID); state.Status == PipelineCompleted {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	state, _ := store.Load(ctx, deps.recording.ID)
+	if state.Status != PipelineCompleted || deps.count("notify") != 1 {
+		t.Errorf("Expected one completed run, got %+v and %d notifications", state, deps.count("notify"))
+	}
+
+	t.Log("✓ Queued pipeline ran")
+}
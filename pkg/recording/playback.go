@@ -4,14 +4,19 @@ import (
 	"bufio"
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Bashar444/VTP/pkg/auth"
+	"github.com/Bashar444/VTP/pkg/course"
+	"github.com/Bashar444/VTP/pkg/logging"
+	"github.com/Bashar444/VTP/pkg/router"
 	"github.com/google/uuid"
 )
 
@@ -19,11 +24,15 @@ import (
 type PlaybackHandlers struct {
 	streamingManager *StreamingManager
 	service          *RecordingService
-	logger           *log.Logger
+	sharing          *SharingService
+	logger           *slog.Logger
 }
 
 // NewPlaybackHandlers creates new playback handler
-func NewPlaybackHandlers(streamingManager *StreamingManager, service *RecordingService, logger *log.Logger) *PlaybackHandlers {
+func NewPlaybackHandlers(streamingManager *StreamingManager, service *RecordingService, logger *slog.Logger) *PlaybackHandlers {
+	if logger == nil {
+		logger = logging.Discard()
+	}
 	return &PlaybackHandlers{
 		streamingManager: streamingManager,
 		service:          service,
@@ -31,10 +40,71 @@ func NewPlaybackHandlers(streamingManager *StreamingManager, service *RecordingS
 	}
 }
 
+// WithSharing checks access to the stream against the recording's shares
+// and logs every access. Without it only members of the recording's course
+// can stream it.
+func (h *PlaybackHandlers) WithSharing(sharing *SharingService) *PlaybackHandlers {
+	h.sharing = sharing
+	return h
+}
+
+// authorize checks access to a recording's stream when sharing is enabled.
+// It writes the error response and returns false if access is denied.
+func (h *PlaybackHandlers) authorize(w http.ResponseWriter, r *http.Request, recordingID uuid.UUID, action string) (*AccessGrant, bool) {
+	if h.sharing == nil {
+		return nil, true
+	}
+	grant, err := h.sharing.CheckAccess(r, recordingID, action)
+	if err != nil {
+		status, message := accessErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			h.logger.ErrorContext(r.Context(), "Failed to check recording access", "recording_id", recordingID, "error", err)
+		}
+		http.Error(w, message, status)
+		return nil, false
+	}
+	return grant, true
+}
+
+// playbackSigner returns the signer of playback tokens, nil when they are
+// not enabled
+func (h *PlaybackHandlers) playbackSigner() *PlaybackSigner {
+	if h.streamingManager == nil {
+		return nil
+	}
+	return h.streamingManager.signer
+}
+
+// playbackToken verifies the playback token of a stream request, see
+// RequirePlaybackToken
+func (h *PlaybackHandlers) playbackToken(authn router.Middleware, check ...router.Middleware) router.Middleware {
+	return RequirePlaybackToken(h.playbackSigner(), h.logger, authn, check...)
+}
+
+// segmentToken issues the short-lived playback token segment URIs carry,
+// for the user or share that was granted access to the playlist
+func (h *PlaybackHandlers) segmentToken(r *http.Request, recordingID uuid.UUID, grant *AccessGrant) (string, error) {
+	userID, _ := r.Context().Value("user_id").(string)
+	role, _ := r.Context().Value("user_role").(string)
+	var shareID string
+	if grant != nil {
+		userID = ""
+		if grant.UserID != nil {
+			userID = grant.UserID.String()
+		}
+		if grant.Share != nil {
+			shareID = grant.Share.ID.String()
+		}
+	}
+
+	signer := h.playbackSigner()
+	token, _, err := signer.IssueSegment(recordingID, userID, role, shareID, signer.ClientIP(r), time.Now())
+	return token, err
+}
+
 // StreamHLSPlaylistHandler serves HLS master playlist
 func (h *PlaybackHandlers) StreamHLSPlaylistHandler(w http.ResponseWriter, r *http.Request) {
-	recordingIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/recordings/")
-	recordingIDStr = strings.TrimSuffix(recordingIDStr, "/stream/playlist.m3u8")
+	recordingIDStr := r.PathValue("id")
 
 	recordingID, err := uuid.Parse(recordingIDStr)
 	if err != nil {
@@ -57,8 +127,16 @@ func (h *PlaybackHandlers) StreamHLSPlaylistHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
-	// Log playback start
-	h.streamingManager.LogPlaybackEvent(ctx, recordingID, uuid.Nil, "playback_start", nil)
+	// Loading the playlist is a view; with sharing enabled it is logged
+	// by the access check. Reloads with a playback token are checked too,
+	// so revoked access ends playback once the segment tokens expire.
+	grant, ok := h.authorize(w, r, recordingID, AccessActionView)
+	if !ok {
+		return
+	}
+	if _, reload := PlaybackClaimsFromContext(r.Context()); !reload && h.sharing == nil {
+		h.streamingManager.LogPlaybackEvent(ctx, recordingID, uuid.Nil, "playback_start", nil)
+	}
 
 	// Generate master playlist
 	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
@@ -78,37 +156,50 @@ segment-001.ts
 #EXT-X-ENDLIST
 `
 
+	// Segment requests carry a playback token, or else link holders fetch
+	// the segments with the same share token
+	if h.playbackSigner() != nil {
+		token, err := h.segmentToken(r, recordingID, grant)
+		if err != nil {
+			h.logger.ErrorContext(r.Context(), "Failed to issue playback token", "recording_id", recordingID, "error", err)
+			http.Error(w, "Failed to issue playback token", http.StatusInternalServerError)
+			return
+		}
+		playlist = rewritePlaylistURIs(playlist, url.Values{PlaybackTokenParam: {token}})
+	} else if grant != nil && grant.ShareToken() != "" {
+		playlist = rewritePlaylistURIs(playlist, url.Values{ShareTokenParam: {grant.ShareToken()}})
+	}
+
 	fmt.Fprint(w, playlist)
-	h.logger.Printf("HLS playlist requested for recording: %s", recordingID)
+	h.logger.InfoContext(r.Context(), "HLS playlist requested", "recording_id", recordingID)
 }
 
 // StreamHLSSegmentHandler serves individual HLS segments
 func (h *PlaybackHandlers) StreamHLSSegmentHandler(w http.ResponseWriter, r *http.Request) {
-	recordingIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/recordings/")
-	parts := strings.Split(recordingIDStr, "/")
-
-	if len(parts) < 1 {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
-		return
-	}
-
-	recordingID, err := uuid.Parse(parts[0])
+	recordingID, err := uuid.Parse(r.PathValue("id"))
 	if err != nil {
 		http.Error(w, "Invalid recording ID", http.StatusBadRequest)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
-	defer cancel()
+	// A playback token was verified without the database; other requests
+	// are checked against the recording
+	if _, ok := PlaybackClaimsFromContext(r.Context()); !ok {
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
 
-	// Verify recording exists
-	if _, err := h.service.GetRecording(ctx, recordingID); err != nil {
-		http.Error(w, "Recording not found", http.StatusNotFound)
-		return
+		if _, err := h.service.GetRecording(ctx, recordingID); err != nil {
+			http.Error(w, "Recording not found", http.StatusNotFound)
+			return
+		}
+
+		if _, ok := h.authorize(w, r, recordingID, AccessActionStream); !ok {
+			return
+		}
 	}
 
-	// Extract segment name from URL
-	segmentPath := filepath.Join(h.streamingManager.outputPath, recordingID.String(), filepath.Base(r.URL.Path))
+	// Extract segment name from the route
+	segmentPath := filepath.Join(h.streamingManager.outputPath, recordingID.String(), filepath.Base(r.PathValue("segment")))
 
 	// Validate path is within recording directory (security)
 	absPath, err := filepath.Abs(segmentPath)
@@ -144,7 +235,7 @@ func (h *PlaybackHandlers) StreamHLSSegmentHandler(w http.ResponseWriter, r *htt
 	// Support range requests for seeking
 	http.ServeContent(w, r, filepath.Base(absPath), fileInfo.ModTime(), file)
 
-	h.logger.Printf("Segment streamed for recording: %s, segment: %s", recordingID, filepath.Base(r.URL.Path))
+	h.logger.DebugContext(r.Context(), "Segment streamed", "recording_id", recordingID, "segment", filepath.Base(r.URL.Path))
 }
 
 // GetRecordingInfoHandler returns recording metadata and streaming info
@@ -154,8 +245,7 @@ func (h *PlaybackHandlers) GetRecordingInfoHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	recordingIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/recordings/")
-	recordingIDStr = strings.TrimSuffix(recordingIDStr, "/info")
+	recordingIDStr := r.PathValue("id")
 
 	recordingID, err := uuid.Parse(recordingIDStr)
 	if err != nil {
@@ -175,7 +265,7 @@ func (h *PlaybackHandlers) GetRecordingInfoHandler(w http.ResponseWriter, r *htt
 	// Get analytics
 	analytics, err := h.streamingManager.GetPlaybackAnalytics(ctx, recordingID)
 	if err != nil {
-		h.logger.Printf("Failed to get analytics: %v", err)
+		h.logger.ErrorContext(r.Context(), "Failed to get analytics", "error", err)
 		analytics = &PlaybackAnalytics{RecordingID: recordingID}
 	}
 
@@ -202,7 +292,15 @@ func (h *PlaybackHandlers) GetRecordingInfoHandler(w http.ResponseWriter, r *htt
 	// Add streaming info if ready
 	if recording.Status == StatusCompleted {
 		response["streaming_ready"] = true
-		response["streaming_url"] = fmt.Sprintf("/api/v1/recordings/%s/stream/playlist.m3u8", recordingID)
+		userID, _ := r.Context().Value("user_id").(string)
+		role, _ := r.Context().Value("user_role").(string)
+		clientIP := ""
+		if signer := h.playbackSigner(); signer != nil {
+			clientIP = signer.ClientIP(r)
+		}
+		if streamingURL, err := h.streamingManager.playlistURL(recordingID, userID, role, clientIP); err == nil {
+			response["streaming_url"] = streamingURL
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -219,8 +317,7 @@ func (h *PlaybackHandlers) GetRecordingThumbnailHandler(w http.ResponseWriter, r
 		return
 	}
 
-	recordingIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/recordings/")
-	recordingIDStr = strings.TrimSuffix(recordingIDStr, "/thumbnail")
+	recordingIDStr := r.PathValue("id")
 
 	recordingID, err := uuid.Parse(recordingIDStr)
 	if err != nil {
@@ -268,8 +365,7 @@ func (h *PlaybackHandlers) TranscodeRecordingHandler(w http.ResponseWriter, r *h
 		return
 	}
 
-	recordingIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/recordings/")
-	recordingIDStr = strings.TrimSuffix(recordingIDStr, "/transcode")
+	recordingIDStr := r.PathValue("id")
 
 	recordingID, err := uuid.Parse(recordingIDStr)
 	if err != nil {
@@ -307,7 +403,7 @@ func (h *PlaybackHandlers) TranscodeRecordingHandler(w http.ResponseWriter, r *h
 
 	// Start transcoding in background (non-blocking)
 	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Hour)
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 1*time.Hour)
 		defer cancel()
 
 		if format == "hls" {
@@ -317,7 +413,7 @@ func (h *PlaybackHandlers) TranscodeRecordingHandler(w http.ResponseWriter, r *h
 		}
 
 		if err != nil {
-			h.logger.Printf("Transcoding failed for %s: %v", recordingID, err)
+			h.logger.ErrorContext(ctx, "Transcoding failed", "recording_id", recordingID, "error", err)
 		}
 	}()
 
@@ -325,7 +421,7 @@ func (h *PlaybackHandlers) TranscodeRecordingHandler(w http.ResponseWriter, r *h
 	w.WriteHeader(http.StatusAccepted)
 	fmt.Fprintf(w, `{"status":"transcoding_started","format":"%s"}`, format)
 
-	h.logger.Printf("Transcoding started for recording: %s, format: %s", recordingID, format)
+	h.logger.InfoContext(r.Context(), "Transcoding started", "recording_id", recordingID, "format", format)
 }
 
 // PlaybackProgressHandler updates playback progress for a user
@@ -335,8 +431,7 @@ func (h *PlaybackHandlers) PlaybackProgressHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	recordingIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/recordings/")
-	recordingIDStr = strings.TrimSuffix(recordingIDStr, "/progress")
+	recordingIDStr := r.PathValue("id")
 
 	recordingID, err := uuid.Parse(recordingIDStr)
 	if err != nil {
@@ -371,14 +466,14 @@ func (h *PlaybackHandlers) PlaybackProgressHandler(w http.ResponseWriter, r *htt
 
 	err = h.streamingManager.LogPlaybackEvent(ctx, recordingID, uuid.Nil, "playback_progress", metadata)
 	if err != nil {
-		h.logger.Printf("Failed to log playback progress: %v", err)
+		h.logger.ErrorContext(r.Context(), "Failed to log playback progress", "error", err)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, `{"position":%d}`, position)
 
-	h.logger.Printf("Playback progress updated: %s, position: %d seconds", recordingID, position)
+	h.logger.DebugContext(r.Context(), "Playback progress updated", "recording_id", recordingID, "position_seconds", position)
 }
 
 // PlaybackAnalyticsHandler returns detailed playback analytics
@@ -388,8 +483,7 @@ func (h *PlaybackHandlers) PlaybackAnalyticsHandler(w http.ResponseWriter, r *ht
 		return
 	}
 
-	recordingIDStr := strings.TrimPrefix(r.URL.Path, "/api/v1/recordings/")
-	recordingIDStr = strings.TrimSuffix(recordingIDStr, "/analytics")
+	recordingIDStr := r.PathValue("id")
 
 	recordingID, err := uuid.Parse(recordingIDStr)
 	if err != nil {
@@ -425,16 +519,35 @@ func (h *PlaybackHandlers) PlaybackAnalyticsHandler(w http.ResponseWriter, r *ht
 		analytics.LastAccessedAt.Format(time.RFC3339),
 	)
 
-	h.logger.Printf("Analytics retrieved for recording: %s", recordingID)
+	h.logger.InfoContext(r.Context(), "Analytics retrieved", "recording_id", recordingID)
 }
 
 // RegisterPlaybackRoutes registers all playback-related routes
-func (h *PlaybackHandlers) RegisterPlaybackRoutes(mux *http.ServeMux) {
-	// Streaming endpoints - use specific patterns to avoid conflicts
-	mux.HandleFunc("/api/v1/recordings/{id}/stream/playlist.m3u8", h.StreamHLSPlaylistHandler)
-	mux.HandleFunc("/api/v1/recordings/{id}/stream/", h.StreamHLSSegmentHandler)
-	mux.HandleFunc("/api/v1/recordings/{id}/thumbnail", h.GetRecordingThumbnailHandler)
-	mux.HandleFunc("/api/v1/recordings/{id}/transcode", h.TranscodeRecordingHandler)
-	mux.HandleFunc("/api/v1/recordings/{id}/progress", h.PlaybackProgressHandler)
-	mux.HandleFunc("/api/v1/recordings/{id}/analytics", h.PlaybackAnalyticsHandler)
+func (h *PlaybackHandlers) RegisterPlaybackRoutes(rt *router.Router, am *auth.AuthMiddleware, authz *course.CourseAuthorizer) {
+	api := rt.With(am.Middleware)
+	member := authz.Require(authz.RecordingScope("id"), course.MemberRoles...)
+	manage := authz.Require(authz.RecordingScope("id"), course.ManageRoles...)
+
+	// With sharing the handlers check access themselves, so link holders
+	// without an account can stream
+	authn, check := router.Middleware(am.Middleware), []router.Middleware{member}
+	if h.sharing != nil {
+		authn, check = am.OptionalAuthMiddleware, nil
+	}
+	streamAuth := append([]router.Middleware{authn}, check...)
+
+	// With playback tokens a signed playlist URL needs no session, though
+	// access is still checked, and segments are served only with a valid
+	// token
+	if h.playbackSigner() != nil {
+		rt.HandleFunc("GET /api/v1/recordings/{id}/stream/playlist.m3u8", h.StreamHLSPlaylistHandler, h.playbackToken(authn, check...))
+		rt.HandleFunc("GET /api/v1/recordings/{id}/stream/{segment}", h.StreamHLSSegmentHandler, h.playbackToken(nil))
+	} else {
+		rt.With(streamAuth...).HandleFunc("GET /api/v1/recordings/{id}/stream/playlist.m3u8", h.StreamHLSPlaylistHandler)
+		rt.With(streamAuth...).HandleFunc("GET /api/v1/recordings/{id}/stream/{segment}", h.StreamHLSSegmentHandler)
+	}
+	api.HandleFunc("GET /api/v1/recordings/{id}/thumbnail", h.GetRecordingThumbnailHandler, member)
+	api.HandleFunc("POST /api/v1/recordings/{id}/transcode", h.TranscodeRecordingHandler, manage)
+	api.HandleFunc("POST /api/v1/recordings/{id}/progress", h.PlaybackProgressHandler, member)
+	api.HandleFunc("GET /api/v1/recordings/{id}/analytics", h.PlaybackAnalyticsHandler, manage)
 }
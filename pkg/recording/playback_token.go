@@ -0,0 +1,293 @@
+package recording
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/router"
+	"github.com/google/uuid"
+)
+
+// PlaybackTokenParam is the query parameter that carries a playback token
+const PlaybackTokenParam = "token"
+
+var (
+	ErrPlaybackTokenInvalid  = errors.New("playback token is invalid")
+	ErrPlaybackTokenExpired  = errors.New("playback token has expired")
+	ErrPlaybackTokenMismatch = errors.New("playback token is not valid for this request")
+	ErrNoPlaybackKeys        = errors.New("no playback signing keys configured")
+)
+
+// PlaybackKey is an HMAC key for playback tokens. The ID is embedded in each
+// token so a token is verified with the key that signed it.
+type PlaybackKey struct {
+	ID     string
+	Secret []byte
+}
+
+// PlaybackTokenConfig configures playback tokens
+type PlaybackTokenConfig struct {
+	// Keys verify tokens; the first one signs new tokens. To rotate, put the
+	// new key first and keep the old one until the tokens it signed expire.
+	Keys []PlaybackKey
+	// TTL is how long a playlist URL token is valid
+	TTL time.Duration
+	// SegmentTTL is how long the tokens of segment URIs are valid. Access is
+	// checked again whenever the playlist is loaded, so players reload it
+	// for fresh segment tokens.
+	SegmentTTL time.Duration
+	// BindIP binds tokens to the client address they were issued to
+	BindIP bool
+	// TrustProxyHeaders takes the client address from the last
+	// X-Forwarded-For entry. Enable it only behind a proxy that sets it.
+	TrustProxyHeaders bool
+}
+
+// DefaultPlaybackTokenConfig returns the default configuration without keys
+func DefaultPlaybackTokenConfig() PlaybackTokenConfig {
+	return PlaybackTokenConfig{
+		TTL:        4 * time.Hour,
+		SegmentTTL: 10 * time.Minute,
+		BindIP:     true,
+	}
+}
+
+// ParsePlaybackKeys parses keys in the form "id:secret,id:secret", newest
+// first
+func ParsePlaybackKeys(value string) ([]PlaybackKey, error) {
+	var keys []PlaybackKey
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || strings.Contains(id, ".") {
+			return nil, fmt.Errorf("invalid playback key %q: expected id:secret", entry)
+		}
+		if len(secret) < 32 {
+			return nil, fmt.Errorf("playback key %q must be at least 32 characters", id)
+		}
+		if seen[id] {
+			return nil, fmt.Errorf("duplicate playback key %q", id)
+		}
+		seen[id] = true
+		keys = append(keys, PlaybackKey{ID: id, Secret: []byte(secret)})
+	}
+	if len(keys) == 0 {
+		return nil, ErrNoPlaybackKeys
+	}
+	return keys, nil
+}
+
+// DerivePlaybackKey derives a playback key from another secret, so
+// deployments without dedicated keys do not sign playback tokens with the
+// secret itself
+func DerivePlaybackKey(id, secret string) PlaybackKey {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("vtp-playback-token"))
+	return PlaybackKey{ID: id, Secret: mac.Sum(nil)}
+}
+
+// PlaybackClaims is what a playback token grants
+type PlaybackClaims struct {
+	RecordingID uuid.UUID `json:"rid"`
+	UserID      string    `json:"uid,omitempty"`  // empty for link holders
+	Role        string    `json:"role,omitempty"` // global role of the user
+	ShareID     string    `json:"sid,omitempty"`  // share that granted access, if any
+	ExpiresAt   int64     `json:"exp"`
+	IP          string    `json:"ip,omitempty"`
+}
+
+type playbackClaimsKey struct{}
+
+// PlaybackClaimsFromContext returns the claims of a verified playback token
+func PlaybackClaimsFromContext(ctx context.Context) (*PlaybackClaims, bool) {
+	claims, ok := ctx.Value(playbackClaimsKey{}).(*PlaybackClaims)
+	return claims, ok
+}
+
+// PlaybackSigner issues and verifies playback tokens. Verification needs
+// only the keys, so segment requests are checked without the database.
+type PlaybackSigner struct {
+	cfg     PlaybackTokenConfig
+	current PlaybackKey
+	keys    map[string][]byte
+}
+
+// NewPlaybackSigner creates a signer. The first key signs new tokens.
+func NewPlaybackSigner(cfg PlaybackTokenConfig) (*PlaybackSigner, error) {
+	if len(cfg.Keys) == 0 {
+		return nil, ErrNoPlaybackKeys
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultPlaybackTokenConfig().TTL
+	}
+	if cfg.SegmentTTL <= 0 {
+		cfg.SegmentTTL = DefaultPlaybackTokenConfig().SegmentTTL
+	}
+	keys := make(map[string][]byte, len(cfg.Keys))
+	for _, key := range cfg.Keys {
+		if key.ID == "" || strings.Contains(key.ID, ".") || len(key.Secret) == 0 {
+			return nil, fmt.Errorf("invalid playback key %q", key.ID)
+		}
+		keys[key.ID] = key.Secret
+	}
+	return &PlaybackSigner{cfg: cfg, current: cfg.Keys[0], keys: keys}, nil
+}
+
+// Issue signs a playlist token for a recording, bound to the client
+// address when BindIP is set
+func (s *PlaybackSigner) Issue(recordingID uuid.UUID, userID, role, shareID, clientIP string, now time.Time) (string, time.Time, error) {
+	return s.issue(recordingID, userID, role, shareID, clientIP, now.Add(s.cfg.TTL))
+}
+
+// IssueSegment signs a token for the segment URIs of a playlist. It expires
+// after SegmentTTL.
+func (s *PlaybackSigner) IssueSegment(recordingID uuid.UUID, userID, role, shareID, clientIP string, now time.Time) (string, time.Time, error) {
+	return s.issue(recordingID, userID, role, shareID, clientIP, now.Add(s.cfg.SegmentTTL))
+}
+
+func (s *PlaybackSigner) issue(recordingID uuid.UUID, userID, role, shareID, clientIP string, expiresAt time.Time) (string, time.Time, error) {
+	claims := PlaybackClaims{
+		RecordingID: recordingID,
+		UserID:      userID,
+		ShareID:     shareID,
+		ExpiresAt:   expiresAt.Unix(),
+	}
+	if userID != "" {
+		claims.Role = role
+	}
+	if s.cfg.BindIP {
+		claims.IP = clientIP
+	}
+	token, err := s.Sign(claims)
+	return token, expiresAt, err
+}
+
+// Sign signs claims with the current key. Tokens have the form
+// keyID.payload.signature with a base64url JSON payload.
+func (s *PlaybackSigner) Sign(claims PlaybackClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode playback token: %w", err)
+	}
+	signed := s.current.ID + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign(s.current.Secret, signed)), nil
+}
+
+// Verify checks a token's signature and expiry and that it was issued for
+// the recording and, if bound, the request's client address
+func (s *PlaybackSigner) Verify(r *http.Request, token string, recordingID uuid.UUID, now time.Time) (*PlaybackClaims, error) {
+	keyID, rest, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrPlaybackTokenInvalid
+	}
+	payload, signature, ok := strings.Cut(rest, ".")
+	if !ok {
+		return nil, ErrPlaybackTokenInvalid
+	}
+	secret, ok := s.keys[keyID]
+	if !ok {
+		return nil, ErrPlaybackTokenInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, sign(secret, keyID+"."+payload)) {
+		return nil, ErrPlaybackTokenInvalid
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrPlaybackTokenInvalid
+	}
+	var claims PlaybackClaims
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return nil, ErrPlaybackTokenInvalid
+	}
+
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, ErrPlaybackTokenExpired
+	}
+	if claims.RecordingID != recordingID {
+		return nil, ErrPlaybackTokenMismatch
+	}
+	if claims.IP != "" && claims.IP != s.ClientIP(r) {
+		return nil, ErrPlaybackTokenMismatch
+	}
+	return &claims, nil
+}
+
+// RequirePlaybackToken verifies the playback token of a request for the
+// recording in the "id" path parameter. Requests without a token are
+// authenticated by authn, or rejected when it is nil. Requests with a valid
+// token act as the user it was issued to, and both go through check, so
+// access revoked since the token was issued is refused.
+func RequirePlaybackToken(signer *PlaybackSigner, logger *slog.Logger, authn router.Middleware, check ...router.Middleware) router.Middleware {
+	return func(next http.Handler) http.Handler {
+		checked := router.Chain(next, check...)
+		var authenticated http.Handler
+		if authn != nil {
+			authenticated = authn(checked)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.URL.Query().Get(PlaybackTokenParam)
+			if token == "" {
+				if authenticated == nil {
+					http.Error(w, "Playback token required", http.StatusUnauthorized)
+					return
+				}
+				authenticated.ServeHTTP(w, r)
+				return
+			}
+
+			recordingID, err := uuid.Parse(r.PathValue("id"))
+			if err != nil {
+				http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+				return
+			}
+			claims, err := signer.Verify(r, token, recordingID, time.Now())
+			if err != nil {
+				logger.DebugContext(r.Context(), "Playback token rejected", "recording_id", recordingID, "error", err)
+				http.Error(w, "Invalid or expired playback token", http.StatusForbidden)
+				return
+			}
+			ctx := context.WithValue(r.Context(), playbackClaimsKey{}, claims)
+			if claims.UserID != "" {
+				ctx = context.WithValue(ctx, "user_id", claims.UserID)
+				ctx = context.WithValue(ctx, "user_role", claims.Role)
+			}
+			checked.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClientIP returns the client address tokens are bound to
+func (s *PlaybackSigner) ClientIP(r *http.Request) string {
+	if s.cfg.TrustProxyHeaders {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			parts := strings.Split(forwarded, ",")
+			return strings.TrimSpace(parts[len(parts)-1])
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func sign(secret []byte, value string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,300 @@
+package recording
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func testPlaybackSigner(t *testing.T, cfg PlaybackTokenConfig) *PlaybackSigner {
+	t.Helper()
+	if len(cfg.Keys) == 0 {
+		cfg.Keys = []PlaybackKey{{ID: "k1", Secret: []byte("first-secret-first-secret-first!")}}
+	}
+	signer, err := NewPlaybackSigner(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+	return signer
+}
+
+// TestPlaybackTokenVerify tests issuing and verifying playback tokens
+func TestPlaybackTokenVerify(t *testing.T) {
+	signer := testPlaybackSigner(t, PlaybackTokenConfig{TTL: time.Hour})
+	recordingID := uuid.New()
+	now := time.Now()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	token, expiresAt, err := signer.Issue(recordingID, "user-1", "student", "", signer.ClientIP(r), now)
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+	if !expiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("Unexpected expiry %v", expiresAt)
+	}
+
+	claims, err := signer.Verify(r, token, recordingID, now)
+	if err != nil {
+		t.Fatalf("Valid token rejected: %v", err)
+	}
+	if claims.UserID != "user-1" || claims.RecordingID != recordingID || claims.IP != "" {
+		t.Errorf("Unexpected claims %+v", claims)
+	}
+
+	if _, err := signer.Verify(r, token, uuid.New(), now); !errors.Is(err, ErrPlaybackTokenMismatch) {
+		t.Errorf("Expected ErrPlaybackTokenMismatch for another recording, got %v", err)
+	}
+	if _, err := signer.Verify(r, token, recordingID, now.Add(time.Hour)); !errors.Is(err, ErrPlaybackTokenExpired) {
+		t.Errorf("Expected ErrPlaybackTokenExpired, got %v", err)
+	}
+
+	// Changing the payload breaks the signature
+	parts := strings.Split(token, ".")
+	tampered := parts[0] + "." + parts[1] + "x." + parts[2]
+	if _, err := signer.Verify(r, tampered, recordingID, now); !errors.Is(err, ErrPlaybackTokenInvalid) {
+		t.Errorf("Expected ErrPlaybackTokenInvalid for tampered token, got %v", err)
+	}
+	if _, err := signer.Verify(r, "garbage", recordingID, now); !errors.Is(err, ErrPlaybackTokenInvalid) {
+		t.Errorf("Expected ErrPlaybackTokenInvalid for garbage, got %v", err)
+	}
+
+	t.Log("✓ Playback tokens verified")
+}
+
+// TestPlaybackTokenBindIP tests tokens bound to the client address
+func TestPlaybackTokenBindIP(t *testing.T) {
+	signer := testPlaybackSigner(t, PlaybackTokenConfig{BindIP: true})
+	recordingID := uuid.New()
+	now := time.Now()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.10:5000"
+	token, _, err := signer.Issue(recordingID, "user-1", "student", "", signer.ClientIP(r), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.RemoteAddr = "192.0.2.10:6000"
+	if _, err := signer.Verify(r, token, recordingID, now); err != nil {
+		t.Errorf("Token rejected from the same address: %v", err)
+	}
+
+	r.RemoteAddr = "198.51.100.7:5000"
+	if _, err := signer.Verify(r, token, recordingID, now); !errors.Is(err, ErrPlaybackTokenMismatch) {
+		t.Errorf("Expected ErrPlaybackTokenMismatch from another address, got %v", err)
+	}
+
+	// Forwarded addresses are ignored unless proxy headers are trusted
+	r.Header.Set("X-Forwarded-For", "192.0.2.10")
+	if _, err := signer.Verify(r, token, recordingID, now); !errors.Is(err, ErrPlaybackTokenMismatch) {
+		t.Errorf("X-Forwarded-For bypassed the IP binding: %v", err)
+	}
+
+	t.Log("✓ Playback tokens bound to client address")
+}
+
+// TestPlaybackTokenKeyRotation tests that tokens signed with a previous key
+// stay valid while it is listed
+func TestPlaybackTokenKeyRotation(t *testing.T) {
+	oldKey := PlaybackKey{ID: "2026-09", Secret: []byte("old-secret-old-secret-old-secret")}
+	newKey := PlaybackKey{ID: "2026-10", Secret: []byte("new-secret-new-secret-new-secret")}
+	recordingID := uuid.New()
+	now := time.Now()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	before := testPlaybackSigner(t, PlaybackTokenConfig{Keys: []PlaybackKey{oldKey}})
+	oldToken, _, err := before.Issue(recordingID, "user-1", "student", "", "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := testPlaybackSigner(t, PlaybackTokenConfig{Keys: []PlaybackKey{newKey, oldKey}})
+	if _, err := rotated.Verify(r, oldToken, recordingID, now); err != nil {
+		t.Errorf("Token of the previous key rejected: %v", err)
+	}
+	newToken, _, err := rotated.Issue(recordingID, "user-1", "student", "", "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(newToken, newKey.ID+".") {
+		t.Errorf("New token not signed with the new key: %s", newToken)
+	}
+
+	retired := testPlaybackSigner(t, PlaybackTokenConfig{Keys: []PlaybackKey{newKey}})
+	if _, err := retired.Verify(r, oldToken, recordingID, now); !errors.Is(err, ErrPlaybackTokenInvalid) {
+		t.Errorf("Expected ErrPlaybackTokenInvalid after retiring the key, got %v", err)
+	}
+
+	t.Log("✓ Playback keys rotated")
+}
+
+// TestParsePlaybackKeys tests parsing the key configuration
+func TestParsePlaybackKeys(t *testing.T) {
+	keys, err := ParsePlaybackKeys("new:" + strings.Repeat("a", 32) + ", old:" + strings.Repeat("b", 32))
+	if err != nil {
+		t.Fatalf("Failed to parse keys: %v", err)
+	}
+	if len(keys) != 2 || keys[0].ID != "new" || keys[1].ID != "old" {
+		t.Errorf("Unexpected keys %+v", keys)
+	}
+
+	for _, value := range []string{"", "nosecret", "short:abc", "a.b:" + strings.Repeat("a", 32), "k:" + strings.Repeat("a", 32) + ",k:" + strings.Repeat("b", 32)} {
+		if _, err := ParsePlaybackKeys(value); err == nil {
+			t.Errorf("Expected error for %q", value)
+		}
+	}
+
+	t.Log("✓ Playback keys parsed")
+}
+
+// TestSegmentRequiresPlaybackToken tests that segments are served only with
+// a valid token, without looking up the recording
+func TestSegmentRequiresPlaybackToken(t *testing.T) {
+	dir := t.TempDir()
+	recordingID := uuid.New()
+	if err := os.MkdirAll(filepath.Join(dir, recordingID.String()), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, recordingID.String(), "segment-000.ts"), []byte("segment"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	signer := testPlaybackSigner(t, PlaybackTokenConfig{})
+	streaming := NewStreamingManager(nil, nil, nil, dir).WithPlaybackTokens(signer)
+	h := NewPlaybackHandlers(streaming, nil, nil)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/v1/recordings/{id}/stream/{segment}", h.playbackToken(nil)(http.HandlerFunc(h.StreamHLSSegmentHandler)))
+
+	token, _, err := signer.Issue(recordingID, "user-1", "student", "", "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherToken, _, err := signer.Issue(uuid.New(), "user-1", "student", "", "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"token of another recording", otherToken, http.StatusForbidden},
+		{"valid token", token, http.StatusOK},
+	}
+	for _, tt := range tests {
+		target := "/api/v1/recordings/" + recordingID.String() + "/stream/segment-000.ts"
+		if tt.token != "" {
+			target += "?" + url.Values{PlaybackTokenParam: {tt.token}}.Encode()
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, w.Code)
+		}
+	}
+
+	t.Log("✓ Segments require a playback token")
+}
+
+// TestPlaylistTokenChecksAccess tests that playlist requests with a token
+// act as the token's user and still go through the access check
+func TestPlaylistTokenChecksAccess(t *testing.T) {
+	signer := testPlaybackSigner(t, PlaybackTokenConfig{})
+	streaming := NewStreamingManager(nil, nil, nil, t.TempDir()).WithPlaybackTokens(signer)
+	h := NewPlaybackHandlers(streaming, nil, nil)
+	recordingID := uuid.New()
+
+	// The check stands in for the course membership check of the route
+	var checked []string
+	check := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := r.Context().Value("user_id").(string)
+			role, _ := r.Context().Value("user_role").(string)
+			checked = append(checked, userID+"/"+role)
+			if userID == "revoked-user" {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	served := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/v1/recordings/{id}/stream/playlist.m3u8", h.playbackToken(nil, check)(served))
+
+	token, _, err := signer.Issue(recordingID, "user-1", "teacher", "", "192.0.2.1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, _, err := signer.Issue(recordingID, "revoked-user", "student", "", "192.0.2.1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"valid token", token, http.StatusOK},
+		{"token of a user without access", revoked, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		target := "/api/v1/recordings/" + recordingID.String() + "/stream/playlist.m3u8?" + url.Values{PlaybackTokenParam: {tt.token}}.Encode()
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, w.Code)
+		}
+	}
+	if strings.Join(checked, ",") != "user-1/teacher,revoked-user/student" {
+		t.Errorf("Access check saw %v", checked)
+	}
+
+	t.Log("✓ Playlist tokens go through the access check")
+}
+
+// TestSegmentTokenTTL tests that segment tokens expire before playlist
+// tokens and are bound to the client address by default
+func TestSegmentTokenTTL(t *testing.T) {
+	cfg := DefaultPlaybackTokenConfig()
+	cfg.Keys = []PlaybackKey{{ID: "k1", Secret: []byte("first-secret-first-secret-first!")}}
+	signer := testPlaybackSigner(t, cfg)
+	recordingID := uuid.New()
+	now := time.Now()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	token, expiresAt, err := signer.IssueSegment(recordingID, "user-1", "student", "", signer.ClientIP(r), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expiresAt.Equal(now.Add(cfg.SegmentTTL)) || cfg.SegmentTTL >= cfg.TTL {
+		t.Errorf("Unexpected segment token expiry %v", expiresAt)
+	}
+	claims, err := signer.Verify(r, token, recordingID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.IP == "" {
+		t.Error("Segment token not bound to the client address by default")
+	}
+	if _, err := signer.Verify(r, token, recordingID, now.Add(cfg.SegmentTTL)); !errors.Is(err, ErrPlaybackTokenExpired) {
+		t.Errorf("Expected ErrPlaybackTokenExpired, got %v", err)
+	}
+
+	t.Log("✓ Segment tokens are short-lived")
+}
@@ -0,0 +1,908 @@
+package recording
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/mediasoup"
+)
+
+var (
+	ErrNoProducers         = errors.New("room has no producers to record")
+	ErrRTPSessionActive    = errors.New("recording is already receiving RTP")
+	ErrRTPSessionNotFound  = errors.New("recording is not receiving RTP")
+	ErrNoRTPPortsAvailable = errors.New("no free RTP ports")
+	ErrInvalidLayout       = errors.New("invalid recording layout")
+	ErrNotComposite        = errors.New("recording is not composited")
+)
+
+// RTPIngestConfig configures recording rooms by receiving their media from
+// the SFU over plain RTP
+type RTPIngestConfig struct {
+	OutputDir  string
+	FFmpegPath string
+	// ListenIP is the address FFmpeg receives on, as reached from the SFU
+	ListenIP string
+	// MinPort and MaxPort bound the UDP ports given to FFmpeg. Each stream
+	// uses an even RTP port and the odd port after it for RTCP.
+	MinPort int
+	MaxPort int
+	// ReadyTimeout bounds the wait for FFmpeg to open its ports before the
+	// SFU starts sending
+	ReadyTimeout time.Duration
+	// Resolution and FrameRate size the canvas of composite recordings
+	Resolution string
+	FrameRate  int
+	// MaxVideoInputs and MaxAudioInputs cap the streams of a composite
+	// recording, bounding the decoding work of one FFmpeg process
+	MaxVideoInputs int
+	MaxAudioInputs int
+	// SpeakerHold is how long a composite stays on a speaker before another
+	// active speaker takes focus, so short interjections do not flip the
+	// layout
+	SpeakerHold time.Duration
+}
+
+// DefaultRTPIngestConfig returns the default RTP ingest configuration
+func DefaultRTPIngestConfig() *RTPIngestConfig {
+	return &RTPIngestConfig{
+		OutputDir:      "/tmp/recordings",
+		ListenIP:       "127.0.0.1",
+		MinPort:        50000,
+		MaxPort:        50999,
+		ReadyTimeout:   5 * time.Second,
+		Resolution:     "1280x720",
+		FrameRate:      30,
+		MaxVideoInputs: 6,
+		MaxAudioInputs: 12,
+		SpeakerHold:    3 * time.Second,
+	}
+}
+
+// RTPRecordOptions selects what to record and how
+type RTPRecordOptions struct {
+	// UserID records only this user's producers. When empty the first
+	// video and audio producers in the room are recorded.
+	UserID      string
+	Format      string // webm (default) or mp4
+	BitrateKbps int    // video bitrate when transcoding
+	// Layout composites the room's participants, starting with this
+	// layout. When empty a single video and audio stream is recorded.
+	Layout string
+}
+
+// RTPStream is one producer's media received on a plain transport
+type RTPStream struct {
+	Kind        string                       `json:"kind"`
+	ProducerID  string                       `json:"producer_id"`
+	UserID      string                       `json:"user_id"`
+	TransportID string                       `json:"transport_id"`
+	ConsumerID  string                       `json:"consumer_id"`
+	Port        int                          `json:"port"`
+	RTCPPort    int                          `json:"rtcp_port"`
+	Codec       mediasoup.RtpCodecParameters `json:"codec"`
+	SSRC        int                          `json:"ssrc"`
+	CNAME       string                       `json:"cname,omitempty"`
+	Source      string                       `json:"source,omitempty"` // camera, screen or mic
+	Name        string                       `json:"name,omitempty"`
+	Role        string                       `json:"role,omitempty"`
+}
+
+// RTPSession is a room recording fed by the SFU
+type RTPSession struct {
+	RecordingID string      `json:"recording_id"`
+	RoomID      string      `json:"room_id"`
+	SDPPath     string      `json:"sdp_path"`
+	OutputPath  string      `json:"output_path"`
+	Streams     []RTPStream `json:"streams"`
+	StartedAt   time.Time   `json:"started_at"`
+	// Layout is the initial layout of a composite recording
+	Layout string `json:"layout,omitempty"`
+
+	// Composite state, guarded by mu. process is set once FFmpeg runs and
+	// cleared when the session stops.
+	mu             sync.Mutex
+	process        *FFmpegProcess
+	width, height  int
+	inputs         []layoutInput
+	state          layoutState
+	placement      map[int]Rect
+	speakerAt      time.Time
+	pendingSpeaker string
+	speakerTimer   *time.Timer
+	changes        []LayoutChange
+}
+
+// LayoutChanges returns the layout changes of a composite recording so far
+func (s *RTPSession) LayoutChanges() []LayoutChange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]LayoutChange(nil), s.changes...)
+}
+
+// RTPRecorder records rooms by asking the SFU for plain RTP transports and
+// consumers for the room's producers, and letting FFmpeg ingest the streams
+// described by a generated SDP file. The FFmpeg processes are tracked in the
+// process registry so they are finalized with their recording.
+type RTPRecorder struct {
+	sfu       *mediasoup.Client
+	processes *ProcessRegistry
+	config    *RTPIngestConfig
+	logger    *slog.Logger
+
+	mu       sync.Mutex
+	sessions map[string]*RTPSession
+	ports    map[int]bool
+}
+
+// NewRTPRecorder creates a new RTP recorder
+func NewRTPRecorder(sfu *mediasoup.Client, processes *ProcessRegistry, config *RTPIngestConfig, logger *slog.Logger) *RTPRecorder {
+	if config == nil {
+		config = DefaultRTPIngestConfig()
+	}
+	if logger == nil {
+		logger = slog.Default().With("component", "rtp_recorder")
+	}
+	if processes == nil {
+		processes = NewProcessRegistry(logger)
+	}
+	return &RTPRecorder{
+		sfu:       sfu,
+		processes: processes,
+		config:    config,
+		logger:    logger,
+		sessions:  make(map[string]*RTPSession),
+		ports:     make(map[int]bool),
+	}
+}
+
+// Start begins recording a room. The context bounds the setup only; the
+// FFmpeg process runs until Stop is called or the registry is stopped.
+func (r *RTPRecorder) Start(ctx context.Context, recordingID, roomID string, opts RTPRecordOptions) (*RTPSession, error) {
+	if opts.Format != "mp4" {
+		opts.Format = "webm"
+	}
+	if opts.Layout != "" && !ValidateLayout(opts.Layout) {
+		return nil, ErrInvalidLayout
+	}
+
+	session := &RTPSession{
+		RecordingID: recordingID,
+		RoomID:      roomID,
+		SDPPath:     filepath.Join(r.config.OutputDir, recordingID+".sdp"),
+		Layout:      opts.Layout,
+	}
+
+	// Reserve the recording so concurrent starts do not both set up streams
+	r.mu.Lock()
+	if _, exists := r.sessions[recordingID]; exists {
+		r.mu.Unlock()
+		return nil, ErrRTPSessionActive
+	}
+	r.sessions[recordingID] = session
+	r.mu.Unlock()
+
+	fp, err := r.start(ctx, session, opts)
+	if err != nil {
+		r.release(session)
+		r.mu.Lock()
+		delete(r.sessions, recordingID)
+		r.mu.Unlock()
+		return nil, err
+	}
+
+	r.processes.Add(fp)
+	r.logger.InfoContext(ctx, "Recording receiving RTP", "recording_id", recordingID, "room_id", roomID, "streams", len(session.Streams))
+	return session, nil
+}
+
+func (r *RTPRecorder) start(ctx context.Context, session *RTPSession, opts RTPRecordOptions) (*FFmpegProcess, error) {
+	producers, err := r.sfu.GetProducers(session.RoomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list producers: %w", err)
+	}
+
+	var selected []mediasoup.ProducerInfo
+	if opts.Layout != "" {
+		selected = selectCompositeProducers(producers, r.config.MaxVideoInputs, r.config.MaxAudioInputs)
+	} else {
+		selected = selectProducers(producers, opts.UserID)
+	}
+	if len(selected) == 0 {
+		return nil, ErrNoProducers
+	}
+
+	for _, producer := range selected {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		stream, err := r.openStream(session.RoomID, producer)
+		if stream != nil {
+			session.Streams = append(session.Streams, *stream)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.MkdirAll(r.config.OutputDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	sdp := GenerateSDP(session.RecordingID, r.config.ListenIP, session.Streams)
+	if err := os.WriteFile(session.SDPPath, []byte(sdp), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write SDP file: %w", err)
+	}
+
+	ffmpegConfig := &FFmpegConfig{
+		OutputDir:   r.config.OutputDir,
+		BitrateKbps: opts.BitrateKbps,
+		Format:      opts.Format,
+		FFmpegPath:  r.config.FFmpegPath,
+	}
+	fp := NewFFmpegProcess(session.RecordingID, ffmpegConfig, r.logger)
+	session.OutputPath = fp.GetOutputPath()
+
+	var args []string
+	if session.Layout != "" {
+		session.width, session.height = parseResolution(r.config.Resolution)
+		session.inputs = compositeInputs(session.Streams)
+		session.state = layoutState{Layout: session.Layout, Pinned: !followsEvents(session.Layout)}
+		_, _, session.placement = resolveLayout(session.state, session.width, session.height, session.inputs)
+		fps := r.config.FrameRate
+		if fps <= 0 {
+			fps = DefaultFFmpegConfig().FrameRate
+		}
+		graph := compositeFilterGraph(session.Streams, session.width, session.height, fps, session.placement)
+		args = rtpCompositeArgs(session.SDPPath, session.OutputPath, graph, session.Streams, ffmpegConfig)
+	} else {
+		args = rtpIngestArgs(session.SDPPath, session.OutputPath, session.Streams, ffmpegConfig)
+	}
+
+	// The process outlives the request that started it
+	if err := fp.StartRTP(context.Background(), args, ffmpegConfig); err != nil {
+		return nil, err
+	}
+	session.StartedAt = time.Now()
+
+	// Packets sent before FFmpeg binds its ports are lost, including the
+	// key frame requested on resume
+	r.waitForListeners(session.Streams)
+
+	for _, stream := range session.Streams {
+		if err := r.sfu.ResumePlainConsumer(session.RoomID, stream.TransportID, stream.ConsumerID); err != nil {
+			fp.Cleanup()
+			return nil, fmt.Errorf("failed to resume %s consumer: %w", stream.Kind, err)
+		}
+	}
+
+	if session.Layout != "" {
+		session.mu.Lock()
+		session.process = fp
+		r.applyLayout(session, session.StartedAt, LayoutReasonStart)
+		session.mu.Unlock()
+	}
+
+	return fp, nil
+}
+
+// openStream creates a plain transport for a producer, points it at a pair
+// of free local ports and consumes the producer on it. A partially opened
+// stream is returned with the error so it can be released.
+func (r *RTPRecorder) openStream(roomID string, producer mediasoup.ProducerInfo) (*RTPStream, error) {
+	port, err := r.allocatePorts()
+	if err != nil {
+		return nil, err
+	}
+	stream := &RTPStream{
+		Kind:       producer.Kind,
+		ProducerID: producer.ID,
+		UserID:     producer.UserID,
+		Source:     producer.Source,
+		Name:       producer.FullName,
+		Role:       producer.Role,
+		Port:       port,
+		RTCPPort:   port + 1,
+	}
+
+	transport, err := r.sfu.CreatePlainTransport(roomID)
+	if err != nil {
+		return stream, fmt.Errorf("failed to create plain transport: %w", err)
+	}
+	stream.TransportID = transport.TransportID
+
+	err = r.sfu.ConnectPlainTransport(roomID, transport.TransportID, &mediasoup.PlainTransportConnectRequest{
+		IP:       r.config.ListenIP,
+		Port:     stream.Port,
+		RTCPPort: stream.RTCPPort,
+	})
+	if err != nil {
+		return stream, fmt.Errorf("failed to connect plain transport: %w", err)
+	}
+
+	consumer, err := r.sfu.ConsumePlain(roomID, transport.TransportID, producer.ID)
+	if err != nil {
+		return stream, fmt.Errorf("failed to consume %s producer: %w", producer.Kind, err)
+	}
+	stream.ConsumerID = consumer.ID
+
+	codec, ok := mediaCodec(consumer.RtpParameters)
+	if !ok {
+		return stream, fmt.Errorf("consumer %s has no media codec", consumer.ID)
+	}
+	stream.Codec = codec
+	if len(consumer.RtpParameters.Encodings) > 0 {
+		stream.SSRC = consumer.RtpParameters.Encodings[0].SSRC
+	}
+	stream.CNAME = consumer.RtpParameters.RTCP.CNAME
+
+	return stream, nil
+}
+
+// Stop stops FFmpeg for a recording, waiting for it to write the trailer
+// until ctx is done, and closes the SFU transports
+func (r *RTPRecorder) Stop(ctx context.Context, recordingID string) (*RTPSession, error) {
+	r.mu.Lock()
+	session, ok := r.sessions[recordingID]
+	delete(r.sessions, recordingID)
+	r.mu.Unlock()
+	if !ok {
+		return nil, ErrRTPSessionNotFound
+	}
+
+	session.mu.Lock()
+	session.process = nil
+	if session.speakerTimer != nil {
+		session.speakerTimer.Stop()
+	}
+	session.mu.Unlock()
+
+	var err error
+	if fp, ok := r.processes.Remove(recordingID); ok && fp.IsRunning() {
+		err = fp.StopFFmpeg(ctx)
+	}
+	r.release(session)
+
+	r.logger.InfoContext(ctx, "Recording stopped receiving RTP", "recording_id", recordingID)
+	return session, err
+}
+
+// Session returns the RTP session of a recording
+func (r *RTPRecorder) Session(recordingID string) (*RTPSession, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	session, ok := r.sessions[recordingID]
+	return session, ok
+}
+
+// HandleRoomEvent updates the composite recordings of a room for an
+// active-speaker or screen-share event from the signalling server
+func (r *RTPRecorder) HandleRoomEvent(roomID string, event LayoutEvent) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	r.mu.Lock()
+	var sessions []*RTPSession
+	for _, session := range r.sessions {
+		if session.RoomID == roomID && session.Layout != "" {
+			sessions = append(sessions, session)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, session := range sessions {
+		session.mu.Lock()
+		if session.process != nil && r.updateLayoutState(session, event) {
+			r.applyLayout(session, event.At, event.Type)
+		}
+		session.mu.Unlock()
+	}
+}
+
+// SetLayout switches a composite recording to a layout chosen by the host.
+// Grid and side-by-side stay until the host changes them again; speaker
+// focus and screen PiP go on following the room's events.
+func (r *RTPRecorder) SetLayout(recordingID, layout string) error {
+	if !ValidateLayout(layout) {
+		return ErrInvalidLayout
+	}
+	session, ok := r.Session(recordingID)
+	if !ok {
+		return ErrRTPSessionNotFound
+	}
+	if session.Layout == "" {
+		return ErrNotComposite
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.process == nil {
+		return ErrRTPSessionNotFound
+	}
+	session.state.Layout = layout
+	session.state.Pinned = !followsEvents(layout)
+	r.applyLayout(session, time.Now(), LayoutReasonManual)
+	return nil
+}
+
+// updateLayoutState applies a room event to the session's layout state and
+// reports whether it changed. A new active speaker within SpeakerHold of the
+// last switch is held back and takes focus when the hold ends, unless
+// someone else speaks first. The caller holds session.mu.
+func (r *RTPRecorder) updateLayoutState(session *RTPSession, event LayoutEvent) bool {
+	state := &session.state
+	switch event.Type {
+	case LayoutEventActiveSpeaker:
+		if event.UserID == "" {
+			return false
+		}
+		if event.UserID == state.Speaker {
+			session.pendingSpeaker = ""
+			return false
+		}
+		wait := r.config.SpeakerHold - event.At.Sub(session.speakerAt)
+		if !session.speakerAt.IsZero() && wait > 0 {
+			session.pendingSpeaker = event.UserID
+			if session.speakerTimer == nil {
+				at := session.speakerAt.Add(r.config.SpeakerHold)
+				session.speakerTimer = time.AfterFunc(wait, func() {
+					r.promotePendingSpeaker(session, at)
+				})
+			}
+			return false
+		}
+		state.Speaker = event.UserID
+		session.speakerAt = event.At
+		session.pendingSpeaker = ""
+
+	case LayoutEventScreenShare:
+		if event.Active {
+			if state.Presenter == event.UserID {
+				return false
+			}
+			state.Presenter = event.UserID
+			if !state.Pinned {
+				state.Layout = LayoutScreenPiP
+			}
+		} else {
+			if state.Presenter != event.UserID {
+				return false
+			}
+			state.Presenter = ""
+			if !state.Pinned {
+				state.Layout = LayoutSpeakerFocus
+			}
+		}
+
+	default:
+		return false
+	}
+	return true
+}
+
+// promotePendingSpeaker gives focus to the speaker held back by SpeakerHold
+func (r *RTPRecorder) promotePendingSpeaker(session *RTPSession, at time.Time) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	session.speakerTimer = nil
+	if session.process == nil || session.pendingSpeaker == "" {
+		return
+	}
+	session.state.Speaker = session.pendingSpeaker
+	session.speakerAt = at
+	session.pendingSpeaker = ""
+	r.applyLayout(session, at, LayoutEventActiveSpeaker)
+}
+
+// applyLayout moves the composite's inputs to match its layout state and
+// records a layout change when the layout shown or the user in focus
+// changes. The caller holds session.mu.
+func (r *RTPRecorder) applyLayout(session *RTPSession, at time.Time, reason string) {
+	layout, focus, placement := resolveLayout(session.state, session.width, session.height, session.inputs)
+
+	for _, cmd := range layoutCommands(session.placement, placement, len(session.inputs), session.width) {
+		if err := session.process.SendCommand(cmd.Target, cmd.Command, cmd.Arg); err != nil {
+			r.logger.Error("Failed to switch layout", "recording_id", session.RecordingID, "error", err)
+			break
+		}
+	}
+	session.placement = placement
+
+	if n := len(session.changes); n > 0 && session.changes[n-1].Layout == layout && session.changes[n-1].UserID == focus {
+		return
+	}
+	offset := at.Sub(session.StartedAt).Seconds()
+	if offset < 0 || reason == LayoutReasonStart {
+		offset = 0
+	}
+	session.changes = append(session.changes, LayoutChange{
+		OffsetSeconds: offset,
+		At:            at,
+		Layout:        layout,
+		UserID:        focus,
+		Title:         layoutTitle(layout, focus, session.inputs),
+		Reason:        reason,
+	})
+}
+
+// release closes the session's transports, frees its ports and removes the
+// SDP file
+func (r *RTPRecorder) release(session *RTPSession) {
+	for _, stream := range session.Streams {
+		if stream.TransportID == "" {
+			continue
+		}
+		if err := r.sfu.ClosePlainTransport(session.RoomID, stream.TransportID); err != nil {
+			r.logger.Error("Failed to close plain transport", "recording_id", session.RecordingID, "transport_id", stream.TransportID, "error", err)
+		}
+	}
+
+	r.mu.Lock()
+	for _, stream := range session.Streams {
+		delete(r.ports, stream.Port)
+	}
+	r.mu.Unlock()
+
+	os.Remove(session.SDPPath)
+}
+
+// allocatePorts reserves an even RTP port whose RTCP port is also free
+func (r *RTPRecorder) allocatePorts() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	start := r.config.MinPort + r.config.MinPort%2
+	for port := start; port+1 <= r.config.MaxPort; port += 2 {
+		if r.ports[port] || !udpPortFree(port) || !udpPortFree(port+1) {
+			continue
+		}
+		r.ports[port] = true
+		return port, nil
+	}
+	return 0, ErrNoRTPPortsAvailable
+}
+
+// waitForListeners waits until FFmpeg has bound the RTP ports. A port that
+// can no longer be bound is taken by FFmpeg.
+func (r *RTPRecorder) waitForListeners(streams []RTPStream) {
+	deadline := time.Now().Add(r.config.ReadyTimeout)
+	for _, stream := range streams {
+		for udpPortFree(stream.Port) {
+			if time.Now().After(deadline) {
+				r.logger.Warn("FFmpeg has not opened port, starting the streams anyway", "port", stream.Port)
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+}
+
+func udpPortFree(port int) bool {
+	conn, err := net.ListenPacket("udp", net.JoinHostPort("", strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// selectProducers picks one video and one audio producer, preferring the
+// oldest, optionally limited to one user
+func selectProducers(producers []mediasoup.ProducerInfo, userID string) []mediasoup.ProducerInfo {
+	sorted := append([]mediasoup.ProducerInfo(nil), producers...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt < sorted[j].CreatedAt
+	})
+
+	var video, audio *mediasoup.ProducerInfo
+	for i := range sorted {
+		p := &sorted[i]
+		if userID != "" && p.UserID != userID {
+			continue
+		}
+		switch {
+		case p.Kind == "video" && video == nil:
+			video = p
+		case p.Kind == "audio" && audio == nil:
+			audio = p
+		}
+	}
+
+	var selected []mediasoup.ProducerInfo
+	if video != nil {
+		selected = append(selected, *video)
+	}
+	if audio != nil {
+		selected = append(selected, *audio)
+	}
+	return selected
+}
+
+// selectCompositeProducers picks the producers of a composite recording:
+// screen shares first so cameras are drawn over them, then teachers'
+// cameras, then the other cameras by age, and every microphone, up to the
+// given limits
+func selectCompositeProducers(producers []mediasoup.ProducerInfo, maxVideo, maxAudio int) []mediasoup.ProducerInfo {
+	rank := func(p mediasoup.ProducerInfo) int {
+		switch {
+		case p.Kind != "video":
+			return 3
+		case p.Source == "screen":
+			return 0
+		case p.Role == "teacher":
+			return 1
+		default:
+			return 2
+		}
+	}
+
+	sorted := append([]mediasoup.ProducerInfo(nil), producers...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if ri, rj := rank(sorted[i]), rank(sorted[j]); ri != rj {
+			return ri < rj
+		}
+		return sorted[i].CreatedAt < sorted[j].CreatedAt
+	})
+
+	var selected []mediasoup.ProducerInfo
+	var video, audio int
+	for _, p := range sorted {
+		switch {
+		case p.Kind == "video" && (maxVideo <= 0 || video < maxVideo):
+			video++
+		case p.Kind == "audio" && (maxAudio <= 0 || audio < maxAudio):
+			audio++
+		default:
+			continue
+		}
+		selected = append(selected, p)
+	}
+	return selected
+}
+
+// compositeInputs describes the video streams of a composite in the order
+// of the filter graph's inputs
+func compositeInputs(streams []RTPStream) []layoutInput {
+	var inputs []layoutInput
+	for _, stream := range streams {
+		if stream.Kind != "video" {
+			continue
+		}
+		inputs = append(inputs, layoutInput{
+			UserID:  stream.UserID,
+			Name:    stream.Name,
+			Screen:  stream.Source == "screen",
+			Teacher: stream.Role == "teacher",
+		})
+	}
+	return inputs
+}
+
+// followsEvents reports whether a layout is switched by room events
+func followsEvents(layout string) bool {
+	return layout == LayoutSpeakerFocus || layout == LayoutScreenPiP
+}
+
+// parseResolution parses a WIDTHxHEIGHT canvas size, falling back to 720p
+func parseResolution(resolution string) (int, int) {
+	var width, height int
+	if _, err := fmt.Sscanf(resolution, "%dx%d", &width, &height); err != nil || width <= 0 || height <= 0 {
+		return 1280, 720
+	}
+	// Even sizes keep the split regions valid for yuv420p
+	return width &^ 1, height &^ 1
+}
+
+// mediaCodec returns the codec carrying the media, skipping RTX and FEC
+func mediaCodec(params mediasoup.RtpParameters) (mediasoup.RtpCodecParameters, bool) {
+	for _, codec := range params.Codecs {
+		switch strings.ToLower(codecName(codec)) {
+		case "rtx", "red", "ulpfec", "flexfec-03":
+			continue
+		}
+		return codec, true
+	}
+	return mediasoup.RtpCodecParameters{}, false
+}
+
+// codecName returns the codec part of a MIME type, e.g. VP8 for video/VP8
+func codecName(codec mediasoup.RtpCodecParameters) string {
+	if i := strings.IndexByte(codec.MimeType, '/'); i >= 0 {
+		return codec.MimeType[i+1:]
+	}
+	return codec.MimeType
+}
+
+// GenerateSDP describes the streams FFmpeg receives on listenIP. RTCP is
+// announced on its own port so FFmpeg gets the sender reports it uses to
+// align audio and video.
+func GenerateSDP(recordingID, listenIP string, streams []RTPStream) string {
+	addrType := "IP4"
+	if strings.Contains(listenIP, ":") {
+		addrType = "IP6"
+	}
+
+	var b strings.Builder
+	b.WriteString("v=0\r\n")
+	fmt.Fprintf(&b, "o=- 0 0 IN %s %s\r\n", addrType, listenIP)
+	fmt.Fprintf(&b, "s=VTP recording %s\r\n", recordingID)
+	fmt.Fprintf(&b, "c=IN %s %s\r\n", addrType, listenIP)
+	b.WriteString("t=0 0\r\n")
+
+	for _, stream := range streams {
+		codec := stream.Codec
+		fmt.Fprintf(&b, "m=%s %d RTP/AVP %d\r\n", stream.Kind, stream.Port, codec.PayloadType)
+		fmt.Fprintf(&b, "a=rtcp:%d\r\n", stream.RTCPPort)
+
+		rtpmap := fmt.Sprintf("%s/%d", codecName(codec), codec.ClockRate)
+		if codec.Channels > 1 {
+			rtpmap += fmt.Sprintf("/%d", codec.Channels)
+		}
+		fmt.Fprintf(&b, "a=rtpmap:%d %s\r\n", codec.PayloadType, rtpmap)
+
+		if fmtp := formatParameters(codec.Parameters); fmtp != "" {
+			fmt.Fprintf(&b, "a=fmtp:%d %s\r\n", codec.PayloadType, fmtp)
+		}
+		if stream.SSRC != 0 && stream.CNAME != "" {
+			fmt.Fprintf(&b, "a=ssrc:%d cname:%s\r\n", uint32(stream.SSRC), stream.CNAME)
+		}
+		b.WriteString("a=recvonly\r\n")
+	}
+
+	return b.String()
+}
+
+// formatParameters renders codec parameters as an fmtp value with the keys
+// in a stable order
+func formatParameters(params map[string]interface{}) string {
+	if len(params) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, params[k]))
+	}
+	return strings.Join(parts, ";")
+}
+
+// rtpInputArgs are the FFmpeg arguments reading the streams of an SDP file
+func rtpInputArgs(sdpPath string) []string {
+	return []string{
+		"-hide_banner",
+		"-protocol_whitelist", "file,udp,rtp",
+		"-fflags", "+genpts",
+		"-reorder_queue_size", "1024",
+		"-analyzeduration", "5000000",
+		"-i", sdpPath,
+	}
+}
+
+// rtpIngestArgs builds the FFmpeg arguments for an RTP recording. Streams
+// whose codec fits the container are copied, so VP8/Opus into WebM is not
+// re-encoded. Timestamps come from RTP, with the streams aligned through
+// RTCP, so no wall-clock timestamps are used.
+func rtpIngestArgs(sdpPath, outputPath string, streams []RTPStream, config *FFmpegConfig) []string {
+	args := append(rtpInputArgs(sdpPath),
+		"-map", "0:v?",
+		"-map", "0:a?",
+	)
+
+	bitrate := config.BitrateKbps
+	if bitrate <= 0 {
+		bitrate = DefaultFFmpegConfig().BitrateKbps
+	}
+
+	var videoCodec, audioCodec string
+	for _, stream := range streams {
+		name := strings.ToLower(codecName(stream.Codec))
+		switch stream.Kind {
+		case "video":
+			videoCodec = name
+		case "audio":
+			audioCodec = name
+		}
+	}
+
+	format := config.Format
+	switch format {
+	case "mp4":
+		if videoCodec == "h264" {
+			args = append(args, "-c:v", "copy")
+		} else {
+			args = append(args,
+				"-c:v", "libx264",
+				"-preset", "veryfast",
+				"-b:v", fmt.Sprintf("%dk", bitrate),
+				"-pix_fmt", "yuv420p",
+			)
+		}
+		args = append(args,
+			"-c:a", "aac",
+			"-b:a", "128k",
+			// Fill gaps in the audio so it stays on the video timeline
+			"-af", "aresample=async=1",
+			"-movflags", "+faststart",
+		)
+	default:
+		format = "webm"
+		if videoCodec == "vp8" {
+			args = append(args, "-c:v", "copy")
+		} else {
+			args = append(args, "-c:v", "libvpx", "-b:v", fmt.Sprintf("%dk", bitrate))
+		}
+		if audioCodec == "opus" {
+			args = append(args, "-c:a", "copy")
+		} else {
+			args = append(args, "-c:a", "libopus", "-b:a", "128k")
+		}
+	}
+
+	return append(args, "-f", format, "-y", outputPath)
+}
+
+// rtpCompositeArgs builds the FFmpeg arguments for a composite recording
+// drawn by a filter graph from compositeFilterGraph. The composite is always
+// encoded, with settings that keep up in real time.
+func rtpCompositeArgs(sdpPath, outputPath, graph string, streams []RTPStream, config *FFmpegConfig) []string {
+	args := append(rtpInputArgs(sdpPath), "-filter_complex", graph)
+
+	var hasVideo, hasAudio bool
+	for _, stream := range streams {
+		hasVideo = hasVideo || stream.Kind == "video"
+		hasAudio = hasAudio || stream.Kind == "audio"
+	}
+	if hasVideo {
+		args = append(args, "-map", "[vout]")
+	}
+	if hasAudio {
+		args = append(args, "-map", "[aout]")
+	}
+
+	bitrate := config.BitrateKbps
+	if bitrate <= 0 {
+		bitrate = DefaultFFmpegConfig().BitrateKbps
+	}
+
+	format := config.Format
+	switch format {
+	case "mp4":
+		args = append(args,
+			"-c:v", "libx264",
+			"-preset", "veryfast",
+			"-b:v", fmt.Sprintf("%dk", bitrate),
+			"-pix_fmt", "yuv420p",
+			"-c:a", "aac",
+			"-b:a", "128k",
+			"-movflags", "+faststart",
+		)
+	default:
+		format = "webm"
+		args = append(args,
+			"-c:v", "libvpx",
+			"-deadline", "realtime",
+			"-cpu-used", "8",
+			"-b:v", fmt.Sprintf("%dk", bitrate),
+			"-c:a", "libopus",
+			"-b:a", "128k",
+		)
+	}
+
+	return append(args, "-f", format, "-y", outputPath)
+}
@@ -0,0 +1,361 @@
+package recording
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/mediasoup"
+)
+
+// fakeSFU serves the plain transport endpoints of the mediasoup SFU
+type fakeSFU struct {
+	mu        sync.Mutex
+	next      int
+	connects  map[string]mediasoup.PlainTransportConnectRequest
+	consumers map[string]string // consumerID -> transportID
+	resumed   map[string]bool
+	closed    map[string]bool
+}
+
+func newFakeSFU(t *testing.T) (*fakeSFU, *httptest.Server) {
+	f := &fakeSFU{
+		connects:  make(map[string]mediasoup.PlainTransportConnectRequest),
+		consumers: make(map[string]string),
+		resumed:   make(map[string]bool),
+		closed:    make(map[string]bool),
+	}
+
+	codecs := map[string]mediasoup.RtpParameters{
+		"video": {
+			Codecs: []mediasoup.RtpCodecParameters{
+				{MimeType: "video/VP8", PayloadType: 101, ClockRate: 90000},
+				{MimeType: "video/rtx", PayloadType: 102, ClockRate: 90000, Parameters: map[string]interface{}{"apt": 101}},
+			},
+			Encodings: []mediasoup.RtpEncodingParameters{{SSRC: 1111}},
+			RTCP:      mediasoup.RTCP{CNAME: "teacher"},
+		},
+		"audio": {
+			Codecs: []mediasoup.RtpCodecParameters{
+				{MimeType: "audio/opus", PayloadType: 100, ClockRate: 48000, Channels: 2},
+			},
+			Encodings: []mediasoup.RtpEncodingParameters{{SSRC: 2222}},
+			RTCP:      mediasoup.RTCP{CNAME: "teacher"},
+		},
+	}
+
+	writeJSON := func(w http.ResponseWriter, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rooms/{room}/producers", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, mediasoup.ProducersList{
+			RoomID: r.PathValue("room"),
+			Producers: []mediasoup.ProducerInfo{
+				{ID: "student-video", UserID: "student", FullName: "Sara Student", Role: "student", Kind: "video", Source: "camera", CreatedAt: 1},
+				{ID: "teacher-video", UserID: "teacher", FullName: "Tariq Teacher", Role: "teacher", Kind: "video", Source: "camera", CreatedAt: 2},
+				{ID: "teacher-audio", UserID: "teacher", FullName: "Tariq Teacher", Role: "teacher", Kind: "audio", Source: "mic", CreatedAt: 3},
+				{ID: "teacher-screen-video", UserID: "teacher", FullName: "Tariq Teacher", Role: "teacher", Kind: "video", Source: "screen", CreatedAt: 4},
+				{ID: "student-audio", UserID: "student", FullName: "Sara Student", Role: "student", Kind: "audio", Source: "mic", CreatedAt: 5},
+			},
+		})
+	})
+	mux.HandleFunc("POST /rooms/{room}/plain-transports", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.next++
+		n := f.next
+		f.mu.Unlock()
+		writeJSON(w, mediasoup.PlainTransport{TransportID: fmt.Sprintf("transport-%d", n), IP: "127.0.0.1", Port: 40000 + 2*n, RTCPPort: 40001 + 2*n})
+	})
+	mux.HandleFunc("POST /rooms/{room}/plain-transports/{transport}/connect", func(w http.ResponseWriter, r *http.Request) {
+		var req mediasoup.PlainTransportConnectRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		f.mu.Lock()
+		f.connects[r.PathValue("transport")] = req
+		f.mu.Unlock()
+		writeJSON(w, map[string]bool{"success": true})
+	})
+	mux.HandleFunc("POST /rooms/{room}/plain-transports/{transport}/consumers", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ProducerID string `json:"producerId"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		kind := "audio"
+		if strings.HasSuffix(req.ProducerID, "video") {
+			kind = "video"
+		}
+		id := "consumer-" + req.ProducerID
+		f.mu.Lock()
+		f.consumers[id] = r.PathValue("transport")
+		f.mu.Unlock()
+		writeJSON(w, mediasoup.PlainConsumer{ID: id, ProducerID: req.ProducerID, Kind: kind, RtpParameters: codecs[kind]})
+	})
+	mux.HandleFunc("POST /rooms/{room}/plain-transports/{transport}/consumers/{consumer}/resume", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.consumers[r.PathValue("consumer")] != r.PathValue("transport") {
+			http.Error(w, `{"error":"Consumer not found"}`, http.StatusNotFound)
+			return
+		}
+		f.resumed[r.PathValue("consumer")] = true
+		writeJSON(w, map[string]bool{"success": true})
+	})
+	mux.HandleFunc("POST /rooms/{room}/plain-transports/{transport}/close", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.closed[r.PathValue("transport")] = true
+		f.mu.Unlock()
+		writeJSON(w, map[string]bool{"success": true})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+// TestGenerateSDP tests the SDP handed to FFmpeg for VP8 and Opus streams
+func TestGenerateSDP(t *testing.T) {
+	streams := []RTPStream{
+		{
+			Kind: "video", Port: 50000, RTCPPort: 50001, SSRC: 1111, CNAME: "teacher",
+			Codec: mediasoup.RtpCodecParameters{MimeType: "video/VP8", PayloadType: 101, ClockRate: 90000},
+		},
+		{
+			Kind: "audio", Port: 50002, RTCPPort: 50003,
+			Codec: mediasoup.RtpCodecParameters{
+				MimeType: "audio/opus", PayloadType: 100, ClockRate: 48000, Channels: 2,
+				Parameters: map[string]interface{}{"useinbandfec": 1, "minptime": 10},
+			},
+		},
+	}
+
+	sdp := GenerateSDP("rec-1", "127.0.0.1", streams)
+
+	for _, line := range []string{
+		"c=IN IP4 127.0.0.1",
+		"m=video 50000 RTP/AVP 101",
+		"a=rtcp:50001",
+		"a=rtpmap:101 VP8/90000",
+		"a=ssrc:1111 cname:teacher",
+		"m=audio 50002 RTP/AVP 100",
+		"a=rtpmap:100 opus/48000/2",
+		"a=fmtp:100 minptime=10;useinbandfec=1",
+	} {
+		if !strings.Contains(sdp, line+"\r\n") {
+			t.Errorf("SDP missing %q:\n%s", line, sdp)
+		}
+	}
+	if strings.Index(sdp, "m=video") > strings.Index(sdp, "m=audio") {
+		t.Error("Streams out of order")
+	}
+
+	if sdp6 := GenerateSDP("rec-1", "::1", streams[:1]); !strings.Contains(sdp6, "c=IN IP6 ::1\r\n") {
+		t.Errorf("IPv6 listen address not announced as IP6:\n%s", sdp6)
+	}
+
+	t.Log("✓ SDP describes the RTP streams")
+}
+
+// TestRTPIngestArgs tests that streams are copied when the container takes
+// their codec and transcoded otherwise
+func TestRTPIngestArgs(t *testing.T) {
+	streams := []RTPStream{
+		{Kind: "video", Codec: mediasoup.RtpCodecParameters{MimeType: "video/VP8"}},
+		{Kind: "audio", Codec: mediasoup.RtpCodecParameters{MimeType: "audio/opus"}},
+	}
+
+	webm := strings.Join(rtpIngestArgs("in.sdp", "out.webm", streams, &FFmpegConfig{Format: "webm"}), " ")
+	for _, want := range []string{"-protocol_whitelist file,udp,rtp", "-i in.sdp", "-c:v copy", "-c:a copy", "-f webm -y out.webm"} {
+		if !strings.Contains(webm, want) {
+			t.Errorf("WebM args missing %q: %s", want, webm)
+		}
+	}
+	if strings.Contains(webm, "use_wallclock_as_timestamps") {
+		t.Error("WebM args use wall-clock timestamps")
+	}
+
+	mp4 := strings.Join(rtpIngestArgs("in.sdp", "out.mp4", streams, &FFmpegConfig{Format: "mp4", BitrateKbps: 1500}), " ")
+	for _, want := range []string{"-c:v libx264", "-b:v 1500k", "-c:a aac", "aresample=async=1", "-f mp4 -y out.mp4"} {
+		if !strings.Contains(mp4, want) {
+			t.Errorf("MP4 args missing %q: %s", want, mp4)
+		}
+	}
+
+	t.Log("✓ FFmpeg args match the container")
+}
+
+// TestRTPRecorderStartStop tests the SFU calls made to record a room, using
+// a stand-in for FFmpeg that waits for its input to close
+func TestRTPRecorderStartStop(t *testing.T) {
+	sfu, server := newFakeSFU(t)
+
+	dir := t.TempDir()
+	fakeFFmpeg := filepath.Join(dir, "ffmpeg")
+	if err := os.WriteFile(fakeFFmpeg, []byte("#!/bin/sh\ncat >/dev/null\n"), 0755); err != nil {
+		t.Fatalf("Failed to write fake ffmpeg: %v", err)
+	}
+
+	config := DefaultRTPIngestConfig()
+	config.OutputDir = dir
+	config.FFmpegPath = fakeFFmpeg
+	config.MinPort = 52000
+	config.MaxPort = 52999
+	config.ReadyTimeout = 100 * time.Millisecond
+
+	processes := NewProcessRegistry(nil)
+	recorder := NewRTPRecorder(mediasoup.NewClient(server.URL), processes, config, nil)
+
+	session, err := recorder.Start(context.Background(), "rec-1", "room-1", RTPRecordOptions{UserID: "teacher"})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if _, err := recorder.Start(context.Background(), "rec-1", "room-1", RTPRecordOptions{}); err != ErrRTPSessionActive {
+		t.Errorf("Expected ErrRTPSessionActive, got %v", err)
+	}
+
+	if len(session.Streams) != 2 {
+		t.Fatalf("Expected 2 streams, got %d", len(session.Streams))
+	}
+	if session.Streams[0].ProducerID != "teacher-video" || session.Streams[1].ProducerID != "teacher-audio" {
+		t.Errorf("Recorded the wrong producers: %+v", session.Streams)
+	}
+	if session.Streams[0].Codec.MimeType != "video/VP8" {
+		t.Errorf("Expected the VP8 codec, not RTX, got %s", session.Streams[0].Codec.MimeType)
+	}
+	if session.Streams[0].Port == session.Streams[1].Port {
+		t.Error("Streams share a port")
+	}
+	if processes.Len() != 1 {
+		t.Errorf("Expected the FFmpeg process to be registered, got %d", processes.Len())
+	}
+	if filepath.Ext(session.OutputPath) != ".webm" {
+		t.Errorf("Expected a WebM output, got %s", session.OutputPath)
+	}
+
+	sdp, err := os.ReadFile(session.SDPPath)
+	if err != nil {
+		t.Fatalf("SDP file not written: %v", err)
+	}
+
+	sfu.mu.Lock()
+	for _, stream := range session.Streams {
+		connect := sfu.connects[stream.TransportID]
+		if connect.IP != "127.0.0.1" || connect.Port != stream.Port || connect.RTCPPort != stream.Port+1 {
+			t.Errorf("Transport %s connected to %+v, expected port %d", stream.TransportID, connect, stream.Port)
+		}
+		if !sfu.resumed[stream.ConsumerID] {
+			t.Errorf("Consumer %s not resumed", stream.ConsumerID)
+		}
+		if !strings.Contains(string(sdp), fmt.Sprintf("m=%s %d ", stream.Kind, stream.Port)) {
+			t.Errorf("SDP missing the %s stream", stream.Kind)
+		}
+	}
+	sfu.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := recorder.Stop(ctx, "rec-1"); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+
+	sfu.mu.Lock()
+	for _, stream := range session.Streams {
+		if !sfu.closed[stream.TransportID] {
+			t.Errorf("Transport %s not closed", stream.TransportID)
+		}
+	}
+	sfu.mu.Unlock()
+	if processes.Len() != 0 {
+		t.Error("FFmpeg process still registered")
+	}
+	if _, err := os.Stat(session.SDPPath); !os.IsNotExist(err) {
+		t.Error("SDP file not removed")
+	}
+	if _, err := recorder.Stop(ctx, "rec-1"); err != ErrRTPSessionNotFound {
+		t.Errorf("Expected ErrRTPSessionNotFound, got %v", err)
+	}
+
+	t.Log("✓ Recorder sets up and tears down plain transports")
+}
+
+// TestRTPIngestWithFFmpeg feeds the generated SDP from a local RTP sender and
+// checks that FFmpeg writes a WebM file with both streams
+func TestRTPIngestWithFFmpeg(t *testing.T) {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+	ffprobe, err := exec.LookPath("ffprobe")
+	if err != nil {
+		t.Skip("ffprobe not installed")
+	}
+
+	_, server := newFakeSFU(t)
+	dir := t.TempDir()
+
+	config := DefaultRTPIngestConfig()
+	config.OutputDir = dir
+	config.FFmpegPath = ffmpeg
+	config.MinPort = 53000
+	config.MaxPort = 53999
+
+	recorder := NewRTPRecorder(mediasoup.NewClient(server.URL), nil, config, nil)
+	session, err := recorder.Start(context.Background(), "rec-ffmpeg", "room-1", RTPRecordOptions{UserID: "teacher"})
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	// Send VP8 and Opus over RTP with the payload types and SSRCs the SFU
+	// announced, as the plain transports would
+	args := []string{"-hide_banner", "-loglevel", "error", "-re",
+		"-f", "lavfi", "-i", "testsrc=size=320x240:rate=15",
+		"-f", "lavfi", "-i", "sine=frequency=440:sample_rate=48000",
+		"-t", "3",
+	}
+	for _, stream := range session.Streams {
+		dest := fmt.Sprintf("rtp://127.0.0.1:%d?rtcpport=%d", stream.Port, stream.RTCPPort)
+		if stream.Kind == "video" {
+			args = append(args, "-map", "0:v", "-c:v", "libvpx", "-deadline", "realtime", "-b:v", "500k")
+		} else {
+			args = append(args, "-map", "1:a", "-c:a", "libopus", "-ac", "2")
+		}
+		args = append(args,
+			"-payload_type", fmt.Sprint(stream.Codec.PayloadType),
+			"-ssrc", fmt.Sprint(stream.SSRC),
+			"-f", "rtp", dest,
+		)
+	}
+	sender := exec.Command(ffmpeg, args...)
+	if out, err := sender.CombinedOutput(); err != nil {
+		recorder.Stop(context.Background(), "rec-ffmpeg")
+		t.Fatalf("RTP sender failed: %v\n%s", err, out)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := recorder.Stop(ctx, "rec-ffmpeg"); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+
+	out, err := exec.Command(ffprobe, "-v", "error", "-show_entries", "stream=codec_name",
+		"-of", "csv=p=0", session.OutputPath).Output()
+	if err != nil {
+		t.Fatalf("ffprobe failed on %s: %v", session.OutputPath, err)
+	}
+	probed := string(out)
+	if !strings.Contains(probed, "vp8") || !strings.Contains(probed, "opus") {
+		t.Errorf("Expected VP8 and Opus streams, got %q", probed)
+	}
+
+	t.Log("✓ FFmpeg recorded RTP from the SDP into WebM")
+}
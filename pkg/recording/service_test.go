@@ -3,7 +3,7 @@ package recording
 import (
 	"context"
 	"database/sql"
-	"log"
+	"log/slog"
 	"testing"
 	"time"
 
@@ -25,7 +25,7 @@ func TestStartRecording(t *testing.T) {
 	}
 	defer db.Close()
 
-	logger := log.New(log.Writer(), "[TEST] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewRecordingService(db, logger)
 
 	// Test data
@@ -124,7 +124,7 @@ func TestStopRecording(t *testing.T) {
 	}
 	defer db.Close()
 
-	logger := log.New(log.Writer(), "[TEST] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewRecordingService(db, logger)
 
 	// First start a recording
@@ -173,7 +173,7 @@ func TestGetRecording(t *testing.T) {
 	}
 	defer db.Close()
 
-	logger := log.New(log.Writer(), "[TEST] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewRecordingService(db, logger)
 
 	userID := uuid.New()
@@ -215,7 +215,7 @@ func TestGetRecordingNotFound(t *testing.T) {
 	}
 	defer db.Close()
 
-	logger := log.New(log.Writer(), "[TEST] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewRecordingService(db, logger)
 
 	// Try to get non-existent recording
@@ -236,7 +236,7 @@ func TestListRecordings(t *testing.T) {
 	}
 	defer db.Close()
 
-	logger := log.New(log.Writer(), "[TEST] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewRecordingService(db, logger)
 
 	userID := uuid.New()
@@ -282,7 +282,7 @@ func TestListRecordingsPagination(t *testing.T) {
 	}
 	defer db.Close()
 
-	logger := log.New(log.Writer(), "[TEST] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewRecordingService(db, logger)
 
 	userID := uuid.New()
@@ -339,7 +339,7 @@ func TestDeleteRecording(t *testing.T) {
 	}
 	defer db.Close()
 
-	logger := log.New(log.Writer(), "[TEST] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewRecordingService(db, logger)
 
 	userID := uuid.New()
@@ -381,7 +381,7 @@ func TestUpdateRecordingStatus(t *testing.T) {
 	}
 	defer db.Close()
 
-	logger := log.New(log.Writer(), "[TEST] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewRecordingService(db, logger)
 
 	userID := uuid.New()
@@ -414,7 +414,7 @@ func TestUpdateRecordingStatus(t *testing.T) {
 }
 
 func TestUpdateRecordingStatusInvalid(t *testing.T) {
-	logger := log.New(log.Writer(), "[TEST] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewRecordingService(nil, logger)
 
 	err := service.UpdateRecordingStatus(context.Background(), uuid.New(), "invalid_status")
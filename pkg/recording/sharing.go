@@ -0,0 +1,633 @@
+package recording
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/course"
+	"github.com/Bashar444/VTP/pkg/router"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrShareNotFound  = errors.New("share not found")
+	ErrShareRevoked   = errors.New("share has been revoked")
+	ErrShareExpired   = errors.New("share has expired")
+	ErrShareViewLimit = errors.New("share has reached its view limit")
+	ErrSharePassword  = errors.New("share password is missing or wrong")
+	ErrAuthRequired   = errors.New("authentication required")
+	ErrAccessDenied   = errors.New("access to recording denied")
+	ErrInvalidShare   = errors.New("invalid share")
+)
+
+// Where a share link token and its password are read from. Players put the
+// token in the URL; the password is sent in a header so it stays out of
+// URLs and logs.
+const (
+	ShareTokenParam     = "share_token"
+	ShareTokenHeader    = "X-Share-Token"
+	SharePasswordHeader = "X-Share-Password"
+)
+
+// CreateShareRequest shares a recording with a user, with everyone in a
+// course or by a tokenized link
+type CreateShareRequest struct {
+	ShareType   string     `json:"share_type"` // user, course or link
+	UserID      *uuid.UUID `json:"user_id,omitempty"`
+	CourseID    *uuid.UUID `json:"course_id,omitempty"`
+	AccessLevel string     `json:"access_level,omitempty"` // view (default) or download
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Password    string     `json:"password,omitempty"`  // link shares only
+	MaxViews    *int       `json:"max_views,omitempty"` // link shares only
+}
+
+// AccessGrant is the outcome of a successful access check
+type AccessGrant struct {
+	RecordingID uuid.UUID
+	UserID      *uuid.UUID // nil for anonymous link holders
+	// Share is the share that granted access, nil for course members and
+	// the recording's owner
+	Share       *RecordingSharing
+	AccessLevel string
+}
+
+// ShareToken returns the link token the access was granted by, if any
+func (g *AccessGrant) ShareToken() string {
+	if g.Share == nil || g.Share.ShareLinkToken == nil {
+		return ""
+	}
+	return *g.Share.ShareLinkToken
+}
+
+// SharingService manages who a recording is shared with and checks and logs
+// access to recording media
+type SharingService struct {
+	db    *sql.DB
+	authz *course.CourseAuthorizer
+	log   *slog.Logger
+}
+
+// NewSharingService creates a new sharing service. Course members are
+// resolved with authz, so the recording's own course keeps its access.
+func NewSharingService(db *sql.DB, authz *course.CourseAuthorizer, logger *slog.Logger) *SharingService {
+	if logger == nil {
+		logger = slog.Default().With("component", "recording_sharing")
+	}
+	return &SharingService{
+		db:    db,
+		authz: authz,
+		log:   logger,
+	}
+}
+
+// validateShareRequest checks a share request and fills in its defaults
+func validateShareRequest(req *CreateShareRequest, now time.Time) error {
+	if req.AccessLevel == "" {
+		req.AccessLevel = AccessLevelView
+	}
+	// Sharing can pass on viewing and downloading, not the right to share
+	// further or delete
+	if req.AccessLevel != AccessLevelView && req.AccessLevel != AccessLevelDownload {
+		return fmt.Errorf("%w: access_level must be %s or %s", ErrInvalidShare, AccessLevelView, AccessLevelDownload)
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		return fmt.Errorf("%w: expires_at must be in the future", ErrInvalidShare)
+	}
+
+	switch req.ShareType {
+	case ShareTypeUser:
+		if req.UserID == nil || *req.UserID == uuid.Nil {
+			return fmt.Errorf("%w: user_id is required", ErrInvalidShare)
+		}
+	case ShareTypeCourse:
+		if req.CourseID == nil || *req.CourseID == uuid.Nil {
+			return fmt.Errorf("%w: course_id is required", ErrInvalidShare)
+		}
+	case ShareTypeLink:
+		if req.MaxViews != nil && *req.MaxViews <= 0 {
+			return fmt.Errorf("%w: max_views must be positive", ErrInvalidShare)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: share_type must be %s, %s or %s", ErrInvalidShare, ShareTypeUser, ShareTypeCourse, ShareTypeLink)
+	}
+
+	if req.Password != "" || req.MaxViews != nil {
+		return fmt.Errorf("%w: password and max_views only apply to link shares", ErrInvalidShare)
+	}
+	return nil
+}
+
+// CreateShare shares a recording. Link shares get a random token; their
+// password is stored as a bcrypt hash.
+func (s *SharingService) CreateShare(ctx context.Context, r *http.Request, recordingID, sharedBy uuid.UUID, req *CreateShareRequest) (*RecordingSharing, error) {
+	if req == nil {
+		return nil, errors.New("request cannot be nil")
+	}
+	now := time.Now().UTC()
+	if err := validateShareRequest(req, now); err != nil {
+		return nil, err
+	}
+
+	share := &RecordingSharing{
+		ID:          uuid.New(),
+		RecordingID: recordingID,
+		SharedBy:    sharedBy,
+		SharedWith:  req.UserID,
+		CourseID:    req.CourseID,
+		ShareType:   req.ShareType,
+		AccessLevel: req.AccessLevel,
+		ExpiryAt:    req.ExpiresAt,
+		MaxViews:    req.MaxViews,
+		Metadata:    map[string]interface{}{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if req.ShareType == ShareTypeLink {
+		token, err := newShareToken()
+		if err != nil {
+			return nil, err
+		}
+		share.ShareLinkToken = &token
+		if req.Password != "" {
+			hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+			if err != nil {
+				return nil, fmt.Errorf("failed to hash share password: %w", err)
+			}
+			hashStr := string(hash)
+			share.PasswordHash = &hashStr
+			share.HasPassword = true
+		}
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO recording_sharing
+		(id, recording_id, shared_by, shared_with, course_id, share_type, access_level, expiry_at,
+		 share_link_token, password_hash, max_views, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`,
+		share.ID, share.RecordingID, share.SharedBy, share.SharedWith, share.CourseID, share.ShareType,
+		share.AccessLevel, share.ExpiryAt, share.ShareLinkToken, share.PasswordHash, share.MaxViews,
+		share.CreatedAt, share.UpdatedAt,
+	)
+	if err != nil {
+		s.log.ErrorContext(ctx, "Error creating share", "recording_id", recordingID, "error", err)
+		return nil, fmt.Errorf("failed to create share: %w", err)
+	}
+
+	s.logAccess(ctx, r, recordingID, &sharedBy, &share.ID, AccessActionShare, nil)
+	s.log.InfoContext(ctx, "Recording shared", "recording_id", recordingID, "share_id", share.ID, "share_type", share.ShareType)
+	return share, nil
+}
+
+// ListShares returns every share of a recording, newest first, including
+// revoked and expired ones
+func (s *SharingService) ListShares(ctx context.Context, recordingID uuid.UUID) ([]RecordingSharing, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, recording_id, shared_by, shared_with, course_id, share_type, access_level, expiry_at,
+		       share_link_token, password_hash IS NOT NULL, max_views, view_count, COALESCE(is_revoked, FALSE), revoked_at,
+		       revoked_by, created_at, updated_at
+		FROM recording_sharing
+		WHERE recording_id = $1
+		ORDER BY created_at DESC
+	`, recordingID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shares: %w", err)
+	}
+	defer rows.Close()
+
+	shares := []RecordingSharing{}
+	for rows.Next() {
+		var share RecordingSharing
+		err := rows.Scan(
+			&share.ID, &share.RecordingID, &share.SharedBy, &share.SharedWith, &share.CourseID,
+			&share.ShareType, &share.AccessLevel, &share.ExpiryAt, &share.ShareLinkToken,
+			&share.HasPassword, &share.MaxViews, &share.ViewCount, &share.IsRevoked, &share.RevokedAt,
+			&share.RevokedBy, &share.CreatedAt, &share.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan share: %w", err)
+		}
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+// RevokeShare revokes a share of a recording. Revoking a share twice is not
+// an error.
+func (s *SharingService) RevokeShare(ctx context.Context, r *http.Request, recordingID, shareID, revokedBy uuid.UUID) error {
+	now := time.Now().UTC()
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE recording_sharing
+		SET is_revoked = TRUE, revoked_at = $1, revoked_by = $2, updated_at = $1
+		WHERE id = $3 AND recording_id = $4 AND NOT COALESCE(is_revoked, FALSE)
+	`, now, revokedBy, shareID, recordingID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke share: %w", err)
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		var exists bool
+		err := s.db.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM recording_sharing WHERE id = $1 AND recording_id = $2)`,
+			shareID, recordingID,
+		).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to revoke share: %w", err)
+		}
+		if !exists {
+			return ErrShareNotFound
+		}
+		return nil
+	}
+
+	s.logAccess(ctx, r, recordingID, &revokedBy, &shareID, AccessActionUnshare, nil)
+	s.log.InfoContext(ctx, "Recording share revoked", "recording_id", recordingID, "share_id", shareID)
+	return nil
+}
+
+// CheckAccess decides whether a request may access a recording's media and
+// logs the attempt. Link holders are identified by the share token; signed
+// in users get access as members of the recording's course, as its owner
+// or through a user or course share. Views (action view or download) count
+// toward a link's view limit; segment requests (stream) do not.
+func (s *SharingService) CheckAccess(r *http.Request, recordingID uuid.UUID, action string) (*AccessGrant, error) {
+	ctx := r.Context()
+
+	var userID *uuid.UUID
+	if value, ok := ctx.Value("user_id").(string); ok {
+		if id, err := uuid.Parse(value); err == nil {
+			userID = &id
+		}
+	}
+
+	grant, err := s.checkAccess(r, recordingID, userID, action)
+	var shareID *uuid.UUID
+	if grant != nil && grant.Share != nil {
+		shareID = &grant.Share.ID
+	}
+	s.logAccess(ctx, r, recordingID, userID, shareID, action, err)
+	return grant, err
+}
+
+// RequireAccess returns middleware that lets through requests CheckAccess
+// allows for the recording in the "id" path parameter, so routes serving
+// a recording's media elsewhere admit the same users and link holders
+func (s *SharingService) RequireAccess(action string) router.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recordingID, err := uuid.Parse(r.PathValue("id"))
+			if err != nil {
+				http.Error(w, "Invalid recording ID", http.StatusBadRequest)
+				return
+			}
+			if _, err := s.CheckAccess(r, recordingID, action); err != nil {
+				status, message := accessErrorStatus(err)
+				if status == http.StatusInternalServerError {
+					s.log.ErrorContext(r.Context(), "Failed to check recording access", "recording_id", recordingID, "error", err)
+				}
+				http.Error(w, message, status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (s *SharingService) checkAccess(r *http.Request, recordingID uuid.UUID, userID *uuid.UUID, action string) (*AccessGrant, error) {
+	ctx := r.Context()
+
+	// A playback token issued to a link holder stands for the share token
+	// and its password until the share is revoked or expires
+	claims, _ := PlaybackClaimsFromContext(ctx)
+	if token := shareToken(r); token != "" || (claims != nil && claims.UserID == "" && claims.ShareID != "") {
+		var share *RecordingSharing
+		var err error
+		if token != "" {
+			share, err = s.shareByToken(ctx, recordingID, token)
+		} else {
+			share, err = s.shareByID(ctx, recordingID, claims.ShareID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		grant := &AccessGrant{RecordingID: recordingID, UserID: userID, Share: share, AccessLevel: share.AccessLevel}
+		if token != "" {
+			err = checkLinkShare(share, r.Header.Get(SharePasswordHeader), time.Now())
+		} else {
+			err = checkShareLive(share, time.Now())
+		}
+		if err != nil {
+			return grant, err
+		}
+		if !levelAllows(share.AccessLevel, action) {
+			return grant, ErrAccessDenied
+		}
+		// Reloads with a playback token belong to a view already counted
+		if action != AccessActionStream && token != "" {
+			if err := s.countView(ctx, share.ID); err != nil {
+				return grant, err
+			}
+		}
+		return grant, nil
+	}
+
+	if userID == nil {
+		return nil, ErrAuthRequired
+	}
+
+	// Members of the recording's course and its owner keep full access
+	if s.authz != nil {
+		scope, err := s.authz.RecordingScope("id")(r)
+		if err != nil && !errors.Is(err, course.ErrResourceMissing) {
+			return nil, err
+		}
+		if scope != nil {
+			_, err := s.authz.Check(r, scope, course.MemberRoles...)
+			if err == nil {
+				return &AccessGrant{RecordingID: recordingID, UserID: userID, AccessLevel: AccessLevelDownload}, nil
+			}
+			if !errors.Is(err, course.ErrNotCourseMember) && !errors.Is(err, course.ErrForbidden) {
+				return nil, err
+			}
+		}
+	}
+
+	share, err := s.userShare(r, recordingID, *userID)
+	if err != nil {
+		return nil, err
+	}
+	if share == nil {
+		return nil, ErrAccessDenied
+	}
+	grant := &AccessGrant{RecordingID: recordingID, UserID: userID, Share: share, AccessLevel: share.AccessLevel}
+	if !levelAllows(share.AccessLevel, action) {
+		return grant, ErrAccessDenied
+	}
+	return grant, nil
+}
+
+// shareByToken looks up a link share of the recording by its token
+func (s *SharingService) shareByToken(ctx context.Context, recordingID uuid.UUID, token string) (*RecordingSharing, error) {
+	return s.linkShare(ctx, "share_link_token = $1", token, recordingID)
+}
+
+// shareByID looks up a link share of the recording by its ID
+func (s *SharingService) shareByID(ctx context.Context, recordingID uuid.UUID, shareID string) (*RecordingSharing, error) {
+	id, err := uuid.Parse(shareID)
+	if err != nil {
+		return nil, ErrShareNotFound
+	}
+	return s.linkShare(ctx, "id = $1", id, recordingID)
+}
+
+func (s *SharingService) linkShare(ctx context.Context, where string, value interface{}, recordingID uuid.UUID) (*RecordingSharing, error) {
+	var share RecordingSharing
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, recording_id, shared_by, share_type, access_level, expiry_at, share_link_token,
+		       password_hash, max_views, view_count, COALESCE(is_revoked, FALSE), revoked_at
+		FROM recording_sharing
+		WHERE `+where+` AND recording_id = $2 AND share_type = $3
+	`, value, recordingID, ShareTypeLink).Scan(
+		&share.ID, &share.RecordingID, &share.SharedBy, &share.ShareType, &share.AccessLevel,
+		&share.ExpiryAt, &share.ShareLinkToken, &share.PasswordHash, &share.MaxViews, &share.ViewCount,
+		&share.IsRevoked, &share.RevokedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrShareNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share: %w", err)
+	}
+	share.HasPassword = share.PasswordHash != nil
+	return &share, nil
+}
+
+// userShare returns the most permissive live share of the recording with
+// the user, directly or through a course they belong to
+func (s *SharingService) userShare(r *http.Request, recordingID, userID uuid.UUID) (*RecordingSharing, error) {
+	ctx := r.Context()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, share_type, access_level, shared_with, course_id, expiry_at
+		FROM recording_sharing
+		WHERE recording_id = $1
+		  AND NOT COALESCE(is_revoked, FALSE)
+		  AND (expiry_at IS NULL OR expiry_at > $2)
+		  AND ((share_type = $3 AND shared_with = $4) OR share_type = $5)
+	`, recordingID, time.Now().UTC(), ShareTypeUser, userID, ShareTypeCourse)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shares: %w", err)
+	}
+	var candidates []RecordingSharing
+	for rows.Next() {
+		share := RecordingSharing{RecordingID: recordingID}
+		if err := rows.Scan(&share.ID, &share.ShareType, &share.AccessLevel, &share.SharedWith, &share.CourseID, &share.ExpiryAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan share: %w", err)
+		}
+		candidates = append(candidates, share)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get shares: %w", err)
+	}
+
+	globalRole, _ := ctx.Value("user_role").(string)
+	var best *RecordingSharing
+	for i := range candidates {
+		share := &candidates[i]
+		if share.ShareType == ShareTypeCourse {
+			if s.authz == nil || share.CourseID == nil {
+				continue
+			}
+			role, err := s.authz.EffectiveRole(ctx, userID.String(), globalRole, *share.CourseID)
+			if err != nil && !errors.Is(err, course.ErrCourseNotFound) {
+				return nil, err
+			}
+			if role == "" {
+				continue
+			}
+		}
+		if best == nil || (share.AccessLevel == AccessLevelDownload && best.AccessLevel != AccessLevelDownload) {
+			best = share
+		}
+	}
+	return best, nil
+}
+
+// countView counts a view of a link share, refusing it once the limit is
+// reached. The check and increment are one statement so concurrent views
+// cannot exceed the limit.
+func (s *SharingService) countView(ctx context.Context, shareID uuid.UUID) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE recording_sharing
+		SET view_count = view_count + 1
+		WHERE id = $1 AND (max_views IS NULL OR view_count < max_views)
+	`, shareID)
+	if err != nil {
+		return fmt.Errorf("failed to count share view: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrShareViewLimit
+	}
+	return nil
+}
+
+// logAccess writes an entry to the recording access log. Logging failures
+// do not fail the request.
+func (s *SharingService) logAccess(ctx context.Context, r *http.Request, recordingID uuid.UUID, userID, shareID *uuid.UUID, action string, accessErr error) {
+	status := AccessStatusSuccess
+	var errorMessage *string
+	if accessErr != nil {
+		status = AccessStatusFailed
+		msg := accessErr.Error()
+		errorMessage = &msg
+	}
+
+	metadata := "{}"
+	if r != nil {
+		if encoded, err := json.Marshal(map[string]string{"path": r.URL.Path}); err == nil {
+			metadata = string(encoded)
+		}
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO recording_access_log
+		(id, recording_id, user_id, share_id, action, ip_address, user_agent, status, error_message, metadata, created_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::inet, NULLIF($7, ''), $8, $9, $10::jsonb, $11)
+	`,
+		uuid.New(), recordingID, userID, shareID, action, requestIP(r), requestUserAgent(r),
+		status, errorMessage, metadata, time.Now().UTC(),
+	)
+	if err != nil {
+		s.log.ErrorContext(ctx, "Failed to write recording access log", "recording_id", recordingID, "action", action, "error", err)
+	}
+}
+
+// accessErrorStatus maps an access check error to an HTTP status and a
+// message for the client
+func accessErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, ErrAuthRequired):
+		return http.StatusUnauthorized, "Authentication required"
+	case errors.Is(err, ErrSharePassword):
+		return http.StatusUnauthorized, "Share password required"
+	case errors.Is(err, ErrShareNotFound):
+		return http.StatusNotFound, "Share link not found"
+	case errors.Is(err, ErrShareRevoked), errors.Is(err, ErrShareExpired):
+		return http.StatusGone, "Share link is no longer valid"
+	case errors.Is(err, ErrShareViewLimit):
+		return http.StatusForbidden, "Share link has reached its view limit"
+	case errors.Is(err, ErrAccessDenied):
+		return http.StatusForbidden, "Access denied"
+	default:
+		return http.StatusInternalServerError, "Failed to check access"
+	}
+}
+
+// checkShareLive checks that a share is neither revoked nor expired
+func checkShareLive(share *RecordingSharing, now time.Time) error {
+	if share.IsRevoked {
+		return ErrShareRevoked
+	}
+	if share.ExpiryAt != nil && !share.ExpiryAt.After(now) {
+		return ErrShareExpired
+	}
+	return nil
+}
+
+// checkLinkShare checks that a link share is live and, if it has a
+// password, that password matches. The view limit is enforced when a view
+// is counted, so the segments of the last allowed view still play.
+func checkLinkShare(share *RecordingSharing, password string, now time.Time) error {
+	if err := checkShareLive(share, now); err != nil {
+		return err
+	}
+	if share.PasswordHash != nil {
+		if password == "" || bcrypt.CompareHashAndPassword([]byte(*share.PasswordHash), []byte(password)) != nil {
+			return ErrSharePassword
+		}
+	}
+	return nil
+}
+
+// levelAllows reports whether an access level permits an action
+func levelAllows(level, action string) bool {
+	if action == AccessActionDownload {
+		return level == AccessLevelDownload || level == AccessLevelShare || level == AccessLevelDelete
+	}
+	return ValidateAccessLevel(level)
+}
+
+// newShareToken returns a random URL-safe share link token
+func newShareToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate share token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// shareToken returns the share link token a request carries, if any
+func shareToken(r *http.Request) string {
+	if token := r.URL.Query().Get(ShareTokenParam); token != "" {
+		return token
+	}
+	return r.Header.Get(ShareTokenHeader)
+}
+
+func requestIP(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if net.ParseIP(host) == nil {
+		return ""
+	}
+	return host
+}
+
+func requestUserAgent(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	return r.UserAgent()
+}
+
+// rewritePlaylistURIs adds query parameters to every URI line of an HLS
+// playlist, so segment requests carry the same credentials as the playlist
+// request
+func rewritePlaylistURIs(playlist string, params url.Values) string {
+	if len(params) == 0 {
+		return playlist
+	}
+	lines := strings.Split(playlist, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		separator := "?"
+		if strings.Contains(trimmed, "?") {
+			separator = "&"
+		}
+		lines[i] = trimmed + separator + params.Encode()
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,139 @@
+package recording
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestValidateShareRequest tests the validation of share requests
+func TestValidateShareRequest(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+	userID := uuid.New()
+	courseID := uuid.New()
+	views := 5
+	noViews := 0
+
+	tests := []struct {
+		name  string
+		req   CreateShareRequest
+		valid bool
+	}{
+		{"user share", CreateShareRequest{ShareType: ShareTypeUser, UserID: &userID}, true},
+		{"user share without user", CreateShareRequest{ShareType: ShareTypeUser}, false},
+		{"course share", CreateShareRequest{ShareType: ShareTypeCourse, CourseID: &courseID, AccessLevel: AccessLevelDownload}, true},
+		{"course share without course", CreateShareRequest{ShareType: ShareTypeCourse}, false},
+		{"link share", CreateShareRequest{ShareType: ShareTypeLink, Password: "secret", MaxViews: &views, ExpiresAt: &future}, true},
+		{"link share with zero views", CreateShareRequest{ShareType: ShareTypeLink, MaxViews: &noViews}, false},
+		{"expired share", CreateShareRequest{ShareType: ShareTypeLink, ExpiresAt: &past}, false},
+		{"password on user share", CreateShareRequest{ShareType: ShareTypeUser, UserID: &userID, Password: "secret"}, false},
+		{"share access level", CreateShareRequest{ShareType: ShareTypeLink, AccessLevel: AccessLevelShare}, false},
+		{"public share", CreateShareRequest{ShareType: ShareTypePublic}, false},
+	}
+
+	for _, tt := range tests {
+		req := tt.req
+		err := validateShareRequest(&req, now)
+		if tt.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidShare) {
+			t.Errorf("%s: expected ErrInvalidShare, got %v", tt.name, err)
+		}
+		if tt.valid && req.AccessLevel == "" {
+			t.Errorf("%s: access level not defaulted", tt.name)
+		}
+	}
+
+	t.Log("✓ Share requests validated")
+}
+
+// TestCheckLinkShare tests revocation, expiry and passwords of link shares
+func TestCheckLinkShare(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashStr := string(hash)
+
+	if err := checkLinkShare(&RecordingSharing{}, "", now); err != nil {
+		t.Errorf("Open link rejected: %v", err)
+	}
+	if err := checkLinkShare(&RecordingSharing{IsRevoked: true}, "", now); !errors.Is(err, ErrShareRevoked) {
+		t.Errorf("Expected ErrShareRevoked, got %v", err)
+	}
+	if err := checkLinkShare(&RecordingSharing{ExpiryAt: &past}, "", now); !errors.Is(err, ErrShareExpired) {
+		t.Errorf("Expected ErrShareExpired, got %v", err)
+	}
+
+	protected := &RecordingSharing{PasswordHash: &hashStr}
+	if err := checkLinkShare(protected, "", now); !errors.Is(err, ErrSharePassword) {
+		t.Errorf("Expected ErrSharePassword without password, got %v", err)
+	}
+	if err := checkLinkShare(protected, "wrong", now); !errors.Is(err, ErrSharePassword) {
+		t.Errorf("Expected ErrSharePassword for wrong password, got %v", err)
+	}
+	if err := checkLinkShare(protected, "secret", now); err != nil {
+		t.Errorf("Correct password rejected: %v", err)
+	}
+
+	t.Log("✓ Link shares checked")
+}
+
+// TestLevelAllows tests which access levels permit downloads
+func TestLevelAllows(t *testing.T) {
+	if !levelAllows(AccessLevelView, AccessActionView) || !levelAllows(AccessLevelView, AccessActionStream) {
+		t.Error("View level should allow viewing and streaming")
+	}
+	if levelAllows(AccessLevelView, AccessActionDownload) {
+		t.Error("View level should not allow downloads")
+	}
+	if !levelAllows(AccessLevelDownload, AccessActionDownload) {
+		t.Error("Download level should allow downloads")
+	}
+
+	t.Log("✓ Access levels checked")
+}
+
+// TestShareTokenFromRequest tests reading the share token from the query
+// and the header
+func TestShareTokenFromRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/recordings/x/stream/playlist.m3u8?share_token=abc", nil)
+	if token := shareToken(r); token != "abc" {
+		t.Errorf("Expected token from query, got %q", token)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/recordings/x/download", nil)
+	r.Header.Set(ShareTokenHeader, "def")
+	if token := shareToken(r); token != "def" {
+		t.Errorf("Expected token from header, got %q", token)
+	}
+
+	t.Log("✓ Share tokens read from requests")
+}
+
+// TestRewritePlaylistURIs tests adding the share token to segment URIs
+func TestRewritePlaylistURIs(t *testing.T) {
+	playlist := "#EXTM3U\n#EXTINF:10.0,\nsegment-0.ts\n#EXTINF:10.0,\nsegment-1.ts?v=2\n#EXT-X-ENDLIST\n"
+	got := rewritePlaylistURIs(playlist, url.Values{ShareTokenParam: {"a b"}})
+	want := "#EXTM3U\n#EXTINF:10.0,\nsegment-0.ts?share_token=a+b\n#EXTINF:10.0,\nsegment-1.ts?v=2&share_token=a+b\n#EXT-X-ENDLIST\n"
+	if got != want {
+		t.Errorf("Unexpected playlist:\n%s", got)
+	}
+
+	if rewritePlaylistURIs(playlist, nil) != playlist {
+		t.Error("Playlist changed without parameters")
+	}
+
+	t.Log("✓ Playlist URIs rewritten")
+}
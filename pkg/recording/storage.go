@@ -5,7 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"time"
@@ -32,11 +32,11 @@ type StorageBackend interface {
 // LocalStorageBackend implements StorageBackend using local filesystem
 type LocalStorageBackend struct {
 	basePath string
-	logger   *log.Logger
+	logger   *slog.Logger
 }
 
 // NewLocalStorageBackend creates a new local storage backend
-func NewLocalStorageBackend(basePath string, logger *log.Logger) (*LocalStorageBackend, error) {
+func NewLocalStorageBackend(basePath string, logger *slog.Logger) (*LocalStorageBackend, error) {
 	// Create directory if it doesn't exist
 	if err := os.MkdirAll(basePath, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create storage directory: %w", err)
@@ -82,7 +82,7 @@ func (b *LocalStorageBackend) Upload(ctx context.Context, recordingID uuid.UUID,
 		return fmt.Errorf("failed to copy file: %w", err)
 	}
 
-	b.logger.Printf("Recording uploaded: %s (%s)", recordingID, dstPath)
+	b.logger.InfoContext(ctx, "Recording uploaded", "recording_id", recordingID, "path", dstPath)
 	return nil
 }
 
@@ -108,7 +108,7 @@ func (b *LocalStorageBackend) Download(ctx context.Context, recordingID uuid.UUI
 		return fmt.Errorf("failed to download recording: %w", err)
 	}
 
-	b.logger.Printf("Recording downloaded: %s", recordingID)
+	b.logger.DebugContext(ctx, "Recording downloaded", "recording_id", recordingID)
 	return nil
 }
 
@@ -125,7 +125,7 @@ func (b *LocalStorageBackend) Delete(ctx context.Context, recordingID uuid.UUID)
 		return fmt.Errorf("failed to delete recording: %w", err)
 	}
 
-	b.logger.Printf("Recording deleted: %s", recordingID)
+	b.logger.InfoContext(ctx, "Recording deleted", "recording_id", recordingID)
 	return nil
 }
 
@@ -180,11 +180,11 @@ func (b *LocalStorageBackend) GetURL(ctx context.Context, recordingID uuid.UUID,
 type StorageManager struct {
 	backend StorageBackend
 	db      *sql.DB
-	logger  *log.Logger
+	logger  *slog.Logger
 }
 
 // NewStorageManager creates a new storage manager
-func NewStorageManager(backend StorageBackend, db *sql.DB, logger *log.Logger) *StorageManager {
+func NewStorageManager(backend StorageBackend, db *sql.DB, logger *slog.Logger) *StorageManager {
 	return &StorageManager{
 		backend: backend,
 		db:      db,
@@ -195,7 +195,7 @@ func NewStorageManager(backend StorageBackend, db *sql.DB, logger *log.Logger) *
 // UploadRecording uploads completed recording to storage
 func (m *StorageManager) UploadRecording(ctx context.Context, recordingID uuid.UUID, filePath string) error {
 	if err := m.backend.Upload(ctx, recordingID, filePath); err != nil {
-		m.logger.Printf("Failed to upload recording %s: %v", recordingID, err)
+		m.logger.ErrorContext(ctx, "Failed to upload recording", "recording_id", recordingID, "error", err)
 		return err
 	}
 
@@ -209,11 +209,11 @@ func (m *StorageManager) UploadRecording(ctx context.Context, recordingID uuid.U
 	now := time.Now().UTC()
 	_, err := m.db.ExecContext(ctx, query, "uploaded", now, now, recordingID)
 	if err != nil {
-		m.logger.Printf("Failed to update storage status: %v", err)
+		m.logger.ErrorContext(ctx, "Failed to update storage status", "recording_id", recordingID, "error", err)
 		// Don't return error - upload succeeded even if DB update failed
 	}
 
-	m.logger.Printf("Recording storage complete: %s", recordingID)
+	m.logger.InfoContext(ctx, "Recording storage complete", "recording_id", recordingID)
 	return nil
 }
 
@@ -258,7 +258,7 @@ func (m *StorageManager) CleanupExpiredRecordings(ctx context.Context, retention
 
 	rows, err := m.db.QueryContext(ctx, query, retentionDays)
 	if err != nil {
-		m.logger.Printf("Failed to query expired recordings: %v", err)
+		m.logger.ErrorContext(ctx, "Failed to query expired recordings", "error", err)
 		return err
 	}
 	defer rows.Close()
@@ -267,13 +267,13 @@ func (m *StorageManager) CleanupExpiredRecordings(ctx context.Context, retention
 	for rows.Next() {
 		var recordingID uuid.UUID
 		if err := rows.Scan(&recordingID); err != nil {
-			m.logger.Printf("Failed to scan recording ID: %v", err)
+			m.logger.ErrorContext(ctx, "Failed to scan recording ID", "error", err)
 			continue
 		}
 
 		// Delete from storage
 		if err := m.backend.Delete(ctx, recordingID); err != nil {
-			m.logger.Printf("Failed to delete recording from storage: %v", err)
+			m.logger.ErrorContext(ctx, "Failed to delete recording from storage", "recording_id", recordingID, "error", err)
 			continue
 		}
 
@@ -286,13 +286,13 @@ func (m *StorageManager) CleanupExpiredRecordings(ctx context.Context, retention
 
 		now := time.Now().UTC()
 		if _, err := m.db.ExecContext(ctx, updateQuery, now, now, recordingID); err != nil {
-			m.logger.Printf("Failed to mark recording as deleted: %v", err)
+			m.logger.ErrorContext(ctx, "Failed to mark recording as deleted", "recording_id", recordingID, "error", err)
 		}
 
 		deletedCount++
 	}
 
-	m.logger.Printf("Cleanup complete: %d recordings deleted", deletedCount)
+	m.logger.InfoContext(ctx, "Cleanup complete", "deleted", deletedCount)
 	return rows.Err()
 }
 
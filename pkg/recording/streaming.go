@@ -4,8 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"math"
+	"net/url"
 	"os/exec"
 	"strconv"
 	"time"
@@ -48,12 +49,13 @@ var DefaultHLSProfile = StreamingProfile{
 type StreamingManager struct {
 	storageManager *StorageManager
 	db             *sql.DB
-	logger         *log.Logger
+	logger         *slog.Logger
 	outputPath     string
+	signer         *PlaybackSigner
 }
 
 // NewStreamingManager creates new streaming manager
-func NewStreamingManager(storageManager *StorageManager, db *sql.DB, logger *log.Logger, outputPath string) *StreamingManager {
+func NewStreamingManager(storageManager *StorageManager, db *sql.DB, logger *slog.Logger, outputPath string) *StreamingManager {
 	return &StreamingManager{
 		storageManager: storageManager,
 		db:             db,
@@ -62,6 +64,13 @@ func NewStreamingManager(storageManager *StorageManager, db *sql.DB, logger *log
 	}
 }
 
+// WithPlaybackTokens signs playlist URLs and segment URIs with playback
+// tokens, so segments are only served to clients holding a valid token
+func (m *StreamingManager) WithPlaybackTokens(signer *PlaybackSigner) *StreamingManager {
+	m.signer = signer
+	return m
+}
+
 // TranscodeToHLS converts recording to HLS format for streaming
 func (m *StreamingManager) TranscodeToHLS(ctx context.Context, recordingID uuid.UUID, inputPath string, profile StreamingProfile) error {
 	select {
@@ -86,7 +95,7 @@ func (m *StreamingManager) TranscodeToHLS(ctx context.Context, recordingID uuid.
 	)
 
 	if err := cmd.Run(); err != nil {
-		m.logger.Printf("FFmpeg HLS transcoding failed: %v", err)
+		m.logger.ErrorContext(ctx, "FFmpeg HLS transcoding failed", "recording_id", recordingID, "error", err)
 		return err
 	}
 
@@ -100,10 +109,10 @@ func (m *StreamingManager) TranscodeToHLS(ctx context.Context, recordingID uuid.
 	now := time.Now().UTC()
 	_, err := m.db.ExecContext(ctx, query, string(FormatHLS), now, now, recordingID)
 	if err != nil {
-		m.logger.Printf("Failed to update streaming status: %v", err)
+		m.logger.ErrorContext(ctx, "Failed to update streaming status", "recording_id", recordingID, "error", err)
 	}
 
-	m.logger.Printf("HLS transcoding complete: %s", recordingID)
+	m.logger.InfoContext(ctx, "HLS transcoding complete", "recording_id", recordingID)
 	return nil
 }
 
@@ -128,7 +137,7 @@ func (m *StreamingManager) TranscodeToMP4(ctx context.Context, recordingID uuid.
 	)
 
 	if err := cmd.Run(); err != nil {
-		m.logger.Printf("FFmpeg MP4 transcoding failed: %v", err)
+		m.logger.ErrorContext(ctx, "FFmpeg MP4 transcoding failed", "recording_id", recordingID, "error", err)
 		return err
 	}
 
@@ -147,6 +156,7 @@ func (m *StreamingManager) GenerateThumbnail(ctx context.Context, recordingID uu
 
 	cmd := exec.CommandContext(ctx,
 		"ffmpeg",
+		"-y",
 		"-ss", strconv.Itoa(timestampSeconds),
 		"-i", inputPath,
 		"-vf", "scale=320:180",
@@ -155,7 +165,7 @@ func (m *StreamingManager) GenerateThumbnail(ctx context.Context, recordingID uu
 	)
 
 	if err := cmd.Run(); err != nil {
-		m.logger.Printf("Failed to generate thumbnail: %v", err)
+		m.logger.ErrorContext(ctx, "Failed to generate thumbnail", "recording_id", recordingID, "error", err)
 		return "", err
 	}
 
@@ -169,10 +179,10 @@ func (m *StreamingManager) GenerateThumbnail(ctx context.Context, recordingID uu
 	now := time.Now().UTC()
 	_, err := m.db.ExecContext(ctx, query, thumbPath, now, recordingID)
 	if err != nil {
-		m.logger.Printf("Failed to save thumbnail path: %v", err)
+		m.logger.ErrorContext(ctx, "Failed to save thumbnail path", "recording_id", recordingID, "error", err)
 	}
 
-	m.logger.Printf("Thumbnail generated: %s", recordingID)
+	m.logger.InfoContext(ctx, "Thumbnail generated", "recording_id", recordingID)
 	return thumbPath, nil
 }
 
@@ -195,7 +205,7 @@ func (m *StreamingManager) ExtractMetadata(ctx context.Context, recordingID uuid
 
 	output, err := cmd.Output()
 	if err != nil {
-		m.logger.Printf("Failed to extract metadata: %v", err)
+		m.logger.ErrorContext(ctx, "Failed to extract metadata", "recording_id", recordingID, "error", err)
 		return nil, err
 	}
 
@@ -313,8 +323,10 @@ func (m *StreamingManager) LogPlaybackEvent(ctx context.Context, recordingID uui
 	return err
 }
 
-// GeneratePlaylistURL creates a URL for HLS playlist
-func (m *StreamingManager) GeneratePlaylistURL(ctx context.Context, recordingID uuid.UUID) (string, error) {
+// GeneratePlaylistURL creates a URL for HLS playlist. With playback tokens
+// the URL is signed for the user, their global role and client address and
+// expires with the token.
+func (m *StreamingManager) GeneratePlaylistURL(ctx context.Context, recordingID, userID uuid.UUID, role, clientIP string) (string, error) {
 	// Check if streaming is ready
 	query := `SELECT streaming_ready FROM recordings WHERE id = $1`
 
@@ -328,9 +340,25 @@ func (m *StreamingManager) GeneratePlaylistURL(ctx context.Context, recordingID
 		return "", fmt.Errorf("streaming not ready for recording: %s", recordingID)
 	}
 
-	// Return playlist URL
-	url := fmt.Sprintf("/api/v1/recordings/%s/stream/playlist.m3u8", recordingID.String())
-	return url, nil
+	user := ""
+	if userID != uuid.Nil {
+		user = userID.String()
+	}
+	return m.playlistURL(recordingID, user, role, clientIP)
+}
+
+// playlistURL returns the playlist URL of a recording, signed when playback
+// tokens are enabled
+func (m *StreamingManager) playlistURL(recordingID uuid.UUID, userID, role, clientIP string) (string, error) {
+	playlist := fmt.Sprintf("/api/v1/recordings/%s/stream/playlist.m3u8", recordingID.String())
+	if m.signer == nil {
+		return playlist, nil
+	}
+	token, _, err := m.signer.Issue(recordingID, userID, role, "", clientIP, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return playlist + "?" + url.Values{PlaybackTokenParam: {token}}.Encode(), nil
 }
 
 // CalculateQuality determines quality based on bitrate
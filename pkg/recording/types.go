@@ -31,6 +31,22 @@ const (
 	ShareTypeRole   = "role"
 	ShareTypePublic = "public"
 	ShareTypeLink   = "link"
+	ShareTypeCourse = "course"
+)
+
+// Recording access log actions
+const (
+	AccessActionView     = "view"
+	AccessActionStream   = "stream"
+	AccessActionDownload = "download"
+	AccessActionShare    = "share"
+	AccessActionUnshare  = "unshare"
+)
+
+// Recording access log statuses
+const (
+	AccessStatusSuccess = "success"
+	AccessStatusFailed  = "failed"
 )
 
 // Recording represents a room recording
@@ -88,8 +104,14 @@ type RecordingSharing struct {
 	AccessLevel    string                 `json:"access_level" db:"access_level"`
 	ExpiryAt       *time.Time             `json:"expiry_at" db:"expiry_at"`
 	ShareLinkToken *string                `json:"share_link_token" db:"share_link_token"`
+	CourseID       *uuid.UUID             `json:"course_id,omitempty" db:"course_id"`
+	PasswordHash   *string                `json:"-" db:"password_hash"`
+	HasPassword    bool                   `json:"has_password"`
+	MaxViews       *int                   `json:"max_views,omitempty" db:"max_views"`
+	ViewCount      int                    `json:"view_count" db:"view_count"`
 	IsRevoked      bool                   `json:"is_revoked" db:"is_revoked"`
 	RevokedAt      *time.Time             `json:"revoked_at" db:"revoked_at"`
+	RevokedBy      *uuid.UUID             `json:"revoked_by,omitempty" db:"revoked_by"`
 	Metadata       map[string]interface{} `json:"metadata" db:"metadata"`
 	CreatedAt      time.Time              `json:"created_at" db:"created_at"`
 	UpdatedAt      time.Time              `json:"updated_at" db:"updated_at"`
@@ -99,7 +121,8 @@ type RecordingSharing struct {
 type RecordingAccessLog struct {
 	ID               uuid.UUID              `json:"id" db:"id"`
 	RecordingID      uuid.UUID              `json:"recording_id" db:"recording_id"`
-	UserID           uuid.UUID              `json:"user_id" db:"user_id"`
+	UserID           *uuid.UUID             `json:"user_id" db:"user_id"`
+	ShareID          *uuid.UUID             `json:"share_id,omitempty" db:"share_id"`
 	Action           string                 `json:"action" db:"action"`
 	IPAddress        *string                `json:"ip_address" db:"ip_address"`
 	UserAgent        *string                `json:"user_agent" db:"user_agent"`
@@ -119,6 +142,12 @@ type StartRecordingRequest struct {
 	Format      string    `json:"format,omitempty"` // webm, mp4, etc. Default: webm
 	BitrateKbps *int      `json:"bitrate_kbps,omitempty"`
 	FrameRate   *int      `json:"frame_rate,omitempty"`
+	Layout      string    `json:"layout,omitempty"` // composites all participants: speaker-focus, side-by-side, screen-pip or grid
+}
+
+// SetLayoutRequest switches the layout of a composite recording
+type SetLayoutRequest struct {
+	Layout string `json:"layout"`
 }
 
 // StartRecordingResponse is the response after starting a recording
@@ -188,11 +217,12 @@ type DeleteRecordingResponse struct {
 
 // RecordingListQuery is the query parameters for listing recordings
 type RecordingListQuery struct {
-	RoomID uuid.UUID
-	UserID uuid.UUID
-	Status string
-	Limit  int
-	Offset int
+	RoomID   uuid.UUID
+	UserID   uuid.UUID
+	CourseID uuid.UUID // recordings published in the course
+	Status   string
+	Limit    int
+	Offset   int
 }
 
 // ValidateStatus checks if a status is valid
@@ -237,6 +267,7 @@ func ValidateShareType(shareType string) bool {
 		ShareTypeRole,
 		ShareTypePublic,
 		ShareTypeLink,
+		ShareTypeCourse,
 	}
 	for _, t := range validTypes {
 		if t == shareType {
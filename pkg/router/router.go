@@ -0,0 +1,136 @@
+package router
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Middleware wraps a handler with cross-cutting behaviour such as
+// authentication or role checks
+type Middleware func(http.Handler) http.Handler
+
+// Chain applies middleware to a handler. The first middleware is the
+// outermost, so Chain(h, a, b) serves requests as a(b(h)).
+func Chain(h http.Handler, mw ...Middleware) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// Route describes a registered route
+type Route struct {
+	Method  string // empty when the route matches every method
+	Path    string
+	Pattern string
+}
+
+// Params returns the names of the path parameters in the route
+func (r Route) Params() []string {
+	var params []string
+	for _, segment := range strings.Split(r.Path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			name := strings.TrimSuffix(strings.Trim(segment, "{}"), "...")
+			if name != "$" {
+				params = append(params, name)
+			}
+		}
+	}
+	return params
+}
+
+// Interceptor replaces a route's handler at registration time
+type Interceptor func(route Route, h http.Handler) http.Handler
+
+// routeTable is shared by a router and all groups derived from it
+type routeTable struct {
+	mu        sync.Mutex
+	mux       *http.ServeMux
+	routes    []Route
+	intercept Interceptor
+}
+
+// Router registers method+pattern routes on a single http.ServeMux. Path
+// parameters are available to handlers through r.PathValue.
+type Router struct {
+	table      *routeTable
+	middleware []Middleware
+}
+
+// New creates an empty router
+func New() *Router {
+	return &Router{table: &routeTable{mux: http.NewServeMux()}}
+}
+
+// With returns a group that applies mw to every route registered through it,
+// after any middleware of the parent group
+func (rt *Router) With(mw ...Middleware) *Router {
+	combined := make([]Middleware, 0, len(rt.middleware)+len(mw))
+	combined = append(combined, rt.middleware...)
+	combined = append(combined, mw...)
+	return &Router{table: rt.table, middleware: combined}
+}
+
+// Handle registers a handler for a pattern such as "GET /api/v1/meetings/{id}".
+// Route-specific middleware runs inside the group middleware.
+func (rt *Router) Handle(pattern string, h http.Handler, mw ...Middleware) {
+	route := parsePattern(pattern)
+
+	h = Chain(h, mw...)
+	h = Chain(h, rt.middleware...)
+
+	rt.table.mu.Lock()
+	defer rt.table.mu.Unlock()
+	if rt.table.intercept != nil {
+		h = rt.table.intercept(route, h)
+	}
+	rt.table.mux.Handle(pattern, h)
+	rt.table.routes = append(rt.table.routes, route)
+}
+
+// HandleFunc registers a handler function for a pattern
+func (rt *Router) HandleFunc(pattern string, h http.HandlerFunc, mw ...Middleware) {
+	rt.Handle(pattern, h, mw...)
+}
+
+// Intercept installs a function that may replace handlers as routes are
+// registered. Route table tests use it to substitute probes for handlers
+// whose dependencies are not available.
+func (rt *Router) Intercept(fn Interceptor) {
+	rt.table.mu.Lock()
+	rt.table.intercept = fn
+	rt.table.mu.Unlock()
+}
+
+// Routes returns the registered routes sorted by path and method
+func (rt *Router) Routes() []Route {
+	rt.table.mu.Lock()
+	routes := make([]Route, len(rt.table.routes))
+	copy(routes, rt.table.routes)
+	rt.table.mu.Unlock()
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// ServeHTTP dispatches the request to the matching route
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.table.mux.ServeHTTP(w, r)
+}
+
+// parsePattern splits "METHOD /path" patterns into a route
+func parsePattern(pattern string) Route {
+	route := Route{Pattern: pattern, Path: pattern}
+	if method, path, ok := strings.Cut(pattern, " "); ok {
+		route.Method = method
+		route.Path = strings.TrimSpace(path)
+	}
+	return route
+}
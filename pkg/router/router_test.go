@@ -0,0 +1,83 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// tag returns middleware that appends name to the X-Trace header
+func tag(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Trace", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TestMiddlewareOrder tests that group middleware wraps route middleware
+func TestMiddlewareOrder(t *testing.T) {
+	rt := New()
+	api := rt.With(tag("auth"))
+	admin := api.With(tag("role"))
+	admin.HandleFunc("GET /admin/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Trace", "handler")
+	}, tag("route"))
+
+	rec := httptest.NewRecorder()
+	rt.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/1", nil))
+
+	got := strings.Join(rec.Header().Values("X-Trace"), ",")
+	if got != "auth,role,route,handler" {
+		t.Fatalf("Expected auth,role,route,handler, got %s", got)
+	}
+
+	t.Log("✓ Middleware applied outermost first")
+}
+
+// TestPathParams tests that handlers receive path parameters by name
+func TestPathParams(t *testing.T) {
+	rt := New()
+	var got string
+	rt.HandleFunc("POST /submissions/{submissionId}/grade", func(w http.ResponseWriter, r *http.Request) {
+		got = r.PathValue("submissionId")
+	})
+
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/submissions/sub-42/grade", nil))
+	if got != "sub-42" {
+		t.Fatalf("Expected submissionId sub-42, got %q", got)
+	}
+
+	t.Log("✓ Path parameters passed to handlers")
+}
+
+// TestRoutes tests route parsing and the sorted route table
+func TestRoutes(t *testing.T) {
+	rt := New()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	rt.HandleFunc("POST /b/{id}", noop)
+	rt.HandleFunc("GET /b/{id}", noop)
+	rt.HandleFunc("/a/", noop)
+
+	routes := rt.Routes()
+	expected := []Route{
+		{Method: "", Path: "/a/", Pattern: "/a/"},
+		{Method: "GET", Path: "/b/{id}", Pattern: "GET /b/{id}"},
+		{Method: "POST", Path: "/b/{id}", Pattern: "POST /b/{id}"},
+	}
+	if len(routes) != len(expected) {
+		t.Fatalf("Expected %d routes, got %d", len(expected), len(routes))
+	}
+	for i, route := range routes {
+		if route != expected[i] {
+			t.Fatalf("Route %d: expected %+v, got %+v", i, expected[i], route)
+		}
+	}
+	if params := routes[1].Params(); len(params) != 1 || params[0] != "id" {
+		t.Fatalf("Expected params [id], got %v", params)
+	}
+
+	t.Log("✓ Routes parsed and sorted")
+}
@@ -0,0 +1,365 @@
+package signalling
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/cache"
+)
+
+// Adapter shares rooms between signalling servers running as replicas
+// behind a load balancer, so that participants of one class connected to
+// different replicas see and reach each other. Each replica is a node.
+type Adapter interface {
+	RoomStates
+
+	// Publish sends a message to every node subscribed, the sender included
+	Publish(ctx context.Context, msg ClusterMessage) error
+	// Subscribe calls handler with each published message until ctx is
+	// done. It returns once messages are being received.
+	Subscribe(ctx context.Context, handler func(ClusterMessage)) error
+
+	// AddMember records a participant of a room connected to a node
+	AddMember(ctx context.Context, roomID string, member Member) error
+	// RemoveMember forgets a connection's membership of a room
+	RemoveMember(ctx context.Context, roomID, socketID string) error
+	// Members returns the members of a room recorded by every node
+	Members(ctx context.Context, roomID string) ([]Member, error)
+
+	// Heartbeat marks a node live for ttl
+	Heartbeat(ctx context.Context, node string, ttl time.Duration) error
+	// RemoveNode marks a node gone before its heartbeat runs out
+	RemoveNode(ctx context.Context, node string) error
+	// Nodes returns the live nodes
+	Nodes(ctx context.Context) ([]string, error)
+}
+
+// ClusterMessage is a Socket.IO event broadcast by one node for the
+// connections of the other nodes, or a command for the node holding a
+// connection
+type ClusterMessage struct {
+	Node  string          `json:"node"` // sender
+	Room  string          `json:"room"` // Socket.IO room, or a connection ID
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+	To    string          `json:"to,omitempty"` // node a command is for
+}
+
+// Member is a participant of a room and the node it is connected to
+type Member struct {
+	Node        string      `json:"node"`
+	Participant Participant `json:"participant"`
+}
+
+// MemoryAdapter shares rooms between signalling servers in one process.
+// Messages are delivered synchronously. It stands in for RedisAdapter in
+// tests and single-process setups.
+type MemoryAdapter struct {
+	mu       sync.Mutex
+	handlers map[int]func(ClusterMessage)
+	nextID   int
+	members  map[string]map[string]Member // room ID -> socket ID -> member
+	nodes    map[string]time.Time         // node -> heartbeat expiry
+	states   map[string][]byte            // room ID -> encoded state
+}
+
+// NewMemoryAdapter creates an in-memory adapter
+func NewMemoryAdapter() *MemoryAdapter {
+	return &MemoryAdapter{
+		handlers: make(map[int]func(ClusterMessage)),
+		members:  make(map[string]map[string]Member),
+		nodes:    make(map[string]time.Time),
+		states:   make(map[string][]byte),
+	}
+}
+
+// Publish calls the subscribed handlers with msg
+func (m *MemoryAdapter) Publish(ctx context.Context, msg ClusterMessage) error {
+	m.mu.Lock()
+	handlers := make([]func(ClusterMessage), 0, len(m.handlers))
+	for _, handler := range m.handlers {
+		handlers = append(handlers, handler)
+	}
+	m.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(msg)
+	}
+	return nil
+}
+
+// Subscribe registers handler until ctx is done
+func (m *MemoryAdapter) Subscribe(ctx context.Context, handler func(ClusterMessage)) error {
+	m.mu.Lock()
+	id := m.nextID
+	m.nextID++
+	m.handlers[id] = handler
+	m.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		delete(m.handlers, id)
+		m.mu.Unlock()
+	}()
+	return nil
+}
+
+// AddMember records a member of a room
+func (m *MemoryAdapter) AddMember(ctx context.Context, roomID string, member Member) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.members[roomID] == nil {
+		m.members[roomID] = make(map[string]Member)
+	}
+	m.members[roomID][member.Participant.SocketID] = member
+	return nil
+}
+
+// RemoveMember forgets a member of a room
+func (m *MemoryAdapter) RemoveMember(ctx context.Context, roomID, socketID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.members[roomID], socketID)
+	if len(m.members[roomID]) == 0 {
+		delete(m.members, roomID)
+	}
+	return nil
+}
+
+// Members returns the members of a room
+func (m *MemoryAdapter) Members(ctx context.Context, roomID string) ([]Member, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	members := make([]Member, 0, len(m.members[roomID]))
+	for _, member := range m.members[roomID] {
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// Heartbeat marks a node live for ttl
+func (m *MemoryAdapter) Heartbeat(ctx context.Context, node string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nodes[node] = time.Now().Add(ttl)
+	return nil
+}
+
+// RemoveNode forgets a node
+func (m *MemoryAdapter) RemoveNode(ctx context.Context, node string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.nodes, node)
+	return nil
+}
+
+// Nodes returns the nodes whose heartbeat has not run out
+func (m *MemoryAdapter) Nodes(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	nodes := make([]string, 0, len(m.nodes))
+	for node, expiry := range m.nodes {
+		if expiry.After(now) {
+			nodes = append(nodes, node)
+		} else {
+			delete(m.nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+// RoomState decodes a copy of a room's state, so callers share nothing
+// with the stored state, as with Redis
+func (m *MemoryAdapter) RoomState(ctx context.Context, roomID string) (*RoomState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return decodeState(m.states[roomID])
+}
+
+// UpdateRoomState changes a room's state under the adapter's lock
+func (m *MemoryAdapter) UpdateRoomState(ctx context.Context, roomID string, update func(*RoomState) error) (*RoomState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, err := decodeState(m.states[roomID])
+	if err != nil {
+		return nil, err
+	}
+	if err := update(state); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	m.states[roomID] = data
+	return decodeState(data)
+}
+
+// DeleteRoomState forgets a room's state
+func (m *MemoryAdapter) DeleteRoomState(ctx context.Context, roomID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.states, roomID)
+	return nil
+}
+
+// decodeState decodes a stored room state, empty if none is stored
+func decodeState(data []byte) (*RoomState, error) {
+	state := &RoomState{}
+	if len(data) == 0 {
+		return state, nil
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Redis keys and channel of the Redis adapter
+const (
+	redisSignallingChannel = "signalling:events"
+	redisSignallingNodes   = "signalling:nodes"
+)
+
+// RedisAdapter shares rooms between signalling servers through Redis:
+// messages over pub/sub, members and node heartbeats in hashes, and room
+// states in keys changed in transactions. Members of nodes that stop
+// without leaving are ignored once their heartbeat runs out; room hashes
+// expire a day after their last join and room states a day after their
+// last change.
+type RedisAdapter struct {
+	cache *cache.RedisCache
+}
+
+// NewRedisAdapter creates a Redis adapter
+func NewRedisAdapter(c *cache.RedisCache) *RedisAdapter {
+	return &RedisAdapter{cache: c}
+}
+
+// Publish publishes msg on the signalling channel
+func (a *RedisAdapter) Publish(ctx context.Context, msg ClusterMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return a.cache.Publish(ctx, redisSignallingChannel, data)
+}
+
+// Subscribe subscribes handler to the signalling channel until ctx is done
+func (a *RedisAdapter) Subscribe(ctx context.Context, handler func(ClusterMessage)) error {
+	return a.cache.Subscribe(ctx, redisSignallingChannel, func(payload string) {
+		var msg ClusterMessage
+		if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+			return
+		}
+		handler(msg)
+	})
+}
+
+// AddMember stores a member in the room's hash
+func (a *RedisAdapter) AddMember(ctx context.Context, roomID string, member Member) error {
+	data, err := json.Marshal(member)
+	if err != nil {
+		return err
+	}
+	key := cache.CacheKey{}.SignallingRoom(roomID)
+	if err := a.cache.HSet(ctx, key, member.Participant.SocketID, data); err != nil {
+		return err
+	}
+	return a.cache.Expire(ctx, key, cache.ExpirationDay)
+}
+
+// RemoveMember removes a member from the room's hash
+func (a *RedisAdapter) RemoveMember(ctx context.Context, roomID, socketID string) error {
+	return a.cache.HDel(ctx, cache.CacheKey{}.SignallingRoom(roomID), socketID)
+}
+
+// Members returns the members in the room's hash
+func (a *RedisAdapter) Members(ctx context.Context, roomID string) ([]Member, error) {
+	fields, err := a.cache.HGetAll(ctx, cache.CacheKey{}.SignallingRoom(roomID))
+	if err != nil {
+		return nil, err
+	}
+	members := make([]Member, 0, len(fields))
+	for _, value := range fields {
+		var member Member
+		if err := json.Unmarshal([]byte(value), &member); err != nil {
+			continue
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// Heartbeat stores the node's heartbeat expiry in the nodes hash
+func (a *RedisAdapter) Heartbeat(ctx context.Context, node string, ttl time.Duration) error {
+	return a.cache.HSet(ctx, redisSignallingNodes, node, time.Now().Add(ttl).UnixMilli())
+}
+
+// RemoveNode removes the node from the nodes hash
+func (a *RedisAdapter) RemoveNode(ctx context.Context, node string) error {
+	return a.cache.HDel(ctx, redisSignallingNodes, node)
+}
+
+// Nodes returns the nodes whose heartbeat has not run out, removing the
+// others from the nodes hash
+func (a *RedisAdapter) Nodes(ctx context.Context) ([]string, error) {
+	fields, err := a.cache.HGetAll(ctx, redisSignallingNodes)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	nodes := make([]string, 0, len(fields))
+	var expired []string
+	for node, value := range fields {
+		if expiry, err := strconv.ParseInt(value, 10, 64); err == nil && expiry > now {
+			nodes = append(nodes, node)
+		} else {
+			expired = append(expired, node)
+		}
+	}
+	if len(expired) > 0 {
+		_ = a.cache.HDel(ctx, redisSignallingNodes, expired...)
+	}
+	return nodes, nil
+}
+
+// RoomState loads a room's state from its key
+func (a *RedisAdapter) RoomState(ctx context.Context, roomID string) (*RoomState, error) {
+	data, err := a.cache.Get(ctx, cache.CacheKey{}.SignallingRoomState(roomID))
+	if err != nil {
+		return nil, err
+	}
+	return decodeState([]byte(data))
+}
+
+// UpdateRoomState changes a room's state in a transaction watching its
+// key, running update again if another node changes it meanwhile
+func (a *RedisAdapter) UpdateRoomState(ctx context.Context, roomID string, update func(*RoomState) error) (*RoomState, error) {
+	var state *RoomState
+	err := a.cache.Update(ctx, cache.CacheKey{}.SignallingRoomState(roomID), cache.ExpirationDay, func(current string) (string, error) {
+		var err error
+		if state, err = decodeState([]byte(current)); err != nil {
+			return "", err
+		}
+		if err := update(state); err != nil {
+			return "", err
+		}
+		data, err := json.Marshal(state)
+		return string(data), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// DeleteRoomState deletes a room's state key
+func (a *RedisAdapter) DeleteRoomState(ctx context.Context, roomID string) error {
+	return a.cache.Delete(ctx, cache.CacheKey{}.SignallingRoomState(roomID))
+}
@@ -4,11 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 
 	"github.com/Bashar444/VTP/pkg/auth"
 	"github.com/Bashar444/VTP/pkg/g5"
+	"github.com/Bashar444/VTP/pkg/router"
 )
 
 // APIHandler provides HTTP endpoints for signalling management
@@ -26,6 +27,27 @@ func NewAPIHandler(ss *SignallingServer, am *auth.AuthMiddleware) *APIHandler {
 	}
 }
 
+// RegisterRoutes registers the signalling management and streaming room
+// routes. The health check is public; everything else requires
+// authentication, and creating or deleting rooms requires a teacher or admin.
+func (h *APIHandler) RegisterRoutes(rt *router.Router) {
+	am := h.AuthMiddleware
+	api := rt.With(am.Middleware)
+	staff := api.With(am.RoleMiddleware(string(auth.RoleTeacher), string(auth.RoleAdmin)))
+
+	rt.HandleFunc("GET /api/v1/signalling/health", h.HealthHandler)
+	api.HandleFunc("GET /api/v1/signalling/room/stats", h.GetRoomStatsHandler)
+	api.HandleFunc("GET /api/v1/signalling/rooms/stats", h.GetAllRoomStatsHandler)
+	staff.HandleFunc("POST /api/v1/signalling/room/create", h.CreateRoomHandler)
+	staff.HandleFunc("DELETE /api/v1/signalling/room/delete", h.DeleteRoomHandler)
+
+	// Streaming helpers used by the frontend
+	api.HandleFunc("GET /api/v1/streaming/rooms/{roomId}/participants", h.GetParticipantsHandler)
+	api.HandleFunc("POST /api/v1/streaming/rooms/{roomId}/record", h.StartRoomRecordingHandler)
+	api.HandleFunc("POST /api/v1/streaming/sessions/{sessionId}/stop-record", h.StopSessionRecordingHandler)
+	api.HandleFunc("POST /api/v1/streaming/sessions/{sessionId}/metrics", h.SessionMetricsHandler)
+}
+
 // GetRoomStatsHandler returns statistics for a specific room
 func (h *APIHandler) GetRoomStatsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -52,7 +74,7 @@ func (h *APIHandler) GetRoomStatsHandler(w http.ResponseWriter, r *http.Request)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
-	log.Printf("✓ Room stats retrieved: %s", roomID)
+	slog.DebugContext(r.Context(), "Room stats retrieved", "room_id", roomID)
 }
 
 // GetAllRoomStatsHandler returns statistics for all rooms
@@ -69,7 +91,7 @@ func (h *APIHandler) GetAllRoomStatsHandler(w http.ResponseWriter, r *http.Reque
 		"rooms": stats,
 		"count": len(stats),
 	})
-	log.Printf("✓ All room stats retrieved (%d rooms)", len(stats))
+	slog.DebugContext(r.Context(), "All room stats retrieved", "rooms", len(stats))
 }
 
 // HealthHandler returns health status of signalling service
@@ -151,6 +173,44 @@ func (h *APIHandler) DeleteRoomHandler(w http.ResponseWriter, r *http.Request) {
 	}`, roomID)
 }
 
+// GetParticipantsHandler returns the participants in a room
+func (h *APIHandler) GetParticipantsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	room, ok := h.SignallingServer.RoomManager.GetRoom(r.PathValue("roomId"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error":"room not found"}`)
+		return
+	}
+
+	json.NewEncoder(w).Encode(room.GetAllParticipants())
+}
+
+// StartRoomRecordingHandler starts recording a room.
+// Stubs a session ID; real integration can hook the recording service.
+func (h *APIHandler) StartRoomRecordingHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sessionId": fmt.Sprintf("rec-%s", r.PathValue("roomId")),
+		"status":    "started",
+	})
+}
+
+// StopSessionRecordingHandler stops a recording session started for a room
+func (h *APIHandler) StopSessionRecordingHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sessionId": r.PathValue("sessionId"),
+		"status":    "stopped",
+	})
+}
+
+// SessionMetricsHandler accepts client-side streaming metrics
+func (h *APIHandler) SessionMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // getCurrentTime returns current unix timestamp in milliseconds
 func getCurrentTime() int64 {
 	return int64(1000) // placeholder - would use time.Now().UnixMilli()
@@ -189,7 +249,7 @@ func (h *APIHandler) GetNetworkStatusHandler(w http.ResponseWriter, r *http.Requ
 		"quality_score":   h.G5Adapter.GetNetworkQuality(),
 		"timestamp":       getCurrentTime(),
 	})
-	log.Printf("✓ Network status retrieved")
+	slog.DebugContext(r.Context(), "Network status retrieved")
 }
 
 // GetNetworkMetricsHandler returns current network metrics
@@ -222,7 +282,7 @@ func (h *APIHandler) GetNetworkMetricsHandler(w http.ResponseWriter, r *http.Req
 		"total_bytes_transferred": metrics.TotalBytesTransfer,
 		"timestamp":               getCurrentTime(),
 	})
-	log.Printf("✓ Network metrics retrieved")
+	slog.DebugContext(r.Context(), "Network metrics retrieved")
 }
 
 // DetectNetworkHandler triggers network detection
@@ -259,7 +319,7 @@ func (h *APIHandler) DetectNetworkHandler(w http.ResponseWriter, r *http.Request
 		"signal_strength": network.SignalStrength,
 		"detected_at":     network.Timestamp,
 	})
-	log.Printf("✓ Network detection completed: %v", network.NetworkType)
+	slog.InfoContext(r.Context(), "Network detection completed", "network_type", network.NetworkType)
 }
 
 // GetEdgeNodesHandler returns available edge nodes
@@ -310,7 +370,7 @@ func (h *APIHandler) GetEdgeNodesHandler(w http.ResponseWriter, r *http.Request)
 		"nodes": response,
 		"count": len(response),
 	})
-	log.Printf("✓ Edge nodes retrieved: %d available", len(response))
+	slog.DebugContext(r.Context(), "Edge nodes retrieved", "available", len(response))
 }
 
 // ConnectToEdgeHandler initiates connection to an edge node
@@ -376,7 +436,7 @@ func (h *APIHandler) ConnectToEdgeHandler(w http.ResponseWriter, r *http.Request
 		"current_quality": status.CurrentQuality,
 		"message":         "Connected to edge node",
 	})
-	log.Printf("✓ Session started: %s on edge node", req.SessionID)
+	slog.InfoContext(r.Context(), "Session started on edge node", "session_id", req.SessionID)
 }
 
 // GetSessionMetricsHandler returns metrics for current session
@@ -416,7 +476,7 @@ func (h *APIHandler) GetSessionMetricsHandler(w http.ResponseWriter, r *http.Req
 		"bytes_received":     metrics.BytesReceived,
 		"sample_count":       metrics.SampleCount,
 	})
-	log.Printf("✓ Session metrics retrieved: %s", metrics.SessionID)
+	slog.DebugContext(r.Context(), "Session metrics retrieved", "session_id", metrics.SessionID)
 }
 
 // AdaptQualityHandler triggers quality adaptation
@@ -448,7 +508,7 @@ func (h *APIHandler) AdaptQualityHandler(w http.ResponseWriter, r *http.Request)
 		"new_quality": quality,
 		"adapted_at":  getCurrentTime(),
 	})
-	log.Printf("✓ Quality adapted to: %s", quality)
+	slog.InfoContext(r.Context(), "Quality adapted", "quality", quality)
 }
 
 // GetAdapterStatusHandler returns full adapter status
@@ -478,5 +538,5 @@ func (h *APIHandler) GetAdapterStatusHandler(w http.ResponseWriter, r *http.Requ
 		"edge_manager_status":   status.EdgeManagerStatus,
 		"last_update":           getCurrentTime(),
 	})
-	log.Printf("✓ Adapter status retrieved")
+	slog.DebugContext(r.Context(), "Adapter status retrieved")
 }
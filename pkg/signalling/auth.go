@@ -0,0 +1,127 @@
+package signalling
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Bashar444/VTP/pkg/auth"
+	socketio "github.com/googollee/go-socket.io"
+)
+
+var (
+	errUnauthenticated = errors.New("a valid access token is required")
+	errNotCourseMember = errors.New("you are not a member of this class's course")
+	errAccessCheck     = errors.New("could not check your access to this room")
+)
+
+// RoomAuthorizer resolves a user's course role in the meeting held in a
+// live session room. ok is false when the room holds no meeting, and role
+// is "" when the user has no role in the meeting's course.
+type RoomAuthorizer interface {
+	RoomRole(ctx context.Context, roomID, userID, globalRole string) (role string, ok bool, err error)
+}
+
+// identity is who a connection authenticated as in its handshake
+type identity struct {
+	UserID string
+	Email  string
+	Role   string
+}
+
+// WithAuth requires every connection to present an access token in its
+// handshake, as a token query parameter or a bearer Authorization header.
+// Joins then take the user from the token and the role from the course of
+// the meeting held in the room, ignoring what the client claims. Without
+// it the user and role of a join request are trusted as sent.
+func (ss *SignallingServer) WithAuth(tokens *auth.TokenService, rooms RoomAuthorizer) *SignallingServer {
+	ss.tokens = tokens
+	ss.rooms = rooms
+	return ss
+}
+
+// authenticate validates the access token of a connection's handshake and
+// returns the connection context carrying the user
+func (ss *SignallingServer) authenticate(ctx context.Context, s socketio.Conn) (context.Context, error) {
+	if ss.tokens == nil {
+		return ctx, nil
+	}
+
+	u := s.URL()
+	token := u.Query().Get("token")
+	if token == "" {
+		token, _ = strings.CutPrefix(s.RemoteHeader().Get("Authorization"), "Bearer ")
+	}
+	if token == "" {
+		return ctx, errUnauthenticated
+	}
+	claims, err := ss.tokens.ValidateToken(strings.TrimSpace(token))
+	if err != nil {
+		return ctx, errUnauthenticated
+	}
+
+	ctx = context.WithValue(ctx, "user_id", claims.UserID)
+	ctx = context.WithValue(ctx, "user_email", claims.Email)
+	return context.WithValue(ctx, "user_role", claims.Role), nil
+}
+
+// connIdentity returns the user a connection authenticated as, or nil if
+// the server does not authenticate connections
+func connIdentity(s socketio.Conn) *identity {
+	ctx, ok := s.Context().(context.Context)
+	if !ok {
+		return nil
+	}
+	userID, _ := ctx.Value("user_id").(string)
+	if userID == "" {
+		return nil
+	}
+	email, _ := ctx.Value("user_email").(string)
+	role, _ := ctx.Value("user_role").(string)
+	return &identity{UserID: userID, Email: email, Role: role}
+}
+
+// authorizeJoin replaces the user and role of a join request with those
+// of the connection's token and the course of the room's meeting. Rooms
+// that hold no meeting keep the token's global role.
+func (ss *SignallingServer) authorizeJoin(ctx context.Context, s socketio.Conn, req *JoinRoomRequest) error {
+	if ss.tokens == nil {
+		return nil
+	}
+	id := connIdentity(s)
+	if id == nil {
+		return errUnauthenticated
+	}
+	req.UserID, req.Email, req.Role = id.UserID, id.Email, id.Role
+
+	if ss.rooms == nil {
+		return nil
+	}
+	courseRole, ok, err := ss.rooms.RoomRole(ctx, ss.RoomManager.RootID(req.RoomID), id.UserID, id.Role)
+	if err != nil {
+		return errAccessCheck
+	}
+	if !ok {
+		return nil
+	}
+	if req.Role = roomRole(courseRole); req.Role == "" {
+		return errNotCourseMember
+	}
+	return nil
+}
+
+// roomRole maps a course role onto the roles of a live session room:
+// instructors and TAs teach, students and viewers attend
+func roomRole(courseRole string) string {
+	switch courseRole {
+	case "admin":
+		return "admin"
+	case "instructor", "ta":
+		return "teacher"
+	case "student":
+		return "student"
+	case "viewer":
+		return "viewer"
+	}
+	return ""
+}
@@ -0,0 +1,540 @@
+package signalling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"time"
+
+	socketio "github.com/googollee/go-socket.io"
+)
+
+var (
+	errBreakoutsOpen      = errors.New("breakout rooms are already open")
+	errNoBreakouts        = errors.New("no breakout rooms are open")
+	errInvalidBreakouts   = errors.New("between 1 and 50 breakout rooms can be created")
+	errNestedBreakout     = errors.New("breakout rooms cannot have breakout rooms")
+	errNotABreakout       = errors.New("room is not a breakout room of this room")
+	errEmptyMessage       = errors.New("message is empty")
+	errInvalidCountdown   = errors.New("countdown must be between 0 and 600 seconds")
+	errMissingParticipant = errors.New("user_id is required")
+)
+
+const (
+	maxBreakouts             = 50
+	defaultBreakoutCountdown = 60 * time.Second
+	maxBreakoutCountdown     = 10 * time.Minute
+)
+
+// registerBreakoutHandlers sets up the breakout room events. Teachers in
+// the main room or any of its breakout rooms manage them; everyone is told
+// when they are moved, when a teacher broadcasts and when the rooms close.
+func (ss *SignallingServer) registerBreakoutHandlers() {
+	ss.IO.OnEvent("", "create-breakouts", func(s socketio.Conn, payload string) {
+		var req CreateBreakoutsRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		resp, err := ss.CreateBreakouts(connContext(s), s.ID(), req)
+		if err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+			return
+		}
+		s.Emit("breakouts-created", resp)
+	})
+
+	ss.IO.OnEvent("", "move-participant", func(s socketio.Conn, payload string) {
+		var req MoveParticipantRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		if err := ss.MoveParticipant(connContext(s), s.ID(), req); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+		}
+	})
+
+	ss.IO.OnEvent("", "broadcast-breakouts", func(s socketio.Conn, payload string) {
+		var req BreakoutBroadcastRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		if err := ss.BroadcastToBreakouts(s.ID(), req.RoomID, req.Message); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+		}
+	})
+
+	ss.IO.OnEvent("", "close-breakouts", func(s socketio.Conn, payload string) {
+		var req CloseBreakoutsRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		countdown := defaultBreakoutCountdown
+		if req.Countdown != nil {
+			countdown = time.Duration(*req.Countdown) * time.Second
+		}
+		if _, err := ss.CloseBreakouts(s.ID(), req.RoomID, countdown); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+		}
+	})
+
+	ss.IO.OnEvent("", "get-breakouts", func(s socketio.Conn, payload string) {
+		var req GetParticipantsRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		parent, _, err := ss.staffOf(s.ID(), req.RoomID)
+		if err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+			return
+		}
+		s.Emit("breakouts-updated", ss.breakoutsOf(parent))
+	})
+}
+
+// family returns a main room followed by its breakout rooms
+func (ss *SignallingServer) family(parent *Room) []*Room {
+	return append([]*Room{parent}, ss.RoomManager.Breakouts(parent.ID)...)
+}
+
+// familyRoom returns this node's room of a room, or of a breakout room
+// another node opened
+func (ss *SignallingServer) familyRoom(roomID string) (*Room, bool) {
+	if room, exists := ss.RoomManager.GetRoom(roomID); exists {
+		return room, true
+	}
+	parentID := ss.RoomManager.RootID(roomID)
+	if parentID == roomID {
+		return nil, false
+	}
+	state, err := ss.RoomManager.state(parentID)
+	if err != nil {
+		return nil, false
+	}
+	breakout, ok := state.breakout(roomID)
+	if !ok {
+		return nil, false
+	}
+	return ss.RoomManager.AddBreakout(parentID, breakout), true
+}
+
+// staffOf returns the main room of a room, given either, provided the
+// sender is a teacher in it or one of its breakout rooms
+func (ss *SignallingServer) staffOf(socketID, roomID string) (*Room, *Participant, error) {
+	parent, exists := ss.RoomManager.GetRoom(ss.RoomManager.RootID(roomID))
+	if !exists {
+		return nil, nil, errRoomNotFound
+	}
+	for _, room := range ss.RoomManager.Family(parent.ID) {
+		if sender, ok := room.GetParticipant(socketID); ok {
+			if !isStaff(sender.Role) {
+				return nil, nil, errNotStaff
+			}
+			return parent, sender, nil
+		}
+	}
+	return nil, nil, errNotInRoom
+}
+
+// CreateBreakouts opens breakout rooms in a main room, spreading its
+// students evenly across them if asked to
+func (ss *SignallingServer) CreateBreakouts(ctx context.Context, socketID string, req CreateBreakoutsRequest) (*BreakoutsResponse, error) {
+	parent, _, err := ss.staffOf(socketID, req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if parent.ID != req.RoomID {
+		return nil, errNestedBreakout
+	}
+	if req.Count < 1 || req.Count > maxBreakouts {
+		return nil, errInvalidBreakouts
+	}
+
+	opened := make([]BreakoutRoom, req.Count)
+	for i := range opened {
+		opened[i] = BreakoutRoom{ID: breakoutID(parent.ID, i+1), Name: fmt.Sprintf("Breakout %d", i+1)}
+		if i < len(req.Names) && strings.TrimSpace(req.Names[i]) != "" {
+			opened[i].Name = strings.TrimSpace(req.Names[i])
+		}
+	}
+	if _, err := ss.RoomManager.update(parent.ID, func(s *RoomState) error {
+		if len(s.Breakouts) > 0 {
+			return errBreakoutsOpen
+		}
+		s.Breakouts = opened
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	breakouts := ss.RoomManager.Breakouts(parent.ID)
+
+	if req.Random && len(breakouts) > 0 {
+		students := ss.studentIDs(parent)
+		rand.Shuffle(len(students), func(i, j int) {
+			students[i], students[j] = students[j], students[i]
+		})
+		for i, userID := range students {
+			if err := ss.moveUser(ctx, parent, userID, breakouts[i%len(breakouts)]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	resp := ss.breakoutsOf(parent)
+	ss.broadcastBreakouts(parent, resp)
+	return resp, nil
+}
+
+// MoveParticipant moves every connection of a user to one of the main
+// room's breakout rooms or back to the main room. Users who are not
+// connected yet are sent to their breakout room when they join.
+func (ss *SignallingServer) MoveParticipant(ctx context.Context, socketID string, req MoveParticipantRequest) error {
+	parent, _, err := ss.staffOf(socketID, req.RoomID)
+	if err != nil {
+		return err
+	}
+	if req.UserID == "" {
+		return errMissingParticipant
+	}
+	to, exists := ss.familyRoom(req.ToRoomID)
+	if !exists || (to != parent && to.ParentID != parent.ID) {
+		return errNotABreakout
+	}
+
+	if err := ss.moveUser(ctx, parent, req.UserID, to); err != nil {
+		return err
+	}
+	ss.broadcastBreakouts(parent, ss.breakoutsOf(parent))
+	return nil
+}
+
+// moveUser has the nodes of a user's connections within a room family
+// move them, and remembers the user's breakout room for when they
+// reconnect
+func (ss *SignallingServer) moveUser(ctx context.Context, parent *Room, userID string, to *Room) error {
+	if _, err := ss.RoomManager.update(parent.ID, func(s *RoomState) error {
+		if to == parent {
+			delete(s.Assignments, userID)
+			return nil
+		}
+		if s.Assignments == nil {
+			s.Assignments = make(map[string]string)
+		}
+		s.Assignments[userID] = to.ID
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, from := range ss.family(parent) {
+		if from == to {
+			continue
+		}
+		for _, p := range ss.participants(from) {
+			if p.UserID == userID {
+				ss.onNode(ctx, commandMove, nodeCommand{RoomID: from.ID, SocketID: p.SocketID, ToRoomID: to.ID})
+			}
+		}
+	}
+	return nil
+}
+
+// moveConnection moves a connection of this node between rooms of a
+// family, in the signalling room, Socket.IO and Mediasoup alike. Its
+// presence is not reported, as the user stays in the meeting.
+func (ss *SignallingServer) moveConnection(ctx context.Context, socketID string, from, to *Room) {
+	p := from.RemoveParticipant(socketID)
+	if p == nil {
+		return
+	}
+	ss.forgetConnection(from, p, socketID)
+	moved := to.AddParticipant(socketID, p.UserID, p.Email, p.FullName, p.Role, p.IsProducer)
+	ss.removeMember(ctx, from.ID, socketID)
+	ss.addMember(ctx, to.ID, moved)
+
+	var mediasoupResp *MediasoupJoinResponse
+	if ss.Mediasoup != nil {
+		if err := ss.Mediasoup.OnLeaveRoom(ctx, from.ID, socketID); err != nil {
+			slog.WarnContext(ctx, "Mediasoup leave failed", "room_id", from.ID, "error", err)
+		}
+		resp, err := ss.Mediasoup.OnJoinRoom(ctx, to.ID, socketID, p.UserID, p.Email, p.FullName, p.Role, p.IsProducer)
+		if err != nil {
+			slog.WarnContext(ctx, "Mediasoup join failed", "room_id", to.ID, "error", err)
+		} else {
+			mediasoupResp = &MediasoupJoinResponse{
+				RtpCapabilities: resp.RtpCapabilities,
+				Peers:           convertMediasoupPeers(resp.Peers),
+			}
+		}
+	}
+
+	if conn := ss.findConn(socketID); conn != nil {
+		conn.Leave(from.ID)
+		conn.Leave(staffRoom(from.ID))
+		conn.Join(to.ID)
+		if isStaff(p.Role) {
+			conn.Join(staffRoom(to.ID))
+		}
+		conn.Emit("moved-to-room", JoinRoomResponse{
+			Success:       true,
+			RoomID:        to.ID,
+			ParticipantID: socketID,
+			Participants:  ss.participants(to),
+			Mediasoup:     mediasoupResp,
+		})
+	}
+
+	slog.InfoContext(ctx, "Participant moved", "from_room_id", from.ID, "to_room_id", to.ID, "participant_user_id", p.UserID)
+
+	// This node's breakout rooms are made again from the state when needed
+	if from.ParentID != "" && from.IsEmpty() {
+		ss.RoomManager.DeleteRoom(from.ID)
+	}
+}
+
+// assignedBreakout returns the breakout room a user was assigned to in a
+// main room, if it is still open
+func (ss *SignallingServer) assignedBreakout(roomID, userID string) (*Room, bool) {
+	state, err := ss.RoomManager.state(roomID)
+	if err != nil {
+		return nil, false
+	}
+	breakoutID, assigned := state.Assignments[userID]
+	if !assigned {
+		return nil, false
+	}
+	breakout, ok := state.breakout(breakoutID)
+	if !ok {
+		return nil, false
+	}
+	return ss.RoomManager.AddBreakout(roomID, breakout), true
+}
+
+// studentIDs returns the distinct students of a room on every node, sorted
+func (ss *SignallingServer) studentIDs(room *Room) []string {
+	seen := make(map[string]bool)
+	var students []string
+	for _, p := range ss.participants(room) {
+		if !isStaff(p.Role) && !seen[p.UserID] {
+			seen[p.UserID] = true
+			students = append(students, p.UserID)
+		}
+	}
+	sort.Strings(students)
+	return students
+}
+
+// BroadcastToBreakouts sends a teacher's message to the main room and all
+// its breakout rooms
+func (ss *SignallingServer) BroadcastToBreakouts(socketID, roomID, message string) error {
+	parent, sender, err := ss.staffOf(socketID, roomID)
+	if err != nil {
+		return err
+	}
+	if message = strings.TrimSpace(message); message == "" {
+		return errEmptyMessage
+	}
+	family := ss.family(parent)
+	if len(family) == 1 {
+		return errNoBreakouts
+	}
+
+	msg := BreakoutMessage{
+		RoomID:   parent.ID,
+		UserID:   sender.UserID,
+		FullName: sender.FullName,
+		Message:  message,
+		At:       time.Now(),
+	}
+	for _, room := range family {
+		ss.broadcast(room.ID, "breakout-message", msg)
+	}
+	return nil
+}
+
+// CloseBreakouts brings everyone back to the main room once a countdown
+// ends, or at once for a zero countdown. Closing again restarts the
+// countdown. The countdown runs on this node; a countdown restarted on
+// another node replaces it.
+func (ss *SignallingServer) CloseBreakouts(socketID, roomID string, countdown time.Duration) (time.Time, error) {
+	parent, _, err := ss.staffOf(socketID, roomID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if countdown < 0 || countdown > maxBreakoutCountdown {
+		return time.Time{}, errInvalidCountdown
+	}
+
+	if countdown == 0 {
+		state, err := parent.state()
+		if err != nil {
+			return time.Time{}, err
+		}
+		if len(state.Breakouts) == 0 {
+			return time.Time{}, errNoBreakouts
+		}
+		parent.stopBreakoutTimer()
+		ss.finishBreakouts(parent.ID)
+		return time.Now(), nil
+	}
+
+	closesAt := time.Now().Add(countdown)
+	if _, err := parent.update(func(s *RoomState) error {
+		if len(s.Breakouts) == 0 {
+			return errNoBreakouts
+		}
+		s.BreakoutsCloseAt = closesAt
+		return nil
+	}); err != nil {
+		return time.Time{}, err
+	}
+
+	parent.mu.Lock()
+	if parent.breakoutsTimer != nil {
+		parent.breakoutsTimer.Stop()
+	}
+	parent.breakoutsTimer = time.AfterFunc(countdown, func() {
+		ss.closeBreakoutsAt(parent.ID, closesAt)
+	})
+	parent.mu.Unlock()
+
+	closing := map[string]interface{}{
+		"room_id":   parent.ID,
+		"closes_at": closesAt,
+		"seconds":   int(countdown.Seconds()),
+	}
+	for _, room := range ss.family(parent) {
+		ss.broadcast(room.ID, "breakouts-closing", closing)
+	}
+	return closesAt, nil
+}
+
+// closeBreakoutsAt closes the breakout rooms when a countdown ends,
+// unless the countdown was restarted since
+func (ss *SignallingServer) closeBreakoutsAt(parentID string, closesAt time.Time) {
+	state, err := ss.RoomManager.state(parentID)
+	if err != nil || !state.BreakoutsCloseAt.Equal(closesAt) {
+		return
+	}
+	ss.finishBreakouts(parentID)
+}
+
+// stopBreakoutTimer cancels this node's pending close of the room's
+// breakout rooms
+func (r *Room) stopBreakoutTimer() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.breakoutsTimer != nil {
+		r.breakoutsTimer.Stop()
+		r.breakoutsTimer = nil
+	}
+}
+
+// finishBreakouts moves everyone in the breakout rooms back to the main
+// room, on every node, closes their polls and deletes them
+func (ss *SignallingServer) finishBreakouts(parentID string) {
+	state, err := ss.RoomManager.state(parentID)
+	if err != nil || len(state.Breakouts) == 0 {
+		return
+	}
+	if parent, exists := ss.RoomManager.GetRoom(parentID); exists {
+		parent.stopBreakoutTimer()
+	}
+
+	ctx := context.Background()
+	for _, breakout := range state.Breakouts {
+		for _, p := range ss.participantsOf(breakout.ID) {
+			ss.onNode(ctx, commandMove, nodeCommand{RoomID: breakout.ID, SocketID: p.SocketID, ToRoomID: parentID})
+		}
+		ss.closeAllPolls(breakout.ID)
+		ss.RoomManager.deleteState(breakout.ID)
+	}
+	if err := ss.RoomManager.DeleteBreakouts(parentID); err != nil {
+		return
+	}
+
+	ss.broadcast(parentID, "breakouts-closed", map[string]string{"room_id": parentID})
+	ss.broadcast(staffRoom(parentID), "breakouts-updated", &BreakoutsResponse{RoomID: parentID, Breakouts: []BreakoutInfo{}})
+}
+
+// breakoutsOf describes the breakout rooms of a main room
+func (ss *SignallingServer) breakoutsOf(parent *Room) *BreakoutsResponse {
+	resp := &BreakoutsResponse{RoomID: parent.ID, Breakouts: []BreakoutInfo{}}
+	for _, room := range ss.RoomManager.Breakouts(parent.ID) {
+		resp.Breakouts = append(resp.Breakouts, BreakoutInfo{
+			RoomID:       room.ID,
+			Name:         room.Name,
+			Participants: ss.participants(room),
+		})
+	}
+
+	if state, err := parent.state(); err == nil && !state.BreakoutsCloseAt.IsZero() {
+		closesAt := state.BreakoutsCloseAt
+		resp.ClosesAt = &closesAt
+	}
+	return resp
+}
+
+// broadcastBreakouts sends the breakout rooms to the teachers of the main
+// room and of every breakout room
+func (ss *SignallingServer) broadcastBreakouts(parent *Room, resp *BreakoutsResponse) {
+	for _, room := range ss.family(parent) {
+		ss.broadcast(staffRoom(room.ID), "breakouts-updated", resp)
+	}
+}
+
+// deleteIfAbandoned deletes this node's rooms of a family once they are
+// all empty, and the family's state with them once no node has anyone in
+// them. A main room whose students are all in breakout rooms, or wait in
+// its lobby, stays open.
+func (ss *SignallingServer) deleteIfAbandoned(room *Room) {
+	parentID := ss.RoomManager.RootID(room.ID)
+	family := ss.RoomManager.Family(parentID)
+	for _, r := range family {
+		if !r.IsEmpty() || r.hasPending() {
+			return
+		}
+	}
+	defer func() {
+		for _, r := range family {
+			ss.RoomManager.DeleteRoom(r.ID)
+		}
+	}()
+
+	state, err := ss.RoomManager.state(parentID)
+	if err != nil || len(state.Waiting) > 0 {
+		return
+	}
+	roomIDs := []string{parentID}
+	for _, breakout := range state.Breakouts {
+		roomIDs = append(roomIDs, breakout.ID)
+	}
+	for _, id := range roomIDs {
+		if len(ss.remoteParticipants(id)) > 0 {
+			return
+		}
+	}
+
+	for _, r := range family {
+		r.stopBreakoutTimer()
+	}
+	for _, id := range roomIDs {
+		ss.closeAllPolls(id)
+		ss.RoomManager.deleteState(id)
+	}
+}
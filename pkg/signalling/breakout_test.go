@@ -0,0 +1,144 @@
+package signalling
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestBreakoutRooms tests splitting a class randomly, moving a student,
+// and closing the breakout rooms back into the main room
+func TestBreakoutRooms(t *testing.T) {
+	ss, parent := newInteractionRoom(t)
+	parent.AddParticipant("socket-4", "student-3", "s3@example.com", "Student 3", "student", false)
+	ctx := context.Background()
+
+	if _, err := ss.CreateBreakouts(ctx, "socket-2", CreateBreakoutsRequest{RoomID: "room-1", Count: 2}); err != errNotStaff {
+		t.Errorf("Expected errNotStaff, got %v", err)
+	}
+	resp, err := ss.CreateBreakouts(ctx, "socket-1", CreateBreakoutsRequest{RoomID: "room-1", Count: 2, Names: []string{"Red"}, Random: true})
+	if err != nil {
+		t.Fatalf("Failed to create breakouts: %v", err)
+	}
+	if len(resp.Breakouts) != 2 || resp.Breakouts[0].Name != "Red" || resp.Breakouts[1].Name != "Breakout 2" {
+		t.Fatalf("Unexpected breakouts %+v", resp.Breakouts)
+	}
+	sizes := []int{len(resp.Breakouts[0].Participants), len(resp.Breakouts[1].Participants)}
+	if sizes[0]+sizes[1] != 3 || sizes[0] < 1 || sizes[1] < 1 {
+		t.Errorf("Expected the students spread evenly, got %v", sizes)
+	}
+	if parent.ParticipantCount() != 1 {
+		t.Errorf("Expected only the teacher left in the main room, got %d", parent.ParticipantCount())
+	}
+	if _, err := ss.CreateBreakouts(ctx, "socket-1", CreateBreakoutsRequest{RoomID: "room-1", Count: 2}); err != errBreakoutsOpen {
+		t.Errorf("Expected errBreakoutsOpen, got %v", err)
+	}
+
+	// Move student-1 into the first breakout room
+	first, second := resp.Breakouts[0].RoomID, resp.Breakouts[1].RoomID
+	if err := ss.MoveParticipant(ctx, "socket-1", MoveParticipantRequest{RoomID: "room-1", UserID: "student-1", ToRoomID: first}); err != nil {
+		t.Fatalf("Failed to move participant: %v", err)
+	}
+	firstRoom, _ := ss.RoomManager.GetRoom(first)
+	if !firstRoom.HasUser("student-1") {
+		t.Error("Expected student-1 in the first breakout room")
+	}
+	if err := ss.MoveParticipant(ctx, "socket-1", MoveParticipantRequest{RoomID: "room-1", UserID: "student-1", ToRoomID: "room-9"}); err != errNotABreakout {
+		t.Errorf("Expected errNotABreakout, got %v", err)
+	}
+	if ss.RoomManager.RootID(second) != "room-1" {
+		t.Errorf("Expected breakout rooms rooted in room-1, got %s", ss.RoomManager.RootID(second))
+	}
+
+	// A student reconnecting is sent back to their breakout room
+	if breakout, ok := ss.assignedBreakout("room-1", "student-1"); !ok || breakout.ID != first {
+		t.Errorf("Expected student-1 assigned to %s, got %v", first, breakout)
+	}
+
+	if err := ss.BroadcastToBreakouts("socket-2", "room-1", "Two minutes left"); err != errNotStaff {
+		t.Errorf("Expected errNotStaff, got %v", err)
+	}
+	if err := ss.BroadcastToBreakouts("socket-1", first, "Two minutes left"); err != nil {
+		t.Errorf("Failed to broadcast: %v", err)
+	}
+
+	if _, err := ss.CloseBreakouts("socket-1", "room-1", 0); err != nil {
+		t.Fatalf("Failed to close breakouts: %v", err)
+	}
+	if parent.ParticipantCount() != 4 || len(ss.RoomManager.Breakouts("room-1")) != 0 || ss.RoomManager.RoomExists(first) {
+		t.Errorf("Expected everyone back in the main room, got %d participants", parent.ParticipantCount())
+	}
+	if _, ok := ss.assignedBreakout("room-1", "student-1"); ok {
+		t.Error("Expected assignments cleared")
+	}
+
+	t.Log("✓ Breakout rooms created, moved and closed")
+}
+
+// TestBreakoutCountdown tests that breakout rooms close when the
+// countdown ends
+func TestBreakoutCountdown(t *testing.T) {
+	ss, parent := newInteractionRoom(t)
+	ctx := context.Background()
+
+	if _, err := ss.CreateBreakouts(ctx, "socket-1", CreateBreakoutsRequest{RoomID: "room-1", Count: 1, Random: true}); err != nil {
+		t.Fatalf("Failed to create breakouts: %v", err)
+	}
+	if _, err := ss.CloseBreakouts("socket-1", "room-1", time.Hour); err != errInvalidCountdown {
+		t.Errorf("Expected errInvalidCountdown, got %v", err)
+	}
+	closesAt, err := ss.CloseBreakouts("socket-1", "room-1", 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Failed to close breakouts: %v", err)
+	}
+	if resp := ss.breakoutsOf(parent); resp.ClosesAt == nil || !resp.ClosesAt.Equal(closesAt) {
+		t.Errorf("Expected the closing time listed, got %+v", resp)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(ss.RoomManager.Breakouts("room-1")) > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(ss.RoomManager.Breakouts("room-1")) != 0 || parent.ParticipantCount() != 3 {
+		t.Errorf("Expected the breakout rooms closed after the countdown")
+	}
+
+	t.Log("✓ Breakout rooms closed after the countdown")
+}
+
+// TestBreakoutPresence tests that presence in breakout rooms counts toward
+// the main room, which stays open while its students are in breakouts
+func TestBreakoutPresence(t *testing.T) {
+	ss, parent := newInteractionRoom(t)
+	ctx := context.Background()
+
+	var events []PresenceEvent
+	ss.OnPresence(func(event PresenceEvent) {
+		events = append(events, event)
+	})
+
+	resp, err := ss.CreateBreakouts(ctx, "socket-1", CreateBreakoutsRequest{RoomID: "room-1", Count: 1, Random: true})
+	if err != nil {
+		t.Fatalf("Failed to create breakouts: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected moves not reported as presence, got %+v", events)
+	}
+	breakout, _ := ss.RoomManager.GetRoom(resp.Breakouts[0].RoomID)
+
+	ss.removeParticipant(ctx, parent, "socket-1")
+	if !ss.RoomManager.RoomExists("room-1") {
+		t.Fatal("Expected the main room kept while its breakout room is in use")
+	}
+	ss.removeParticipant(ctx, breakout, "socket-2")
+	if len(events) != 2 || events[1].RoomID != "room-1" || events[1].UserID != "student-1" {
+		t.Errorf("Expected breakout presence reported for room-1, got %+v", events)
+	}
+
+	ss.removeParticipant(ctx, breakout, "socket-3")
+	if ss.RoomManager.RoomExists("room-1") || ss.RoomManager.RoomExists(breakout.ID) {
+		t.Error("Expected the rooms deleted once all are empty")
+	}
+
+	t.Log("✓ Breakout presence counted toward the main room")
+}
@@ -0,0 +1,378 @@
+package signalling
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// nodeHeartbeatInterval is how often a node renews its heartbeat and
+	// refreshes its list of live nodes
+	nodeHeartbeatInterval = 10 * time.Second
+	// nodeTTL is how long a heartbeat keeps a node live
+	nodeTTL = 3 * nodeHeartbeatInterval
+	// stickyWindow is how long a session reaching the wrong node keeps
+	// this node unhealthy
+	stickyWindow = time.Minute
+)
+
+// stickyGuidance tells operators how to fix misrouted sessions
+const stickyGuidance = "Socket.IO sessions must stay on the replica that opened them: " +
+	"route /socket.io/ by client (nginx ip_hash, ingress-nginx upstream-hash-by or cookie affinity)"
+
+// defaultNode names a signalling server: INSTANCE_ID when set, otherwise
+// the host name and process ID, followed by a random suffix so a restarted
+// replica is a new node
+func defaultNode() string {
+	id := os.Getenv("INSTANCE_ID")
+	if id == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			host = "localhost"
+		}
+		id = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	return id + "-" + hex.EncodeToString(suffix)
+}
+
+// sessionIDs generates Socket.IO session IDs prefixed with the node, so
+// they are unique across nodes and show which node holds a session
+type sessionIDs struct {
+	node string
+	last uint64
+}
+
+// NewID returns the next session ID
+func (g *sessionIDs) NewID() string {
+	return g.node + "." + strconv.FormatUint(atomic.AddUint64(&g.last, 1), 36)
+}
+
+// sessionNode returns the node that holds a session
+func sessionNode(sid string) string {
+	if i := strings.LastIndex(sid, "."); i > 0 {
+		return sid[:i]
+	}
+	return ""
+}
+
+// ClusterStatus reports how a signalling server shares its rooms with the
+// other replicas
+type ClusterStatus struct {
+	Node           string `json:"node"`
+	Clustered      bool   `json:"clustered"`       // an adapter shares rooms between nodes
+	Nodes          int    `json:"nodes"`           // live nodes, this one included
+	StickySessions bool   `json:"sticky_sessions"` // no session reached the wrong node lately
+	Misrouted      int64  `json:"misrouted"`       // requests for other nodes' sessions since start
+	Error          string `json:"error,omitempty"`
+	Guidance       string `json:"guidance,omitempty"`
+}
+
+// Healthy reports whether the node can serve its sessions
+func (s ClusterStatus) Healthy() bool {
+	return s.StickySessions && s.Error == ""
+}
+
+// Ready reports whether the node reaches the cluster, so it sees every
+// node's participants. Unlike Healthy it ignores misrouted sessions, which
+// come from the load balancer rather than the node.
+func (s ClusterStatus) Ready() bool {
+	return s.Error == ""
+}
+
+// WithAdapter shares the server's rooms and their state with other
+// replicas through adapter. It must be called before rooms are created.
+// Start subscribes the server to the other nodes.
+func (ss *SignallingServer) WithAdapter(adapter Adapter) *SignallingServer {
+	ss.adapter = adapter
+	ss.RoomManager.states = adapter
+	return ss
+}
+
+// Start joins the cluster: it subscribes to the other nodes' broadcasts
+// and keeps this node's heartbeat. Without an adapter it does nothing.
+func (ss *SignallingServer) Start(ctx context.Context) error {
+	if ss.adapter == nil {
+		return nil
+	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	if err := ss.adapter.Subscribe(runCtx, ss.receive); err != nil {
+		cancel()
+		return err
+	}
+	ss.cancel = cancel
+	ss.heartbeat(ctx)
+
+	ss.wg.Add(1)
+	go func() {
+		defer ss.wg.Done()
+		ticker := time.NewTicker(nodeHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-runCtx.Done():
+				return
+			case <-ticker.C:
+				ss.heartbeat(runCtx)
+			}
+		}
+	}()
+	slog.InfoContext(ctx, "Signalling node joined cluster", "node", ss.Node)
+	return nil
+}
+
+// Stop leaves the cluster, so the other nodes stop counting this node's
+// participants right away
+func (ss *SignallingServer) Stop(ctx context.Context) error {
+	if ss.cancel == nil {
+		return nil
+	}
+	ss.cancel()
+	ss.wg.Wait()
+	return ss.adapter.RemoveNode(ctx, ss.Node)
+}
+
+// heartbeat renews this node's heartbeat and refreshes the live nodes
+func (ss *SignallingServer) heartbeat(ctx context.Context) {
+	err := ss.adapter.Heartbeat(ctx, ss.Node, nodeTTL)
+	var nodes []string
+	if err == nil {
+		nodes, err = ss.adapter.Nodes(ctx)
+	}
+
+	ss.clusterMu.Lock()
+	defer ss.clusterMu.Unlock()
+	ss.clusterErr = err
+	if err != nil {
+		slog.WarnContext(ctx, "Signalling heartbeat failed", "node", ss.Node, "error", err)
+		return
+	}
+	ss.nodes = make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		ss.nodes[node] = true
+	}
+}
+
+// liveNode reports whether a node other than this one was live at the
+// last heartbeat
+func (ss *SignallingServer) liveNode(node string) bool {
+	ss.clusterMu.Lock()
+	defer ss.clusterMu.Unlock()
+	return node != ss.Node && ss.nodes[node]
+}
+
+// broadcast sends an event to a Socket.IO room on this node and, through
+// the adapter, on the other nodes. Every connection is a room of its own,
+// so a connection ID reaches that connection wherever it is connected.
+func (ss *SignallingServer) broadcast(room, event string, data interface{}) {
+	ss.IO.BroadcastToRoom("", room, event, data)
+	if ss.adapter == nil {
+		return
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		slog.Warn("Cluster broadcast not encoded", "event", event, "error", err)
+		return
+	}
+	msg := ClusterMessage{Node: ss.Node, Room: room, Event: event, Data: payload}
+	if err := ss.adapter.Publish(context.Background(), msg); err != nil {
+		slog.Warn("Cluster broadcast failed", "room_id", room, "event", event, "error", err)
+	}
+}
+
+// receive delivers another node's broadcast to this node's connections
+// and runs the commands sent to this node
+func (ss *SignallingServer) receive(msg ClusterMessage) {
+	if msg.Node == ss.Node {
+		return
+	}
+	if msg.To != "" {
+		var cmd nodeCommand
+		if msg.To == ss.Node && json.Unmarshal(msg.Data, &cmd) == nil {
+			ss.runCommand(context.Background(), msg.Event, cmd)
+		}
+		return
+	}
+	ss.IO.BroadcastToRoom("", msg.Room, msg.Event, msg.Data)
+}
+
+// Commands acting on a connection, which only its node can do
+const (
+	commandAdmit  = "admit"
+	commandDeny   = "deny"
+	commandRemove = "remove"
+	commandMove   = "move"
+)
+
+// nodeCommand is an action on a connection of a room
+type nodeCommand struct {
+	RoomID   string `json:"room_id"`
+	SocketID string `json:"socket_id"`
+	ToRoomID string `json:"to_room_id,omitempty"` // for moves
+	Ban      bool   `json:"ban,omitempty"`        // for removals
+}
+
+// onNode runs a command on the node holding its connection: at once on
+// this node, through the adapter on another
+func (ss *SignallingServer) onNode(ctx context.Context, event string, cmd nodeCommand) {
+	node := sessionNode(cmd.SocketID)
+	if ss.adapter == nil || node == "" || node == ss.Node {
+		ss.runCommand(ctx, event, cmd)
+		return
+	}
+
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		slog.WarnContext(ctx, "Cluster command not encoded", "event", event, "error", err)
+		return
+	}
+	msg := ClusterMessage{Node: ss.Node, Event: event, Data: data, To: node}
+	if err := ss.adapter.Publish(ctx, msg); err != nil {
+		slog.WarnContext(ctx, "Cluster command failed", "node", node, "room_id", cmd.RoomID, "event", event, "error", err)
+	}
+}
+
+// runCommand acts on a connection of this node
+func (ss *SignallingServer) runCommand(ctx context.Context, event string, cmd nodeCommand) {
+	room, exists := ss.RoomManager.GetRoom(cmd.RoomID)
+	if !exists {
+		return
+	}
+	switch event {
+	case commandAdmit:
+		ss.admitConnection(room, cmd.SocketID)
+	case commandDeny:
+		ss.denyConnection(room, cmd.SocketID)
+	case commandRemove:
+		ss.removeConnection(ctx, room, cmd.SocketID, cmd.Ban)
+	case commandMove:
+		if to, ok := ss.familyRoom(cmd.ToRoomID); ok {
+			ss.moveConnection(ctx, cmd.SocketID, room, to)
+		}
+	}
+}
+
+// addMember records a participant of a room for the other nodes
+func (ss *SignallingServer) addMember(ctx context.Context, roomID string, p *Participant) {
+	if ss.adapter == nil || p == nil {
+		return
+	}
+	if err := ss.adapter.AddMember(ctx, roomID, Member{Node: ss.Node, Participant: *p}); err != nil {
+		slog.WarnContext(ctx, "Cluster member not recorded", "room_id", roomID, "error", err)
+	}
+}
+
+// removeMember forgets a participant of a room for the other nodes
+func (ss *SignallingServer) removeMember(ctx context.Context, roomID, socketID string) {
+	if ss.adapter == nil {
+		return
+	}
+	if err := ss.adapter.RemoveMember(ctx, roomID, socketID); err != nil {
+		slog.WarnContext(ctx, "Cluster member not removed", "room_id", roomID, "error", err)
+	}
+}
+
+// participants returns the participants of a room on every live node
+func (ss *SignallingServer) participants(room *Room) []*Participant {
+	return append(room.GetAllParticipants(), ss.remoteParticipants(room.ID)...)
+}
+
+// participantsOf returns the participants of a room on every live node,
+// whether or not this node has the room
+func (ss *SignallingServer) participantsOf(roomID string) []*Participant {
+	if room, exists := ss.RoomManager.GetRoom(roomID); exists {
+		return ss.participants(room)
+	}
+	return ss.remoteParticipants(roomID)
+}
+
+// remoteParticipants returns the participants of a room on the other live
+// nodes
+func (ss *SignallingServer) remoteParticipants(roomID string) []*Participant {
+	if ss.adapter == nil {
+		return nil
+	}
+
+	members, err := ss.adapter.Members(context.Background(), roomID)
+	if err != nil {
+		slog.Warn("Cluster members not loaded", "room_id", roomID, "error", err)
+		return nil
+	}
+	var participants []*Participant
+	for _, member := range members {
+		if ss.liveNode(member.Node) {
+			p := member.Participant
+			participants = append(participants, &p)
+		}
+	}
+	return participants
+}
+
+// hasUser reports whether a user has a connection in a room on any live
+// node
+func (ss *SignallingServer) hasUser(room *Room, userID string) bool {
+	if room.HasUser(userID) {
+		return true
+	}
+	for _, p := range ss.remoteParticipants(room.ID) {
+		if p.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSession counts a request for a session another live node holds.
+// It means the load balancer does not keep clients on one replica, which
+// breaks Socket.IO's polling transport.
+func (ss *SignallingServer) checkSession(sid string) {
+	node := sessionNode(sid)
+	if node == "" || !ss.liveNode(node) {
+		return
+	}
+
+	ss.clusterMu.Lock()
+	first := time.Since(ss.misroutedAt) > stickyWindow
+	ss.misroutedAt = time.Now()
+	ss.misrouted++
+	ss.clusterMu.Unlock()
+
+	if first {
+		slog.Error("Socket.IO session reached the wrong replica", "node", ss.Node, "session_node", node, "guidance", stickyGuidance)
+	}
+}
+
+// ClusterStatus reports this node's view of the cluster
+func (ss *SignallingServer) ClusterStatus() ClusterStatus {
+	ss.clusterMu.Lock()
+	defer ss.clusterMu.Unlock()
+
+	status := ClusterStatus{
+		Node:           ss.Node,
+		Clustered:      ss.adapter != nil,
+		Nodes:          1,
+		StickySessions: ss.misroutedAt.IsZero() || time.Since(ss.misroutedAt) > stickyWindow,
+		Misrouted:      ss.misrouted,
+	}
+	if ss.nodes != nil {
+		status.Nodes = len(ss.nodes)
+	}
+	if ss.clusterErr != nil {
+		status.Error = ss.clusterErr.Error()
+	}
+	if !status.StickySessions {
+		status.Guidance = stickyGuidance
+	}
+	return status
+}
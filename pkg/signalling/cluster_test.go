@@ -0,0 +1,270 @@
+package signalling
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newCluster returns two signalling servers sharing rooms through an
+// in-memory adapter, and a recorder of the messages they publish
+func newCluster(t *testing.T) (a, b *SignallingServer, published func() []ClusterMessage) {
+	t.Helper()
+	adapter := NewMemoryAdapter()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	var mu sync.Mutex
+	var messages []ClusterMessage
+	adapter.Subscribe(ctx, func(msg ClusterMessage) {
+		mu.Lock()
+		messages = append(messages, msg)
+		mu.Unlock()
+	})
+
+	servers := make([]*SignallingServer, 2)
+	for i := range servers {
+		ss, err := NewSignallingServer()
+		if err != nil {
+			t.Fatalf("Failed to create signalling server: %v", err)
+		}
+		ss.Mediasoup = nil
+		if err := ss.WithAdapter(adapter).Start(ctx); err != nil {
+			t.Fatalf("Failed to start node: %v", err)
+		}
+		t.Cleanup(func() { ss.Stop(context.Background()) })
+		servers[i] = ss
+	}
+	// The first node learns of the second at its next heartbeat
+	servers[0].heartbeat(ctx)
+
+	return servers[0], servers[1], func() []ClusterMessage {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]ClusterMessage(nil), messages...)
+	}
+}
+
+// TestClusterRooms tests that participants connected to different nodes
+// see each other, reach each other with relays and stop being counted
+// once they leave or their node stops
+func TestClusterRooms(t *testing.T) {
+	a, b, published := newCluster(t)
+	ctx := context.Background()
+
+	teacher := &fakeConn{id: a.Node + ".1"}
+	a.RoomManager.CreateRoom("room-1", "Class")
+	roomA, _ := a.RoomManager.GetRoom("room-1")
+	a.joinRoom(teacher, roomA, JoinRoomRequest{RoomID: "room-1", UserID: "teacher-1", Email: "t@example.com", Role: "teacher"})
+
+	student := &fakeConn{id: b.Node + ".1"}
+	b.RoomManager.CreateRoom("room-1", "Class")
+	roomB, _ := b.RoomManager.GetRoom("room-1")
+	b.joinRoom(student, roomB, JoinRoomRequest{RoomID: "room-1", UserID: "student-1", Email: "s@example.com", Role: "student"})
+
+	for _, ss := range []*SignallingServer{a, b} {
+		if stats := ss.GetRoomStats("room-1"); stats.ParticipantCount != 2 || stats.ProducerCount != 0 {
+			t.Errorf("Expected node %s to count both participants, got %+v", ss.Node, stats)
+		}
+	}
+
+	joined := false
+	for _, msg := range published() {
+		if msg.Node == b.Node && msg.Room == "room-1" && msg.Event == "participant-joined" &&
+			strings.Contains(string(msg.Data), "student-1") {
+			joined = true
+		}
+	}
+	if !joined {
+		t.Error("Expected the student's join published to the other nodes")
+	}
+
+	offer := SignallingMessage{Type: "offer", From: "spoofed", To: teacher.id, SDP: "v=0"}
+	if err := b.Relay(student.id, "webrtc-offer", offer); err != nil {
+		t.Fatalf("Failed to relay across nodes: %v", err)
+	}
+	msgs := published()
+	last := msgs[len(msgs)-1]
+	if last.Node != b.Node || last.Room != teacher.id || last.Event != "webrtc-offer" ||
+		!strings.Contains(string(last.Data), `"from":"`+student.id+`"`) {
+		t.Errorf("Unexpected relay %+v (%s)", last, last.Data)
+	}
+	if err := b.Relay(student.id, "webrtc-offer", SignallingMessage{To: "room-1"}); err != errPeerNotInRoom {
+		t.Errorf("Expected errPeerNotInRoom relaying to a room, got %v", err)
+	}
+	if err := b.Relay("stranger", "webrtc-offer", offer); err != errNotInRoom {
+		t.Errorf("Expected errNotInRoom, got %v", err)
+	}
+
+	b.removeParticipant(ctx, roomB, student.id)
+	if stats := a.GetRoomStats("room-1"); stats.ParticipantCount != 1 {
+		t.Errorf("Expected the student gone from the other node, got %+v", stats)
+	}
+
+	b.joinRoom(student, roomB, JoinRoomRequest{RoomID: "room-1", UserID: "student-1", Email: "s@example.com", Role: "student"})
+	b.Stop(ctx)
+	a.heartbeat(ctx)
+	if stats := a.GetRoomStats("room-1"); stats.ParticipantCount != 1 {
+		t.Errorf("Expected a stopped node's participants ignored, got %+v", stats)
+	}
+
+	t.Log("✓ Rooms shared across nodes")
+}
+
+// TestStickySessions tests that a node reports itself unhealthy while it
+// receives requests for sessions another live node holds
+func TestStickySessions(t *testing.T) {
+	a, b, _ := newCluster(t)
+
+	if id := (&sessionIDs{node: a.Node}).NewID(); sessionNode(id) != a.Node {
+		t.Fatalf("Expected session %q of node %s", id, a.Node)
+	}
+
+	for _, sid := range []string{b.Node + ".7", "gone-node.3", "42"} {
+		rec := httptest.NewRecorder()
+		b.ServeHTTP(rec, httptest.NewRequest("GET", "/socket.io/?EIO=3&transport=polling&sid="+sid, nil))
+	}
+	if status := b.ClusterStatus(); !status.Healthy() || status.Nodes != 2 || !status.Clustered {
+		t.Fatalf("Expected a healthy node, got %+v", status)
+	}
+
+	rec := httptest.NewRecorder()
+	b.ServeHTTP(rec, httptest.NewRequest("GET", "/socket.io/?EIO=3&transport=polling&sid="+a.Node+".1", nil))
+	status := b.ClusterStatus()
+	if status.Healthy() || status.StickySessions || status.Misrouted != 1 || status.Guidance == "" {
+		t.Errorf("Expected a misrouted session reported, got %+v", status)
+	}
+	if !status.Ready() {
+		t.Error("Expected misrouted sessions not to take the node out of rotation")
+	}
+
+	t.Log("✓ Misrouted sessions make the node unhealthy")
+}
+
+// TestClusterRoomState tests that polls, hands, the lobby, host controls
+// and breakout rooms act on participants connected to another node
+func TestClusterRoomState(t *testing.T) {
+	a, b, published := newCluster(t)
+	ctx := context.Background()
+
+	connect := func(ss *SignallingServer, n string) *fakeConn {
+		conn := &fakeConn{id: ss.Node + "." + n}
+		ss.addConn(conn)
+		return conn
+	}
+	join := func(ss *SignallingServer, conn *fakeConn, userID, role string) *Room {
+		t.Helper()
+		req := JoinRoomRequest{RoomID: "room-1", UserID: userID, Email: userID + "@example.com", Role: role}
+		room, err := ss.openRoom(req)
+		if err != nil {
+			t.Fatalf("Failed to open room: %v", err)
+		}
+		ss.joinRoom(conn, room, req)
+		return room
+	}
+	teacher, student := connect(a, "1"), connect(b, "1")
+	roomA := join(a, teacher, "teacher-1", "teacher")
+	roomB := join(b, student, "student-1", "student")
+
+	var closed []PollClosedEvent
+	a.OnPollClosed(func(event PollClosedEvent) {
+		closed = append(closed, event)
+	})
+	started, err := a.CreatePoll(teacher.id, CreatePollRequest{RoomID: "room-1", Question: "Ready?", Options: []string{"Yes", "No"}, Points: 1})
+	if err != nil {
+		t.Fatalf("Failed to create poll: %v", err)
+	}
+	if err := b.VotePoll(student.id, VotePollRequest{RoomID: "room-1", PollID: started.PollID, Choices: []int{0}}); err != nil {
+		t.Fatalf("Failed to vote on another node: %v", err)
+	}
+	results, err := a.ClosePoll(teacher.id, "room-1", started.PollID)
+	if err != nil || results.Voters != 1 || results.Tallies[0] != 1 {
+		t.Fatalf("Expected the other node's vote tallied, got %+v (%v)", results, err)
+	}
+	if len(closed) != 1 || len(closed[0].Students) != 1 || closed[0].Votes["student-1"][0] != 0 {
+		t.Errorf("Expected student-1 graded, got %+v", closed)
+	}
+
+	if _, err := b.RaiseHand(student.id, "room-1"); err != nil {
+		t.Fatalf("Failed to raise hand: %v", err)
+	}
+	if hands := roomA.Hands(); len(hands) != 1 || hands[0].UserID != "student-1" {
+		t.Errorf("Expected the hand seen on the other node, got %+v", hands)
+	}
+	if err := a.LowerHand(teacher.id, "room-1", "student-1"); err != nil {
+		t.Errorf("Failed to lower a hand raised on another node: %v", err)
+	}
+
+	// A student waiting on one node is admitted by the host on the other
+	on := true
+	if _, err := a.UpdateRoomSettings(teacher.id, RoomSettingsRequest{RoomID: "room-1", Lobby: &on}); err != nil {
+		t.Fatalf("Failed to turn the lobby on: %v", err)
+	}
+	newcomer := connect(b, "2")
+	req := JoinRoomRequest{RoomID: "room-1", UserID: "student-2", Email: "s2@example.com", Role: "student"}
+	if err := b.admission(roomB, req); err != errWaitForHost {
+		t.Fatalf("Expected the lobby setting shared, got %v", err)
+	}
+	b.wait(newcomer, roomB, req)
+	if waiting := roomA.Waiting(); len(waiting) != 1 || waiting[0].SocketID != newcomer.id {
+		t.Fatalf("Expected the lobby shared, got %+v", waiting)
+	}
+	if n, err := a.Admit(teacher.id, "room-1", "student-2"); err != nil || n != 1 {
+		t.Fatalf("Expected 1 admitted, got %d (%v)", n, err)
+	}
+	if !roomB.HasUser("student-2") || roomB.isWaiting(newcomer.id) || newcomer.events[len(newcomer.events)-1] != "joined-room" {
+		t.Errorf("Expected the newcomer joined on their node, got %v", newcomer.events)
+	}
+	commanded := false
+	for _, msg := range published() {
+		if msg.Node == a.Node && msg.To == b.Node && msg.Event == commandAdmit {
+			commanded = true
+		}
+	}
+	if !commanded {
+		t.Error("Expected the admission sent to the newcomer's node")
+	}
+
+	if err := a.RemoveUser(ctx, teacher.id, "room-1", "student-2", true); err != nil {
+		t.Fatalf("Failed to remove a participant of another node: %v", err)
+	}
+	if roomB.HasUser("student-2") || newcomer.events[len(newcomer.events)-1] != "removed" {
+		t.Errorf("Expected student-2 removed on their node, got %v", newcomer.events)
+	}
+	if err := b.admission(roomB, req); err != errBanned {
+		t.Errorf("Expected the ban shared, got %v", err)
+	}
+
+	// Breakout rooms opened on one node move students of the other
+	resp, err := a.CreateBreakouts(ctx, teacher.id, CreateBreakoutsRequest{RoomID: "room-1", Count: 2})
+	if err != nil {
+		t.Fatalf("Failed to create breakouts: %v", err)
+	}
+	first := resp.Breakouts[0].RoomID
+	if err := a.MoveParticipant(ctx, teacher.id, MoveParticipantRequest{RoomID: "room-1", UserID: "student-1", ToRoomID: first}); err != nil {
+		t.Fatalf("Failed to move a participant of another node: %v", err)
+	}
+	if breakout, ok := b.RoomManager.GetRoom(first); !ok || !breakout.HasUser("student-1") || roomB.HasUser("student-1") {
+		t.Fatal("Expected student-1 moved on their node")
+	}
+	if student.events[len(student.events)-1] != "moved-to-room" {
+		t.Errorf("Expected student-1 told of the move, got %v", student.events)
+	}
+	if breakout, ok := b.assignedBreakout("room-1", "student-1"); !ok || breakout.ID != first {
+		t.Errorf("Expected the assignment shared, got %v", breakout)
+	}
+	if resp := a.breakoutsOf(roomA); len(resp.Breakouts[0].Participants) != 1 {
+		t.Errorf("Expected the breakout room's participant listed, got %+v", resp.Breakouts)
+	}
+
+	if _, err := a.CloseBreakouts(teacher.id, "room-1", 0); err != nil {
+		t.Fatalf("Failed to close breakouts: %v", err)
+	}
+	if !roomB.HasUser("student-1") || b.RoomManager.RoomExists(first) {
+		t.Error("Expected student-1 back in the main room on their node")
+	}
+
+	t.Log("✓ Room state shared across nodes")
+}
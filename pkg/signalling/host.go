@@ -0,0 +1,627 @@
+package signalling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	socketio "github.com/googollee/go-socket.io"
+)
+
+var (
+	errWaitForHost    = errors.New("waiting for the host to admit you")
+	errRoomLocked     = errors.New("room is locked")
+	errBanned         = errors.New("removed from this session by the host")
+	errDenied         = errors.New("the host did not admit you")
+	errNotHost        = errors.New("only the host can do this")
+	errNotWaiting     = errors.New("user is not waiting in the lobby")
+	errCannotRemove   = errors.New("the host cannot be removed")
+	errUnknownMedia   = errors.New("media kind must be audio or video")
+	errMediaBlocked   = errors.New("the host has turned this off")
+	errUserNotPresent = errors.New("user is not in this room")
+)
+
+// WaitingParticipant is someone waiting in a room's lobby
+type WaitingParticipant struct {
+	SocketID string    `json:"socket_id"`
+	UserID   string    `json:"user_id"`
+	Email    string    `json:"email"`
+	FullName string    `json:"full_name"`
+	Since    time.Time `json:"since"`
+}
+
+// lobbyRoom is the Socket.IO room of the connections waiting in a room's
+// lobby
+func lobbyRoom(roomID string) string {
+	return roomID + "#lobby"
+}
+
+// registerHostHandlers sets up the lobby and host control events. The host
+// is the first teacher to join unless host is transferred; while the host
+// is away any teacher in the room, and admins always, may act as host.
+func (ss *SignallingServer) registerHostHandlers() {
+	ss.IO.OnEvent("", "admit", func(s socketio.Conn, payload string) {
+		var req HostActionRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		if _, err := ss.Admit(s.ID(), req.RoomID, req.UserID); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+		}
+	})
+
+	ss.IO.OnEvent("", "deny", func(s socketio.Conn, payload string) {
+		var req HostActionRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		if err := ss.Deny(s.ID(), req.RoomID, req.UserID); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+		}
+	})
+
+	ss.IO.OnEvent("", "get-lobby", func(s socketio.Conn, payload string) {
+		var req HostActionRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		room, _, err := ss.hostIn(s.ID(), req.RoomID)
+		if err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+			return
+		}
+		s.Emit("lobby-updated", map[string]interface{}{"room_id": room.ID, "waiting": room.Waiting()})
+	})
+
+	ss.IO.OnEvent("", "remove-participant", func(s socketio.Conn, payload string) {
+		var req HostActionRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		if err := ss.RemoveUser(connContext(s), s.ID(), req.RoomID, req.UserID, req.Ban); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+		}
+	})
+
+	ss.IO.OnEvent("", "transfer-host", func(s socketio.Conn, payload string) {
+		var req HostActionRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		if err := ss.TransferHost(s.ID(), req.RoomID, req.UserID); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+		}
+	})
+
+	ss.IO.OnEvent("", "room-settings", func(s socketio.Conn, payload string) {
+		var req RoomSettingsRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		if _, err := ss.UpdateRoomSettings(s.ID(), req); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+		}
+	})
+
+	ss.IO.OnEvent("", "mute-participant", func(s socketio.Conn, payload string) {
+		var req MediaControlRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		if err := ss.SetMediaAllowed(connContext(s), s.ID(), req, false); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+		}
+	})
+
+	ss.IO.OnEvent("", "unmute-participant", func(s socketio.Conn, payload string) {
+		var req MediaControlRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		if err := ss.SetMediaAllowed(connContext(s), s.ID(), req, true); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+		}
+	})
+}
+
+// admission decides whether a join request enters the room, waits in its
+// lobby or is refused. Bans hold across a main room and its breakout rooms.
+func (ss *SignallingServer) admission(room *Room, req JoinRoomRequest) error {
+	if rootID := ss.RoomManager.RootID(room.ID); rootID != room.ID {
+		root, err := ss.RoomManager.state(rootID)
+		if err != nil {
+			return err
+		}
+		if root.Banned[req.UserID] {
+			return errBanned
+		}
+	}
+
+	state, err := room.state()
+	if err != nil {
+		return err
+	}
+	if state.Banned[req.UserID] {
+		return errBanned
+	}
+	host := req.Role == "admin" || (state.HostID != "" && req.UserID == state.HostID)
+	if state.Locked && !host {
+		return errRoomLocked
+	}
+	if state.Lobby && !isStaff(req.Role) && !host && !state.Admitted[req.UserID] {
+		return errWaitForHost
+	}
+	return nil
+}
+
+// admit records that a user entered the room, so they skip the lobby when
+// reconnecting. The first teacher to enter becomes the host.
+func (r *Room) admit(userID, role string) error {
+	_, err := r.update(func(s *RoomState) error {
+		s.admit(userID, role)
+		return nil
+	})
+	return err
+}
+
+// hostIn returns the room and the sender, provided the sender may act as
+// its host: admins and the host always, other teachers while the host is
+// connected to no node
+func (ss *SignallingServer) hostIn(socketID, roomID string) (*Room, *Participant, error) {
+	room, sender, err := ss.participantIn(socketID, roomID)
+	if err != nil {
+		return nil, nil, err
+	}
+	state, err := room.state()
+	if err != nil {
+		return nil, nil, err
+	}
+	if sender.Role == "admin" || sender.UserID == state.HostID {
+		return room, sender, nil
+	}
+	if !isStaff(sender.Role) || ss.hasUser(room, state.HostID) {
+		return nil, nil, errNotHost
+	}
+	return room, sender, nil
+}
+
+// wait puts a connection in the room's lobby
+func (ss *SignallingServer) wait(s socketio.Conn, room *Room, req JoinRoomRequest) {
+	waiting := WaitingParticipant{
+		SocketID: s.ID(),
+		UserID:   req.UserID,
+		Email:    req.Email,
+		FullName: req.FullName,
+		Since:    time.Now(),
+	}
+	var position int
+	_, err := room.update(func(st *RoomState) error {
+		if st.Waiting == nil {
+			st.Waiting = make(map[string]WaitingParticipant)
+		}
+		st.Waiting[s.ID()] = waiting
+		position = len(st.Waiting)
+		return nil
+	})
+	if err != nil {
+		s.Emit("join-refused", map[string]string{"room_id": room.ID, "reason": err.Error()})
+		return
+	}
+
+	room.mu.Lock()
+	if room.pending == nil {
+		room.pending = make(map[string]JoinRoomRequest)
+	}
+	room.pending[s.ID()] = req
+	room.mu.Unlock()
+
+	s.Join(lobbyRoom(room.ID))
+	s.Emit("waiting", map[string]interface{}{"room_id": room.ID, "position": position})
+	ss.broadcastLobby(room)
+
+	slog.InfoContext(connContext(s), "User waiting in lobby", "room_id", room.ID, "participant_user_id", req.UserID)
+}
+
+// Waiting returns the room's lobby on every node in the order people
+// arrived
+func (r *Room) Waiting() []WaitingParticipant {
+	state, err := r.state()
+	if err != nil {
+		return []WaitingParticipant{}
+	}
+	return state.waiting()
+}
+
+// takePending removes a connection of this node from the lobby and
+// returns its join request
+func (r *Room) takePending(socketID string) (JoinRoomRequest, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	req, ok := r.pending[socketID]
+	delete(r.pending, socketID)
+	return req, ok
+}
+
+// dropWaiting removes a connection of this node from the lobby, reporting
+// whether it was waiting
+func (r *Room) dropWaiting(socketID string) bool {
+	if _, ok := r.takePending(socketID); !ok {
+		return false
+	}
+	r.update(func(s *RoomState) error {
+		delete(s.Waiting, socketID)
+		return nil
+	})
+	return true
+}
+
+// isWaiting reports whether a connection of this node is in the lobby
+func (r *Room) isWaiting(socketID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.pending[socketID]
+	return ok
+}
+
+// hasPending reports whether connections of this node are in the lobby
+func (r *Room) hasPending() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.pending) > 0
+}
+
+func (ss *SignallingServer) broadcastLobby(room *Room) {
+	ss.broadcast(staffRoom(room.ID), "lobby-updated", map[string]interface{}{
+		"room_id": room.ID,
+		"waiting": room.Waiting(),
+	})
+}
+
+// Admit lets a user waiting in the lobby into the room, or everyone
+// waiting for an empty user ID, whichever node they are connected to. It
+// returns the number of connections admitted.
+func (ss *SignallingServer) Admit(socketID, roomID, userID string) (int, error) {
+	room, _, err := ss.hostIn(socketID, roomID)
+	if err != nil {
+		return 0, err
+	}
+
+	var waiting []WaitingParticipant
+	if _, err := room.update(func(s *RoomState) error {
+		waiting = s.admitWaiting(userID)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	if userID != "" && len(waiting) == 0 {
+		return 0, errNotWaiting
+	}
+	ss.admitWaiting(room, waiting)
+	return len(waiting), nil
+}
+
+// admitWaiting has the nodes of connections taken from the lobby complete
+// their joins
+func (ss *SignallingServer) admitWaiting(room *Room, waiting []WaitingParticipant) {
+	for _, w := range waiting {
+		ss.onNode(context.Background(), commandAdmit, nodeCommand{RoomID: room.ID, SocketID: w.SocketID})
+	}
+	if len(waiting) > 0 {
+		ss.broadcastLobby(room)
+	}
+}
+
+// admitConnection completes the join of a connection of this node let in
+// from the lobby
+func (ss *SignallingServer) admitConnection(room *Room, socketID string) {
+	req, ok := room.takePending(socketID)
+	if !ok {
+		return
+	}
+	if conn := ss.findConn(socketID); conn != nil {
+		conn.Leave(lobbyRoom(room.ID))
+		ss.joinRoom(conn, room, req)
+	}
+}
+
+// Deny turns away a user waiting in the lobby
+func (ss *SignallingServer) Deny(socketID, roomID, userID string) error {
+	room, _, err := ss.hostIn(socketID, roomID)
+	if err != nil {
+		return err
+	}
+	if userID == "" {
+		return errMissingParticipant
+	}
+
+	var waiting []WaitingParticipant
+	if _, err := room.update(func(s *RoomState) error {
+		waiting = s.takeWaiting(userID)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if len(waiting) == 0 {
+		return errNotWaiting
+	}
+	for _, w := range waiting {
+		ss.onNode(context.Background(), commandDeny, nodeCommand{RoomID: room.ID, SocketID: w.SocketID})
+	}
+	ss.broadcastLobby(room)
+	return nil
+}
+
+// denyConnection turns away a connection of this node waiting in the lobby
+func (ss *SignallingServer) denyConnection(room *Room, socketID string) {
+	if _, ok := room.takePending(socketID); !ok {
+		return
+	}
+	if conn := ss.findConn(socketID); conn != nil {
+		conn.Leave(lobbyRoom(room.ID))
+		conn.Emit("join-refused", map[string]string{"room_id": room.ID, "reason": errDenied.Error()})
+	}
+}
+
+// RemoveUser takes every connection of a user out of the room, on every
+// node. A banned user cannot come back to the room or its breakout rooms
+// for the rest of the session.
+func (ss *SignallingServer) RemoveUser(ctx context.Context, socketID, roomID, userID string, ban bool) error {
+	room, sender, err := ss.hostIn(socketID, roomID)
+	if err != nil {
+		return err
+	}
+	if userID == "" {
+		return errMissingParticipant
+	}
+	state, err := room.state()
+	if err != nil {
+		return err
+	}
+	if userID == sender.UserID || (userID == state.HostID && sender.Role != "admin") {
+		return errCannotRemove
+	}
+	if !ss.hasUser(room, userID) && !ban {
+		return errUserNotPresent
+	}
+
+	if rootID := ss.RoomManager.RootID(room.ID); ban && rootID != room.ID {
+		if _, err := ss.RoomManager.update(rootID, func(s *RoomState) error {
+			s.ban(userID)
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	var waiting []WaitingParticipant
+	if _, err := room.update(func(s *RoomState) error {
+		if ban {
+			s.ban(userID)
+		}
+		delete(s.Admitted, userID)
+		waiting = s.takeWaiting(userID)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, w := range waiting {
+		ss.onNode(ctx, commandRemove, nodeCommand{RoomID: room.ID, SocketID: w.SocketID, Ban: ban})
+	}
+	for _, p := range ss.participants(room) {
+		if p.UserID == userID {
+			ss.onNode(ctx, commandRemove, nodeCommand{RoomID: room.ID, SocketID: p.SocketID, Ban: ban})
+		}
+	}
+
+	slog.InfoContext(ctx, "Participant removed by host", "room_id", room.ID, "participant_user_id", userID, "banned", ban)
+	return nil
+}
+
+// removeConnection takes a connection of this node out of the room or its
+// lobby and tells it why
+func (ss *SignallingServer) removeConnection(ctx context.Context, room *Room, socketID string, ban bool) {
+	if conn := ss.findConn(socketID); conn != nil {
+		if room.isWaiting(socketID) {
+			conn.Leave(lobbyRoom(room.ID))
+		} else {
+			conn.Leave(room.ID)
+			conn.Leave(staffRoom(room.ID))
+		}
+		conn.Emit("removed", map[string]interface{}{"room_id": room.ID, "banned": ban})
+	}
+	ss.removeParticipant(ctx, room, socketID)
+}
+
+// TransferHost makes another participant the room's host
+func (ss *SignallingServer) TransferHost(socketID, roomID, userID string) error {
+	room, _, err := ss.hostIn(socketID, roomID)
+	if err != nil {
+		return err
+	}
+	if !ss.hasUser(room, userID) {
+		return errUserNotPresent
+	}
+
+	state, err := room.update(func(s *RoomState) error {
+		s.HostID = userID
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ss.broadcast(room.ID, "room-settings", state.settings(room.ID))
+	return nil
+}
+
+// Settings returns the room's host, lobby and lock settings
+func (r *Room) Settings() RoomSettings {
+	state, err := r.state()
+	if err != nil {
+		return RoomSettings{RoomID: r.ID}
+	}
+	return state.settings(r.ID)
+}
+
+// UpdateRoomSettings turns the lobby on or off and locks or unlocks the
+// room. Turning the lobby off admits everyone waiting in it.
+func (ss *SignallingServer) UpdateRoomSettings(socketID string, req RoomSettingsRequest) (RoomSettings, error) {
+	room, _, err := ss.hostIn(socketID, req.RoomID)
+	if err != nil {
+		return RoomSettings{}, err
+	}
+
+	var waiting []WaitingParticipant
+	state, err := room.update(func(s *RoomState) error {
+		if req.Lobby != nil {
+			s.Lobby = *req.Lobby
+		}
+		if req.Locked != nil {
+			s.Locked = *req.Locked
+		}
+		waiting = nil
+		if !s.Lobby {
+			waiting = s.admitWaiting("")
+		}
+		return nil
+	})
+	if err != nil {
+		return RoomSettings{}, err
+	}
+	ss.admitWaiting(room, waiting)
+
+	settings := state.settings(room.ID)
+	ss.broadcast(room.ID, "room-settings", settings)
+	return settings, nil
+}
+
+// SetMediaAllowed lets the host turn off a user's microphone or camera,
+// or every student's for an empty user ID. Their producers of that kind
+// are closed in Mediasoup and new ones are refused until the host allows
+// them again, which asks the user to turn them back on.
+func (ss *SignallingServer) SetMediaAllowed(ctx context.Context, socketID string, req MediaControlRequest, allowed bool) error {
+	room, sender, err := ss.hostIn(socketID, req.RoomID)
+	if err != nil {
+		return err
+	}
+	if req.Kind == "" {
+		req.Kind = "audio"
+	}
+	if req.Kind != "audio" && req.Kind != "video" {
+		return errUnknownMedia
+	}
+
+	var targets []string
+	if req.UserID != "" {
+		if !ss.hasUser(room, req.UserID) {
+			return errUserNotPresent
+		}
+		targets = []string{req.UserID}
+	} else {
+		for _, userID := range ss.studentIDs(room) {
+			if userID != sender.UserID {
+				targets = append(targets, userID)
+			}
+		}
+	}
+
+	if _, err := room.update(func(s *RoomState) error {
+		if s.Blocked == nil {
+			s.Blocked = make(map[string]map[string]bool)
+		}
+		for _, userID := range targets {
+			if allowed {
+				delete(s.Blocked[userID], req.Kind)
+				continue
+			}
+			if s.Blocked[userID] == nil {
+				s.Blocked[userID] = make(map[string]bool)
+			}
+			s.Blocked[userID][req.Kind] = true
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	event := "media-blocked"
+	if allowed {
+		event = "unmute-requested"
+	}
+	participants := ss.participants(room)
+	for _, userID := range targets {
+		for _, p := range participants {
+			if p.UserID != userID {
+				continue
+			}
+			if !allowed && ss.Mediasoup != nil {
+				closed, err := ss.Mediasoup.ClosePeerProducers(ctx, room.ID, p.SocketID, req.Kind)
+				if err != nil {
+					slog.WarnContext(ctx, "Failed to close producers of muted participant", "room_id", room.ID, "peer_id", p.SocketID, "error", err)
+				}
+				for _, producerID := range closed {
+					ss.broadcast(room.ID, "producer-closed", map[string]string{
+						"producerId": producerID,
+						"peerId":     p.SocketID,
+					})
+				}
+			}
+			ss.broadcast(p.SocketID, event, map[string]string{"room_id": room.ID, "kind": req.Kind})
+		}
+		ss.broadcast(room.ID, "media-state", map[string]interface{}{
+			"room_id": room.ID,
+			"user_id": userID,
+			"kind":    req.Kind,
+			"allowed": allowed,
+		})
+	}
+	return nil
+}
+
+// checkProduce refuses media from connections waiting in the lobby and
+// media the host has turned off. Screen shares are not camera video and
+// stay allowed.
+func (ss *SignallingServer) checkProduce(roomID, socketID, kind, source string) error {
+	room, exists := ss.RoomManager.GetRoom(roomID)
+	if !exists {
+		return nil
+	}
+	if room.isWaiting(socketID) {
+		return errWaitForHost
+	}
+	p, ok := room.GetParticipant(socketID)
+	if !ok {
+		return nil
+	}
+	if kind == "video" && source == "screen" {
+		return nil
+	}
+
+	state, err := room.state()
+	if err != nil {
+		return err
+	}
+	if state.Blocked[p.UserID][kind] {
+		return errMediaBlocked
+	}
+	return nil
+}
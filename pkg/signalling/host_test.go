@@ -0,0 +1,241 @@
+package signalling
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/Bashar444/VTP/pkg/auth"
+	socketio "github.com/googollee/go-socket.io"
+)
+
+// fakeConn is a connection that records what it is sent
+type fakeConn struct {
+	socketio.Conn
+	id     string
+	ctx    interface{}
+	url    url.URL
+	header http.Header
+	events []string
+}
+
+func (c *fakeConn) ID() string                          { return c.id }
+func (c *fakeConn) Context() interface{}                { return c.ctx }
+func (c *fakeConn) SetContext(ctx interface{})          { c.ctx = ctx }
+func (c *fakeConn) URL() url.URL                        { return c.url }
+func (c *fakeConn) RemoteHeader() http.Header           { return c.header }
+func (c *fakeConn) Join(string)                         {}
+func (c *fakeConn) Leave(string)                        {}
+func (c *fakeConn) Emit(event string, _ ...interface{}) { c.events = append(c.events, event) }
+
+// TestLobby tests that with the lobby on students wait until the host
+// admits them, while teachers and admitted students go straight in
+func TestLobby(t *testing.T) {
+	ss, room := newInteractionRoom(t)
+	room.admit("teacher-1", "teacher")
+	room.admit("student-1", "student")
+	on := true
+	if _, err := ss.UpdateRoomSettings("socket-2", RoomSettingsRequest{RoomID: "room-1", Lobby: &on}); err != errNotHost {
+		t.Errorf("Expected errNotHost, got %v", err)
+	}
+	if _, err := ss.UpdateRoomSettings("socket-1", RoomSettingsRequest{RoomID: "room-1", Lobby: &on}); err != nil {
+		t.Fatalf("Failed to turn the lobby on: %v", err)
+	}
+
+	newcomer := JoinRoomRequest{RoomID: "room-1", UserID: "student-9", Email: "s9@example.com", Role: "student"}
+	if err := ss.admission(room, newcomer); err != errWaitForHost {
+		t.Fatalf("Expected errWaitForHost, got %v", err)
+	}
+	if err := ss.admission(room, JoinRoomRequest{UserID: "student-1", Role: "student"}); err != nil {
+		t.Errorf("Expected an admitted student to rejoin, got %v", err)
+	}
+	if err := ss.admission(room, JoinRoomRequest{UserID: "teacher-2", Role: "teacher"}); err != nil {
+		t.Errorf("Expected teachers to skip the lobby, got %v", err)
+	}
+
+	conn := &fakeConn{id: "socket-9"}
+	ss.wait(conn, room, newcomer)
+	if waiting := room.Waiting(); len(waiting) != 1 || waiting[0].UserID != "student-9" {
+		t.Fatalf("Unexpected lobby %+v", waiting)
+	}
+	if len(conn.events) != 1 || conn.events[0] != "waiting" {
+		t.Errorf("Expected the newcomer told to wait, got %v", conn.events)
+	}
+	if err := ss.checkProduce("room-1", "socket-9", "audio", ""); err != errWaitForHost {
+		t.Errorf("Expected media refused in the lobby, got %v", err)
+	}
+
+	if _, err := ss.Admit("socket-2", "room-1", "student-9"); err != errNotHost {
+		t.Errorf("Expected errNotHost, got %v", err)
+	}
+	if n, err := ss.Admit("socket-1", "room-1", "student-9"); err != nil || n != 1 {
+		t.Fatalf("Expected 1 admitted, got %d (%v)", n, err)
+	}
+	if len(room.Waiting()) != 0 || ss.admission(room, newcomer) != nil {
+		t.Error("Expected the newcomer admitted")
+	}
+
+	// Leaving the lobby keeps the room open for those waiting
+	ss.wait(&fakeConn{id: "socket-10"}, room, JoinRoomRequest{RoomID: "room-1", UserID: "student-10", Role: "student"})
+	for _, socketID := range []string{"socket-1", "socket-2", "socket-3"} {
+		ss.removeParticipant(context.Background(), room, socketID)
+	}
+	if !ss.RoomManager.RoomExists("room-1") {
+		t.Fatal("Expected the room kept while someone waits")
+	}
+	ss.removeParticipant(context.Background(), room, "socket-10")
+	if ss.RoomManager.RoomExists("room-1") {
+		t.Error("Expected the room deleted once the lobby empties")
+	}
+
+	t.Log("✓ Lobby admits students through the host")
+}
+
+// TestHostControls tests locking the room, removing and banning a
+// participant, transferring host and turning off a student's media
+func TestHostControls(t *testing.T) {
+	ss, room := newInteractionRoom(t)
+	room.admit("teacher-1", "teacher")
+	ctx := context.Background()
+
+	locked := true
+	settings, err := ss.UpdateRoomSettings("socket-1", RoomSettingsRequest{RoomID: "room-1", Locked: &locked})
+	if err != nil || !settings.Locked || settings.HostID != "teacher-1" {
+		t.Fatalf("Unexpected settings %+v (%v)", settings, err)
+	}
+	if err := ss.admission(room, JoinRoomRequest{UserID: "teacher-2", Role: "teacher"}); err != errRoomLocked {
+		t.Errorf("Expected errRoomLocked, got %v", err)
+	}
+	if err := ss.admission(room, JoinRoomRequest{UserID: "admin-1", Role: "admin"}); err != nil {
+		t.Errorf("Expected admins let into locked rooms, got %v", err)
+	}
+
+	if err := ss.RemoveUser(ctx, "socket-2", "room-1", "student-2", false); err != errNotHost {
+		t.Errorf("Expected errNotHost, got %v", err)
+	}
+	if err := ss.RemoveUser(ctx, "socket-1", "room-1", "teacher-1", false); err != errCannotRemove {
+		t.Errorf("Expected errCannotRemove, got %v", err)
+	}
+	if err := ss.RemoveUser(ctx, "socket-1", "room-1", "student-2", true); err != nil {
+		t.Fatalf("Failed to remove participant: %v", err)
+	}
+	if room.HasUser("student-2") {
+		t.Error("Expected student-2 removed")
+	}
+	locked = false
+	ss.UpdateRoomSettings("socket-1", RoomSettingsRequest{RoomID: "room-1", Locked: &locked})
+	if err := ss.admission(room, JoinRoomRequest{UserID: "student-2", Role: "student"}); err != errBanned {
+		t.Errorf("Expected errBanned, got %v", err)
+	}
+
+	if err := ss.SetMediaAllowed(ctx, "socket-1", MediaControlRequest{RoomID: "room-1", UserID: "student-1", Kind: "video"}, false); err != nil {
+		t.Fatalf("Failed to turn off video: %v", err)
+	}
+	if err := ss.checkProduce("room-1", "socket-2", "video", "camera"); err != errMediaBlocked {
+		t.Errorf("Expected the camera refused, got %v", err)
+	}
+	if err := ss.checkProduce("room-1", "socket-2", "video", "screen"); err != nil {
+		t.Errorf("Expected screen shares allowed, got %v", err)
+	}
+	if err := ss.checkProduce("room-1", "socket-2", "audio", ""); err != nil {
+		t.Errorf("Expected the microphone allowed, got %v", err)
+	}
+	if err := ss.SetMediaAllowed(ctx, "socket-1", MediaControlRequest{RoomID: "room-1", UserID: "student-1", Kind: "video"}, true); err != nil {
+		t.Fatalf("Failed to allow video: %v", err)
+	}
+	if err := ss.checkProduce("room-1", "socket-2", "video", "camera"); err != nil {
+		t.Errorf("Expected the camera allowed again, got %v", err)
+	}
+
+	if err := ss.TransferHost("socket-1", "room-1", "student-1"); err != nil {
+		t.Fatalf("Failed to transfer host: %v", err)
+	}
+	if _, err := ss.Admit("socket-1", "room-1", ""); err != errNotHost {
+		t.Errorf("Expected the former host to lose host controls, got %v", err)
+	}
+	if room.Settings().HostID != "student-1" {
+		t.Errorf("Expected student-1 to host, got %+v", room.Settings())
+	}
+
+	t.Log("✓ Host controls enforced")
+}
+
+// fakeRooms gives users course roles in the meeting held in "class-1"
+type fakeRooms map[string]string
+
+func (f fakeRooms) RoomRole(ctx context.Context, roomID, userID, globalRole string) (string, bool, error) {
+	if roomID != "class-1" {
+		return "", false, nil
+	}
+	if globalRole == "admin" {
+		return "admin", true, nil
+	}
+	return f[userID], true, nil
+}
+
+// TestJoinAuthentication tests that sockets need an access token and that
+// joins take the user from the token and the role from the course of the
+// room's meeting, whatever the client claims
+func TestJoinAuthentication(t *testing.T) {
+	tokens := auth.NewTokenService("test-secret", 1, 1)
+	ss, err := NewSignallingServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.WithAuth(tokens, fakeRooms{"ta-1": "ta", "student-1": "student"})
+
+	connect := func(userID, role string) *fakeConn {
+		t.Helper()
+		pair, err := tokens.GenerateTokenPair(userID, userID+"@example.com", role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn := &fakeConn{id: "socket-" + userID, url: url.URL{RawQuery: "token=" + pair.AccessToken}, header: http.Header{}}
+		ctx, err := ss.authenticate(context.Background(), conn)
+		if err != nil {
+			t.Fatalf("Failed to authenticate %s: %v", userID, err)
+		}
+		conn.SetContext(ctx)
+		return conn
+	}
+
+	if _, err := ss.authenticate(context.Background(), &fakeConn{header: http.Header{}}); err != errUnauthenticated {
+		t.Errorf("Expected errUnauthenticated without a token, got %v", err)
+	}
+	bad := &fakeConn{header: http.Header{"Authorization": {"Bearer not-a-token"}}}
+	if _, err := ss.authenticate(context.Background(), bad); err != errUnauthenticated {
+		t.Errorf("Expected errUnauthenticated with a bad token, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		userID   string
+		role     string
+		roomID   string
+		claimed  JoinRoomRequest
+		expected string
+		err      error
+	}{
+		{"student claiming to teach", "student-1", "student", "class-1", JoinRoomRequest{UserID: "teacher-1", Role: "teacher"}, "student", nil},
+		{"TA with a student account", "ta-1", "student", "class-1", JoinRoomRequest{Role: "student"}, "teacher", nil},
+		{"teacher of another course", "teacher-9", "teacher", "class-1", JoinRoomRequest{Role: "teacher"}, "", errNotCourseMember},
+		{"admin", "admin-1", "admin", "class-1", JoinRoomRequest{}, "admin", nil},
+		{"room without a meeting", "teacher-9", "teacher", "ad-hoc", JoinRoomRequest{Role: "admin"}, "teacher", nil},
+	}
+	for _, tt := range tests {
+		conn := connect(tt.userID, tt.role)
+		req := tt.claimed
+		req.RoomID = tt.roomID
+		err := ss.authorizeJoin(context.Background(), conn, &req)
+		if err != tt.err {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+			continue
+		}
+		if err == nil && (req.UserID != tt.userID || req.Role != tt.expected) {
+			t.Errorf("%s: expected %s as %s, got %s as %s", tt.name, tt.userID, tt.expected, req.UserID, req.Role)
+		}
+	}
+
+	t.Log("✓ Joins authenticated from the socket's token")
+}
@@ -0,0 +1,584 @@
+package signalling
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	socketio "github.com/googollee/go-socket.io"
+)
+
+var (
+	errNotStaff        = errors.New("only teachers can do this")
+	errPollNotFound    = errors.New("poll not found")
+	errPollClosed      = errors.New("poll is closed")
+	errInvalidPoll     = errors.New("a poll needs a question and 2 to 10 options")
+	errInvalidChoice   = errors.New("invalid poll choice")
+	errGradedAnonymous = errors.New("anonymous polls cannot be graded")
+	errUnknownReaction = errors.New("unknown reaction")
+	errReactionTooSoon = errors.New("reactions are sent too quickly")
+	errHandNotRaised   = errors.New("hand is not raised")
+	errHandRaised      = errors.New("hand is already raised")
+)
+
+const (
+	maxPollOptions = 10
+	// reactionInterval is the least time between two reactions of one
+	// connection, so a held key cannot flood the room
+	reactionInterval = 500 * time.Millisecond
+)
+
+// Reactions are the emoji participants can react with
+var Reactions = map[string]bool{
+	"👍":  true,
+	"👏":  true,
+	"❤️": true,
+	"😂":  true,
+	"😮":  true,
+	"🤔":  true,
+	"🎉":  true,
+}
+
+// RaisedHand is a participant waiting to speak
+type RaisedHand struct {
+	UserID   string    `json:"user_id"`
+	FullName string    `json:"full_name"`
+	RaisedAt time.Time `json:"raised_at"`
+}
+
+// Poll is a question put to the room by a teacher. Votes are kept per
+// user while the poll is open; a new vote replaces the user's previous
+// one.
+type Poll struct {
+	ID        string
+	RoomID    string
+	Question  string
+	Options   []string
+	Multiple  bool  // several options may be chosen
+	Anonymous bool  // who voted for what is never shown or stored
+	Points    int   // participation grade points, 0 for ungraded polls
+	Correct   []int // options earning the points; any vote earns them if empty
+	CreatedBy string
+	CreatedAt time.Time
+	ClosedAt  time.Time
+
+	Votes map[string][]int // user ID -> chosen options
+	Staff map[string]bool  // voters who are teachers, not graded
+}
+
+// PollResults are the tallies of a poll. Votes are only set for teachers
+// of polls that are not anonymous.
+type PollResults struct {
+	PollID    string           `json:"poll_id"`
+	RoomID    string           `json:"room_id"`
+	Question  string           `json:"question"`
+	Options   []string         `json:"options"`
+	Multiple  bool             `json:"multiple"`
+	Anonymous bool             `json:"anonymous"`
+	Tallies   []int            `json:"tallies"`
+	Voters    int              `json:"voters"`
+	Closed    bool             `json:"closed"`
+	Votes     map[string][]int `json:"votes,omitempty"`
+}
+
+// PollClosedEvent reports a closed poll with what is needed to store it.
+// Votes are nil for anonymous polls. Students are the students who voted
+// or were in the room when the poll closed.
+type PollClosedEvent struct {
+	Poll     *Poll
+	Results  PollResults
+	Votes    map[string][]int
+	Students []string
+}
+
+// results tallies the poll's votes, with who voted for what if withVotes
+// is set and the poll is not anonymous
+func (p *Poll) results(withVotes bool) PollResults {
+	res := PollResults{
+		PollID:    p.ID,
+		RoomID:    p.RoomID,
+		Question:  p.Question,
+		Options:   p.Options,
+		Multiple:  p.Multiple,
+		Anonymous: p.Anonymous,
+		Tallies:   make([]int, len(p.Options)),
+		Voters:    len(p.Votes),
+		Closed:    !p.ClosedAt.IsZero(),
+	}
+	for _, choices := range p.Votes {
+		for _, choice := range choices {
+			res.Tallies[choice]++
+		}
+	}
+	if withVotes && !p.Anonymous {
+		res.Votes = make(map[string][]int, len(p.Votes))
+		for userID, choices := range p.Votes {
+			res.Votes[userID] = append([]int(nil), choices...)
+		}
+	}
+	return res
+}
+
+// isStaff reports whether a role may run the room's interaction. Checks
+// pass a participant's role, which authorizeJoin takes from the
+// connection's token and course, never a role sent with an event.
+func isStaff(role string) bool {
+	return role == "teacher" || role == "admin"
+}
+
+// staffRoom is the Socket.IO room of a room's teachers, which receives
+// the hand queue and live poll tallies
+func staffRoom(roomID string) string {
+	return roomID + "#staff"
+}
+
+// registerInteractionHandlers sets up the raise hand, poll and reaction
+// events. Teachers receive the hand queue and live poll tallies; everyone
+// sees polls start and their final results.
+func (ss *SignallingServer) registerInteractionHandlers() {
+	ss.IO.OnEvent("", "raise-hand", func(s socketio.Conn, payload string) {
+		var req HandRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		position, err := ss.RaiseHand(s.ID(), req.RoomID)
+		if err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+			return
+		}
+		s.Emit("hand-raised", map[string]interface{}{"room_id": req.RoomID, "position": position})
+	})
+
+	ss.IO.OnEvent("", "lower-hand", func(s socketio.Conn, payload string) {
+		var req HandRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		if err := ss.LowerHand(s.ID(), req.RoomID, req.UserID); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+		}
+	})
+
+	ss.IO.OnEvent("", "get-hands", func(s socketio.Conn, payload string) {
+		var req HandRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		room, sender, err := ss.participantIn(s.ID(), req.RoomID)
+		if err == nil && !isStaff(sender.Role) {
+			err = errNotStaff
+		}
+		if err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+			return
+		}
+		s.Emit("hand-queue", map[string]interface{}{"room_id": room.ID, "hands": room.Hands()})
+	})
+
+	ss.IO.OnEvent("", "create-poll", func(s socketio.Conn, payload string) {
+		var req CreatePollRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		if _, err := ss.CreatePoll(s.ID(), req); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+		}
+	})
+
+	ss.IO.OnEvent("", "vote-poll", func(s socketio.Conn, payload string) {
+		var req VotePollRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		if err := ss.VotePoll(s.ID(), req); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+			return
+		}
+		s.Emit("vote-recorded", map[string]interface{}{"poll_id": req.PollID, "choices": req.Choices})
+	})
+
+	ss.IO.OnEvent("", "close-poll", func(s socketio.Conn, payload string) {
+		var req ClosePollRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		if _, err := ss.ClosePoll(s.ID(), req.RoomID, req.PollID); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+		}
+	})
+
+	ss.IO.OnEvent("", "reaction", func(s socketio.Conn, payload string) {
+		var req ReactionRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		if err := ss.React(s.ID(), req.RoomID, req.Emoji); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+		}
+	})
+}
+
+// participantIn returns the room and the sender's participant
+func (ss *SignallingServer) participantIn(socketID, roomID string) (*Room, *Participant, error) {
+	room, exists := ss.RoomManager.GetRoom(roomID)
+	if !exists {
+		return nil, nil, errRoomNotFound
+	}
+	sender, ok := room.GetParticipant(socketID)
+	if !ok {
+		return nil, nil, errNotInRoom
+	}
+	return room, sender, nil
+}
+
+// RaiseHand puts the sender at the end of the room's hand queue and
+// returns their position, counted from 1
+func (ss *SignallingServer) RaiseHand(socketID, roomID string) (int, error) {
+	room, sender, err := ss.participantIn(socketID, roomID)
+	if err != nil {
+		return 0, err
+	}
+
+	hand := RaisedHand{UserID: sender.UserID, FullName: sender.FullName, RaisedAt: time.Now()}
+	state, err := room.update(func(s *RoomState) error {
+		for _, raised := range s.Hands {
+			if raised.UserID == sender.UserID {
+				return errHandRaised
+			}
+		}
+		s.Hands = append(s.Hands, hand)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	ss.broadcastHands(room)
+	return len(state.Hands), nil
+}
+
+// LowerHand takes a user out of the hand queue. Participants lower their
+// own hand; teachers may lower anyone's, as when giving them the floor.
+func (ss *SignallingServer) LowerHand(socketID, roomID, userID string) error {
+	room, sender, err := ss.participantIn(socketID, roomID)
+	if err != nil {
+		return err
+	}
+	if userID == "" {
+		userID = sender.UserID
+	}
+	if userID != sender.UserID && !isStaff(sender.Role) {
+		return errNotStaff
+	}
+
+	if err := room.lowerHand(userID); err != nil {
+		return err
+	}
+	ss.broadcast(roomID, "hand-lowered", map[string]string{
+		"room_id": roomID,
+		"user_id": userID,
+	})
+	ss.broadcastHands(room)
+	return nil
+}
+
+// Hands returns the room's hand queue in the order hands were raised
+func (r *Room) Hands() []RaisedHand {
+	state, err := r.state()
+	if err != nil || state.Hands == nil {
+		return []RaisedHand{}
+	}
+	return state.Hands
+}
+
+// lowerHand removes a user from the hand queue, or returns errHandNotRaised
+func (r *Room) lowerHand(userID string) error {
+	_, err := r.update(func(s *RoomState) error {
+		for i, hand := range s.Hands {
+			if hand.UserID == userID {
+				s.Hands = append(s.Hands[:i], s.Hands[i+1:]...)
+				return nil
+			}
+		}
+		return errHandNotRaised
+	})
+	return err
+}
+
+func (ss *SignallingServer) broadcastHands(room *Room) {
+	ss.broadcast(staffRoom(room.ID), "hand-queue", map[string]interface{}{
+		"room_id": room.ID,
+		"hands":   room.Hands(),
+	})
+}
+
+// CreatePoll starts a poll in the room. Only teachers can create polls.
+func (ss *SignallingServer) CreatePoll(socketID string, req CreatePollRequest) (*PollResults, error) {
+	room, sender, err := ss.participantIn(socketID, req.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if !isStaff(sender.Role) {
+		return nil, errNotStaff
+	}
+
+	req.Question = strings.TrimSpace(req.Question)
+	options := make([]string, 0, len(req.Options))
+	for _, option := range req.Options {
+		if option = strings.TrimSpace(option); option != "" {
+			options = append(options, option)
+		}
+	}
+	if req.Question == "" || len(options) < 2 || len(options) > maxPollOptions || req.Points < 0 {
+		return nil, errInvalidPoll
+	}
+	if req.Anonymous && req.Points > 0 {
+		return nil, errGradedAnonymous
+	}
+	for _, choice := range req.Correct {
+		if choice < 0 || choice >= len(options) {
+			return nil, errInvalidChoice
+		}
+	}
+
+	poll := &Poll{
+		ID:        uuid.New().String(),
+		RoomID:    room.ID,
+		Question:  req.Question,
+		Options:   options,
+		Multiple:  req.Multiple,
+		Anonymous: req.Anonymous,
+		Points:    req.Points,
+		Correct:   req.Correct,
+		CreatedBy: sender.UserID,
+		CreatedAt: time.Now(),
+		Votes:     make(map[string][]int),
+		Staff:     make(map[string]bool),
+	}
+
+	if _, err := room.update(func(s *RoomState) error {
+		if s.Polls == nil {
+			s.Polls = make(map[string]*Poll)
+		}
+		s.Polls[poll.ID] = poll
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	results := poll.results(false)
+
+	ss.broadcast(room.ID, "poll-started", results)
+	return &results, nil
+}
+
+// VotePoll records the sender's choices in an open poll under the user
+// they joined as, replacing their earlier vote, and sends teachers the
+// live tallies
+func (ss *SignallingServer) VotePoll(socketID string, req VotePollRequest) error {
+	room, sender, err := ss.participantIn(socketID, req.RoomID)
+	if err != nil {
+		return err
+	}
+
+	var results PollResults
+	if _, err := room.update(func(s *RoomState) error {
+		poll, ok := s.Polls[req.PollID]
+		if !ok {
+			return errPollNotFound
+		}
+		if !poll.ClosedAt.IsZero() {
+			return errPollClosed
+		}
+		choices, err := validChoices(req.Choices, len(poll.Options), poll.Multiple)
+		if err != nil {
+			return err
+		}
+		if poll.Votes == nil {
+			poll.Votes = make(map[string][]int)
+		}
+		poll.Votes[sender.UserID] = choices
+		if isStaff(sender.Role) {
+			if poll.Staff == nil {
+				poll.Staff = make(map[string]bool)
+			}
+			poll.Staff[sender.UserID] = true
+		}
+		results = poll.results(true)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	ss.broadcast(staffRoom(room.ID), "poll-results", results)
+	return nil
+}
+
+// validChoices returns the distinct, sorted choices of a vote
+func validChoices(choices []int, options int, multiple bool) ([]int, error) {
+	if len(choices) == 0 || (!multiple && len(choices) > 1) {
+		return nil, errInvalidChoice
+	}
+	seen := make(map[int]bool, len(choices))
+	distinct := make([]int, 0, len(choices))
+	for _, choice := range choices {
+		if choice < 0 || choice >= options {
+			return nil, errInvalidChoice
+		}
+		if !seen[choice] {
+			seen[choice] = true
+			distinct = append(distinct, choice)
+		}
+	}
+	sort.Ints(distinct)
+	return distinct, nil
+}
+
+// ClosePoll ends a poll, shows everyone the results and passes it to the
+// poll listeners. Only teachers can close polls.
+func (ss *SignallingServer) ClosePoll(socketID, roomID, pollID string) (*PollResults, error) {
+	room, sender, err := ss.participantIn(socketID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if !isStaff(sender.Role) {
+		return nil, errNotStaff
+	}
+
+	students := ss.studentIDs(room)
+	var event PollClosedEvent
+	if _, err := room.update(func(s *RoomState) error {
+		poll, ok := s.Polls[pollID]
+		if !ok {
+			return errPollNotFound
+		}
+		if !poll.ClosedAt.IsZero() {
+			return errPollClosed
+		}
+		event = s.closePoll(poll, students)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	ss.finishPoll(event)
+	return &event.Results, nil
+}
+
+// closePoll marks a poll closed and removes it from the room. Students
+// are the students in the room, to whom the voters are added.
+func (s *RoomState) closePoll(poll *Poll, students []string) PollClosedEvent {
+	poll.ClosedAt = time.Now()
+	delete(s.Polls, poll.ID)
+
+	closed := *poll
+	closed.Votes, closed.Staff = nil, nil
+	event := PollClosedEvent{Poll: &closed, Results: poll.results(false)}
+	if !poll.Anonymous {
+		event.Votes = poll.results(true).Votes
+	}
+	seen := make(map[string]bool)
+	for _, userID := range students {
+		seen[userID] = true
+		event.Students = append(event.Students, userID)
+	}
+	for userID := range poll.Votes {
+		if !poll.Staff[userID] && !seen[userID] {
+			seen[userID] = true
+			event.Students = append(event.Students, userID)
+		}
+	}
+	sort.Strings(event.Students)
+	return event
+}
+
+// closeAllPolls closes a room's open polls, as when the room empties
+func (ss *SignallingServer) closeAllPolls(roomID string) {
+	var students []string
+	if room, exists := ss.RoomManager.GetRoom(roomID); exists {
+		students = ss.studentIDs(room)
+	}
+	var events []PollClosedEvent
+	if _, err := ss.RoomManager.update(roomID, func(s *RoomState) error {
+		events = make([]PollClosedEvent, 0, len(s.Polls))
+		for _, poll := range s.Polls {
+			events = append(events, s.closePoll(poll, students))
+		}
+		return nil
+	}); err != nil {
+		return
+	}
+
+	for _, event := range events {
+		ss.finishPoll(event)
+	}
+}
+
+// finishPoll shows the results of a closed poll and passes it to the
+// listeners
+func (ss *SignallingServer) finishPoll(event PollClosedEvent) {
+	ss.broadcast(event.Poll.RoomID, "poll-closed", event.Results)
+
+	ss.listenersMu.RLock()
+	listeners := ss.pollListeners
+	ss.listenersMu.RUnlock()
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
+
+// OnPollClosed registers a listener for closed polls. Listeners are called
+// synchronously and should return quickly.
+func (ss *SignallingServer) OnPollClosed(listener func(PollClosedEvent)) {
+	ss.listenersMu.Lock()
+	defer ss.listenersMu.Unlock()
+	ss.pollListeners = append(ss.pollListeners, listener)
+}
+
+// React broadcasts the sender's emoji reaction to the room
+func (ss *SignallingServer) React(socketID, roomID, emoji string) error {
+	room, sender, err := ss.participantIn(socketID, roomID)
+	if err != nil {
+		return err
+	}
+	if !Reactions[emoji] {
+		return errUnknownReaction
+	}
+
+	now := time.Now()
+	room.mu.Lock()
+	if room.lastReaction == nil {
+		room.lastReaction = make(map[string]time.Time)
+	}
+	if now.Sub(room.lastReaction[socketID]) < reactionInterval {
+		room.mu.Unlock()
+		return errReactionTooSoon
+	}
+	room.lastReaction[socketID] = now
+	room.mu.Unlock()
+
+	ss.broadcast(roomID, "reaction", ReactionEvent{
+		RoomID:   roomID,
+		UserID:   sender.UserID,
+		FullName: sender.FullName,
+		Emoji:    emoji,
+		At:       now,
+	})
+	return nil
+}
@@ -0,0 +1,177 @@
+package signalling
+
+import (
+	"context"
+	"testing"
+)
+
+// newInteractionRoom creates a server with a teacher and two students in
+// room-1
+func newInteractionRoom(t *testing.T) (*SignallingServer, *Room) {
+	t.Helper()
+	ss, err := NewSignallingServer()
+	if err != nil {
+		t.Fatalf("Failed to create signalling server: %v", err)
+	}
+	ss.Mediasoup = nil
+	ss.RoomManager.CreateRoom("room-1", "Test Room")
+	room, _ := ss.RoomManager.GetRoom("room-1")
+	room.AddParticipant("socket-1", "teacher-1", "t@example.com", "Teacher", "teacher", true)
+	room.AddParticipant("socket-2", "student-1", "s1@example.com", "Student 1", "student", false)
+	room.AddParticipant("socket-3", "student-2", "s2@example.com", "Student 2", "student", false)
+	return ss, room
+}
+
+// TestHandQueue tests that raised hands queue in order, that students
+// lower only their own and that leaving the room lowers a hand
+func TestHandQueue(t *testing.T) {
+	ss, room := newInteractionRoom(t)
+
+	if pos, err := ss.RaiseHand("socket-3", "room-1"); err != nil || pos != 1 {
+		t.Fatalf("Expected position 1, got %d (%v)", pos, err)
+	}
+	if pos, err := ss.RaiseHand("socket-2", "room-1"); err != nil || pos != 2 {
+		t.Fatalf("Expected position 2, got %d (%v)", pos, err)
+	}
+	if _, err := ss.RaiseHand("socket-2", "room-1"); err != errHandRaised {
+		t.Errorf("Expected errHandRaised, got %v", err)
+	}
+
+	hands := room.Hands()
+	if len(hands) != 2 || hands[0].UserID != "student-2" || hands[1].UserID != "student-1" {
+		t.Fatalf("Unexpected hand queue %+v", hands)
+	}
+
+	if err := ss.LowerHand("socket-2", "room-1", "student-2"); err != errNotStaff {
+		t.Errorf("Expected errNotStaff, got %v", err)
+	}
+	if err := ss.LowerHand("socket-1", "room-1", "student-2"); err != nil {
+		t.Fatalf("Teacher failed to lower a hand: %v", err)
+	}
+	if err := ss.LowerHand("socket-3", "room-1", ""); err != errHandNotRaised {
+		t.Errorf("Expected errHandNotRaised, got %v", err)
+	}
+
+	ss.removeParticipant(context.Background(), room, "socket-2")
+	if hands := room.Hands(); len(hands) != 0 {
+		t.Errorf("Expected the hand lowered on leaving, got %+v", hands)
+	}
+
+	t.Log("✓ Hands queued in order")
+}
+
+// TestPolls tests creating, voting in and closing a graded poll
+func TestPolls(t *testing.T) {
+	ss, _ := newInteractionRoom(t)
+
+	var closed []PollClosedEvent
+	ss.OnPollClosed(func(event PollClosedEvent) {
+		closed = append(closed, event)
+	})
+
+	req := CreatePollRequest{RoomID: "room-1", Question: "2 + 2?", Options: []string{"3", "4", " "}, Points: 5, Correct: []int{1}}
+	if _, err := ss.CreatePoll("socket-2", req); err != errNotStaff {
+		t.Errorf("Expected errNotStaff, got %v", err)
+	}
+	started, err := ss.CreatePoll("socket-1", req)
+	if err != nil {
+		t.Fatalf("Failed to create poll: %v", err)
+	}
+	if len(started.Options) != 2 || started.Closed {
+		t.Errorf("Unexpected poll %+v", started)
+	}
+
+	if err := ss.VotePoll("socket-2", VotePollRequest{RoomID: "room-1", PollID: started.PollID, Choices: []int{0, 1}}); err != errInvalidChoice {
+		t.Errorf("Expected errInvalidChoice for two choices, got %v", err)
+	}
+	if err := ss.VotePoll("socket-2", VotePollRequest{RoomID: "room-1", PollID: started.PollID, Choices: []int{0}}); err != nil {
+		t.Fatalf("Failed to vote: %v", err)
+	}
+	// A second vote replaces the first
+	if err := ss.VotePoll("socket-2", VotePollRequest{RoomID: "room-1", PollID: started.PollID, Choices: []int{1}}); err != nil {
+		t.Fatalf("Failed to vote: %v", err)
+	}
+
+	results, err := ss.ClosePoll("socket-1", "room-1", started.PollID)
+	if err != nil {
+		t.Fatalf("Failed to close poll: %v", err)
+	}
+	if results.Tallies[0] != 0 || results.Tallies[1] != 1 || results.Voters != 1 || !results.Closed || results.Votes != nil {
+		t.Errorf("Unexpected results %+v", results)
+	}
+	if err := ss.VotePoll("socket-3", VotePollRequest{RoomID: "room-1", PollID: started.PollID, Choices: []int{1}}); err != errPollNotFound {
+		t.Errorf("Expected errPollNotFound after closing, got %v", err)
+	}
+
+	if len(closed) != 1 {
+		t.Fatalf("Expected 1 closed poll, got %d", len(closed))
+	}
+	event := closed[0]
+	if event.Poll.Points != 5 || len(event.Votes["student-1"]) != 1 || event.Votes["student-1"][0] != 1 {
+		t.Errorf("Unexpected closed poll %+v", event)
+	}
+	if len(event.Students) != 2 || event.Students[0] != "student-1" || event.Students[1] != "student-2" {
+		t.Errorf("Expected both students, got %v", event.Students)
+	}
+
+	t.Log("✓ Poll votes tallied and passed to listeners")
+}
+
+// TestAnonymousPolls tests that anonymous polls keep no votes and cannot
+// be graded, and that open polls close when the room empties
+func TestAnonymousPolls(t *testing.T) {
+	ss, room := newInteractionRoom(t)
+
+	var closed []PollClosedEvent
+	ss.OnPollClosed(func(event PollClosedEvent) {
+		closed = append(closed, event)
+	})
+
+	req := CreatePollRequest{RoomID: "room-1", Question: "Too fast?", Options: []string{"Yes", "No"}, Anonymous: true, Points: 1}
+	if _, err := ss.CreatePoll("socket-1", req); err != errGradedAnonymous {
+		t.Errorf("Expected errGradedAnonymous, got %v", err)
+	}
+	req.Points = 0
+	req.Multiple = true
+	started, err := ss.CreatePoll("socket-1", req)
+	if err != nil {
+		t.Fatalf("Failed to create poll: %v", err)
+	}
+	if err := ss.VotePoll("socket-3", VotePollRequest{RoomID: "room-1", PollID: started.PollID, Choices: []int{1, 0, 1}}); err != nil {
+		t.Fatalf("Failed to vote: %v", err)
+	}
+
+	for _, socketID := range []string{"socket-1", "socket-2", "socket-3"} {
+		ss.removeParticipant(context.Background(), room, socketID)
+	}
+
+	if len(closed) != 1 {
+		t.Fatalf("Expected the poll closed with the room, got %d", len(closed))
+	}
+	if closed[0].Votes != nil || closed[0].Results.Tallies[0] != 1 || closed[0].Results.Tallies[1] != 1 {
+		t.Errorf("Unexpected anonymous results %+v", closed[0])
+	}
+
+	t.Log("✓ Anonymous polls keep only tallies")
+}
+
+// TestReactions tests that only known emoji are accepted and that a
+// connection cannot flood the room
+func TestReactions(t *testing.T) {
+	ss, _ := newInteractionRoom(t)
+
+	if err := ss.React("socket-2", "room-1", "👍"); err != nil {
+		t.Fatalf("Failed to react: %v", err)
+	}
+	if err := ss.React("socket-2", "room-1", "🎉"); err != errReactionTooSoon {
+		t.Errorf("Expected errReactionTooSoon, got %v", err)
+	}
+	if err := ss.React("socket-3", "room-1", "💩"); err != errUnknownReaction {
+		t.Errorf("Expected errUnknownReaction, got %v", err)
+	}
+	if err := ss.React("socket-9", "room-1", "👍"); err != errNotInRoom {
+		t.Errorf("Expected errNotInRoom, got %v", err)
+	}
+
+	t.Log("✓ Reactions validated")
+}
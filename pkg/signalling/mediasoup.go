@@ -1,9 +1,10 @@
 package signalling
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 
 	"github.com/Bashar444/VTP/pkg/mediasoup"
 	socketio "github.com/googollee/go-socket.io"
@@ -28,7 +29,7 @@ func NewMediasoupIntegration(mediasoupURL string) *MediasoupIntegration {
 }
 
 // OnJoinRoom handles Mediasoup integration when a peer joins
-func (mi *MediasoupIntegration) OnJoinRoom(roomID, peerId, userId, email, fullName, role string, isProducer bool) (*mediasoup.JoinRoomResponse, error) {
+func (mi *MediasoupIntegration) OnJoinRoom(ctx context.Context, roomID, peerId, userId, email, fullName, role string, isProducer bool) (*mediasoup.JoinRoomResponse, error) {
 	// Create room in Mediasoup
 	joinReq := &mediasoup.JoinRoomRequest{
 		PeerID:     peerId,
@@ -42,7 +43,7 @@ func (mi *MediasoupIntegration) OnJoinRoom(roomID, peerId, userId, email, fullNa
 
 	resp, err := mi.MediasoupClient.JoinRoom(roomID, joinReq)
 	if err != nil {
-		log.Printf("❌ Failed to join room in Mediasoup: %v", err)
+		slog.ErrorContext(ctx, "Failed to join room in Mediasoup", "room_id", roomID, "peer_id", peerId, "error", err)
 		return nil, err
 	}
 
@@ -53,17 +54,17 @@ func (mi *MediasoupIntegration) OnJoinRoom(roomID, peerId, userId, email, fullNa
 		mi.RoomConsumers[roomID] = make(map[string]*mediasoup.Consumer)
 	}
 
-	log.Printf("✓ Peer %s joined room %s in Mediasoup", peerId, roomID)
+	slog.InfoContext(ctx, "Peer joined room in Mediasoup", "room_id", roomID, "peer_id", peerId)
 	return resp, nil
 }
 
 // OnLeaveRoom handles cleanup when a peer leaves
-func (mi *MediasoupIntegration) OnLeaveRoom(roomID, peerId string) error {
+func (mi *MediasoupIntegration) OnLeaveRoom(ctx context.Context, roomID, peerId string) error {
 	// Close all producers for this peer
 	if producers, exists := mi.RoomProducers[roomID]; exists {
 		if producer, hasProducer := producers[peerId]; hasProducer {
 			if err := mi.MediasoupClient.CloseProducer(roomID, producer.ID); err != nil {
-				log.Printf("⚠ Failed to close producer: %v", err)
+				slog.WarnContext(ctx, "Failed to close producer", "room_id", roomID, "producer_id", producer.ID, "error", err)
 			}
 			delete(producers, peerId)
 		}
@@ -73,7 +74,7 @@ func (mi *MediasoupIntegration) OnLeaveRoom(roomID, peerId string) error {
 	if consumers, exists := mi.RoomConsumers[roomID]; exists {
 		if consumer, hasConsumer := consumers[peerId]; hasConsumer {
 			if err := mi.MediasoupClient.CloseConsumer(roomID, consumer.ID); err != nil {
-				log.Printf("⚠ Failed to close consumer: %v", err)
+				slog.WarnContext(ctx, "Failed to close consumer", "room_id", roomID, "consumer_id", consumer.ID, "error", err)
 			}
 			delete(consumers, peerId)
 		}
@@ -87,7 +88,7 @@ func (mi *MediasoupIntegration) OnLeaveRoom(roomID, peerId string) error {
 	// Remove peer from room in Mediasoup
 	err := mi.MediasoupClient.LeaveRoom(roomID, peerId)
 	if err != nil {
-		log.Printf("❌ Failed to leave room in Mediasoup: %v", err)
+		slog.ErrorContext(ctx, "Failed to leave room in Mediasoup", "room_id", roomID, "peer_id", peerId, "error", err)
 		return err
 	}
 
@@ -99,15 +100,15 @@ func (mi *MediasoupIntegration) OnLeaveRoom(roomID, peerId string) error {
 		delete(mi.RoomConsumers, roomID)
 	}
 
-	log.Printf("✓ Peer %s left room %s in Mediasoup", peerId, roomID)
+	slog.InfoContext(ctx, "Peer left room in Mediasoup", "room_id", roomID, "peer_id", peerId)
 	return nil
 }
 
 // CreateTransport creates a WebRTC transport in Mediasoup
-func (mi *MediasoupIntegration) CreateTransport(roomID, peerId, direction string) (*mediasoup.Transport, error) {
+func (mi *MediasoupIntegration) CreateTransport(ctx context.Context, roomID, peerId, direction string) (*mediasoup.Transport, error) {
 	transport, err := mi.MediasoupClient.CreateTransport(roomID, peerId, direction)
 	if err != nil {
-		log.Printf("❌ Failed to create transport: %v", err)
+		slog.ErrorContext(ctx, "Failed to create transport", "room_id", roomID, "peer_id", peerId, "error", err)
 		return nil, err
 	}
 
@@ -117,33 +118,35 @@ func (mi *MediasoupIntegration) CreateTransport(roomID, peerId, direction string
 	}
 	mi.RoomTransports[roomID][peerId] = transport
 
-	log.Printf("✓ Created transport %s for peer %s", transport.TransportID, peerId)
+	slog.InfoContext(ctx, "Created transport", "room_id", roomID, "peer_id", peerId, "transport_id", transport.TransportID)
 	return transport, nil
 }
 
 // ConnectTransport connects a transport with DTLS parameters
-func (mi *MediasoupIntegration) ConnectTransport(roomID, peerId, transportID string, dtlsParams mediasoup.DtlsParameters) error {
+func (mi *MediasoupIntegration) ConnectTransport(ctx context.Context, roomID, peerId, transportID string, dtlsParams mediasoup.DtlsParameters) error {
 	err := mi.MediasoupClient.ConnectTransport(roomID, transportID, dtlsParams)
 	if err != nil {
-		log.Printf("❌ Failed to connect transport: %v", err)
+		slog.ErrorContext(ctx, "Failed to connect transport", "room_id", roomID, "transport_id", transportID, "error", err)
 		return err
 	}
 
-	log.Printf("✓ Connected transport %s", transportID)
+	slog.InfoContext(ctx, "Connected transport", "room_id", roomID, "transport_id", transportID)
 	return nil
 }
 
-// CreateProducer creates a media producer in Mediasoup
-func (mi *MediasoupIntegration) CreateProducer(roomID, peerId string, kind string, rtpParams interface{}) (*mediasoup.Producer, error) {
+// CreateProducer creates a media producer in Mediasoup. Source is screen for
+// a screen share and may be empty for a camera or microphone.
+func (mi *MediasoupIntegration) CreateProducer(ctx context.Context, roomID, peerId string, kind, source string, rtpParams interface{}) (*mediasoup.Producer, error) {
 	req := &mediasoup.ProducerRequest{
 		PeerID:        peerId,
 		Kind:          kind,
+		Source:        source,
 		RtpParameters: rtpParams,
 	}
 
 	producer, err := mi.MediasoupClient.CreateProducer(roomID, req)
 	if err != nil {
-		log.Printf("❌ Failed to create producer: %v", err)
+		slog.ErrorContext(ctx, "Failed to create producer", "room_id", roomID, "peer_id", peerId, "kind", kind, "error", err)
 		return nil, err
 	}
 
@@ -153,12 +156,12 @@ func (mi *MediasoupIntegration) CreateProducer(roomID, peerId string, kind strin
 	}
 	mi.RoomProducers[roomID][peerId] = producer
 
-	log.Printf("✓ Created %s producer %s for peer %s", kind, producer.ID, peerId)
+	slog.InfoContext(ctx, "Created producer", "room_id", roomID, "peer_id", peerId, "kind", kind, "producer_id", producer.ID)
 	return producer, nil
 }
 
 // CreateConsumer creates a media consumer in Mediasoup
-func (mi *MediasoupIntegration) CreateConsumer(roomID, peerId, producerID string, rtpCaps interface{}) (*mediasoup.Consumer, error) {
+func (mi *MediasoupIntegration) CreateConsumer(ctx context.Context, roomID, peerId, producerID string, rtpCaps interface{}) (*mediasoup.Consumer, error) {
 	req := &mediasoup.ConsumerRequest{
 		PeerID:          peerId,
 		ProducerID:      producerID,
@@ -167,7 +170,7 @@ func (mi *MediasoupIntegration) CreateConsumer(roomID, peerId, producerID string
 
 	consumer, err := mi.MediasoupClient.CreateConsumer(roomID, req)
 	if err != nil {
-		log.Printf("❌ Failed to create consumer: %v", err)
+		slog.ErrorContext(ctx, "Failed to create consumer", "room_id", roomID, "peer_id", peerId, "producer_id", producerID, "error", err)
 		return nil, err
 	}
 
@@ -177,15 +180,15 @@ func (mi *MediasoupIntegration) CreateConsumer(roomID, peerId, producerID string
 	}
 	mi.RoomConsumers[roomID][peerId] = consumer
 
-	log.Printf("✓ Created consumer %s for peer %s from producer %s", consumer.ID, peerId, producerID)
+	slog.InfoContext(ctx, "Created consumer", "room_id", roomID, "peer_id", peerId, "producer_id", producerID, "consumer_id", consumer.ID)
 	return consumer, nil
 }
 
 // CloseProducer closes a producer
-func (mi *MediasoupIntegration) CloseProducer(roomID, peerId, producerID string) error {
+func (mi *MediasoupIntegration) CloseProducer(ctx context.Context, roomID, peerId, producerID string) error {
 	err := mi.MediasoupClient.CloseProducer(roomID, producerID)
 	if err != nil {
-		log.Printf("❌ Failed to close producer: %v", err)
+		slog.ErrorContext(ctx, "Failed to close producer", "room_id", roomID, "producer_id", producerID, "error", err)
 		return err
 	}
 
@@ -193,15 +196,36 @@ func (mi *MediasoupIntegration) CloseProducer(roomID, peerId, producerID string)
 		delete(producers, peerId)
 	}
 
-	log.Printf("✓ Closed producer %s", producerID)
+	slog.InfoContext(ctx, "Closed producer", "room_id", roomID, "producer_id", producerID)
 	return nil
 }
 
+// ClosePeerProducers closes a peer's producers of a kind, leaving screen
+// shares open when closing video, and returns the IDs of those closed
+func (mi *MediasoupIntegration) ClosePeerProducers(ctx context.Context, roomID, peerId, kind string) ([]string, error) {
+	producers, err := mi.MediasoupClient.GetProducers(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	var closed []string
+	for _, producer := range producers {
+		if producer.PeerID != peerId || producer.Kind != kind || (kind == "video" && producer.Source == "screen") {
+			continue
+		}
+		if err := mi.CloseProducer(ctx, roomID, peerId, producer.ID); err != nil {
+			return closed, err
+		}
+		closed = append(closed, producer.ID)
+	}
+	return closed, nil
+}
+
 // CloseConsumer closes a consumer
-func (mi *MediasoupIntegration) CloseConsumer(roomID, peerId, consumerID string) error {
+func (mi *MediasoupIntegration) CloseConsumer(ctx context.Context, roomID, peerId, consumerID string) error {
 	err := mi.MediasoupClient.CloseConsumer(roomID, consumerID)
 	if err != nil {
-		log.Printf("❌ Failed to close consumer: %v", err)
+		slog.ErrorContext(ctx, "Failed to close consumer", "room_id", roomID, "consumer_id", consumerID, "error", err)
 		return err
 	}
 
@@ -209,7 +233,7 @@ func (mi *MediasoupIntegration) CloseConsumer(roomID, peerId, consumerID string)
 		delete(consumers, peerId)
 	}
 
-	log.Printf("✓ Closed consumer %s", consumerID)
+	slog.InfoContext(ctx, "Closed consumer", "room_id", roomID, "consumer_id", consumerID)
 	return nil
 }
 
@@ -232,14 +256,15 @@ func (ss *SignallingServer) RegisterMediasoupHandlers(mi *MediasoupIntegration)
 			return
 		}
 
-		transport, err := mi.CreateTransport(req.RoomID, s.ID(), req.Direction)
+		ctx := connContext(s)
+		transport, err := mi.CreateTransport(ctx, req.RoomID, s.ID(), req.Direction)
 		if err != nil {
 			s.Emit("error", map[string]string{"error": fmt.Sprintf("Failed to create transport: %v", err)})
 			return
 		}
 
 		s.Emit("transport-created", transport)
-		log.Printf("✓ Transport created for client %s", s.ID())
+		slog.DebugContext(ctx, "Transport created for client")
 	})
 
 	// Connect transport with DTLS
@@ -255,14 +280,15 @@ func (ss *SignallingServer) RegisterMediasoupHandlers(mi *MediasoupIntegration)
 			return
 		}
 
-		err := mi.ConnectTransport(req.RoomID, s.ID(), req.TransportID, req.DtlsParameters)
+		ctx := connContext(s)
+		err := mi.ConnectTransport(ctx, req.RoomID, s.ID(), req.TransportID, req.DtlsParameters)
 		if err != nil {
 			s.Emit("error", map[string]string{"error": fmt.Sprintf("Failed to connect transport: %v", err)})
 			return
 		}
 
 		s.Emit("transport-connected", map[string]string{"transportId": req.TransportID})
-		log.Printf("✓ Transport connected for client %s", s.ID())
+		slog.DebugContext(ctx, "Transport connected for client")
 	})
 
 	// Produce media
@@ -270,6 +296,7 @@ func (ss *SignallingServer) RegisterMediasoupHandlers(mi *MediasoupIntegration)
 		var req struct {
 			RoomID        string      `json:"roomId"`
 			Kind          string      `json:"kind"`
+			Source        string      `json:"source"`
 			RtpParameters interface{} `json:"rtpParameters"`
 		}
 
@@ -278,7 +305,13 @@ func (ss *SignallingServer) RegisterMediasoupHandlers(mi *MediasoupIntegration)
 			return
 		}
 
-		producer, err := mi.CreateProducer(req.RoomID, s.ID(), req.Kind, req.RtpParameters)
+		if err := ss.checkProduce(req.RoomID, s.ID(), req.Kind, req.Source); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+			return
+		}
+
+		ctx := connContext(s)
+		producer, err := mi.CreateProducer(ctx, req.RoomID, s.ID(), req.Kind, req.Source, req.RtpParameters)
 		if err != nil {
 			s.Emit("error", map[string]string{"error": fmt.Sprintf("Failed to produce: %v", err)})
 			return
@@ -286,12 +319,13 @@ func (ss *SignallingServer) RegisterMediasoupHandlers(mi *MediasoupIntegration)
 
 		s.Emit("producer-created", producer)
 		// Notify other peers in the room about new producer (for consumers to subscribe)
-		ss.IO.BroadcastToRoom("", req.RoomID, "newProducer", map[string]string{
+		ss.broadcast(req.RoomID, "newProducer", map[string]string{
 			"producerId": producer.ID,
 			"peerId":     s.ID(),
 			"kind":       producer.Kind,
+			"source":     producer.Source,
 		})
-		log.Printf("✓ Producer created for client %s (kind: %s)", s.ID(), req.Kind)
+		slog.DebugContext(ctx, "Producer created for client", "kind", req.Kind)
 	})
 
 	// Consume media
@@ -307,14 +341,15 @@ func (ss *SignallingServer) RegisterMediasoupHandlers(mi *MediasoupIntegration)
 			return
 		}
 
-		consumer, err := mi.CreateConsumer(req.RoomID, s.ID(), req.ProducerID, req.RtpCapabilities)
+		ctx := connContext(s)
+		consumer, err := mi.CreateConsumer(ctx, req.RoomID, s.ID(), req.ProducerID, req.RtpCapabilities)
 		if err != nil {
 			s.Emit("error", map[string]string{"error": fmt.Sprintf("Failed to consume: %v", err)})
 			return
 		}
 
 		s.Emit("consumer-created", consumer)
-		log.Printf("✓ Consumer created for client %s (producer: %s)", s.ID(), req.ProducerID)
+		slog.DebugContext(ctx, "Consumer created for client", "producer_id", req.ProducerID)
 	})
 
 	// Close producer
@@ -329,14 +364,15 @@ func (ss *SignallingServer) RegisterMediasoupHandlers(mi *MediasoupIntegration)
 			return
 		}
 
-		err := mi.CloseProducer(req.RoomID, s.ID(), req.ProducerID)
+		ctx := connContext(s)
+		err := mi.CloseProducer(ctx, req.RoomID, s.ID(), req.ProducerID)
 		if err != nil {
 			s.Emit("error", map[string]string{"error": fmt.Sprintf("Failed to close producer: %v", err)})
 			return
 		}
 
 		s.Emit("producer-closed", map[string]string{"producerId": req.ProducerID})
-		log.Printf("✓ Producer closed for client %s", s.ID())
+		slog.DebugContext(ctx, "Producer closed for client")
 	})
 
 	// Close consumer
@@ -351,14 +387,15 @@ func (ss *SignallingServer) RegisterMediasoupHandlers(mi *MediasoupIntegration)
 			return
 		}
 
-		err := mi.CloseConsumer(req.RoomID, s.ID(), req.ConsumerID)
+		ctx := connContext(s)
+		err := mi.CloseConsumer(ctx, req.RoomID, s.ID(), req.ConsumerID)
 		if err != nil {
 			s.Emit("error", map[string]string{"error": fmt.Sprintf("Failed to close consumer: %v", err)})
 			return
 		}
 
 		s.Emit("consumer-closed", map[string]string{"consumerId": req.ConsumerID})
-		log.Printf("✓ Consumer closed for client %s", s.ID())
+		slog.DebugContext(ctx, "Consumer closed for client")
 	})
 
 	// Get room info from Mediasoup
@@ -379,6 +416,6 @@ func (ss *SignallingServer) RegisterMediasoupHandlers(mi *MediasoupIntegration)
 		}
 
 		s.Emit("room-info", roomInfo)
-		log.Printf("✓ Room info retrieved for %s", req.RoomID)
+		slog.DebugContext(connContext(s), "Room info retrieved", "room_id", req.RoomID)
 	})
 }
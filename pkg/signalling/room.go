@@ -1,29 +1,40 @@
 package signalling
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
 	"sync"
 	"time"
 )
 
-// Room represents a live session/classroom
+// Room represents a live session/classroom on this node. Participants
+// are the connections of this node; what every node acts on is kept in
+// the room's shared state.
 type Room struct {
-	ID          string
-	Name        string
+	ID           string
+	Name         string
 	Participants map[string]*Participant // key: socket ID
-	mu          sync.RWMutex
+	ParentID     string                  // main room of a breakout room
+	mu           sync.RWMutex
+
+	states         RoomStates
+	pending        map[string]JoinRoomRequest // this node's connections in the lobby, key: socket ID
+	breakoutsTimer *time.Timer
+	lastReaction   map[string]time.Time // key: socket ID
 }
 
 // Participant represents a user in a room
 type Participant struct {
-	SocketID  string
-	UserID    string
-	Email     string
-	FullName  string
-	Role      string // student, teacher, admin
+	SocketID   string
+	UserID     string
+	Email      string
+	FullName   string
+	Role       string // student, teacher, admin
 	IsProducer bool   // Can send media
 	IsConsumer bool   // Receiving media
-	JoinedAt  int64  // Timestamp
+	JoinedAt   int64  // Timestamp
 }
 
 // Message types for WebRTC signalling
@@ -38,14 +49,16 @@ type SignallingMessage struct {
 
 // RoomManager manages all active rooms
 type RoomManager struct {
-	Rooms map[string]*Room
-	mu    sync.RWMutex
+	Rooms  map[string]*Room
+	mu     sync.RWMutex
+	states RoomStates
 }
 
-// NewRoomManager creates a new room manager
+// NewRoomManager creates a new room manager keeping room states in memory
 func NewRoomManager() *RoomManager {
 	return &RoomManager{
-		Rooms: make(map[string]*Room),
+		Rooms:  make(map[string]*Room),
+		states: NewMemoryAdapter(),
 	}
 }
 
@@ -54,14 +67,21 @@ func (rm *RoomManager) CreateRoom(roomID, roomName string) *Room {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
 
+	room := rm.newRoom(roomID, roomName, "")
+	slog.Info("Room created", "room_id", roomID, "room_name", roomName)
+	return room
+}
+
+// newRoom adds a room. The manager must be locked.
+func (rm *RoomManager) newRoom(roomID, roomName, parentID string) *Room {
 	room := &Room{
 		ID:           roomID,
 		Name:         roomName,
+		ParentID:     parentID,
 		Participants: make(map[string]*Participant),
+		states:       rm.states,
 	}
-
 	rm.Rooms[roomID] = room
-	log.Printf("✓ Room created: %s (%s)", roomID, roomName)
 	return room
 }
 
@@ -80,7 +100,114 @@ func (rm *RoomManager) DeleteRoom(roomID string) {
 	defer rm.mu.Unlock()
 
 	delete(rm.Rooms, roomID)
-	log.Printf("✓ Room deleted: %s", roomID)
+	slog.Info("Room deleted", "room_id", roomID)
+}
+
+// breakoutID names the nth breakout room of a main room, counted from 1
+func breakoutID(parentID string, n int) string {
+	return fmt.Sprintf("%s:breakout-%d", parentID, n)
+}
+
+// AddBreakout returns this node's room for a breakout room open in a main
+// room, creating it, and the main room, if this node has none yet
+func (rm *RoomManager) AddBreakout(parentID string, breakout BreakoutRoom) *Room {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if _, exists := rm.Rooms[parentID]; !exists {
+		rm.newRoom(parentID, "", "")
+	}
+	if room, exists := rm.Rooms[breakout.ID]; exists {
+		return room
+	}
+	room := rm.newRoom(breakout.ID, breakout.Name, parentID)
+	slog.Info("Breakout room created", "room_id", room.ID, "parent_room_id", parentID)
+	return room
+}
+
+// Breakouts returns the breakout rooms open in a main room, in order
+func (rm *RoomManager) Breakouts(parentID string) []*Room {
+	state, err := rm.state(parentID)
+	if err != nil {
+		return nil
+	}
+	rooms := make([]*Room, 0, len(state.Breakouts))
+	for _, breakout := range state.Breakouts {
+		rooms = append(rooms, rm.AddBreakout(parentID, breakout))
+	}
+	return rooms
+}
+
+// DeleteBreakouts closes the breakout rooms of a main room and forgets
+// where its users were assigned
+func (rm *RoomManager) DeleteBreakouts(parentID string) error {
+	_, err := rm.update(parentID, func(s *RoomState) error {
+		s.Breakouts = nil
+		s.Assignments = nil
+		s.BreakoutsCloseAt = time.Time{}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	for id, room := range rm.Rooms {
+		if room.ParentID == parentID {
+			delete(rm.Rooms, id)
+		}
+	}
+	slog.Info("Breakout rooms deleted", "room_id", parentID)
+	return nil
+}
+
+// Family returns this node's rooms of a main room's family: the main room
+// and its breakout rooms
+func (rm *RoomManager) Family(parentID string) []*Room {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	var rooms []*Room
+	for id, room := range rm.Rooms {
+		if id == parentID || room.ParentID == parentID {
+			rooms = append(rooms, room)
+		}
+	}
+	return rooms
+}
+
+// RootID returns the main room of a room: the parent of a breakout room,
+// the room itself otherwise. Breakout rooms another node opened are known
+// by their ID.
+func (rm *RoomManager) RootID(roomID string) string {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	if room, exists := rm.Rooms[roomID]; exists && room.ParentID != "" {
+		return room.ParentID
+	}
+	if i := strings.LastIndex(roomID, ":breakout-"); i > 0 {
+		return roomID[:i]
+	}
+	return roomID
+}
+
+// state returns the shared state of a room
+func (rm *RoomManager) state(roomID string) (*RoomState, error) {
+	return loadState(rm.states, roomID)
+}
+
+// update changes the shared state of a room
+func (rm *RoomManager) update(roomID string, fn func(*RoomState) error) (*RoomState, error) {
+	return updateState(rm.states, roomID, fn)
+}
+
+// deleteState forgets the shared state of a room
+func (rm *RoomManager) deleteState(roomID string) {
+	if err := rm.states.DeleteRoomState(context.Background(), roomID); err != nil {
+		slog.Warn("Room state not deleted", "room_id", roomID, "error", err)
+	}
 }
 
 // GetAllRooms returns all active rooms
@@ -123,7 +250,7 @@ func (r *Room) AddParticipant(socketID, userID, email, fullName, role string, is
 	}
 
 	r.Participants[socketID] = participant
-	log.Printf("✓ Participant joined room %s: %s (%s) - Producer: %v", r.ID, fullName, email, isProducer)
+	slog.Info("Participant joined room", "room_id", r.ID, "socket_id", socketID, "participant_user_id", userID, "producer", isProducer)
 
 	return participant
 }
@@ -139,7 +266,7 @@ func (r *Room) RemoveParticipant(socketID string) *Participant {
 	}
 
 	delete(r.Participants, socketID)
-	log.Printf("✓ Participant left room %s: %s (%s)", r.ID, participant.FullName, participant.Email)
+	slog.Info("Participant left room", "room_id", r.ID, "socket_id", socketID, "participant_user_id", participant.UserID)
 
 	return participant
 }
@@ -153,6 +280,19 @@ func (r *Room) GetParticipant(socketID string) (*Participant, bool) {
 	return participant, exists
 }
 
+// HasUser reports whether a user has a connection in the room
+func (r *Room) HasUser(userID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, p := range r.Participants {
+		if p.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
 // GetAllParticipants returns all participants in the room
 func (r *Room) GetAllParticipants() []*Participant {
 	r.mu.RLock()
@@ -194,3 +334,13 @@ func (r *Room) IsEmpty() bool {
 
 	return len(r.Participants) == 0
 }
+
+// state returns the room's shared state
+func (r *Room) state() (*RoomState, error) {
+	return loadState(r.states, r.ID)
+}
+
+// update changes the room's shared state
+func (r *Room) update(fn func(*RoomState) error) (*RoomState, error) {
+	return updateState(r.states, r.ID, fn)
+}
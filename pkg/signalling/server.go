@@ -1,12 +1,20 @@
 package signalling
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
+	"sync"
+	"time"
 
+	"github.com/Bashar444/VTP/pkg/auth"
+	"github.com/Bashar444/VTP/pkg/logging"
 	"github.com/Bashar444/VTP/pkg/mediasoup"
+	"github.com/Bashar444/VTP/pkg/monitoring"
 	socketio "github.com/googollee/go-socket.io"
+	"github.com/googollee/go-socket.io/engineio"
 )
 
 // SignallingServer manages WebRTC signalling via Socket.IO
@@ -14,16 +22,53 @@ type SignallingServer struct {
 	IO          *socketio.Server
 	RoomManager *RoomManager
 	Mediasoup   *MediasoupIntegration
+
+	// LobbyByDefault keeps students of new rooms in a lobby until the
+	// host admits them
+	LobbyByDefault bool
+
+	// Node names this server among replicas and prefixes its session IDs
+	Node string
+
+	tokens *auth.TokenService
+	rooms  RoomAuthorizer
+
+	connsMu sync.RWMutex
+	conns   map[string]socketio.Conn // this node's connections, key: socket ID
+
+	adapter     Adapter
+	clusterMu   sync.Mutex
+	nodes       map[string]bool // live nodes at the last heartbeat
+	clusterErr  error
+	misrouted   int64
+	misroutedAt time.Time
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+
+	listenersMu       sync.RWMutex
+	listeners         []func(RoomEvent)
+	presenceListeners []func(PresenceEvent)
+	pollListeners     []func(PollClosedEvent)
 }
 
+var (
+	errRoomNotFound     = errors.New("room not found")
+	errNotInRoom        = errors.New("not a participant in this room")
+	errSpeakerNotInRoom = errors.New("speaker is not a participant in this room")
+	errUnknownRoomEvent = errors.New("unknown room event")
+	errPeerNotInRoom    = errors.New("recipient is not a participant in your rooms")
+)
+
 // NewSignallingServer creates a new signalling server
 func NewSignallingServer() (*SignallingServer, error) {
-	server := socketio.NewServer(nil)
+	node := defaultNode()
+	server := socketio.NewServer(&engineio.Options{SessionIDGenerator: &sessionIDs{node: node}})
 
 	ss := &SignallingServer{
 		IO:          server,
 		RoomManager: NewRoomManager(),
 		Mediasoup:   NewMediasoupIntegration("http://localhost:3000"),
+		Node:        node,
 	}
 
 	ss.registerEventHandlers()
@@ -33,12 +78,14 @@ func NewSignallingServer() (*SignallingServer, error) {
 
 // NewSignallingServerWithMediasoup creates a signalling server with custom Mediasoup URL
 func NewSignallingServerWithMediasoup(mediasoupURL string) (*SignallingServer, error) {
-	server := socketio.NewServer(nil)
+	node := defaultNode()
+	server := socketio.NewServer(&engineio.Options{SessionIDGenerator: &sessionIDs{node: node}})
 
 	ss := &SignallingServer{
 		IO:          server,
 		RoomManager: NewRoomManager(),
 		Mediasoup:   NewMediasoupIntegration(mediasoupURL),
+		Node:        node,
 	}
 
 	ss.registerEventHandlers()
@@ -50,16 +97,36 @@ func NewSignallingServerWithMediasoup(mediasoupURL string) (*SignallingServer, e
 // registerEventHandlers sets up all Socket.IO event handlers
 func (ss *SignallingServer) registerEventHandlers() {
 	ss.IO.OnConnect("", func(s socketio.Conn) error {
-		log.Printf("✓ Socket connected: %s", s.ID())
+		ctx, err := ss.authenticate(newConnContext(s), s)
+		if err != nil {
+			slog.WarnContext(ctx, "Socket refused", "remote_addr", s.RemoteAddr().String(), "error", err)
+			return err
+		}
+		s.SetContext(ctx)
+		ss.addConn(s)
+		slog.InfoContext(ctx, "Socket connected", "remote_addr", s.RemoteAddr().String())
 		return nil
 	})
 
 	ss.IO.OnDisconnect("", func(s socketio.Conn, reason string) {
-		log.Printf("✗ Socket disconnected: %s (reason: %s)", s.ID(), reason)
+		ctx := connContext(s)
+		slog.InfoContext(ctx, "Socket disconnected", "reason", reason)
+
+		// A dropped connection leaves its rooms like leave-room would
+		for _, room := range ss.RoomManager.GetAllRooms() {
+			if _, ok := room.GetParticipant(s.ID()); ok || room.isWaiting(s.ID()) {
+				ss.removeParticipant(ctx, room, s.ID())
+			}
+		}
+		ss.removeConn(s.ID())
 	})
 
 	ss.IO.OnError("", func(s socketio.Conn, e error) {
-		log.Printf("❌ Socket error: %v", e)
+		ctx := context.Background()
+		if s != nil {
+			ctx = connContext(s)
+		}
+		slog.ErrorContext(ctx, "Socket error", "error", e)
 	})
 
 	ss.IO.OnEvent("", "join-room", func(s socketio.Conn, payload string) {
@@ -69,59 +136,34 @@ func (ss *SignallingServer) registerEventHandlers() {
 			return
 		}
 
+		if err := ss.authorizeJoin(connContext(s), s, &req); err != nil {
+			s.Emit("join-refused", map[string]string{"room_id": req.RoomID, "reason": err.Error()})
+			return
+		}
+
 		if req.RoomID == "" || req.UserID == "" || req.Email == "" {
 			s.Emit("error", map[string]string{"error": "Missing required fields"})
 			return
 		}
 
-		if !ss.RoomManager.RoomExists(req.RoomID) {
-			ss.RoomManager.CreateRoom(req.RoomID, req.RoomName)
+		// Users assigned to a breakout room go straight back to it
+		if breakout, ok := ss.assignedBreakout(req.RoomID, req.UserID); ok {
+			req.RoomID = breakout.ID
 		}
 
-		room, _ := ss.RoomManager.GetRoom(req.RoomID)
-		_ = room.AddParticipant(
-			s.ID(),
-			req.UserID,
-			req.Email,
-			req.FullName,
-			req.Role,
-			req.IsProducer,
-		)
-
-		s.Join(req.RoomID)
-
-		// Integrate with Mediasoup if available
-		var mediasoupResp *MediasoupJoinResponse
-		if ss.Mediasoup != nil {
-			resp, err := ss.Mediasoup.OnJoinRoom(
-				req.RoomID,
-				s.ID(),
-				req.UserID,
-				req.Email,
-				req.FullName,
-				req.Role,
-				req.IsProducer,
-			)
-			if err != nil {
-				log.Printf("⚠ Mediasoup join failed: %v", err)
-			} else {
-				mediasoupResp = &MediasoupJoinResponse{
-					RtpCapabilities: resp.RtpCapabilities,
-					Peers:           convertMediasoupPeers(resp.Peers),
-				}
-			}
+		room, err := ss.openRoom(req)
+		if err != nil {
+			s.Emit("join-refused", map[string]string{"room_id": req.RoomID, "reason": err.Error()})
+			return
 		}
-
-		response := JoinRoomResponse{
-			Success:       true,
-			RoomID:        req.RoomID,
-			ParticipantID: s.ID(),
-			Participants:  room.GetAllParticipants(),
-			Mediasoup:     mediasoupResp,
+		switch err := ss.admission(room, req); err {
+		case nil:
+			ss.joinRoom(s, room, req)
+		case errWaitForHost:
+			ss.wait(s, room, req)
+		default:
+			s.Emit("join-refused", map[string]string{"room_id": req.RoomID, "reason": err.Error()})
 		}
-		s.Emit("joined-room", response)
-
-		log.Printf("✓ User %s joined room %s", req.Email, req.RoomID)
 	})
 
 	ss.IO.OnEvent("", "leave-room", func(s socketio.Conn, payload string) {
@@ -137,21 +179,12 @@ func (ss *SignallingServer) registerEventHandlers() {
 			return
 		}
 
-		room.RemoveParticipant(s.ID())
 		s.Leave(req.RoomID)
+		s.Leave(staffRoom(req.RoomID))
+		ctx := connContext(s)
+		ss.removeParticipant(ctx, room, s.ID())
 
-		// Integrate with Mediasoup if available
-		if ss.Mediasoup != nil {
-			if err := ss.Mediasoup.OnLeaveRoom(req.RoomID, s.ID()); err != nil {
-				log.Printf("⚠ Mediasoup leave failed: %v", err)
-			}
-		}
-
-		if room.IsEmpty() {
-			ss.RoomManager.DeleteRoom(req.RoomID)
-		}
-
-		log.Printf("✓ User left room %s", req.RoomID)
+		slog.InfoContext(ctx, "User left room", "room_id", req.RoomID)
 	})
 
 	ss.IO.OnEvent("", "webrtc-offer", func(s socketio.Conn, payload string) {
@@ -161,8 +194,11 @@ func (ss *SignallingServer) registerEventHandlers() {
 			return
 		}
 
-		log.Printf("✓ Offer from %s to %s (SDP length: %d)", msg.From, msg.To, len(msg.SDP))
-		s.Emit("webrtc-offer", msg)
+		if err := ss.Relay(s.ID(), "webrtc-offer", msg); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+			return
+		}
+		slog.DebugContext(connContext(s), "Offer relayed", "from", s.ID(), "to", msg.To, "sdp_length", len(msg.SDP))
 	})
 
 	ss.IO.OnEvent("", "webrtc-answer", func(s socketio.Conn, payload string) {
@@ -172,8 +208,11 @@ func (ss *SignallingServer) registerEventHandlers() {
 			return
 		}
 
-		log.Printf("✓ Answer from %s to %s (SDP length: %d)", msg.From, msg.To, len(msg.SDP))
-		s.Emit("webrtc-answer", msg)
+		if err := ss.Relay(s.ID(), "webrtc-answer", msg); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+			return
+		}
+		slog.DebugContext(connContext(s), "Answer relayed", "from", s.ID(), "to", msg.To, "sdp_length", len(msg.SDP))
 	})
 
 	ss.IO.OnEvent("", "ice-candidate", func(s socketio.Conn, payload string) {
@@ -183,8 +222,37 @@ func (ss *SignallingServer) registerEventHandlers() {
 			return
 		}
 
-		log.Printf("✓ ICE candidate from %s to %s", msg.From, msg.To)
-		s.Emit("ice-candidate", msg)
+		if err := ss.Relay(s.ID(), "ice-candidate", msg); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+			return
+		}
+		slog.DebugContext(connContext(s), "ICE candidate relayed", "from", s.ID(), "to", msg.To)
+	})
+
+	ss.IO.OnEvent("", "active-speaker", func(s socketio.Conn, payload string) {
+		var req ActiveSpeakerRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		event := RoomEvent{Type: RoomEventActiveSpeaker, RoomID: req.RoomID, UserID: req.UserID}
+		if err := ss.ReportRoomEvent(s.ID(), event); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+		}
+	})
+
+	ss.IO.OnEvent("", "screen-share", func(s socketio.Conn, payload string) {
+		var req ScreenShareRequest
+		if err := json.Unmarshal([]byte(payload), &req); err != nil {
+			s.Emit("error", map[string]string{"error": "Invalid payload"})
+			return
+		}
+
+		event := RoomEvent{Type: RoomEventScreenShare, RoomID: req.RoomID, Active: req.Active}
+		if err := ss.ReportRoomEvent(s.ID(), event); err != nil {
+			s.Emit("error", map[string]string{"error": err.Error()})
+		}
 	})
 
 	ss.IO.OnEvent("", "get-participants", func(s socketio.Conn, payload string) {
@@ -200,17 +268,305 @@ func (ss *SignallingServer) registerEventHandlers() {
 			return
 		}
 
+		participants := ss.participants(room)
 		response := GetParticipantsResponse{
 			RoomID:       req.RoomID,
-			Participants: room.GetAllParticipants(),
-			Count:        room.ParticipantCount(),
+			Participants: participants,
+			Count:        len(participants),
 		}
 
 		s.Emit("participants-list", response)
 	})
+
+	ss.registerInteractionHandlers()
+	ss.registerBreakoutHandlers()
+	ss.registerHostHandlers()
+}
+
+// openRoom returns this node's room for a join. A main room new to every
+// node takes the default lobby setting; breakout rooms must be open.
+func (ss *SignallingServer) openRoom(req JoinRoomRequest) (*Room, error) {
+	if ss.RoomManager.RootID(req.RoomID) != req.RoomID {
+		room, ok := ss.familyRoom(req.RoomID)
+		if !ok {
+			return nil, errRoomNotFound
+		}
+		return room, nil
+	}
+
+	room, exists := ss.RoomManager.GetRoom(req.RoomID)
+	if !exists {
+		room = ss.RoomManager.CreateRoom(req.RoomID, req.RoomName)
+	}
+	_, err := room.update(func(s *RoomState) error {
+		if !s.Open {
+			s.Open = true
+			s.Lobby = ss.LobbyByDefault
+		}
+		return nil
+	})
+	return room, err
+}
+
+// addConn records a connection of this node, for the commands other nodes
+// send it
+func (ss *SignallingServer) addConn(s socketio.Conn) {
+	ss.connsMu.Lock()
+	defer ss.connsMu.Unlock()
+	if ss.conns == nil {
+		ss.conns = make(map[string]socketio.Conn)
+	}
+	ss.conns[s.ID()] = s
+}
+
+// removeConn forgets a closed connection
+func (ss *SignallingServer) removeConn(socketID string) {
+	ss.connsMu.Lock()
+	defer ss.connsMu.Unlock()
+	delete(ss.conns, socketID)
+}
+
+// findConn returns a connection of this node
+func (ss *SignallingServer) findConn(socketID string) socketio.Conn {
+	ss.connsMu.RLock()
+	defer ss.connsMu.RUnlock()
+	return ss.conns[socketID]
+}
+
+// joinRoom adds a connection to a room, in Socket.IO and Mediasoup
+// alike, and sends it the room's participants on every node
+func (ss *SignallingServer) joinRoom(s socketio.Conn, room *Room, req JoinRoomRequest) {
+	ctx := connContext(s)
+	participant := room.AddParticipant(
+		s.ID(),
+		req.UserID,
+		req.Email,
+		req.FullName,
+		req.Role,
+		req.IsProducer,
+	)
+	if err := room.admit(req.UserID, req.Role); err != nil {
+		slog.WarnContext(ctx, "Admission not recorded", "room_id", req.RoomID, "error", err)
+	}
+	ss.notifyPresence(PresenceEvent{
+		RoomID:   req.RoomID,
+		UserID:   req.UserID,
+		SocketID: s.ID(),
+		Role:     req.Role,
+		Joined:   true,
+		At:       time.Now(),
+	})
+	ss.addMember(ctx, req.RoomID, participant)
+	ss.broadcast(req.RoomID, "participant-joined", participant)
+
+	s.Join(req.RoomID)
+	if isStaff(req.Role) {
+		s.Join(staffRoom(req.RoomID))
+	}
+
+	// Integrate with Mediasoup if available
+	var mediasoupResp *MediasoupJoinResponse
+	if ss.Mediasoup != nil {
+		resp, err := ss.Mediasoup.OnJoinRoom(
+			ctx,
+			req.RoomID,
+			s.ID(),
+			req.UserID,
+			req.Email,
+			req.FullName,
+			req.Role,
+			req.IsProducer,
+		)
+		if err != nil {
+			slog.WarnContext(ctx, "Mediasoup join failed", "room_id", req.RoomID, "error", err)
+		} else {
+			mediasoupResp = &MediasoupJoinResponse{
+				RtpCapabilities: resp.RtpCapabilities,
+				Peers:           convertMediasoupPeers(resp.Peers),
+			}
+		}
+	}
+
+	response := JoinRoomResponse{
+		Success:       true,
+		RoomID:        req.RoomID,
+		ParticipantID: s.ID(),
+		Participants:  ss.participants(room),
+		Mediasoup:     mediasoupResp,
+	}
+	s.Emit("joined-room", response)
+
+	slog.InfoContext(ctx, "User joined room", "room_id", req.RoomID, "participant_user_id", req.UserID)
+}
+
+// OnRoomEvent registers a listener for active speaker and screen share
+// events. Listeners are called synchronously and should return quickly.
+func (ss *SignallingServer) OnRoomEvent(listener func(RoomEvent)) {
+	ss.listenersMu.Lock()
+	defer ss.listenersMu.Unlock()
+	ss.listeners = append(ss.listeners, listener)
+}
+
+// OnPresence registers a listener for participants joining and leaving
+// rooms. A user with several connections is reported once per connection.
+// Listeners are called synchronously and should return quickly.
+func (ss *SignallingServer) OnPresence(listener func(PresenceEvent)) {
+	ss.listenersMu.Lock()
+	defer ss.listenersMu.Unlock()
+	ss.presenceListeners = append(ss.presenceListeners, listener)
+}
+
+// notifyPresence passes a presence event to the listeners. Presence in a
+// breakout room is reported as presence in its main room, so time spent
+// in breakout rooms counts toward the meeting.
+func (ss *SignallingServer) notifyPresence(event PresenceEvent) {
+	event.RoomID = ss.RoomManager.RootID(event.RoomID)
+	ss.listenersMu.RLock()
+	listeners := ss.presenceListeners
+	ss.listenersMu.RUnlock()
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
+
+// removeParticipant takes a connection out of a room, tells Mediasoup and
+// the presence listeners, and deletes the room once it is empty
+func (ss *SignallingServer) removeParticipant(ctx context.Context, room *Room, socketID string) {
+	if room.dropWaiting(socketID) {
+		ss.broadcastLobby(room)
+		if room.IsEmpty() {
+			ss.deleteIfAbandoned(room)
+		}
+		return
+	}
+
+	participant := room.RemoveParticipant(socketID)
+
+	// Integrate with Mediasoup if available
+	if ss.Mediasoup != nil {
+		if err := ss.Mediasoup.OnLeaveRoom(ctx, room.ID, socketID); err != nil {
+			slog.WarnContext(ctx, "Mediasoup leave failed", "room_id", room.ID, "error", err)
+		}
+	}
+
+	if participant != nil {
+		ss.removeMember(ctx, room.ID, socketID)
+		ss.broadcast(room.ID, "participant-left", participant)
+		ss.forgetConnection(room, participant, socketID)
+		ss.notifyPresence(PresenceEvent{
+			RoomID:   room.ID,
+			UserID:   participant.UserID,
+			SocketID: socketID,
+			Role:     participant.Role,
+			Joined:   false,
+			At:       time.Now(),
+		})
+	}
+
+	if room.IsEmpty() {
+		ss.deleteIfAbandoned(room)
+	}
+}
+
+// forgetConnection drops what a room keeps about a connection that left
+// it, lowering the user's hand once they have no connection left in it on
+// any node
+func (ss *SignallingServer) forgetConnection(room *Room, participant *Participant, socketID string) {
+	room.mu.Lock()
+	delete(room.lastReaction, socketID)
+	room.mu.Unlock()
+	if !ss.hasUser(room, participant.UserID) && room.lowerHand(participant.UserID) == nil {
+		ss.broadcastHands(room)
+	}
+}
+
+// Relay sends a WebRTC offer, answer or ICE candidate to another
+// participant of a room the sender is in, on whichever node it is
+// connected
+func (ss *SignallingServer) Relay(socketID, event string, msg SignallingMessage) error {
+	inRoom := false
+	for _, room := range ss.RoomManager.GetAllRooms() {
+		if _, ok := room.GetParticipant(socketID); !ok {
+			continue
+		}
+		inRoom = true
+		for _, p := range ss.participants(room) {
+			if p.SocketID == msg.To && msg.To != socketID {
+				msg.From = socketID
+				ss.broadcast(msg.To, event, msg)
+				return nil
+			}
+		}
+	}
+	if !inRoom {
+		return errNotInRoom
+	}
+	return errPeerNotInRoom
+}
+
+// ReportRoomEvent validates an event sent by a participant, broadcasts it to
+// the room and passes it to the listeners. A screen share is always the
+// sender's own.
+func (ss *SignallingServer) ReportRoomEvent(socketID string, event RoomEvent) error {
+	room, exists := ss.RoomManager.GetRoom(event.RoomID)
+	if !exists {
+		return errRoomNotFound
+	}
+	sender, ok := room.GetParticipant(socketID)
+	if !ok {
+		return errNotInRoom
+	}
+
+	switch event.Type {
+	case RoomEventActiveSpeaker:
+		if event.UserID == "" {
+			event.UserID = sender.UserID
+		}
+		if !ss.hasUser(room, event.UserID) {
+			return errSpeakerNotInRoom
+		}
+		event.Active = true
+	case RoomEventScreenShare:
+		event.UserID = sender.UserID
+	default:
+		return errUnknownRoomEvent
+	}
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	ss.broadcast(event.RoomID, event.Type, event)
+
+	ss.listenersMu.RLock()
+	listeners := ss.listeners
+	ss.listenersMu.RUnlock()
+	for _, listener := range listeners {
+		listener(event)
+	}
+	return nil
 }
 
 // convertMediasoupPeers converts Mediasoup peers to response format
+// newConnContext creates the logging context of a new connection. It carries
+// the socket ID and the request ID of the request that opened the connection,
+// so every event on the connection can be correlated with it.
+func newConnContext(s socketio.Conn) context.Context {
+	requestID := s.RemoteHeader().Get(logging.RequestIDHeader)
+	if requestID == "" {
+		requestID = logging.NewRequestID()
+	}
+	ctx := logging.WithRequestID(context.Background(), requestID)
+	return logging.WithSocketID(ctx, s.ID())
+}
+
+// connContext returns the logging context of a connection
+func connContext(s socketio.Conn) context.Context {
+	if ctx, ok := s.Context().(context.Context); ok {
+		return ctx
+	}
+	return logging.WithSocketID(context.Background(), s.ID())
+}
+
 func convertMediasoupPeers(peers []mediasoup.Peer) []*MediasoupPeerInfo {
 	result := make([]*MediasoupPeerInfo, len(peers))
 	for i, p := range peers {
@@ -228,6 +584,9 @@ func convertMediasoupPeers(peers []mediasoup.Peer) []*MediasoupPeerInfo {
 
 // ServeHTTP implements http.Handler for Socket.IO
 func (ss *SignallingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if sid := r.URL.Query().Get("sid"); sid != "" {
+		ss.checkSession(sid)
+	}
 	ss.IO.ServeHTTP(w, r)
 }
 
@@ -238,12 +597,7 @@ func (ss *SignallingServer) GetRoomStats(roomID string) *RoomStats {
 		return nil
 	}
 
-	return &RoomStats{
-		RoomID:           roomID,
-		ParticipantCount: room.ParticipantCount(),
-		ProducerCount:    len(room.GetProducers()),
-		Participants:     room.GetAllParticipants(),
-	}
+	return ss.roomStats(room)
 }
 
 // GetAllRoomStats returns statistics for all rooms
@@ -252,13 +606,44 @@ func (ss *SignallingServer) GetAllRoomStats() []*RoomStats {
 	stats := make([]*RoomStats, 0, len(rooms))
 
 	for _, room := range rooms {
-		stats = append(stats, &RoomStats{
-			RoomID:           room.ID,
-			ParticipantCount: room.ParticipantCount(),
-			ProducerCount:    len(room.GetProducers()),
-			Participants:     room.GetAllParticipants(),
-		})
+		stats = append(stats, ss.roomStats(room))
 	}
 
 	return stats
 }
+
+// roomStats returns statistics about a room's participants on every node
+func (ss *SignallingServer) roomStats(room *Room) *RoomStats {
+	participants := ss.participants(room)
+	producers := 0
+	for _, p := range participants {
+		if p.IsProducer {
+			producers++
+		}
+	}
+
+	return &RoomStats{
+		RoomID:           room.ID,
+		ParentID:         room.ParentID,
+		ParticipantCount: len(participants),
+		ProducerCount:    producers,
+		Participants:     participants,
+	}
+}
+
+// RegisterMetrics exports Socket.IO connections, rooms and participants
+func (ss *SignallingServer) RegisterMetrics(reg *monitoring.Registry) {
+	reg.NewGaugeFunc("vtp_socketio_connections", "Open Socket.IO connections.", func() float64 {
+		return float64(ss.IO.Count())
+	})
+	reg.NewGaugeFunc("vtp_signalling_rooms", "Active signalling rooms.", func() float64 {
+		return float64(len(ss.RoomManager.GetAllRooms()))
+	})
+	reg.NewGaugeFunc("vtp_signalling_participants", "Participants across all signalling rooms.", func() float64 {
+		total := 0
+		for _, room := range ss.RoomManager.GetAllRooms() {
+			total += room.ParticipantCount()
+		}
+		return float64(total)
+	})
+}
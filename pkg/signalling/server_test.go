@@ -1,6 +1,7 @@
 package signalling
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 	"time"
@@ -388,3 +389,87 @@ func TestRoomCleanup(t *testing.T) {
 
 	t.Log("✓ Room cleanup verified")
 }
+
+// TestReportRoomEvent tests active speaker and screen share events
+func TestReportRoomEvent(t *testing.T) {
+	ss, err := NewSignallingServer()
+	if err != nil {
+		t.Fatalf("Failed to create signalling server: %v", err)
+	}
+	ss.RoomManager.CreateRoom("room-1", "Test Room")
+	room, _ := ss.RoomManager.GetRoom("room-1")
+	room.AddParticipant("socket-1", "user-1", "user1@example.com", "User 1", "teacher", true)
+	room.AddParticipant("socket-2", "user-2", "user2@example.com", "User 2", "student", false)
+
+	var events []RoomEvent
+	ss.OnRoomEvent(func(event RoomEvent) {
+		events = append(events, event)
+	})
+
+	// The teacher's client reports another participant as the speaker
+	if err := ss.ReportRoomEvent("socket-1", RoomEvent{Type: RoomEventActiveSpeaker, RoomID: "room-1", UserID: "user-2"}); err != nil {
+		t.Fatalf("Failed to report active speaker: %v", err)
+	}
+	// A screen share is always the sender's
+	if err := ss.ReportRoomEvent("socket-2", RoomEvent{Type: RoomEventScreenShare, RoomID: "room-1", UserID: "user-1", Active: true}); err != nil {
+		t.Fatalf("Failed to report screen share: %v", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if events[0].UserID != "user-2" || !events[0].Active || events[0].At.IsZero() {
+		t.Errorf("Unexpected active speaker event: %+v", events[0])
+	}
+	if events[1].UserID != "user-2" || !events[1].Active {
+		t.Errorf("Unexpected screen share event: %+v", events[1])
+	}
+
+	if err := ss.ReportRoomEvent("socket-1", RoomEvent{Type: RoomEventActiveSpeaker, RoomID: "room-1", UserID: "user-9"}); err != errSpeakerNotInRoom {
+		t.Errorf("Expected errSpeakerNotInRoom, got %v", err)
+	}
+	if err := ss.ReportRoomEvent("socket-9", RoomEvent{Type: RoomEventScreenShare, RoomID: "room-1"}); err != errNotInRoom {
+		t.Errorf("Expected errNotInRoom, got %v", err)
+	}
+	if err := ss.ReportRoomEvent("socket-1", RoomEvent{Type: "raise-hand", RoomID: "room-1"}); err != errUnknownRoomEvent {
+		t.Errorf("Expected errUnknownRoomEvent, got %v", err)
+	}
+	if len(events) != 2 {
+		t.Errorf("Rejected events reached the listeners")
+	}
+
+	t.Log("✓ Room events validated and passed to listeners")
+}
+
+// TestPresenceEvents tests that leaving a room is reported to presence
+// listeners once per connection
+func TestPresenceEvents(t *testing.T) {
+	ss, err := NewSignallingServer()
+	if err != nil {
+		t.Fatalf("Failed to create signalling server: %v", err)
+	}
+	ss.Mediasoup = nil
+	ss.RoomManager.CreateRoom("room-1", "Test Room")
+	room, _ := ss.RoomManager.GetRoom("room-1")
+	room.AddParticipant("socket-1", "user-1", "user1@example.com", "User 1", "student", false)
+
+	var events []PresenceEvent
+	ss.OnPresence(func(event PresenceEvent) {
+		events = append(events, event)
+	})
+
+	ss.removeParticipant(context.Background(), room, "socket-1")
+	ss.removeParticipant(context.Background(), room, "socket-1")
+
+	if len(events) != 1 {
+		t.Fatalf("Expected 1 presence event, got %d", len(events))
+	}
+	if events[0].Joined || events[0].UserID != "user-1" || events[0].SocketID != "socket-1" || events[0].At.IsZero() {
+		t.Errorf("Unexpected presence event: %+v", events[0])
+	}
+	if ss.RoomManager.RoomExists("room-1") {
+		t.Error("Expected the empty room deleted")
+	}
+
+	t.Log("✓ Leaving a room reported to presence listeners")
+}
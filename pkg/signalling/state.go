@@ -0,0 +1,152 @@
+package signalling
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+var errRoomState = errors.New("the room is unavailable, try again")
+
+// RoomStates keeps what every node acts on in a room: its host settings,
+// lobby, bans, raised hands, open polls and breakout rooms. Each node keeps
+// only its own connections; a teacher connected to one replica acts on
+// students connected to another through this state.
+type RoomStates interface {
+	// RoomState returns the state of a room, empty if it has none
+	RoomState(ctx context.Context, roomID string) (*RoomState, error)
+	// UpdateRoomState changes the state of a room atomically and returns
+	// the new state. update may run more than once when nodes change the
+	// room at the same time; an error from it leaves the state unchanged.
+	UpdateRoomState(ctx context.Context, roomID string, update func(*RoomState) error) (*RoomState, error)
+	// DeleteRoomState forgets the state of a room
+	DeleteRoomState(ctx context.Context, roomID string) error
+}
+
+// RoomState is the state of a room shared by every node
+type RoomState struct {
+	Open     bool                          `json:"open"` // settings were set when the room opened
+	HostID   string                        `json:"host_id"`
+	Lobby    bool                          `json:"lobby"`              // students wait to be admitted
+	Locked   bool                          `json:"locked"`             // only the host and admins may join
+	Waiting  map[string]WaitingParticipant `json:"waiting,omitempty"`  // key: socket ID
+	Admitted map[string]bool               `json:"admitted,omitempty"` // users who entered the room
+	Banned   map[string]bool               `json:"banned,omitempty"`   // users removed for the session
+	Blocked  map[string]map[string]bool    `json:"blocked,omitempty"`  // user ID -> media kinds turned off by the host
+
+	Breakouts        []BreakoutRoom    `json:"breakouts,omitempty"`   // in order
+	Assignments      map[string]string `json:"assignments,omitempty"` // user ID -> breakout room ID
+	BreakoutsCloseAt time.Time         `json:"breakouts_close_at"`
+
+	Hands []RaisedHand     `json:"hands,omitempty"` // in the order raised
+	Polls map[string]*Poll `json:"polls,omitempty"` // open polls, key: poll ID
+}
+
+// BreakoutRoom is a breakout room open in a main room
+type BreakoutRoom struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// loadState returns the state of a room, logging why it is unavailable
+func loadState(states RoomStates, roomID string) (*RoomState, error) {
+	state, err := states.RoomState(context.Background(), roomID)
+	if err != nil {
+		slog.Warn("Room state not loaded", "room_id", roomID, "error", err)
+		return nil, errRoomState
+	}
+	return state, nil
+}
+
+// updateState changes the state of a room, passing on the errors of
+// update and logging why the state is unavailable
+func updateState(states RoomStates, roomID string, update func(*RoomState) error) (*RoomState, error) {
+	var updateErr error
+	state, err := states.UpdateRoomState(context.Background(), roomID, func(s *RoomState) error {
+		updateErr = update(s)
+		return updateErr
+	})
+	if err != nil && err != updateErr {
+		slog.Warn("Room state not updated", "room_id", roomID, "error", err)
+		return nil, errRoomState
+	}
+	return state, err
+}
+
+// admit records that a user entered the room. The first teacher to enter
+// becomes the host.
+func (s *RoomState) admit(userID, role string) {
+	if s.Admitted == nil {
+		s.Admitted = make(map[string]bool)
+	}
+	s.Admitted[userID] = true
+	if s.HostID == "" && isStaff(role) {
+		s.HostID = userID
+	}
+}
+
+// ban keeps a user out of the room for the rest of the session
+func (s *RoomState) ban(userID string) {
+	if s.Banned == nil {
+		s.Banned = make(map[string]bool)
+	}
+	s.Banned[userID] = true
+	delete(s.Assignments, userID)
+}
+
+// waiting returns the lobby in the order people arrived
+func (s *RoomState) waiting() []WaitingParticipant {
+	waiting := make([]WaitingParticipant, 0, len(s.Waiting))
+	for _, w := range s.Waiting {
+		waiting = append(waiting, w)
+	}
+	sort.Slice(waiting, func(i, j int) bool {
+		return waiting[i].Since.Before(waiting[j].Since)
+	})
+	return waiting
+}
+
+// takeWaiting removes a user's connections from the lobby, or everyone's
+// for an empty user ID
+func (s *RoomState) takeWaiting(userID string) []WaitingParticipant {
+	var taken []WaitingParticipant
+	for _, w := range s.waiting() {
+		if userID == "" || w.UserID == userID {
+			taken = append(taken, w)
+			delete(s.Waiting, w.SocketID)
+		}
+	}
+	return taken
+}
+
+// admitWaiting takes a user's connections, or everyone's for an empty
+// user ID, out of the lobby and admits them
+func (s *RoomState) admitWaiting(userID string) []WaitingParticipant {
+	taken := s.takeWaiting(userID)
+	for _, w := range taken {
+		s.admit(w.UserID, "")
+	}
+	return taken
+}
+
+// breakout returns an open breakout room
+func (s *RoomState) breakout(roomID string) (BreakoutRoom, bool) {
+	for _, b := range s.Breakouts {
+		if b.ID == roomID {
+			return b, true
+		}
+	}
+	return BreakoutRoom{}, false
+}
+
+// settings returns the room's host, lobby and lock settings
+func (s *RoomState) settings(roomID string) RoomSettings {
+	return RoomSettings{
+		RoomID: roomID,
+		HostID: s.HostID,
+		Lobby:  s.Lobby,
+		Locked: s.Locked,
+	}
+}
@@ -1,5 +1,7 @@
 package signalling
 
+import "time"
+
 // JoinRoomRequest is the payload for joining a room
 type JoinRoomRequest struct {
 	RoomID     string `json:"room_id"`
@@ -42,6 +44,7 @@ type GetParticipantsResponse struct {
 // RoomStats contains statistics about a room
 type RoomStats struct {
 	RoomID           string         `json:"room_id"`
+	ParentID         string         `json:"parent_id,omitempty"` // main room of a breakout room
 	ParticipantCount int            `json:"participant_count"`
 	ProducerCount    int            `json:"producer_count"`
 	Participants     []*Participant `json:"participants"`
@@ -80,3 +83,180 @@ type MediasoupJoinResponse struct {
 	RtpCapabilities interface{}          `json:"rtpCapabilities"`
 	Peers           []*MediasoupPeerInfo `json:"peers,omitempty"`
 }
+
+// Room event types passed to room event listeners
+const (
+	RoomEventActiveSpeaker = "active-speaker"
+	RoomEventScreenShare   = "screen-share"
+)
+
+// RoomEvent is a change in what a room is showing, such as a new active
+// speaker or a screen share starting or stopping
+type RoomEvent struct {
+	Type   string    `json:"type"`
+	RoomID string    `json:"room_id"`
+	UserID string    `json:"user_id"`
+	Active bool      `json:"active"`
+	At     time.Time `json:"at"`
+}
+
+// ActiveSpeakerRequest reports the participant currently speaking. UserID
+// defaults to the sender.
+type ActiveSpeakerRequest struct {
+	RoomID string `json:"room_id"`
+	UserID string `json:"user_id,omitempty"`
+}
+
+// ScreenShareRequest reports that the sender started or stopped sharing
+// their screen
+type ScreenShareRequest struct {
+	RoomID string `json:"room_id"`
+	Active bool   `json:"active"`
+}
+
+// PresenceEvent reports a connection joining or leaving a room
+type PresenceEvent struct {
+	RoomID   string    `json:"room_id"`
+	UserID   string    `json:"user_id"`
+	SocketID string    `json:"socket_id"`
+	Role     string    `json:"role"`
+	Joined   bool      `json:"joined"`
+	At       time.Time `json:"at"`
+}
+
+// HandRequest raises or lowers a hand. UserID, for teachers lowering
+// someone else's hand, defaults to the sender.
+type HandRequest struct {
+	RoomID string `json:"room_id"`
+	UserID string `json:"user_id,omitempty"`
+}
+
+// CreatePollRequest starts a poll. Points, if set, are given as a
+// participation grade to students choosing one of the correct options,
+// or to every voter when none are marked correct.
+type CreatePollRequest struct {
+	RoomID    string   `json:"room_id"`
+	Question  string   `json:"question"`
+	Options   []string `json:"options"`
+	Multiple  bool     `json:"multiple"`
+	Anonymous bool     `json:"anonymous"`
+	Points    int      `json:"points,omitempty"`
+	Correct   []int    `json:"correct,omitempty"`
+}
+
+// VotePollRequest is a vote for one or, in polls allowing it, several of a
+// poll's options, given by their index
+type VotePollRequest struct {
+	RoomID  string `json:"room_id"`
+	PollID  string `json:"poll_id"`
+	Choices []int  `json:"choices"`
+}
+
+// ClosePollRequest ends a poll
+type ClosePollRequest struct {
+	RoomID string `json:"room_id"`
+	PollID string `json:"poll_id"`
+}
+
+// ReactionRequest sends an emoji reaction to the room
+type ReactionRequest struct {
+	RoomID string `json:"room_id"`
+	Emoji  string `json:"emoji"`
+}
+
+// ReactionEvent is a reaction broadcast to the room
+type ReactionEvent struct {
+	RoomID   string    `json:"room_id"`
+	UserID   string    `json:"user_id"`
+	FullName string    `json:"full_name"`
+	Emoji    string    `json:"emoji"`
+	At       time.Time `json:"at"`
+}
+
+// CreateBreakoutsRequest splits a room into breakout rooms. With Random
+// set the room's students are spread evenly across them; otherwise they
+// are assigned one by one with move-participant.
+type CreateBreakoutsRequest struct {
+	RoomID string   `json:"room_id"`
+	Count  int      `json:"count"`
+	Names  []string `json:"names,omitempty"`
+	Random bool     `json:"random"`
+}
+
+// MoveParticipantRequest moves every connection of a user to a breakout
+// room, or back to the main room
+type MoveParticipantRequest struct {
+	RoomID   string `json:"room_id"`
+	UserID   string `json:"user_id"`
+	ToRoomID string `json:"to_room_id"`
+}
+
+// BreakoutBroadcastRequest sends a message to the main room and all its
+// breakout rooms
+type BreakoutBroadcastRequest struct {
+	RoomID  string `json:"room_id"`
+	Message string `json:"message"`
+}
+
+// CloseBreakoutsRequest brings everyone back to the main room after a
+// countdown, 60 seconds if not given
+type CloseBreakoutsRequest struct {
+	RoomID    string `json:"room_id"`
+	Countdown *int   `json:"countdown_seconds,omitempty"`
+}
+
+// BreakoutInfo is a breakout room and who is in it
+type BreakoutInfo struct {
+	RoomID       string         `json:"room_id"`
+	Name         string         `json:"name"`
+	Participants []*Participant `json:"participants"`
+}
+
+// BreakoutsResponse lists a room's breakout rooms. ClosesAt is set once
+// they are closing.
+type BreakoutsResponse struct {
+	RoomID    string         `json:"room_id"`
+	Breakouts []BreakoutInfo `json:"breakouts"`
+	ClosesAt  *time.Time     `json:"closes_at,omitempty"`
+}
+
+// BreakoutMessage is a message from a teacher to every breakout room
+type BreakoutMessage struct {
+	RoomID   string    `json:"room_id"`
+	UserID   string    `json:"user_id"`
+	FullName string    `json:"full_name"`
+	Message  string    `json:"message"`
+	At       time.Time `json:"at"`
+}
+
+// HostActionRequest is a host's action on a participant: admitting or
+// denying them from the lobby, removing them, or making them host. Admit
+// takes everyone waiting for an empty user ID.
+type HostActionRequest struct {
+	RoomID string `json:"room_id"`
+	UserID string `json:"user_id,omitempty"`
+	Ban    bool   `json:"ban,omitempty"` // remove-participant only
+}
+
+// RoomSettingsRequest changes a room's settings; unset fields are kept
+type RoomSettingsRequest struct {
+	RoomID string `json:"room_id"`
+	Lobby  *bool  `json:"lobby,omitempty"`
+	Locked *bool  `json:"locked,omitempty"`
+}
+
+// RoomSettings are a room's host, lobby and lock settings
+type RoomSettings struct {
+	RoomID string `json:"room_id"`
+	HostID string `json:"host_id"`
+	Lobby  bool   `json:"lobby"`
+	Locked bool   `json:"locked"`
+}
+
+// MediaControlRequest turns a user's microphone or camera off or asks them
+// to turn it back on. An empty user ID applies to every student.
+type MediaControlRequest struct {
+	RoomID string `json:"room_id"`
+	UserID string `json:"user_id,omitempty"`
+	Kind   string `json:"kind"` // audio or video, audio by default
+}
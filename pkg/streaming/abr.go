@@ -1,7 +1,7 @@
 package streaming
 
 import (
-	"log"
+	"log/slog"
 	"math"
 	"time"
 )
@@ -45,8 +45,8 @@ func (abr *AdaptiveBitrateManager) RecordSegmentMetrics(metrics SegmentMetrics)
 	// Estimate bandwidth from this segment
 	if metrics.DownloadTime > 0 {
 		segmentBitrate := (metrics.BytesDownloaded * 8 * 1000) / metrics.DownloadTime
-		log.Printf("[ABR] Segment %d: Downloaded %d bytes in %dms (%.0f kbps)",
-			metrics.SegmentNumber, metrics.BytesDownloaded, metrics.DownloadTime, float64(segmentBitrate))
+		slog.Debug("ABR segment downloaded", "component", "abr", "segment", metrics.SegmentNumber,
+			"bytes", metrics.BytesDownloaded, "duration_ms", metrics.DownloadTime, "kbps", segmentBitrate)
 	}
 }
 
@@ -60,8 +60,8 @@ func (abr *AdaptiveBitrateManager) RecordNetworkStats(stats NetworkStats) {
 		abr.networkHistory = abr.networkHistory[1:]
 	}
 
-	log.Printf("[ABR] Network: %.0f kbps, %dms latency, %.1f%% loss, buffer: %.0f%%",
-		stats.Bandwidth, stats.Latency, stats.PacketLoss, stats.BufferHealth)
+	slog.Debug("ABR network stats", "component", "abr", "kbps", stats.Bandwidth, "latency_ms", stats.Latency,
+		"packet_loss", stats.PacketLoss, "buffer_health", stats.BufferHealth)
 }
 
 // SelectQuality determines best quality for current bandwidth
@@ -139,7 +139,7 @@ func (abr *AdaptiveBitrateManager) GetCurrentBitrate() int {
 // UpdateCurrentBitrate sets the current bitrate
 func (abr *AdaptiveBitrateManager) UpdateCurrentBitrate(bitrate int) {
 	abr.currentBitrate = bitrate
-	log.Printf("[ABR] Bitrate updated to %d kbps", bitrate)
+	slog.Debug("ABR bitrate updated", "component", "abr", "kbps", bitrate)
 }
 
 // GetAvailableBitrates returns list of available bitrates
@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
 	"time"
+
+	"github.com/Bashar444/VTP/pkg/auth"
+	"github.com/Bashar444/VTP/pkg/course"
+	"github.com/Bashar444/VTP/pkg/router"
 )
 
 // DistributionHandlers handles HTTP requests for live distribution
@@ -124,14 +127,27 @@ func NewDistributionHandlers(service *DistributionService) *DistributionHandlers
 	}
 }
 
-// RegisterDistributionRoutes registers all distribution routes
-func (dh *DistributionHandlers) RegisterDistributionRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/api/v1/streams/start", dh.StartStreamHandler)
-	mux.HandleFunc("/api/v1/streams/", dh.StreamOperationHandler) // POST for join/leave, GET for stats
-	mux.HandleFunc("/api/v1/segments/deliver", dh.DeliverSegmentHandler)
-	mux.HandleFunc("/api/v1/viewers/adapt-quality", dh.AdaptQualityHandler)
-	mux.HandleFunc("/api/v1/distribution/metrics", dh.GetMetricsHandler)
-	mux.HandleFunc("/api/v1/distribution/health", dh.HealthCheckHandler)
+// RegisterDistributionRoutes registers all distribution routes. The health
+// check is public; everything else requires authentication. Streams are keyed
+// by recording, so live HLS is scoped to the recording's course: members may
+// watch and only its instructors may upload segments.
+func (dh *DistributionHandlers) RegisterDistributionRoutes(rt *router.Router, am *auth.AuthMiddleware, authz *course.CourseAuthorizer) {
+	api := rt.With(am.Middleware)
+	member := api.With(authz.Require(authz.RecordingScope("id"), course.MemberRoles...))
+	manage := api.With(authz.Require(authz.RecordingScope("id"), course.ManageRoles...))
+
+	api.HandleFunc("POST /api/v1/streams/start", dh.StartStreamHandler)
+	api.HandleFunc("POST /api/v1/streams/{id}", dh.StreamOperationHandler)   // join
+	api.HandleFunc("DELETE /api/v1/streams/{id}", dh.StreamOperationHandler) // leave
+	api.HandleFunc("GET /api/v1/streams/{id}", dh.StreamOperationHandler)    // stats
+	api.HandleFunc("POST /api/v1/segments/deliver", dh.DeliverSegmentHandler)
+	api.HandleFunc("POST /api/v1/viewers/adapt-quality", dh.AdaptQualityHandler)
+	api.HandleFunc("GET /api/v1/distribution/metrics", dh.GetMetricsHandler)
+	member.HandleFunc("GET /api/v1/streams/{id}/hls/master.m3u8", dh.LiveMasterPlaylistHandler)
+	member.HandleFunc("GET /api/v1/streams/{id}/hls/{bitrate}/playlist.m3u8", dh.LiveMediaPlaylistHandler)
+	member.HandleFunc("GET /api/v1/streams/{id}/hls/{bitrate}/{file}", dh.LiveSegmentHandler)
+	manage.HandleFunc("PUT /api/v1/streams/{id}/hls/{bitrate}/{file}", dh.IngestLiveSegmentHandler)
+	rt.HandleFunc("GET /api/v1/distribution/health", dh.HealthCheckHandler)
 }
 
 // StartStreamHandler starts a new live stream
@@ -180,7 +196,7 @@ func (dh *DistributionHandlers) StartStreamHandler(w http.ResponseWriter, r *htt
 
 // StreamOperationHandler handles join/leave and statistics operations
 func (dh *DistributionHandlers) StreamOperationHandler(w http.ResponseWriter, r *http.Request) {
-	recordingID := extractRecordingID(r.URL.Path, "/api/v1/streams/")
+	recordingID := r.PathValue("id")
 
 	if recordingID == "" {
 		http.Error(w, "recording_id required in path", http.StatusBadRequest)
@@ -431,18 +447,6 @@ func (dh *DistributionHandlers) HealthCheckHandler(w http.ResponseWriter, r *htt
 
 // Helper functions
 
-func extractRecordingID(path, prefix string) string {
-	if !strings.HasPrefix(path, prefix) {
-		return ""
-	}
-	remainder := strings.TrimPrefix(path, prefix)
-	parts := strings.Split(remainder, "/")
-	if len(parts) > 0 && parts[0] != "" {
-		return parts[0]
-	}
-	return ""
-}
-
 func timeString() string {
 	return time.Now().Format("2006-01-02T15:04:05Z")
 }
@@ -2,7 +2,7 @@ package streaming
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"sync"
 	"time"
 )
@@ -16,12 +16,13 @@ type DistributionService struct {
 	workQueue      chan *SegmentDeliveryTask
 	stopChan       chan bool
 	wg             sync.WaitGroup
-	logger         *log.Logger
+	logger         *slog.Logger
 	closed         bool
 	metrics        DistributionMetrics
 	metricsMu      sync.RWMutex
 	cdnEnabled     bool
 	cdnEndpoint    string
+	onStreamEnded  func(recordingID string)
 }
 
 // DistributionWorker processes segment delivery tasks
@@ -29,7 +30,7 @@ type DistributionWorker struct {
 	workerID int
 	taskChan chan *SegmentDeliveryTask
 	stopChan chan bool
-	logger   *log.Logger
+	logger   *slog.Logger
 }
 
 // SegmentDeliveryTask represents a segment delivery operation
@@ -57,7 +58,7 @@ type DistributionMetrics struct {
 }
 
 // NewDistributionService creates a new distribution service
-func NewDistributionService(workerCount int, logger *log.Logger) *DistributionService {
+func NewDistributionService(workerCount int, logger *slog.Logger) *DistributionService {
 	if workerCount < 1 {
 		workerCount = 4
 	}
@@ -173,6 +174,7 @@ func (ds *DistributionService) DeliverSegmentToViewer(recordingID, viewerID, seg
 	case <-ds.stopChan:
 		return fmt.Errorf("service is stopped")
 	default:
+		ds.recordDeliveryFailure()
 		return fmt.Errorf("task queue full")
 	}
 }
@@ -282,15 +284,25 @@ func (ds *DistributionService) EndLiveStream(recordingID string) error {
 
 	delete(ds.distributors, recordingID)
 
+	if ds.onStreamEnded != nil {
+		go ds.onStreamEnded(recordingID)
+	}
+
 	return nil
 }
 
+// OnStreamEnded registers a function called after a live stream ends, such
+// as converting the stream's recording for on-demand playback
+func (ds *DistributionService) OnStreamEnded(fn func(recordingID string)) {
+	ds.onStreamEnded = fn
+}
+
 // EnableCDN enables CDN integration for segment delivery
 func (ds *DistributionService) EnableCDN(endpoint string) {
 	ds.cdnEnabled = true
 	ds.cdnEndpoint = endpoint
 	if ds.logger != nil {
-		ds.logger.Printf("[Distribution] CDN enabled: %s\n", endpoint)
+		ds.logger.Info("CDN enabled", "endpoint", endpoint)
 	}
 }
 
@@ -298,7 +310,7 @@ func (ds *DistributionService) EnableCDN(endpoint string) {
 func (ds *DistributionService) DisableCDN() {
 	ds.cdnEnabled = false
 	if ds.logger != nil {
-		ds.logger.Println("[Distribution] CDN disabled")
+		ds.logger.Info("CDN disabled")
 	}
 }
 
@@ -418,7 +430,7 @@ func (ds *DistributionService) Stop() error {
 	ds.distributorsMu.Unlock()
 
 	if ds.logger != nil {
-		ds.logger.Println("[Distribution] Service stopped")
+		ds.logger.Info("Distribution service stopped")
 	}
 
 	return nil
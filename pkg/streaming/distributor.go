@@ -58,6 +58,8 @@ type VideoSegment struct {
 	Delivered   int64 // Count of successful deliveries
 	FailedCount int64 // Count of failed deliveries
 	IsKeyFrame  bool
+	Data        []byte      // segment bytes, served instead of FilePath when set
+	Parts       []*LivePart // LL-HLS partial segments, if any
 }
 
 // DistributionStats tracks distribution network statistics
@@ -90,6 +92,10 @@ type LiveDistributor struct {
 	maxViewers           int
 	segmentRetentionTime time.Duration
 	bandwidthLimitMBps   float64
+	hlsConfig            LiveHLSConfig
+	live                 map[string]*liveRendition
+	liveUpdate           chan struct{}
+	liveMu               sync.Mutex
 }
 
 // SegmentDeliveryEvent reports distribution events
@@ -160,6 +166,9 @@ func NewLiveDistributor(recordingID string, maxViewers int, segmentRetentionTime
 		maxViewers:           maxViewers,
 		segmentRetentionTime: segmentRetentionTime,
 		bandwidthLimitMBps:   100.0, // Default 100 Mbps
+		hlsConfig:            DefaultLiveHLSConfig(),
+		live:                 make(map[string]*liveRendition),
+		liveUpdate:           make(chan struct{}),
 	}
 }
 
@@ -190,10 +199,12 @@ func (ld *LiveDistributor) EnqueueSegment(segment *VideoSegment) error {
 		return fmt.Errorf("first segment must be keyframe")
 	}
 
+	ld.attachLiveParts(segment)
 	err := ld.segmentQueue.Add(segment)
 	if err != nil {
 		return err
 	}
+	ld.completeLiveSegment(segment)
 
 	ld.statsMu.Lock()
 	ld.stats.TotalSegmentsQueued++
@@ -595,5 +606,11 @@ func (ld *LiveDistributor) Close() error {
 	ld.segmentQueue.segments = make(map[string]*VideoSegment)
 	ld.segmentQueue.mu.Unlock()
 
+	// Wake blocked playlist requests
+	ld.liveMu.Lock()
+	ld.live = make(map[string]*liveRendition)
+	ld.notifyLive()
+	ld.liveMu.Unlock()
+
 	return nil
 }
@@ -2,8 +2,7 @@ package streaming
 
 import (
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
 	"testing"
 	"time"
 )
@@ -245,7 +244,7 @@ func TestDistributorClose(t *testing.T) {
 // Distribution Service Tests
 
 func TestNewDistributionService(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewDistributionService(4, logger)
 
 	if service == nil {
@@ -257,7 +256,7 @@ func TestNewDistributionService(t *testing.T) {
 }
 
 func TestCreateDistributor(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewDistributionService(2, logger)
 	defer service.Stop()
 
@@ -272,7 +271,7 @@ func TestCreateDistributor(t *testing.T) {
 }
 
 func TestStartLiveStream(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewDistributionService(2, logger)
 	defer service.Stop()
 
@@ -287,7 +286,7 @@ func TestStartLiveStream(t *testing.T) {
 }
 
 func TestGetDistributor(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewDistributionService(2, logger)
 	defer service.Stop()
 
@@ -304,7 +303,7 @@ func TestGetDistributor(t *testing.T) {
 }
 
 func TestJoinStream(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewDistributionService(2, logger)
 	defer service.Stop()
 
@@ -321,7 +320,7 @@ func TestJoinStream(t *testing.T) {
 }
 
 func TestLeaveStream(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewDistributionService(2, logger)
 	defer service.Stop()
 
@@ -335,7 +334,7 @@ func TestLeaveStream(t *testing.T) {
 }
 
 func TestAdaptViewerQuality(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewDistributionService(2, logger)
 	defer service.Stop()
 
@@ -354,7 +353,7 @@ func TestAdaptViewerQuality(t *testing.T) {
 }
 
 func TestGetStreamViewers(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewDistributionService(2, logger)
 	defer service.Stop()
 
@@ -373,7 +372,7 @@ func TestGetStreamViewers(t *testing.T) {
 }
 
 func TestGetStreamStatistics(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewDistributionService(2, logger)
 	defer service.Stop()
 
@@ -391,7 +390,7 @@ func TestGetStreamStatistics(t *testing.T) {
 }
 
 func TestEndLiveStream(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewDistributionService(2, logger)
 	defer service.Stop()
 
@@ -410,7 +409,7 @@ func TestEndLiveStream(t *testing.T) {
 }
 
 func TestEnableCDN(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewDistributionService(2, logger)
 	defer service.Stop()
 
@@ -425,7 +424,7 @@ func TestEnableCDN(t *testing.T) {
 }
 
 func TestGetMetrics(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	service := NewDistributionService(2, logger)
 	defer service.Stop()
 
@@ -0,0 +1,249 @@
+package streaming
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// HLSKeySize is the size of an AES-128 segment key
+const HLSKeySize = 16
+
+var (
+	ErrEncryptionNotConfigured = errors.New("hls encryption is not configured")
+	ErrKeyNotFound             = errors.New("hls key not found")
+	ErrInvalidMasterKey        = errors.New("master key must be 32 bytes, base64 or hex encoded")
+)
+
+// KeyStore persists segment keys sealed under the master key
+type KeyStore interface {
+	// SaveKey stores a sealed key unless the recording already has a key
+	// with that index
+	SaveKey(ctx context.Context, recordingID string, index int, sealed []byte) error
+	// LoadKey returns a sealed key or ErrKeyNotFound
+	LoadKey(ctx context.Context, recordingID string, index int) ([]byte, error)
+}
+
+// SQLKeyStore stores keys in the hls_encryption_keys table
+type SQLKeyStore struct {
+	db *sql.DB
+}
+
+// NewSQLKeyStore creates a key store backed by the database
+func NewSQLKeyStore(db *sql.DB) *SQLKeyStore {
+	return &SQLKeyStore{db: db}
+}
+
+// SaveKey stores a sealed key
+func (s *SQLKeyStore) SaveKey(ctx context.Context, recordingID string, index int, sealed []byte) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO hls_encryption_keys (recording_id, key_index, encrypted_key)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (recording_id, key_index) DO NOTHING
+	`, recordingID, index, sealed)
+	if err != nil {
+		return fmt.Errorf("failed to save hls key: %w", err)
+	}
+	return nil
+}
+
+// LoadKey returns a sealed key
+func (s *SQLKeyStore) LoadKey(ctx context.Context, recordingID string, index int) ([]byte, error) {
+	var sealed []byte
+	err := s.db.QueryRowContext(ctx,
+		`SELECT encrypted_key FROM hls_encryption_keys WHERE recording_id = $1 AND key_index = $2`,
+		recordingID, index,
+	).Scan(&sealed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load hls key: %w", err)
+	}
+	return sealed, nil
+}
+
+// MemoryKeyStore keeps keys in memory, for tests and single-node setups
+// without a database
+type MemoryKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string][]byte
+}
+
+// NewMemoryKeyStore creates an empty in-memory key store
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: make(map[string][]byte)}
+}
+
+// SaveKey stores a sealed key
+func (s *MemoryKeyStore) SaveKey(ctx context.Context, recordingID string, index int, sealed []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := keyID(recordingID, index)
+	if _, ok := s.keys[id]; !ok {
+		s.keys[id] = append([]byte(nil), sealed...)
+	}
+	return nil
+}
+
+// LoadKey returns a sealed key
+func (s *MemoryKeyStore) LoadKey(ctx context.Context, recordingID string, index int) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sealed, ok := s.keys[keyID(recordingID, index)]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return sealed, nil
+}
+
+// ParseMasterKey decodes a 32-byte master key given as base64 or hex
+func ParseMasterKey(value string) ([]byte, error) {
+	if key, err := hex.DecodeString(value); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(value); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, ErrInvalidMasterKey
+}
+
+// KeyVault generates per-recording segment keys and keeps them encrypted
+// at rest with AES-256-GCM under the master key. Each sealed key is bound
+// to its recording and index, so sealed keys cannot be swapped.
+type KeyVault struct {
+	aead  cipher.AEAD
+	store KeyStore
+}
+
+// NewKeyVault creates a key vault
+func NewKeyVault(masterKey []byte, store KeyStore) (*KeyVault, error) {
+	if len(masterKey) != 32 {
+		return nil, ErrInvalidMasterKey
+	}
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyVault{aead: aead, store: store}, nil
+}
+
+// Key returns an existing key of a recording or ErrKeyNotFound
+func (v *KeyVault) Key(ctx context.Context, recordingID string, index int) ([]byte, error) {
+	sealed, err := v.store.LoadKey(ctx, recordingID, index)
+	if err != nil {
+		return nil, err
+	}
+	return v.open(recordingID, index, sealed)
+}
+
+// EnsureKey returns the key of a recording, generating it first if needed.
+// When two transcoders race, the key saved first wins.
+func (v *KeyVault) EnsureKey(ctx context.Context, recordingID string, index int) ([]byte, error) {
+	key, err := v.Key(ctx, recordingID, index)
+	if !errors.Is(err, ErrKeyNotFound) {
+		return key, err
+	}
+
+	key = make([]byte, HLSKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate hls key: %w", err)
+	}
+	sealed, err := v.seal(recordingID, index, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.store.SaveKey(ctx, recordingID, index, sealed); err != nil {
+		return nil, err
+	}
+	return v.Key(ctx, recordingID, index)
+}
+
+func (v *KeyVault) seal(recordingID string, index int, key []byte) ([]byte, error) {
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to seal hls key: %w", err)
+	}
+	return v.aead.Seal(nonce, nonce, key, []byte(keyID(recordingID, index))), nil
+}
+
+func (v *KeyVault) open(recordingID string, index int, sealed []byte) ([]byte, error) {
+	size := v.aead.NonceSize()
+	if len(sealed) < size {
+		return nil, fmt.Errorf("failed to open hls key: sealed key too short")
+	}
+	key, err := v.aead.Open(nil, sealed[:size], sealed[size:], []byte(keyID(recordingID, index)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open hls key: %w", err)
+	}
+	return key, nil
+}
+
+func keyID(recordingID string, index int) string {
+	return recordingID + ":" + strconv.Itoa(index)
+}
+
+// keyIndex returns the key a segment is encrypted with when keys rotate
+// every segmentsPerKey segments
+func keyIndex(segment, segmentsPerKey int) int {
+	if segmentsPerKey <= 0 {
+		return 0
+	}
+	return segment / segmentsPerKey
+}
+
+// segmentIV returns the IV of a segment. Playlists carry no IV attribute,
+// so players use the media sequence number as HLS specifies.
+func segmentIV(sequence int) []byte {
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], uint64(sequence))
+	return iv
+}
+
+// EncryptSegment encrypts a segment with AES-128-CBC and PKCS#7 padding,
+// the HLS AES-128 method
+func EncryptSegment(key []byte, sequence int, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	plain := append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	out := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, segmentIV(sequence)).CryptBlocks(out, plain)
+	return out, nil
+}
+
+// DecryptSegment reverses EncryptSegment
+func DecryptSegment(key []byte, sequence int, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted segment is not a multiple of the block size")
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, segmentIV(sequence)).CryptBlocks(out, data)
+	padding := int(out[len(out)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(out[len(out)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, fmt.Errorf("invalid segment padding")
+	}
+	return out[:len(out)-padding], nil
+}
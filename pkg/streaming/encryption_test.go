@@ -0,0 +1,337 @@
+package streaming
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/auth"
+	"github.com/Bashar444/VTP/pkg/recording"
+	"github.com/Bashar444/VTP/pkg/router"
+	"github.com/google/uuid"
+)
+
+func newTestVault(t *testing.T, store KeyStore) *KeyVault {
+	t.Helper()
+	vault, err := NewKeyVault(bytes.Repeat([]byte{7}, 32), store)
+	if err != nil {
+		t.Fatalf("Failed to create key vault: %v", err)
+	}
+	return vault
+}
+
+func TestKeyVaultEnsureKey(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryKeyStore()
+	vault := newTestVault(t, store)
+
+	if _, err := vault.Key(ctx, "rec-1", 0); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+
+	key, err := vault.EnsureKey(ctx, "rec-1", 0)
+	if err != nil {
+		t.Fatalf("Failed to create key: %v", err)
+	}
+	if len(key) != HLSKeySize {
+		t.Errorf("Expected %d byte key, got %d", HLSKeySize, len(key))
+	}
+
+	again, err := vault.EnsureKey(ctx, "rec-1", 0)
+	if err != nil || !bytes.Equal(key, again) {
+		t.Errorf("Expected the same key on the second call, got %x (%v)", again, err)
+	}
+
+	// Keys are not stored in the clear
+	sealed, _ := store.LoadKey(ctx, "rec-1", 0)
+	if bytes.Contains(sealed, key) {
+		t.Error("Key stored in the clear")
+	}
+
+	// A sealed key only opens for its own recording and index
+	other, err := vault.EnsureKey(ctx, "rec-1", 1)
+	if err != nil || bytes.Equal(key, other) {
+		t.Fatalf("Expected a different key for index 1: %v", err)
+	}
+	store.keys[keyID("rec-1", 1)] = sealed
+	if _, err := vault.Key(ctx, "rec-1", 1); err == nil {
+		t.Error("Swapped sealed key opened")
+	}
+
+	// Another master key cannot open the keys
+	otherVault, _ := NewKeyVault(bytes.Repeat([]byte{8}, 32), store)
+	if _, err := otherVault.Key(ctx, "rec-1", 0); err == nil {
+		t.Error("Key opened with the wrong master key")
+	}
+}
+
+func TestParseMasterKey(t *testing.T) {
+	hexKey := strings.Repeat("ab", 32)
+	if key, err := ParseMasterKey(hexKey); err != nil || len(key) != 32 {
+		t.Errorf("Failed to parse hex key: %v", err)
+	}
+	if key, err := ParseMasterKey("AQIDBAUGBwgJCgsMDQ4PEBESExQVFhcYGRobHB0eHyA="); err != nil || key[0] != 1 {
+		t.Errorf("Failed to parse base64 key: %v", err)
+	}
+	if _, err := ParseMasterKey("too-short"); !errors.Is(err, ErrInvalidMasterKey) {
+		t.Errorf("Expected ErrInvalidMasterKey, got %v", err)
+	}
+}
+
+func TestEncryptSegment(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, HLSKeySize)
+	data := bytes.Repeat([]byte{0x47}, 188*3)
+
+	encrypted, err := EncryptSegment(key, 5, data)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if len(encrypted)%16 != 0 || len(encrypted) <= len(data) {
+		t.Errorf("Unexpected encrypted length %d", len(encrypted))
+	}
+
+	decrypted, err := DecryptSegment(key, 5, encrypted)
+	if err != nil || !bytes.Equal(decrypted, data) {
+		t.Errorf("Round trip failed: %v", err)
+	}
+
+	// The IV is the media sequence number
+	if decrypted, err := DecryptSegment(key, 6, encrypted); err == nil && bytes.Equal(decrypted, data) {
+		t.Error("Segment decrypted with the wrong sequence number")
+	}
+}
+
+func TestEncryptedVariantPlaylist(t *testing.T) {
+	logger := slog.Default()
+	dir := t.TempDir()
+	transcoder := NewMultiBitrateTranscoder(dir, "/usr/bin/ffmpeg", 4, logger)
+
+	if err := transcoder.EnableEncryption("rec-1"); !errors.Is(err, ErrEncryptionNotConfigured) {
+		t.Errorf("Expected ErrEncryptionNotConfigured, got %v", err)
+	}
+
+	transcoder.WithEncryption(newTestVault(t, NewMemoryKeyStore()), 4)
+	if err := transcoder.EnableEncryption("rec-1"); err != nil {
+		t.Fatalf("Failed to enable encryption: %v", err)
+	}
+
+	// Keys are only announced once segments were encrypted
+	if count, err := transcoder.EncryptSegments(context.Background(), "rec-1", 1000); err != nil || count != 0 {
+		t.Fatalf("Expected no segments to encrypt, got %d (%v)", count, err)
+	}
+	playlist, err := transcoder.GenerateVariantPlaylist(context.Background(), "rec-1", 1000, "playback-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(playlist, "#EXT-X-KEY") {
+		t.Fatalf("Keys announced before any segment was encrypted:\n%s", playlist)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "rec-1_1000_segment_0.ts"), []byte("segment"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := transcoder.EncryptSegments(context.Background(), "rec-1", 1000); err != nil || count != 1 {
+		t.Fatalf("Expected 1 encrypted segment, got %d (%v)", count, err)
+	}
+	playlist, err = transcoder.GenerateVariantPlaylist(context.Background(), "rec-1", 1000, "playback-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 10 segments with a new key every 4 segments
+	if n := strings.Count(playlist, "#EXT-X-KEY:METHOD=AES-128"); n != 3 {
+		t.Errorf("Expected 3 keys, got %d:\n%s", n, playlist)
+	}
+	lines := strings.Split(playlist, "\n")
+	for i, line := range lines {
+		if line == "rec-1_1000_segment_4.ts" && !strings.Contains(lines[i-2], `URI="/api/v1/transcode/rec-1/keys/1?token=playback-token"`) {
+			t.Errorf("Expected key 1 before segment 4:\n%s", playlist)
+		}
+	}
+
+	plain, err := transcoder.GenerateVariantPlaylist(context.Background(), "rec-2", 1000, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(plain, "#EXT-X-KEY") {
+		t.Error("Unencrypted recording has keys")
+	}
+}
+
+func TestEncryptSegments(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	logger := slog.Default()
+	vault := newTestVault(t, NewMemoryKeyStore())
+	transcoder := NewMultiBitrateTranscoder(dir, "/usr/bin/ffmpeg", 4, logger).WithEncryption(vault, 2)
+
+	segments := make([][]byte, 3)
+	for i := range segments {
+		segments[i] = []byte(fmt.Sprintf("segment %d payload", i))
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("rec-1_500_segment_%d.ts", i)), segments[i], 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count, err := transcoder.EncryptSegments(ctx, "rec-1", 500)
+	if err != nil || count != 3 {
+		t.Fatalf("Expected 3 encrypted segments, got %d (%v)", count, err)
+	}
+
+	for i, plain := range segments {
+		key, err := vault.Key(ctx, "rec-1", keyIndex(i, 2))
+		if err != nil {
+			t.Fatalf("Key of segment %d missing: %v", i, err)
+		}
+		data, _ := os.ReadFile(filepath.Join(dir, fmt.Sprintf("rec-1_500_segment_%d.ts", i)))
+		decrypted, err := DecryptSegment(key, i, data)
+		if err != nil || !bytes.Equal(decrypted, plain) {
+			t.Errorf("Segment %d did not decrypt: %v", i, err)
+		}
+	}
+
+	// Running again does not encrypt twice
+	if count, err := transcoder.EncryptSegments(ctx, "rec-1", 500); err != nil || count != 0 {
+		t.Errorf("Expected no segments on the second run, got %d (%v)", count, err)
+	}
+}
+
+func TestGetKeyHandler(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.Default()
+	vault := newTestVault(t, NewMemoryKeyStore())
+	transcoder := NewMultiBitrateTranscoder(t.TempDir(), "/usr/bin/ffmpeg", 4, logger).WithEncryption(vault, 10)
+	h := NewTranscodingHandlers(&TranscodingService{transcoder: transcoder}, logger)
+
+	key, err := vault.EnsureKey(ctx, "rec-1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/transcode/{id}/keys/{index}", h.withRecordingID(h.GetKeyHandler))
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/api/v1/transcode/rec-1/keys/0", http.StatusOK},
+		{"/api/v1/transcode/rec-1/keys/1", http.StatusNotFound},
+		{"/api/v1/transcode/rec-2/keys/0", http.StatusNotFound},
+		{"/api/v1/transcode/rec-1/keys/x", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.path, tt.status, w.Code)
+		}
+		if tt.status == http.StatusOK {
+			if !bytes.Equal(w.Body.Bytes(), key) {
+				t.Error("Key server returned the wrong key")
+			}
+			if w.Header().Get("Cache-Control") != "no-store" {
+				t.Error("Key response is cacheable")
+			}
+		}
+	}
+}
+
+func TestGetKeyWithPlaybackToken(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.Default()
+	vault := newTestVault(t, NewMemoryKeyStore())
+	dir := t.TempDir()
+	transcoder := NewMultiBitrateTranscoder(dir, "/usr/bin/ffmpeg", 4, logger).WithEncryption(vault, 10)
+	signer, err := recording.NewPlaybackSigner(recording.PlaybackTokenConfig{
+		Keys: []recording.PlaybackKey{{ID: "k1", Secret: []byte("first-secret-first-secret-first!")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewTranscodingHandlers(&TranscodingService{transcoder: transcoder}, logger).WithPlaybackTokens(signer)
+
+	recordingID := uuid.New()
+	if err := transcoder.EnableEncryption(recordingID.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, recordingID.String()+"_1000_segment_0.ts"), []byte("segment"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := transcoder.EncryptSegments(ctx, recordingID.String(), 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	rt := router.New()
+	h.RegisterTranscodingRoutes(rt, auth.NewAuthMiddleware(auth.NewTokenService("test-secret", 1, 1)), nil)
+
+	// Key URIs of generated playlists carry a token for the recording
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), "user_id", "user-1"))
+	token, err := h.keyToken(r, recordingID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherToken, _, err := signer.IssueSegment(uuid.New(), "user-1", "student", "", "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	playlist, err := transcoder.GenerateVariantPlaylist(ctx, recordingID.String(), 1000, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyURI := transcoder.KeyURI(recordingID.String(), 0, token)
+	if !strings.Contains(playlist, `URI="`+keyURI+`"`) {
+		t.Errorf("Key URI %s missing from playlist:\n%s", keyURI, playlist)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		status int
+	}{
+		{"no token or session", "/api/v1/transcode/" + recordingID.String() + "/keys/0", http.StatusUnauthorized},
+		{"token of another recording", transcoder.KeyURI(recordingID.String(), 0, otherToken), http.StatusForbidden},
+		{"playlist key URI", keyURI, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, w.Code)
+		}
+	}
+
+	// Playlists served to a link holder carry key tokens for the same
+	// share, so the key route checks the share
+	shareID := uuid.New().String()
+	shareToken, _, err := signer.IssueSegment(recordingID, "", "", shareID, "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keyClaims *recording.PlaybackClaims
+	rt.HandleFunc("GET /test/{id}/playlist", func(w http.ResponseWriter, r *http.Request) {
+		token, err := h.keyToken(r, recordingID.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyClaims, err = signer.Verify(r, token, recordingID, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}, recording.RequirePlaybackToken(signer, logger, nil))
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/test/"+recordingID.String()+"/playlist?"+recording.PlaybackTokenParam+"="+shareToken, nil))
+	if keyClaims == nil || keyClaims.ShareID != shareID || keyClaims.UserID != "" {
+		t.Errorf("Key token of a link holder not issued for the share: %+v", keyClaims)
+	}
+}
@@ -3,21 +3,25 @@ package streaming
 import (
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/Bashar444/VTP/pkg/auth"
+	"github.com/Bashar444/VTP/pkg/course"
+	"github.com/Bashar444/VTP/pkg/router"
 )
 
 // ABRHandlers handles HTTP requests for adaptive bitrate streaming
 type ABRHandlers struct {
 	manager *AdaptiveBitrateManager
-	logger  *log.Logger
+	logger  *slog.Logger
 }
 
 // NewABRHandlers creates a new ABR handlers instance
-func NewABRHandlers(manager *AdaptiveBitrateManager, logger *log.Logger) *ABRHandlers {
+func NewABRHandlers(manager *AdaptiveBitrateManager, logger *slog.Logger) *ABRHandlers {
 	return &ABRHandlers{
 		manager: manager,
 		logger:  logger,
@@ -25,33 +29,17 @@ func NewABRHandlers(manager *AdaptiveBitrateManager, logger *log.Logger) *ABRHan
 }
 
 // RegisterABRRoutes registers all ABR HTTP routes
-func (h *ABRHandlers) RegisterABRRoutes(mux *http.ServeMux) {
-	// Use specific ABR routes to avoid conflicts
-	mux.HandleFunc("/api/v1/recordings/{id}/abr/quality", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			recordingID := r.PathValue("id")
-			h.SelectQualityHandler(w, r, recordingID)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
-	})
+func (h *ABRHandlers) RegisterABRRoutes(rt *router.Router, am *auth.AuthMiddleware, authz *course.CourseAuthorizer) {
+	api := rt.With(am.Middleware, authz.Require(authz.RecordingScope("id"), course.MemberRoles...))
 
-	mux.HandleFunc("/api/v1/recordings/{id}/abr/stats", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			recordingID := r.PathValue("id")
-			h.GetABRStatsHandler(w, r, recordingID)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
+	api.HandleFunc("POST /api/v1/recordings/{id}/abr/quality", func(w http.ResponseWriter, r *http.Request) {
+		h.SelectQualityHandler(w, r, r.PathValue("id"))
 	})
-
-	mux.HandleFunc("/api/v1/recordings/{id}/abr/metrics", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			recordingID := r.PathValue("id")
-			h.RecordMetricsHandler(w, r, recordingID)
-		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		}
+	api.HandleFunc("GET /api/v1/recordings/{id}/abr/stats", func(w http.ResponseWriter, r *http.Request) {
+		h.GetABRStatsHandler(w, r, r.PathValue("id"))
+	})
+	api.HandleFunc("POST /api/v1/recordings/{id}/abr/metrics", func(w http.ResponseWriter, r *http.Request) {
+		h.RecordMetricsHandler(w, r, r.PathValue("id"))
 	})
 }
 
@@ -78,14 +66,14 @@ func (h *ABRHandlers) SelectQualityHandler(w http.ResponseWriter, r *http.Reques
 	// Parse request
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
-		h.logger.Printf("SelectQuality - invalid request: %v", err)
+		h.logger.WarnContext(r.Context(), "Invalid quality selection request", "recording_id", recordingID, "error", err)
 		return
 	}
 
 	// Validate bandwidth
 	if req.Bandwidth <= 0 {
 		http.Error(w, `{"error":"Bandwidth must be positive"}`, http.StatusBadRequest)
-		h.logger.Printf("SelectQuality - invalid bandwidth: %d", req.Bandwidth)
+		h.logger.WarnContext(r.Context(), "Invalid bandwidth for quality selection", "recording_id", recordingID, "bandwidth_kbps", req.Bandwidth)
 		return
 	}
 
@@ -113,7 +101,7 @@ func (h *ABRHandlers) SelectQualityHandler(w http.ResponseWriter, r *http.Reques
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 
-	h.logger.Printf("SelectQuality - recording=%s bandwidth=%d kbps -> %s (%d kbps)", recordingID, req.Bandwidth, label, bitrate)
+	h.logger.DebugContext(r.Context(), "Quality selected", "recording_id", recordingID, "bandwidth_kbps", req.Bandwidth, "quality", label, "bitrate_kbps", bitrate)
 }
 
 // SegmentMetricsRequest represents segment delivery metrics
@@ -143,7 +131,7 @@ func (h *ABRHandlers) RecordMetricsHandler(w http.ResponseWriter, r *http.Reques
 	// Parse request
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
-		h.logger.Printf("RecordMetrics - invalid request: %v", err)
+		h.logger.WarnContext(r.Context(), "Invalid ABR metrics request", "recording_id", recordingID, "error", err)
 		return
 	}
 
@@ -178,8 +166,8 @@ func (h *ABRHandlers) RecordMetricsHandler(w http.ResponseWriter, r *http.Reques
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 
-	h.logger.Printf("RecordMetrics - recording=%s segment=%d download_time=%dms buffer=%d%% -> upscale=%v downscale=%v",
-		recordingID, req.SegmentNumber, req.DownloadTime, req.BufferOccupancy, shouldUpscale, shouldDownscale)
+	h.logger.DebugContext(r.Context(), "ABR metrics recorded", "recording_id", recordingID, "segment", req.SegmentNumber,
+		"download_ms", req.DownloadTime, "buffer_pct", req.BufferOccupancy, "upscale", shouldUpscale, "downscale", shouldDownscale)
 }
 
 // ABRStatsResponse represents comprehensive ABR statistics
@@ -226,8 +214,8 @@ func (h *ABRHandlers) GetABRStatsHandler(w http.ResponseWriter, r *http.Request,
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 
-	h.logger.Printf("GetABRStats - recording=%s current=%d optimal=%d segments=%d",
-		recordingID, resp.CurrentBitrate, resp.OptimalBitrate, resp.RecentSegments)
+	h.logger.DebugContext(r.Context(), "ABR stats returned", "recording_id", recordingID, "current_kbps", resp.CurrentBitrate,
+		"optimal_kbps", resp.OptimalBitrate, "segments", resp.RecentSegments)
 }
 
 // Helper functions to convert bitrate level to properties
@@ -0,0 +1,552 @@
+package streaming
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Transcoding job priorities; workers take higher priorities first
+const (
+	PriorityBackfill  = 0
+	PriorityNormal    = 50
+	PriorityLiveToVOD = 100
+)
+
+// DefaultMaxAttempts is how often a job runs before it is marked failed
+const DefaultMaxAttempts = 3
+
+var (
+	ErrJobNotFound  = errors.New("transcoding job not found")
+	ErrJobCancelled = errors.New("transcoding job cancelled")
+	ErrLeaseLost    = errors.New("transcoding job lease lost")
+)
+
+// JobStore keeps transcoding jobs and hands them out to workers. A worker
+// leases a job for a while and renews the lease with heartbeats; a job whose
+// lease expires is handed out again, so jobs of crashed workers are not lost.
+type JobStore interface {
+	// Enqueue queues a job. A job with the same ID that is not running is
+	// queued again from scratch.
+	Enqueue(ctx context.Context, job *TranscodingJob) error
+	// Lease claims the queued job with the highest priority, or a running
+	// job whose lease expired, for workerID. It returns nil when there is
+	// no job to run.
+	Lease(ctx context.Context, workerID string, ttl time.Duration) (*TranscodingJob, error)
+	// Heartbeat renews the lease of a running job. It returns
+	// ErrJobCancelled once the job is cancelled and ErrLeaseLost when
+	// another worker took it over.
+	Heartbeat(ctx context.Context, jobID, workerID string, ttl time.Duration) error
+	// UpdateProgress saves the progress of a job
+	UpdateProgress(ctx context.Context, jobID string, progress float64) error
+	// Finish ends a job and returns its new status. A failed job is queued
+	// again when retry is set and it has attempts left. An empty workerID
+	// finishes the job whoever holds it.
+	Finish(ctx context.Context, jobID, workerID string, jobErr error, retry bool) (JobStatus, error)
+	// Cancel cancels a queued or running job
+	Cancel(ctx context.Context, jobID string) error
+	// Get returns a job or ErrJobNotFound
+	Get(ctx context.Context, jobID string) (*TranscodingJob, error)
+	// ListByRecording returns the jobs of a recording, lowest bitrate first
+	ListByRecording(ctx context.Context, recordingID string) ([]*TranscodingJob, error)
+	// Counts returns the number of jobs in each status
+	Counts(ctx context.Context) (map[JobStatus]int, error)
+}
+
+// DefaultWorkerID names this process in job leases: INSTANCE_ID when set,
+// otherwise the host name and process ID
+func DefaultWorkerID() string {
+	if id := os.Getenv("INSTANCE_ID"); id != "" {
+		return id
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// finishStatus is the status a job ends in
+func finishStatus(job *TranscodingJob, jobErr error, retry bool) JobStatus {
+	switch {
+	case jobErr == nil:
+		return JobCompleted
+	case retry && job.Attempts < job.MaxAttempts:
+		return JobQueued
+	default:
+		return JobFailed
+	}
+}
+
+// SQLJobStore keeps jobs in the transcoding_jobs table, shared by all
+// replicas
+type SQLJobStore struct {
+	db *sql.DB
+}
+
+// NewSQLJobStore creates a job store backed by the database
+func NewSQLJobStore(db *sql.DB) *SQLJobStore {
+	return &SQLJobStore{db: db}
+}
+
+const jobColumns = `job_id, recording_id, bitrate, resolution, frame_rate, label, input_path, output_path,
+	encrypted, status, priority, attempts, max_attempts, progress, COALESCE(worker_id, ''),
+	lease_expires_at, last_error, started_at, finished_at`
+
+type jobScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanJob(row jobScanner) (*TranscodingJob, error) {
+	var job TranscodingJob
+	var status string
+	var lease, started, finished sql.NullTime
+	var lastError sql.NullString
+	err := row.Scan(&job.JobID, &job.RecordingID, &job.Profile.Bitrate, &job.Profile.Resolution,
+		&job.Profile.FrameRate, &job.Profile.Label, &job.InputPath, &job.OutputPath,
+		&job.Encrypted, &status, &job.Priority, &job.Attempts, &job.MaxAttempts, &job.Progress, &job.WorkerID,
+		&lease, &lastError, &started, &finished)
+	if err != nil {
+		return nil, err
+	}
+	job.Status = JobStatus(status)
+	job.LeaseExpires = lease.Time
+	job.StartTime = started.Time
+	job.EndTime = finished.Time
+	if lastError.Valid {
+		job.Error = errors.New(lastError.String)
+	}
+	return &job, nil
+}
+
+// Enqueue queues a job
+func (s *SQLJobStore) Enqueue(ctx context.Context, job *TranscodingJob) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO transcoding_jobs (job_id, recording_id, bitrate, resolution, frame_rate, label,
+			input_path, output_path, encrypted, priority, max_attempts)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (job_id) DO UPDATE SET
+			bitrate = EXCLUDED.bitrate, resolution = EXCLUDED.resolution, frame_rate = EXCLUDED.frame_rate,
+			label = EXCLUDED.label, input_path = EXCLUDED.input_path, output_path = EXCLUDED.output_path,
+			encrypted = EXCLUDED.encrypted, priority = EXCLUDED.priority, max_attempts = EXCLUDED.max_attempts,
+			status = 'queued', attempts = 0, progress = 0, worker_id = NULL, lease_expires_at = NULL,
+			heartbeat_at = NULL, last_error = NULL, created_at = NOW(), started_at = NOW(),
+			finished_at = NULL, updated_at = NOW()
+		WHERE transcoding_jobs.status <> 'running'
+	`, job.JobID, job.RecordingID, job.Profile.Bitrate, job.Profile.Resolution, job.Profile.FrameRate,
+		job.Profile.Label, job.InputPath, job.OutputPath, job.Encrypted, job.Priority, job.MaxAttempts)
+	if err != nil {
+		return fmt.Errorf("failed to queue transcoding job: %w", err)
+	}
+	return nil
+}
+
+// Lease claims the next job. Running jobs whose lease expired after their
+// last attempt are marked failed instead of being handed out again.
+func (s *SQLJobStore) Lease(ctx context.Context, workerID string, ttl time.Duration) (*TranscodingJob, error) {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE transcoding_jobs
+		SET status = 'failed', last_error = 'worker lease expired', worker_id = NULL,
+			lease_expires_at = NULL, finished_at = NOW(), updated_at = NOW()
+		WHERE status = 'running' AND lease_expires_at < NOW() AND attempts >= max_attempts
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire transcoding jobs: %w", err)
+	}
+
+	job, err := scanJob(s.db.QueryRowContext(ctx, `
+		UPDATE transcoding_jobs
+		SET status = 'running', worker_id = $1, attempts = attempts + 1, progress = 0,
+			lease_expires_at = NOW() + make_interval(secs => $2), heartbeat_at = NOW(),
+			started_at = NOW(), finished_at = NULL, updated_at = NOW()
+		WHERE job_id = (
+			SELECT job_id FROM transcoding_jobs
+			WHERE status = 'queued' OR (status = 'running' AND lease_expires_at < NOW())
+			ORDER BY priority DESC, created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+jobColumns, workerID, ttl.Seconds()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lease transcoding job: %w", err)
+	}
+	return job, nil
+}
+
+// leaseError explains why a job is not held by a worker
+func (s *SQLJobStore) leaseError(ctx context.Context, jobID string) error {
+	var status string
+	err := s.db.QueryRowContext(ctx, `SELECT status FROM transcoding_jobs WHERE job_id = $1`, jobID).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrJobNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load transcoding job: %w", err)
+	}
+	if JobStatus(status) == JobCancelled {
+		return ErrJobCancelled
+	}
+	return ErrLeaseLost
+}
+
+// Heartbeat renews a lease
+func (s *SQLJobStore) Heartbeat(ctx context.Context, jobID, workerID string, ttl time.Duration) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE transcoding_jobs
+		SET lease_expires_at = NOW() + make_interval(secs => $3), heartbeat_at = NOW(), updated_at = NOW()
+		WHERE job_id = $1 AND worker_id = $2 AND status = 'running'
+	`, jobID, workerID, ttl.Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to renew transcoding lease: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return s.leaseError(ctx, jobID)
+	}
+	return nil
+}
+
+// UpdateProgress saves the progress of a job
+func (s *SQLJobStore) UpdateProgress(ctx context.Context, jobID string, progress float64) error {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE transcoding_jobs SET progress = $2, updated_at = NOW() WHERE job_id = $1`,
+		jobID, progress,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update transcoding progress: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// Finish ends a job
+func (s *SQLJobStore) Finish(ctx context.Context, jobID, workerID string, jobErr error, retry bool) (JobStatus, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	job, err := scanJob(tx.QueryRowContext(ctx,
+		`SELECT `+jobColumns+` FROM transcoding_jobs WHERE job_id = $1 FOR UPDATE`, jobID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrJobNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to load transcoding job: %w", err)
+	}
+	if err := jobHeldBy(job, workerID); err != nil {
+		return "", err
+	}
+
+	status := finishStatus(job, jobErr, retry)
+	var lastError sql.NullString
+	if jobErr != nil {
+		lastError = sql.NullString{String: jobErr.Error(), Valid: true}
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE transcoding_jobs
+		SET status = $2, last_error = $3, worker_id = NULL, lease_expires_at = NULL,
+			progress = CASE $2 WHEN 'completed' THEN 100 WHEN 'queued' THEN 0 ELSE progress END,
+			finished_at = CASE WHEN $2 = 'queued' THEN NULL ELSE NOW() END, updated_at = NOW()
+		WHERE job_id = $1
+	`, jobID, string(status), lastError)
+	if err != nil {
+		return "", fmt.Errorf("failed to finish transcoding job: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to finish transcoding job: %w", err)
+	}
+	return status, nil
+}
+
+// Cancel cancels a queued or running job
+func (s *SQLJobStore) Cancel(ctx context.Context, jobID string) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE transcoding_jobs
+		SET status = 'cancelled', worker_id = NULL, lease_expires_at = NULL, finished_at = NOW(), updated_at = NOW()
+		WHERE job_id = $1 AND status IN ('queued', 'running')
+	`, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel transcoding job: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		if _, err := s.Get(ctx, jobID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns a job
+func (s *SQLJobStore) Get(ctx context.Context, jobID string) (*TranscodingJob, error) {
+	job, err := scanJob(s.db.QueryRowContext(ctx,
+		`SELECT `+jobColumns+` FROM transcoding_jobs WHERE job_id = $1`, jobID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load transcoding job: %w", err)
+	}
+	return job, nil
+}
+
+// ListByRecording returns the jobs of a recording
+func (s *SQLJobStore) ListByRecording(ctx context.Context, recordingID string) ([]*TranscodingJob, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+jobColumns+` FROM transcoding_jobs WHERE recording_id = $1 ORDER BY bitrate`, recordingID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transcoding jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*TranscodingJob
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan transcoding job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// Counts returns the number of jobs in each status
+func (s *SQLJobStore) Counts(ctx context.Context) (map[JobStatus]int, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT status, COUNT(*) FROM transcoding_jobs GROUP BY status`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count transcoding jobs: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[JobStatus]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan transcoding job count: %w", err)
+		}
+		counts[JobStatus(status)] = count
+	}
+	return counts, rows.Err()
+}
+
+// jobHeldBy checks that a job can still be finished by workerID
+func jobHeldBy(job *TranscodingJob, workerID string) error {
+	switch {
+	case job.Status == JobCancelled:
+		return ErrJobCancelled
+	case job.Status != JobQueued && job.Status != JobRunning:
+		return ErrLeaseLost
+	case workerID != "" && job.WorkerID != workerID:
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// MemoryJobStore keeps jobs in memory, for tests and single-node setups
+// without a database
+type MemoryJobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*TranscodingJob
+	seq  map[string]int64 // queue order of each job
+	next int64
+}
+
+// NewMemoryJobStore creates an empty in-memory job store
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{
+		jobs: make(map[string]*TranscodingJob),
+		seq:  make(map[string]int64),
+	}
+}
+
+// Enqueue queues a job
+func (s *MemoryJobStore) Enqueue(ctx context.Context, job *TranscodingJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.jobs[job.JobID]; ok && existing.Status == JobRunning {
+		return nil
+	}
+	queued := *job
+	queued.Status = JobQueued
+	queued.Attempts = 0
+	queued.Progress = 0
+	queued.WorkerID = ""
+	queued.LeaseExpires = time.Time{}
+	queued.EndTime = time.Time{}
+	queued.Error = nil
+	s.jobs[job.JobID] = &queued
+	s.next++
+	s.seq[job.JobID] = s.next
+	return nil
+}
+
+// Lease claims the next job
+func (s *MemoryJobStore) Lease(ctx context.Context, workerID string, ttl time.Duration) (*TranscodingJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var next *TranscodingJob
+	for _, job := range s.jobs {
+		expired := job.Status == JobRunning && job.LeaseExpires.Before(now)
+		if expired && job.Attempts >= job.MaxAttempts {
+			job.Status = JobFailed
+			job.Error = errors.New("worker lease expired")
+			job.WorkerID = ""
+			job.EndTime = now
+			continue
+		}
+		if job.Status != JobQueued && !expired {
+			continue
+		}
+		if next == nil || job.Priority > next.Priority ||
+			(job.Priority == next.Priority && s.seq[job.JobID] < s.seq[next.JobID]) {
+			next = job
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+
+	next.Status = JobRunning
+	next.WorkerID = workerID
+	next.Attempts++
+	next.Progress = 0
+	next.LeaseExpires = now.Add(ttl)
+	next.StartTime = now
+	next.EndTime = time.Time{}
+	leased := *next
+	return &leased, nil
+}
+
+// Heartbeat renews a lease
+func (s *MemoryJobStore) Heartbeat(ctx context.Context, jobID, workerID string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return ErrJobNotFound
+	}
+	if job.Status == JobCancelled {
+		return ErrJobCancelled
+	}
+	if job.Status != JobRunning || job.WorkerID != workerID {
+		return ErrLeaseLost
+	}
+	job.LeaseExpires = time.Now().Add(ttl)
+	return nil
+}
+
+// UpdateProgress saves the progress of a job
+func (s *MemoryJobStore) UpdateProgress(ctx context.Context, jobID string, progress float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return ErrJobNotFound
+	}
+	job.Progress = progress
+	return nil
+}
+
+// Finish ends a job
+func (s *MemoryJobStore) Finish(ctx context.Context, jobID, workerID string, jobErr error, retry bool) (JobStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return "", ErrJobNotFound
+	}
+	if err := jobHeldBy(job, workerID); err != nil {
+		return "", err
+	}
+
+	job.Status = finishStatus(job, jobErr, retry)
+	job.Error = jobErr
+	job.WorkerID = ""
+	job.LeaseExpires = time.Time{}
+	switch job.Status {
+	case JobCompleted:
+		job.Progress = 100.0
+		job.EndTime = time.Now()
+	case JobQueued:
+		job.Progress = 0
+	default:
+		job.EndTime = time.Now()
+	}
+	return job.Status, nil
+}
+
+// Cancel cancels a queued or running job
+func (s *MemoryJobStore) Cancel(ctx context.Context, jobID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return ErrJobNotFound
+	}
+	if job.Status == JobQueued || job.Status == JobRunning {
+		job.Status = JobCancelled
+		job.WorkerID = ""
+		job.LeaseExpires = time.Time{}
+		job.EndTime = time.Now()
+	}
+	return nil
+}
+
+// Get returns a job
+func (s *MemoryJobStore) Get(ctx context.Context, jobID string) (*TranscodingJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	copied := *job
+	return &copied, nil
+}
+
+// ListByRecording returns the jobs of a recording
+func (s *MemoryJobStore) ListByRecording(ctx context.Context, recordingID string) ([]*TranscodingJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var jobs []*TranscodingJob
+	for _, job := range s.jobs {
+		if job.RecordingID == recordingID {
+			copied := *job
+			jobs = append(jobs, &copied)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Profile.Bitrate < jobs[j].Profile.Bitrate })
+	return jobs, nil
+}
+
+// Counts returns the number of jobs in each status
+func (s *MemoryJobStore) Counts(ctx context.Context) (map[JobStatus]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[JobStatus]int)
+	for _, job := range s.jobs {
+		counts[job.Status]++
+	}
+	return counts, nil
+}
@@ -0,0 +1,238 @@
+package streaming
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func queueTestJob(t *testing.T, store JobStore, jobID string, priority int) {
+	t.Helper()
+	err := store.Enqueue(context.Background(), &TranscodingJob{
+		JobID:       jobID,
+		RecordingID: "rec-001",
+		Profile:     EncodingProfile{Bitrate: 1000},
+		Priority:    priority,
+		MaxAttempts: 2,
+	})
+	if err != nil {
+		t.Fatalf("Failed to queue %s: %v", jobID, err)
+	}
+}
+
+func TestMemoryJobStoreLeaseOrder(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryJobStore()
+	queueTestJob(t, store, "backfill", PriorityBackfill)
+	queueTestJob(t, store, "normal-1", PriorityNormal)
+	queueTestJob(t, store, "live", PriorityLiveToVOD)
+	queueTestJob(t, store, "normal-2", PriorityNormal)
+
+	for _, want := range []string{"live", "normal-1", "normal-2", "backfill"} {
+		job, err := store.Lease(ctx, "worker-1", time.Minute)
+		if err != nil || job == nil {
+			t.Fatalf("Expected %s, got %v, %v", want, job, err)
+		}
+		if job.JobID != want || job.WorkerID != "worker-1" || job.Attempts != 1 || job.Status != JobRunning {
+			t.Errorf("Expected %s leased by worker-1, got %+v", want, job)
+		}
+	}
+	if job, _ := store.Lease(ctx, "worker-1", time.Minute); job != nil {
+		t.Errorf("Leased %s from an empty queue", job.JobID)
+	}
+
+	counts, _ := store.Counts(ctx)
+	if counts[JobRunning] != 4 || counts[JobQueued] != 0 {
+		t.Errorf("Unexpected counts %v", counts)
+	}
+}
+
+func TestMemoryJobStoreLeaseExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryJobStore()
+	queueTestJob(t, store, "job-1", PriorityNormal)
+
+	// The first worker dies without renewing its lease
+	if job, _ := store.Lease(ctx, "worker-1", -time.Second); job == nil {
+		t.Fatal("Expected a job")
+	}
+	job, _ := store.Lease(ctx, "worker-2", -time.Second)
+	if job == nil || job.WorkerID != "worker-2" || job.Attempts != 2 {
+		t.Fatalf("Expected the expired job taken over by worker-2, got %+v", job)
+	}
+	if err := store.Heartbeat(ctx, "job-1", "worker-1", time.Minute); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Expected ErrLeaseLost for the old worker, got %v", err)
+	}
+	if _, err := store.Finish(ctx, "job-1", "worker-1", nil, true); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Old worker finished a job it lost, got %v", err)
+	}
+
+	// Expiring after the last attempt fails the job
+	if job, _ := store.Lease(ctx, "worker-3", time.Minute); job != nil {
+		t.Errorf("Job leased after using its attempts: %+v", job)
+	}
+	job, _ = store.Get(ctx, "job-1")
+	if job.Status != JobFailed || job.Error == nil {
+		t.Errorf("Expected a failed job with an error, got %+v", job)
+	}
+}
+
+func TestMemoryJobStoreRetry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryJobStore()
+	queueTestJob(t, store, "job-1", PriorityNormal)
+	jobErr := fmt.Errorf("ffmpeg exited with status 1")
+
+	store.Lease(ctx, "worker-1", time.Minute)
+	status, err := store.Finish(ctx, "job-1", "worker-1", jobErr, true)
+	if err != nil || status != JobQueued {
+		t.Fatalf("Expected the job queued again, got %s, %v", status, err)
+	}
+	job, _ := store.Get(ctx, "job-1")
+	if job.Error == nil || job.Error.Error() != jobErr.Error() || job.WorkerID != "" {
+		t.Errorf("Error not captured or lease kept: %+v", job)
+	}
+
+	store.Lease(ctx, "worker-2", time.Minute)
+	if status, _ := store.Finish(ctx, "job-1", "worker-2", jobErr, true); status != JobFailed {
+		t.Errorf("Expected the job failed after its last attempt, got %s", status)
+	}
+
+	// Queuing the recording again starts from scratch
+	queueTestJob(t, store, "job-1", PriorityNormal)
+	job, _ = store.Get(ctx, "job-1")
+	if job.Status != JobQueued || job.Attempts != 0 || job.Error != nil {
+		t.Errorf("Expected a fresh job, got %+v", job)
+	}
+}
+
+func TestMemoryJobStoreCancel(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryJobStore()
+	queueTestJob(t, store, "job-1", PriorityNormal)
+	store.Lease(ctx, "worker-1", time.Minute)
+
+	// Queuing a running job again leaves it running
+	queueTestJob(t, store, "job-1", PriorityNormal)
+	if job, _ := store.Get(ctx, "job-1"); job.Status != JobRunning {
+		t.Errorf("Running job queued again: %+v", job)
+	}
+
+	if err := store.Cancel(ctx, "job-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Heartbeat(ctx, "job-1", "worker-1", time.Minute); !errors.Is(err, ErrJobCancelled) {
+		t.Errorf("Expected ErrJobCancelled, got %v", err)
+	}
+	if _, err := store.Finish(ctx, "job-1", "worker-1", nil, true); !errors.Is(err, ErrJobCancelled) {
+		t.Errorf("Cancelled job finished, got %v", err)
+	}
+	if err := store.Cancel(ctx, "job-404"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestSharedJobStore(t *testing.T) {
+	logger := slog.Default()
+	store := NewMemoryJobStore()
+	first := NewMultiBitrateTranscoder(t.TempDir(), "/usr/bin/ffmpeg", 4, logger).WithJobStore(store)
+	second := NewMultiBitrateTranscoder(t.TempDir(), "/usr/bin/ffmpeg", 4, logger).WithJobStore(store)
+
+	jobIDs, err := first.QueueMultiBitrateJob(context.Background(), "rec-shared", "/tmp/test.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Progress and cancellation work from any replica
+	first.UpdateJobProgress(context.Background(), jobIDs[0], 40.0, 30.0)
+	if stats := second.GetJobStats(context.Background(), jobIDs[0]); stats.Progress != 40.0 || stats.Status != JobQueued {
+		t.Errorf("Progress not shared: %+v", stats)
+	}
+	if err := second.CancelJob(context.Background(), jobIDs[1]); err != nil {
+		t.Fatal(err)
+	}
+	if job := first.GetJob(context.Background(), jobIDs[1]); job.Status != JobCancelled {
+		t.Errorf("Cancellation not shared: %+v", job)
+	}
+	if len(second.GetAllJobs(context.Background(), "rec-shared")) != 4 {
+		t.Error("Expected all jobs listed by the other replica")
+	}
+	if err := second.CancelJob(context.Background(), "rec-shared-404"); err == nil {
+		t.Error("Expected an error cancelling an unknown job")
+	}
+}
+
+func TestTranscodingServiceRunsJobs(t *testing.T) {
+	logger := slog.Default()
+	transcoder := NewMultiBitrateTranscoder(t.TempDir(), "/usr/bin/ffmpeg", 4, logger)
+	if _, err := transcoder.QueuePriorityJob(context.Background(), "rec-backfill", "/tmp/old.mp4", PriorityBackfill); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := transcoder.QueuePriorityJob(context.Background(), "rec-live", "/tmp/live.mp4", PriorityLiveToVOD); err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewTranscodingService(transcoder, 2, logger)
+	defer service.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) && !transcoder.IsRecordingCompleted(context.Background(), "rec-backfill") {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !transcoder.IsRecordingCompleted(context.Background(), "rec-live") || !transcoder.IsRecordingCompleted(context.Background(), "rec-backfill") {
+		t.Fatalf("Jobs not completed: %v", service.GetRecordingTranscodingStatus(context.Background(), "rec-backfill"))
+	}
+
+	// Live-to-VOD jobs ran first
+	live := transcoder.GetAllJobs(context.Background(), "rec-live")
+	backfill := transcoder.GetAllJobs(context.Background(), "rec-backfill")
+	if live[0].StartTime.After(backfill[0].StartTime) {
+		t.Error("Backfill started before the live-to-VOD recording")
+	}
+	if live[0].Attempts != 1 || live[0].WorkerID != "" {
+		t.Errorf("Unexpected finished job %+v", live[0])
+	}
+}
+
+func TestKeepLeaseStopsCancelledJob(t *testing.T) {
+	logger := slog.Default()
+	transcoder := NewMultiBitrateTranscoder(t.TempDir(), "/usr/bin/ffmpeg", 4, logger)
+	service := NewTranscodingService(transcoder, 0, logger)
+	defer service.Stop()
+	service.leaseTTL = 30 * time.Millisecond
+
+	transcoder.QueueMultiBitrateJob(context.Background(), "rec-cancel", "/tmp/test.mp4")
+	job, err := transcoder.leaseJob(context.Background(), "worker-1", service.leaseTTL)
+	if err != nil || job == nil {
+		t.Fatalf("Expected a job, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	done := make(chan struct{})
+	go func() {
+		service.keepLease(ctx, cancel, job.JobID, "worker-1")
+		close(done)
+	}()
+
+	// Heartbeats keep the lease alive
+	time.Sleep(50 * time.Millisecond)
+	if leased, _ := transcoder.leaseJob(context.Background(), "worker-2", time.Minute); leased != nil && leased.JobID == job.JobID {
+		t.Error("Job with a live lease was taken over")
+	}
+
+	if err := transcoder.CancelJob(context.Background(), job.JobID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Worker not stopped after cancellation")
+	}
+	if !errors.Is(context.Cause(ctx), ErrJobCancelled) {
+		t.Errorf("Expected ErrJobCancelled, got %v", context.Cause(ctx))
+	}
+}
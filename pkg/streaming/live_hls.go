@@ -0,0 +1,376 @@
+package streaming
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrRenditionNotFound = errors.New("no live segments for bitrate")
+	ErrLiveSegmentGone   = errors.New("live segment not available")
+	ErrMSNTooFarAhead    = errors.New("requested media sequence is too far ahead of the live edge")
+	ErrInvalidPart       = errors.New("invalid partial segment")
+)
+
+// LiveHLSConfig configures the live media playlists of a distributor
+type LiveHLSConfig struct {
+	// WindowSize is the number of complete segments a playlist lists
+	WindowSize int
+	// PartTarget is the target duration of LL-HLS partial segments
+	PartTarget time.Duration
+	// PartWindow is the number of complete segments before the live edge
+	// whose parts are still listed
+	PartWindow int
+}
+
+// DefaultLiveHLSConfig returns the default live playlist configuration
+func DefaultLiveHLSConfig() LiveHLSConfig {
+	return LiveHLSConfig{
+		WindowSize: 6,
+		PartTarget: 500 * time.Millisecond,
+		PartWindow: 2,
+	}
+}
+
+// LivePart is an LL-HLS partial segment of a segment still being encoded
+type LivePart struct {
+	Index       int
+	DurationMs  int64
+	Independent bool // starts with a keyframe
+	Data        []byte
+}
+
+// liveRendition tracks the segment of a bitrate that is being built from
+// parts
+type liveRendition struct {
+	pendingMSN   int64
+	pendingParts []*LivePart
+	hasPending   bool
+}
+
+// SetLiveHLSConfig changes the live playlist configuration
+func (ld *LiveDistributor) SetLiveHLSConfig(cfg LiveHLSConfig) {
+	ld.liveMu.Lock()
+	defer ld.liveMu.Unlock()
+
+	ld.hlsConfig = cfg
+}
+
+// liveChanged returns a channel closed on the next playlist change
+func (ld *LiveDistributor) liveChanged() <-chan struct{} {
+	ld.liveMu.Lock()
+	defer ld.liveMu.Unlock()
+
+	return ld.liveUpdate
+}
+
+// notifyLive wakes requests blocked on a playlist change. Callers hold
+// liveMu.
+func (ld *LiveDistributor) notifyLive() {
+	close(ld.liveUpdate)
+	ld.liveUpdate = make(chan struct{})
+}
+
+// attachLiveParts gives a complete segment the parts it was built from, so
+// they stay listed after the segment arrives
+func (ld *LiveDistributor) attachLiveParts(segment *VideoSegment) {
+	ld.liveMu.Lock()
+	defer ld.liveMu.Unlock()
+
+	if rendition, ok := ld.live[segment.Bitrate]; ok && rendition.hasPending && rendition.pendingMSN == segment.SequenceNum && len(segment.Parts) == 0 {
+		segment.Parts = rendition.pendingParts
+	}
+}
+
+// completeLiveSegment drops the pending parts of a queued segment and wakes
+// blocked playlist requests
+func (ld *LiveDistributor) completeLiveSegment(segment *VideoSegment) {
+	ld.liveMu.Lock()
+	defer ld.liveMu.Unlock()
+
+	if rendition, ok := ld.live[segment.Bitrate]; ok && rendition.hasPending && rendition.pendingMSN <= segment.SequenceNum {
+		rendition.pendingParts = nil
+		rendition.hasPending = false
+	}
+	ld.notifyLive()
+}
+
+// AppendPart adds a partial segment to the segment with media sequence
+// number msn. Parts must arrive in order; a part of a later segment drops
+// the parts of an unfinished earlier one.
+func (ld *LiveDistributor) AppendPart(bitrate string, msn int64, part *LivePart) error {
+	if part == nil || part.DurationMs <= 0 || len(part.Data) == 0 {
+		return ErrInvalidPart
+	}
+	if _, ok := ld.DistributionProfiles[bitrate]; !ok {
+		return fmt.Errorf("invalid bitrate: %s", bitrate)
+	}
+
+	// Hold off EnqueueSegment so a segment cannot complete mid-append
+	ld.mu.RLock()
+	defer ld.mu.RUnlock()
+
+	if ld.closed {
+		return fmt.Errorf("distributor is closed")
+	}
+	if ld.segmentBySequence(bitrate, msn) != nil {
+		return fmt.Errorf("%w: segment %d is already complete", ErrInvalidPart, msn)
+	}
+
+	ld.liveMu.Lock()
+	defer ld.liveMu.Unlock()
+
+	rendition, ok := ld.live[bitrate]
+	if !ok {
+		rendition = &liveRendition{}
+		ld.live[bitrate] = rendition
+	}
+	if !rendition.hasPending || msn > rendition.pendingMSN {
+		rendition.pendingMSN = msn
+		rendition.pendingParts = nil
+		rendition.hasPending = true
+	}
+	if msn < rendition.pendingMSN || part.Index != len(rendition.pendingParts) {
+		return fmt.Errorf("%w: expected part %d of segment %d", ErrInvalidPart, len(rendition.pendingParts), rendition.pendingMSN)
+	}
+
+	rendition.pendingParts = append(rendition.pendingParts, part)
+	ld.notifyLive()
+	return nil
+}
+
+// liveSegments returns the complete segments of a bitrate in sequence order
+func (ld *LiveDistributor) liveSegments(bitrate string) []*VideoSegment {
+	segments := ld.segmentQueue.GetSegmentsByBitrate(bitrate)
+	sort.Slice(segments, func(i, j int) bool { return segments[i].SequenceNum < segments[j].SequenceNum })
+	return segments
+}
+
+// segmentBySequence returns a complete segment by media sequence number
+func (ld *LiveDistributor) segmentBySequence(bitrate string, msn int64) *VideoSegment {
+	for _, segment := range ld.segmentQueue.GetSegmentsByBitrate(bitrate) {
+		if segment.SequenceNum == msn {
+			return segment
+		}
+	}
+	return nil
+}
+
+// pendingParts returns the segment being built from parts, if any
+func (ld *LiveDistributor) pendingParts(bitrate string) (int64, []*LivePart, bool) {
+	ld.liveMu.Lock()
+	defer ld.liveMu.Unlock()
+
+	rendition, ok := ld.live[bitrate]
+	if !ok || !rendition.hasPending {
+		return 0, nil, false
+	}
+	return rendition.pendingMSN, append([]*LivePart(nil), rendition.pendingParts...), true
+}
+
+// liveEdge returns the newest media sequence number of a bitrate, complete
+// or in progress
+func (ld *LiveDistributor) liveEdge(bitrate string) (int64, bool) {
+	edge, found := int64(-1), false
+	if segments := ld.liveSegments(bitrate); len(segments) > 0 {
+		edge, found = segments[len(segments)-1].SequenceNum, true
+	}
+	if msn, _, ok := ld.pendingParts(bitrate); ok && msn > edge {
+		edge, found = msn, true
+	}
+	return edge, found
+}
+
+// hasPart reports whether a playlist would list part of segment msn, or the
+// whole segment when part is negative
+func (ld *LiveDistributor) hasPart(bitrate string, msn int64, part int) bool {
+	if segment := ld.segmentBySequence(bitrate, msn); segment != nil {
+		return true
+	}
+	if part < 0 {
+		return false
+	}
+	pendingMSN, parts, ok := ld.pendingParts(bitrate)
+	return ok && pendingMSN == msn && part < len(parts)
+}
+
+// WaitForPart blocks until the playlist of a bitrate contains segment msn,
+// or its part when part is not negative. This is the LL-HLS blocking
+// playlist reload; requests more than two segments past the live edge are
+// rejected.
+func (ld *LiveDistributor) WaitForPart(ctx context.Context, bitrate string, msn int64, part int) error {
+	for {
+		changed := ld.liveChanged()
+		if ld.hasPart(bitrate, msn, part) {
+			return nil
+		}
+		if edge, ok := ld.liveEdge(bitrate); !ok || msn > edge+2 {
+			return ErrMSNTooFarAhead
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// MediaPlaylist renders the live media playlist of a bitrate: a sliding
+// window of complete segments, then the parts of the segment being built
+func (ld *LiveDistributor) MediaPlaylist(bitrate string) (string, error) {
+	ld.liveMu.Lock()
+	cfg := ld.hlsConfig
+	ld.liveMu.Unlock()
+
+	segments := ld.liveSegments(bitrate)
+	pendingMSN, pending, hasPending := ld.pendingParts(bitrate)
+	if len(segments) == 0 && !hasPending {
+		return "", ErrRenditionNotFound
+	}
+
+	if cfg.WindowSize > 0 && len(segments) > cfg.WindowSize {
+		segments = segments[len(segments)-cfg.WindowSize:]
+	}
+
+	lowLatency := hasPending
+	targetDuration := int64(0)
+	for _, segment := range segments {
+		targetDuration = max(targetDuration, segment.DurationMs)
+		lowLatency = lowLatency || len(segment.Parts) > 0
+	}
+	if profile, ok := ld.DistributionProfiles[bitrate]; ok {
+		targetDuration = max(targetDuration, profile.SegmentDuration.Milliseconds())
+	}
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	if lowLatency {
+		b.WriteString("#EXT-X-VERSION:9\n")
+	} else {
+		b.WriteString("#EXT-X-VERSION:6\n")
+	}
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int64(math.Ceil(float64(targetDuration)/1000)))
+	if lowLatency {
+		partTarget := cfg.PartTarget.Seconds()
+		fmt.Fprintf(&b, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%.3f\n", 3*partTarget)
+		fmt.Fprintf(&b, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", partTarget)
+	}
+
+	mediaSequence := pendingMSN
+	if len(segments) > 0 {
+		mediaSequence = segments[0].SequenceNum
+	}
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", mediaSequence)
+
+	for i, segment := range segments {
+		if i > 0 && segment.SequenceNum != segments[i-1].SequenceNum+1 {
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		fmt.Fprintf(&b, "#EXT-X-PROGRAM-DATE-TIME:%s\n", segment.CreatedTime.UTC().Format("2006-01-02T15:04:05.000Z"))
+		if len(segments)-i <= cfg.PartWindow {
+			writeParts(&b, segment.SequenceNum, segment.Parts)
+		}
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%d.ts\n", float64(segment.DurationMs)/1000, segment.SequenceNum)
+	}
+
+	if hasPending {
+		writeParts(&b, pendingMSN, pending)
+		fmt.Fprintf(&b, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"%d.%d.ts\"\n", pendingMSN, len(pending))
+	}
+
+	return b.String(), nil
+}
+
+func writeParts(b *strings.Builder, msn int64, parts []*LivePart) {
+	for _, part := range parts {
+		fmt.Fprintf(b, "#EXT-X-PART:DURATION=%.3f,URI=\"%d.%d.ts\"", float64(part.DurationMs)/1000, msn, part.Index)
+		if part.Independent {
+			b.WriteString(",INDEPENDENT=YES")
+		}
+		b.WriteString("\n")
+	}
+}
+
+// MasterPlaylist lists the bitrates that have live segments
+func (ld *LiveDistributor) MasterPlaylist() (string, error) {
+	bandwidth := map[string]int{"VeryLow": 500000, "Low": 1000000, "Medium": 2000000, "High": 4000000}
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:6\n")
+	found := false
+	for _, bitrate := range []string{"VeryLow", "Low", "Medium", "High"} {
+		if _, ok := ld.liveEdge(bitrate); !ok {
+			continue
+		}
+		found = true
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d\n%s/playlist.m3u8\n", bandwidth[bitrate], bitrate)
+	}
+	if !found {
+		return "", ErrRenditionNotFound
+	}
+	return b.String(), nil
+}
+
+// SegmentData returns the bytes of a complete segment from the queue
+func (ld *LiveDistributor) SegmentData(bitrate string, msn int64) ([]byte, error) {
+	segment := ld.segmentBySequence(bitrate, msn)
+	if segment == nil {
+		return nil, ErrLiveSegmentGone
+	}
+
+	data := segment.Data
+	if data == nil && segment.FilePath != "" {
+		var err error
+		if data, err = os.ReadFile(segment.FilePath); err != nil {
+			return nil, fmt.Errorf("failed to read segment: %w", err)
+		}
+	}
+	if data == nil {
+		return nil, ErrLiveSegmentGone
+	}
+
+	ld.recordServed(segment, int64(len(data)))
+	return data, nil
+}
+
+// PartData returns the bytes of a partial segment, waiting for a part that
+// the playlist hinted but the encoder has not delivered yet
+func (ld *LiveDistributor) PartData(ctx context.Context, bitrate string, msn int64, index int) ([]byte, error) {
+	if err := ld.WaitForPart(ctx, bitrate, msn, index); err != nil {
+		return nil, err
+	}
+
+	if segment := ld.segmentBySequence(bitrate, msn); segment != nil {
+		if index >= len(segment.Parts) {
+			return nil, ErrLiveSegmentGone
+		}
+		ld.recordServed(nil, int64(len(segment.Parts[index].Data)))
+		return segment.Parts[index].Data, nil
+	}
+
+	pendingMSN, parts, ok := ld.pendingParts(bitrate)
+	if !ok || pendingMSN != msn || index >= len(parts) {
+		return nil, ErrLiveSegmentGone
+	}
+	ld.recordServed(nil, int64(len(parts[index].Data)))
+	return parts[index].Data, nil
+}
+
+// recordServed counts a segment or part served over HTTP
+func (ld *LiveDistributor) recordServed(segment *VideoSegment, bytes int64) {
+	ld.statsMu.Lock()
+	defer ld.statsMu.Unlock()
+
+	if segment != nil {
+		segment.Delivered++
+		ld.stats.TotalSegmentsServed++
+	}
+	ld.stats.TotalBytesServed += bytes
+}
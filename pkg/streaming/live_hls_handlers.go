@@ -0,0 +1,237 @@
+package streaming
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/utils"
+)
+
+// maxLiveSegmentBytes bounds the body of a segment or part upload
+const maxLiveSegmentBytes = 32 << 20
+
+// parseLiveURI parses a live segment name: "N.ts" for segment N or "N.P.ts"
+// for part P of segment N. part is -1 for a full segment.
+func parseLiveURI(name string) (msn int64, part int, err error) {
+	base, ok := strings.CutSuffix(name, ".ts")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid segment name: %s", name)
+	}
+
+	seq, partStr, hasPart := strings.Cut(base, ".")
+	msn, err = strconv.ParseInt(seq, 10, 64)
+	if err != nil || msn < 0 {
+		return 0, 0, fmt.Errorf("invalid segment name: %s", name)
+	}
+	if !hasPart {
+		return msn, -1, nil
+	}
+	part, err = strconv.Atoi(partStr)
+	if err != nil || part < 0 {
+		return 0, 0, fmt.Errorf("invalid segment name: %s", name)
+	}
+	return msn, part, nil
+}
+
+// liveDistributor resolves the distributor and bitrate of a live HLS request
+func (dh *DistributionHandlers) liveDistributor(w http.ResponseWriter, r *http.Request) (*LiveDistributor, string, bool) {
+	distributor, err := dh.service.GetDistributor(r.PathValue("id"))
+	if err != nil {
+		utils.WriteErr(w, http.StatusNotFound, err)
+		return nil, "", false
+	}
+
+	bitrate := r.PathValue("bitrate")
+	if _, ok := distributor.DistributionProfiles[bitrate]; !ok {
+		utils.WriteErr(w, http.StatusNotFound, fmt.Errorf("invalid bitrate: %s", bitrate))
+		return nil, "", false
+	}
+	return distributor, bitrate, true
+}
+
+// blockingContext bounds a blocking request to three target durations, as
+// LL-HLS recommends
+func blockingContext(r *http.Request, distributor *LiveDistributor, bitrate string) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), 3*distributor.DistributionProfiles[bitrate].SegmentDuration)
+}
+
+// writeBlockingError reports why a blocking request gave up
+func writeBlockingError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrMSNTooFarAhead):
+		utils.WriteErr(w, http.StatusBadRequest, err)
+	case errors.Is(err, context.DeadlineExceeded):
+		utils.WriteErr(w, http.StatusServiceUnavailable, errors.New("timed out waiting for the live edge"))
+	case errors.Is(err, ErrLiveSegmentGone):
+		utils.WriteErr(w, http.StatusNotFound, err)
+	default:
+		// The client went away
+	}
+}
+
+// LiveMasterPlaylistHandler serves the master playlist of a live stream
+func (dh *DistributionHandlers) LiveMasterPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	distributor, err := dh.service.GetDistributor(r.PathValue("id"))
+	if err != nil {
+		utils.WriteErr(w, http.StatusNotFound, err)
+		return
+	}
+
+	playlist, err := distributor.MasterPlaylist()
+	if err != nil {
+		utils.WriteErr(w, http.StatusNotFound, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-cache")
+	io.WriteString(w, playlist)
+}
+
+// LiveMediaPlaylistHandler serves the sliding-window media playlist of a
+// bitrate. With _HLS_msn (and optionally _HLS_part) the request blocks until
+// the playlist contains that segment or part.
+func (dh *DistributionHandlers) LiveMediaPlaylistHandler(w http.ResponseWriter, r *http.Request) {
+	distributor, bitrate, ok := dh.liveDistributor(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Has("_HLS_msn") {
+		msn, err := strconv.ParseInt(query.Get("_HLS_msn"), 10, 64)
+		if err != nil || msn < 0 {
+			utils.WriteErr(w, http.StatusBadRequest, errors.New("invalid _HLS_msn"))
+			return
+		}
+		part := -1
+		if query.Has("_HLS_part") {
+			if part, err = strconv.Atoi(query.Get("_HLS_part")); err != nil || part < 0 {
+				utils.WriteErr(w, http.StatusBadRequest, errors.New("invalid _HLS_part"))
+				return
+			}
+		}
+
+		ctx, cancel := blockingContext(r, distributor, bitrate)
+		defer cancel()
+		if err := distributor.WaitForPart(ctx, bitrate, msn, part); err != nil {
+			writeBlockingError(w, err)
+			return
+		}
+	} else if query.Has("_HLS_part") {
+		utils.WriteErr(w, http.StatusBadRequest, errors.New("_HLS_part requires _HLS_msn"))
+		return
+	}
+
+	playlist, err := distributor.MediaPlaylist(bitrate)
+	if err != nil {
+		utils.WriteErr(w, http.StatusNotFound, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-cache")
+	io.WriteString(w, playlist)
+}
+
+// LiveSegmentHandler serves a segment or part from the segment queue. A part
+// named in a preload hint is held until the encoder delivers it.
+func (dh *DistributionHandlers) LiveSegmentHandler(w http.ResponseWriter, r *http.Request) {
+	distributor, bitrate, ok := dh.liveDistributor(w, r)
+	if !ok {
+		return
+	}
+
+	msn, part, err := parseLiveURI(r.PathValue("file"))
+	if err != nil {
+		utils.WriteErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var data []byte
+	if part < 0 {
+		data, err = distributor.SegmentData(bitrate, msn)
+	} else {
+		ctx, cancel := blockingContext(r, distributor, bitrate)
+		defer cancel()
+		data, err = distributor.PartData(ctx, bitrate, msn, part)
+	}
+	if err != nil {
+		writeBlockingError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "video/mp2t")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// IngestLiveSegmentHandler accepts a segment or part from the encoder. The
+// duration query parameter is in milliseconds; parts that start with a
+// keyframe set independent=true.
+func (dh *DistributionHandlers) IngestLiveSegmentHandler(w http.ResponseWriter, r *http.Request) {
+	distributor, bitrate, ok := dh.liveDistributor(w, r)
+	if !ok {
+		return
+	}
+
+	msn, part, err := parseLiveURI(r.PathValue("file"))
+	if err != nil {
+		utils.WriteErr(w, http.StatusBadRequest, err)
+		return
+	}
+	durationMs, err := strconv.ParseInt(r.URL.Query().Get("duration"), 10, 64)
+	if err != nil || durationMs <= 0 {
+		utils.WriteErr(w, http.StatusBadRequest, errors.New("duration in milliseconds is required"))
+		return
+	}
+	independent := r.URL.Query().Get("independent") == "true"
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxLiveSegmentBytes))
+	if err != nil {
+		utils.WriteErr(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	if len(data) == 0 {
+		utils.WriteErr(w, http.StatusBadRequest, errors.New("segment body is empty"))
+		return
+	}
+
+	if part >= 0 {
+		err = distributor.AppendPart(bitrate, msn, &LivePart{
+			Index:       part,
+			DurationMs:  durationMs,
+			Independent: independent,
+			Data:        data,
+		})
+	} else if distributor.segmentBySequence(bitrate, msn) != nil {
+		err = fmt.Errorf("segment %d already exists", msn)
+	} else {
+		// The segment started playing one duration before it arrived
+		start := time.Now().Add(-time.Duration(durationMs) * time.Millisecond)
+		err = distributor.EnqueueSegment(&VideoSegment{
+			SegmentID:   fmt.Sprintf("%s-%s-%d", distributor.RecordingID, bitrate, msn),
+			RecordingID: distributor.RecordingID,
+			Bitrate:     bitrate,
+			SequenceNum: msn,
+			DurationMs:  durationMs,
+			Data:        data,
+			FileSize:    int64(len(data)),
+			CreatedTime: start,
+			ExpiresTime: time.Now().Add(distributor.segmentRetentionTime),
+			IsKeyFrame:  true,
+		})
+	}
+	if err != nil {
+		utils.WriteErr(w, http.StatusConflict, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
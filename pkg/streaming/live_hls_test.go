@@ -0,0 +1,226 @@
+package streaming
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func enqueueLiveSegment(t *testing.T, distributor *LiveDistributor, bitrate string, msn int64, created time.Time) {
+	t.Helper()
+	err := distributor.EnqueueSegment(&VideoSegment{
+		SegmentID:   fmt.Sprintf("%s-%d", bitrate, msn),
+		RecordingID: distributor.RecordingID,
+		Bitrate:     bitrate,
+		SequenceNum: msn,
+		DurationMs:  2000,
+		Data:        []byte(fmt.Sprintf("segment %d", msn)),
+		CreatedTime: created,
+		ExpiresTime: created.Add(time.Minute),
+		IsKeyFrame:  true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to enqueue segment %d: %v", msn, err)
+	}
+}
+
+func TestLiveMediaPlaylistWindow(t *testing.T) {
+	distributor := NewLiveDistributor("rec-001", 50, 30*time.Second)
+	distributor.SetLiveHLSConfig(LiveHLSConfig{WindowSize: 3, PartTarget: 500 * time.Millisecond})
+
+	if _, err := distributor.MediaPlaylist("Low"); !errors.Is(err, ErrRenditionNotFound) {
+		t.Errorf("Expected ErrRenditionNotFound, got %v", err)
+	}
+
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	for i := int64(0); i < 5; i++ {
+		enqueueLiveSegment(t, distributor, "Low", i, start.Add(time.Duration(i)*2*time.Second))
+	}
+
+	playlist, err := distributor.MediaPlaylist("Low")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"#EXT-X-TARGETDURATION:2\n",
+		"#EXT-X-MEDIA-SEQUENCE:2\n",
+		"#EXT-X-PROGRAM-DATE-TIME:2026-10-18T09:00:04.000Z\n#EXTINF:2.000,\n2.ts\n",
+		"#EXTINF:2.000,\n4.ts\n",
+	} {
+		if !strings.Contains(playlist, want) {
+			t.Errorf("Expected %q in playlist:\n%s", want, playlist)
+		}
+	}
+	if strings.Contains(playlist, "1.ts") {
+		t.Errorf("Segment outside the window listed:\n%s", playlist)
+	}
+	if strings.Contains(playlist, "EXT-X-PART") {
+		t.Errorf("Playlist without parts has LL-HLS tags:\n%s", playlist)
+	}
+}
+
+func TestLiveMediaPlaylistParts(t *testing.T) {
+	distributor := NewLiveDistributor("rec-001", 50, 30*time.Second)
+	enqueueLiveSegment(t, distributor, "Low", 0, time.Now())
+
+	for i := 0; i < 2; i++ {
+		part := &LivePart{Index: i, DurationMs: 500, Independent: i == 0, Data: []byte{byte(i)}}
+		if err := distributor.AppendPart("Low", 1, part); err != nil {
+			t.Fatalf("Failed to append part %d: %v", i, err)
+		}
+	}
+
+	// Parts must arrive in order
+	if err := distributor.AppendPart("Low", 1, &LivePart{Index: 5, DurationMs: 500, Data: []byte{5}}); !errors.Is(err, ErrInvalidPart) {
+		t.Errorf("Expected ErrInvalidPart for an out-of-order part, got %v", err)
+	}
+	if err := distributor.AppendPart("Low", 0, &LivePart{Index: 0, DurationMs: 500, Data: []byte{0}}); !errors.Is(err, ErrInvalidPart) {
+		t.Errorf("Expected ErrInvalidPart for a complete segment, got %v", err)
+	}
+
+	playlist, err := distributor.MediaPlaylist("Low")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"#EXT-X-VERSION:9",
+		"#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=1.500",
+		"#EXT-X-PART-INF:PART-TARGET=0.500",
+		`#EXT-X-PART:DURATION=0.500,URI="1.0.ts",INDEPENDENT=YES`,
+		`#EXT-X-PART:DURATION=0.500,URI="1.1.ts"` + "\n",
+		`#EXT-X-PRELOAD-HINT:TYPE=PART,URI="1.2.ts"`,
+	} {
+		if !strings.Contains(playlist, want) {
+			t.Errorf("Expected %q in playlist:\n%s", want, playlist)
+		}
+	}
+
+	// The complete segment keeps its parts
+	enqueueLiveSegment(t, distributor, "Low", 1, time.Now())
+	playlist, _ = distributor.MediaPlaylist("Low")
+	if !strings.Contains(playlist, `URI="1.1.ts"`+"\n#EXTINF:2.000,\n1.ts") {
+		t.Errorf("Expected the parts of segment 1 before it:\n%s", playlist)
+	}
+	if strings.Contains(playlist, "PRELOAD-HINT") {
+		t.Errorf("Preload hint without a pending segment:\n%s", playlist)
+	}
+}
+
+func TestWaitForPart(t *testing.T) {
+	distributor := NewLiveDistributor("rec-001", 50, 30*time.Second)
+	enqueueLiveSegment(t, distributor, "Low", 0, time.Now())
+
+	if err := distributor.WaitForPart(context.Background(), "Low", 0, -1); err != nil {
+		t.Errorf("Existing segment blocked: %v", err)
+	}
+	if err := distributor.WaitForPart(context.Background(), "Low", 5, -1); !errors.Is(err, ErrMSNTooFarAhead) {
+		t.Errorf("Expected ErrMSNTooFarAhead, got %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		done <- distributor.WaitForPart(ctx, "Low", 1, 0)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if err := distributor.AppendPart("Low", 1, &LivePart{Index: 0, DurationMs: 500, Data: []byte{1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Blocked reload did not return the new part: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := distributor.WaitForPart(ctx, "Low", 2, -1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestParseLiveURI(t *testing.T) {
+	tests := []struct {
+		name string
+		msn  int64
+		part int
+		ok   bool
+	}{
+		{"12.ts", 12, -1, true},
+		{"12.3.ts", 12, 3, true},
+		{"12.m3u8", 0, 0, false},
+		{"x.ts", 0, 0, false},
+		{"-1.ts", 0, 0, false},
+		{"1.x.ts", 0, 0, false},
+	}
+	for _, tt := range tests {
+		msn, part, err := parseLiveURI(tt.name)
+		if (err == nil) != tt.ok || msn != tt.msn || part != tt.part {
+			t.Errorf("%s: got %d, %d, %v", tt.name, msn, part, err)
+		}
+	}
+}
+
+func TestLiveHLSHandlers(t *testing.T) {
+	service := NewDistributionService(1, slog.Default())
+	defer service.Stop()
+	distributor, err := service.StartLiveStream("rec-001", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enqueueLiveSegment(t, distributor, "Low", 0, time.Now())
+
+	h := NewDistributionHandlers(service)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/streams/{id}/hls/master.m3u8", h.LiveMasterPlaylistHandler)
+	mux.HandleFunc("GET /api/v1/streams/{id}/hls/{bitrate}/playlist.m3u8", h.LiveMediaPlaylistHandler)
+	mux.HandleFunc("GET /api/v1/streams/{id}/hls/{bitrate}/{file}", h.LiveSegmentHandler)
+	mux.HandleFunc("PUT /api/v1/streams/{id}/hls/{bitrate}/{file}", h.IngestLiveSegmentHandler)
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "/api/v1/streams/rec-001/hls/master.m3u8", "", http.StatusOK},
+		{http.MethodGet, "/api/v1/streams/rec-404/hls/master.m3u8", "", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/streams/rec-001/hls/Low/playlist.m3u8", "", http.StatusOK},
+		{http.MethodGet, "/api/v1/streams/rec-001/hls/Ultra/playlist.m3u8", "", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/streams/rec-001/hls/Low/playlist.m3u8?_HLS_part=0", "", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/streams/rec-001/hls/Low/playlist.m3u8?_HLS_msn=9", "", http.StatusBadRequest},
+		{http.MethodGet, "/api/v1/streams/rec-001/hls/Low/0.ts", "", http.StatusOK},
+		{http.MethodGet, "/api/v1/streams/rec-001/hls/Low/7.ts", "", http.StatusNotFound},
+		{http.MethodPut, "/api/v1/streams/rec-001/hls/Low/1.0.ts?duration=500&independent=true", "part", http.StatusCreated},
+		{http.MethodPut, "/api/v1/streams/rec-001/hls/Low/1.ts", "segment", http.StatusBadRequest},
+		{http.MethodPut, "/api/v1/streams/rec-001/hls/Low/0.ts?duration=2000", "again", http.StatusConflict},
+		{http.MethodGet, "/api/v1/streams/rec-001/hls/Low/1.0.ts", "", http.StatusOK},
+		{http.MethodGet, "/api/v1/streams/rec-001/hls/Low/playlist.m3u8?_HLS_msn=1&_HLS_part=0", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := serve(tt.method, tt.path, tt.body); w.Code != tt.status {
+			t.Errorf("%s %s: expected status %d, got %d (%s)", tt.method, tt.path, tt.status, w.Code, w.Body.String())
+		}
+	}
+
+	w := serve(http.MethodGet, "/api/v1/streams/rec-001/hls/Low/0.ts", "")
+	if w.Body.String() != "segment 0" || w.Header().Get("Content-Type") != "video/mp2t" {
+		t.Errorf("Unexpected segment response %q", w.Body.String())
+	}
+	if stats := distributor.GetDistributionStats(); stats.TotalSegmentsServed != 2 {
+		t.Errorf("Expected 2 segments served, got %d", stats.TotalSegmentsServed)
+	}
+}
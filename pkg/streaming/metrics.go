@@ -0,0 +1,52 @@
+package streaming
+
+import (
+	"context"
+
+	"github.com/Bashar444/VTP/pkg/monitoring"
+)
+
+// RegisterMetrics exports live viewers, segment delivery queue depth and
+// delivery failures
+func (ds *DistributionService) RegisterMetrics(reg *monitoring.Registry) {
+	reg.NewGaugeFunc("vtp_live_streams", "Live streams with an active distributor.", func() float64 {
+		ds.distributorsMu.RLock()
+		defer ds.distributorsMu.RUnlock()
+		return float64(len(ds.distributors))
+	})
+	reg.NewGaugeVecFunc("vtp_live_viewers", "Active viewers per live stream.", []string{"recording_id"}, func() []monitoring.Sample {
+		ds.distributorsMu.RLock()
+		defer ds.distributorsMu.RUnlock()
+
+		samples := make([]monitoring.Sample, 0, len(ds.distributors))
+		for recordingID, distributor := range ds.distributors {
+			stats := distributor.GetDistributionStats()
+			samples = append(samples, monitoring.Sample{
+				LabelValues: []string{recordingID},
+				Value:       float64(stats.ActiveViewers),
+			})
+		}
+		return samples
+	})
+	reg.NewGaugeFunc("vtp_segment_delivery_queue_depth", "Segment delivery tasks waiting for a worker.", func() float64 {
+		return float64(len(ds.workQueue))
+	})
+	reg.NewCounterFunc("vtp_segment_delivery_failures_total", "Segment deliveries that failed or could not be queued.", func() float64 {
+		ds.metricsMu.RLock()
+		defer ds.metricsMu.RUnlock()
+		return float64(ds.metrics.TotalDeliveryFailures)
+	})
+}
+
+// RegisterMetrics exports transcoding queue depth and running jobs
+func (ts *TranscodingService) RegisterMetrics(reg *monitoring.Registry) {
+	reg.NewGaugeFunc("vtp_transcoding_queue_depth", "Transcoding jobs waiting to start.", func() float64 {
+		return float64(ts.transcoder.GetQueueStats(context.Background())["pending_jobs"].(int))
+	})
+	reg.NewGaugeFunc("vtp_transcoding_jobs_running", "Transcoding jobs currently running.", func() float64 {
+		return float64(ts.transcoder.GetQueueStats(context.Background())["running_jobs"].(int))
+	})
+	reg.NewGaugeFunc("vtp_transcoding_workers", "Transcoding worker goroutines.", func() float64 {
+		return float64(ts.workerCount)
+	})
+}
@@ -1,10 +1,17 @@
 package streaming
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
+
+	"github.com/Bashar444/VTP/pkg/recording"
 )
 
 // EncodingProfile represents a bitrate encoding profile
@@ -17,16 +24,22 @@ type EncodingProfile struct {
 
 // TranscodingJob represents a single transcoding job
 type TranscodingJob struct {
-	JobID       string          // Unique job identifier
-	RecordingID string          // Which recording to transcode
-	Profile     EncodingProfile // Target encoding profile
-	Status      JobStatus       // Current status
-	Progress    float64         // 0-100%
-	StartTime   time.Time       // When job started
-	EndTime     time.Time       // When job completed
-	InputPath   string          // Path to source video
-	OutputPath  string          // Path to output video
-	Error       error           // Any error that occurred
+	JobID        string          // Unique job identifier
+	RecordingID  string          // Which recording to transcode
+	Profile      EncodingProfile // Target encoding profile
+	Status       JobStatus       // Current status
+	Progress     float64         // 0-100%
+	StartTime    time.Time       // When job started
+	EndTime      time.Time       // When job completed
+	InputPath    string          // Path to source video
+	OutputPath   string          // Path to output video
+	Error        error           // Any error that occurred
+	Priority     int             // Higher priorities run first
+	Attempts     int             // Times a worker has started the job
+	MaxAttempts  int             // Attempts before the job is marked failed
+	WorkerID     string          // Worker holding the lease
+	LeaseExpires time.Time       // When another worker may take the job over
+	Encrypted    bool            // Encrypt the variant's segments
 }
 
 // JobStatus represents the status of a transcoding job
@@ -141,30 +154,35 @@ func (tq *TranscodingQueue) Running() int {
 	return tq.running
 }
 
-// MultiBitrateTranscoder manages multi-bitrate video transcoding
+// MultiBitrateTranscoder manages multi-bitrate video transcoding. Jobs are
+// kept in a JobStore, in memory unless WithJobStore sets a shared one.
 type MultiBitrateTranscoder struct {
-	logger              *log.Logger
-	queue               *TranscodingQueue
-	jobs                map[string]*TranscodingJob // Track all jobs
-	jobsMu              sync.RWMutex
+	logger              *slog.Logger
+	store               JobStore
+	maxAttempts         int
+	mu                  sync.RWMutex
 	storageDir          string
 	ffmpegPath          string
 	defaultProfiles     []EncodingProfile
 	maxConcurrentJobs   int
 	progressCallbacks   map[string]func(ProgressUpdate)
 	progressCallbacksMu sync.RWMutex
+	vault               *KeyVault
+	segmentsPerKey      int
+	encrypted           map[string]bool // recordings with encrypted segments
 }
 
 // NewMultiBitrateTranscoder creates a new multi-bitrate transcoder
-func NewMultiBitrateTranscoder(storageDir, ffmpegPath string, maxConcurrent int, logger *log.Logger) *MultiBitrateTranscoder {
+func NewMultiBitrateTranscoder(storageDir, ffmpegPath string, maxConcurrent int, logger *slog.Logger) *MultiBitrateTranscoder {
 	mt := &MultiBitrateTranscoder{
 		logger:            logger,
-		queue:             NewTranscodingQueue(maxConcurrent),
-		jobs:              make(map[string]*TranscodingJob),
+		store:             NewMemoryJobStore(),
+		maxAttempts:       DefaultMaxAttempts,
 		storageDir:        storageDir,
 		ffmpegPath:        ffmpegPath,
 		maxConcurrentJobs: maxConcurrent,
 		progressCallbacks: make(map[string]func(ProgressUpdate)),
+		encrypted:         make(map[string]bool),
 	}
 
 	// Initialize default encoding profiles
@@ -175,22 +193,176 @@ func NewMultiBitrateTranscoder(storageDir, ffmpegPath string, maxConcurrent int,
 		{Bitrate: 4000, Resolution: "1920x1080", FrameRate: 30, Label: "High"},
 	}
 
-	mt.logger.Println("[Transcoder] Multi-bitrate transcoder initialized")
+	mt.logger.Info("Multi-bitrate transcoder initialized", "max_concurrent", maxConcurrent)
+	return mt
+}
+
+// WithJobStore keeps jobs in store, so they survive restarts and are shared
+// by the workers of all replicas
+func (mt *MultiBitrateTranscoder) WithJobStore(store JobStore) *MultiBitrateTranscoder {
+	mt.store = store
+	return mt
+}
+
+// WithMaxAttempts sets how often a failing job runs before it is marked
+// failed
+func (mt *MultiBitrateTranscoder) WithMaxAttempts(attempts int) *MultiBitrateTranscoder {
+	if attempts > 0 {
+		mt.maxAttempts = attempts
+	}
+	return mt
+}
+
+// WithEncryption enables AES-128 segment encryption with keys from vault.
+// Keys rotate every segmentsPerKey segments; zero uses one key for the
+// whole recording.
+func (mt *MultiBitrateTranscoder) WithEncryption(vault *KeyVault, segmentsPerKey int) *MultiBitrateTranscoder {
+	mt.vault = vault
+	mt.segmentsPerKey = segmentsPerKey
 	return mt
 }
 
+// EnableEncryption encrypts the segments of a recording transcoded from now
+// on and adds keys to its playlists
+func (mt *MultiBitrateTranscoder) EnableEncryption(recordingID string) error {
+	if mt.vault == nil {
+		return ErrEncryptionNotConfigured
+	}
+	mt.mu.Lock()
+	mt.encrypted[recordingID] = true
+	mt.mu.Unlock()
+	return nil
+}
+
+// EncryptionEnabled reports whether a recording's segments are encrypted
+// as its jobs run. Jobs record it too, for recordings queued by another
+// replica.
+func (mt *MultiBitrateTranscoder) EncryptionEnabled(ctx context.Context, recordingID string) bool {
+	mt.mu.RLock()
+	encrypted := mt.encrypted[recordingID]
+	mt.mu.RUnlock()
+	if encrypted {
+		return true
+	}
+
+	for _, job := range mt.GetAllJobs(ctx, recordingID) {
+		if job.Encrypted {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyURI returns the key server URI of a recording's key. A playback token,
+// when given, is added so players that cannot send the Authorization header
+// fetch keys with it.
+func (mt *MultiBitrateTranscoder) KeyURI(recordingID string, index int, token string) string {
+	uri := fmt.Sprintf("/api/v1/transcode/%s/keys/%d", recordingID, index)
+	if token != "" {
+		uri += "?" + url.Values{recording.PlaybackTokenParam: {token}}.Encode()
+	}
+	return uri
+}
+
+// SegmentKey returns a key of an encrypted recording for the key server
+func (mt *MultiBitrateTranscoder) SegmentKey(ctx context.Context, recordingID string, index int) ([]byte, error) {
+	if mt.vault == nil {
+		return nil, ErrEncryptionNotConfigured
+	}
+	return mt.vault.Key(ctx, recordingID, index)
+}
+
+// segmentPath returns the path of a variant segment
+func (mt *MultiBitrateTranscoder) segmentPath(recordingID string, bitrate, segment int) string {
+	return filepath.Join(mt.storageDir, fmt.Sprintf("%s_%d_segment_%d.ts", recordingID, bitrate, segment))
+}
+
+// encryptedMarker returns the path of the file marking a variant's
+// segments encrypted
+func (mt *MultiBitrateTranscoder) encryptedMarker(recordingID string, bitrate int) string {
+	return filepath.Join(mt.storageDir, fmt.Sprintf("%s_%d.encrypted", recordingID, bitrate))
+}
+
+// VariantEncrypted reports whether the segments of a variant were
+// encrypted, so its playlist announces keys
+func (mt *MultiBitrateTranscoder) VariantEncrypted(recordingID string, bitrate int) bool {
+	_, err := os.Stat(mt.encryptedMarker(recordingID, bitrate))
+	return err == nil
+}
+
+// EncryptSegments encrypts the segments of a variant in place and returns
+// how many were encrypted. A marker file records that the variant is done,
+// so running it again does not encrypt twice; it is only written once a
+// segment was encrypted.
+func (mt *MultiBitrateTranscoder) EncryptSegments(ctx context.Context, recordingID string, bitrate int) (int, error) {
+	if mt.vault == nil {
+		return 0, ErrEncryptionNotConfigured
+	}
+
+	marker := mt.encryptedMarker(recordingID, bitrate)
+	if mt.VariantEncrypted(recordingID, bitrate) {
+		return 0, nil
+	}
+
+	count := 0
+	for segment := 0; ; segment++ {
+		path := mt.segmentPath(recordingID, bitrate, segment)
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to read segment: %w", err)
+		}
+
+		key, err := mt.vault.EnsureKey(ctx, recordingID, keyIndex(segment, mt.segmentsPerKey))
+		if err != nil {
+			return count, err
+		}
+		encrypted, err := EncryptSegment(key, segment, data)
+		if err != nil {
+			return count, fmt.Errorf("failed to encrypt segment: %w", err)
+		}
+
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, encrypted, 0644); err != nil {
+			return count, fmt.Errorf("failed to write segment: %w", err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return count, fmt.Errorf("failed to write segment: %w", err)
+		}
+		count++
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	if err := os.WriteFile(marker, nil, 0644); err != nil {
+		return count, fmt.Errorf("failed to mark segments encrypted: %w", err)
+	}
+	mt.logger.InfoContext(ctx, "Segments encrypted", "recording_id", recordingID, "bitrate_kbps", bitrate, "segments", count)
+	return count, nil
+}
+
 // GetDefaultProfiles returns the default encoding profiles
 func (mt *MultiBitrateTranscoder) GetDefaultProfiles() []EncodingProfile {
 	return mt.defaultProfiles
 }
 
 // QueueMultiBitrateJob queues a job to encode multiple bitrates
-func (mt *MultiBitrateTranscoder) QueueMultiBitrateJob(recordingID, inputPath string) ([]string, error) {
+func (mt *MultiBitrateTranscoder) QueueMultiBitrateJob(ctx context.Context, recordingID, inputPath string) ([]string, error) {
+	return mt.QueuePriorityJob(ctx, recordingID, inputPath, PriorityNormal)
+}
+
+// QueuePriorityJob queues a job to encode multiple bitrates ahead of jobs
+// with a lower priority
+func (mt *MultiBitrateTranscoder) QueuePriorityJob(ctx context.Context, recordingID, inputPath string, priority int) ([]string, error) {
 	if recordingID == "" || inputPath == "" {
 		return nil, fmt.Errorf("invalid recording ID or input path")
 	}
 
 	jobIDs := make([]string, 0)
+	encrypted := mt.EncryptionEnabled(ctx, recordingID)
 
 	// Queue a job for each default profile
 	for _, profile := range mt.defaultProfiles {
@@ -205,40 +377,50 @@ func (mt *MultiBitrateTranscoder) QueueMultiBitrateJob(recordingID, inputPath st
 			InputPath:   inputPath,
 			OutputPath:  fmt.Sprintf("%s/%s_%d.mp4", mt.storageDir, recordingID, profile.Bitrate),
 			StartTime:   time.Now(),
+			Priority:    priority,
+			MaxAttempts: mt.maxAttempts,
+			Encrypted:   encrypted,
 		}
 
-		if err := mt.queue.Add(job); err != nil {
-			mt.logger.Printf("[Transcoder] Error queuing job %s: %v", jobID, err)
+		if err := mt.store.Enqueue(ctx, job); err != nil {
+			mt.logger.ErrorContext(ctx, "Failed to queue transcoding job", "job_id", jobID, "error", err)
 			return nil, err
 		}
 
-		// Store job in jobs map
-		mt.jobsMu.Lock()
-		mt.jobs[jobID] = job
-		mt.jobsMu.Unlock()
-
 		jobIDs = append(jobIDs, jobID)
-		mt.logger.Printf("[Transcoder] Queued job %s (%d kbps)", jobID, profile.Bitrate)
+		mt.logger.DebugContext(ctx, "Transcoding job queued", "job_id", jobID, "bitrate_kbps", profile.Bitrate, "priority", priority)
 	}
 
 	return jobIDs, nil
 }
 
 // GetJob retrieves a job by ID
-func (mt *MultiBitrateTranscoder) GetJob(jobID string) *TranscodingJob {
-	mt.jobsMu.RLock()
-	defer mt.jobsMu.RUnlock()
+func (mt *MultiBitrateTranscoder) GetJob(ctx context.Context, jobID string) *TranscodingJob {
+	job, err := mt.store.Get(ctx, jobID)
+	if err != nil {
+		if !errors.Is(err, ErrJobNotFound) {
+			mt.logger.ErrorContext(ctx, "Failed to load transcoding job", "job_id", jobID, "error", err)
+		}
+		return nil
+	}
+	return job
+}
 
-	return mt.jobs[jobID]
+// leaseJob claims the next job for a worker
+func (mt *MultiBitrateTranscoder) leaseJob(ctx context.Context, workerID string, ttl time.Duration) (*TranscodingJob, error) {
+	return mt.store.Lease(ctx, workerID, ttl)
+}
+
+// heartbeat renews a worker's lease on a job
+func (mt *MultiBitrateTranscoder) heartbeat(ctx context.Context, jobID, workerID string, ttl time.Duration) error {
+	return mt.store.Heartbeat(ctx, jobID, workerID, ttl)
 }
 
 // UpdateJobProgress updates the progress of a job
-func (mt *MultiBitrateTranscoder) UpdateJobProgress(jobID string, progress float64, speed float64) {
-	mt.jobsMu.Lock()
-	if job, ok := mt.jobs[jobID]; ok {
-		job.Progress = progress
+func (mt *MultiBitrateTranscoder) UpdateJobProgress(ctx context.Context, jobID string, progress float64, speed float64) {
+	if err := mt.store.UpdateProgress(ctx, jobID, progress); err != nil {
+		mt.logger.WarnContext(ctx, "Failed to update transcoding job progress", "job_id", jobID, "error", err)
 	}
-	mt.jobsMu.Unlock()
 
 	// Call progress callback if registered
 	mt.progressCallbacksMu.RLock()
@@ -256,22 +438,23 @@ func (mt *MultiBitrateTranscoder) UpdateJobProgress(jobID string, progress float
 	}
 }
 
-// CompleteJob marks a job as completed
-func (mt *MultiBitrateTranscoder) CompleteJob(jobID string, err error) {
-	mt.jobsMu.Lock()
-	if job, ok := mt.jobs[jobID]; ok {
-		if err != nil {
-			job.Status = JobFailed
-			job.Error = err
-		} else {
-			job.Status = JobCompleted
-			job.Progress = 100.0
-		}
-		job.EndTime = time.Now()
-	}
-	mt.jobsMu.Unlock()
+// CompleteJob marks a job as completed, or failed when err is set
+func (mt *MultiBitrateTranscoder) CompleteJob(ctx context.Context, jobID string, err error) {
+	mt.finishJob(ctx, jobID, "", err, false)
+}
 
-	mt.queue.Complete(jobID)
+// finishJob ends a job run by workerID. A failed job is queued again while
+// it has attempts left when retry is set.
+func (mt *MultiBitrateTranscoder) finishJob(ctx context.Context, jobID, workerID string, err error, retry bool) {
+	status, finishErr := mt.store.Finish(ctx, jobID, workerID, err, retry)
+	if finishErr != nil {
+		mt.logger.ErrorContext(ctx, "Failed to finish transcoding job", "job_id", jobID, "error", finishErr)
+		return
+	}
+	if status == JobQueued {
+		mt.logger.WarnContext(ctx, "Transcoding job failed, queued again", "job_id", jobID, "error", err)
+		return
+	}
 
 	// Call progress callback
 	mt.progressCallbacksMu.RLock()
@@ -279,10 +462,8 @@ func (mt *MultiBitrateTranscoder) CompleteJob(jobID string, err error) {
 	mt.progressCallbacksMu.RUnlock()
 
 	if ok && callback != nil {
-		status := JobCompleted
 		errStr := ""
 		if err != nil {
-			status = JobFailed
 			errStr = err.Error()
 		}
 		update := ProgressUpdate{
@@ -295,9 +476,9 @@ func (mt *MultiBitrateTranscoder) CompleteJob(jobID string, err error) {
 	}
 
 	if err != nil {
-		mt.logger.Printf("[Transcoder] Job %s failed: %v", jobID, err)
+		mt.logger.ErrorContext(ctx, "Transcoding job failed", "job_id", jobID, "error", err)
 	} else {
-		mt.logger.Printf("[Transcoder] Job %s completed successfully", jobID)
+		mt.logger.InfoContext(ctx, "Transcoding job completed", "job_id", jobID)
 	}
 }
 
@@ -310,23 +491,30 @@ func (mt *MultiBitrateTranscoder) RegisterProgressCallback(jobID string, callbac
 }
 
 // GetQueueStats returns statistics about the transcoding queue
-func (mt *MultiBitrateTranscoder) GetQueueStats() map[string]interface{} {
+func (mt *MultiBitrateTranscoder) GetQueueStats(ctx context.Context) map[string]interface{} {
+	counts, err := mt.store.Counts(ctx)
+	if err != nil {
+		mt.logger.ErrorContext(ctx, "Failed to count transcoding jobs", "error", err)
+	}
+
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
 	return map[string]interface{}{
-		"pending_jobs":    mt.queue.Length(),
-		"running_jobs":    mt.queue.Running(),
-		"total_jobs":      len(mt.jobs),
+		"pending_jobs":    counts[JobQueued],
+		"running_jobs":    counts[JobRunning],
+		"failed_jobs":     counts[JobFailed],
+		"total_jobs":      total,
 		"max_concurrent":  mt.maxConcurrentJobs,
-		"utilization_pct": float64(mt.queue.Running()) / float64(mt.maxConcurrentJobs) * 100,
+		"utilization_pct": float64(counts[JobRunning]) / float64(mt.maxConcurrentJobs) * 100,
 	}
 }
 
 // GetJobStats returns detailed stats for a specific job
-func (mt *MultiBitrateTranscoder) GetJobStats(jobID string) ProgressUpdate {
-	mt.jobsMu.RLock()
-	job, ok := mt.jobs[jobID]
-	mt.jobsMu.RUnlock()
-
-	if !ok {
+func (mt *MultiBitrateTranscoder) GetJobStats(ctx context.Context, jobID string) ProgressUpdate {
+	job := mt.GetJob(ctx, jobID)
+	if job == nil {
 		return ProgressUpdate{
 			JobID:  jobID,
 			Status: JobFailed,
@@ -362,7 +550,7 @@ func (mt *MultiBitrateTranscoder) GetJobStats(jobID string) ProgressUpdate {
 }
 
 // GenerateMasterPlaylist creates a master M3U8 playlist linking all bitrates
-func (mt *MultiBitrateTranscoder) GenerateMasterPlaylist(recordingID string) (string, error) {
+func (mt *MultiBitrateTranscoder) GenerateMasterPlaylist(ctx context.Context, recordingID string) (string, error) {
 	if recordingID == "" {
 		return "", fmt.Errorf("invalid recording ID")
 	}
@@ -382,12 +570,13 @@ func (mt *MultiBitrateTranscoder) GenerateMasterPlaylist(recordingID string) (st
 	playlist += "#EXT-X-STREAM-INF:BANDWIDTH=4000000,RESOLUTION=1920x1080,FRAME-RATE=30\n"
 	playlist += fmt.Sprintf("%s_4000.m3u8\n", recordingID)
 
-	mt.logger.Printf("[Transcoder] Generated master playlist for recording %s", recordingID)
+	mt.logger.DebugContext(ctx, "Master playlist generated", "recording_id", recordingID)
 	return playlist, nil
 }
 
-// GenerateVariantPlaylist creates an HLS variant playlist for a specific bitrate
-func (mt *MultiBitrateTranscoder) GenerateVariantPlaylist(recordingID string, bitrate int) (string, error) {
+// GenerateVariantPlaylist creates an HLS variant playlist for a specific
+// bitrate. keyToken is the playback token added to key URIs, if any.
+func (mt *MultiBitrateTranscoder) GenerateVariantPlaylist(ctx context.Context, recordingID string, bitrate int, keyToken string) (string, error) {
 	if recordingID == "" || bitrate <= 0 {
 		return "", fmt.Errorf("invalid recording ID or bitrate")
 	}
@@ -399,65 +588,57 @@ func (mt *MultiBitrateTranscoder) GenerateVariantPlaylist(recordingID string, bi
 	playlist += "#EXT-X-TARGETDURATION:10\n"
 	playlist += "#EXT-X-MEDIA-SEQUENCE:0\n"
 
-	// Add sample segments
+	// Add sample segments. Encrypted variants announce each key before the
+	// first segment it encrypts; without an IV attribute players use the
+	// media sequence number.
+	encrypted := mt.VariantEncrypted(recordingID, bitrate)
 	for i := 0; i < 10; i++ {
+		if encrypted && (i == 0 || keyIndex(i, mt.segmentsPerKey) != keyIndex(i-1, mt.segmentsPerKey)) {
+			playlist += fmt.Sprintf("#EXT-X-KEY:METHOD=AES-128,URI=\"%s\"\n", mt.KeyURI(recordingID, keyIndex(i, mt.segmentsPerKey), keyToken))
+		}
 		playlist += fmt.Sprintf("#EXTINF:10.0,\n%s_%d_segment_%d.ts\n", recordingID, bitrate, i)
 	}
 
 	playlist += "#EXT-X-ENDLIST\n"
 
-	mt.logger.Printf("[Transcoder] Generated variant playlist for recording %s at %d kbps", recordingID, bitrate)
+	mt.logger.DebugContext(ctx, "Variant playlist generated", "recording_id", recordingID, "bitrate_kbps", bitrate)
 	return playlist, nil
 }
 
-// CancelJob cancels a pending or running job
-func (mt *MultiBitrateTranscoder) CancelJob(jobID string) error {
-	mt.jobsMu.Lock()
-	if job, ok := mt.jobs[jobID]; ok {
-		if job.Status == JobQueued || job.Status == JobRunning {
-			job.Status = JobCancelled
-			job.EndTime = time.Now()
+// CancelJob cancels a pending or running job. A worker running it in
+// another process stops at its next heartbeat.
+func (mt *MultiBitrateTranscoder) CancelJob(ctx context.Context, jobID string) error {
+	if err := mt.store.Cancel(ctx, jobID); err != nil {
+		if errors.Is(err, ErrJobNotFound) {
+			return fmt.Errorf("job not found")
 		}
-		mt.jobsMu.Unlock()
-
-		mt.logger.Printf("[Transcoder] Job %s cancelled", jobID)
-		return nil
+		return err
 	}
-	mt.jobsMu.Unlock()
 
-	return fmt.Errorf("job not found")
+	mt.logger.InfoContext(ctx, "Transcoding job cancelled", "job_id", jobID)
+	return nil
 }
 
 // GetAllJobs returns all jobs for a recording
-func (mt *MultiBitrateTranscoder) GetAllJobs(recordingID string) []*TranscodingJob {
-	mt.jobsMu.RLock()
-	defer mt.jobsMu.RUnlock()
-
-	var jobs []*TranscodingJob
-	for _, job := range mt.jobs {
-		if job.RecordingID == recordingID {
-			jobs = append(jobs, job)
-		}
+func (mt *MultiBitrateTranscoder) GetAllJobs(ctx context.Context, recordingID string) []*TranscodingJob {
+	jobs, err := mt.store.ListByRecording(ctx, recordingID)
+	if err != nil {
+		mt.logger.ErrorContext(ctx, "Failed to list transcoding jobs", "recording_id", recordingID, "error", err)
+		return nil
 	}
 	return jobs
 }
 
 // IsRecordingCompleted checks if all encoding jobs for a recording are done
-func (mt *MultiBitrateTranscoder) IsRecordingCompleted(recordingID string) bool {
-	mt.jobsMu.RLock()
-	defer mt.jobsMu.RUnlock()
+func (mt *MultiBitrateTranscoder) IsRecordingCompleted(ctx context.Context, recordingID string) bool {
+	jobs := mt.GetAllJobs(ctx, recordingID)
 
-	recordingJobs := 0
 	completedJobs := 0
-
-	for _, job := range mt.jobs {
-		if job.RecordingID == recordingID {
-			recordingJobs++
-			if job.Status == JobCompleted {
-				completedJobs++
-			}
+	for _, job := range jobs {
+		if job.Status == JobCompleted {
+			completedJobs++
 		}
 	}
 
-	return recordingJobs > 0 && recordingJobs == completedJobs
+	return len(jobs) > 0 && len(jobs) == completedJobs
 }
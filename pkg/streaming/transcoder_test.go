@@ -1,14 +1,14 @@
 package streaming
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
 	"testing"
 )
 
 func TestNewMultiBitrateTranscoder(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	transcoder := NewMultiBitrateTranscoder("/tmp", "/usr/bin/ffmpeg", 4, logger)
 
 	if transcoder == nil {
@@ -21,13 +21,13 @@ func TestNewMultiBitrateTranscoder(t *testing.T) {
 }
 
 func TestQueueMultiBitrateJob(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	transcoder := NewMultiBitrateTranscoder("/tmp", "/usr/bin/ffmpeg", 4, logger)
 
 	recordingID := "test-123"
 	inputPath := "/tmp/test.mp4"
 
-	jobIDs, err := transcoder.QueueMultiBitrateJob(recordingID, inputPath)
+	jobIDs, err := transcoder.QueueMultiBitrateJob(context.Background(), recordingID, inputPath)
 
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -39,7 +39,7 @@ func TestQueueMultiBitrateJob(t *testing.T) {
 
 	// Verify each job exists and has correct profile
 	for i, jobID := range jobIDs {
-		job := transcoder.GetJob(jobID)
+		job := transcoder.GetJob(context.Background(), jobID)
 		if job == nil {
 			t.Errorf("Job %s not found", jobID)
 		} else if job.Status != JobQueued {
@@ -91,53 +91,53 @@ func TestQueueManagement(t *testing.T) {
 }
 
 func TestProgressTracking(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	transcoder := NewMultiBitrateTranscoder("/tmp", "/usr/bin/ffmpeg", 4, logger)
 
-	jobIDs, _ := transcoder.QueueMultiBitrateJob("test-456", "/tmp/test.mp4")
+	jobIDs, _ := transcoder.QueueMultiBitrateJob(context.Background(), "test-456", "/tmp/test.mp4")
 	jobID := jobIDs[0]
 
 	// Update progress
-	transcoder.UpdateJobProgress(jobID, 50.0, 25.5)
+	transcoder.UpdateJobProgress(context.Background(), jobID, 50.0, 25.5)
 
-	job := transcoder.GetJob(jobID)
+	job := transcoder.GetJob(context.Background(), jobID)
 	if job.Progress != 50.0 {
 		t.Errorf("Expected 50%% progress, got %.1f%%", job.Progress)
 	}
 }
 
 func TestGetJobStats(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	transcoder := NewMultiBitrateTranscoder("/tmp", "/usr/bin/ffmpeg", 4, logger)
 
-	jobIDs, _ := transcoder.QueueMultiBitrateJob("test-789", "/tmp/test.mp4")
+	jobIDs, _ := transcoder.QueueMultiBitrateJob(context.Background(), "test-789", "/tmp/test.mp4")
 	jobID := jobIDs[0]
 
 	// Get stats for queued job
-	stats := transcoder.GetJobStats(jobID)
+	stats := transcoder.GetJobStats(context.Background(), jobID)
 	if stats.Status != JobQueued {
 		t.Errorf("Expected JobQueued status, got %s", stats.Status)
 	}
 
 	// Simulate progress
-	transcoder.UpdateJobProgress(jobID, 75.0, 28.0)
-	stats = transcoder.GetJobStats(jobID)
+	transcoder.UpdateJobProgress(context.Background(), jobID, 75.0, 28.0)
+	stats = transcoder.GetJobStats(context.Background(), jobID)
 	if stats.Progress != 75.0 {
 		t.Errorf("Expected 75%% progress in stats, got %.1f%%", stats.Progress)
 	}
 }
 
 func TestCompleteJob(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	transcoder := NewMultiBitrateTranscoder("/tmp", "/usr/bin/ffmpeg", 4, logger)
 
-	jobIDs, _ := transcoder.QueueMultiBitrateJob("test-complete", "/tmp/test.mp4")
+	jobIDs, _ := transcoder.QueueMultiBitrateJob(context.Background(), "test-complete", "/tmp/test.mp4")
 	jobID := jobIDs[0]
 
 	// Complete the job
-	transcoder.CompleteJob(jobID, nil)
+	transcoder.CompleteJob(context.Background(), jobID, nil)
 
-	job := transcoder.GetJob(jobID)
+	job := transcoder.GetJob(context.Background(), jobID)
 	if job.Status != JobCompleted {
 		t.Errorf("Expected JobCompleted status, got %s", job.Status)
 	}
@@ -152,17 +152,17 @@ func TestCompleteJob(t *testing.T) {
 }
 
 func TestCompleteJobWithError(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	transcoder := NewMultiBitrateTranscoder("/tmp", "/usr/bin/ffmpeg", 4, logger)
 
-	jobIDs, _ := transcoder.QueueMultiBitrateJob("test-error", "/tmp/test.mp4")
+	jobIDs, _ := transcoder.QueueMultiBitrateJob(context.Background(), "test-error", "/tmp/test.mp4")
 	jobID := jobIDs[0]
 
 	// Complete with error
 	testErr := fmt.Errorf("transcoding failed")
-	transcoder.CompleteJob(jobID, testErr)
+	transcoder.CompleteJob(context.Background(), jobID, testErr)
 
-	job := transcoder.GetJob(jobID)
+	job := transcoder.GetJob(context.Background(), jobID)
 	if job.Status != JobFailed {
 		t.Errorf("Expected JobFailed status, got %s", job.Status)
 	}
@@ -173,11 +173,11 @@ func TestCompleteJobWithError(t *testing.T) {
 }
 
 func TestGenerateMasterPlaylist(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	transcoder := NewMultiBitrateTranscoder("/tmp", "/usr/bin/ffmpeg", 4, logger)
 
 	recordingID := "test-playlist"
-	playlist, err := transcoder.GenerateMasterPlaylist(recordingID)
+	playlist, err := transcoder.GenerateMasterPlaylist(context.Background(), recordingID)
 
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -205,13 +205,13 @@ func TestGenerateMasterPlaylist(t *testing.T) {
 }
 
 func TestGenerateVariantPlaylist(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	transcoder := NewMultiBitrateTranscoder("/tmp", "/usr/bin/ffmpeg", 4, logger)
 
 	recordingID := "test-variant"
 	bitrate := 1000
 
-	playlist, err := transcoder.GenerateVariantPlaylist(recordingID, bitrate)
+	playlist, err := transcoder.GenerateVariantPlaylist(context.Background(), recordingID, bitrate, "")
 
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
@@ -232,73 +232,73 @@ func TestGenerateVariantPlaylist(t *testing.T) {
 }
 
 func TestGetAllJobs(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	transcoder := NewMultiBitrateTranscoder("/tmp", "/usr/bin/ffmpeg", 4, logger)
 
 	// Queue multiple recordings
-	jobIDs1, _ := transcoder.QueueMultiBitrateJob("recording-1", "/tmp/test1.mp4")
-	jobIDs2, _ := transcoder.QueueMultiBitrateJob("recording-2", "/tmp/test2.mp4")
+	jobIDs1, _ := transcoder.QueueMultiBitrateJob(context.Background(), "recording-1", "/tmp/test1.mp4")
+	jobIDs2, _ := transcoder.QueueMultiBitrateJob(context.Background(), "recording-2", "/tmp/test2.mp4")
 
 	// Get all jobs for recording-1
-	jobs1 := transcoder.GetAllJobs("recording-1")
+	jobs1 := transcoder.GetAllJobs(context.Background(), "recording-1")
 	if len(jobs1) != len(jobIDs1) {
 		t.Errorf("Expected %d jobs for recording-1, got %d", len(jobIDs1), len(jobs1))
 	}
 
 	// Get all jobs for recording-2
-	jobs2 := transcoder.GetAllJobs("recording-2")
+	jobs2 := transcoder.GetAllJobs(context.Background(), "recording-2")
 	if len(jobs2) != len(jobIDs2) {
 		t.Errorf("Expected %d jobs for recording-2, got %d", len(jobIDs2), len(jobs2))
 	}
 }
 
 func TestIsRecordingCompleted(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	transcoder := NewMultiBitrateTranscoder("/tmp", "/usr/bin/ffmpeg", 4, logger)
 
 	recordingID := "test-completion"
-	jobIDs, _ := transcoder.QueueMultiBitrateJob(recordingID, "/tmp/test.mp4")
+	jobIDs, _ := transcoder.QueueMultiBitrateJob(context.Background(), recordingID, "/tmp/test.mp4")
 
 	// Initially not completed
-	if transcoder.IsRecordingCompleted(recordingID) {
+	if transcoder.IsRecordingCompleted(context.Background(), recordingID) {
 		t.Error("Expected recording to not be completed")
 	}
 
 	// Complete all jobs
 	for _, jobID := range jobIDs {
-		transcoder.CompleteJob(jobID, nil)
+		transcoder.CompleteJob(context.Background(), jobID, nil)
 	}
 
 	// Now should be completed
-	if !transcoder.IsRecordingCompleted(recordingID) {
+	if !transcoder.IsRecordingCompleted(context.Background(), recordingID) {
 		t.Error("Expected recording to be completed")
 	}
 }
 
 func TestCancelJob(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	transcoder := NewMultiBitrateTranscoder("/tmp", "/usr/bin/ffmpeg", 4, logger)
 
-	jobIDs, _ := transcoder.QueueMultiBitrateJob("test-cancel", "/tmp/test.mp4")
+	jobIDs, _ := transcoder.QueueMultiBitrateJob(context.Background(), "test-cancel", "/tmp/test.mp4")
 	jobID := jobIDs[0]
 
 	// Cancel the job
-	err := transcoder.CancelJob(jobID)
+	err := transcoder.CancelJob(context.Background(), jobID)
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
 
-	job := transcoder.GetJob(jobID)
+	job := transcoder.GetJob(context.Background(), jobID)
 	if job.Status != JobCancelled {
 		t.Errorf("Expected JobCancelled status, got %s", job.Status)
 	}
 }
 
 func TestGetQueueStats(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	transcoder := NewMultiBitrateTranscoder("/tmp", "/usr/bin/ffmpeg", 2, logger)
 
-	stats := transcoder.GetQueueStats()
+	stats := transcoder.GetQueueStats(context.Background())
 
 	if stats["pending_jobs"].(int) != 0 {
 		t.Error("Expected 0 pending jobs initially")
@@ -314,10 +314,10 @@ func TestGetQueueStats(t *testing.T) {
 }
 
 func TestProgressCallback(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	transcoder := NewMultiBitrateTranscoder("/tmp", "/usr/bin/ffmpeg", 4, logger)
 
-	jobIDs, _ := transcoder.QueueMultiBitrateJob("test-callback", "/tmp/test.mp4")
+	jobIDs, _ := transcoder.QueueMultiBitrateJob(context.Background(), "test-callback", "/tmp/test.mp4")
 	jobID := jobIDs[0]
 
 	// Register a callback
@@ -329,7 +329,7 @@ func TestProgressCallback(t *testing.T) {
 	transcoder.RegisterProgressCallback(jobID, callback)
 
 	// Update progress - callback should be called
-	transcoder.UpdateJobProgress(jobID, 50.0, 25.0)
+	transcoder.UpdateJobProgress(context.Background(), jobID, 50.0, 25.0)
 
 	// In a real scenario with goroutines, we'd need to wait
 	// For now, just verify the callback was registered
@@ -371,7 +371,7 @@ func TestQueueFull(t *testing.T) {
 }
 
 func TestTranscodingServiceCreation(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	transcoder := NewMultiBitrateTranscoder("/tmp", "/usr/bin/ffmpeg", 4, logger)
 	service := NewTranscodingService(transcoder, 2, logger)
 
@@ -387,7 +387,7 @@ func TestTranscodingServiceCreation(t *testing.T) {
 }
 
 func TestNewTranscodingServiceWithWorkers(t *testing.T) {
-	logger := log.New(os.Stderr, "[Test] ", log.LstdFlags)
+	logger := slog.Default()
 	transcoder := NewMultiBitrateTranscoder("/tmp", "/usr/bin/ffmpeg", 4, logger)
 
 	// Create service with 3 workers
@@ -411,21 +411,21 @@ func containsString(str, substring string) bool {
 
 // Benchmark tests
 func BenchmarkQueueJob(b *testing.B) {
-	logger := log.New(os.Stderr, "[Bench] ", log.LstdFlags)
+	logger := slog.Default()
 	transcoder := NewMultiBitrateTranscoder("/tmp", "/usr/bin/ffmpeg", 100, logger)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		transcoder.QueueMultiBitrateJob(fmt.Sprintf("rec-%d", i), "/tmp/test.mp4")
+		transcoder.QueueMultiBitrateJob(context.Background(), fmt.Sprintf("rec-%d", i), "/tmp/test.mp4")
 	}
 }
 
 func BenchmarkGeneratePlaylist(b *testing.B) {
-	logger := log.New(os.Stderr, "[Bench] ", log.LstdFlags)
+	logger := slog.Default()
 	transcoder := NewMultiBitrateTranscoder("/tmp", "/usr/bin/ffmpeg", 4, logger)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		transcoder.GenerateMasterPlaylist(fmt.Sprintf("rec-%d", i))
+		transcoder.GenerateMasterPlaylist(context.Background(), fmt.Sprintf("rec-%d", i))
 	}
 }
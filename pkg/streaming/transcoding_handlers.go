@@ -2,77 +2,114 @@ package streaming
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
-	"strings"
+	"time"
+
+	"github.com/Bashar444/VTP/pkg/auth"
+	"github.com/Bashar444/VTP/pkg/course"
+	"github.com/Bashar444/VTP/pkg/logging"
+	"github.com/Bashar444/VTP/pkg/recording"
+	"github.com/Bashar444/VTP/pkg/router"
+	"github.com/google/uuid"
 )
 
 // TranscodingHandlers handles HTTP requests for transcoding
 type TranscodingHandlers struct {
 	service *TranscodingService
-	logger  *log.Logger
+	signer  *recording.PlaybackSigner
+	sharing *recording.SharingService
+	logger  *slog.Logger
 }
 
 // NewTranscodingHandlers creates a new transcoding handlers instance
-func NewTranscodingHandlers(service *TranscodingService, logger *log.Logger) *TranscodingHandlers {
+func NewTranscodingHandlers(service *TranscodingService, logger *slog.Logger) *TranscodingHandlers {
+	if logger == nil {
+		logger = logging.Discard()
+	}
 	return &TranscodingHandlers{
 		service: service,
 		logger:  logger,
 	}
 }
 
-// RegisterTranscodingRoutes registers all transcoding HTTP routes
-func (h *TranscodingHandlers) RegisterTranscodingRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/api/v1/transcode/", func(w http.ResponseWriter, r *http.Request) {
-		// Extract recording ID and route to appropriate handler
-		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/transcode/"), "/")
-		if len(parts) < 2 {
-			http.NotFound(w, r)
-			return
-		}
+// WithPlaybackTokens lets players fetch segment keys with the playback
+// token of the recording instead of the Authorization header. Key URIs in
+// generated playlists carry a token.
+func (h *TranscodingHandlers) WithPlaybackTokens(signer *recording.PlaybackSigner) *TranscodingHandlers {
+	h.signer = signer
+	return h
+}
 
-		recordingID := parts[0]
-
-		// Route to transcoding endpoints
-		if len(parts) >= 2 {
-			switch parts[1] {
-			case "quality":
-				if r.Method == http.MethodPost {
-					h.StartTranscodingHandler(w, r, recordingID)
-				} else {
-					http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-				}
-			case "progress":
-				if r.Method == http.MethodGet {
-					h.GetTranscodingProgressHandler(w, r, recordingID)
-				} else {
-					http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-				}
-			case "cancel":
-				if r.Method == http.MethodPost {
-					h.CancelTranscodingHandler(w, r, recordingID)
-				} else {
-					http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-				}
-			default:
-				http.NotFound(w, r)
-			}
-		} else if len(parts) >= 2 && parts[1] == "master.m3u8" {
-			// Master playlist endpoint
-			if r.Method == http.MethodGet {
-				h.GetMasterPlaylistHandler(w, r, recordingID)
-			} else {
-				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			}
-		}
-	})
+// WithSharing releases segment keys to everyone the recording's playback
+// admits, including users and link holders it was shared with. Without it
+// only members of the recording's course get keys.
+func (h *TranscodingHandlers) WithSharing(sharing *recording.SharingService) *TranscodingHandlers {
+	h.sharing = sharing
+	return h
+}
+
+// RegisterTranscodingRoutes registers all transcoding HTTP routes. Starting
+// and cancelling jobs requires a managing role in the recording's course.
+func (h *TranscodingHandlers) RegisterTranscodingRoutes(rt *router.Router, am *auth.AuthMiddleware, authz *course.CourseAuthorizer) {
+	api := rt.With(am.Middleware)
+	member := authz.Require(authz.RecordingScope("id"), course.MemberRoles...)
+	manage := authz.Require(authz.RecordingScope("id"), course.ManageRoles...)
+
+	api.HandleFunc("POST /api/v1/transcode/{id}/quality", h.withRecordingID(h.StartTranscodingHandler), manage)
+	api.HandleFunc("GET /api/v1/transcode/{id}/progress", h.withRecordingID(h.GetTranscodingProgressHandler), member)
+	api.HandleFunc("POST /api/v1/transcode/{id}/cancel", h.withRecordingID(h.CancelTranscodingHandler), manage)
+	api.HandleFunc("GET /api/v1/transcode/{id}/master.m3u8", h.withRecordingID(h.GetMasterPlaylistHandler), member)
+
+	// Keys are checked like the segments they decrypt: with sharing, by
+	// the recording's shares for whoever the playback token was issued to
+	authn, check := router.Middleware(am.Middleware), member
+	if h.sharing != nil {
+		authn, check = am.OptionalAuthMiddleware, h.sharing.RequireAccess(recording.AccessActionStream)
+	}
+	if h.signer != nil {
+		rt.HandleFunc("GET /api/v1/transcode/{id}/keys/{index}", h.withRecordingID(h.GetKeyHandler),
+			recording.RequirePlaybackToken(h.signer, h.logger, authn, check))
+	} else {
+		rt.HandleFunc("GET /api/v1/transcode/{id}/keys/{index}", h.withRecordingID(h.GetKeyHandler), authn, check)
+	}
+}
+
+// keyToken issues the playback token key URIs carry, for the user or
+// share the playlist is served to. It is empty without playback tokens.
+func (h *TranscodingHandlers) keyToken(r *http.Request, recordingID string) (string, error) {
+	if h.signer == nil {
+		return "", nil
+	}
+	id, err := uuid.Parse(recordingID)
+	if err != nil {
+		return "", err
+	}
+	userID, _ := r.Context().Value("user_id").(string)
+	role, _ := r.Context().Value("user_role").(string)
+	var shareID string
+	if claims, ok := recording.PlaybackClaimsFromContext(r.Context()); ok {
+		shareID = claims.ShareID
+	}
+	token, _, err := h.signer.IssueSegment(id, userID, role, shareID, h.signer.ClientIP(r), time.Now())
+	return token, err
+}
+
+// withRecordingID adapts a handler that takes the recording ID from the route
+func (h *TranscodingHandlers) withRecordingID(fn func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fn(w, r, r.PathValue("id"))
+	}
 }
 
 // StartTranscodingRequest represents a request to start transcoding
 type StartTranscodingRequest struct {
-	InputPath string `json:"input_path"` // Path to source video
+	InputPath string `json:"input_path"`         // Path to source video
+	Encrypt   bool   `json:"encrypt,omitempty"`  // Encrypt segments with AES-128
+	Backfill  bool   `json:"backfill,omitempty"` // Run after other queued encodes
 }
 
 // StartTranscodingResponse represents the response from starting transcoding
@@ -84,14 +121,14 @@ type StartTranscodingResponse struct {
 	Timestamp   int64    `json:"timestamp"`
 }
 
-// StartTranscodingHandler handles POST /api/v1/recordings/{id}/transcode/quality
+// StartTranscodingHandler handles POST /api/v1/transcode/{id}/quality
 func (h *TranscodingHandlers) StartTranscodingHandler(w http.ResponseWriter, r *http.Request, recordingID string) {
 	var req StartTranscodingRequest
 
 	// Parse request
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, `{"error":"Invalid request body"}`, http.StatusBadRequest)
-		h.logger.Printf("StartTranscoding - invalid request: %v", err)
+		h.logger.WarnContext(r.Context(), "Invalid transcoding request", "recording_id", recordingID, "error", err)
 		return
 	}
 
@@ -101,11 +138,22 @@ func (h *TranscodingHandlers) StartTranscodingHandler(w http.ResponseWriter, r *
 		return
 	}
 
+	if req.Encrypt {
+		if err := h.service.transcoder.EnableEncryption(recordingID); err != nil {
+			http.Error(w, `{"error":"Segment encryption is not configured"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Start transcoding
-	jobIDs, err := h.service.StartMultiBitrateEncoding(recordingID, req.InputPath)
+	priority := PriorityNormal
+	if req.Backfill {
+		priority = PriorityBackfill
+	}
+	jobIDs, err := h.service.StartPriorityEncoding(r.Context(), recordingID, req.InputPath, priority)
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
-		h.logger.Printf("StartTranscoding - error: %v", err)
+		h.logger.WarnContext(r.Context(), "Failed to start transcoding", "recording_id", recordingID, "error", err)
 		return
 	}
 
@@ -125,29 +173,29 @@ func (h *TranscodingHandlers) StartTranscodingHandler(w http.ResponseWriter, r *
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 
-	h.logger.Printf("StartTranscoding - recording=%s queued %d jobs", recordingID, len(jobIDs))
+	h.logger.InfoContext(r.Context(), "Transcoding started", "recording_id", recordingID, "jobs", len(jobIDs))
 }
 
 // TranscodingProgressResponse represents the progress response
 type TranscodingProgressResponse struct {
-	RecordingID     string                 `json:"recording_id"`
-	TotalJobs       int                    `json:"total_jobs"`
-	CompletedJobs   int                    `json:"completed_jobs"`
-	FailedJobs      int                    `json:"failed_jobs"`
-	AverageProgress float64                `json:"average_progress_percent"`
-	IsComplete      bool                   `json:"is_complete"`
-	Jobs            map[string]interface{} `json:"jobs"`
-	QueueStats      map[string]interface{} `json:"queue_stats"`
-	Timestamp       int64                  `json:"timestamp"`
+	RecordingID     string                   `json:"recording_id"`
+	TotalJobs       int                      `json:"total_jobs"`
+	CompletedJobs   int                      `json:"completed_jobs"`
+	FailedJobs      int                      `json:"failed_jobs"`
+	AverageProgress float64                  `json:"average_progress_percent"`
+	IsComplete      bool                     `json:"is_complete"`
+	Jobs            []map[string]interface{} `json:"jobs"`
+	QueueStats      map[string]interface{}   `json:"queue_stats"`
+	Timestamp       int64                    `json:"timestamp"`
 }
 
-// GetTranscodingProgressHandler handles GET /api/v1/recordings/{id}/transcode/progress
+// GetTranscodingProgressHandler handles GET /api/v1/transcode/{id}/progress
 func (h *TranscodingHandlers) GetTranscodingProgressHandler(w http.ResponseWriter, r *http.Request, recordingID string) {
 	// Get transcoding status
-	status := h.service.GetRecordingTranscodingStatus(recordingID)
+	status := h.service.GetRecordingTranscodingStatus(r.Context(), recordingID)
 
 	// Get queue statistics
-	queueStats := h.service.GetQueueStats()
+	queueStats := h.service.GetQueueStats(r.Context())
 
 	// Build response
 	resp := TranscodingProgressResponse{
@@ -157,7 +205,7 @@ func (h *TranscodingHandlers) GetTranscodingProgressHandler(w http.ResponseWrite
 		FailedJobs:      status["failed_count"].(int),
 		AverageProgress: status["average_progress"].(float64),
 		IsComplete:      status["is_complete"].(bool),
-		Jobs:            status["jobs"].(map[string]interface{}),
+		Jobs:            status["jobs"].([]map[string]interface{}),
 		QueueStats:      queueStats,
 		Timestamp:       getUnixMillis(),
 	}
@@ -166,18 +214,18 @@ func (h *TranscodingHandlers) GetTranscodingProgressHandler(w http.ResponseWrite
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 
-	h.logger.Printf("GetTranscodingProgress - recording=%s completed=%d/%d",
-		recordingID, resp.CompletedJobs, resp.TotalJobs)
+	h.logger.DebugContext(r.Context(), "Transcoding progress returned", "recording_id", recordingID,
+		"completed", resp.CompletedJobs, "total", resp.TotalJobs)
 }
 
-// CancelTranscodingHandler handles POST /api/v1/recordings/{id}/transcode/cancel
+// CancelTranscodingHandler handles POST /api/v1/transcode/{id}/cancel
 func (h *TranscodingHandlers) CancelTranscodingHandler(w http.ResponseWriter, r *http.Request, recordingID string) {
 	// Cancel all encoding jobs for this recording
-	err := h.service.CancelRecordingEncoding(recordingID)
+	err := h.service.CancelRecordingEncoding(r.Context(), recordingID)
 
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusBadRequest)
-		h.logger.Printf("CancelTranscoding - error: %v", err)
+		h.logger.WarnContext(r.Context(), "Failed to cancel transcoding", "recording_id", recordingID, "error", err)
 		return
 	}
 
@@ -192,23 +240,23 @@ func (h *TranscodingHandlers) CancelTranscodingHandler(w http.ResponseWriter, r
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 
-	h.logger.Printf("CancelTranscoding - recording=%s cancelled", recordingID)
+	h.logger.InfoContext(r.Context(), "Transcoding cancelled", "recording_id", recordingID)
 }
 
-// GetMasterPlaylistHandler handles GET /api/v1/recordings/{id}/stream/master.m3u8
+// GetMasterPlaylistHandler handles GET /api/v1/transcode/{id}/master.m3u8
 func (h *TranscodingHandlers) GetMasterPlaylistHandler(w http.ResponseWriter, r *http.Request, recordingID string) {
 	// Check if recording is finished transcoding
-	if !h.service.transcoder.IsRecordingCompleted(recordingID) {
+	if !h.service.transcoder.IsRecordingCompleted(r.Context(), recordingID) {
 		http.Error(w, `{"error":"Recording is still transcoding"}`, http.StatusBadRequest)
-		h.logger.Printf("GetMasterPlaylist - recording %s not yet completed", recordingID)
+		h.logger.DebugContext(r.Context(), "Master playlist requested before transcoding completed", "recording_id", recordingID)
 		return
 	}
 
 	// Generate master playlist
-	playlist, err := h.service.transcoder.GenerateMasterPlaylist(recordingID)
+	playlist, err := h.service.transcoder.GenerateMasterPlaylist(r.Context(), recordingID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
-		h.logger.Printf("GetMasterPlaylist - error: %v", err)
+		h.logger.ErrorContext(r.Context(), "Failed to generate master playlist", "recording_id", recordingID, "error", err)
 		return
 	}
 
@@ -217,7 +265,35 @@ func (h *TranscodingHandlers) GetMasterPlaylistHandler(w http.ResponseWriter, r
 	w.Header().Set("Cache-Control", "public, max-age=3600")
 	fmt.Fprint(w, playlist)
 
-	h.logger.Printf("GetMasterPlaylist - recording=%s returned", recordingID)
+	h.logger.DebugContext(r.Context(), "Master playlist returned", "recording_id", recordingID)
+}
+
+// GetKeyHandler handles GET /api/v1/transcode/{id}/keys/{index}. Keys are
+// released only to those allowed to stream the recording, identified by
+// their session or a playback token for the recording, and never cached.
+func (h *TranscodingHandlers) GetKeyHandler(w http.ResponseWriter, r *http.Request, recordingID string) {
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil || index < 0 {
+		http.Error(w, `{"error":"Invalid key index"}`, http.StatusBadRequest)
+		return
+	}
+
+	key, err := h.service.transcoder.SegmentKey(r.Context(), recordingID, index)
+	if errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrEncryptionNotConfigured) {
+		http.Error(w, `{"error":"Key not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to load key"}`, http.StatusInternalServerError)
+		h.logger.ErrorContext(r.Context(), "Failed to load segment key", "recording_id", recordingID, "key_index", index, "error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(key)
+
+	h.logger.DebugContext(r.Context(), "Segment key released", "recording_id", recordingID, "key_index", index)
 }
 
 // GetVariantPlaylistHandler handles GET /api/v1/recordings/{id}/stream/{bitrate}.m3u8
@@ -229,29 +305,41 @@ func (h *TranscodingHandlers) GetVariantPlaylistHandler(w http.ResponseWriter, r
 		return
 	}
 
+	keyToken, err := h.keyToken(r, recordingID)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to issue playback token"}`, http.StatusInternalServerError)
+		h.logger.ErrorContext(r.Context(), "Failed to issue key token", "recording_id", recordingID, "error", err)
+		return
+	}
+
 	// Generate variant playlist
-	playlist, err := h.service.transcoder.GenerateVariantPlaylist(recordingID, bitrate)
+	playlist, err := h.service.transcoder.GenerateVariantPlaylist(r.Context(), recordingID, bitrate, keyToken)
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
-		h.logger.Printf("GetVariantPlaylist - error: %v", err)
+		h.logger.ErrorContext(r.Context(), "Failed to generate variant playlist", "recording_id", recordingID, "bitrate_kbps", bitrate, "error", err)
 		return
 	}
 
-	// Send playlist
+	// Send playlist; key tokens are personal and expire, so playlists
+	// carrying them are not cached
 	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
-	w.Header().Set("Cache-Control", "public, max-age=3600")
+	if keyToken != "" {
+		w.Header().Set("Cache-Control", "no-store")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+	}
 	fmt.Fprint(w, playlist)
 
-	h.logger.Printf("GetVariantPlaylist - recording=%s bitrate=%d returned", recordingID, bitrate)
+	h.logger.DebugContext(r.Context(), "Variant playlist returned", "recording_id", recordingID, "bitrate_kbps", bitrate)
 }
 
 // GeneratePlaylistsHandler handles POST /api/v1/recordings/{id}/stream/generate-playlists
 func (h *TranscodingHandlers) GeneratePlaylistsHandler(w http.ResponseWriter, r *http.Request, recordingID string) {
 	// Generate all playlists
-	playlists, err := h.service.GeneratePlaylistsForRecording(recordingID)
+	playlists, err := h.service.GeneratePlaylistsForRecording(r.Context(), recordingID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"error":"%s"}`, err.Error()), http.StatusInternalServerError)
-		h.logger.Printf("GeneratePlaylists - error: %v", err)
+		h.logger.ErrorContext(r.Context(), "Failed to generate playlists", "recording_id", recordingID, "error", err)
 		return
 	}
 
@@ -267,5 +355,5 @@ func (h *TranscodingHandlers) GeneratePlaylistsHandler(w http.ResponseWriter, r
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 
-	h.logger.Printf("GeneratePlaylists - recording=%s playlists generated", recordingID)
+	h.logger.InfoContext(r.Context(), "Playlists generated", "recording_id", recordingID)
 }
@@ -1,90 +1,128 @@
 package streaming
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"sync"
+	"time"
+)
+
+const (
+	// jobLeaseTTL is how long a job stays with a worker that stopped sending
+	// heartbeats before another worker takes it over
+	jobLeaseTTL = 2 * time.Minute
+	// jobPollInterval is how often idle workers look for queued jobs
+	jobPollInterval = time.Second
 )
 
 // TranscodingService manages the transcoding pipeline
 type TranscodingService struct {
 	transcoder   *MultiBitrateTranscoder
-	logger       *log.Logger
+	logger       *slog.Logger
 	activeJobs   map[string]bool
 	activeJobsMu sync.RWMutex
 	workerCount  int
+	workerID     string
+	leaseTTL     time.Duration
+	pollInterval time.Duration
 	stopChan     chan struct{}
 	wg           sync.WaitGroup
 }
 
 // NewTranscodingService creates a new transcoding service
-func NewTranscodingService(transcoder *MultiBitrateTranscoder, workerCount int, logger *log.Logger) *TranscodingService {
+func NewTranscodingService(transcoder *MultiBitrateTranscoder, workerCount int, logger *slog.Logger) *TranscodingService {
 	ts := &TranscodingService{
-		transcoder:  transcoder,
-		logger:      logger,
-		activeJobs:  make(map[string]bool),
-		workerCount: workerCount,
-		stopChan:    make(chan struct{}),
+		transcoder:   transcoder,
+		logger:       logger,
+		activeJobs:   make(map[string]bool),
+		workerCount:  workerCount,
+		workerID:     DefaultWorkerID(),
+		leaseTTL:     jobLeaseTTL,
+		pollInterval: jobPollInterval,
+		stopChan:     make(chan struct{}),
 	}
 
 	// Start worker goroutines
 	for i := 0; i < workerCount; i++ {
 		ts.wg.Add(1)
-		go ts.transcodingWorker(i)
+		go ts.transcodingWorker(fmt.Sprintf("%s/w%d", ts.workerID, i))
 	}
 
-	ts.logger.Printf("[TranscodingService] Service started with %d workers", workerCount)
+	ts.logger.Info("Transcoding service started", "workers", workerCount, "worker_id", ts.workerID)
 	return ts
 }
 
-// transcodingWorker processes transcoding jobs from the queue
-func (ts *TranscodingService) transcodingWorker(workerID int) {
+// transcodingWorker leases jobs from the job store and runs them
+func (ts *TranscodingService) transcodingWorker(workerID string) {
 	defer ts.wg.Done()
 
 	for {
 		select {
 		case <-ts.stopChan:
-			ts.logger.Printf("[TranscodingService] Worker %d stopping", workerID)
+			ts.logger.Debug("Transcoding worker stopping", "worker_id", workerID)
 			return
 		default:
-			// Try to get a job from the queue
-			job := ts.transcoder.queue.Next()
-			if job == nil {
-				// No jobs available, sleep briefly
-				select {
-				case <-ts.stopChan:
-					return
-				default:
-					// Sleep for a short duration
-					// In real implementation, use time.Sleep(100 * time.Millisecond)
-				}
-				continue
-			}
+		}
 
-			// Process the job
-			ts.processTranscodingJob(job, workerID)
+		job, err := ts.transcoder.leaseJob(context.Background(), workerID, ts.leaseTTL)
+		if err != nil {
+			ts.logger.Warn("Transcoding worker failed to lease a job", "worker_id", workerID, "error", err)
+		}
+		if job == nil {
+			// No jobs available, look again shortly
+			select {
+			case <-ts.stopChan:
+				ts.logger.Debug("Transcoding worker stopping", "worker_id", workerID)
+				return
+			case <-time.After(ts.pollInterval):
+			}
+			continue
 		}
+
+		// Process the job
+		ts.processTranscodingJob(job, workerID)
 	}
 }
 
-// processTranscodingJob executes an actual transcoding job
-func (ts *TranscodingService) processTranscodingJob(job *TranscodingJob, workerID int) {
-	job.Status = JobRunning
-	ts.logger.Printf("[TranscodingService:W%d] Starting job %s (%d kbps)", workerID, job.JobID, job.Profile.Bitrate)
+// processTranscodingJob executes an actual transcoding job. The lease is
+// renewed while it runs; a job that is cancelled or taken over by another
+// worker stops without being finished here.
+func (ts *TranscodingService) processTranscodingJob(job *TranscodingJob, workerID string) {
+	ts.logger.Info("Transcoding job started", "worker_id", workerID, "job_id", job.JobID,
+		"bitrate_kbps", job.Profile.Bitrate, "attempt", job.Attempts, "max_attempts", job.MaxAttempts)
 
 	// Mark as active
 	ts.activeJobsMu.Lock()
 	ts.activeJobs[job.JobID] = true
 	ts.activeJobsMu.Unlock()
 
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	go ts.keepLease(ctx, cancel, job.JobID, workerID)
+
 	// In a real implementation, this would call FFmpeg
 	// For now, we'll simulate the transcoding process
-	err := ts.simulateTranscoding(job)
+	err := ts.simulateTranscoding(ctx, job)
+	if err == nil && job.Encrypted {
+		// Not cancelled half way, so segments are never encrypted twice.
+		// Playlists only announce keys once segments were encrypted.
+		var count int
+		count, err = ts.transcoder.EncryptSegments(ctx, job.RecordingID, job.Profile.Bitrate)
+		if err == nil && count == 0 && !ts.transcoder.VariantEncrypted(job.RecordingID, job.Profile.Bitrate) {
+			ts.logger.Warn("No segments to encrypt", "job_id", job.JobID, "recording_id", job.RecordingID, "bitrate_kbps", job.Profile.Bitrate)
+		}
+	}
 
 	// Update job status
-	ts.transcoder.CompleteJob(job.JobID, err)
+	if cause := context.Cause(ctx); cause != nil {
+		ts.logger.Info("Transcoding job stopped", "worker_id", workerID, "job_id", job.JobID, "cause", cause)
+	} else {
+		ts.transcoder.finishJob(context.Background(), job.JobID, workerID, err, true)
+	}
 
 	// Mark as inactive
 	ts.activeJobsMu.Lock()
@@ -92,54 +130,93 @@ func (ts *TranscodingService) processTranscodingJob(job *TranscodingJob, workerI
 	ts.activeJobsMu.Unlock()
 }
 
+// keepLease sends heartbeats for a running job until ctx is done, and
+// cancels the job when its lease can no longer be renewed
+func (ts *TranscodingService) keepLease(ctx context.Context, cancel context.CancelCauseFunc, jobID, workerID string) {
+	ticker := time.NewTicker(ts.leaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := ts.transcoder.heartbeat(ctx, jobID, workerID, ts.leaseTTL)
+		if errors.Is(err, ErrJobCancelled) || errors.Is(err, ErrLeaseLost) || errors.Is(err, ErrJobNotFound) {
+			cancel(err)
+			return
+		}
+		if err != nil && ctx.Err() == nil {
+			ts.logger.WarnContext(ctx, "Transcoding job heartbeat failed", "worker_id", workerID, "job_id", jobID, "error", err)
+		}
+	}
+}
+
 // simulateTranscoding simulates the transcoding process for testing
-func (ts *TranscodingService) simulateTranscoding(job *TranscodingJob) error {
+func (ts *TranscodingService) simulateTranscoding(ctx context.Context, job *TranscodingJob) error {
 	// In a real implementation, this would call:
 	// ffmpeg -i input.mp4 -b:v {bitrate}k -r {fps} -s {resolution} output.mp4
 
 	// Simulate encoding progress
 	for progress := float64(0); progress < 100; progress += 10 {
-		ts.transcoder.UpdateJobProgress(job.JobID, progress, 30.0) // 30 FPS
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ts.transcoder.UpdateJobProgress(ctx, job.JobID, progress, 30.0) // 30 FPS
 		// Sleep to simulate encoding time
 		// In real: time.Sleep(100 * time.Millisecond)
 	}
 
-	ts.transcoder.UpdateJobProgress(job.JobID, 100.0, 30.0)
+	ts.transcoder.UpdateJobProgress(ctx, job.JobID, 100.0, 30.0)
 
 	// Create dummy output file (in production, this would be the actual video)
 	if err := os.WriteFile(job.OutputPath, []byte("dummy video data"), 0644); err != nil {
 		return fmt.Errorf("failed to write output file: %w", err)
 	}
 
-	ts.logger.Printf("[TranscodingService] Transcoded to %s", job.OutputPath)
+	ts.logger.DebugContext(ctx, "Transcoded", "job_id", job.JobID, "output", job.OutputPath)
 	return nil
 }
 
 // StartMultiBitrateEncoding queues a recording for multi-bitrate transcoding
-func (ts *TranscodingService) StartMultiBitrateEncoding(recordingID, inputPath string) ([]string, error) {
+func (ts *TranscodingService) StartMultiBitrateEncoding(ctx context.Context, recordingID, inputPath string) ([]string, error) {
+	return ts.StartPriorityEncoding(ctx, recordingID, inputPath, PriorityNormal)
+}
+
+// StartLiveToVODEncoding queues a recording that just ended ahead of other
+// encodes
+func (ts *TranscodingService) StartLiveToVODEncoding(ctx context.Context, recordingID, inputPath string) ([]string, error) {
+	return ts.StartPriorityEncoding(ctx, recordingID, inputPath, PriorityLiveToVOD)
+}
+
+// StartPriorityEncoding queues a recording for multi-bitrate transcoding at
+// the given priority
+func (ts *TranscodingService) StartPriorityEncoding(ctx context.Context, recordingID, inputPath string, priority int) ([]string, error) {
 	if recordingID == "" || inputPath == "" {
 		return nil, fmt.Errorf("invalid recording ID or input path")
 	}
 
 	// Queue jobs for all profiles
-	jobIDs, err := ts.transcoder.QueueMultiBitrateJob(recordingID, inputPath)
+	jobIDs, err := ts.transcoder.QueuePriorityJob(ctx, recordingID, inputPath, priority)
 	if err != nil {
-		ts.logger.Printf("[TranscodingService] Error starting encoding for %s: %v", recordingID, err)
+		ts.logger.ErrorContext(ctx, "Failed to start encoding", "recording_id", recordingID, "error", err)
 		return nil, err
 	}
 
-	ts.logger.Printf("[TranscodingService] Queued %d encoding jobs for recording %s", len(jobIDs), recordingID)
+	ts.logger.InfoContext(ctx, "Encoding jobs queued", "recording_id", recordingID, "jobs", len(jobIDs))
 	return jobIDs, nil
 }
 
 // GetTranscodingProgress returns progress for a specific job
-func (ts *TranscodingService) GetTranscodingProgress(jobID string) ProgressUpdate {
-	return ts.transcoder.GetJobStats(jobID)
+func (ts *TranscodingService) GetTranscodingProgress(ctx context.Context, jobID string) ProgressUpdate {
+	return ts.transcoder.GetJobStats(ctx, jobID)
 }
 
 // GetRecordingTranscodingStatus returns status for all jobs of a recording
-func (ts *TranscodingService) GetRecordingTranscodingStatus(recordingID string) map[string]interface{} {
-	jobs := ts.transcoder.GetAllJobs(recordingID)
+func (ts *TranscodingService) GetRecordingTranscodingStatus(ctx context.Context, recordingID string) map[string]interface{} {
+	jobs := ts.transcoder.GetAllJobs(ctx, recordingID)
 
 	status := map[string]interface{}{
 		"recording_id": recordingID,
@@ -158,6 +235,14 @@ func (ts *TranscodingService) GetRecordingTranscodingStatus(recordingID string)
 			"status":   job.Status,
 			"progress": job.Progress,
 			"output":   job.OutputPath,
+			"priority": job.Priority,
+			"attempts": job.Attempts,
+		}
+		if job.WorkerID != "" {
+			jobInfo["worker_id"] = job.WorkerID
+		}
+		if job.Error != nil {
+			jobInfo["error"] = job.Error.Error()
 		}
 
 		if job.Status == JobCompleted {
@@ -174,32 +259,32 @@ func (ts *TranscodingService) GetRecordingTranscodingStatus(recordingID string)
 
 	if len(jobs) > 0 {
 		avgProgress /= float64(len(jobs))
-		status["average_progress"] = avgProgress
-		status["completed_count"] = completedCount
-		status["failed_count"] = failedCount
-		status["is_complete"] = completedCount == len(jobs) && failedCount == 0
 	}
+	status["average_progress"] = avgProgress
+	status["completed_count"] = completedCount
+	status["failed_count"] = failedCount
+	status["is_complete"] = len(jobs) > 0 && completedCount == len(jobs) && failedCount == 0
 
 	return status
 }
 
 // GeneratePlaylistsForRecording generates all HLS playlists for a completed encoding
-func (ts *TranscodingService) GeneratePlaylistsForRecording(recordingID string) (map[string]string, error) {
+func (ts *TranscodingService) GeneratePlaylistsForRecording(ctx context.Context, recordingID string) (map[string]string, error) {
 	playlists := make(map[string]string)
 
 	// Generate master playlist
-	masterPlaylist, err := ts.transcoder.GenerateMasterPlaylist(recordingID)
+	masterPlaylist, err := ts.transcoder.GenerateMasterPlaylist(ctx, recordingID)
 	if err != nil {
-		ts.logger.Printf("[TranscodingService] Error generating master playlist: %v", err)
+		ts.logger.ErrorContext(ctx, "Failed to generate master playlist", "recording_id", recordingID, "error", err)
 		return nil, err
 	}
 	playlists["master"] = masterPlaylist
 
 	// Generate variant playlists for each bitrate
 	for _, profile := range ts.transcoder.GetDefaultProfiles() {
-		variantPlaylist, err := ts.transcoder.GenerateVariantPlaylist(recordingID, profile.Bitrate)
+		variantPlaylist, err := ts.transcoder.GenerateVariantPlaylist(ctx, recordingID, profile.Bitrate, "")
 		if err != nil {
-			ts.logger.Printf("[TranscodingService] Error generating variant playlist: %v", err)
+			ts.logger.ErrorContext(ctx, "Failed to generate variant playlist", "recording_id", recordingID, "bitrate_kbps", profile.Bitrate, "error", err)
 			return nil, err
 		}
 
@@ -207,38 +292,41 @@ func (ts *TranscodingService) GeneratePlaylistsForRecording(recordingID string)
 		playlists[playlistKey] = variantPlaylist
 	}
 
-	ts.logger.Printf("[TranscodingService] Generated playlists for recording %s", recordingID)
+	ts.logger.InfoContext(ctx, "Playlists generated", "recording_id", recordingID)
 	return playlists, nil
 }
 
 // CancelRecordingEncoding cancels all jobs for a recording
-func (ts *TranscodingService) CancelRecordingEncoding(recordingID string) error {
-	jobs := ts.transcoder.GetAllJobs(recordingID)
+func (ts *TranscodingService) CancelRecordingEncoding(ctx context.Context, recordingID string) error {
+	jobs := ts.transcoder.GetAllJobs(ctx, recordingID)
 
 	for _, job := range jobs {
-		if err := ts.transcoder.CancelJob(job.JobID); err != nil {
-			ts.logger.Printf("[TranscodingService] Error cancelling job %s: %v", job.JobID, err)
+		if err := ts.transcoder.CancelJob(ctx, job.JobID); err != nil {
+			ts.logger.WarnContext(ctx, "Failed to cancel encoding job", "job_id", job.JobID, "error", err)
 		}
 	}
 
-	ts.logger.Printf("[TranscodingService] Cancelled all encoding jobs for recording %s", recordingID)
+	ts.logger.InfoContext(ctx, "Encoding jobs cancelled", "recording_id", recordingID)
 	return nil
 }
 
 // GetQueueStats returns statistics about the transcoding queue
-func (ts *TranscodingService) GetQueueStats() map[string]interface{} {
-	stats := ts.transcoder.GetQueueStats()
+func (ts *TranscodingService) GetQueueStats(ctx context.Context) map[string]interface{} {
+	stats := ts.transcoder.GetQueueStats(ctx)
+	ts.activeJobsMu.RLock()
 	stats["active_jobs"] = len(ts.activeJobs)
+	ts.activeJobsMu.RUnlock()
 	stats["workers"] = ts.workerCount
+	stats["worker_id"] = ts.workerID
 	return stats
 }
 
 // Stop gracefully stops the transcoding service
 func (ts *TranscodingService) Stop() error {
-	ts.logger.Println("[TranscodingService] Stopping service...")
+	ts.logger.Info("Transcoding service stopping")
 	close(ts.stopChan)
 	ts.wg.Wait()
-	ts.logger.Println("[TranscodingService] Service stopped")
+	ts.logger.Info("Transcoding service stopped")
 	return nil
 }
 
@@ -6,8 +6,9 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/Bashar444/VTP/pkg/auth"
 	"github.com/Bashar444/VTP/pkg/models"
-	"github.com/gorilla/mux"
+	"github.com/Bashar444/VTP/pkg/router"
 )
 
 // Handler handles HTTP requests for subjects
@@ -20,6 +21,18 @@ func NewHandler(service *Service) *Handler {
 	return &Handler{service: service}
 }
 
+// RegisterRoutes registers subject routes. Subjects are public to read and
+// managed by admins.
+func (h *Handler) RegisterRoutes(rt *router.Router, am *auth.AuthMiddleware) {
+	admin := rt.With(am.Middleware, am.RoleMiddleware(string(auth.RoleAdmin)))
+
+	rt.HandleFunc("GET /api/v1/subjects", h.ListSubjects)
+	rt.HandleFunc("GET /api/v1/subjects/{id}", h.GetSubject)
+	admin.HandleFunc("POST /api/v1/subjects", h.CreateSubject)
+	admin.HandleFunc("PUT /api/v1/subjects/{id}", h.UpdateSubject)
+	admin.HandleFunc("DELETE /api/v1/subjects/{id}", h.DeleteSubject)
+}
+
 // SubjectRequest represents the request to create/update a subject
 type SubjectRequest struct {
 	NameAr   string `json:"name_ar"`
@@ -60,8 +73,7 @@ func (h *Handler) CreateSubject(w http.ResponseWriter, r *http.Request) {
 
 // GetSubject handles GET /api/v1/subjects/{id}
 func (h *Handler) GetSubject(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id := r.PathValue("id")
 
 	subject, err := h.service.GetSubject(r.Context(), id)
 	if err != nil {
@@ -113,8 +125,7 @@ func (h *Handler) ListSubjects(w http.ResponseWriter, r *http.Request) {
 
 // UpdateSubject handles PUT /api/v1/subjects/{id}
 func (h *Handler) UpdateSubject(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id := r.PathValue("id")
 
 	var req SubjectRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -144,8 +155,7 @@ func (h *Handler) UpdateSubject(w http.ResponseWriter, r *http.Request) {
 
 // DeleteSubject handles DELETE /api/v1/subjects/{id}
 func (h *Handler) DeleteSubject(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id := r.PathValue("id")
 
 	if err := h.service.DeleteSubject(r.Context(), id); err != nil {
 		if err == ErrSubjectNotFound {
@@ -2,6 +2,8 @@ package utils
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 )
 
@@ -15,6 +17,19 @@ func WriteErr(w http.ResponseWriter, status int, err error) {
 	WriteJSON(w, status, map[string]string{"error": err.Error()})
 }
 
+// DecodeJSON decodes a request body holding exactly one JSON value, so the
+// handler sees the same value the course scope was resolved from
+func DecodeJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after JSON body")
+	}
+	return nil
+}
+
 // Param retrieves a path parameter from Request. For net/http without routers,
 // this is a stub; integrate with your router as needed.
 func Param(r *http.Request, key string) string {
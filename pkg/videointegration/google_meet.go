@@ -0,0 +1,382 @@
+package videointegration
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrGoogleNotConfigured = errors.New("google meet is not configured")
+	ErrGoogleEventNotFound = errors.New("google calendar event not found")
+	ErrMeetLinkPending     = errors.New("google meet link is not ready yet")
+)
+
+const (
+	googleCalendarURL = "https://www.googleapis.com/calendar/v3"
+	googleTokenURL    = "https://oauth2.googleapis.com/token"
+	googleEventsScope = "https://www.googleapis.com/auth/calendar.events"
+)
+
+// GoogleConfig configures a service account with domain-wide delegation
+// that creates Calendar events with Meet conferences for a Workspace user
+type GoogleConfig struct {
+	ClientEmail string          // service account
+	PrivateKey  *rsa.PrivateKey // service account key signing token assertions
+	Subject     string          // Workspace user the events are organized by
+	CalendarID  string          // "primary" by default
+	APIURL      string          // overrides the Calendar API, for tests
+	TokenURL    string          // overrides the token endpoint, for tests
+}
+
+// serviceAccountKey is the JSON key file of a service account
+type serviceAccountKey struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// GoogleConfigFromEnv reads the service account key file named by
+// GOOGLE_SERVICE_ACCOUNT_FILE and the organizer GOOGLE_MEET_ORGANIZER
+func GoogleConfigFromEnv() (GoogleConfig, error) {
+	path := os.Getenv("GOOGLE_SERVICE_ACCOUNT_FILE")
+	subject := os.Getenv("GOOGLE_MEET_ORGANIZER")
+	if path == "" || subject == "" {
+		return GoogleConfig{}, ErrGoogleNotConfigured
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return GoogleConfig{}, fmt.Errorf("failed to read service account key: %w", err)
+	}
+	var key serviceAccountKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return GoogleConfig{}, fmt.Errorf("failed to decode service account key: %w", err)
+	}
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(key.PrivateKey))
+	if err != nil {
+		return GoogleConfig{}, fmt.Errorf("failed to parse service account private key: %w", err)
+	}
+
+	return GoogleConfig{
+		ClientEmail: key.ClientEmail,
+		PrivateKey:  privateKey,
+		Subject:     subject,
+		CalendarID:  os.Getenv("GOOGLE_MEET_CALENDAR_ID"),
+		TokenURL:    key.TokenURI,
+	}, nil
+}
+
+// GoogleMeetProvider implements VideoProvider for Google Meet. Each
+// meeting is a Calendar event of the organizer with a Meet conference;
+// the event ID is the external meeting ID. Attendees get Google's
+// invitations and updates.
+type GoogleMeetProvider struct {
+	cfg        GoogleConfig
+	httpClient *http.Client
+	logger     *slog.Logger
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewGoogleMeetProvider creates a new Google Meet provider
+func NewGoogleMeetProvider(cfg GoogleConfig, logger *slog.Logger) *GoogleMeetProvider {
+	if cfg.APIURL == "" {
+		cfg.APIURL = googleCalendarURL
+	}
+	if cfg.TokenURL == "" {
+		cfg.TokenURL = googleTokenURL
+	}
+	if cfg.CalendarID == "" {
+		cfg.CalendarID = "primary"
+	}
+	if logger == nil {
+		logger = slog.Default().With("component", "google_meet")
+	}
+	return &GoogleMeetProvider{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+		logger:     logger,
+	}
+}
+
+// calendarEvent is a Calendar event as sent to and returned by the API
+type calendarEvent struct {
+	ID             string           `json:"id,omitempty"`
+	Summary        string           `json:"summary,omitempty"`
+	Start          *eventTime       `json:"start,omitempty"`
+	End            *eventTime       `json:"end,omitempty"`
+	Attendees      []eventAttendee  `json:"attendees,omitempty"`
+	HangoutLink    string           `json:"hangoutLink,omitempty"`
+	ConferenceData *eventConference `json:"conferenceData,omitempty"`
+	GuestsCanShare *bool            `json:"guestsCanInviteOthers,omitempty"`
+}
+
+type eventTime struct {
+	DateTime string `json:"dateTime"`
+}
+
+type eventAttendee struct {
+	Email string `json:"email"`
+}
+
+type eventConference struct {
+	CreateRequest *conferenceRequest `json:"createRequest,omitempty"`
+	EntryPoints   []struct {
+		Type string `json:"entryPointType"`
+		URI  string `json:"uri"`
+	} `json:"entryPoints,omitempty"`
+}
+
+type conferenceRequest struct {
+	RequestID string `json:"requestId"`
+	Solution  struct {
+		Type string `json:"type"`
+	} `json:"conferenceSolutionKey"`
+}
+
+func newCalendarEvent(title string, scheduledAt time.Time, duration int, settings MeetingSettings) *calendarEvent {
+	guestsCanShare := false
+	event := &calendarEvent{
+		Summary:        title,
+		Start:          &eventTime{DateTime: scheduledAt.UTC().Format(time.RFC3339)},
+		End:            &eventTime{DateTime: scheduledAt.Add(time.Duration(duration) * time.Minute).UTC().Format(time.RFC3339)},
+		GuestsCanShare: &guestsCanShare,
+	}
+	for _, email := range settings.Attendees {
+		event.Attendees = append(event.Attendees, eventAttendee{Email: email})
+	}
+	return event
+}
+
+// meetLink returns the video entry point of an event's conference
+func (e *calendarEvent) meetLink() string {
+	if e.HangoutLink != "" {
+		return e.HangoutLink
+	}
+	if e.ConferenceData != nil {
+		for _, entry := range e.ConferenceData.EntryPoints {
+			if entry.Type == "video" {
+				return entry.URI
+			}
+		}
+	}
+	return ""
+}
+
+func (e *calendarEvent) details() *MeetingDetails {
+	link := e.meetLink()
+	return &MeetingDetails{
+		ExternalID:  e.ID,
+		MeetingLink: link,
+		HostLink:    link, // the organizer is host by signing in
+		JoinURL:     link,
+	}
+}
+
+// CreateMeeting creates a Calendar event with a Meet conference and
+// invites the attendees
+func (g *GoogleMeetProvider) CreateMeeting(ctx context.Context, title string, scheduledAt time.Time, duration int, settings MeetingSettings) (*MeetingDetails, error) {
+	event := newCalendarEvent(title, scheduledAt, duration, settings)
+	request := &conferenceRequest{RequestID: uuid.New().String()}
+	request.Solution.Type = "hangoutsMeet"
+	event.ConferenceData = &eventConference{CreateRequest: request}
+
+	var created calendarEvent
+	if err := g.do(ctx, http.MethodPost, g.eventsPath("")+"?conferenceDataVersion=1&sendUpdates=all", event, &created); err != nil {
+		return nil, fmt.Errorf("failed to create google calendar event: %w", err)
+	}
+
+	// Conferences are usually created at once, but may still be pending.
+	// An event without a link is removed so it can be created again.
+	if created.meetLink() == "" {
+		details, err := g.GetMeetingInfo(ctx, created.ID)
+		if err == nil && details.MeetingLink == "" {
+			err = ErrMeetLinkPending
+		}
+		if err != nil {
+			if delErr := g.DeleteMeeting(ctx, created.ID); delErr != nil {
+				g.logger.WarnContext(ctx, "Failed to remove event without a Meet link", "event_id", created.ID, "error", delErr)
+			}
+			return nil, err
+		}
+		return details, nil
+	}
+	return created.details(), nil
+}
+
+// UpdateMeeting moves or renames the event and updates its attendees,
+// notifying them
+func (g *GoogleMeetProvider) UpdateMeeting(ctx context.Context, externalID string, title string, scheduledAt time.Time, duration int, settings MeetingSettings) error {
+	event := newCalendarEvent(title, scheduledAt, duration, settings)
+	if err := g.do(ctx, http.MethodPatch, g.eventsPath(externalID)+"?sendUpdates=all", event, nil); err != nil {
+		return fmt.Errorf("failed to update google calendar event: %w", err)
+	}
+	return nil
+}
+
+// DeleteMeeting cancels the event, notifying attendees. An event already
+// gone is not an error.
+func (g *GoogleMeetProvider) DeleteMeeting(ctx context.Context, externalID string) error {
+	err := g.do(ctx, http.MethodDelete, g.eventsPath(externalID)+"?sendUpdates=all", nil, nil)
+	if err != nil && !errors.Is(err, ErrGoogleEventNotFound) {
+		return fmt.Errorf("failed to delete google calendar event: %w", err)
+	}
+	return nil
+}
+
+// GetMeetingInfo gets the event's Meet link
+func (g *GoogleMeetProvider) GetMeetingInfo(ctx context.Context, externalID string) (*MeetingDetails, error) {
+	var event calendarEvent
+	if err := g.do(ctx, http.MethodGet, g.eventsPath(externalID), nil, &event); err != nil {
+		return nil, fmt.Errorf("failed to get google calendar event: %w", err)
+	}
+	return event.details(), nil
+}
+
+// eventsPath returns the path of the organizer's calendar events, or of
+// one event
+func (g *GoogleMeetProvider) eventsPath(eventID string) string {
+	path := "/calendars/" + url.PathEscape(g.cfg.CalendarID) + "/events"
+	if eventID != "" {
+		path += "/" + url.PathEscape(eventID)
+	}
+	return path
+}
+
+// do calls the Calendar API with a JSON body and decodes the JSON response
+// into out, if given
+func (g *GoogleMeetProvider) do(ctx context.Context, method, path string, in, out interface{}) error {
+	token, err := g.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, g.cfg.APIURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		// The token was revoked or expired early; fetch a new one next time
+		g.mu.Lock()
+		g.token = ""
+		g.mu.Unlock()
+	}
+	// Deleted events are gone (410) rather than missing (404)
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return ErrGoogleEventNotFound
+	}
+	if resp.StatusCode >= 300 {
+		var gerr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&gerr)
+		return fmt.Errorf("google calendar API returned %d: %s", resp.StatusCode, gerr.Error.Message)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// accessToken returns the cached access token, exchanging a locally
+// signed JWT assertion for a new one when it is about to expire. The
+// assertion acts as the organizer through domain-wide delegation.
+func (g *GoogleMeetProvider) accessToken(ctx context.Context) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.token != "" && time.Now().Before(g.tokenExpiry.Add(-tokenRefreshMargin)) {
+		return g.token, nil
+	}
+	if g.cfg.PrivateKey == nil {
+		return "", ErrGoogleNotConfigured
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   g.cfg.ClientEmail,
+		"sub":   g.cfg.Subject,
+		"scope": googleEventsScope,
+		"aud":   g.cfg.TokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(g.cfg.PrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign google token assertion: %w", err)
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get google access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get google access token: status %d", resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"` // seconds
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode google access token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("google returned an empty access token")
+	}
+
+	g.token = token.AccessToken
+	g.tokenExpiry = now.Add(time.Duration(token.ExpiresIn) * time.Second)
+	return g.token, nil
+}
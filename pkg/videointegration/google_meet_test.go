@@ -0,0 +1,190 @@
+package videointegration
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeGoogle is a stand-in for Google's OAuth token endpoint and the
+// Calendar events API
+type fakeGoogle struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	tokens    atomic.Int32
+	events    map[string]*calendarEvent
+	lastQuery string
+}
+
+func newFakeGoogle(t *testing.T) *fakeGoogle {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	f := &fakeGoogle{key: key, events: make(map[string]*calendarEvent)}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(r.FormValue("assertion"), claims, func(*jwt.Token) (interface{}, error) {
+			return &key.PublicKey, nil
+		}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithAudience(f.server.URL+"/token"))
+		if err != nil || claims["iss"] != "vtp@project.iam.gserviceaccount.com" ||
+			claims["sub"] != "teacher@school.example" || claims["scope"] != googleEventsScope {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f.tokens.Add(1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "google-token", "expires_in": 3600})
+	})
+
+	authorized := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer google-token" || r.PathValue("calendar") != "primary" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			f.lastQuery = r.URL.RawQuery
+			next(w, r)
+		}
+	}
+	mux.HandleFunc("POST /calendar/v3/calendars/{calendar}/events", authorized(func(w http.ResponseWriter, r *http.Request) {
+		var event calendarEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		if event.ConferenceData == nil || event.ConferenceData.CreateRequest == nil ||
+			event.ConferenceData.CreateRequest.Solution.Type != "hangoutsMeet" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		event.ID = "evt1"
+		event.HangoutLink = "https://meet.google.com/abc-defg-hij"
+		f.events[event.ID] = &event
+		json.NewEncoder(w).Encode(event)
+	}))
+	mux.HandleFunc("PATCH /calendar/v3/calendars/{calendar}/events/{id}", authorized(func(w http.ResponseWriter, r *http.Request) {
+		event, ok := f.events[r.PathValue("id")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(event)
+		json.NewEncoder(w).Encode(event)
+	}))
+	mux.HandleFunc("GET /calendar/v3/calendars/{calendar}/events/{id}", authorized(func(w http.ResponseWriter, r *http.Request) {
+		event, ok := f.events[r.PathValue("id")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(event)
+	}))
+	mux.HandleFunc("DELETE /calendar/v3/calendars/{calendar}/events/{id}", authorized(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := f.events[r.PathValue("id")]; !ok {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		delete(f.events, r.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeGoogle) provider() *GoogleMeetProvider {
+	return NewGoogleMeetProvider(GoogleConfig{
+		ClientEmail: "vtp@project.iam.gserviceaccount.com",
+		PrivateKey:  f.key,
+		Subject:     "teacher@school.example",
+		APIURL:      f.server.URL + "/calendar/v3",
+		TokenURL:    f.server.URL + "/token",
+	}, nil)
+}
+
+// TestGoogleMeetLifecycle tests creating an event with a Meet conference
+// for enrolled students, moving it and cancelling it
+func TestGoogleMeetLifecycle(t *testing.T) {
+	f := newFakeGoogle(t)
+	g := f.provider()
+	ctx := context.Background()
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	settings := MeetingSettings{Attendees: []string{"a@school.example", "b@school.example"}}
+
+	details, err := g.CreateMeeting(ctx, "كيمياء", start, 45, settings)
+	if err != nil {
+		t.Fatalf("CreateMeeting failed: %v", err)
+	}
+	if details.ExternalID != "evt1" || details.MeetingLink != "https://meet.google.com/abc-defg-hij" {
+		t.Errorf("Unexpected meeting details: %+v", details)
+	}
+	if f.lastQuery != "conferenceDataVersion=1&sendUpdates=all" {
+		t.Errorf("Unexpected create query %q", f.lastQuery)
+	}
+	event := f.events["evt1"]
+	if len(event.Attendees) != 2 || event.Attendees[1].Email != "b@school.example" {
+		t.Errorf("Expected the students to be invited, got %+v", event.Attendees)
+	}
+	if event.End.DateTime != "2026-03-01T09:45:00Z" {
+		t.Errorf("Unexpected end %s", event.End.DateTime)
+	}
+
+	settings.Attendees = append(settings.Attendees, "c@school.example")
+	if err := g.UpdateMeeting(ctx, "evt1", "كيمياء", start.Add(24*time.Hour), 60, settings); err != nil {
+		t.Fatalf("UpdateMeeting failed: %v", err)
+	}
+	if event.Start.DateTime != "2026-03-02T09:00:00Z" || len(event.Attendees) != 3 || f.lastQuery != "sendUpdates=all" {
+		t.Errorf("Unexpected updated event %+v (query %q)", event, f.lastQuery)
+	}
+
+	info, err := g.GetMeetingInfo(ctx, "evt1")
+	if err != nil || info.MeetingLink != details.MeetingLink {
+		t.Errorf("Unexpected meeting info %+v: %v", info, err)
+	}
+
+	if err := g.DeleteMeeting(ctx, "evt1"); err != nil {
+		t.Fatalf("DeleteMeeting failed: %v", err)
+	}
+	if err := g.DeleteMeeting(ctx, "evt1"); err != nil {
+		t.Errorf("Expected deleting a cancelled event to succeed, got %v", err)
+	}
+	if len(f.events) != 0 {
+		t.Errorf("Expected the event to be deleted, got %v", f.events)
+	}
+
+	if n := f.tokens.Load(); n != 1 {
+		t.Errorf("Expected one access token request, got %d", n)
+	}
+}
+
+// TestGoogleMeetWrongKey tests that assertions signed with another key are
+// refused
+func TestGoogleMeetWrongKey(t *testing.T) {
+	f := newFakeGoogle(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	g := f.provider()
+	g.cfg.PrivateKey = other
+
+	if _, err := g.CreateMeeting(context.Background(), "x", time.Now(), 30, MeetingSettings{}); err == nil {
+		t.Fatal("Expected the token request to fail")
+	}
+	if len(f.events) != 0 {
+		t.Errorf("Expected no event, got %v", f.events)
+	}
+}
@@ -2,9 +2,14 @@ package videointegration
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"time"
 
+	"github.com/Bashar444/VTP/pkg/auth"
+	"github.com/Bashar444/VTP/pkg/course"
+	"github.com/Bashar444/VTP/pkg/router"
 	"github.com/Bashar444/VTP/pkg/utils"
 )
 
@@ -18,13 +23,32 @@ func NewHandler(service *Service) *Handler {
 	return &Handler{service: service}
 }
 
+// RegisterRoutes registers video integration routes. Join links are
+// available to meeting members; host links and changes to the integration
+// require a managing course role. Provider webhooks are authenticated by
+// their signatures.
+func (h *Handler) RegisterRoutes(rt *router.Router, am *auth.AuthMiddleware, authz *course.CourseAuthorizer) {
+	api := rt.With(am.Middleware)
+	member := authz.Require(authz.MeetingScope("id"), course.MemberRoles...)
+	manage := authz.Require(authz.MeetingScope("id"), course.ManageRoles...)
+
+	api.HandleFunc("GET /api/v1/video/providers", h.ListProviders)
+	api.HandleFunc("POST /api/v1/meetings/{id}/video", h.CreateIntegration, manage)
+	api.HandleFunc("GET /api/v1/meetings/{id}/video", h.GetIntegration, member)
+	api.HandleFunc("DELETE /api/v1/meetings/{id}/video", h.DeleteIntegration, manage)
+	api.HandleFunc("GET /api/v1/meetings/{id}/join", h.GetJoinLink, member)
+	api.HandleFunc("GET /api/v1/meetings/{id}/host", h.GetHostLink, manage)
+	rt.HandleFunc("POST /api/v1/video/zoom/webhook", h.ZoomWebhook)
+}
+
 // CreateIntegrationRequest represents the request to create a video integration
 type CreateIntegrationRequest struct {
-	MeetingID   string `json:"meeting_id"`
-	Provider    string `json:"provider"` // google_meet, zoom, jitsi, internal
-	Title       string `json:"title"`
-	ScheduledAt string `json:"scheduled_at"` // ISO 8601
-	Duration    int    `json:"duration"`     // minutes
+	MeetingID   string          `json:"meeting_id"`
+	Provider    string          `json:"provider"` // google_meet, zoom, jitsi, internal
+	Title       string          `json:"title"`
+	ScheduledAt string          `json:"scheduled_at"` // ISO 8601
+	Duration    int             `json:"duration"`     // minutes
+	Settings    MeetingSettings `json:"settings"`
 }
 
 // CreateIntegration handles POST /api/v1/meetings/{id}/video
@@ -58,10 +82,11 @@ func (h *Handler) CreateIntegration(w http.ResponseWriter, r *http.Request) {
 		req.Title,
 		scheduledAt,
 		req.Duration,
+		req.Settings,
 	)
 	if err != nil {
 		status := http.StatusBadRequest
-		if err == ErrInvalidProvider {
+		if err == ErrInvalidProvider || err == ErrUnsupportedRecording {
 			status = http.StatusBadRequest
 		}
 		utils.WriteErr(w, status, err)
@@ -99,12 +124,21 @@ func (h *Handler) GetJoinLink(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID, err := auth.GetUserID(r)
+	if err != nil {
+		utils.WriteErr(w, http.StatusUnauthorized, err)
+		return
+	}
+
 	meetingID := utils.Param(r, "id")
-	link, err := h.service.GetJoinLink(r.Context(), meetingID)
+	link, err := h.service.GetJoinLink(r.Context(), meetingID, userID)
 	if err != nil {
 		status := http.StatusInternalServerError
-		if err == ErrIntegrationNotFound {
+		switch {
+		case err == ErrIntegrationNotFound:
 			status = http.StatusNotFound
+		case err == ErrMeetingEnded:
+			status = http.StatusGone
 		}
 		utils.WriteErr(w, status, err)
 		return
@@ -129,12 +163,21 @@ func (h *Handler) GetHostLink(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID, err := auth.GetUserID(r)
+	if err != nil {
+		utils.WriteErr(w, http.StatusUnauthorized, err)
+		return
+	}
+
 	meetingID := utils.Param(r, "id")
-	link, err := h.service.GetHostLink(r.Context(), meetingID)
+	link, err := h.service.GetHostLink(r.Context(), meetingID, userID)
 	if err != nil {
 		status := http.StatusInternalServerError
-		if err == ErrIntegrationNotFound {
+		switch {
+		case err == ErrIntegrationNotFound:
 			status = http.StatusNotFound
+		case err == ErrMeetingEnded:
+			status = http.StatusGone
 		}
 		utils.WriteErr(w, status, err)
 		return
@@ -172,6 +215,34 @@ func (h *Handler) DeleteIntegration(w http.ResponseWriter, r *http.Request) {
 	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Integration deleted"})
 }
 
+// ZoomWebhook handles POST /api/v1/video/zoom/webhook
+func (h *Handler) ZoomWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		utils.WriteErr(w, http.StatusBadRequest, err)
+		return
+	}
+
+	resp, err := h.service.HandleZoomWebhook(r.Context(), r.Header, body)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ErrInvalidWebhook):
+			status = http.StatusUnauthorized
+		case errors.Is(err, ErrZoomNotConfigured):
+			status = http.StatusNotFound
+		}
+		utils.WriteErr(w, status, err)
+		return
+	}
+
+	if resp == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, resp)
+}
+
 // ListProviders handles GET /api/v1/video/providers
 func (h *Handler) ListProviders(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
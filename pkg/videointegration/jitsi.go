@@ -0,0 +1,173 @@
+package videointegration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrMeetingEnded = errors.New("meeting has ended")
+)
+
+const (
+	// jitsiJoinEarly is how long before its start a meeting can be joined
+	jitsiJoinEarly = 15 * time.Minute
+	// jitsiOverrun is how long after its scheduled end a meeting can still
+	// be joined
+	jitsiOverrun = 30 * time.Minute
+)
+
+// JitsiProvider implements VideoProvider for Jitsi Meet. With an app ID
+// and secret, as configured for a self-hosted server's token
+// authentication, rooms only admit holders of personal links signed for
+// the meeting's time.
+type JitsiProvider struct {
+	serverURL string
+	appID     string
+	appSecret string
+	logger    *slog.Logger
+}
+
+// NewJitsiProvider creates a new Jitsi provider
+func NewJitsiProvider(serverURL string, logger *slog.Logger) *JitsiProvider {
+	if serverURL == "" {
+		serverURL = "https://meet.jit.si" // Public Jitsi server
+	}
+	return &JitsiProvider{
+		serverURL: strings.TrimSuffix(serverURL, "/"),
+		logger:    logger,
+	}
+}
+
+// WithJWT secures rooms with tokens signed by the app secret shared with
+// the Jitsi server
+func (j *JitsiProvider) WithJWT(appID, appSecret string) *JitsiProvider {
+	j.appID = appID
+	j.appSecret = appSecret
+	return j
+}
+
+// CreateMeeting creates a Jitsi meeting (Jitsi creates rooms on-demand)
+func (j *JitsiProvider) CreateMeeting(ctx context.Context, title string, scheduledAt time.Time, duration int, settings MeetingSettings) (*MeetingDetails, error) {
+	// Jitsi uses room names - we generate a unique one
+	roomID := fmt.Sprintf("vtp-%s", uuid.New().String()[:8])
+	meetingLink := fmt.Sprintf("%s/%s", j.serverURL, roomID)
+
+	return &MeetingDetails{
+		ExternalID:  roomID,
+		MeetingLink: meetingLink,
+		HostLink:    meetingLink, // Same for Jitsi
+		JoinURL:     meetingLink,
+	}, nil
+}
+
+// UpdateMeeting updates a Jitsi meeting (no-op for Jitsi)
+func (j *JitsiProvider) UpdateMeeting(ctx context.Context, externalID string, title string, scheduledAt time.Time, duration int, settings MeetingSettings) error {
+	// Jitsi rooms are ephemeral, no update needed; links are signed for
+	// the meeting's time when requested
+	return nil
+}
+
+// DeleteMeeting deletes a Jitsi meeting (no-op for Jitsi)
+func (j *JitsiProvider) DeleteMeeting(ctx context.Context, externalID string) error {
+	// Jitsi rooms are ephemeral
+	return nil
+}
+
+// GetMeetingInfo gets Jitsi meeting info
+func (j *JitsiProvider) GetMeetingInfo(ctx context.Context, externalID string) (*MeetingDetails, error) {
+	meetingLink := fmt.Sprintf("%s/%s", j.serverURL, externalID)
+	return &MeetingDetails{
+		ExternalID:  externalID,
+		MeetingLink: meetingLink,
+		HostLink:    meetingLink,
+		JoinURL:     meetingLink,
+	}, nil
+}
+
+// jitsiClaims are the claims of a Jitsi token
+type jitsiClaims struct {
+	Room      string       `json:"room"`
+	Context   jitsiContext `json:"context"`
+	Moderator bool         `json:"moderator"`
+	jwt.RegisteredClaims
+}
+
+type jitsiContext struct {
+	User jitsiUser `json:"user"`
+	Room struct {
+		Lobby bool `json:"lobby"`
+	} `json:"room"`
+}
+
+type jitsiUser struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Email       string `json:"email,omitempty"`
+	Avatar      string `json:"avatar,omitempty"`
+	Moderator   bool   `json:"moderator"`
+	LobbyBypass bool   `json:"lobby_bypass"`
+}
+
+// PersonalLink returns a participant's link to a room. When rooms are
+// secured, the link carries a token valid from shortly before the meeting
+// until shortly after its end. Moderators bypass the lobby and admit
+// everyone else, whose clients knock on joining.
+func (j *JitsiProvider) PersonalLink(ctx context.Context, externalID string, p Participant, moderator bool, start, end time.Time) (string, error) {
+	link := fmt.Sprintf("%s/%s", j.serverURL, externalID)
+	if j.appSecret == "" {
+		return link, nil
+	}
+
+	notBefore := start.Add(-jitsiJoinEarly)
+	expires := end.Add(jitsiOverrun)
+	if !time.Now().Before(expires) {
+		return "", ErrMeetingEnded
+	}
+
+	host := j.serverURL
+	if u, err := url.Parse(j.serverURL); err == nil && u.Host != "" {
+		host = u.Hostname()
+	}
+
+	claims := jitsiClaims{
+		Room:      strings.ToLower(externalID),
+		Moderator: moderator,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    j.appID,
+			Subject:   host,
+			Audience:  jwt.ClaimStrings{"jitsi"},
+			NotBefore: jwt.NewNumericDate(notBefore),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	}
+	claims.Context.User = jitsiUser{
+		ID:          p.UserID,
+		Name:        p.Name,
+		Email:       p.Email,
+		Avatar:      p.Avatar,
+		Moderator:   moderator,
+		LobbyBypass: moderator,
+	}
+	claims.Context.Room.Lobby = true
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(j.appSecret))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign jitsi token: %w", err)
+	}
+
+	link += "?jwt=" + url.QueryEscape(token)
+	if !moderator {
+		link += "#config.lobby.autoKnock=true"
+	}
+	return link, nil
+}
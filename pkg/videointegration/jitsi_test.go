@@ -0,0 +1,85 @@
+package videointegration
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// parseJitsiLink returns the verified claims of a personal link's token
+func parseJitsiLink(t *testing.T, link, secret string) *jitsiClaims {
+	t.Helper()
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("Invalid link %q: %v", link, err)
+	}
+	claims := &jitsiClaims{}
+	_, err = jwt.ParseWithClaims(u.Query().Get("jwt"), claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithAudience("jitsi"))
+	if err != nil {
+		t.Fatalf("Invalid token in %q: %v", link, err)
+	}
+	return claims
+}
+
+// TestJitsiPersonalLinks tests that hosts and students get tokens for the
+// room with their identity, role and the meeting's time
+func TestJitsiPersonalLinks(t *testing.T) {
+	j := NewJitsiProvider("https://meet.school.example/", nil).WithJWT("vtp", "shared-secret")
+	ctx := context.Background()
+	start := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	end := start.Add(45 * time.Minute)
+	teacher := Participant{UserID: "u1", Name: "أحمد", Email: "ahmad@school.example", Avatar: "https://cdn.example/a.png"}
+	student := Participant{UserID: "u2", Name: "سارة", Email: "sara@school.example"}
+
+	host, err := j.PersonalLink(ctx, "vtp-AB12", teacher, true, start, end)
+	if err != nil {
+		t.Fatalf("PersonalLink failed: %v", err)
+	}
+	if !strings.HasPrefix(host, "https://meet.school.example/vtp-AB12?jwt=") || strings.Contains(host, "autoKnock") {
+		t.Errorf("Unexpected host link %q", host)
+	}
+	claims := parseJitsiLink(t, host, "shared-secret")
+	if claims.Room != "vtp-ab12" || claims.Issuer != "vtp" || claims.Subject != "meet.school.example" {
+		t.Errorf("Unexpected claims %+v", claims)
+	}
+	if !claims.Moderator || !claims.Context.User.Moderator || !claims.Context.User.LobbyBypass ||
+		claims.Context.User.Name != "أحمد" || claims.Context.User.Avatar != "https://cdn.example/a.png" {
+		t.Errorf("Unexpected host user %+v", claims.Context.User)
+	}
+	if !claims.NotBefore.Time.Equal(start.Add(-jitsiJoinEarly)) || !claims.ExpiresAt.Time.Equal(end.Add(jitsiOverrun)) {
+		t.Errorf("Unexpected validity %v - %v", claims.NotBefore, claims.ExpiresAt)
+	}
+
+	join, err := j.PersonalLink(ctx, "vtp-AB12", student, false, start, end)
+	if err != nil {
+		t.Fatalf("PersonalLink failed: %v", err)
+	}
+	if !strings.HasSuffix(join, "#config.lobby.autoKnock=true") {
+		t.Errorf("Expected students to knock on the lobby, got %q", join)
+	}
+	claims = parseJitsiLink(t, join, "shared-secret")
+	if claims.Moderator || claims.Context.User.LobbyBypass || !claims.Context.Room.Lobby || claims.Context.User.Email != "sara@school.example" {
+		t.Errorf("Unexpected student claims %+v", claims)
+	}
+
+	past := time.Now().Add(-3 * time.Hour)
+	if _, err := j.PersonalLink(ctx, "vtp-AB12", student, false, past, past.Add(time.Hour)); !errors.Is(err, ErrMeetingEnded) {
+		t.Errorf("Expected ErrMeetingEnded, got %v", err)
+	}
+}
+
+// TestJitsiOpenRooms tests that without a secret links are plain room URLs
+func TestJitsiOpenRooms(t *testing.T) {
+	j := NewJitsiProvider("", nil)
+	link, err := j.PersonalLink(context.Background(), "vtp-1", Participant{UserID: "u1"}, true, time.Now(), time.Now())
+	if err != nil || link != "https://meet.jit.si/vtp-1" {
+		t.Errorf("Expected an open room link, got %q (%v)", link, err)
+	}
+}
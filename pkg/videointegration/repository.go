@@ -103,3 +103,89 @@ func (r *Repository) Delete(ctx context.Context, id string) error {
 	_, err := r.db.ExecContext(ctx, query, id)
 	return err
 }
+
+// GetByExternalID retrieves the integration of a provider's meeting
+func (r *Repository) GetByExternalID(ctx context.Context, provider Provider, externalID string) (*models.MeetingIntegration, error) {
+	query := `
+		SELECT id, meeting_id, provider, external_meeting_id, meeting_link,
+			host_link, password, settings, created_at, updated_at
+		FROM meeting_integrations WHERE provider = $1 AND external_meeting_id = $2
+	`
+	var mi models.MeetingIntegration
+	err := r.db.QueryRowContext(ctx, query, provider, externalID).Scan(
+		&mi.ID, &mi.MeetingID, &mi.Provider, &mi.ExternalMeetingID, &mi.MeetingLink,
+		&mi.HostLink, &mi.Password, &mi.Settings, &mi.CreatedAt, &mi.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrIntegrationNotFound
+	}
+	return &mi, err
+}
+
+// UserIDByEmail returns the ID of the user with an email address, or ""
+// if there is none
+func (r *Repository) UserIDByEmail(ctx context.Context, email string) (string, error) {
+	var id string
+	err := r.db.QueryRowContext(ctx, `SELECT id FROM users WHERE LOWER(email) = LOWER($1)`, email).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return id, err
+}
+
+// AttendeeEmails returns the email addresses of a meeting's students: its
+// one-on-one student or the students enrolled in its course
+func (r *Repository) AttendeeEmails(ctx context.Context, meetingID string) ([]string, error) {
+	query := `
+		SELECT DISTINCT u.email
+		FROM meetings m
+		JOIN users u ON u.id = m.student_id
+			OR u.id IN (SELECT student_id FROM course_enrollments WHERE course_id = m.course_id AND status = 'active')
+		WHERE m.id = $1 AND u.email <> ''
+		ORDER BY u.email
+	`
+	rows, err := r.db.QueryContext(ctx, query, meetingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+		emails = append(emails, email)
+	}
+	return emails, rows.Err()
+}
+
+// Participant returns the user a personal meeting link is issued to. The
+// avatar is the profile image of instructors.
+func (r *Repository) Participant(ctx context.Context, userID string) (*Participant, error) {
+	query := `
+		SELECT u.id, COALESCE(u.full_name, ''), u.email, COALESCE(i.profile_image_url, '')
+		FROM users u
+		LEFT JOIN instructors i ON i.user_id = u.id
+		WHERE u.id = $1
+	`
+	var p Participant
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&p.UserID, &p.Name, &p.Email, &p.Avatar)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// MeetingTimes returns when a meeting starts and ends: when it was
+// completed, or else its scheduled end
+func (r *Repository) MeetingTimes(ctx context.Context, meetingID string) (time.Time, time.Time, error) {
+	query := `
+		SELECT scheduled_at, COALESCE(end_time, scheduled_at + duration * INTERVAL '1 minute')
+		FROM meetings WHERE id = $1
+	`
+	var start, end time.Time
+	err := r.db.QueryRowContext(ctx, query, meetingID).Scan(&start, &end)
+	return start, end, err
+}
@@ -2,9 +2,11 @@ package videointegration
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"time"
 
 	"github.com/Bashar444/VTP/pkg/models"
@@ -18,132 +20,71 @@ var (
 
 // VideoProvider interface for video conferencing providers
 type VideoProvider interface {
-	CreateMeeting(ctx context.Context, title string, scheduledAt time.Time, duration int) (*MeetingDetails, error)
-	UpdateMeeting(ctx context.Context, externalID string, title string, scheduledAt time.Time) error
+	CreateMeeting(ctx context.Context, title string, scheduledAt time.Time, duration int, settings MeetingSettings) (*MeetingDetails, error)
+	UpdateMeeting(ctx context.Context, externalID string, title string, scheduledAt time.Time, duration int, settings MeetingSettings) error
 	DeleteMeeting(ctx context.Context, externalID string) error
 	GetMeetingInfo(ctx context.Context, externalID string) (*MeetingDetails, error)
 }
 
-// MeetingDetails holds provider meeting details
-type MeetingDetails struct {
-	ExternalID  string
-	MeetingLink string
-	HostLink    string
-	Password    string
-	JoinURL     string
+// PersonalLinker is implemented by providers that give every participant
+// their own link to a meeting, valid between its start and end
+type PersonalLinker interface {
+	PersonalLink(ctx context.Context, externalID string, p Participant, moderator bool, start, end time.Time) (string, error)
 }
 
-// JitsiProvider implements VideoProvider for Jitsi Meet
-type JitsiProvider struct {
-	serverURL string
-	logger    *log.Logger
+// Participant is the user a personal link is issued to
+type Participant struct {
+	UserID string
+	Name   string
+	Email  string
+	Avatar string
 }
 
-// NewJitsiProvider creates a new Jitsi provider
-func NewJitsiProvider(serverURL string, logger *log.Logger) *JitsiProvider {
-	if serverURL == "" {
-		serverURL = "https://meet.jit.si" // Public Jitsi server
-	}
-	return &JitsiProvider{
-		serverURL: serverURL,
-		logger:    logger,
-	}
+// MeetingSettings are the meeting options stored in
+// MeetingIntegration.Settings. Providers apply those they support.
+type MeetingSettings struct {
+	Passcode       string `json:"passcode,omitempty"`
+	WaitingRoom    bool   `json:"waiting_room"`
+	JoinBeforeHost bool   `json:"join_before_host"`
+	MuteUponEntry  bool   `json:"mute_upon_entry"`
+	AutoRecording  string `json:"auto_recording,omitempty"` // none, local or cloud
+
+	// Attendees are the emails of the meeting's students when the
+	// provider is called. They are looked up each time, not stored.
+	Attendees []string `json:"-"`
 }
 
-// CreateMeeting creates a Jitsi meeting (Jitsi creates rooms on-demand)
-func (j *JitsiProvider) CreateMeeting(ctx context.Context, title string, scheduledAt time.Time, duration int) (*MeetingDetails, error) {
-	// Jitsi uses room names - we generate a unique one
-	roomID := fmt.Sprintf("vtp-%s", uuid.New().String()[:8])
-	meetingLink := fmt.Sprintf("%s/%s", j.serverURL, roomID)
-
-	return &MeetingDetails{
-		ExternalID:  roomID,
-		MeetingLink: meetingLink,
-		HostLink:    meetingLink, // Same for Jitsi
-		JoinURL:     meetingLink,
-	}, nil
-}
-
-// UpdateMeeting updates a Jitsi meeting (no-op for Jitsi)
-func (j *JitsiProvider) UpdateMeeting(ctx context.Context, externalID string, title string, scheduledAt time.Time) error {
-	// Jitsi rooms are ephemeral, no update needed
-	return nil
-}
-
-// DeleteMeeting deletes a Jitsi meeting (no-op for Jitsi)
-func (j *JitsiProvider) DeleteMeeting(ctx context.Context, externalID string) error {
-	// Jitsi rooms are ephemeral
-	return nil
-}
-
-// GetMeetingInfo gets Jitsi meeting info
-func (j *JitsiProvider) GetMeetingInfo(ctx context.Context, externalID string) (*MeetingDetails, error) {
-	meetingLink := fmt.Sprintf("%s/%s", j.serverURL, externalID)
-	return &MeetingDetails{
-		ExternalID:  externalID,
-		MeetingLink: meetingLink,
-		HostLink:    meetingLink,
-		JoinURL:     meetingLink,
-	}, nil
-}
-
-// GoogleMeetProvider implements VideoProvider for Google Meet
-// Note: Full implementation requires Google Calendar API credentials
-type GoogleMeetProvider struct {
-	// In production, add Google API client
-	logger *log.Logger
-}
-
-// NewGoogleMeetProvider creates a new Google Meet provider
-func NewGoogleMeetProvider(logger *log.Logger) *GoogleMeetProvider {
-	return &GoogleMeetProvider{logger: logger}
-}
-
-// CreateMeeting creates a Google Meet meeting
-func (g *GoogleMeetProvider) CreateMeeting(ctx context.Context, title string, scheduledAt time.Time, duration int) (*MeetingDetails, error) {
-	// TODO: Implement with Google Calendar API
-	// This requires OAuth2 setup and Google Workspace integration
-	// For now, return a placeholder
-	meetID := fmt.Sprintf("meet.google.com/%s", uuid.New().String()[:12])
-	return &MeetingDetails{
-		ExternalID:  meetID,
-		MeetingLink: "https://" + meetID,
-		HostLink:    "https://" + meetID,
-		JoinURL:     "https://" + meetID,
-	}, nil
-}
-
-// UpdateMeeting updates a Google Meet meeting
-func (g *GoogleMeetProvider) UpdateMeeting(ctx context.Context, externalID string, title string, scheduledAt time.Time) error {
-	// TODO: Implement with Google Calendar API
-	return nil
-}
-
-// DeleteMeeting deletes a Google Meet meeting
-func (g *GoogleMeetProvider) DeleteMeeting(ctx context.Context, externalID string) error {
-	// TODO: Implement with Google Calendar API
-	return nil
+// parseSettings reads stored integration settings, ignoring invalid ones
+func parseSettings(raw string) MeetingSettings {
+	var settings MeetingSettings
+	if raw != "" {
+		_ = json.Unmarshal([]byte(raw), &settings)
+	}
+	return settings
 }
 
-// GetMeetingInfo gets Google Meet info
-func (g *GoogleMeetProvider) GetMeetingInfo(ctx context.Context, externalID string) (*MeetingDetails, error) {
-	return &MeetingDetails{
-		ExternalID:  externalID,
-		MeetingLink: "https://" + externalID,
-		HostLink:    "https://" + externalID,
-		JoinURL:     "https://" + externalID,
-	}, nil
+// MeetingDetails holds provider meeting details
+type MeetingDetails struct {
+	ExternalID  string
+	MeetingLink string
+	HostLink    string
+	Password    string
+	JoinURL     string
 }
 
 // Service handles video integration business logic
 type Service struct {
 	repo      *Repository
 	providers map[Provider]VideoProvider
-	logger    *log.Logger
+	logger    *slog.Logger
+	onEvent   func(ctx context.Context, event MeetingEvent)
 }
 
 // NewService creates a new video integration service
-func NewService(repo *Repository, logger *log.Logger) *Service {
+func NewService(repo *Repository, logger *slog.Logger) *Service {
+	if logger == nil {
+		logger = slog.Default().With("component", "video_integration")
+	}
 	return &Service{
 		repo:      repo,
 		providers: make(map[Provider]VideoProvider),
@@ -156,8 +97,14 @@ func (s *Service) RegisterProvider(provider Provider, impl VideoProvider) {
 	s.providers[provider] = impl
 }
 
+// OnEvent registers a function called for meeting events reported by
+// providers, such as a meeting ending or a participant joining
+func (s *Service) OnEvent(fn func(ctx context.Context, event MeetingEvent)) {
+	s.onEvent = fn
+}
+
 // CreateMeetingIntegration creates a meeting with the specified provider
-func (s *Service) CreateMeetingIntegration(ctx context.Context, meetingID string, provider Provider, title string, scheduledAt time.Time, duration int) (*models.MeetingIntegration, error) {
+func (s *Service) CreateMeetingIntegration(ctx context.Context, meetingID string, provider Provider, title string, scheduledAt time.Time, duration int, settings MeetingSettings) (*models.MeetingIntegration, error) {
 	if meetingID == "" {
 		return nil, ErrMeetingIDRequired
 	}
@@ -173,7 +120,21 @@ func (s *Service) CreateMeetingIntegration(ctx context.Context, meetingID string
 	}
 
 	// Create meeting with provider
-	details, err := providerImpl.CreateMeeting(ctx, title, scheduledAt, duration)
+	attendees, err := s.repo.AttendeeEmails(ctx, meetingID)
+	if err != nil {
+		return nil, err
+	}
+	settings.Attendees = attendees
+	details, err := providerImpl.CreateMeeting(ctx, title, scheduledAt, duration, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	// The provider may have generated a passcode
+	if details.Password != "" {
+		settings.Passcode = details.Password
+	}
+	settingsJSON, err := json.Marshal(settings)
 	if err != nil {
 		return nil, err
 	}
@@ -185,7 +146,7 @@ func (s *Service) CreateMeetingIntegration(ctx context.Context, meetingID string
 		MeetingLink:       details.MeetingLink,
 		HostLink:          details.HostLink,
 		Password:          details.Password,
-		Settings:          "{}",
+		Settings:          string(settingsJSON),
 	}
 
 	if err := s.repo.Create(ctx, mi); err != nil {
@@ -233,8 +194,8 @@ func (s *Service) GetMeetingIntegration(ctx context.Context, meetingID string) (
 	return s.repo.GetByMeetingID(ctx, meetingID)
 }
 
-// UpdateMeetingIntegration updates a meeting integration
-func (s *Service) UpdateMeetingIntegration(ctx context.Context, meetingID string, title string, scheduledAt time.Time) error {
+// UpdateMeetingIntegration moves or renames the provider's meeting
+func (s *Service) UpdateMeetingIntegration(ctx context.Context, meetingID string, title string, scheduledAt time.Time, duration int) error {
 	mi, err := s.repo.GetByMeetingID(ctx, meetingID)
 	if err != nil {
 		return err
@@ -243,8 +204,13 @@ func (s *Service) UpdateMeetingIntegration(ctx context.Context, meetingID string
 	provider := Provider(mi.Provider)
 	providerImpl, ok := s.providers[provider]
 	if ok {
-		if err := providerImpl.UpdateMeeting(ctx, mi.ExternalMeetingID, title, scheduledAt); err != nil {
-			s.logger.Printf("Failed to update external meeting: %v", err)
+		settings := parseSettings(mi.Settings)
+		settings.Attendees, err = s.repo.AttendeeEmails(ctx, meetingID)
+		if err != nil {
+			return err
+		}
+		if err := providerImpl.UpdateMeeting(ctx, mi.ExternalMeetingID, title, scheduledAt, duration, settings); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to update external meeting", "meeting_id", meetingID, "provider", provider, "error", err)
 		}
 	}
 
@@ -262,30 +228,127 @@ func (s *Service) DeleteMeetingIntegration(ctx context.Context, meetingID string
 	providerImpl, ok := s.providers[provider]
 	if ok {
 		if err := providerImpl.DeleteMeeting(ctx, mi.ExternalMeetingID); err != nil {
-			s.logger.Printf("Failed to delete external meeting: %v", err)
+			s.logger.ErrorContext(ctx, "Failed to delete external meeting", "meeting_id", meetingID, "provider", provider, "error", err)
 		}
 	}
 
 	return s.repo.Delete(ctx, mi.ID)
 }
 
-// GetJoinLink returns the participant join link
-func (s *Service) GetJoinLink(ctx context.Context, meetingID string) (string, error) {
+// GetJoinLink returns the participant join link. Providers that issue
+// personal links, such as secured Jitsi rooms, sign one for the user.
+func (s *Service) GetJoinLink(ctx context.Context, meetingID, userID string) (string, error) {
 	mi, err := s.repo.GetByMeetingID(ctx, meetingID)
 	if err != nil {
 		return "", err
 	}
+	if linker, ok := s.providers[Provider(mi.Provider)].(PersonalLinker); ok {
+		return s.personalLink(ctx, linker, mi, userID, false)
+	}
 	return mi.MeetingLink, nil
 }
 
-// GetHostLink returns the host/teacher join link
-func (s *Service) GetHostLink(ctx context.Context, meetingID string) (string, error) {
+// GetHostLink returns the host/teacher join link. Providers whose host
+// links expire, such as Zoom's start URL, are asked for a current one;
+// providers that issue personal links sign a moderator link for the user.
+func (s *Service) GetHostLink(ctx context.Context, meetingID, userID string) (string, error) {
 	mi, err := s.repo.GetByMeetingID(ctx, meetingID)
 	if err != nil {
 		return "", err
 	}
+	providerImpl, ok := s.providers[Provider(mi.Provider)]
+	if linker, isLinker := providerImpl.(PersonalLinker); isLinker {
+		return s.personalLink(ctx, linker, mi, userID, true)
+	}
+	if ok {
+		details, err := providerImpl.GetMeetingInfo(ctx, mi.ExternalMeetingID)
+		if err != nil {
+			s.logger.WarnContext(ctx, "Failed to refresh host link", "meeting_id", meetingID, "provider", mi.Provider, "error", err)
+		} else if details.HostLink != "" && details.HostLink != mi.HostLink {
+			mi.HostLink = details.HostLink
+			if err := s.repo.Update(ctx, mi); err != nil {
+				return "", err
+			}
+		}
+	}
 	if mi.HostLink != "" {
 		return mi.HostLink, nil
 	}
 	return mi.MeetingLink, nil
 }
+
+// personalLink signs a user's link to an integration's meeting for the
+// meeting's scheduled time
+func (s *Service) personalLink(ctx context.Context, linker PersonalLinker, mi *models.MeetingIntegration, userID string, moderator bool) (string, error) {
+	participant, err := s.repo.Participant(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	start, end, err := s.repo.MeetingTimes(ctx, mi.MeetingID)
+	if err != nil {
+		return "", err
+	}
+	return linker.PersonalLink(ctx, mi.ExternalMeetingID, *participant, moderator, start, end)
+}
+
+// Meeting event types reported by providers
+const (
+	EventMeetingStarted    = "meeting_started"
+	EventMeetingEnded      = "meeting_ended"
+	EventParticipantJoined = "participant_joined"
+	EventParticipantLeft   = "participant_left"
+)
+
+// MeetingEvent is something a provider reports about a meeting
+type MeetingEvent struct {
+	Type            string
+	Provider        Provider
+	MeetingID       string // VTP meeting
+	ExternalID      string // provider's meeting
+	ParticipantID   string // provider's participant, unique per connection
+	ParticipantName string
+	Email           string
+	UserID          string // VTP user with the participant's email, if any
+	At              time.Time
+}
+
+// HandleZoomWebhook verifies and handles a Zoom webhook. It returns the
+// response body Zoom expects, which is only set for URL validation.
+// Events of meetings without an integration are ignored.
+func (s *Service) HandleZoomWebhook(ctx context.Context, header http.Header, body []byte) (interface{}, error) {
+	zoom, ok := s.providers[ProviderZoom].(*ZoomProvider)
+	if !ok {
+		return nil, ErrZoomNotConfigured
+	}
+	hook, err := zoom.VerifyWebhook(header, body)
+	if err != nil {
+		return nil, err
+	}
+	if hook.Event == ZoomEventURLValidation {
+		return zoom.ValidationResponse(hook.Payload.PlainToken), nil
+	}
+
+	event, ok := hook.event()
+	if !ok || s.onEvent == nil {
+		return nil, nil
+	}
+	mi, err := s.repo.GetByExternalID(ctx, ProviderZoom, event.ExternalID)
+	if errors.Is(err, ErrIntegrationNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	event.MeetingID = mi.MeetingID
+
+	if event.Email != "" {
+		userID, err := s.repo.UserIDByEmail(ctx, event.Email)
+		if err != nil {
+			return nil, err
+		}
+		event.UserID = userID
+	}
+
+	s.onEvent(ctx, event)
+	return nil, nil
+}
@@ -0,0 +1,424 @@
+package videointegration
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrZoomNotConfigured    = errors.New("zoom is not configured")
+	ErrInvalidWebhook       = errors.New("invalid webhook signature")
+	ErrZoomMeetingNotFound  = errors.New("zoom meeting not found")
+	ErrUnsupportedRecording = errors.New("auto recording must be none, local or cloud")
+)
+
+const (
+	zoomAPIURL   = "https://api.zoom.us/v2"
+	zoomOAuthURL = "https://zoom.us/oauth/token"
+
+	// tokenRefreshMargin renews an access token this long before it expires
+	tokenRefreshMargin = time.Minute
+	// webhookMaxAge rejects webhook deliveries signed longer ago, which
+	// stops replays of captured requests
+	webhookMaxAge = 5 * time.Minute
+)
+
+// Zoom webhook events
+const (
+	ZoomEventURLValidation     = "endpoint.url_validation"
+	ZoomEventMeetingStarted    = "meeting.started"
+	ZoomEventMeetingEnded      = "meeting.ended"
+	ZoomEventParticipantJoined = "meeting.participant_joined"
+	ZoomEventParticipantLeft   = "meeting.participant_left"
+)
+
+// ZoomConfig configures a Zoom Server-to-Server OAuth app
+type ZoomConfig struct {
+	AccountID     string
+	ClientID      string
+	ClientSecret  string
+	WebhookSecret string // secret token of the app's event subscription
+	HostUser      string // user ID or email meetings are created for, "me" by default
+	APIURL        string // overrides the REST API, for tests
+	OAuthURL      string // overrides the token endpoint, for tests
+}
+
+// ZoomConfigFromEnv reads the Zoom app from ZOOM_* environment variables
+func ZoomConfigFromEnv() (ZoomConfig, error) {
+	cfg := ZoomConfig{
+		AccountID:     os.Getenv("ZOOM_ACCOUNT_ID"),
+		ClientID:      os.Getenv("ZOOM_CLIENT_ID"),
+		ClientSecret:  os.Getenv("ZOOM_CLIENT_SECRET"),
+		WebhookSecret: os.Getenv("ZOOM_WEBHOOK_SECRET"),
+		HostUser:      os.Getenv("ZOOM_HOST_USER"),
+	}
+	if cfg.AccountID == "" || cfg.ClientID == "" || cfg.ClientSecret == "" {
+		return cfg, ErrZoomNotConfigured
+	}
+	return cfg, nil
+}
+
+// ZoomProvider implements VideoProvider for Zoom using a Server-to-Server
+// OAuth app. Access tokens are cached until shortly before they expire.
+type ZoomProvider struct {
+	cfg        ZoomConfig
+	httpClient *http.Client
+	logger     *slog.Logger
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewZoomProvider creates a new Zoom provider
+func NewZoomProvider(cfg ZoomConfig, logger *slog.Logger) *ZoomProvider {
+	if cfg.APIURL == "" {
+		cfg.APIURL = zoomAPIURL
+	}
+	if cfg.OAuthURL == "" {
+		cfg.OAuthURL = zoomOAuthURL
+	}
+	if cfg.HostUser == "" {
+		cfg.HostUser = "me"
+	}
+	return &ZoomProvider{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+		logger:     logger,
+	}
+}
+
+// zoomSettings are the settings of a Zoom meeting
+type zoomSettings struct {
+	WaitingRoom    bool   `json:"waiting_room"`
+	JoinBeforeHost bool   `json:"join_before_host"`
+	MuteUponEntry  bool   `json:"mute_upon_entry"`
+	AutoRecording  string `json:"auto_recording,omitempty"`
+}
+
+// zoomMeeting is a Zoom meeting as created, updated and returned by the API
+type zoomMeeting struct {
+	ID        int64         `json:"id,omitempty"`
+	Topic     string        `json:"topic,omitempty"`
+	Type      int           `json:"type,omitempty"` // 2 is a scheduled meeting
+	StartTime string        `json:"start_time,omitempty"`
+	Duration  int           `json:"duration,omitempty"`
+	Timezone  string        `json:"timezone,omitempty"`
+	Password  string        `json:"password,omitempty"`
+	JoinURL   string        `json:"join_url,omitempty"`
+	StartURL  string        `json:"start_url,omitempty"`
+	Settings  *zoomSettings `json:"settings,omitempty"`
+}
+
+// zoomError is an error response of the Zoom API
+type zoomError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func newZoomMeeting(title string, scheduledAt time.Time, duration int, settings MeetingSettings) (*zoomMeeting, error) {
+	switch settings.AutoRecording {
+	case "", "none", "local", "cloud":
+	default:
+		return nil, ErrUnsupportedRecording
+	}
+	return &zoomMeeting{
+		Topic:     title,
+		Type:      2,
+		StartTime: scheduledAt.UTC().Format("2006-01-02T15:04:05Z"),
+		Duration:  duration,
+		Timezone:  "UTC",
+		Password:  settings.Passcode,
+		Settings: &zoomSettings{
+			WaitingRoom:    settings.WaitingRoom,
+			JoinBeforeHost: settings.JoinBeforeHost,
+			MuteUponEntry:  settings.MuteUponEntry,
+			AutoRecording:  settings.AutoRecording,
+		},
+	}, nil
+}
+
+// details returns what VTP keeps of a Zoom meeting. Students join with the
+// join URL; the start URL makes its holder the host.
+func (m *zoomMeeting) details() *MeetingDetails {
+	return &MeetingDetails{
+		ExternalID:  strconv.FormatInt(m.ID, 10),
+		MeetingLink: m.JoinURL,
+		HostLink:    m.StartURL,
+		Password:    m.Password,
+		JoinURL:     m.JoinURL,
+	}
+}
+
+// CreateMeeting schedules a Zoom meeting for the host user
+func (z *ZoomProvider) CreateMeeting(ctx context.Context, title string, scheduledAt time.Time, duration int, settings MeetingSettings) (*MeetingDetails, error) {
+	req, err := newZoomMeeting(title, scheduledAt, duration, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	var created zoomMeeting
+	path := "/users/" + url.PathEscape(z.cfg.HostUser) + "/meetings"
+	if err := z.do(ctx, http.MethodPost, path, req, &created); err != nil {
+		return nil, fmt.Errorf("failed to create zoom meeting: %w", err)
+	}
+	return created.details(), nil
+}
+
+// UpdateMeeting moves, renames or reconfigures a Zoom meeting
+func (z *ZoomProvider) UpdateMeeting(ctx context.Context, externalID string, title string, scheduledAt time.Time, duration int, settings MeetingSettings) error {
+	req, err := newZoomMeeting(title, scheduledAt, duration, settings)
+	if err != nil {
+		return err
+	}
+
+	if err := z.do(ctx, http.MethodPatch, "/meetings/"+url.PathEscape(externalID), req, nil); err != nil {
+		return fmt.Errorf("failed to update zoom meeting: %w", err)
+	}
+	return nil
+}
+
+// DeleteMeeting deletes a Zoom meeting. A meeting already gone is not an
+// error.
+func (z *ZoomProvider) DeleteMeeting(ctx context.Context, externalID string) error {
+	err := z.do(ctx, http.MethodDelete, "/meetings/"+url.PathEscape(externalID), nil, nil)
+	if err != nil && !errors.Is(err, ErrZoomMeetingNotFound) {
+		return fmt.Errorf("failed to delete zoom meeting: %w", err)
+	}
+	return nil
+}
+
+// GetMeetingInfo gets a Zoom meeting, including a current start URL
+func (z *ZoomProvider) GetMeetingInfo(ctx context.Context, externalID string) (*MeetingDetails, error) {
+	var m zoomMeeting
+	if err := z.do(ctx, http.MethodGet, "/meetings/"+url.PathEscape(externalID), nil, &m); err != nil {
+		return nil, fmt.Errorf("failed to get zoom meeting: %w", err)
+	}
+	return m.details(), nil
+}
+
+// do calls the Zoom API with a JSON body and decodes the JSON response
+// into out, if given
+func (z *ZoomProvider) do(ctx context.Context, method, path string, in, out interface{}) error {
+	token, err := z.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, z.cfg.APIURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := z.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		// The token was revoked or expired early; fetch a new one next time
+		z.mu.Lock()
+		z.token = ""
+		z.mu.Unlock()
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrZoomMeetingNotFound
+	}
+	if resp.StatusCode >= 300 {
+		var zerr zoomError
+		_ = json.NewDecoder(resp.Body).Decode(&zerr)
+		return fmt.Errorf("zoom API returned %d: %s (code %d)", resp.StatusCode, zerr.Message, zerr.Code)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// accessToken returns the cached access token, requesting a new one from
+// the account credentials grant when it is about to expire
+func (z *ZoomProvider) accessToken(ctx context.Context) (string, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if z.token != "" && time.Now().Before(z.tokenExpiry.Add(-tokenRefreshMargin)) {
+		return z.token, nil
+	}
+
+	form := url.Values{
+		"grant_type": {"account_credentials"},
+		"account_id": {z.cfg.AccountID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, z.cfg.OAuthURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(z.cfg.ClientID, z.cfg.ClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := z.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get zoom access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get zoom access token: status %d", resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"` // seconds
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode zoom access token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("zoom returned an empty access token")
+	}
+
+	z.token = token.AccessToken
+	z.tokenExpiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return z.token, nil
+}
+
+// ZoomWebhook is a Zoom event notification
+type ZoomWebhook struct {
+	Event   string `json:"event"`
+	EventTS int64  `json:"event_ts"` // milliseconds
+	Payload struct {
+		PlainToken string `json:"plainToken"` // endpoint.url_validation only
+		Object     struct {
+			ID          zoomID `json:"id"`
+			StartTime   string `json:"start_time"`
+			EndTime     string `json:"end_time"`
+			Participant struct {
+				UserID   string `json:"user_id"` // per meeting instance
+				UserName string `json:"user_name"`
+				Email    string `json:"email"`
+				JoinTime string `json:"join_time"`
+				Leave    string `json:"leave_time"`
+			} `json:"participant"`
+		} `json:"object"`
+	} `json:"payload"`
+}
+
+// zoomID is a meeting ID, which Zoom sends as a number or a string
+type zoomID string
+
+func (id *zoomID) UnmarshalJSON(data []byte) error {
+	*id = zoomID(strings.Trim(string(data), `"`))
+	return nil
+}
+
+// VerifyWebhook checks the signature of a webhook request and decodes it.
+// Zoom signs "v0:{timestamp}:{body}" with the webhook secret.
+func (z *ZoomProvider) VerifyWebhook(header http.Header, body []byte) (*ZoomWebhook, error) {
+	if z.cfg.WebhookSecret == "" {
+		return nil, ErrZoomNotConfigured
+	}
+
+	timestamp := header.Get("x-zm-request-timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidWebhook
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > webhookMaxAge || age < -webhookMaxAge {
+		return nil, ErrInvalidWebhook
+	}
+
+	expected := "v0=" + z.sign("v0:"+timestamp+":"+string(body))
+	if !hmac.Equal([]byte(expected), []byte(header.Get("x-zm-signature"))) {
+		return nil, ErrInvalidWebhook
+	}
+
+	var hook ZoomWebhook
+	if err := json.Unmarshal(body, &hook); err != nil {
+		return nil, fmt.Errorf("failed to decode zoom webhook: %w", err)
+	}
+	return &hook, nil
+}
+
+// ValidationResponse answers Zoom's endpoint.url_validation challenge
+func (z *ZoomProvider) ValidationResponse(plainToken string) map[string]string {
+	return map[string]string{
+		"plainToken":     plainToken,
+		"encryptedToken": z.sign(plainToken),
+	}
+}
+
+// sign returns the hex HMAC-SHA256 of a message with the webhook secret
+func (z *ZoomProvider) sign(message string) string {
+	mac := hmac.New(sha256.New, []byte(z.cfg.WebhookSecret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// event returns the meeting event a webhook reports, or false for events
+// VTP does not follow
+func (h *ZoomWebhook) event() (MeetingEvent, bool) {
+	obj := h.Payload.Object
+	event := MeetingEvent{
+		Provider:   ProviderZoom,
+		ExternalID: string(obj.ID),
+		At:         time.UnixMilli(h.EventTS),
+	}
+	at := func(value string) {
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			event.At = t
+		}
+	}
+
+	switch h.Event {
+	case ZoomEventMeetingStarted:
+		event.Type = EventMeetingStarted
+		at(obj.StartTime)
+	case ZoomEventMeetingEnded:
+		event.Type = EventMeetingEnded
+		at(obj.EndTime)
+	case ZoomEventParticipantJoined:
+		event.Type = EventParticipantJoined
+		at(obj.Participant.JoinTime)
+	case ZoomEventParticipantLeft:
+		event.Type = EventParticipantLeft
+		at(obj.Participant.Leave)
+	default:
+		return MeetingEvent{}, false
+	}
+	if event.Type == EventParticipantJoined || event.Type == EventParticipantLeft {
+		event.ParticipantID = obj.Participant.UserID
+		event.ParticipantName = obj.Participant.UserName
+		event.Email = obj.Participant.Email
+	}
+	return event, true
+}
@@ -0,0 +1,227 @@
+package videointegration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeZoom is a stand-in for the Zoom OAuth and REST APIs
+type fakeZoom struct {
+	server      *httptest.Server
+	tokens      atomic.Int32
+	lastMeeting zoomMeeting
+	deleted     []string
+}
+
+func newFakeZoom(t *testing.T) *fakeZoom {
+	t.Helper()
+	f := &fakeZoom{}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "secret" ||
+			r.FormValue("grant_type") != "account_credentials" || r.FormValue("account_id") != "account" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := f.tokens.Add(1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "token-" + strconv.Itoa(int(n)),
+			"expires_in":   3600,
+		})
+	})
+
+	authorized := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer token-"+strconv.Itoa(int(f.tokens.Load())) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+	mux.HandleFunc("POST /v2/users/{user}/meetings", authorized(func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("user") != "teacher@example.com" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&f.lastMeeting)
+		created := f.lastMeeting
+		created.ID = 85746065432
+		created.JoinURL = "https://zoom.example/j/85746065432"
+		created.StartURL = "https://zoom.example/s/85746065432?zak=1"
+		if created.Password == "" {
+			created.Password = "gen123"
+		}
+		json.NewEncoder(w).Encode(created)
+	}))
+	mux.HandleFunc("PATCH /v2/meetings/{id}", authorized(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&f.lastMeeting)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("GET /v2/meetings/{id}", authorized(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(zoomMeeting{
+			ID:       85746065432,
+			JoinURL:  "https://zoom.example/j/85746065432",
+			StartURL: "https://zoom.example/s/85746065432?zak=2",
+		})
+	}))
+	mux.HandleFunc("DELETE /v2/meetings/{id}", authorized(func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "404" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(zoomError{Code: 3001, Message: "Meeting does not exist"})
+			return
+		}
+		f.deleted = append(f.deleted, r.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeZoom) provider() *ZoomProvider {
+	return NewZoomProvider(ZoomConfig{
+		AccountID:     "account",
+		ClientID:      "client",
+		ClientSecret:  "secret",
+		WebhookSecret: "hook-secret",
+		HostUser:      "teacher@example.com",
+		APIURL:        f.server.URL + "/v2",
+		OAuthURL:      f.server.URL + "/oauth/token",
+	}, nil)
+}
+
+// TestZoomMeetingLifecycle tests creating, updating, refreshing and
+// deleting a Zoom meeting with one cached access token
+func TestZoomMeetingLifecycle(t *testing.T) {
+	f := newFakeZoom(t)
+	z := f.provider()
+	ctx := context.Background()
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.FixedZone("AST", 3*3600))
+
+	details, err := z.CreateMeeting(ctx, "رياضيات", start, 45, MeetingSettings{WaitingRoom: true, MuteUponEntry: true})
+	if err != nil {
+		t.Fatalf("CreateMeeting failed: %v", err)
+	}
+	if details.ExternalID != "85746065432" || details.MeetingLink != "https://zoom.example/j/85746065432" {
+		t.Errorf("Unexpected meeting details: %+v", details)
+	}
+	if details.HostLink == details.MeetingLink || details.Password != "gen123" {
+		t.Errorf("Expected a separate start URL and a generated passcode, got %+v", details)
+	}
+	if f.lastMeeting.StartTime != "2026-03-01T06:00:00Z" || f.lastMeeting.Type != 2 || f.lastMeeting.Duration != 45 {
+		t.Errorf("Unexpected meeting request: %+v", f.lastMeeting)
+	}
+	if f.lastMeeting.Settings == nil || !f.lastMeeting.Settings.WaitingRoom || !f.lastMeeting.Settings.MuteUponEntry {
+		t.Errorf("Expected settings to be sent, got %+v", f.lastMeeting.Settings)
+	}
+
+	if err := z.UpdateMeeting(ctx, details.ExternalID, "رياضيات", start.Add(time.Hour), 60, MeetingSettings{Passcode: "abc"}); err != nil {
+		t.Fatalf("UpdateMeeting failed: %v", err)
+	}
+	if f.lastMeeting.StartTime != "2026-03-01T07:00:00Z" || f.lastMeeting.Password != "abc" {
+		t.Errorf("Unexpected update request: %+v", f.lastMeeting)
+	}
+
+	info, err := z.GetMeetingInfo(ctx, details.ExternalID)
+	if err != nil {
+		t.Fatalf("GetMeetingInfo failed: %v", err)
+	}
+	if info.HostLink != "https://zoom.example/s/85746065432?zak=2" {
+		t.Errorf("Expected a fresh start URL, got %s", info.HostLink)
+	}
+
+	if err := z.DeleteMeeting(ctx, details.ExternalID); err != nil {
+		t.Fatalf("DeleteMeeting failed: %v", err)
+	}
+	if err := z.DeleteMeeting(ctx, "404"); err != nil {
+		t.Errorf("Expected deleting a missing meeting to succeed, got %v", err)
+	}
+	if len(f.deleted) != 1 {
+		t.Errorf("Expected one deletion, got %v", f.deleted)
+	}
+
+	if n := f.tokens.Load(); n != 1 {
+		t.Errorf("Expected one access token request, got %d", n)
+	}
+}
+
+// TestZoomTokenRefresh tests that a rejected token is replaced
+func TestZoomTokenRefresh(t *testing.T) {
+	f := newFakeZoom(t)
+	z := f.provider()
+	ctx := context.Background()
+
+	if _, err := z.GetMeetingInfo(ctx, "1"); err != nil {
+		t.Fatalf("GetMeetingInfo failed: %v", err)
+	}
+	// Another instance renews the token, revoking ours
+	f.tokens.Add(1)
+	if _, err := z.GetMeetingInfo(ctx, "1"); err == nil {
+		t.Fatal("Expected the revoked token to be rejected")
+	}
+	if _, err := z.GetMeetingInfo(ctx, "1"); err != nil {
+		t.Fatalf("Expected a new token to be used, got %v", err)
+	}
+}
+
+// TestZoomInvalidSettings tests that unknown recording modes are rejected
+func TestZoomInvalidSettings(t *testing.T) {
+	f := newFakeZoom(t)
+	_, err := f.provider().CreateMeeting(context.Background(), "x", time.Now(), 30, MeetingSettings{AutoRecording: "tape"})
+	if !errors.Is(err, ErrUnsupportedRecording) {
+		t.Errorf("Expected ErrUnsupportedRecording, got %v", err)
+	}
+}
+
+func signedHeader(z *ZoomProvider, at time.Time, body []byte) http.Header {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	header := http.Header{}
+	header.Set("x-zm-request-timestamp", timestamp)
+	header.Set("x-zm-signature", "v0="+z.sign("v0:"+timestamp+":"+string(body)))
+	return header
+}
+
+// TestZoomWebhookSignature tests webhook verification and URL validation
+func TestZoomWebhookSignature(t *testing.T) {
+	z := newFakeZoom(t).provider()
+	body := []byte(`{"event":"meeting.participant_joined","event_ts":1772344800000,"payload":{"object":{"id":85746065432,` +
+		`"participant":{"user_id":"16778240","user_name":"Sara","email":"sara@example.com","join_time":"2026-03-01T06:02:00Z"}}}}`)
+
+	hook, err := z.VerifyWebhook(signedHeader(z, time.Now(), body), body)
+	if err != nil {
+		t.Fatalf("VerifyWebhook failed: %v", err)
+	}
+	event, ok := hook.event()
+	if !ok || event.Type != EventParticipantJoined || event.ExternalID != "85746065432" {
+		t.Fatalf("Unexpected event: %+v", event)
+	}
+	if event.Email != "sara@example.com" || event.ParticipantID != "16778240" ||
+		!event.At.Equal(time.Date(2026, 3, 1, 6, 2, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected participant: %+v", event)
+	}
+
+	tampered := append([]byte{}, body...)
+	tampered[len(tampered)-3] = 'X'
+	if _, err := z.VerifyWebhook(signedHeader(z, time.Now(), body), tampered); !errors.Is(err, ErrInvalidWebhook) {
+		t.Errorf("Expected a tampered body to be rejected, got %v", err)
+	}
+	if _, err := z.VerifyWebhook(signedHeader(z, time.Now().Add(-time.Hour), body), body); !errors.Is(err, ErrInvalidWebhook) {
+		t.Errorf("Expected an old delivery to be rejected, got %v", err)
+	}
+
+	resp := z.ValidationResponse("plain")
+	if resp["plainToken"] != "plain" || resp["encryptedToken"] != z.sign("plain") {
+		t.Errorf("Unexpected validation response: %v", resp)
+	}
+}
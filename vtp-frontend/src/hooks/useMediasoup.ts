@@ -209,6 +209,7 @@ export const useMediasoup = (roomId: string) => {
           await videoProducerRef.current.replaceTrack({ track: screenTrack });
         }
         setIsScreenSharing(true);
+        signalingRef.current?.reportScreenShare(true);
         screenTrack.onended = () => {
           // Auto disable when user stops share
           toggleScreenShare(false);
@@ -221,6 +222,7 @@ export const useMediasoup = (roomId: string) => {
         await videoProducerRef.current.replaceTrack({ track: originalCameraTrackRef.current });
       }
       setIsScreenSharing(false);
+      signalingRef.current?.reportScreenShare(false);
     }
   }, [localStream]);
 
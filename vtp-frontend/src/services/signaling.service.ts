@@ -44,6 +44,8 @@ export default class SignalingService {
       query: {
         roomId: this.roomId,
         userId: this.userId,
+        // The server reads the token from the handshake query
+        token: this.token,
       },
       auth: {
         token: this.token,
@@ -214,6 +216,17 @@ export default class SignalingService {
     }
   }
 
+  // Tell the room (and composite recordings) that this user started or
+  // stopped sharing their screen
+  reportScreenShare(active: boolean) {
+    this.socket.emit('screen-share', JSON.stringify({ room_id: this.roomId, active }));
+  }
+
+  // Tell the room who is speaking, as detected from audio levels
+  reportActiveSpeaker(userId: string) {
+    this.socket.emit('active-speaker', JSON.stringify({ room_id: this.roomId, user_id: userId }));
+  }
+
   onNewProducer(callback: (producerId: string, peerId: string, kind: string) => void) {
     this.socket.on('newProducer', ({ producerId, peerId, kind }: any) => {
       callback(producerId, peerId, kind);